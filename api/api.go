@@ -22,6 +22,7 @@ import (
 	accountApi "github.com/hanzoai/commerce/api/account"
 	affiliateApi "github.com/hanzoai/commerce/api/affiliate"
 	apikeyApi "github.com/hanzoai/commerce/api/apikey"
+	auditApi "github.com/hanzoai/commerce/api/audit"
 	authApi "github.com/hanzoai/commerce/api/auth"
 	b2bApi "github.com/hanzoai/commerce/api/b2b"
 	billingApi "github.com/hanzoai/commerce/api/billing"
@@ -44,6 +45,7 @@ import (
 	giftcardApi "github.com/hanzoai/commerce/api/giftcard"
 	inventoryApi "github.com/hanzoai/commerce/api/inventory"
 	inviteApi "github.com/hanzoai/commerce/api/invite"
+	jobsApi "github.com/hanzoai/commerce/api/jobs"
 	libraryApi "github.com/hanzoai/commerce/api/library"
 	metricsApi "github.com/hanzoai/commerce/api/metrics"
 	namespaceApi "github.com/hanzoai/commerce/api/namespace"
@@ -56,11 +58,14 @@ import (
 	producttaxonomyApi "github.com/hanzoai/commerce/api/producttaxonomy"
 	promoApi "github.com/hanzoai/commerce/api/promo"
 	promotionApi "github.com/hanzoai/commerce/api/promotion"
+	recommendApi "github.com/hanzoai/commerce/api/recommend"
 	referralApi "github.com/hanzoai/commerce/api/referral"
 	regionApi "github.com/hanzoai/commerce/api/region"
+	returnApi "github.com/hanzoai/commerce/api/return"
 	reviewApi "github.com/hanzoai/commerce/api/review"
 	searchApi "github.com/hanzoai/commerce/api/search"
 	storeApi "github.com/hanzoai/commerce/api/store"
+	storefrontApi "github.com/hanzoai/commerce/api/storefront"
 	subscriptionApi "github.com/hanzoai/commerce/api/subscription"
 	taxApi "github.com/hanzoai/commerce/api/tax"
 	transactionApi "github.com/hanzoai/commerce/api/transaction"
@@ -136,6 +141,7 @@ func Route(api zip.Router) {
 	paymentApi.Route(api, tokenRequired)
 
 	accountApi.Route(api, tokenRequired)
+	auditApi.Route(api, tokenRequired) // who changed what, per org (RequireAdmin inside)
 	billingApi.Route(api, tokenRequired)
 	costsApi.Route(api, tokenRequired)
 	metricsApi.Route(api, tokenRequired) // SaaS ops god-view (revenue/subs/usage/customers) — global-admin gated inside
@@ -152,6 +158,7 @@ func Route(api zip.Router) {
 	orderApi.Route(api, tokenRequired, requireAccess)
 	referralApi.Route(api, tokenRequired)
 	payablesApi.Route(api, adminRequired) // what we owe + manual payment records (RequirePlatformAdmin inside)
+	jobsApi.Route(api, adminRequired)     // scheduled jobs: schedules, run history, run now (RequirePlatformAdmin inside)
 	affiliateApi.Route(api, tokenRequired)
 	regionApi.Route(api, tokenRequired)
 	reviewApi.Route(api, tokenRequired)
@@ -178,6 +185,7 @@ func Route(api zip.Router) {
 	exchangeApi.Route(api, tokenRequired)                  // order exchanges (return + replacement)
 	currencyApi.Route(api, adminRequired)                  // currency reference table CRUD (global default-ns; public list on commerce group)
 	claimApi.Route(api, tokenRequired)                     // order claims (damaged/wrong/missing → refund or replacement)
+	returnApi.Route(api, tokenRequired)                    // returns (RMA): approve, label, receive/restock, refund/store credit/exchange
 	draftorderApi.Route(api, tokenRequired, requireAccess) // admin order builder: draft orders + line items → complete into a real order
 	producttaxonomyApi.Route(api, tokenRequired)           // product options/values, categories, tags, types, return/refund reasons
 	catalogApi.AdminRoute(api, adminRequired)              // platform product catalog CMS (global-admin gated inside)
@@ -203,6 +211,8 @@ func Route(api zip.Router) {
 	user.Route(api, tokenRequired)
 
 	searchApi.Route(api, tokenRequired)
+	storefrontApi.Route(api, tokenRequired) // GET /products/search, scoped by the x-publishable-api-key's sales channels
+	recommendApi.Route(api)                 // similar, bought-together and per-customer recommendations (auth inside)
 
 	// Namespace API
 	namespaceApi.Route(api)
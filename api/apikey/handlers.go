@@ -10,6 +10,7 @@ import (
 	"github.com/hanzoai/commerce/models/apipermission"
 	"github.com/hanzoai/commerce/models/publishableapikey"
 	"github.com/hanzoai/commerce/models/role"
+	"github.com/hanzoai/commerce/models/roleassignment"
 	"github.com/hanzoai/commerce/util/json/http"
 	"github.com/hanzoai/commerce/util/rest"
 )
@@ -24,6 +25,12 @@ func Route(router zip.Router, args ...zip.Handler) {
 	// RBAC CRUD
 	rest.New(role.Role{}).Route(router, args...)
 	rest.New(apipermission.ApiPermission{}).Route(router, args...)
+	rest.New(roleassignment.RoleAssignment{}).Route(router, args...)
+
+	rbacApi := rest.New("/rbac")
+	rbacApi.GET("/roles", append(args, BuiltinRoles)...)
+	rbacApi.GET("/explain", append(args, namespaced, Explain)...)
+	rbacApi.Route(router, args...)
 }
 
 // Revoke marks an API key as revoked by setting RevokedAt to the current time.
@@ -0,0 +1,150 @@
+package apikey
+
+import (
+	"errors"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/roleassignment"
+	"github.com/hanzoai/commerce/rbac"
+	"github.com/hanzoai/commerce/util/bit"
+	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/rest"
+)
+
+// builtinRole is a built-in role as the API lists it.
+type builtinRole struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// BuiltinRoles lists the built-in roles and what they allow.
+//
+//	GET /rbac/roles
+func BuiltinRoles(c *zip.Ctx) error {
+	roles := make([]builtinRole, 0, len(rbac.Builtin))
+	for _, name := range rbac.BuiltinRoles() {
+		roles = append(roles, builtinRole{Name: name, Permissions: rbac.Builtin[name]})
+	}
+	return http.Render(c, 200, roles)
+}
+
+// Explain answers whether a subject may take an action on a resource, and
+// why: the roles it holds, and the permission that allowed or denied it. A
+// subject with no roles is answered from its token's permissions where they
+// are known here — the caller's own, or an API key's.
+//
+// Anyone may ask about themselves, the default subject. Asking about
+// another takes roleassignment:read, or an admin when the caller has no
+// roles.
+//
+//	GET /rbac/explain?subject=apikey:live-secret-key&resource=order&action=read
+func Explain(c *zip.Ctx) error {
+	org, ok := middleware.GetOrganizationOK(c)
+	if !ok || org == nil {
+		return http.Fail(c, 401, "Authentication required", errors.New("no authenticated organization"))
+	}
+
+	resource, action := c.Query("resource"), c.Query("action")
+	if resource == "" || action == "" {
+		return http.Fail(c, 400, "resource and action are required", errors.New("missing resource or action"))
+	}
+
+	self, known := middleware.RBACSubject(c)
+	subject, isSelf := self, known
+	if s := c.Query("subject"); s != "" {
+		parsed, err := rbac.ParseSubject(s)
+		if err != nil {
+			return http.Fail(c, 400, err.Error(), err)
+		}
+		subject, isSelf = parsed, known && parsed == self
+	}
+	if subject.Id == "" {
+		return http.Fail(c, 400, "subject is required", errors.New("caller has no subject to explain"))
+	}
+	if !isSelf && !mayReadRoles(c) {
+		return nil
+	}
+
+	db := datastore.NewNamespaced(org.Namespaced(c.Context()))
+	grants, err := rbac.Grants(db, subject)
+	if err != nil {
+		log.Error("rbac: explain %s: %v", subject, err, c)
+		return http.Fail(c, 500, "Failed to load roles", err)
+	}
+
+	d := rbac.Evaluate(subject, grants, resource, action)
+	if !d.Enforced {
+		explainPermissions(c, org, subject, isSelf, &d)
+	}
+	return http.Render(c, 200, d)
+}
+
+// mayReadRoles renders the failure and returns false unless the caller may
+// see another subject's roles.
+func mayReadRoles(c *zip.Ctx) bool {
+	d, err := middleware.Authorization(c, "roleassignment", rbac.Read)
+	if err != nil {
+		_ = http.Fail(c, 500, "Failed to load roles", err)
+		return false
+	}
+	if !d.Enforced {
+		return middleware.RequireAdmin(c)
+	}
+	if !d.Allowed {
+		_ = http.Fail(c, 403, d.Reason, errors.New(d.Reason))
+	}
+	return d.Allowed
+}
+
+// explainPermissions decides d, for a subject with no roles, the way rest
+// would from the subject's token permissions. Only the standard actions of
+// a model have a permission table to decide by; anything else is left to
+// the route's own checks, and said so.
+func explainPermissions(c *zip.Ctx, org *organization.Organization, subject rbac.Subject, isSelf bool, d *rbac.Decision) {
+	var perms bit.Field
+	switch {
+	case isSelf:
+		f, ok := c.Locals("permissions").(bit.Field)
+		if !ok {
+			d.Reason = subject.String() + " has no roles, and no token permissions"
+			d.Allowed = false
+			return
+		}
+		perms = f
+	case subject.Type == roleassignment.APIKey:
+		tok, err := org.GetTokenByName(subject.Id)
+		if err != nil {
+			d.Reason = subject.String() + " has no roles, and the org has no API key by that name"
+			d.Allowed = false
+			return
+		}
+		perms = tok.Permissions
+	default:
+		d.Reason = subject.String() + " has no roles; the permissions its IAM token carries decide"
+		return
+	}
+
+	method := map[string]string{rbac.Read: "get", rbac.Write: "update", rbac.Delete: "delete"}[d.Action]
+	masks, ok := rest.DefaultPermissions[d.Resource][method]
+	if method == "" || !ok {
+		d.Reason = subject.String() + " has no roles; " + d.Resource + ":" + d.Action + " is decided by the route's own permission checks"
+		return
+	}
+	d.Allowed = false
+	for _, m := range masks {
+		if perms.Has(m) {
+			d.Allowed = true
+			break
+		}
+	}
+	if d.Allowed {
+		d.Reason = subject.String() + " has no roles, and its token's permissions allow " + d.Resource + ":" + d.Action
+	} else {
+		d.Reason = subject.String() + " has no roles, and its token's permissions do not allow " + d.Resource + ":" + d.Action
+	}
+}
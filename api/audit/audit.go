@@ -0,0 +1,127 @@
+// Package audit is the query surface of the audit log: an org admin reads who
+// changed what in their org, newest first, a page at a time.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	auditlog "github.com/hanzoai/commerce/audit"
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/util/json/http"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+func Route(router zip.Router, args ...zip.Handler) {
+	api := router.Group("audit")
+	api.Use(args...)
+
+	api.Get("", List)
+}
+
+// entry is a record as the API returns it: the record with its diff decoded.
+type entry struct {
+	*db.AuditRecord
+	Diff json.RawMessage `json:"diff"`
+}
+
+// List returns the caller's org's audit records, newest first.
+//
+//	GET /v1/audit?actor=&resourceKind=&resourceId=&action=&since=&until=&cursor=&limit=
+//
+// since and until are RFC 3339 times. cursor is the nextCursor of the page
+// before; a page with no nextCursor is the last. A platform admin may read
+// another org's log with ?org=, and the records that belong to no org with
+// ?org=_system.
+//
+// ORG ADMIN ONLY. The log names who did what to every customer and payment in
+// the org; it is not for a storefront key or a non-admin member.
+func List(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+
+	store := auditlog.Store()
+	if store == nil {
+		return http.Fail(c, 503, "Audit log unavailable", errors.New("no audit store"))
+	}
+
+	org := middleware.GetOrganization(c).Name
+	if other := strings.TrimSpace(c.Query("org")); other != "" && other != org {
+		if !middleware.MayReadPlatform(c) {
+			return http.Fail(c, 403, "Cannot read another organization's audit log", errors.New("cross-org audit read"))
+		}
+		org = other
+	}
+
+	f := db.AuditFilter{
+		Org:          org,
+		ActorID:      c.Query("actor"),
+		ResourceKind: c.Query("resourceKind"),
+		ResourceID:   c.Query("resourceId"),
+		Action:       c.Query("action"),
+		Limit:        defaultLimit,
+	}
+	var err error
+	if f.Since, err = queryTime(c, "since"); err != nil {
+		return http.Fail(c, 400, "since must be an RFC 3339 time", err)
+	}
+	if f.Until, err = queryTime(c, "until"); err != nil {
+		return http.Fail(c, 400, "until must be an RFC 3339 time", err)
+	}
+	if s := c.Query("cursor"); s != "" {
+		if f.Before, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return http.Fail(c, 400, "Invalid cursor", err)
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return http.Fail(c, 400, "limit must be a positive number", errors.New("invalid limit"))
+		}
+		if n > maxLimit {
+			n = maxLimit
+		}
+		f.Limit = n
+	}
+
+	// One more than the page, to know whether there is a next one without a
+	// second query.
+	want := f.Limit
+	f.Limit++
+	recs, err := store.ListAudit(c.Context(), f)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to read audit log", err)
+	}
+
+	res := map[string]interface{}{"hasMore": false}
+	if len(recs) > want {
+		recs = recs[:want]
+		res["hasMore"] = true
+		res["nextCursor"] = strconv.FormatUint(recs[want-1].Seq, 10)
+	}
+	data := make([]entry, 0, len(recs))
+	for _, rec := range recs {
+		data = append(data, entry{AuditRecord: rec, Diff: json.RawMessage(rec.Diff)})
+	}
+	res["data"] = data
+	return http.Render(c, 200, res)
+}
+
+func queryTime(c *zip.Ctx, name string) (time.Time, error) {
+	s := c.Query(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -201,12 +201,12 @@ func GrantAllotment(c *zip.Ctx) error {
 // an active/trialing subscription in the given org datastore, for the UTC month
 // containing `now`. Idempotent per (user, period). Returns a result per user.
 // Shared by the standalone allotment-run endpoint and the billing cycle.
-func grantOrgAllotments(c *zip.Ctx, db *datastore.Datastore, now time.Time, live bool) (granted, skipped int, results []map[string]any) {
+func grantOrgAllotments(ctx context.Context, db *datastore.Datastore, now time.Time, live bool) (granted, skipped int, results []map[string]any) {
 	rootKey := db.NewKey("synckey", "", 1, nil)
 
 	subs := make([]*subscription.Subscription, 0)
 	if _, err := subscription.Query(db).Ancestor(rootKey).GetAll(&subs); err != nil {
-		log.Error("Failed to list subscriptions for allotment run: %v", err, c)
+		log.Error("Failed to list subscriptions for allotment run: %v", err, ctx)
 		return 0, 0, nil
 	}
 
@@ -238,7 +238,7 @@ func grantOrgAllotments(c *zip.Ctx, db *datastore.Datastore, now time.Time, live
 		cents := IncludedMonthlyCents(plan)
 		res, err := allotment.Grant(db, user, plan, cents, now, !live)
 		if err != nil {
-			log.Error("allotment run: grant failed for %s: %v", user, err, c)
+			log.Error("allotment run: grant failed for %s: %v", user, err, ctx)
 			results = append(results, map[string]any{"user": user, "plan": plan, "granted": false, "error": err.Error()})
 			continue
 		}
@@ -270,7 +270,7 @@ func RunAllotments(c *zip.Ctx) error {
 
 	now := time.Now()
 	// live = !TestMode: allotment grants land in the SAME bucket as charges/usage.
-	granted, skipped, results := grantOrgAllotments(c, db, now, !org.TestMode())
+	granted, skipped, results := grantOrgAllotments(c.Context(), db, now, !org.TestMode())
 
 	return c.JSON(200, map[string]any{
 		"period":  allotment.Period(now),
@@ -6,6 +6,7 @@ import (
 	"github.com/zap-proto/zip"
 
 	"github.com/hanzoai/commerce/middleware/iammiddleware"
+	"github.com/hanzoai/commerce/rbac"
 	"github.com/hanzoai/commerce/util/bit"
 	"github.com/hanzoai/commerce/util/permission"
 )
@@ -69,3 +70,45 @@ func callerMayReachBillingSubject(c *zip.Ctx, ownerIDs ...string) bool {
 	}
 	return false
 }
+
+// billingKinds names the billing routes that act on one kind of record by that
+// kind, as roles name it: "/refunds/:id" is a refund. The first segment of the
+// route's path below /billing picks it.
+var billingKinds = map[string]string{
+	"balance-transactions":       "balance-transaction",
+	"bank-transfer-instructions": "bank-transfer-instruction",
+	"credit-notes":               "credit-note",
+	"credits":                    "credit-grant",
+	"customer-balance":           "customer-balance",
+	"disputes":                   "dispute",
+	"events":                     "billing-event",
+	"invoices":                   "billing-invoice",
+	"meter-events":               "meter-event",
+	"meters":                     "meter",
+	"oss-accruals":               "oss-accrual",
+	"payment-intents":            "payment-intent",
+	"payouts":                    "billing-payout",
+	"pricing-rules":              "billing-pricing-rule",
+	"refunds":                    "refund",
+	"setup-intents":              "setup-intent",
+	"subscription-items":         "subscription-item",
+	"subscription-schedules":     "subscription-schedule",
+	"subscriptions":              "subscription",
+}
+
+// billingAuthz names a billing route to the caller's roles: the kind it acts
+// on and what it does to it, so POST /refunds is refund:write and
+// POST /invoices/:id/pay is billing-invoice:pay. A route on no one kind, such
+// as /balance or /deposit, is billing's own.
+func billingAuthz(method, path string) (string, string) {
+	seg, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if kind, ok := billingKinds[seg]; ok {
+		return kind, rbac.ActionFor(method, rest)
+	}
+	return "billing", rbac.ActionFor(method, path)
+}
+
+// dnsAuthz names a DNS billing route to the caller's roles.
+func dnsAuthz(method, path string) (string, string) {
+	return "dns", rbac.ActionFor(method, path)
+}
@@ -1,6 +1,7 @@
 package billing
 
 import (
+	"context"
 	"time"
 
 	"github.com/zap-proto/zip"
@@ -11,6 +12,7 @@ import (
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/models/organization"
 	"github.com/hanzoai/commerce/models/subscription"
+	"github.com/hanzoai/commerce/thirdparty/kms"
 	"github.com/hanzoai/commerce/util/json/http"
 )
 
@@ -36,11 +38,11 @@ func RunBillingCycle(c *zip.Ctx) error {
 	hydratePaymentCreds(c, org)
 	db := datastore.New(org.Namespaced(c.Context()))
 
-	results := renewDueSubscriptions(c, db, chargeProviderForOrg(org))
+	results := renewDueSubscriptions(c.Context(), db, chargeProviderForOrg(org))
 
 	// Top up each active subscriber's included monthly allotment for the
 	// current period (idempotent per user+month).
-	allotGranted, allotSkipped, _ := grantOrgAllotments(c, db, time.Now(), !org.TestMode())
+	allotGranted, allotSkipped, _ := grantOrgAllotments(c.Context(), db, time.Now(), !org.TestMode())
 
 	return c.JSON(200, map[string]any{
 		"processed": len(results),
@@ -70,7 +72,7 @@ func RunBillingCycleUser(c *zip.Ctx) error {
 		return http.Fail(c, 400, "userId is required", nil)
 	}
 
-	results := renewDueSubscriptionsForUser(c, db, req.UserId, chargeProviderForOrg(org))
+	results := renewDueSubscriptionsForUser(c.Context(), db, req.UserId, chargeProviderForOrg(org))
 
 	return c.JSON(200, map[string]any{
 		"user":      req.UserId,
@@ -79,44 +81,70 @@ func RunBillingCycleUser(c *zip.Ctx) error {
 	})
 }
 
+// CycleOrgResult is one organization's renewals in a billing cycle run.
+type CycleOrgResult struct {
+	OrgId     string        `json:"orgId"`
+	OrgName   string        `json:"orgName"`
+	Processed int           `json:"processed"`
+	Results   []cycleResult `json:"results"`
+}
+
+// CycleRun is one billing cycle across every organization. Orgs counts those
+// that had anything due, and Results holds only those.
+type CycleRun struct {
+	Orgs           int              `json:"orgs"`
+	TotalProcessed int              `json:"totalProcessed"`
+	Results        []CycleOrgResult `json:"results"`
+}
+
 // RunBillingCycleAllOrgs iterates every organization and processes due
-// subscriptions across all of them. This is intended for the platform
-// scheduler to invoke on a recurring basis.
+// subscriptions across all of them. The in-process scheduler runs the same
+// cycle on its own (RunBillingCycles); this is for a caller that drives it.
 //
 //	POST /v1/billing/cycle/run-all
 func RunBillingCycleAllOrgs(c *zip.Ctx) error {
-	rootDb := datastore.New(c.Context())
-
-	orgs := make([]*organization.Organization, 0)
-	if _, err := organization.Query(rootDb).GetAll(&orgs); err != nil {
+	run, err := RunBillingCycles(c.Context(), kmsOf(c))
+	if err != nil {
 		log.Error("Failed to list organizations for billing cycle: %v", err, c)
 		return http.Fail(c, 500, "failed to list organizations", err)
 	}
+	return c.JSON(200, run)
+}
+
+// RunBillingCycles renews every organization's due subscriptions, and grants
+// its active subscribers the month's included allotment.
+//
+// Like RunAutoRecharge it takes values rather than a request, so the
+// scheduler can run it with none. A renewal that fails is that subscription's
+// result and the run goes on; only failing to list the organizations ends it.
+func RunBillingCycles(ctx context.Context, kmsClient *kms.CachedClient) (*CycleRun, error) {
+	rootDb := datastore.New(ctx)
 
-	type orgResult struct {
-		OrgId     string        `json:"orgId"`
-		OrgName   string        `json:"orgName"`
-		Processed int           `json:"processed"`
-		Results   []cycleResult `json:"results"`
+	orgs := make([]*organization.Organization, 0)
+	if _, err := organization.Query(rootDb).GetAll(&orgs); err != nil {
+		return nil, err
 	}
 
-	allResults := make([]orgResult, 0, len(orgs))
-	totalProcessed := 0
+	run := &CycleRun{Results: make([]CycleOrgResult, 0, len(orgs))}
 
 	now := time.Now()
 	for _, org := range orgs {
 		// Hydrate each org's payment creds so a due renewal can re-charge its
 		// subscribers' vaulted cards via that org's own Square processor.
-		hydratePaymentCreds(c, org)
-		db := datastore.New(org.Namespaced(c.Context()))
-		results := renewDueSubscriptions(c, db, chargeProviderForOrg(org))
-		totalProcessed += len(results)
+		if kmsClient != nil {
+			if err := kms.Hydrate(kmsClient, org); err != nil {
+				log.Error("KMS hydration failed for org %q during billing cycle: %v", org.Name, err, ctx)
+			}
+		}
+		db := datastore.New(org.Namespaced(ctx))
+		results := renewDueSubscriptions(ctx, db, chargeProviderForOrg(org))
+		run.TotalProcessed += len(results)
 
 		// Grant included monthly allotment for active subscribers (idempotent).
-		grantOrgAllotments(c, db, now, !org.TestMode())
+		grantOrgAllotments(ctx, db, now, !org.TestMode())
 
 		if len(results) > 0 {
-			allResults = append(allResults, orgResult{
+			run.Results = append(run.Results, CycleOrgResult{
 				OrgId:     org.Id(),
 				OrgName:   org.Name,
 				Processed: len(results),
@@ -124,18 +152,15 @@ func RunBillingCycleAllOrgs(c *zip.Ctx) error {
 			})
 		}
 	}
+	run.Orgs = len(run.Results)
 
-	return c.JSON(200, map[string]any{
-		"orgs":           len(allResults),
-		"totalProcessed": totalProcessed,
-		"results":        allResults,
-	})
+	return run, nil
 }
 
 // renewDueSubscriptions finds all active or past-due subscriptions whose
 // current period has ended and renews each one. Returns a result per
 // subscription processed.
-func renewDueSubscriptions(c *zip.Ctx, db *datastore.Datastore, chargeProvider engine.ProviderCharger) []cycleResult {
+func renewDueSubscriptions(ctx context.Context, db *datastore.Datastore, chargeProvider engine.ProviderCharger) []cycleResult {
 	now := time.Now()
 	rootKey := db.NewKey("synckey", "", 1, nil)
 
@@ -143,7 +168,7 @@ func renewDueSubscriptions(c *zip.Ctx, db *datastore.Datastore, chargeProvider e
 	q := subscription.Query(db).Ancestor(rootKey)
 
 	if _, err := q.GetAll(&subs); err != nil {
-		log.Error("Failed to query subscriptions for billing cycle: %v", err, c)
+		log.Error("Failed to query subscriptions for billing cycle: %v", err, ctx)
 		return nil
 	}
 
@@ -152,7 +177,7 @@ func renewDueSubscriptions(c *zip.Ctx, db *datastore.Datastore, chargeProvider e
 		if !engine.IsDue(sub, now) {
 			continue
 		}
-		results = append(results, renewOne(c, db, sub, chargeProvider))
+		results = append(results, renewOne(ctx, db, sub, chargeProvider))
 	}
 
 	return results
@@ -160,7 +185,7 @@ func renewDueSubscriptions(c *zip.Ctx, db *datastore.Datastore, chargeProvider e
 
 // renewDueSubscriptionsForUser is the same as renewDueSubscriptions but
 // scoped to a single user.
-func renewDueSubscriptionsForUser(c *zip.Ctx, db *datastore.Datastore, userId string, chargeProvider engine.ProviderCharger) []cycleResult {
+func renewDueSubscriptionsForUser(ctx context.Context, db *datastore.Datastore, userId string, chargeProvider engine.ProviderCharger) []cycleResult {
 	now := time.Now()
 	rootKey := db.NewKey("synckey", "", 1, nil)
 
@@ -168,7 +193,7 @@ func renewDueSubscriptionsForUser(c *zip.Ctx, db *datastore.Datastore, userId st
 	q := subscription.Query(db).Ancestor(rootKey).Filter("UserId=", userId)
 
 	if _, err := q.GetAll(&subs); err != nil {
-		log.Error("Failed to query subscriptions for user %s: %v", userId, err, c)
+		log.Error("Failed to query subscriptions for user %s: %v", userId, err, ctx)
 		return nil
 	}
 
@@ -177,7 +202,7 @@ func renewDueSubscriptionsForUser(c *zip.Ctx, db *datastore.Datastore, userId st
 		if !engine.IsDue(sub, now) {
 			continue
 		}
-		results = append(results, renewOne(c, db, sub, chargeProvider))
+		results = append(results, renewOne(ctx, db, sub, chargeProvider))
 	}
 
 	return results
@@ -185,10 +210,10 @@ func renewDueSubscriptionsForUser(c *zip.Ctx, db *datastore.Datastore, userId st
 
 // renewOne generates an invoice and attempts collection for a single
 // subscription, then persists the updated subscription state.
-func renewOne(c *zip.Ctx, db *datastore.Datastore, sub *subscription.Subscription, chargeProvider engine.ProviderCharger) cycleResult {
-	inv, result, err := engine.RenewSubscription(c.Context(), db, sub, BurnCredits, chargeProvider)
+func renewOne(ctx context.Context, db *datastore.Datastore, sub *subscription.Subscription, chargeProvider engine.ProviderCharger) cycleResult {
+	inv, result, err := engine.RenewSubscription(ctx, db, sub, BurnCredits, chargeProvider)
 	if err != nil {
-		log.Error("Billing cycle: failed to renew subscription %s: %v", sub.Id(), err, c)
+		log.Error("Billing cycle: failed to renew subscription %s: %v", sub.Id(), err, ctx)
 		return cycleResult{
 			UserId:         sub.UserId,
 			SubscriptionId: sub.Id(),
@@ -197,8 +222,8 @@ func renewOne(c *zip.Ctx, db *datastore.Datastore, sub *subscription.Subscriptio
 		}
 	}
 
-	if err := sub.Update(); err != nil {
-		log.Error("Billing cycle: failed to update subscription %s after renewal: %v", sub.Id(), err, c)
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, "subscription.renewed")); err != nil {
+		log.Error("Billing cycle: failed to update subscription %s after renewal: %v", sub.Id(), err, ctx)
 		return cycleResult{
 			UserId:         sub.UserId,
 			SubscriptionId: sub.Id(),
@@ -21,7 +21,12 @@ const mintMountPath = "/v1/billing"
 func Route(r zip.Router, args ...zip.Handler) {
 	adminRequired := middleware.TokenRequired(permission.Admin)
 
-	api := r.Group("billing")
+	// Every route below is also held to the caller's roles, as rest holds the
+	// routes it registers: each is named by the kind of record it acts on and
+	// what it does to it (see billingAuthz), so a finance key may read refunds
+	// but not create one. The mint routes are registered through api and are
+	// held to them too, ahead of the platform gate.
+	api := middleware.Roles(r.Group("billing"), billingAuthz)
 	api.Use(adminRequired)
 
 	// mint is the money-MINT surface: every route registered through it (those
@@ -133,6 +138,7 @@ func Route(r zip.Router, args ...zip.Handler) {
 	api.Get("/payment-intents", ListPaymentIntents)
 	api.Get("/payment-intents/:id", GetPaymentIntent)
 	api.Post("/payment-intents/:id/confirm", ConfirmPaymentIntent)
+	api.Post("/payment-intents/:id/resume", ResumePaymentIntent)
 	api.Post("/payment-intents/:id/capture", CapturePaymentIntent)
 	api.Post("/payment-intents/:id/cancel", CancelPaymentIntent)
 
@@ -257,7 +263,7 @@ func Route(r zip.Router, args ...zip.Handler) {
 	api.Post("/zap", ZapDispatch)
 
 	// DNS billing endpoints
-	dns := r.Group("dns")
+	dns := middleware.Roles(r.Group("dns"), dnsAuthz)
 	dns.Use(adminRequired)
 	dns.Post("/usage", RecordDNSUsage)
 	dns.Get("/usage/summary", GetDNSUsageSummary)
@@ -293,7 +299,7 @@ func Route(r zip.Router, args ...zip.Handler) {
 	// masks on the IAM path since v1.46.5 — see middleware/accesstoken.go.)
 	userRequired := middleware.TokenRequired()
 
-	user := r.Group("billing")
+	user := middleware.Roles(r.Group("billing"), billingAuthz)
 	user.Use(userRequired)
 
 	// Invoice PDF download (user-scoped). Tenant-isolated: the handler loads the
@@ -321,7 +327,7 @@ func Route(r zip.Router, args ...zip.Handler) {
 	user.Get("/plans/:id", middleware.CachePublic(3600), middleware.CFCacheTags("plans"), GetPlan)
 
 	// DNS plans (public catalog, cacheable)
-	dnsUser := r.Group("dns")
+	dnsUser := middleware.Roles(r.Group("dns"), dnsAuthz)
 	dnsUser.Use(userRequired)
 	dnsUser.Get("/plans", middleware.CachePublic(3600), middleware.CFCacheTags("dns-plans"), ListDNSPlans)
 
@@ -10,6 +10,9 @@ import (
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/models/billinginvoice"
+	"github.com/hanzoai/commerce/models/paymentmethod"
+	"github.com/hanzoai/commerce/models/user"
+	"github.com/hanzoai/commerce/tax"
 	"github.com/hanzoai/commerce/types"
 	"github.com/hanzoai/commerce/util/json/http"
 )
@@ -238,6 +241,20 @@ func CalculateInvoiceTax(c *zip.Ctx) error {
 		return http.Fail(c, 400, "country query parameter is required for tax calculation", nil)
 	}
 
+	// Where the seller is and the buyer's tax number decide whether the
+	// invoice is reverse-charged; the billing country and the card's are
+	// the evidence of where the buyer is.
+	if inv.SellerCountry == "" {
+		inv.SellerCountry = org.Country
+	}
+	if inv.CustomerTaxId.Value == "" && inv.UserId != "" {
+		usr := user.New(db)
+		if err := usr.GetById(inv.UserId); err == nil {
+			inv.CustomerTaxId = usr.TaxId
+		}
+	}
+	inv.TaxEvidence = tax.Evidence{BillingCountry: addr.Country, CardCountry: cardCountry(db, inv.UserId)}
+
 	taxLines, totalTax, err := engine.CalculateInvoiceTax(db, inv, addr)
 	if err != nil {
 		log.Error("Failed to calculate tax: %v", err, c)
@@ -249,8 +266,12 @@ func CalculateInvoiceTax(c *zip.Ctx) error {
 		inv.TaxPercent = float64(totalTax) / float64(inv.Subtotal) * 100
 	}
 
-	// Recalculate AmountDue
+	// Recalculate AmountDue; tax included in the prices is already in the
+	// subtotal.
 	inv.AmountDue = inv.Subtotal + inv.Tax - inv.Discount - inv.CreditApplied
+	if len(taxLines) > 0 && taxLines[0].Inclusive {
+		inv.AmountDue -= inv.Tax
+	}
 	if inv.AmountDue < 0 {
 		inv.AmountDue = 0
 	}
@@ -266,3 +287,28 @@ func CalculateInvoiceTax(c *zip.Ctx) error {
 		"totalTax": totalTax,
 	})
 }
+
+// cardCountry is the country that issued the customer's default card, or
+// any card of theirs, or "".
+func cardCountry(db *datastore.Datastore, userId string) string {
+	if userId == "" {
+		return ""
+	}
+	var methods []*paymentmethod.PaymentMethod
+	if _, err := paymentmethod.Query(db).Filter("UserId=", userId).GetAll(&methods); err != nil {
+		return ""
+	}
+	country := ""
+	for _, pm := range methods {
+		if pm.Card == nil || pm.Card.Country == "" {
+			continue
+		}
+		if pm.IsDefault {
+			return pm.Card.Country
+		}
+		if country == "" {
+			country = pm.Card.Country
+		}
+	}
+	return country
+}
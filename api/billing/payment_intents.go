@@ -7,8 +7,12 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/organization"
 	"github.com/hanzoai/commerce/models/paymentintent"
+	"github.com/hanzoai/commerce/models/paymentmethod"
 	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/thirdparty/kms"
 	"github.com/hanzoai/commerce/util/json/http"
 )
 
@@ -116,11 +120,20 @@ func ListPaymentIntents(c *zip.Ctx) error {
 
 type confirmPaymentIntentRequest struct {
 	PaymentMethodId string `json:"paymentMethodId,omitempty"`
+
+	// ReturnUrl is where the customer lands after a 3-D Secure redirect. The
+	// page there calls resume with what the redirect brought back.
+	ReturnUrl string `json:"returnUrl,omitempty"`
 }
 
 // ConfirmPaymentIntent confirms a payment intent.
 //
 //	POST /v1/billing/payment-intents/:id/confirm
+//
+// A card vaulted with a processor that can challenge for strong customer
+// authentication is charged through the org's own account with it, and the
+// intent may come back requires_action with a nextAction for the front end to
+// carry out. Every other method is settled internally, as before.
 func ConfirmPaymentIntent(c *zip.Ctx) error {
 	org := middleware.GetOrganization(c)
 	db := datastore.New(org.Namespaced(c.Context()))
@@ -133,8 +146,21 @@ func ConfirmPaymentIntent(c *zip.Ctx) error {
 	var req confirmPaymentIntentRequest
 	_ = c.Bind(&req)
 
-	// No external processor for now — internal-only
-	if err := engine.ConfirmPaymentIntent(c.Context(), db, pi, req.PaymentMethodId, nil); err != nil {
+	if req.ReturnUrl != "" {
+		pi.ReturnUrl = req.ReturnUrl
+	}
+
+	pmId := req.PaymentMethodId
+	if pmId == "" {
+		pmId = pi.PaymentMethodId
+	}
+	var proc processor.PaymentProcessor
+	pm := paymentmethod.New(db)
+	if pmId != "" && pm.GetById(pmId) == nil {
+		proc = intentProcessor(c, org, pm.ProviderType)
+	}
+
+	if err := engine.ConfirmPaymentIntent(c.Context(), db, pi, req.PaymentMethodId, proc); err != nil {
 		log.Error("Failed to confirm payment intent: %v", err, c)
 		return http.Fail(c, 400, err.Error(), err)
 	}
@@ -142,6 +168,80 @@ func ConfirmPaymentIntent(c *zip.Ctx) error {
 	return c.JSON(200, paymentIntentResponse(pi))
 }
 
+type resumePaymentIntentRequest struct {
+	// Data is what the challenge handed back: the query parameters the
+	// customer returned to the returnUrl with, or the result the processor's
+	// SDK reported.
+	Data map[string]interface{} `json:"data"`
+}
+
+// ResumePaymentIntent finishes a payment intent after its 3-D Secure
+// challenge.
+//
+//	POST /v1/billing/payment-intents/:id/resume
+func ResumePaymentIntent(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	pi := paymentintent.New(db)
+	if err := pi.GetById(c.Param("id")); err != nil {
+		return http.Fail(c, 404, "payment intent not found", err)
+	}
+
+	var req resumePaymentIntentRequest
+	if err := c.Bind(&req); err != nil {
+		return http.Fail(c, 400, "invalid request body", err)
+	}
+
+	// The processor's webhook may settle the challenge at the same moment;
+	// read the intent again under the lock it takes too.
+	unlock, err := engine.LockPaymentIntent(db, pi.Id())
+	if err != nil {
+		return http.Fail(c, 409, "payment intent is being updated; try again", err)
+	}
+	defer unlock()
+	id := pi.Id()
+	pi = paymentintent.New(db)
+	if err := pi.GetById(id); err != nil {
+		return http.Fail(c, 404, "payment intent not found", err)
+	}
+
+	proc := intentProcessor(c, org, pi.ProviderType)
+	if proc == nil {
+		return http.Fail(c, 400, "payment intent has no processor to resume with", nil)
+	}
+
+	if err := engine.ResumePaymentIntent(c.Context(), db, pi, req.Data, proc); err != nil {
+		log.Error("Failed to resume payment intent: %v", err, c)
+		return http.Fail(c, 400, err.Error(), err)
+	}
+
+	return c.JSON(200, paymentIntentResponse(pi))
+}
+
+// intentProcessor is the org's processor of the given type when it can run a
+// strong customer authentication challenge, and nil otherwise. The org's
+// credentials are hydrated from KMS; the org is not saved afterwards.
+func intentProcessor(c *zip.Ctx, org *organization.Organization, providerType string) processor.PaymentProcessor {
+	if providerType == "" {
+		return nil
+	}
+	if creds := kmsOf(c); creds != nil {
+		if err := kms.Hydrate(creds, org); err != nil {
+			log.Error("KMS hydration failed for org %q: %v", org.Name, err, c)
+		}
+	}
+
+	p, err := processorsForOrg(org).Get(processor.ProcessorType(providerType))
+	if err != nil {
+		return nil
+	}
+	if _, ok := p.(processor.AuthenticationProcessor); !ok {
+		return nil
+	}
+	return p
+}
+
 type capturePaymentIntentRequest struct {
 	AmountToCapture int64 `json:"amountToCapture,omitempty"`
 }
@@ -224,6 +324,12 @@ func paymentIntentResponse(pi *paymentintent.PaymentIntent) map[string]interface
 	if pi.LastError != "" {
 		resp["lastError"] = pi.LastError
 	}
+	if pi.NextAction != nil {
+		resp["nextAction"] = pi.NextAction
+	}
+	if pi.ReturnUrl != "" {
+		resp["returnUrl"] = pi.ReturnUrl
+	}
 	if pi.Metadata != nil {
 		resp["metadata"] = pi.Metadata
 	}
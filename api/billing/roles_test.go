@@ -0,0 +1,65 @@
+package billing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/roleassignment"
+	"github.com/hanzoai/commerce/rbac"
+	"github.com/hanzoai/commerce/util/permission"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+// An org admin key that holds only the finance role reads refunds but may not
+// create one: the billing routes are held to the caller's roles although rest
+// does not register them.
+func TestRoles_FinanceKeyCannotCreateRefund(t *testing.T) {
+	t.Setenv("COMMERCE_SERVICE_TOKEN", "")
+	ctx := ae.NewContext()
+	defer ctx.Close()
+	db := datastore.New(ctx)
+
+	org := organization.New(db)
+	org.Name = "acme"
+	org.FullName = "Acme"
+	org.SecretKey = []byte("AAA")
+	key := org.AddToken("finance-key", permission.Admin|permission.Live)
+	if err := org.Put(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := roleassignment.New(datastore.NewNamespaced(org.Namespaced(ctx)))
+	a.SubjectType = roleassignment.APIKey
+	a.SubjectId = "finance-key"
+	a.Roles = []string{rbac.Finance}
+	if err := a.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	eng := engineWithSeed(func(c *zip.Ctx) { c.SetContext(ctx) })
+	call := func(method, path, body string) (int, string) {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := eng.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if status, body := call(http.MethodPost, "/v1/billing/refunds", `{"paymentIntentId":"pi_1","amount":100}`); status != http.StatusForbidden {
+		t.Fatalf("POST /billing/refunds: status=%d body=%s, want 403 for a finance key", status, body)
+	}
+	if status, body := call(http.MethodGet, "/v1/billing/refunds", ""); status == http.StatusForbidden {
+		t.Fatalf("GET /billing/refunds: status=%d body=%s, a finance key reads refunds", status, body)
+	}
+}
@@ -0,0 +1,54 @@
+package billing
+
+import (
+	"net/http"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/middleware/iammiddleware"
+	"github.com/hanzoai/commerce/payment/router"
+)
+
+// PaymentRouterStats reports what the payment router has seen and how it is
+// choosing:
+//
+//	GET /v1/commerce/payments/router
+//
+// The adaptive strategy moves traffic on its own, and a router that moves money
+// between processors without being able to say why is one nobody can be asked
+// to trust. This is the why: per processor, currency and card brand, the
+// attempts and approvals in the window, how many payments were routed there
+// first and how many of those were exploration. A processor losing traffic
+// shows here as approvals falling before Routed does. Circuit breakers are
+// each org's own, over its own credentials, and are not in this picture.
+//
+// SUPERADMIN ONLY, for the reason DepositWatcherStatus is: the outcomes are
+// one record per process, shared by every org's router (payment.RouterForOrg).
+// They are the whole deployment's traffic; there is no tenant slice of them to
+// hand an org admin.
+//
+// Fees, epsilon and minimum samples are each org's own, in the adaptive
+// section of its payment routing settings, and are read and changed there. An
+// org's contracts with its processors are its own; the process router scores
+// nothing and reports the defaults. The window is the process router's, and
+// the same for every org.
+//
+// READ-ONLY. A knob here would let the router's behaviour drift from what its
+// configuration says it is.
+func PaymentRouterStats(c *zip.Ctx) error {
+	if !iammiddleware.IsIAMAuthenticated(c) {
+		return c.JSON(http.StatusUnauthorized, map[string]any{"error": "authentication required"})
+	}
+	if !iammiddleware.GetIAMClaims(c).IsSuperAdmin() {
+		return c.JSON(http.StatusForbidden, map[string]any{"error": "superadmin role required"})
+	}
+
+	// A host that routes through processor.SelectProcessor has no router to
+	// report on; say so rather than serve an empty picture that reads as "no
+	// traffic".
+	r := router.Default()
+	if r == nil {
+		return c.JSON(http.StatusNotFound, map[string]any{"error": "no payment router installed"})
+	}
+	return c.JSON(http.StatusOK, r.Stats())
+}
@@ -608,7 +608,7 @@ func subscribe(ctx context.Context, org *organization.Organization, in Subscribe
 		// failure is non-fatal to the entitlement. Log for reconciliation.
 		log.Error("subscribe: failed to record paid first invoice (subject=%s, ref=%s): %v", in.Subject, res.ProcessorRef, err)
 	}
-	if err := sub.Update(); err != nil {
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, "subscription.updated")); err != nil {
 		log.Error("subscribe: failed to update subscription after first invoice (subject=%s): %v", in.Subject, err)
 	}
 
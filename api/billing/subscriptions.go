@@ -288,7 +288,7 @@ func createSubscription(db *datastore.Datastore, p *plan.Plan, req *createSubscr
 	// Initialize subscription lifecycle
 	engine.StartSubscription(sub, p)
 
-	if err := sub.Create(); err != nil {
+	if err := sub.CreateWithEvents(engine.SubscriptionEvent(sub, "subscription.created")); err != nil {
 		log.Error("Failed to create subscription: %v", err)
 		return nil, err
 	}
@@ -708,7 +708,7 @@ func UpdateBillingSubscription(c *zip.Ctx) error {
 		sub.Quantity = req.Quantity
 	}
 
-	if err := sub.Update(); err != nil {
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, "subscription.updated")); err != nil {
 		log.Error("Failed to update subscription: %v", err, c)
 		return http.Fail(c, 500, "failed to update subscription", err)
 	}
@@ -865,7 +865,7 @@ func cancelSubscription(ctx context.Context, org *organization.Organization, id
 	if err := engine.CancelSubscription(sub, atPeriodEnd); err != nil {
 		return nil, subValidationError{err.Error()}
 	}
-	if err := sub.Update(); err != nil {
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, "subscription.canceled")); err != nil {
 		return nil, err
 	}
 	return sub, nil
@@ -893,7 +893,7 @@ func reactivateSubscription(ctx context.Context, org *organization.Organization,
 	if err := engine.ReactivateSubscription(sub); err != nil {
 		return nil, subValidationError{err.Error()}
 	}
-	if err := sub.Update(); err != nil {
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, "subscription.reactivated")); err != nil {
 		return nil, err
 	}
 	return sub, nil
@@ -987,7 +987,7 @@ func RenewBillingSubscription(c *zip.Ctx) error {
 		return http.Fail(c, 500, "failed to renew subscription", err)
 	}
 
-	if err := sub.Update(); err != nil {
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, "subscription.renewed")); err != nil {
 		log.Error("Failed to update subscription after renewal: %v", err, c)
 		return http.Fail(c, 500, "failed to update subscription", err)
 	}
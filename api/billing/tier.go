@@ -23,7 +23,7 @@ import (
 // registry's configuration plus the one fact that is derived rather than stored.
 //
 // tier.Config is embedded, not copied field by field. The registry is the
-// authority on what a tier allows, and a second declaration of its five fields
+// authority on what a tier allows, and a second declaration of its fields
 // here is how a read and a gate come to disagree about maxAgents.
 type TierLimits struct {
 	tier.Config
@@ -424,6 +424,11 @@ func deriveTier(db *datastore.Datastore, user string) (tier.Name, error) {
 	if err != nil {
 		return tier.Free, err
 	}
+	return bestTier(subs), nil
+}
+
+// bestTier is the highest tier any of subs confers.
+func bestTier(subs []*subscription.Subscription) tier.Name {
 	best := tier.Free
 	for _, s := range subs {
 		var t tier.Name
@@ -443,7 +448,33 @@ func deriveTier(db *datastore.Datastore, user string) (tier.Name, error) {
 			best = t
 		}
 	}
-	return best, nil
+	return best
+}
+
+// OrgTier is the tier an org's own subscriptions confer, whoever in it holds
+// them: the best over its active and trialing subscriptions, in both stores a
+// subscription may live in (see paywall.Allowed). It sets the org's API rate
+// limits (middleware.SetRateLimitTier).
+//
+// Only catalog plans confer a tier, so a merchant's own customers'
+// subscriptions in the same namespace do not lift it. Like TierOf, a lookup
+// error is returned rather than answered as Free.
+func OrgTier(ctx context.Context, org *organization.Organization) (tier.Name, error) {
+	if org == nil {
+		return tier.Free, nil
+	}
+	ctx = org.Namespaced(ctx)
+	subs := make([]*subscription.Subscription, 0)
+	for _, db := range []*datastore.Datastore{datastore.New(ctx), datastore.NewNamespaced(ctx)} {
+		for _, status := range []subscription.Status{subscription.Active, subscription.Trialing} {
+			found := make([]*subscription.Subscription, 0)
+			if _, err := subscription.Query(db).Filter("Status=", status).GetAll(&found); err != nil {
+				return tier.Free, err
+			}
+			subs = append(subs, found...)
+		}
+	}
+	return bestTier(subs), nil
 }
 
 // tierForActivePaidSlug maps an ACTIVE subscription's plan slug to its tier,
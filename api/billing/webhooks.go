@@ -11,6 +11,7 @@ import (
 	"github.com/zap-proto/zip"
 
 	"github.com/hanzoai/commerce/billing/creditledger"
+	"github.com/hanzoai/commerce/billing/engine"
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/middleware"
@@ -18,6 +19,7 @@ import (
 	"github.com/hanzoai/commerce/models/billingevent"
 	"github.com/hanzoai/commerce/models/billinginvoice"
 	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/paymentintent"
 	"github.com/hanzoai/commerce/models/subscription"
 	"github.com/hanzoai/commerce/models/transaction"
 	"github.com/hanzoai/commerce/models/types/currency"
@@ -119,6 +121,10 @@ func HandleProviderWebhook(c *zip.Ctx) error {
 		applySettlementEvent(ctx, db, org, event)
 	}
 
+	// Settle payment intents parked on a 3-D Secure challenge whose customer
+	// completed it and never came back to resume.
+	applyPaymentIntentActionEvent(ctx, db, event)
+
 	return c.JSON(http.StatusOK, map[string]any{
 		"received": true,
 		"type":     event.Type,
@@ -565,6 +571,63 @@ func settlementAmount(data Map) (currency.Cents, currency.Type) {
 	return currency.Cents(amt), cur
 }
 
+// applyPaymentIntentActionEvent settles a payment intent waiting at
+// requires_action from the processor's report of how its challenge ended.
+// The payment is found by the processor's id for it, which is what the intent
+// recorded when it was challenged. An intent the customer already resumed is
+// no longer waiting and is not touched, so a delivery that races the return,
+// or is retried, changes nothing. The two are serialised by the intent's lock.
+func applyPaymentIntentActionEvent(ctx context.Context, db *datastore.Datastore, event *processor.WebhookEvent) {
+	var approved bool
+	switch event.Type {
+	case "payment.completed", "payment.authorized":
+		approved = true
+	case "payment.failed", "payment.refused":
+	default:
+		return
+	}
+
+	pay := unwrapObject(event.Data, "payment")
+	ref := stringField(pay, "id")
+	if ref == "" {
+		ref = stringField(pay, "pspReference")
+	}
+	if ref == "" {
+		return
+	}
+
+	found := paymentintent.New(db)
+	ok, err := found.Query().
+		Filter("ProviderRef=", ref).
+		Filter("Status=", string(paymentintent.RequiresAction)).
+		Get()
+	if err != nil || !ok {
+		return
+	}
+
+	// Read it again under the lock the customer's resume takes: whichever
+	// of the two comes second finds the intent settled and leaves it.
+	unlock, err := engine.LockPaymentIntent(db, found.Id())
+	if err != nil {
+		log.Error("payment intent %s: %s for %s not applied: %v", found.Id(), event.Type, ref, err)
+		return
+	}
+	defer unlock()
+	pi := paymentintent.New(db)
+	if err := pi.GetById(found.Id()); err != nil {
+		log.Error("payment intent %s: %s for %s not applied: %v", found.Id(), event.Type, ref, err)
+		return
+	}
+
+	reason := ""
+	if !approved {
+		reason = "authentication failed or payment declined after challenge"
+	}
+	if err := engine.CompletePaymentIntentAction(ctx, pi, approved, reason); err != nil {
+		log.Error("payment intent %s: failed to apply %s for %s: %v", pi.Id(), event.Type, ref, err)
+	}
+}
+
 // unwrapObject returns data[key] as a map when present (Square nests the
 // changed resource one level deep, e.g. data.object.payment), otherwise the
 // data map itself (processors that expose fields at the top level).
@@ -648,7 +711,11 @@ func applySubscriptionEvent(db *datastore.Datastore, event *processor.WebhookEve
 		sub.Canceled = true
 		sub.CanceledAt = time.Now().UTC()
 	}
-	if err := sub.Update(); err != nil {
+	eventType := "subscription.updated"
+	if event.Type == "subscription.canceled" {
+		eventType = event.Type
+	}
+	if err := sub.UpdateWithEvents(engine.SubscriptionEvent(sub, eventType)); err != nil {
 		log.Warn("webhook: failed to update subscription %s: %v", sub.Id(), err)
 	}
 }
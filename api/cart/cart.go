@@ -75,6 +75,11 @@ func Set(c *zip.Ctx) error {
 		car.Mailchimp.CheckoutUrl = org.Mailchimp.CheckoutUrl
 	}
 
+	// Re-total with the promotions the cart now qualifies for
+	if err := car.Tally(); err != nil {
+		return http.Fail(c, 500, "Failed to total cart", err)
+	}
+
 	// Update cart in datastore
 	var res error
 	if err := car.Update(); err != nil {
@@ -153,6 +158,10 @@ func create(r *rest.Rest) zip.Handler {
 			car.Mailchimp.CheckoutUrl = org.Mailchimp.CheckoutUrl
 		}
 
+		if err := car.Tally(); err != nil {
+			return r.Fail(c, 500, "Failed to total "+r.Kind, err)
+		}
+
 		if err := car.Create(); err != nil {
 			return r.Fail(c, 500, "Failed to create "+r.Kind, err)
 		}
@@ -209,6 +218,10 @@ func update(r *rest.Rest) zip.Handler {
 		// Use same key to save cart
 		car.SetKey(key)
 
+		if err := car.Tally(); err != nil {
+			return r.Fail(c, 500, "Failed to total "+r.Kind, err)
+		}
+
 		// Replace whatever was in the datastore with our new updated cart
 		var res error
 		if err := car.Update(); err != nil {
@@ -260,6 +273,10 @@ func patch(r *rest.Rest) zip.Handler {
 			car.Mailchimp.CheckoutUrl = org.Mailchimp.CheckoutUrl
 		}
 
+		if err := car.Tally(); err != nil {
+			return r.Fail(c, 500, "Failed to total "+r.Kind, err)
+		}
+
 		var res error
 		if err := car.Update(); err != nil {
 			res = r.Fail(c, 500, "Failed to update "+r.Kind, err)
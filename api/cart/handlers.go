@@ -21,6 +21,7 @@ func Route(router zip.Router, args ...zip.Handler) {
 
 	api.POST("/:cartid/set", publishedRequired, namespaced, Set)
 	api.POST("/:cartid/discard", publishedRequired, namespaced, Discard)
+	api.GET("/:cartid/shipping-options", publishedRequired, namespaced, ShippingOptions)
 
 	api.Route(router, args...)
 }
@@ -0,0 +1,32 @@
+package cart
+
+import (
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment/shipping"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/cart"
+	"github.com/hanzoai/commerce/util/json/http"
+)
+
+// ShippingOptions lists the shipping options the cart can ship with to its
+// shipping address, priced, with what its promotions take off each.
+func ShippingOptions(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	id := c.Param("cartid")
+
+	car := cart.New(db)
+	if err := car.GetById(id); err != nil {
+		return http.Fail(c, 404, "No cart found with id: "+id, err)
+	}
+
+	options, err := shipping.Options(c.Context(), db, org, car)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to list shipping options", err)
+	}
+
+	return http.Render(c, 200, options)
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/hanzoai/commerce/models/types/client"
 	"github.com/hanzoai/commerce/models/types/currency"
 	"github.com/hanzoai/commerce/models/user"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/util/counter"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/reflect"
@@ -69,6 +70,10 @@ func decodeAuthorization(c *zip.Ctx, ord *order.Order) (*user.User, *payment.Pay
 func authorize(c *zip.Ctx, org *organization.Organization, ord *order.Order) (*payment.Payment, error) {
 	var fees []*fee.Fee
 
+	// Whether the order was stored before this call (an order id in the
+	// route), rather than placed by it.
+	existed := !ord.CreatedAt.IsZero()
+
 	// Decode authorization request
 	usr, pay, tsPass, err := decodeAuthorization(c, ord)
 	if err != nil {
@@ -96,6 +101,18 @@ func authorize(c *zip.Ctx, org *organization.Organization, ord *order.Order) (*p
 		log.Info("Using Store '%v'", ord.StoreId, c)
 	}
 
+	// The tax number the order is placed under decides whether it is
+	// reverse-charged, so it is checked here rather than taken as posted:
+	// the one given with the order, or else the customer's own.
+	if ord.CustomerTaxId.Value == "" {
+		ord.CustomerTaxId = usr.TaxId
+	}
+	if ord.CustomerTaxId.Value != "" {
+		if err := taxid.Verify(ord.Context(), &ord.CustomerTaxId); err != nil {
+			log.Warn("Tax id '%v' is %v: %v", ord.CustomerTaxId.Value, ord.CustomerTaxId.Status, err, c)
+		}
+	}
+
 	log.Info("Order Before Tally: '%v'", json.Encode(ord), c)
 
 	// Update order with information from datastore, and tally
@@ -285,16 +302,28 @@ func authorize(c *zip.Ctx, org *organization.Organization, ord *order.Order) (*p
 			pay.MustCreate()
 		}
 
-		ord.MustCreate()
+		// An order placed before this call was announced, and is announced
+		// canceled; one this call was placing never existed to anyone.
+		if existed {
+			if err := ord.CreateWithEvents(ord.OutboxEvent("order.canceled")); err != nil {
+				panic(err)
+			}
+		} else {
+			ord.MustCreate()
+		}
 		usr.MustCreate()
 		return nil, err
 	}
 
-	// Batch save user, order, payment, fees
-	entities := []interface{}{usr, ord, pay}
+	// Where the customer was, as far as the payment shows, for the tax
+	// returns that need it.
+	ord.RecordTaxEvidence(pay)
+
+	// Batch save user, payment, fees and the order
+	entities := []interface{}{usr, pay}
 
 	if !usingFiat {
-		entities = []interface{}{usr, ord}
+		entities = []interface{}{usr}
 	} else {
 		// If the charge is not live or test flag is set, then it is a test charge
 		ord.Test = pay.Test || !pay.Live
@@ -313,6 +342,8 @@ func authorize(c *zip.Ctx, org *organization.Organization, ord *order.Order) (*p
 		}
 	}
 
+	// The order goes last, now that it is final, with order.created.
+	entities = append(entities, multi.WithEvents(ord, ord.OutboxEvent("order.created")))
 	multi.MustCreate(entities)
 
 	// Emit order_completed analytics event (fire and forget)
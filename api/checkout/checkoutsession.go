@@ -0,0 +1,293 @@
+package checkout
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/checkout/session"
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/checkoutsession"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	"github.com/hanzoai/commerce/models/paymentmethod"
+	"github.com/hanzoai/commerce/payment"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/util/json"
+	"github.com/hanzoai/commerce/util/json/http"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+// sessionRequest is the body of every step of a checkout session. Each step
+// reads the fields it takes; Version is the session version the change was
+// made against, and is always required.
+type sessionRequest struct {
+	Version int `json:"version"`
+
+	CartId string `json:"cartId,omitempty"`
+
+	Email string `json:"email,omitempty"`
+
+	ShippingAddress Address `json:"shippingAddress,omitempty"`
+	BillingAddress  Address `json:"billingAddress,omitempty"`
+
+	ShippingOptionId string `json:"shippingOptionId,omitempty"`
+
+	CouponCodes []string `json:"couponCodes,omitempty"`
+
+	Processor       string `json:"processor,omitempty"`
+	PaymentMethodId string `json:"paymentMethodId,omitempty"`
+	ReturnUrl       string `json:"returnUrl,omitempty"`
+}
+
+// sessionResponse is a session, and the order it completed to or the
+// challenge its payment waits on.
+type sessionResponse struct {
+	*checkoutsession.CheckoutSession
+	Order      interface{}           `json:"order,omitempty"`
+	NextAction *processor.NextAction `json:"nextAction,omitempty"`
+}
+
+// sessionDB is the authenticated org and its datastore, or renders 401.
+func sessionDB(c *zip.Ctx) (*organization.Organization, *datastore.Datastore, bool) {
+	org, ok := authedOrg(c)
+	if !ok {
+		_ = http.Fail(c, 401, "Authentication required", errors.New("no authenticated organization"))
+		return nil, nil, false
+	}
+	return org, datastore.NewNamespaced(org.Namespaced(c.Context())), true
+}
+
+func decodeSession(c *zip.Ctx) (sessionRequest, bool) {
+	var req sessionRequest
+	if body := c.Body(); len(body) > 0 {
+		if err := json.DecodeBytes(body, &req); err != nil {
+			_ = http.Fail(c, 400, "Failed to decode request body", err)
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// failSession renders a checkout session error with the status it calls for.
+func failSession(c *zip.Ctx, err error) error {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		return http.Fail(c, 404, err.Error(), err)
+	case errors.Is(err, session.ErrExpired):
+		return http.Fail(c, 410, err.Error(), err)
+	case errors.Is(err, session.ErrVersion),
+		errors.Is(err, session.ErrClosed),
+		errors.Is(err, session.ErrStep),
+		errors.Is(err, session.ErrPaying),
+		errors.Is(err, session.ErrCart),
+		errors.Is(err, session.ErrTotalChanged),
+		errors.Is(err, lock.ErrBusy):
+		return http.Fail(c, 409, err.Error(), err)
+	case errors.Is(err, session.ErrPayment):
+		return http.Fail(c, 402, err.Error(), err)
+	case errors.Is(err, session.ErrEmptyCart),
+		errors.Is(err, session.ErrEmail),
+		errors.Is(err, session.ErrAddress),
+		errors.Is(err, session.ErrShippingOption),
+		errors.Is(err, session.ErrPaymentMethod),
+		errors.Is(err, session.ErrNoProcessor),
+		errors.Is(err, allocation.ErrInsufficientStock),
+		errors.Is(err, allocation.ErrUnserviceable):
+		return http.Fail(c, 422, err.Error(), err)
+	}
+	log.Error("checkout session: %v", err, c)
+	return http.Fail(c, 500, "Failed to update checkout session", err)
+}
+
+// StartSession opens a checkout session on a cart.
+//
+//	POST /checkout/session
+func StartSession(c *zip.Ctx) error {
+	org, db, ok := sessionDB(c)
+	if !ok {
+		return nil
+	}
+	req, ok := decodeSession(c)
+	if !ok {
+		return nil
+	}
+	if req.CartId == "" {
+		return http.Fail(c, 400, "cartId is required", errors.New("missing cartId"))
+	}
+
+	s, err := session.Start(c.Context(), db, org, req.CartId, time.Now())
+	if err != nil {
+		return failSession(c, err)
+	}
+	return http.Render(c, 201, sessionResponse{CheckoutSession: s})
+}
+
+// GetSession returns a checkout session.
+//
+//	GET /checkout/session/:sessionid
+func GetSession(c *zip.Ctx) error {
+	_, db, ok := sessionDB(c)
+	if !ok {
+		return nil
+	}
+	s, err := session.Get(db, c.Param("sessionid"))
+	if err != nil {
+		return failSession(c, err)
+	}
+	return http.Render(c, 200, sessionResponse{CheckoutSession: s})
+}
+
+// sessionStep returns the handler of a step of checkout: the step fn
+// builds from the request, applied at the request's version.
+func sessionStep(step func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error) func(*zip.Ctx) error {
+	return func(c *zip.Ctx) error {
+		org, db, ok := sessionDB(c)
+		if !ok {
+			return nil
+		}
+		req, ok := decodeSession(c)
+		if !ok {
+			return nil
+		}
+		s, err := session.Apply(c.Context(), db, org, c.Param("sessionid"), req.Version, time.Now(), step(db, req))
+		if err != nil {
+			return failSession(c, err)
+		}
+		return http.Render(c, 200, sessionResponse{CheckoutSession: s})
+	}
+}
+
+// SessionCustomer takes the customer step: the email the order is for.
+//
+//	POST /checkout/session/:sessionid/customer
+var SessionCustomer = sessionStep(func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error {
+	return session.Customer(req.Email)
+})
+
+// SessionAddress takes the address step: where the order ships and is billed.
+//
+//	POST /checkout/session/:sessionid/address
+var SessionAddress = sessionStep(func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error {
+	return session.Addresses(req.ShippingAddress, req.BillingAddress)
+})
+
+// SessionShipping takes the shipping step: one of the cart's shipping options.
+//
+//	POST /checkout/session/:sessionid/shipping
+var SessionShipping = sessionStep(func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error {
+	return session.ShippingMethod(req.ShippingOptionId)
+})
+
+// SessionTax takes the tax step, quoting tax on the address and shipping chosen.
+//
+//	POST /checkout/session/:sessionid/tax
+var SessionTax = sessionStep(func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error {
+	return session.QuoteTax()
+})
+
+// SessionPromotions takes the promotions step: the coupon codes to apply.
+//
+//	POST /checkout/session/:sessionid/promotions
+var SessionPromotions = sessionStep(func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error {
+	return session.Promotions(req.CouponCodes)
+})
+
+// SessionPayment takes the payment step: the payment method, and processor, to charge.
+//
+//	POST /checkout/session/:sessionid/payment
+var SessionPayment = sessionStep(func(db *datastore.Datastore, req sessionRequest) func(*checkoutsession.CheckoutSession) error {
+	return session.Payment(db, req.Processor, req.PaymentMethodId, req.ReturnUrl)
+})
+
+// CompleteSession places the order of a checkout session and pays for it.
+// A payment that waits on the customer authenticating it answers 402 with
+// the session and its nextAction; once the payment intent is resumed
+// (POST /billing/payment-intents/:id/resume), completing again finishes it.
+//
+//	POST /checkout/session/:sessionid/complete
+func CompleteSession(c *zip.Ctx) error {
+	org, db, ok := sessionDB(c)
+	if !ok {
+		return nil
+	}
+	req, ok := decodeSession(c)
+	if !ok {
+		return nil
+	}
+	s, err := session.Get(db, c.Param("sessionid"))
+	if err != nil {
+		return failSession(c, err)
+	}
+
+	proc, err := sessionProcessor(org, db, s)
+	if err != nil {
+		return failSession(c, err)
+	}
+
+	s, ord, err := session.Complete(c.Context(), db, org, s.Id(), req.Version, time.Now(), proc)
+	if errors.Is(err, session.ErrRequiresAction) {
+		res := sessionResponse{CheckoutSession: s}
+		pi := paymentintent.New(db)
+		if pi.GetById(s.PaymentIntentId) == nil {
+			res.NextAction = pi.NextAction
+		}
+		return http.Render(c, 402, res)
+	}
+	if err != nil {
+		return failSession(c, err)
+	}
+	return http.Render(c, 200, sessionResponse{CheckoutSession: s, Order: ord})
+}
+
+// sessionProcessor is what a session is charged through: the processor it
+// names, else the one its payment method was saved with, else the org's
+// payment router. A session with nothing to pay needs none.
+func sessionProcessor(org *organization.Organization, db *datastore.Datastore, s *checkoutsession.CheckoutSession) (processor.PaymentProcessor, error) {
+	if s.Total <= 0 && s.PaymentIntentId == "" {
+		return nil, nil
+	}
+	name := s.Processor
+	if name == "" {
+		pm := paymentmethod.New(db)
+		if err := pm.GetById(s.PaymentMethodId); err == nil {
+			name = pm.ProviderType
+		}
+	}
+	if name != "" {
+		p, err := payment.ProcessorsForOrg(org).Get(processor.ProcessorType(name))
+		if err != nil {
+			return nil, session.ErrNoProcessor
+		}
+		return p, nil
+	}
+	r, err := payment.RouterForOrg(org)
+	if err != nil {
+		return nil, session.ErrNoProcessor
+	}
+	return r, nil
+}
+
+// CancelSession abandons a checkout session.
+//
+//	POST /checkout/session/:sessionid/cancel
+func CancelSession(c *zip.Ctx) error {
+	_, db, ok := sessionDB(c)
+	if !ok {
+		return nil
+	}
+	req, ok := decodeSession(c)
+	if !ok {
+		return nil
+	}
+	s, err := session.Cancel(c.Context(), db, c.Param("sessionid"), req.Version, time.Now())
+	if err != nil {
+		return failSession(c, err)
+	}
+	return http.Render(c, 200, sessionResponse{CheckoutSession: s})
+}
@@ -273,6 +273,19 @@ func route(router zip.Router, prefix string) {
 	// never the request body.
 	if prefix == "/checkout" {
 		api.Post("/sessions", publishedRequired, Sessions)
+
+		// First-party checkout: a cart walked step by step to an order paid
+		// through the org's own processors.
+		api.Post("/session", publishedRequired, StartSession)
+		api.Get("/session/:sessionid", publishedRequired, GetSession)
+		api.Post("/session/:sessionid/customer", publishedRequired, SessionCustomer)
+		api.Post("/session/:sessionid/address", publishedRequired, SessionAddress)
+		api.Post("/session/:sessionid/shipping", publishedRequired, SessionShipping)
+		api.Post("/session/:sessionid/tax", publishedRequired, SessionTax)
+		api.Post("/session/:sessionid/promotions", publishedRequired, SessionPromotions)
+		api.Post("/session/:sessionid/payment", publishedRequired, SessionPayment)
+		api.Post("/session/:sessionid/complete", publishedRequired, CompleteSession)
+		api.Post("/session/:sessionid/cancel", publishedRequired, CancelSession)
 	}
 
 	// Auth and Capture Flow (Two-step Payment)
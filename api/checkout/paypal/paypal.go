@@ -41,7 +41,9 @@ func Confirm(c *zip.Ctx, org *organization.Organization, ord *order.Order) (err
 
 	ord.PaymentStatus = payment.Paid
 	ord.Payments = payments
-	ord.MustPut()
+	if err := ord.PutWithEvents(ord.OutboxEvent("order.paid")); err != nil {
+		panic(err)
+	}
 
 	return nil
 }
@@ -128,5 +128,9 @@ func Refund(org *organization.Organization, ord *order.Order, refundAmount curre
 		email.SendOrderRefunded(ctx, org, ord, usr, payments[0])
 	}
 
-	return ord.Put()
+	eventType := "order.partially_refunded"
+	if ord.Total == ord.Refunded {
+		eventType = "order.refunded"
+	}
+	return ord.PutWithEvents(ord.OutboxEvent(eventType))
 }
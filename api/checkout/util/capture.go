@@ -10,6 +10,7 @@ import (
 	"github.com/hanzoai/commerce/models/order"
 	"github.com/hanzoai/commerce/models/organization"
 	"github.com/hanzoai/commerce/models/payment"
+	"github.com/hanzoai/commerce/models/promotion/engine"
 	"github.com/hanzoai/commerce/models/referral"
 	"github.com/hanzoai/commerce/models/referrer"
 	"github.com/hanzoai/commerce/models/store"
@@ -32,11 +33,15 @@ func UpdateOrder(ctx context.Context, ord *order.Order, payments []*payment.Paym
 	}
 
 	ord.Paid = currency.Cents(int(ord.Paid) + totalPaid)
+	eventType := "order.updated"
 	if ord.Paid >= ord.Total {
 		ord.PaymentStatus = payment.Paid
+		eventType = "order.paid"
 	}
 
-	ord.MustUpdate()
+	if err := ord.UpdateWithEvents(ord.OutboxEvent(eventType)); err != nil {
+		panic(err)
+	}
 }
 
 func UpdateOrderPayments(ctx context.Context, ord *order.Order, payments []*payment.Payment) error {
@@ -59,6 +64,14 @@ func SaveRedemptions(ctx context.Context, ord *order.Order) {
 			}
 		}
 	}
+
+	// Charge promotions to their campaign budgets, once per order however
+	// often the capture is retried.
+	if len(ord.Promotions) > 0 {
+		if err := engine.Redeem(ord.Datastore(), ord.Id(), ord.Promotions); err != nil {
+			log.Warn("Unable to redeem promotions: %v", err, ctx)
+		}
+	}
 }
 
 type Referrent struct {
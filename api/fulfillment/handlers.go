@@ -7,11 +7,14 @@ import (
 	"github.com/zap-proto/zip"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment"
+	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/models/fulfillmentmodel"
 	"github.com/hanzoai/commerce/models/fulfillmentprovider"
 	"github.com/hanzoai/commerce/models/fulfillmentset"
 	"github.com/hanzoai/commerce/models/geozone"
+	"github.com/hanzoai/commerce/models/order"
 	"github.com/hanzoai/commerce/models/servicezone"
 	"github.com/hanzoai/commerce/models/shippingoption"
 	"github.com/hanzoai/commerce/models/shippingoptionrule"
@@ -30,11 +33,17 @@ func Route(router zip.Router, args ...zip.Handler) {
 	rest.New(shippingoption.ShippingOption{}).Route(router, args...)
 	rest.New(shippingoptionrule.ShippingOptionRule{}).Route(router, args...)
 	rest.New(shippingprofile.ShippingProfile{}).Route(router, args...)
-	rest.New(fulfillmentprovider.FulfillmentProvider{}).Route(router, args...)
+
+	pApi := rest.New(fulfillmentprovider.FulfillmentProvider{})
+	pApi.POST("/:providerid/rates", namespaced, Rates)
+	pApi.POST("/:providerid/address", namespaced, ValidateAddress)
+	pApi.Route(router, args...)
 
 	fApi := rest.New(fulfillmentmodel.Fulfillment{})
 	fApi.POST("/:fulfillmentid/ship", namespaced, Ship)
 	fApi.POST("/:fulfillmentid/cancel", namespaced, Cancel)
+	fApi.POST("/:fulfillmentid/track", namespaced, Track)
+	fApi.POST("/:fulfillmentid/return-label", namespaced, ReturnLabel)
 	fApi.Route(router, args...)
 }
 
@@ -42,16 +51,34 @@ func Route(router zip.Router, args ...zip.Handler) {
 // fulfillment as shipped.
 type ShipRequest struct {
 	Labels []fulfillmentmodel.FulfillmentLabel `json:"labels"`
+
+	// Retry asks the provider again for a fulfillment whose earlier request
+	// left no shipment recorded.
+	Retry bool `json:"retry,omitempty"`
 }
 
 // Ship marks a fulfillment as shipped by setting ShippedAt to now and
 // optionally appending tracking labels provided in the request body.
+//
+// A fulfillment with a provider and no labels given is shipped through it
+// first: labels are bought, or the order is handed to the warehouse, and
+// the labels are pushed onto the order. The fulfillment is saved as
+// requested before the provider is asked and with the shipment as soon as it
+// answers, so a label is never bought twice: a fulfillment requested before
+// with no shipment recorded is refused until the request says Retry, once
+// the merchant has checked the provider has none.
 func Ship(c *zip.Ctx) error {
 	org := middleware.GetOrganization(c)
 	db := datastore.New(org.Namespaced(c.Context()))
 
 	id := c.Param("fulfillmentid")
 
+	unlock, err := fulfillment.Lock(db, id)
+	if err != nil {
+		return http.Fail(c, 409, "Fulfillment is being updated, retry", err)
+	}
+	defer unlock()
+
 	f := fulfillmentmodel.New(db)
 	if err := f.GetById(id); err != nil {
 		return http.Fail(c, 404, "No fulfillment found with id: "+id, err)
@@ -69,6 +96,47 @@ func Ship(c *zip.Ctx) error {
 		}
 	}
 
+	if len(req.Labels) == 0 && f.ProviderId != "" && f.ExternalId == "" {
+		if f.ShipmentRequestedAt != nil && !req.Retry {
+			return http.Fail(c, 409, "A shipment was requested at "+f.ShipmentRequestedAt.Format(time.RFC3339)+" and not recorded; check the provider, then retry", errors.New("shipment unrecorded"))
+		}
+		ord := order.New(db)
+		if err := ord.GetById(f.OrderId); err != nil {
+			return http.Fail(c, 404, "No order found with id: "+f.OrderId, err)
+		}
+		p, err := fulfillment.Open(db, org, f.ProviderId)
+		if err != nil {
+			return http.Fail(c, 400, "Failed to open fulfillment provider", err)
+		}
+		sreq := fulfillment.OrderRequest(ord, f, fulfillment.ShipFrom(db, ord, f))
+		sreq.Carrier, sreq.Service = shippingService(db, f)
+
+		requested := time.Now()
+		f.ShipmentRequestedAt = &requested
+		if err := f.Update(); err != nil {
+			return http.Fail(c, 500, "Failed to update fulfillment", err)
+		}
+
+		s, err := p.CreateShipment(c.Context(), sreq)
+		if err != nil {
+			// Nothing was bought: the request may be made again.
+			f.ShipmentRequestedAt = nil
+			if uerr := f.Update(); uerr != nil {
+				log.Error("fulfillment: clear request of %s: %v", f.Id(), uerr, c)
+			}
+			return http.Fail(c, 502, "Failed to ship with "+p.Name(), err)
+		}
+		fulfillment.Shipped(f, s)
+		if err := f.Update(); err != nil {
+			log.Error("fulfillment: %s shipped as %s with %s but not saved: %v", f.Id(), s.Id, p.Name(), err, c)
+			return http.Fail(c, 500, "Shipped as "+s.Id+" but failed to update fulfillment", err)
+		}
+		fulfillment.Record(ord, f, &fulfillment.Tracking{})
+		if err := ord.Update(); err != nil {
+			log.Error("fulfillment: order %s of %s: %v", ord.Id(), f.Id(), err, c)
+		}
+	}
+
 	now := time.Now()
 	f.ShippedAt = &now
 
@@ -83,6 +151,19 @@ func Ship(c *zip.Ctx) error {
 	return http.Render(c, 200, f)
 }
 
+// shippingService is the carrier and service the fulfillment's shipping
+// option ships with.
+func shippingService(db *datastore.Datastore, f *fulfillmentmodel.Fulfillment) (string, string) {
+	if f.ShippingOptionId == "" {
+		return "", ""
+	}
+	opt := shippingoption.New(db)
+	if err := opt.GetById(f.ShippingOptionId); err != nil {
+		return "", ""
+	}
+	return opt.Service()
+}
+
 // Cancel marks a fulfillment as canceled by setting CanceledAt to now.
 func Cancel(c *zip.Ctx) error {
 	org := middleware.GetOrganization(c)
@@ -99,6 +180,16 @@ func Cancel(c *zip.Ctx) error {
 		return http.Fail(c, 400, "Fulfillment is already canceled", errors.New("already canceled"))
 	}
 
+	if f.ExternalId != "" {
+		p, err := fulfillment.Open(db, org, f.ProviderId)
+		if err != nil {
+			return http.Fail(c, 400, "Failed to open fulfillment provider", err)
+		}
+		if err := p.CancelShipment(c.Context(), f.ExternalId); err != nil {
+			return http.Fail(c, 502, "Failed to cancel with "+p.Name(), err)
+		}
+	}
+
 	now := time.Now()
 	f.CanceledAt = &now
 
@@ -108,3 +199,130 @@ func Cancel(c *zip.Ctx) error {
 
 	return http.Render(c, 200, f)
 }
+
+// Track asks the fulfillment's provider where its parcels are, and records
+// it on the fulfillment and its order. Fulfillments in flight are also
+// tracked on a schedule (fulfillment.Poll); this is for asking now.
+func Track(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	id := c.Param("fulfillmentid")
+
+	unlock, err := fulfillment.Lock(db, id)
+	if err != nil {
+		return http.Fail(c, 409, "Fulfillment is being updated, retry", err)
+	}
+	defer unlock()
+
+	f := fulfillmentmodel.New(db)
+	if err := f.GetById(id); err != nil {
+		return http.Fail(c, 404, "No fulfillment found with id: "+id, err)
+	}
+	if f.ExternalId == "" {
+		return http.Fail(c, 400, "Fulfillment was not shipped through a provider", errors.New("nothing to track"))
+	}
+
+	switch err := fulfillment.Track(c.Context(), db, org, f); {
+	case errors.Is(err, fulfillment.ErrUnsupported):
+		return http.Fail(c, 400, "Fulfillment provider does not report tracking", err)
+	case errors.Is(err, fulfillment.ErrDisabled), errors.Is(err, fulfillment.ErrUnknownProvider):
+		return http.Fail(c, 400, "Failed to open fulfillment provider", err)
+	case err != nil:
+		return http.Fail(c, 502, "Failed to track fulfillment", err)
+	}
+
+	return http.Render(c, 200, f)
+}
+
+// ReturnLabel has the fulfillment's provider make a label for the customer
+// to send it back with.
+func ReturnLabel(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	id := c.Param("fulfillmentid")
+
+	f := fulfillmentmodel.New(db)
+	if err := f.GetById(id); err != nil {
+		return http.Fail(c, 404, "No fulfillment found with id: "+id, err)
+	}
+	if f.ShippedAt == nil {
+		return http.Fail(c, 400, "Fulfillment has not shipped", errors.New("not shipped"))
+	}
+
+	ord := order.New(db)
+	if err := ord.GetById(f.OrderId); err != nil {
+		return http.Fail(c, 404, "No order found with id: "+f.OrderId, err)
+	}
+	p, err := fulfillment.Open(db, org, f.ProviderId)
+	if err != nil {
+		return http.Fail(c, 400, "Failed to open fulfillment provider", err)
+	}
+	req := fulfillment.OrderRequest(ord, f, fulfillment.ShipFrom(db, ord, f))
+	req.Carrier, req.Service = shippingService(db, f)
+	s, err := p.CreateReturnLabel(c.Context(), f.ExternalId, req)
+	if errors.Is(err, fulfillment.ErrUnsupported) {
+		return http.Fail(c, 400, p.Name()+" does not make return labels", err)
+	}
+	if err != nil {
+		return http.Fail(c, 502, "Failed to create return label with "+p.Name(), err)
+	}
+
+	return http.Render(c, 200, s)
+}
+
+// Rates quotes a provider's services for the parcels in the request body,
+// as a calculated shipping option would be priced.
+func Rates(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	req := fulfillment.Request{}
+	if err := json.DecodeBytes(c.Body(), &req); err != nil {
+		return http.Fail(c, 400, "Failed to decode request body", err)
+	}
+
+	p, err := fulfillment.Open(db, org, c.Param("providerid"))
+	if err != nil {
+		return http.Fail(c, 400, "Failed to open fulfillment provider", err)
+	}
+	rates, err := p.Rates(c.Context(), &req)
+	if errors.Is(err, fulfillment.ErrUnsupported) {
+		return http.Fail(c, 400, p.Name()+" does not quote rates", err)
+	}
+	if err != nil {
+		return http.Fail(c, 502, "Failed to quote rates with "+p.Name(), err)
+	}
+
+	return http.Render(c, 200, rates)
+}
+
+// ValidateAddress has a provider check and correct the address in the
+// request body.
+func ValidateAddress(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	addr := fulfillment.Address{}
+	if err := json.DecodeBytes(c.Body(), &addr); err != nil {
+		return http.Fail(c, 400, "Failed to decode request body", err)
+	}
+
+	p, err := fulfillment.Open(db, org, c.Param("providerid"))
+	if err != nil {
+		return http.Fail(c, 400, "Failed to open fulfillment provider", err)
+	}
+	corrected, err := p.ValidateAddress(c.Context(), addr)
+	if errors.Is(err, fulfillment.ErrUnsupported) {
+		return http.Fail(c, 400, p.Name()+" does not validate addresses", err)
+	}
+	if errors.Is(err, fulfillment.ErrAddress) {
+		return http.Fail(c, 422, err.Error(), err)
+	}
+	if err != nil {
+		return http.Fail(c, 502, "Failed to validate address with "+p.Name(), err)
+	}
+
+	return http.Render(c, 200, corrected)
+}
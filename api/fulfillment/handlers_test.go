@@ -8,11 +8,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/zap-proto/zip"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment"
 	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/fulfillmentprovider"
+	"github.com/hanzoai/commerce/models/order"
 	"github.com/hanzoai/commerce/models/organization"
 	"github.com/hanzoai/commerce/util/nscontext"
 	"github.com/hanzoai/commerce/util/test/ae"
@@ -185,3 +189,80 @@ func TestCancel_UnknownRefused(t *testing.T) {
 		t.Fatalf("cancel unknown = %d, want 404", code)
 	}
 }
+
+// shipper is a provider that checks, when asked to ship, that the
+// fulfillment was saved as requested first.
+type shipper struct {
+	fulfillment.Manual
+	t     *testing.T
+	db    *datastore.Datastore
+	id    string
+	asked int
+}
+
+func (s *shipper) CreateShipment(ctx context.Context, req *fulfillment.Request) (*fulfillment.Shipment, error) {
+	s.asked++
+	stored := fulfillmentmodel.New(s.db)
+	if err := stored.GetById(s.id); err != nil {
+		s.t.Errorf("reload before shipping: %v", err)
+	} else if stored.ShipmentRequestedAt == nil {
+		s.t.Error("asked to ship a fulfillment not yet saved as requested")
+	}
+	return &fulfillment.Shipment{Id: "shp_1", Labels: []fulfillmentmodel.FulfillmentLabel{{TrackingNumber: "1Z1"}}}, nil
+}
+
+// TestShip_SavesBeforeBuying: the fulfillment is saved as requested before
+// the provider buys its label, and one requested with no shipment recorded
+// is not shipped again until the request says to retry.
+func TestShip_SavesBeforeBuying(t *testing.T) {
+	tc := ae.NewContext()
+	defer tc.Close()
+
+	api := newFulfillmentAPI("acme")
+	ord := order.New(api.db)
+	if err := ord.Create(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := fulfillmentprovider.New(api.db)
+	cfg.Name, cfg.IsEnabled = "test-shipper", true
+	if err := cfg.Create(); err != nil {
+		t.Fatal(err)
+	}
+	seed := func() *fulfillmentmodel.Fulfillment {
+		f := fulfillmentmodel.New(api.db)
+		f.OrderId, f.ProviderId = ord.Id(), cfg.Id()
+		if err := f.Create(); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	p := &shipper{t: t, db: api.db}
+	fulfillment.Register("test-shipper", func(*organization.Organization, *fulfillmentprovider.FulfillmentProvider) (fulfillment.Provider, error) {
+		return p, nil
+	})
+
+	f := seed()
+	p.id = f.Id()
+	if code, body := api.do(t, "/"+f.Id()+"/ship", nil); code != http.StatusOK {
+		t.Fatalf("ship status = %d, body=%s", code, body)
+	}
+	if got := api.reload(t, f.Id()); got.ExternalId != "shp_1" || got.ShippedAt == nil || p.asked != 1 {
+		t.Fatalf("shipped = %+v, provider asked %d times", got, p.asked)
+	}
+
+	// A request that was made and never recorded.
+	lost := seed()
+	requested := time.Now().Add(-time.Minute)
+	lost.ShipmentRequestedAt = &requested
+	if err := lost.Update(); err != nil {
+		t.Fatal(err)
+	}
+	p.id = lost.Id()
+	if code, _ := api.do(t, "/"+lost.Id()+"/ship", nil); code != http.StatusConflict || p.asked != 1 {
+		t.Fatalf("ship of an unrecorded request = %d, provider asked %d times; want 409 and no label bought", code, p.asked)
+	}
+	if code, body := api.do(t, "/"+lost.Id()+"/ship", map[string]any{"retry": true}); code != http.StatusOK || p.asked != 2 {
+		t.Fatalf("retried ship = %d, body=%s, provider asked %d times", code, body, p.asked)
+	}
+}
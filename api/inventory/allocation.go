@@ -0,0 +1,220 @@
+package inventory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/cart"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/util/json"
+	"github.com/hanzoai/commerce/util/json/http"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+// maxTTL bounds how long a cart may ask to hold stock. A longer hold is stock
+// a shopper who left keeps from everyone else.
+const maxTTL = 24 * time.Hour
+
+// planRequest is what to allocate: a cart's items and address, or items and a
+// destination given outright. A destination given with a cart stands in for
+// the cart's address.
+type planRequest struct {
+	CartId      string              `json:"cartId"`
+	Items       []lineitem.LineItem `json:"items"`
+	Destination *Address            `json:"destination"`
+	AllowSplit  bool                `json:"allowSplit"`
+}
+
+// holdRequest is how a cart's stock is held. TTL is in seconds; zero is
+// allocation.DefaultTTL.
+type holdRequest struct {
+	AllowSplit bool `json:"allowSplit"`
+	TTL        int  `json:"ttl"`
+}
+
+// PlanAllocation says where an order would ship from, holding nothing.
+//
+//	POST /allocation/plan
+func PlanAllocation(c *zip.Ctx) error {
+	db := datastore.New(c.Context())
+
+	var req planRequest
+	if err := json.DecodeBytes(c.Body(), &req); err != nil {
+		return http.Fail(c, 400, "Failed to decode request body", err)
+	}
+
+	items := req.Items
+	var dest Address
+	if req.CartId != "" {
+		car := cart.New(db)
+		if err := car.GetById(req.CartId); err != nil {
+			return http.Fail(c, 404, "No cart found with id: "+req.CartId, err)
+		}
+		items, dest = car.Items, car.ShippingAddress
+	}
+	if req.Destination != nil {
+		dest = *req.Destination
+	}
+
+	lines, err := allocation.Lines(db, items)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to load inventory items", err)
+	}
+	plan, err := allocation.PlanFor(db, lines, allocation.DestinationOf(dest), allocation.Options{AllowSplit: req.AllowSplit})
+	if err != nil {
+		return failAllocation(c, err)
+	}
+	return http.Render(c, 200, plan)
+}
+
+// ReserveCart allocates a cart's items and holds the stock for it until the
+// hold lapses, replacing whatever the cart held before.
+//
+//	POST /allocation/cart/:cartid
+func ReserveCart(c *zip.Ctx) error {
+	db := datastore.New(c.Context())
+	id := c.Param("cartid")
+
+	var req holdRequest
+	if len(c.Body()) > 0 {
+		if err := json.DecodeBytes(c.Body(), &req); err != nil {
+			return http.Fail(c, 400, "Failed to decode request body", err)
+		}
+	}
+	ttl, err := holdTTL(req.TTL)
+	if err != nil {
+		return http.Fail(c, 400, err.Error(), err)
+	}
+
+	car := cart.New(db)
+	if err := car.GetById(id); err != nil {
+		return http.Fail(c, 404, "No cart found with id: "+id, err)
+	}
+	if car.Status != cart.Active {
+		err := errors.New("cart is " + string(car.Status))
+		return http.Fail(c, 409, "Only an active cart can hold stock", err)
+	}
+
+	lines, err := allocation.Lines(db, car.Items)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to load inventory items", err)
+	}
+	plan, err := allocation.PlanFor(db, lines, allocation.DestinationOf(car.ShippingAddress), allocation.Options{AllowSplit: req.AllowSplit})
+	if err != nil {
+		return failAllocation(c, err)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	reservations, err := allocation.Reserve(db, plan, allocation.Hold{OwnerId: car.Id(), ExpiresAt: expiresAt})
+	if err != nil {
+		return failAllocation(c, err)
+	}
+
+	return http.Render(c, 200, map[string]interface{}{
+		"plan":         plan,
+		"reservations": reservations,
+		"expiresAt":    expiresAt,
+	})
+}
+
+// ExtendCart moves the lapse of a cart's hold to ttl seconds from now.
+//
+//	POST /allocation/cart/:cartid/extend
+func ExtendCart(c *zip.Ctx) error {
+	db := datastore.New(c.Context())
+	id := c.Param("cartid")
+
+	var req holdRequest
+	if len(c.Body()) > 0 {
+		if err := json.DecodeBytes(c.Body(), &req); err != nil {
+			return http.Fail(c, 400, "Failed to decode request body", err)
+		}
+	}
+	ttl, err := holdTTL(req.TTL)
+	if err != nil {
+		return http.Fail(c, 400, err.Error(), err)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	reservations, err := allocation.Extend(db, id, expiresAt)
+	if errors.Is(err, allocation.ErrNotHolding) {
+		return http.Fail(c, 404, "Cart holds no stock", err)
+	}
+	if err != nil {
+		return http.Fail(c, 500, "Failed to extend hold", err)
+	}
+	return http.Render(c, 200, map[string]interface{}{
+		"reservations": reservations,
+		"expiresAt":    expiresAt,
+	})
+}
+
+// ReleaseCart gives back the stock a cart holds.
+//
+//	DELETE /allocation/cart/:cartid
+func ReleaseCart(c *zip.Ctx) error {
+	db := datastore.New(c.Context())
+	n, err := allocation.Release(db, c.Param("cartid"))
+	if err != nil {
+		return http.Fail(c, 500, "Failed to release hold", err)
+	}
+	return http.Render(c, 200, map[string]interface{}{"released": n})
+}
+
+// AvailableToPromise returns how many of a variant each location can sell
+// now, and in total.
+//
+//	GET /allocation/variant/:variantid
+func AvailableToPromise(c *zip.Ctx) error {
+	db := datastore.New(c.Context())
+	id := c.Param("variantid")
+
+	promises, managed, err := allocation.AvailableToPromise(db, id)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to load inventory levels", err)
+	}
+	total := 0
+	for _, p := range promises {
+		total += p.Available
+	}
+	return http.Render(c, 200, map[string]interface{}{
+		"variantId": id,
+		"managed":   managed,
+		"available": total,
+		"locations": promises,
+	})
+}
+
+func holdTTL(seconds int) (time.Duration, error) {
+	switch {
+	case seconds < 0:
+		return 0, errors.New("ttl must not be negative")
+	case seconds == 0:
+		return allocation.DefaultTTL, nil
+	case time.Duration(seconds)*time.Second > maxTTL:
+		return 0, errors.New("ttl must be at most a day")
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// failAllocation renders an allocation error: a destination nobody ships to
+// is the request's problem, a shortage is the stock's, anything else ours.
+func failAllocation(c *zip.Ctx, err error) error {
+	var short *allocation.ShortageError
+	switch {
+	case errors.Is(err, allocation.ErrUnserviceable):
+		return http.Fail(c, 422, "No stock location ships to this address", err)
+	case errors.As(err, &short):
+		return http.Fail(c, 409, short.Error(), err)
+	case errors.Is(err, allocation.ErrInsufficientStock):
+		return http.Fail(c, 409, "Insufficient stock", err)
+	case errors.Is(err, allocation.ErrNoLevel):
+		return http.Fail(c, 409, "Stock moved while allocating; try again", err)
+	}
+	return http.Fail(c, 500, "Failed to allocate stock", err)
+}
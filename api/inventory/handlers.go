@@ -6,6 +6,7 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/middleware"
 	inventoryModel "github.com/hanzoai/commerce/models/inventory"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
 	"github.com/hanzoai/commerce/models/inventorylevel"
 	"github.com/hanzoai/commerce/models/reservation"
 	"github.com/hanzoai/commerce/models/variantinventorylink"
@@ -30,6 +31,17 @@ func Route(router zip.Router, args ...zip.Handler) {
 
 	// Variant-Inventory Links
 	rest.New(variantinventorylink.VariantInventoryLink{}).Route(router, args...)
+
+	// Allocation: where an order ships from, the stock held for a cart while
+	// it checks out, and what each location can promise.
+	alloc := router.Group("allocation")
+	alloc.Use(args...)
+	alloc.Use(namespaced)
+	alloc.Post("/plan", PlanAllocation)
+	alloc.Post("/cart/:cartid", ReserveCart)
+	alloc.Post("/cart/:cartid/extend", ExtendCart)
+	alloc.Delete("/cart/:cartid", ReleaseCart)
+	alloc.Get("/variant/:variantid", AvailableToPromise)
 }
 
 // adjustRequest represents a stock adjustment request body.
@@ -58,6 +70,19 @@ func AdjustStock(c *zip.Ctx) error {
 		return http.Fail(c, 400, "Failed to decode request body", err)
 	}
 
+	// Read the level again under the lock reservations take, so that an
+	// adjustment and a reservation landing together cannot each write over
+	// the other's change.
+	unlock, err := allocation.LockLevel(db, level.InventoryItemId, level.LocationId)
+	if err != nil {
+		return http.Fail(c, 409, "The inventory level is being changed by another request; try again", err)
+	}
+	defer unlock()
+	level = inventorylevel.New(db)
+	if err := level.GetById(id); err != nil {
+		return http.Fail(c, 404, "Inventory level not found", err)
+	}
+
 	// Compute the post-adjustment values WITHOUT mutating yet, so a rejected
 	// oversell leaves the stored level untouched.
 	stocked := level.StockedQuantity
@@ -77,8 +102,10 @@ func AdjustStock(c *zip.Ctx) error {
 	// Reserving more than is on hand — or stocking down below what is already
 	// reserved — would sell inventory that does not exist. Refuse and DO NOT
 	// persist. Incoming/restock (positive stocked) and releasing a reservation
-	// (negative reserved) stay allowed because they keep available ≥ 0.
-	if stocked-reserved < 0 {
+	// (negative reserved) stay allowed because they keep available ≥ 0 — or,
+	// on a level a backorder already took below zero, because they bring it
+	// closer.
+	if stocked-reserved < 0 && stocked-reserved < level.AvailableQuantity() {
 		return http.Fail(c, 409, "insufficient available stock", nil)
 	}
 
@@ -0,0 +1,143 @@
+// Package jobs is the admin surface of the scheduler: which recurring jobs
+// commerce runs, when each runs next, how its runs went, and a way to run one
+// now.
+//
+// Mounted under /v1 (api/api.go), platform-admin gated — the jobs bill every
+// org, so running one by hand is not an org owner's to do:
+//
+//	GET  /v1/jobs               -> every job, its schedule, next slot and last run
+//	GET  /v1/jobs/:name/runs    -> the job's run history, newest first (?limit=, default 50)
+//	POST /v1/jobs/:name/run     -> run the job now; 202 with the run, 409 if it is running
+package jobs
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/scheduler"
+	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/permission"
+)
+
+// maxRuns bounds a history page.
+const maxRuns = 500
+
+var sched *scheduler.Scheduler
+
+// SetScheduler sets the scheduler the endpoints report on (called once at
+// bootstrap). Until it is called they answer 503.
+func SetScheduler(s *scheduler.Scheduler) {
+	sched = s
+}
+
+// Route registers the job endpoints. As with every cross-org surface, each
+// handler gates the caller itself (RequirePlatformAdmin, or MayMintMoney for
+// Trigger) on top of the route-level token gate, which admits any IAM caller.
+func Route(r zip.Router, args ...zip.Handler) {
+	api := r.Group("jobs")
+	api.Use(middleware.TokenRequired(permission.Admin))
+
+	api.Get("", List)
+	api.Get("/:name/runs", Runs)
+	api.Post("/:name/run", Trigger)
+}
+
+// Job is a job with its last run.
+type Job struct {
+	scheduler.JobStatus
+	LastRun *scheduler.Run `json:"lastRun,omitempty"`
+}
+
+// List lists the jobs.
+//
+//	GET /v1/jobs
+func List(c *zip.Ctx) error {
+	if !middleware.RequirePlatformAdmin(c) {
+		return nil
+	}
+	if sched == nil {
+		return http.Fail(c, 503, "the scheduler is not running", errors.New("no scheduler"))
+	}
+
+	statuses := sched.Jobs()
+	out := make([]Job, 0, len(statuses))
+	for _, st := range statuses {
+		j := Job{JobStatus: st}
+		runs, err := sched.Runs(c.Context(), st.Name, 1)
+		if err != nil {
+			// The schedule is worth showing without the history.
+			log.Warn("jobs: last run of %s: %v", st.Name, err, c)
+		} else if len(runs) > 0 {
+			j.LastRun = runs[0]
+		}
+		out = append(out, j)
+	}
+	return http.Render(c, 200, out)
+}
+
+// Runs is a job's run history.
+//
+//	GET /v1/jobs/:name/runs?limit=
+func Runs(c *zip.Ctx) error {
+	if !middleware.RequirePlatformAdmin(c) {
+		return nil
+	}
+	if sched == nil {
+		return http.Fail(c, 503, "the scheduler is not running", errors.New("no scheduler"))
+	}
+
+	limit := 50
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return http.Fail(c, 400, "limit must be a positive number", err)
+		}
+		limit = min(n, maxRuns)
+	}
+
+	runs, err := sched.Runs(c.Context(), c.Param("name"), limit)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		return http.Fail(c, 404, "no job named "+c.Param("name"), err)
+	case err != nil:
+		return http.Fail(c, 500, "failed to read the job's runs", err)
+	}
+	return http.Render(c, 200, runs)
+}
+
+// Trigger runs a job now. It answers as soon as the run has started; the run
+// goes on after the response, and its outcome is in the job's history.
+//
+// The run executes on the scheduler's own context, not the request's, so the
+// ledger's mint gate never sees this caller: the billing jobs grant allotments
+// and renew subscriptions unchecked. Hence the money-mint principal here, not
+// the wider platform read gate the listings use.
+//
+//	POST /v1/jobs/:name/run
+func Trigger(c *zip.Ctx) error {
+	if !middleware.MayMintMoney(c) {
+		return http.Fail(c, 403,
+			"This operation requires platform-administrator or internal-service credentials.",
+			errors.New("job trigger: caller is neither the internal service token nor a platform global admin"))
+	}
+	if sched == nil {
+		return http.Fail(c, 503, "the scheduler is not running", errors.New("no scheduler"))
+	}
+
+	name := c.Param("name")
+	run, err := sched.Trigger(name)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		return http.Fail(c, 404, "no job named "+name, err)
+	case errors.Is(err, scheduler.ErrRunning):
+		return http.Fail(c, 409, "the job is already running", err)
+	case err != nil:
+		return http.Fail(c, 500, "failed to start the job", err)
+	}
+	log.Info("jobs: %s triggered by %s", name, middleware.AuditActor(c).ID, c)
+	return http.Render(c, 202, run)
+}
@@ -1,11 +1,15 @@
 package notification
 
 import (
+	"time"
+
 	"github.com/zap-proto/zip"
 
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/middleware"
 	notificationModel "github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/notificationpreference"
+	"github.com/hanzoai/commerce/models/notificationtemplate"
 	"github.com/hanzoai/commerce/util/json/http"
 	"github.com/hanzoai/commerce/util/rest"
 )
@@ -16,6 +20,9 @@ func Route(router zip.Router, args ...zip.Handler) {
 	api := rest.New(notificationModel.Notification{})
 	api.POST("/:notificationid/resend", namespaced, Resend)
 	api.Route(router, args...)
+
+	rest.New(notificationtemplate.NotificationTemplate{}).Route(router, args...)
+	rest.New(notificationpreference.NotificationPreference{}).Route(router, args...)
 }
 
 // Resend resets a notification's status to pending so it can be re-delivered.
@@ -30,9 +37,13 @@ func Resend(c *zip.Ctx) error {
 		return http.Fail(c, 404, "No notification found with id: "+id, err)
 	}
 
-	// Reset status to pending for re-delivery
+	// Reset status to pending for re-delivery, with a fresh set of attempts
+	// due now
 	n.Status = notificationModel.Pending
 	n.ExternalId = ""
+	n.Attempts = 0
+	n.NextAttemptAt = time.Time{}
+	n.LastError = ""
 
 	if err := n.Update(); err != nil {
 		return http.Fail(c, 500, "Failed to resend notification", err)
@@ -59,7 +59,7 @@ func Update(c *zip.Ctx) error {
 	}
 
 	// Replace whatever was in the datastore with our new updated order
-	if err := ord.Update(); err != nil {
+	if err := ord.UpdateWithEvents(ord.OutboxEvent("order.updated")); err != nil {
 		return http.Fail(c, 500, "Failed to update order", err)
 	} else {
 		return http.Render(c, 200, ord)
@@ -88,7 +88,7 @@ func Patch(c *zip.Ctx) error {
 		return http.Fail(c, 400, "Invalid or incomplete order", err)
 	}
 
-	if err := ord.Update(); err != nil {
+	if err := ord.UpdateWithEvents(ord.OutboxEvent("order.updated")); err != nil {
 		return http.Fail(c, 500, "Failed to update order", err)
 	} else {
 		return http.Render(c, 200, ord)
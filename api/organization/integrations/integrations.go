@@ -201,6 +201,10 @@ func Upsert(c *zip.Ctx) error {
 			org.Shipwire = s.Shipwire
 		}
 
+		if in := org.Integrations.FindByType(integration.ShipStationType); in != nil {
+			org.ShipStation = in.ShipStation
+		}
+
 		// Save organization
 		if err := org.Update(); err != nil {
 			http.Fail(c, 500, "Failed to save integrations", err)
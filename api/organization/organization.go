@@ -5,6 +5,7 @@ import (
 
 	"github.com/hanzoai/commerce/api/organization/analytics"
 	"github.com/hanzoai/commerce/api/organization/integrations"
+	"github.com/hanzoai/commerce/api/organization/paymentrouting"
 	"github.com/hanzoai/commerce/api/organization/wallet"
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/models/organization"
@@ -36,6 +37,10 @@ func Route(router zip.Router, args ...zip.Handler) {
 	api.PATCH("/:organizationid/integrations", adminRequired, namespaced, integrations.Upsert)
 	api.DELETE("/:organizationid/integrations/:integrationid", adminRequired, namespaced, integrations.Delete)
 
+	api.GET("/:organizationid/paymentrouting", adminRequired, namespaced, paymentrouting.Get)
+	api.PUT("/:organizationid/paymentrouting", adminRequired, namespaced, paymentrouting.Set)
+	api.POST("/:organizationid/paymentrouting/dryrun", adminRequired, namespaced, paymentrouting.DryRun)
+
 	api.GET("/:organizationid/wallet", adminRequired, namespaced, wallet.Get)
 	api.GET("/:organizationid/wallet/account/:name", adminRequired, namespaced, wallet.GetAccount)
 	api.POST("/:organizationid/wallet/account", adminRequired, namespaced, wallet.CreateAccount)
@@ -0,0 +1,126 @@
+// Package paymentrouting is the admin surface for an org's payment routing
+// rules: read them, replace them, and dry-run a hypothetical payment against
+// them to see which rule and processor it would hit.
+package paymentrouting
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/payment"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/payment/router"
+	"github.com/hanzoai/commerce/thirdparty/kms"
+	"github.com/hanzoai/commerce/util/json/http"
+)
+
+// orgFor returns the caller's org, provided it is the one named in the path,
+// or writes a 403 and returns nil.
+func orgFor(c *zip.Ctx) *organization.Organization {
+	org := middleware.GetOrganization(c)
+	id := c.Param("organizationid")
+
+	if id != org.Id() && id != org.Name && id != org.FullName {
+		http.Fail(c, 403, "Organization Id does not match key", errors.New("Organization Id does not match key"))
+		return nil
+	}
+	return org
+}
+
+// probe resolves settings against the org's processors. The org's payment
+// credentials come from KMS, and a hydrated org must never be saved: they
+// would land in the datastore in the clear. So the credentials go on a second
+// copy of the org, which is checked and thrown away.
+func probe(c *zip.Ctx, org *organization.Organization, settings router.Settings) (*router.Router, error) {
+	p := organization.New(org.Datastore())
+	if err := p.GetById(org.Id()); err != nil {
+		return nil, err
+	}
+	p.PaymentRouting = settings
+
+	if v := c.Locals("kms"); v != nil {
+		if kmsClient, ok := v.(*kms.CachedClient); ok {
+			if err := kms.Hydrate(kmsClient, p); err != nil {
+				log.Error("KMS hydration failed for org %q: %v", p.Name, err, c)
+			}
+		}
+	}
+
+	return payment.RouterForOrg(p)
+}
+
+func Get(c *zip.Ctx) error {
+	org := orgFor(c)
+	if org == nil {
+		return nil
+	}
+	return http.Render(c, 200, org.PaymentRouting)
+}
+
+// Set replaces the org's routing settings. Nothing is saved unless every rule
+// validates against the processors the org can charge through; the 400 lists
+// every problem at once.
+func Set(c *zip.Ctx) error {
+	org := orgFor(c)
+	if org == nil {
+		return nil
+	}
+
+	settings, err := router.ParseSettings(c.Body())
+	if err != nil {
+		return http.Fail(c, 400, "Failed decode request body", err)
+	}
+
+	if _, err := probe(c, org, settings); err != nil {
+		return http.Fail(c, 400, err.Error(), err)
+	}
+
+	org.PaymentRouting = settings
+	if err := org.Put(); err != nil {
+		return http.Fail(c, 500, "Failed to save payment routing", err)
+	}
+	c.SetHeader("Location", c.Path())
+	return http.Render(c, 201, org.PaymentRouting)
+}
+
+type dryRunRequest struct {
+	Request processor.PaymentRequest `json:"request"`
+
+	// Settings, when given, are dry-run instead of the saved ones, so a rule
+	// change can be tried before it is made.
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
+// DryRun reports which rule and processor a hypothetical payment would hit.
+// Nothing is charged and nothing is recorded.
+func DryRun(c *zip.Ctx) error {
+	org := orgFor(c)
+	if org == nil {
+		return nil
+	}
+
+	var req dryRunRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return http.Fail(c, 400, "Failed decode request body", err)
+	}
+
+	settings := org.PaymentRouting
+	if len(req.Settings) > 0 {
+		s, err := router.ParseSettings(req.Settings)
+		if err != nil {
+			return http.Fail(c, 400, "Failed decode settings", err)
+		}
+		settings = s
+	}
+
+	r, err := probe(c, org, settings)
+	if err != nil {
+		return http.Fail(c, 400, err.Error(), err)
+	}
+	return http.Render(c, 200, r.DryRun(req.Request))
+}
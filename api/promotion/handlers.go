@@ -2,6 +2,7 @@ package promotion
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/zap-proto/zip"
@@ -11,6 +12,7 @@ import (
 	"github.com/hanzoai/commerce/models/applicationmethod"
 	"github.com/hanzoai/commerce/models/campaignbudget"
 	promotionModel "github.com/hanzoai/commerce/models/promotion"
+	"github.com/hanzoai/commerce/models/promotion/engine"
 	"github.com/hanzoai/commerce/models/promotionrule"
 	"github.com/hanzoai/commerce/models/types/currency"
 	"github.com/hanzoai/commerce/util/json"
@@ -32,18 +34,29 @@ func Route(router zip.Router, args ...zip.Handler) {
 }
 
 type evalItem struct {
-	ProductId string `json:"productId"`
-	VariantId string `json:"variantId"`
-	Quantity  int    `json:"quantity"`
-	Amount    int64  `json:"amount"`
+	ProductId     string   `json:"productId"`
+	VariantId     string   `json:"variantId"`
+	CollectionIds []string `json:"collectionIds,omitempty"`
+	TagIds        []string `json:"tagIds,omitempty"`
+	CategoryIds   []string `json:"categoryIds,omitempty"`
+	Quantity      int      `json:"quantity"`
+
+	// Unit price, in the currency's minor unit.
+	Amount int64 `json:"amount"`
 }
 
 type evalRequest struct {
 	Items           []evalItem `json:"items"`
 	CurrencyCode    string     `json:"currencyCode"`
 	RegionId        string     `json:"regionId,omitempty"`
+	SalesChannelId  string     `json:"salesChannelId,omitempty"`
+	CustomerId      string     `json:"customerId,omitempty"`
 	CustomerGroupId string     `json:"customerGroupId,omitempty"`
-	CartTotal       int64      `json:"cartTotal"`
+	Codes           []string   `json:"codes,omitempty"`
+	Shipping        int64      `json:"shipping,omitempty"`
+
+	// CartTotal stands in for items when none are given.
+	CartTotal int64 `json:"cartTotal"`
 }
 
 type adjustment struct {
@@ -51,18 +64,22 @@ type adjustment struct {
 	Code        string `json:"code"`
 	Amount      int64  `json:"amount"`
 	Type        string `json:"type"`
+	Target      string `json:"target"`
 }
 
 type evalResponse struct {
-	Adjustments   []adjustment `json:"adjustments"`
-	TotalDiscount int64        `json:"totalDiscount"`
+	Adjustments      []adjustment `json:"adjustments"`
+	TotalDiscount    int64        `json:"totalDiscount"`
+	ShippingDiscount int64        `json:"shippingDiscount"`
 }
 
-// Evaluate finds applicable promotions for a given cart/order context.
+// Evaluate previews the promotions a cart would get.
 //
-// It queries all active automatic promotions, checks date ranges and
-// currency constraints, then calculates discount adjustments using the
-// associated ApplicationMethod.
+// It runs the same engine cart totals and checkout do (models/promotion/engine)
+// and only reports: nothing is saved and no campaign budget is spent. The
+// engine's per-line adjustments are summed per promotion. TotalDiscount is
+// everything taken off, ShippingDiscount the part of it that came off
+// shipping.
 func Evaluate(c *zip.Ctx) error {
 	var req evalRequest
 	if err := json.DecodeBytes(c.Body(), &req); err != nil {
@@ -74,59 +91,76 @@ func Evaluate(c *zip.Ctx) error {
 	defer cancel()
 	db := datastore.New(ctx)
 
-	now := time.Now()
-	var promotions []*promotionModel.Promotion
-	q := promotionModel.Query(db).Filter("Status=", "active").Filter("IsAutomatic=", true)
-	if _, err := q.GetAll(&promotions); err != nil {
-		return jsonhttp.Fail(c, 500, "Failed to query promotions", err)
+	cart := &engine.Cart{
+		Currency:       req.CurrencyCode,
+		CustomerId:     req.CustomerId,
+		SalesChannelId: req.SalesChannelId,
+		RegionId:       req.RegionId,
+		Codes:          req.Codes,
+		Items:          make([]engine.Item, 0, len(req.Items)),
+		Subtotal:       currency.Cents(req.CartTotal),
+		Shipping:       currency.Cents(req.Shipping),
 	}
-
-	adjustments := make([]adjustment, 0)
-	totalDiscount := int64(0)
-
-	for _, promo := range promotions {
-		if promo.StartsAt != nil && promo.StartsAt.After(now) {
-			continue
+	if req.CustomerGroupId != "" {
+		cart.CustomerGroupIds = []string{req.CustomerGroupId}
+	} else if req.CustomerId != "" {
+		groups, err := engine.CustomerGroups(db, req.CustomerId)
+		if err != nil {
+			return jsonhttp.Fail(c, 500, "Failed to query customer groups", err)
 		}
-		if promo.EndsAt != nil && promo.EndsAt.Before(now) {
-			continue
+		cart.CustomerGroupIds = groups
+	}
+	for i, it := range req.Items {
+		id := it.VariantId
+		if id == "" {
+			id = it.ProductId
 		}
-
-		am := applicationmethod.New(db)
-		ok, err := am.Query().Filter("PromotionId=", promo.Id()).Get()
-		if err != nil || !ok {
-			continue
+		if id == "" {
+			id = strconv.Itoa(i)
 		}
+		cart.Items = append(cart.Items, engine.Item{
+			Id:            id,
+			ProductId:     it.ProductId,
+			VariantId:     it.VariantId,
+			CollectionIds: it.CollectionIds,
+			TagIds:        it.TagIds,
+			CategoryIds:   it.CategoryIds,
+			Quantity:      it.Quantity,
+			UnitPrice:     currency.Cents(it.Amount),
+		})
+	}
 
-		if am.CurrencyCode != "" && am.CurrencyCode != req.CurrencyCode {
-			continue
-		}
+	candidates, err := engine.Load(db, cart.Codes)
+	if err != nil {
+		return jsonhttp.Fail(c, 500, "Failed to query promotions", err)
+	}
+	res := engine.Evaluate(cart, candidates, time.Now())
 
-		var discountAmount int64
-		switch am.Type {
-		case "percentage":
-			if am.TargetType == "order" {
-				// Value is in basis points: 1500 = 15.00%. Rounded, not floored by
-				// integer division — same rule as every other discount.
-				discountAmount = int64(currency.Cents(req.CartTotal).BasisPoints(am.Value))
-			}
-		case "fixed":
-			discountAmount = int64(am.Value)
-		}
+	types := make(map[string]string, len(candidates))
+	for _, cand := range candidates {
+		types[cand.Promotion.Id()] = cand.Method.Type
+	}
 
-		if discountAmount > 0 {
+	adjustments := make([]adjustment, 0)
+	index := make(map[string]int)
+	for _, a := range res.Adjustments {
+		i, ok := index[a.PromotionId+"/"+a.Target]
+		if !ok {
+			i = len(adjustments)
+			index[a.PromotionId+"/"+a.Target] = i
 			adjustments = append(adjustments, adjustment{
-				PromotionId: promo.Id(),
-				Code:        promo.Code,
-				Amount:      discountAmount,
-				Type:        am.Type,
+				PromotionId: a.PromotionId,
+				Code:        a.Code,
+				Type:        types[a.PromotionId],
+				Target:      a.Target,
 			})
-			totalDiscount += discountAmount
 		}
+		adjustments[i].Amount += int64(a.Amount)
 	}
 
 	return jsonhttp.Render(c, 200, evalResponse{
-		Adjustments:   adjustments,
-		TotalDiscount: totalDiscount,
+		Adjustments:      adjustments,
+		TotalDiscount:    int64(res.Discount + res.ShippingDiscount),
+		ShippingDiscount: int64(res.ShippingDiscount),
 	})
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/hanzoai/commerce/models/applicationmethod"
 	"github.com/hanzoai/commerce/models/campaignbudget"
 	promotionModel "github.com/hanzoai/commerce/models/promotion"
+	"github.com/hanzoai/commerce/models/promotionrule"
 	"github.com/hanzoai/commerce/util/nscontext"
 	"github.com/hanzoai/commerce/util/test/ae"
 )
@@ -266,3 +267,50 @@ func TestCampaignBudget_Burndown(t *testing.T) {
 		t.Fatalf("remaining = %d, want 25000", remaining)
 	}
 }
+
+// TestEvaluate_ItemRulesAndCodes proves Evaluate runs the rule engine: a
+// code-only promotion applies once its code is entered, and only to the items
+// its target rules pick.
+func TestEvaluate_ItemRulesAndCodes(t *testing.T) {
+	const ns = "acme"
+	tc := ae.NewContext()
+	defer tc.Close()
+	db := datastore.New(nscontext.WithNamespace(context.Background(), ns))
+
+	p := seedPromo(t, db, "HATS20", applicationmethod.ApplicationMethod{
+		Type: "percentage", TargetType: "items", Value: 2000, CurrencyCode: "usd",
+	})
+	p.IsAutomatic = false
+	if err := p.Update(); err != nil {
+		t.Fatalf("update promotion: %v", err)
+	}
+	r := promotionrule.New(db)
+	r.PromotionId = p.Id()
+	r.Scope = promotionrule.ScopeTarget
+	r.Attribute = "product"
+	r.Operator = "eq"
+	r.Values = []string{"hat"}
+	if err := r.Create(); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+
+	req := evalRequest{
+		CurrencyCode: "usd",
+		Items: []evalItem{
+			{ProductId: "shirt", Quantity: 2, Amount: 2000},
+			{ProductId: "hat", Quantity: 1, Amount: 1500},
+		},
+	}
+	if out := evalOver(t, ns, req); out.TotalDiscount != 0 {
+		t.Fatalf("total discount = %d without the code, want 0", out.TotalDiscount)
+	}
+
+	req.Codes = []string{"hats20"}
+	out := evalOver(t, ns, req)
+	if out.TotalDiscount != 300 {
+		t.Fatalf("total discount = %d, want 300 (20%% of the hat only)", out.TotalDiscount)
+	}
+	if len(out.Adjustments) != 1 || out.Adjustments[0].Target != "items" {
+		t.Fatalf("adjustments = %+v, want one item adjustment", out.Adjustments)
+	}
+}
@@ -0,0 +1,131 @@
+// Package recommend serves product recommendations:
+//
+//	GET /v1/commerce/recommendations/product/:productid/similar
+//	GET /v1/commerce/recommendations/product/:productid/bought-together
+//	GET /v1/commerce/recommendations/account
+//	GET /v1/commerce/recommendations/user/:userid
+//
+// The first three are for storefronts, with the org's published token, the
+// account one also with the shopper's; the last is an admin's view of what
+// a customer is shown. What is recommended, and why, is
+// models/product/recommend's.
+package recommend
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/product/recommend"
+	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/permission"
+)
+
+func Route(router zip.Router) {
+	adminRequired := middleware.TokenRequired(permission.Admin)
+	publishedRequired := middleware.TokenRequired(permission.Admin, permission.Published)
+	accountRequired := middleware.AccountRequired()
+	namespaced := middleware.Namespace()
+
+	api := router.Group("recommendations")
+	api.Use(middleware.AccessControl("*"))
+
+	api.Get("/product/:productid/similar", publishedRequired, namespaced, similar)
+	api.Get("/product/:productid/bought-together", publishedRequired, namespaced, boughtTogether)
+	api.Get("/account", publishedRequired, accountRequired, namespaced, forAccount)
+	api.Get("/user/:userid", adminRequired, namespaced, forUser)
+}
+
+type recommendation struct {
+	Product *product.Product `json:"product"`
+	Score   float64          `json:"score"`
+	Reason  string           `json:"reason"`
+}
+
+func similar(c *zip.Ctx) error {
+	return ofProduct(c, (*recommend.Recommender).Similar)
+}
+
+func boughtTogether(c *zip.Ctx) error {
+	return ofProduct(c, (*recommend.Recommender).BoughtTogether)
+}
+
+// ofProduct answers with what find recommends alongside the product in the
+// path.
+func ofProduct(c *zip.Ctx, find func(*recommend.Recommender, context.Context, string, int) ([]recommend.Recommendation, error)) error {
+	rec, db, limit, ok := setup(c)
+	if !ok {
+		return nil
+	}
+
+	p := product.New(db)
+	if err := p.GetById(c.Param("productid")); err != nil || p.Hidden {
+		return http.Fail(c, 404, "No product found with id: "+c.Param("productid"), err)
+	}
+
+	found, err := find(rec, db.Context, p.Id(), limit)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to recommend products", err)
+	}
+	return render(c, db, found)
+}
+
+func forAccount(c *zip.Ctx) error {
+	return forCustomer(c, middleware.GetUser(c).Id())
+}
+
+func forUser(c *zip.Ctx) error {
+	return forCustomer(c, c.Param("userid"))
+}
+
+func forCustomer(c *zip.Ctx, userId string) error {
+	rec, db, limit, ok := setup(c)
+	if !ok {
+		return nil
+	}
+	found, err := rec.ForCustomer(db.Context, userId, limit)
+	if err != nil {
+		return http.Fail(c, 500, "Failed to recommend products", err)
+	}
+	return render(c, db, found)
+}
+
+// setup is what every handler needs: the recommender, the org's datastore
+// and the limit asked for. It has failed the request when ok is false.
+func setup(c *zip.Ctx) (rec *recommend.Recommender, db *datastore.Datastore, limit int, ok bool) {
+	rec = recommend.Default()
+	if rec == nil {
+		http.Fail(c, 503, "Recommendations are not available", nil)
+		return nil, nil, 0, false
+	}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Fail(c, 400, "limit must be a positive number", err)
+			return nil, nil, 0, false
+		}
+		limit = min(n, recommend.MaxLimit)
+	}
+
+	org := middleware.GetOrganization(c)
+	return rec, datastore.New(org.Namespaced(c.Context())), limit, true
+}
+
+// render answers with the products recommended, leaving out those deleted
+// or hidden since they were embedded or bought.
+func render(c *zip.Ctx, db *datastore.Datastore, found []recommend.Recommendation) error {
+	res := make([]recommendation, 0, len(found))
+	for _, r := range found {
+		p := product.New(db)
+		if err := p.GetById(r.ProductId); err != nil || p.Hidden {
+			continue
+		}
+		res = append(res, recommendation{Product: p, Score: r.Score, Reason: r.Reason})
+	}
+	return http.Render(c, 200, res)
+}
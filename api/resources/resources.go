@@ -45,7 +45,8 @@ import (
 	"github.com/hanzoai/commerce/models/variant"
 	"github.com/hanzoai/commerce/models/wallet"
 	"github.com/hanzoai/commerce/models/watchlist"
-	"github.com/hanzoai/commerce/models/webhook"
+
+	webhookApi "github.com/hanzoai/commerce/api/webhook"
 
 	"github.com/hanzoai/commerce/util/rest"
 )
@@ -75,7 +76,9 @@ func Route(api zip.Router, tokenRequired, adminRequired, requireAccess, productE
 	rest.New(variant.Variant{}).Route(api, tokenRequired, requireAccess)
 	rest.New(wallet.Wallet{}).Route(api, adminRequired)
 	rest.New(watchlist.Watchlist{}).Route(api, tokenRequired)
-	rest.New(webhook.Webhook{}).Route(api, adminRequired)
+	// Webhooks carry their delivery log, replay and secret rotation on top of
+	// the CRUD; the package is as light as this one (models plus the binder).
+	webhookApi.Route(api, adminRequired)
 
 	rest.New(saleschannel.SalesChannel{}).Route(api, tokenRequired, requireAccess)
 	rest.New(stocklocation.StockLocation{}).Route(api, tokenRequired, requireAccess)
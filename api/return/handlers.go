@@ -0,0 +1,393 @@
+// Package return_ wires the return (RMA) HTTP surface: CRUD on returns plus
+// the steps a return goes through — approve or reject, a return label,
+// receive and inspect, and settlement by refund, store credit or exchange.
+// The rules live in models/return/rma; these handlers load, gate and render.
+//
+// A return is requested by the merchant, or by the customer with their
+// storefront key and the email the order was placed with, which is what
+// proves a guest's order is theirs. Every later step is the merchant's and
+// is admin-gated INSIDE the handler (the route middleware no-ops on the IAM
+// path). Settling is idempotent: a completed return returns what it was
+// settled with without refunding or crediting twice.
+package return_
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/middleware/iammiddleware"
+	"github.com/hanzoai/commerce/models/exchange"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	return_ "github.com/hanzoai/commerce/models/return"
+	"github.com/hanzoai/commerce/models/return/rma"
+	"github.com/hanzoai/commerce/payment"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/util/bit"
+	"github.com/hanzoai/commerce/util/json"
+	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/permission"
+	"github.com/hanzoai/commerce/util/rest"
+)
+
+func Route(router zip.Router, args ...zip.Handler) {
+	namespaced := middleware.Namespace()
+
+	api := rest.New(return_.Return{})
+	api.Create = Create
+	api.POST("/:returnid/approve", namespaced, Approve)
+	api.POST("/:returnid/reject", namespaced, Reject)
+	api.POST("/:returnid/cancel", namespaced, Cancel)
+	api.POST("/:returnid/label", namespaced, Label)
+	api.POST("/:returnid/receive", namespaced, Receive)
+	api.POST("/:returnid/refund", namespaced, Refund)
+	api.POST("/:returnid/store-credit", namespaced, StoreCredit)
+	api.POST("/:returnid/exchange", namespaced, Exchange)
+	api.Route(router, args...)
+}
+
+// isAdmin reports whether the caller is the merchant, as RequireAdmin
+// decides it, without writing a 403: Create serves the customer too.
+func isAdmin(c *zip.Ctx) bool {
+	if v := c.Locals("permissions"); v != nil {
+		if f, ok := v.(bit.Field); ok && f.Has(permission.Admin) {
+			return true
+		}
+	}
+	claims := iammiddleware.GetIAMClaims(c)
+	return claims.IsAdmin || claims.IsSuperAdmin()
+}
+
+// fail renders an rma error with the status it calls for.
+func fail(c *zip.Ctx, err error) error {
+	switch {
+	case errors.Is(err, rma.ErrResolution):
+		return http.Fail(c, 400, err.Error(), err)
+	case errors.Is(err, rma.ErrState):
+		return http.Fail(c, 409, err.Error(), err)
+	case errors.Is(err, rma.ErrNoLines),
+		errors.Is(err, rma.ErrNotReturnable),
+		errors.Is(err, rma.ErrNotReceived),
+		errors.Is(err, rma.ErrOverRefund),
+		errors.Is(err, rma.ErrNoPayment),
+		errors.Is(err, rma.ErrNoProcessor),
+		errors.Is(err, rma.ErrNoLabel):
+		return http.Fail(c, 422, err.Error(), err)
+	}
+	return http.Fail(c, 500, "Failed to process return", err)
+}
+
+// createRequest is the body of POST /return.
+type createRequest struct {
+	OrderId    string         `json:"orderId"`
+	Email      string         `json:"email"`
+	Resolution string         `json:"resolution"`
+	Lines      []return_.Line `json:"lines"`
+}
+
+// Create requests a return of some of an order's fulfilled units. A caller
+// that is not the merchant must give the order's email; an order whose email
+// does not match is reported as not found, so order ids cannot be probed.
+func Create(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.NewNamespaced(org.Namespaced(c.Context()))
+
+	var req createRequest
+	if err := json.DecodeBytes(c.Body(), &req); err != nil {
+		return http.Fail(c, 400, "Failed to decode request body", err)
+	}
+	req.OrderId = strings.TrimSpace(req.OrderId)
+	if req.OrderId == "" {
+		return http.Fail(c, 400, "orderId is required", errors.New("missing orderId"))
+	}
+
+	ord := order.New(db)
+	if err := ord.GetById(req.OrderId); err != nil {
+		return http.Fail(c, 404, "No order found with id: "+req.OrderId, err)
+	}
+
+	by := "admin"
+	if !isAdmin(c) {
+		by = "customer"
+		email := strings.TrimSpace(req.Email)
+		if email == "" || ord.Email == "" || !strings.EqualFold(email, ord.Email) {
+			return http.Fail(c, 404, "No order found with id: "+req.OrderId, errors.New("email does not match order"))
+		}
+	}
+
+	r, err := rma.Request(db, ord, req.Lines, by, req.Resolution)
+	if err != nil {
+		return fail(c, err)
+	}
+	return http.Render(c, 201, r)
+}
+
+// load is the return named in the route and its order, or renders why not.
+func load(c *zip.Ctx) (*datastore.Datastore, *return_.Return, *order.Order, bool) {
+	org := middleware.GetOrganization(c)
+	db := datastore.NewNamespaced(org.Namespaced(c.Context()))
+
+	id := c.Param("returnid")
+	r := return_.New(db)
+	if err := r.GetById(id); err != nil {
+		_ = http.Fail(c, 404, "No return found with id: "+id, err)
+		return nil, nil, nil, false
+	}
+	ord := order.New(db)
+	if err := ord.GetById(r.OrderId); err != nil {
+		_ = http.Fail(c, 404, "No order found with id: "+r.OrderId, err)
+		return nil, nil, nil, false
+	}
+	return db, r, ord, true
+}
+
+// approveRequest is the body of POST /return/:id/approve.
+type approveRequest struct {
+	// LocationId is where received units are to be restocked.
+	LocationId string `json:"locationId"`
+}
+
+// Approve accepts a requested return.
+func Approve(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	var req approveRequest
+	if body := c.Body(); len(body) > 0 {
+		if err := json.DecodeBytes(body, &req); err != nil {
+			return http.Fail(c, 400, "Failed to decode request body", err)
+		}
+	}
+	return transition(c, return_.Approved, func(r *return_.Return) {
+		if req.LocationId != "" {
+			r.LocationId = req.LocationId
+		}
+	})
+}
+
+// Reject refuses a requested return.
+func Reject(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	return transition(c, return_.Rejected, nil)
+}
+
+// Cancel withdraws a return that has not been received.
+func Cancel(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	return transition(c, return_.Canceled, nil)
+}
+
+// transition moves the route's return to status to, idempotently: a return
+// already there is rendered as it is.
+func transition(c *zip.Ctx, to string, set func(*return_.Return)) error {
+	_, r, _, ok := load(c)
+	if !ok {
+		return nil
+	}
+	if r.Status == to {
+		return http.Render(c, 200, r)
+	}
+	if err := rma.Transition(r, to, time.Now()); err != nil {
+		return fail(c, err)
+	}
+	if set != nil {
+		set(r)
+	}
+	if err := r.Update(); err != nil {
+		return http.Fail(c, 500, "Failed to update return", err)
+	}
+	return http.Render(c, 200, r)
+}
+
+// Label buys a return label from the provider that shipped the order.
+func Label(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	db, r, ord, ok := load(c)
+	if !ok {
+		return nil
+	}
+	if err := rma.Label(c.Context(), db, middleware.GetOrganization(c), ord, r); err != nil {
+		return fail(c, err)
+	}
+	if err := r.Update(); err != nil {
+		return http.Fail(c, 500, "Failed to update return", err)
+	}
+	return http.Render(c, 200, r)
+}
+
+// receiveRequest is the body of POST /return/:id/receive.
+type receiveRequest struct {
+	// Lines are what arrived: per line item, the received quantity and
+	// condition.
+	Lines      []return_.Line `json:"lines"`
+	LocationId string         `json:"locationId"`
+}
+
+// Receive records what arrived and restocks what can be sold again.
+func Receive(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	var req receiveRequest
+	if err := json.DecodeBytes(c.Body(), &req); err != nil {
+		return http.Fail(c, 400, "Failed to decode request body", err)
+	}
+	db, r, ord, ok := load(c)
+	if !ok {
+		return nil
+	}
+	if err := rma.Inspect(db, ord, r, req.Lines, req.LocationId); err != nil {
+		return fail(c, err)
+	}
+	if err := r.Update(); err != nil {
+		return http.Fail(c, 500, "Failed to update return", err)
+	}
+	return http.Render(c, 200, r)
+}
+
+// Refund settles a received return with a refund. The body may name the
+// payment intent or invoice to refund against; otherwise the order's is
+// used.
+func Refund(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	var p rma.Payment
+	if body := c.Body(); len(body) > 0 {
+		if err := json.DecodeBytes(body, &p); err != nil {
+			return http.Fail(c, 400, "Failed to decode request body", err)
+		}
+	}
+	db, r, ord, ok := load(c)
+	if !ok {
+		return nil
+	}
+	if r.Status == return_.Completed {
+		return http.Render(c, 200, r)
+	}
+	proc, err := refundProcessor(middleware.GetOrganization(c), db, ord, p)
+	if err != nil {
+		return fail(c, err)
+	}
+	if err := rma.Refund(c.Context(), db, ord, r, p, proc); err != nil {
+		return settled(c, r, err)
+	}
+	return http.Render(c, 200, r)
+}
+
+// settled renders a return another request completed while this one waited
+// for the order's lock as it was settled, and any other error as fail does.
+func settled(c *zip.Ctx, r *return_.Return, err error) error {
+	if errors.Is(err, rma.ErrState) && r.Status == return_.Completed {
+		return http.Render(c, 200, r)
+	}
+	return fail(c, err)
+}
+
+// refundProcessor is what a refund of ord against p goes through: the
+// processor that took the payment, else the org's payment router. A payment
+// no processor took, or an invoice, is refunded without one.
+func refundProcessor(org *organization.Organization, db *datastore.Datastore, ord *order.Order, p rma.Payment) (processor.PaymentProcessor, error) {
+	p, err := rma.PaymentOf(ord, p)
+	if err != nil || p.PaymentIntentId == "" {
+		return nil, nil
+	}
+	pi := paymentintent.New(db)
+	if err := pi.GetById(p.PaymentIntentId); err != nil || pi.ProviderRef == "" {
+		return nil, nil
+	}
+	if pi.ProviderType != "" {
+		proc, err := payment.ProcessorsForOrg(org).Get(processor.ProcessorType(pi.ProviderType))
+		if err != nil {
+			return nil, rma.ErrNoProcessor
+		}
+		return proc, nil
+	}
+	r, err := payment.RouterForOrg(org)
+	if err != nil {
+		return nil, rma.ErrNoProcessor
+	}
+	return r, nil
+}
+
+// StoreCredit settles a received return with a gift card.
+func StoreCredit(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	db, r, ord, ok := load(c)
+	if !ok {
+		return nil
+	}
+	if r.Status == return_.Completed {
+		return http.Render(c, 200, r)
+	}
+	if err := rma.StoreCredit(db, ord, r); err != nil {
+		return settled(c, r, err)
+	}
+	return http.Render(c, 200, r)
+}
+
+// exchangeResponse is the settled return with the replacement order and
+// the difference the customer owes (> 0) or was given back (< 0).
+type exchangeResponse struct {
+	Return             *return_.Return `json:"return"`
+	ReplacementOrderId string          `json:"replacementOrderId"`
+	ExchangeId         string          `json:"exchangeId"`
+	DifferenceDue      int64           `json:"differenceDueCents"`
+}
+
+// Exchange settles a received return by shipping other items in its place.
+func Exchange(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	var p rma.ExchangeParams
+	if err := json.DecodeBytes(c.Body(), &p); err != nil {
+		return http.Fail(c, 400, "Failed to decode request body", err)
+	}
+	db, r, ord, ok := load(c)
+	if !ok {
+		return nil
+	}
+	var e *exchange.Exchange
+	if r.Status != return_.Completed {
+		proc, err := refundProcessor(middleware.GetOrganization(c), db, ord, p.Payment)
+		if err != nil {
+			return fail(c, err)
+		}
+		// A return settled while this request waited for the order's lock
+		// is rendered with the exchange it was settled with.
+		_, e, err = rma.Exchange(c.Context(), db, ord, r, p, proc)
+		if err != nil && !(errors.Is(err, rma.ErrState) && r.Status == return_.Completed) {
+			return fail(c, err)
+		}
+	}
+	if e == nil {
+		if r.ExchangeId == "" {
+			return http.Fail(c, 409, "Return was settled without an exchange", rma.ErrState)
+		}
+		e = exchange.New(db)
+		if err := e.GetById(r.ExchangeId); err != nil {
+			return http.Fail(c, 404, "No exchange found with id: "+r.ExchangeId, err)
+		}
+	}
+	return http.Render(c, 200, exchangeResponse{
+		Return:             r,
+		ReplacementOrderId: r.ReplacementOrderId,
+		ExchangeId:         e.Id(),
+		DifferenceDue:      int64(e.DifferenceDueCents),
+	})
+}
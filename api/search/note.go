@@ -7,14 +7,20 @@ import (
 
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/models/note"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/search"
 )
 
 type searchReq struct {
 	After  time.Time `json:"after"`
 	Before time.Time `json:"before"`
+
+	// Q, when set, searches the notes' text through the search index. The
+	// window then narrows the matches, and either end may be left open.
+	Q string `json:"q"`
 }
 
 func searchNote(c *zip.Ctx) error {
@@ -28,6 +34,10 @@ func searchNote(c *zip.Ctx) error {
 
 	nts := make([]*note.Note, 0)
 
+	if req.Q != "" {
+		return searchNoteText(c, db, req)
+	}
+
 	q := note.Query(db).Filter("Enabled=", true).Filter("Time>", req.After).Filter("Time<=", req.Before)
 	if _, err := q.GetAll(&nts); err != nil {
 		return http.Fail(c, 500, "Failed to get logs", err)
@@ -35,3 +45,43 @@ func searchNote(c *zip.Ctx) error {
 
 	return http.Render(c, 200, nts)
 }
+
+func searchNoteText(c *zip.Ctx, db *datastore.Datastore, req *searchReq) error {
+	index, err := search.Open(mixin.DefaultIndex)
+	if err != nil {
+		return http.Fail(c, 404, "Failed to find index 'note'", err)
+	}
+
+	nts := make([]*note.Note, 0)
+	for t := index.Search(db.Context, req.Q, &search.SearchOptions{
+		IDsOnly: true,
+		Limit:   1000,
+		Refinements: []search.Facet{
+			{Name: "kind", Value: "note"},
+			{Name: "enabled", Value: "enabled"},
+		},
+	}); ; {
+		id, err := t.Next(nil)
+		if err == search.Done {
+			break
+		}
+		if err != nil {
+			return http.Fail(c, 500, "Failed to search index 'note'", err)
+		}
+
+		n := note.New(db)
+		if err := n.GetById(id); err != nil {
+			// Indexed but gone: the index catches up on its own.
+			continue
+		}
+		if !req.After.IsZero() && !n.Time.After(req.After) {
+			continue
+		}
+		if !req.Before.IsZero() && n.Time.After(req.Before) {
+			continue
+		}
+		nts = append(nts, n)
+	}
+
+	return http.Render(c, 200, nts)
+}
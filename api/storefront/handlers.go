@@ -0,0 +1,219 @@
+// Package storefront is the shopper-facing product search:
+//
+//	GET /v1/commerce/products/search
+//
+// It is called with the org's published token, which picks the org, and a
+// publishable API key in the x-publishable-api-key header, whose sales
+// channels pick what of the org's catalog the storefront sells. The search
+// itself is models/product/storefront's.
+package storefront
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/models/product"
+	storefrontmodel "github.com/hanzoai/commerce/models/product/storefront"
+	"github.com/hanzoai/commerce/models/publishableapikey"
+	"github.com/hanzoai/commerce/models/saleschannel"
+	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// KeyHeader carries the id of the publishable API key a storefront searches
+// with.
+const KeyHeader = "x-publishable-api-key"
+
+func Route(router zip.Router, args ...zip.Handler) {
+	namespaced := middleware.Namespace()
+
+	group := router.Group("products")
+	group.Use(middleware.AccessControl("*"))
+
+	group.Get("/search", append(append([]zip.Handler{}, args...), namespaced, searchProducts)...)
+}
+
+type facetValue struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// priceRange is a search.Range as JSON, which has no infinity: an open end
+// is left out.
+type priceRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+type searchRes struct {
+	Products   []*product.Product      `json:"products"`
+	Count      int                     `json:"count"`
+	Facets     map[string][]facetValue `json:"facets"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+// searchProducts answers a storefront search with a page of products, how
+// many matched in all, the facets of what matched and the cursor of the next
+// page.
+//
+// Query parameters: q; category, collection, tag and type, each a
+// comma-separated list of ids; option, a comma-separated list of Name:Value;
+// in_stock=true; price_min and price_max in the smallest currency unit;
+// price_ranges, the price facet's buckets as min-max pairs, "0-2500,2500-";
+// sort, one of relevance, price_asc, price_desc, newest and best_selling;
+// limit; cursor, as returned in nextCursor.
+func searchProducts(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	channels, status, err := keyChannels(c, db)
+	if err != nil {
+		return http.Fail(c, status, err.Error(), err)
+	}
+
+	q, err := parseQuery(func(key string) string { return c.Query(key) })
+	if err != nil {
+		return http.Fail(c, 400, err.Error(), err)
+	}
+
+	res := &searchRes{Products: make([]*product.Product, 0), Facets: make(map[string][]facetValue)}
+	if len(channels) == 0 {
+		// Every channel of the key is disabled: it sells nothing.
+		return http.Render(c, 200, res)
+	}
+	q.SalesChannels = channels
+
+	found, err := storefrontmodel.Search(db.Context, q)
+	if errors.Is(err, storefrontmodel.ErrBadCursor) || errors.Is(err, storefrontmodel.ErrBadSort) {
+		return http.Fail(c, 400, err.Error(), err)
+	}
+	if err != nil {
+		return http.Fail(c, 500, "Failed to search products", err)
+	}
+
+	for _, id := range found.Ids {
+		p := product.New(db)
+		if err := p.GetById(id); err != nil || p.Hidden {
+			// Indexed but gone or hidden since: the index catches up on
+			// its own.
+			continue
+		}
+		res.Products = append(res.Products, p)
+	}
+	res.Count = found.Count
+	res.NextCursor = found.Next
+	for name, values := range found.Facets {
+		out := make([]facetValue, 0, len(values))
+		for _, v := range values {
+			value := v.Value
+			if r, ok := value.(search.Range); ok {
+				value = rangeOf(r)
+			}
+			out = append(out, facetValue{Value: value, Count: v.Count})
+		}
+		res.Facets[name] = out
+	}
+	return http.Render(c, 200, res)
+}
+
+// keyChannels is the enabled sales channels of the request's publishable
+// key, with the status to refuse the request with when there is no usable
+// key. A key needs a channel to be usable: one without any would otherwise
+// see only what is sold everywhere, which is never what was meant.
+func keyChannels(c *zip.Ctx, db *datastore.Datastore) ([]string, int, error) {
+	id := strings.TrimSpace(c.Header(KeyHeader))
+	if id == "" {
+		return nil, 400, errors.New("A publishable API key is required in the " + KeyHeader + " header")
+	}
+	k := publishableapikey.New(db)
+	if err := k.GetById(id); err != nil || !k.Usable() {
+		return nil, 401, errors.New("Invalid publishable API key")
+	}
+	if len(k.SalesChannelIds) == 0 {
+		return nil, 400, errors.New("The publishable API key has no sales channel")
+	}
+
+	channels := make([]string, 0, len(k.SalesChannelIds))
+	for _, id := range k.SalesChannelIds {
+		ch := saleschannel.New(db)
+		if err := ch.GetById(id); err != nil || ch.IsDisabled {
+			continue
+		}
+		channels = append(channels, ch.Id())
+	}
+	return channels, 0, nil
+}
+
+// parseQuery reads a search from the query parameters get returns.
+func parseQuery(get func(key string) string) (*storefrontmodel.Query, error) {
+	q := &storefrontmodel.Query{
+		Text:        strings.TrimSpace(get("q")),
+		Categories:  list(get("category")),
+		Collections: list(get("collection")),
+		Tags:        list(get("tag")),
+		Types:       list(get("type")),
+		Options:     list(get("option")),
+		InStock:     get("in_stock") == "true",
+		Sort:        storefrontmodel.Sort(get("sort")),
+		Cursor:      get("cursor"),
+	}
+
+	var err error
+	if v := get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+	}
+	if v := get("price_min"); v != "" {
+		if q.PriceMin, err = strconv.ParseFloat(v, 64); err != nil || q.PriceMin < 0 {
+			return nil, errors.New("price_min must be a price in the smallest currency unit")
+		}
+	}
+	if v := get("price_max"); v != "" {
+		if q.PriceMax, err = strconv.ParseFloat(v, 64); err != nil || q.PriceMax <= 0 {
+			return nil, errors.New("price_max must be a price in the smallest currency unit")
+		}
+	}
+	for _, r := range list(get("price_ranges")) {
+		lo, hi, ok := strings.Cut(r, "-")
+		pr := search.Range{Start: math.Inf(-1), End: math.Inf(1)}
+		if ok && lo != "" {
+			pr.Start, err = strconv.ParseFloat(lo, 64)
+		}
+		if ok && err == nil && hi != "" {
+			pr.End, err = strconv.ParseFloat(hi, 64)
+		}
+		if !ok || err != nil || pr.Start >= pr.End {
+			return nil, errors.New("price_ranges must be min-max pairs, as in 0-2500,2500-")
+		}
+		q.PriceRanges = append(q.PriceRanges, pr)
+	}
+	return q, nil
+}
+
+func list(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func rangeOf(r search.Range) priceRange {
+	var pr priceRange
+	if !math.IsInf(r.Start, -1) {
+		pr.Min = &r.Start
+	}
+	if !math.IsInf(r.End, 1) {
+		pr.Max = &r.End
+	}
+	return pr
+}
@@ -0,0 +1,65 @@
+package storefront
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	storefrontmodel "github.com/hanzoai/commerce/models/product/storefront"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+func params(kv map[string]string) func(string) string {
+	return func(key string) string { return kv[key] }
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := parseQuery(params(map[string]string{
+		"q":            " trail runer ",
+		"category":     "shoes, boots,",
+		"option":       "Size:42",
+		"in_stock":     "true",
+		"price_max":    "10000",
+		"price_ranges": "0-2500,2500-5000,5000-",
+		"sort":         "best_selling",
+		"limit":        "12",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &storefrontmodel.Query{
+		Text:       "trail runer",
+		Categories: []string{"shoes", "boots"},
+		Options:    []string{"Size:42"},
+		InStock:    true,
+		PriceMax:   10000,
+		PriceRanges: []search.Range{
+			{Start: 0, End: 2500},
+			{Start: 2500, End: 5000},
+			{Start: 5000, End: math.Inf(1)},
+		},
+		Sort:  storefrontmodel.BestSelling,
+		Limit: 12,
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Fatalf("parseQuery = %+v, want %+v", q, want)
+	}
+
+	for _, bad := range []map[string]string{
+		{"limit": "0"},
+		{"price_min": "cheap"},
+		{"price_ranges": "5000-2500"},
+		{"price_ranges": "2500"},
+	} {
+		if _, err := parseQuery(params(bad)); err == nil {
+			t.Fatalf("parseQuery(%v) accepted it", bad)
+		}
+	}
+}
+
+func TestRangeOf_LeavesOpenEndsOut(t *testing.T) {
+	r := rangeOf(search.Range{Start: 5000, End: math.Inf(1)})
+	if r.Min == nil || *r.Min != 5000 || r.Max != nil {
+		t.Fatalf("rangeOf = %+v, want min 5000 and no max", r)
+	}
+}
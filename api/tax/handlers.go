@@ -3,16 +3,18 @@ package tax
 import (
 	"context"
 	"math"
+	"strconv"
 	"time"
 
 	"github.com/zap-proto/zip"
 
-	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/models/taxprovider"
 	"github.com/hanzoai/commerce/models/taxrate"
 	"github.com/hanzoai/commerce/models/taxraterule"
 	"github.com/hanzoai/commerce/models/taxregion"
+	"github.com/hanzoai/commerce/models/types/currency"
+	taxcalc "github.com/hanzoai/commerce/tax"
 	"github.com/hanzoai/commerce/util/json"
 	jsonhttp "github.com/hanzoai/commerce/util/json/http"
 	"github.com/hanzoai/commerce/util/rest"
@@ -34,14 +36,23 @@ func Route(router zip.Router, args ...zip.Handler) {
 	// Tax calculation endpoint
 	calcApi := rest.New("/tax")
 	calcApi.POST("/calculate", append(args, namespaced, Calculate)...)
+	calcApi.POST("/ids/validate", append(args, namespaced, ValidateTaxId)...)
+	calcApi.GET("/oss", append(args, namespaced, OSSReport)...)
 	calcApi.Route(router, args...)
 }
 
-// Request/response types for tax calculation.
+// Request/response types for tax calculation. Amounts are in major units,
+// as they always were here; the arithmetic is in cents, in package tax.
 
 type calcItem struct {
-	Amount   float64 `json:"amount"`
-	Quantity int     `json:"quantity"`
+	Amount        float64 `json:"amount"`
+	Quantity      int     `json:"quantity"`
+	ProductId     string  `json:"productId,omitempty"`
+	ProductTypeId string  `json:"productTypeId,omitempty"`
+	TaxCode       string  `json:"taxCode,omitempty"`
+
+	// TaxExempt is for an item that is never taxed, such as a gift card.
+	TaxExempt bool `json:"taxExempt,omitempty"`
 }
 
 type calcAddress struct {
@@ -52,6 +63,10 @@ type calcAddress struct {
 type calcRequest struct {
 	Items           []calcItem  `json:"items"`
 	ShippingAddress calcAddress `json:"shippingAddress"`
+	Shipping        float64     `json:"shipping,omitempty"`
+	Currency        string      `json:"currency,omitempty"`
+	RegionId        string      `json:"regionId,omitempty"`
+	CustomerId      string      `json:"customerId,omitempty"`
 }
 
 type calcItemResult struct {
@@ -62,16 +77,19 @@ type calcItemResult struct {
 }
 
 type calcResponse struct {
-	Items    []calcItemResult `json:"items"`
-	TotalTax float64          `json:"totalTax"`
+	Items        []calcItemResult `json:"items"`
+	ShippingTax  float64          `json:"shippingTax"`
+	TotalTax     float64          `json:"totalTax"`
+	Inclusive    bool             `json:"inclusive,omitempty"`
+	Exempt       bool             `json:"exempt,omitempty"`
+	Jurisdiction string           `json:"jurisdiction,omitempty"`
+	Provider     string           `json:"provider"`
 }
 
-// Calculate computes tax for a list of items given a shipping address.
-//
-// It looks up the TaxRegion matching the provided countryCode and
-// provinceCode, queries all TaxRates for that region, sums combinable
-// rates (or uses the default rate), then applies the effective rate to
-// each item.
+// Calculate previews the tax on a list of items shipped to an address, as
+// cart and checkout would charge it: through the provider of the address's
+// tax region, which for most orgs is their own rates and rate rules (see
+// package tax). An address no region covers pays no tax.
 func Calculate(c *zip.Ctx) error {
 	var req calcRequest
 	if err := json.DecodeBytes(c.Body(), &req); err != nil {
@@ -86,103 +104,57 @@ func Calculate(c *zip.Ctx) error {
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
-	db := datastore.New(ctx)
-
-	// Find matching tax region by country + province.
-	region := taxregion.New(db)
-	ok, err := region.Query().
-		Filter("CountryCode=", req.ShippingAddress.CountryCode).
-		Filter("ProvinceCode=", req.ShippingAddress.ProvinceCode).
-		Get()
-	if err != nil {
-		return jsonhttp.Fail(c, 500, "Failed to query tax region", err)
-	}
-
-	// If no province-level region, try country-level (empty province).
-	if !ok {
-		region = taxregion.New(db)
-		ok, err = region.Query().
-			Filter("CountryCode=", req.ShippingAddress.CountryCode).
-			Filter("ProvinceCode=", "").
-			Get()
-		if err != nil {
-			return jsonhttp.Fail(c, 500, "Failed to query tax region", err)
-		}
-	}
-
-	// No region found -- zero tax.
-	if !ok {
-		items := make([]calcItemResult, len(req.Items))
-		for i, item := range req.Items {
-			items[i] = calcItemResult{
-				Amount:   item.Amount,
-				Quantity: item.Quantity,
-				TaxRate:  0,
-				Tax:      0,
-			}
-		}
-		return jsonhttp.Render(c, 200, calcResponse{Items: items, TotalTax: 0})
+	treq := &taxcalc.Request{
+		Currency: currency.Type(req.Currency),
+		Address:  taxcalc.Address{Country: req.ShippingAddress.CountryCode, Province: req.ShippingAddress.ProvinceCode},
+		Customer: taxcalc.Customer{Id: req.CustomerId},
+		RegionId: req.RegionId,
+		Shipping: cents(req.Shipping),
 	}
-
-	// Fetch tax rates for this region.
-	regionId := region.Id()
-	var rates []*taxrate.TaxRate
-	q := taxrate.Query(db).Filter("TaxRegionId=", regionId)
-	if _, err := q.GetAll(&rates); err != nil {
-		return jsonhttp.Fail(c, 500, "Failed to query tax rates", err)
+	for i, item := range req.Items {
+		treq.Lines = append(treq.Lines, taxcalc.Line{
+			Id:            strconv.Itoa(i),
+			ProductId:     item.ProductId,
+			ProductTypeId: item.ProductTypeId,
+			TaxCode:       item.TaxCode,
+			Quantity:      item.Quantity,
+			UnitPrice:     cents(item.Amount),
+			Taxable:       !item.TaxExempt,
+		})
 	}
 
-	// Compute effective rate: sum all combinable rates, or fall back to
-	// the first default rate.
-	effectiveRate := 0.0
-	hasCombined := false
-
-	for _, r := range rates {
-		if r.IsCombinable {
-			effectiveRate += r.Rate
-			hasCombined = true
-		}
+	q, err := taxcalc.Calculate(ctx, treq)
+	if err != nil {
+		return jsonhttp.Fail(c, 500, "Failed to calculate tax", err)
 	}
 
-	if !hasCombined {
-		for _, r := range rates {
-			if r.IsDefault {
-				effectiveRate = r.Rate
-				break
-			}
-		}
-		// If still zero and rates exist, use the first one.
-		if effectiveRate == 0 && len(rates) > 0 {
-			effectiveRate = rates[0].Rate
-		}
+	res := calcResponse{
+		Items:        make([]calcItemResult, len(req.Items)),
+		ShippingTax:  major(q.Shipping.Tax),
+		TotalTax:     major(q.Tax),
+		Inclusive:    q.Inclusive,
+		Exempt:       q.Exempt,
+		Jurisdiction: q.Jurisdiction,
+		Provider:     q.Provider,
 	}
-
-	// Calculate per-item tax.
-	totalTax := 0.0
-	items := make([]calcItemResult, len(req.Items))
-
 	for i, item := range req.Items {
-		lineTotal := item.Amount * float64(item.Quantity)
-		tax := roundCents(lineTotal * effectiveRate)
-		totalTax += tax
-
-		items[i] = calcItemResult{
-			Amount:   item.Amount,
-			Quantity: item.Quantity,
-			TaxRate:  effectiveRate,
-			Tax:      tax,
+		res.Items[i] = calcItemResult{Amount: item.Amount, Quantity: item.Quantity}
+		if i < len(q.Lines) {
+			for _, r := range q.Lines[i].Rates {
+				res.Items[i].TaxRate += r.Rate
+			}
+			res.Items[i].Tax = major(q.Lines[i].Tax)
 		}
 	}
+	return jsonhttp.Render(c, 200, res)
+}
 
-	totalTax = roundCents(totalTax)
-
-	return jsonhttp.Render(c, 200, calcResponse{
-		Items:    items,
-		TotalTax: totalTax,
-	})
+// cents is an amount in major units in cents.
+func cents(v float64) currency.Cents {
+	return currency.Cents(math.Round(v * 100))
 }
 
-// roundCents rounds to 2 decimal places (cents).
-func roundCents(v float64) float64 {
-	return math.Round(v*100) / 100
+// major is an amount in cents in major units.
+func major(c currency.Cents) float64 {
+	return float64(c) / 100
 }
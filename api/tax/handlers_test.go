@@ -14,6 +14,7 @@ import (
 
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/taxrate"
+	"github.com/hanzoai/commerce/models/taxraterule"
 	"github.com/hanzoai/commerce/models/taxregion"
 	"github.com/hanzoai/commerce/util/nscontext"
 	"github.com/hanzoai/commerce/util/test/ae"
@@ -202,3 +203,45 @@ func TestCalculate_FirstRateWhenNoDefault(t *testing.T) {
 		t.Fatalf("total tax = %v, want 10.00", out.TotalTax)
 	}
 }
+
+// TestCalculate_ProductTypeOverride proves a rate tied to a product type by a
+// tax rate rule taxes that type's items instead of the region's default, and
+// that an exempt item pays nothing.
+func TestCalculate_ProductTypeOverride(t *testing.T) {
+	const ns = "acme"
+	tc := ae.NewContext()
+	defer tc.Close()
+	db := datastore.New(nscontext.WithNamespace(context.Background(), ns))
+
+	r := seedRegion(t, db, "CA", "ON")
+	seedRate(t, db, r.Id(), 0.13, true, false) // HST, default
+
+	books := taxrate.New(db)
+	books.TaxRegionId = r.Id()
+	books.Rate = 0.05
+	if err := books.Create(); err != nil {
+		t.Fatalf("create rate: %v", err)
+	}
+	rule := taxraterule.New(db)
+	rule.TaxRateId = books.Id()
+	rule.Reference = "product_type"
+	rule.ReferenceId = "ptyp_books"
+	if err := rule.Create(); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+
+	out := calcOver(t, ns, calcRequest{
+		ShippingAddress: calcAddress{CountryCode: "CA", ProvinceCode: "ON"},
+		Items: []calcItem{
+			{Amount: 100, Quantity: 1, ProductTypeId: "ptyp_books"},
+			{Amount: 100, Quantity: 1},
+			{Amount: 50, Quantity: 1, TaxExempt: true},
+		},
+	})
+	if !approx(out.Items[0].Tax, 5) || !approx(out.Items[1].Tax, 13) || out.Items[2].Tax != 0 {
+		t.Fatalf("item taxes = %+v, want 5, 13 and 0", out.Items)
+	}
+	if !approx(out.TotalTax, 18) || out.Jurisdiction != "CA-ON" {
+		t.Fatalf("total tax = %v in %q, want 18 in CA-ON", out.TotalTax, out.Jurisdiction)
+	}
+}
@@ -0,0 +1,99 @@
+package tax
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/middleware"
+	"github.com/hanzoai/commerce/tax/oss"
+	"github.com/hanzoai/commerce/tax/taxid"
+	"github.com/hanzoai/commerce/util/json"
+	jsonhttp "github.com/hanzoai/commerce/util/json/http"
+)
+
+// OSSReport exports the org's One-Stop-Shop VAT return for a quarter, as
+// JSON or, with format=csv, the CSV the return is filled in from. The org's
+// country is where it is established; the quarter defaults to the last one
+// ended.
+//
+//	GET /tax/oss?year=2026&quarter=3&format=csv
+func OSSReport(c *zip.Ctx) error {
+	org := middleware.GetOrganization(c)
+	db := datastore.New(org.Namespaced(c.Context()))
+
+	year, quarter := lastQuarter(time.Now().UTC())
+	if s := c.Query("year"); s != "" {
+		y, err := strconv.Atoi(s)
+		if err != nil {
+			return jsonhttp.Fail(c, 400, "Invalid year", err)
+		}
+		year = y
+	}
+	if s := c.Query("quarter"); s != "" {
+		q, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(s), "Q"))
+		if err != nil || q < 1 || q > 4 {
+			return jsonhttp.Fail(c, 400, "Invalid quarter", err)
+		}
+		quarter = q
+	}
+
+	r, err := oss.Load(db, year, quarter, strings.ToUpper(org.Country))
+	if err != nil {
+		return jsonhttp.Fail(c, 500, "Failed to build OSS report", err)
+	}
+
+	if c.Query("format") != "csv" {
+		return jsonhttp.Render(c, 200, r)
+	}
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		return jsonhttp.Fail(c, 500, "Failed to write OSS report", err)
+	}
+	c.SetHeader("Content-Type", "text/csv")
+	c.SetHeader("Content-Disposition", "attachment; filename=oss-"+strconv.Itoa(year)+"-q"+strconv.Itoa(quarter)+".csv")
+	return c.Bytes(200, buf.Bytes())
+}
+
+// lastQuarter is the year and quarter of the last quarter ended before t.
+func lastQuarter(t time.Time) (int, int) {
+	q := (int(t.Month())-1)/3 + 1
+	if q == 1 {
+		return t.Year() - 1, 4
+	}
+	return t.Year(), q - 1
+}
+
+type taxIdRequest struct {
+	Country string `json:"country"`
+	Value   string `json:"value"`
+}
+
+// ValidateTaxId checks a customer's tax number and has it verified, as
+// saving it on a company or user would, without saving it: for a checkout
+// form to say whether the number will be accepted before the order is
+// placed. An invalid number is a 200 with status invalid; it is the answer,
+// not a failed request.
+//
+//	POST /tax/ids/validate {"country": "DE", "value": "DE136695976"}
+func ValidateTaxId(c *zip.Ctx) error {
+	var req taxIdRequest
+	if err := json.DecodeBytes(c.Body(), &req); err != nil {
+		return jsonhttp.Fail(c, 400, "Invalid request body", err)
+	}
+	if req.Value == "" {
+		return jsonhttp.Fail(c, 400, "No tax id provided", nil)
+	}
+
+	id := taxid.TaxId{Country: req.Country, Value: req.Value}
+	res := map[string]interface{}{}
+	if err := taxid.Verify(c.Context(), &id); err != nil {
+		res["error"] = err.Error()
+	}
+	res["taxId"] = id
+	return jsonhttp.Render(c, 200, res)
+}
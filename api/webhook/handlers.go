@@ -0,0 +1,277 @@
+// Package webhook is the admin surface for webhooks: base CRUD via rest plus
+// the delivery log (every signed attempt, its status, latency and response),
+// replay of a recorded delivery, secret rotation and re-enabling a webhook
+// that was disabled after sustained failure.
+//
+// The signing secret is shown twice in a webhook's life — in the response
+// that creates it and in the one that rotates it — and never read back.
+package webhook
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/middleware"
+	webhookModel "github.com/hanzoai/commerce/models/webhook"
+	"github.com/hanzoai/commerce/models/webhook/tasks"
+	"github.com/hanzoai/commerce/models/webhookdelivery"
+	"github.com/hanzoai/commerce/util/json"
+	"github.com/hanzoai/commerce/util/json/http"
+	"github.com/hanzoai/commerce/util/rest"
+)
+
+// Route mounts the webhook resource. args are the gates the caller applies to
+// the base CRUD; the sub-routes carry the same ones, since every one of them
+// is as privileged as editing the webhook itself.
+func Route(router zip.Router, args ...zip.Handler) {
+	namespaced := middleware.Namespace()
+
+	chain := func(h zip.Handler) []zip.Handler {
+		hs := append([]zip.Handler{}, args...)
+		return append(hs, namespaced, h)
+	}
+
+	api := rest.New(webhookModel.Webhook{})
+	api.Create = create(api)
+	api.Update = update(api)
+	api.GET("/:webhookid/deliveries", chain(ListDeliveries)...)
+	api.GET("/:webhookid/deliveries/:deliveryid", chain(GetDelivery)...)
+	api.POST("/:webhookid/deliveries/:deliveryid/resend", chain(Resend)...)
+	api.POST("/:webhookid/rotate", chain(RotateSecret)...)
+	api.POST("/:webhookid/enable", chain(Enable)...)
+	api.Route(router, args...)
+}
+
+// create is the rest create, answering with the new webhook's secret.
+func create(r *rest.Rest) zip.Handler {
+	return func(c *zip.Ctx) error {
+		if !r.CheckPermissions(c, "create") {
+			return nil
+		}
+
+		org := middleware.GetOrganization(c)
+		w := webhookModel.New(datastore.NewNamespaced(org.Namespaced(c.Context())))
+		if err := json.DecodeBytes(c.Body(), w); err != nil {
+			return r.Fail(c, 400, "Failed decode request body", err)
+		}
+
+		if err := w.Create(); err != nil {
+			return r.Fail(c, 500, "Failed to create "+r.Kind, err)
+		}
+		c.SetHeader("Location", c.Path()+"/"+w.Id())
+		return r.Render(c, 201, webhookModel.WithSecret{Webhook: w, Secret: w.Secret})
+	}
+}
+
+// update is the rest full replace, except that what the server owns — the
+// signing secrets and the delivery health — is kept rather than cleared for
+// being absent from the body.
+func update(r *rest.Rest) zip.Handler {
+	return func(c *zip.Ctx) error {
+		if !r.CheckPermissions(c, "update") {
+			return nil
+		}
+
+		db, stored, unlock := lockWebhook(c)
+		if stored == nil {
+			return nil
+		}
+		defer unlock()
+
+		w := webhookModel.New(db)
+		if err := json.DecodeBytes(c.Body(), w); err != nil {
+			return r.Fail(c, 400, "Failed decode request body", err)
+		}
+		w.SetKey(stored.Key())
+		w.Keep(stored)
+
+		if err := w.Update(); err != nil {
+			return r.Fail(c, 500, "Failed to update "+r.Kind, err)
+		}
+		return r.Render(c, 200, w)
+	}
+}
+
+// getWebhook loads the org-scoped webhook named in the path, or writes a 404
+// and returns nil.
+func getWebhook(c *zip.Ctx) (*datastore.Datastore, *webhookModel.Webhook) {
+	org := middleware.GetOrganization(c)
+	db := datastore.NewNamespaced(org.Namespaced(c.Context()))
+	id := c.Param("webhookid")
+	w := webhookModel.New(db)
+	if err := w.GetById(id); err != nil {
+		http.Fail(c, 404, "No webhook found with id: "+id, err)
+		return nil, nil
+	}
+	return db, w
+}
+
+// lockWebhook takes the webhook's lock (webhookModel.Lock) and loads the
+// webhook under it, for a handler that saves it; or writes the failure and
+// returns nil. The caller releases the lock.
+func lockWebhook(c *zip.Ctx) (*datastore.Datastore, *webhookModel.Webhook, func()) {
+	org := middleware.GetOrganization(c)
+	db := datastore.NewNamespaced(org.Namespaced(c.Context()))
+	unlock, err := webhookModel.Lock(db, c.Param("webhookid"))
+	if err != nil {
+		http.Fail(c, 409, "The webhook is being changed by another request; try again", err)
+		return nil, nil, nil
+	}
+	if _, w := getWebhook(c); w != nil {
+		return db, w, unlock
+	}
+	unlock()
+	return nil, nil, nil
+}
+
+// getDelivery loads the delivery named in the path, provided it belongs to w.
+func getDelivery(c *zip.Ctx, db *datastore.Datastore, w *webhookModel.Webhook) *webhookdelivery.WebhookDelivery {
+	id := c.Param("deliveryid")
+	d := webhookdelivery.New(db)
+	if err := d.GetById(id); err != nil || d.WebhookId != w.Id() {
+		http.Fail(c, 404, "No delivery found with id: "+id, err)
+		return nil
+	}
+	return d
+}
+
+// ListDeliveries returns the webhook's delivery attempts, newest first.
+// Optional filters: status (succeeded|failed), event, eventId; limit (default
+// 50, max 500).
+func ListDeliveries(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	db, w := getWebhook(c)
+	if w == nil {
+		return nil
+	}
+
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	q := webhookdelivery.Query(db).Filter("WebhookId=", w.Id())
+	if v := c.Query("status"); v != "" {
+		q = q.Filter("Status=", v)
+	}
+	if v := c.Query("event"); v != "" {
+		q = q.Filter("Event=", v)
+	}
+	if v := c.Query("eventId"); v != "" {
+		q = q.Filter("EventId=", v)
+	}
+
+	deliveries := make([]*webhookdelivery.WebhookDelivery, 0)
+	if _, err := q.Order("-CreatedAt").Limit(limit).GetAll(&deliveries); err != nil {
+		return http.Fail(c, 500, "Failed to list deliveries", err)
+	}
+
+	return http.Render(c, 200, deliveries)
+}
+
+// GetDelivery returns one recorded attempt, including its payload.
+func GetDelivery(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	db, w := getWebhook(c)
+	if w == nil {
+		return nil
+	}
+	d := getDelivery(c, db, w)
+	if d == nil {
+		return nil
+	}
+	return http.Render(c, 200, d)
+}
+
+// Resend replays a recorded delivery now, as one new signed attempt of the
+// same event, and returns the new attempt's record. A failed replay is still
+// a 200: the attempt happened and its outcome is in the record.
+func Resend(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	db, w := getWebhook(c)
+	if w == nil {
+		return nil
+	}
+	prev := getDelivery(c, db, w)
+	if prev == nil {
+		return nil
+	}
+
+	d, err := tasks.Replay(c.Context(), db, w, prev)
+	if d == nil {
+		return http.Fail(c, 500, "Failed to resend delivery", err)
+	}
+	return http.Render(c, 200, d)
+}
+
+type rotateRequest struct {
+	// GraceSeconds keeps the old secret signing alongside the new one for
+	// this long. Defaults to 24 hours; 0 retires it immediately.
+	GraceSeconds *int64 `json:"graceSeconds"`
+}
+
+// RotateSecret issues a new signing secret and returns the webhook with it —
+// the one chance to read it.
+func RotateSecret(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	_, w, unlock := lockWebhook(c)
+	if w == nil {
+		return nil
+	}
+	defer unlock()
+
+	var req rotateRequest
+	if body := c.Body(); len(body) > 0 {
+		if err := json.DecodeBytes(body, &req); err != nil {
+			return http.Fail(c, 400, "Failed decode request body", err)
+		}
+	}
+
+	grace := 24 * time.Hour
+	if req.GraceSeconds != nil {
+		if *req.GraceSeconds < 0 {
+			return http.Fail(c, 400, "graceSeconds must not be negative", nil)
+		}
+		grace = time.Duration(*req.GraceSeconds) * time.Second
+	}
+
+	w.RotateSecret(grace)
+	if err := w.Update(); err != nil {
+		return http.Fail(c, 500, "Failed to rotate webhook secret", err)
+	}
+	return http.Render(c, 200, webhookModel.WithSecret{Webhook: w, Secret: w.Secret})
+}
+
+// Enable re-enables a webhook, clearing its failure record.
+func Enable(c *zip.Ctx) error {
+	if !middleware.RequireAdmin(c) {
+		return nil
+	}
+	_, w, unlock := lockWebhook(c)
+	if w == nil {
+		return nil
+	}
+	defer unlock()
+
+	w.Reenable()
+	if err := w.Update(); err != nil {
+		return http.Fail(c, 500, "Failed to enable webhook", err)
+	}
+	return http.Render(c, 200, w)
+}
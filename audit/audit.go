@@ -0,0 +1,223 @@
+// Package audit keeps the tamper-evident record of who changed what: every
+// mutating API call, the model changes it made, and every money-moving write,
+// whoever made it.
+//
+// Records are appended to the system store's audit log (db.AuditLog), where
+// each org's records form a hash chain: a record's hash covers its content and
+// the hash of the record before it, so a record edited, removed or inserted
+// after the fact breaks the chain from that point on, and Verify says where.
+// The chain makes tampering evident; it does not prevent it. Somebody with
+// write access to the store can rebuild a chain from scratch, which is why the
+// head hashes are worth copying somewhere else from time to time.
+//
+// Recording never sits on the request's path to the client: a failure to
+// append is logged and the request's outcome stands. The log is the record of
+// what happened, not a precondition for it happening.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/hooks"
+)
+
+// Actor types.
+const (
+	// ActorIAM is a principal authenticated by the IAM gateway; the actor id
+	// is its subject.
+	ActorIAM = "iam"
+
+	// ActorAPIKey is a caller authenticated by an org access token; the actor
+	// id is the token's id, never the secret.
+	ActorAPIKey = "api_key"
+
+	// ActorService is a trusted service-to-service caller.
+	ActorService = "service"
+
+	// ActorSystem is commerce itself: tasks, crons and webhooks acting on
+	// nobody's request.
+	ActorSystem = "system"
+
+	// ActorAnonymous is a caller nobody authenticated, such as a storefront
+	// checkout.
+	ActorAnonymous = "anonymous"
+)
+
+// SystemOrg is the chain for actions that belong to no org, such as a
+// platform admin's cross-org work.
+const SystemOrg = "_system"
+
+// Actor is who made a change.
+type Actor struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// System is the actor for commerce's own work.
+var System = Actor{Type: ActorSystem}
+
+var (
+	store   db.AuditLog
+	storeMu sync.RWMutex
+)
+
+// SetStore sets the log records are appended to. The App sets it to the
+// system store at boot; until it is set, recording is a no-op.
+func SetStore(s db.AuditLog) {
+	storeMu.Lock()
+	store = s
+	storeMu.Unlock()
+}
+
+// Store returns the log records are appended to, or nil.
+func Store() db.AuditLog {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// Entry is one thing to record. Diff is the field changes the action made, as
+// the model hooks report them; for an action that is not a model write it is
+// whatever describes it, such as an amount.
+type Entry struct {
+	Org          string
+	Actor        Actor
+	Method       string
+	Route        string
+	Status       int
+	ResourceKind string
+	ResourceID   string
+	Action       string
+	RequestID    string
+	Diff         []hooks.FieldChange
+}
+
+// Record appends e to its org's chain. An entry with no org goes on the
+// SystemOrg chain.
+func Record(ctx context.Context, e Entry) error {
+	s := Store()
+	if s == nil {
+		return nil
+	}
+	// The record outlives the request it describes: a client that hangs up
+	// does not get to cancel it.
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	org := e.Org
+	if org == "" {
+		org = SystemOrg
+	}
+	diff, err := json.Marshal(redact(e.Diff))
+	if err != nil {
+		return err
+	}
+
+	return s.AppendAudit(ctx, &db.AuditRecord{
+		Org:          org,
+		At:           time.Now(),
+		ActorType:    e.Actor.Type,
+		ActorID:      e.Actor.ID,
+		Method:       e.Method,
+		Route:        e.Route,
+		Status:       e.Status,
+		ResourceKind: e.ResourceKind,
+		ResourceID:   e.ResourceID,
+		Action:       e.Action,
+		RequestID:    e.RequestID,
+		Diff:         diff,
+	}, Seal)
+}
+
+// sealed is what a record's hash covers, in a fixed field order so that the
+// encoding, and with it the hash, is the same on every replica and release.
+// The time is in milliseconds because that is what the store keeps.
+type sealed struct {
+	ID           string          `json:"id"`
+	Org          string          `json:"org"`
+	Seq          uint64          `json:"seq"`
+	At           int64           `json:"at"`
+	ActorType    string          `json:"actorType"`
+	ActorID      string          `json:"actorId"`
+	Method       string          `json:"method"`
+	Route        string          `json:"route"`
+	Status       int             `json:"status"`
+	ResourceKind string          `json:"resourceKind"`
+	ResourceID   string          `json:"resourceId"`
+	Action       string          `json:"action"`
+	RequestID    string          `json:"requestId"`
+	Diff         json.RawMessage `json:"diff"`
+}
+
+// Hash returns the hash rec should carry: sha256 over the previous record's
+// hash and rec's content.
+func Hash(rec *db.AuditRecord) string {
+	diff := json.RawMessage(rec.Diff)
+	if !json.Valid(diff) {
+		// Stored diffs are always JSON; this keeps a corrupted one hashable,
+		// so Verify reports a mismatch rather than failing to run.
+		diff, _ = json.Marshal(string(rec.Diff))
+	}
+	content, _ := json.Marshal(sealed{
+		ID:           rec.ID,
+		Org:          rec.Org,
+		Seq:          rec.Seq,
+		At:           rec.At.UnixMilli(),
+		ActorType:    rec.ActorType,
+		ActorID:      rec.ActorID,
+		Method:       rec.Method,
+		Route:        rec.Route,
+		Status:       rec.Status,
+		ResourceKind: rec.ResourceKind,
+		ResourceID:   rec.ResourceID,
+		Action:       rec.Action,
+		RequestID:    rec.RequestID,
+		Diff:         diff,
+	})
+
+	h := sha256.New()
+	h.Write([]byte(rec.PrevHash))
+	h.Write([]byte{'\n'})
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Seal sets rec's hash. It is the seal AppendAudit is given.
+func Seal(rec *db.AuditRecord) error {
+	rec.Hash = Hash(rec)
+	return nil
+}
+
+// redacted names the fields whose values are never written to the log, by
+// any part of their JSON name. The log records that a credential changed,
+// not what it changed to.
+var redacted = []string{"password", "secret", "token", "privatekey", "apikey"}
+
+func redact(changes []hooks.FieldChange) []hooks.FieldChange {
+	out := make([]hooks.FieldChange, 0, len(changes))
+	for _, c := range changes {
+		name := strings.ToLower(c.Field)
+		for _, r := range redacted {
+			if strings.Contains(name, r) {
+				if c.Before != nil {
+					c.Before = "[redacted]"
+				}
+				if c.After != nil {
+					c.After = "[redacted]"
+				}
+				break
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
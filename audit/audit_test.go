@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/hooks"
+)
+
+// memLog is an AuditLog in memory, with its records in reach so a test can
+// tamper with them the way somebody with the store's credentials could.
+type memLog struct {
+	mu    sync.Mutex
+	recs  map[string][]*db.AuditRecord
+	heads map[string]*db.AuditRecord
+}
+
+func newMemLog() *memLog {
+	return &memLog{recs: map[string][]*db.AuditRecord{}, heads: map[string]*db.AuditRecord{}}
+}
+
+func (m *memLog) AppendAudit(_ context.Context, rec *db.AuditRecord, seal func(*db.AuditRecord) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec.ID = "aud_test"
+	rec.Seq, rec.PrevHash = 1, ""
+	if head := m.heads[rec.Org]; head != nil {
+		rec.Seq, rec.PrevHash = head.Seq+1, head.Hash
+	}
+	if rec.Diff == nil {
+		rec.Diff = []byte("null")
+	}
+	if err := seal(rec); err != nil {
+		return err
+	}
+	cp := *rec
+	m.recs[rec.Org] = append(m.recs[rec.Org], &cp)
+	m.heads[rec.Org] = &cp
+	return nil
+}
+
+func (m *memLog) ListAudit(_ context.Context, f db.AuditFilter) ([]*db.AuditRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*db.AuditRecord
+	for i := len(m.recs[f.Org]) - 1; i >= 0; i-- {
+		out = append(out, m.recs[f.Org][i])
+	}
+	return out, nil
+}
+
+func (m *memLog) ScanAudit(_ context.Context, org string, afterSeq uint64, n int) ([]*db.AuditRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*db.AuditRecord
+	for _, r := range m.recs[org] {
+		if r.Seq > afterSeq && len(out) < n {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *memLog) AuditHead(_ context.Context, org string) (uint64, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if head := m.heads[org]; head != nil {
+		return head.Seq, head.Hash, nil
+	}
+	return 0, "", nil
+}
+
+func (m *memLog) AuditOrgs(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for org := range m.heads {
+		out = append(out, org)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func useLog(t *testing.T) *memLog {
+	t.Helper()
+	m := newMemLog()
+	SetStore(m)
+	t.Cleanup(func() { SetStore(nil) })
+	return m
+}
+
+func TestVerify_CatchesEditsAndRemovals(t *testing.T) {
+	m := useLog(t)
+	ctx := context.Background()
+	for _, action := range []string{"order.create", "order.update", "refund.create"} {
+		if err := Record(ctx, Entry{Org: "acme", Actor: Actor{Type: ActorIAM, ID: "usr_1"}, Action: action}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if n, err := Verify(ctx, m, "acme"); err != nil || n != 3 {
+		t.Fatalf("Verify = %d, %v; want 3 good records", n, err)
+	}
+
+	// Rewriting who did it breaks the chain at that record.
+	m.recs["acme"][1].ActorID = "usr_2"
+	var ce *ChainError
+	if _, err := Verify(ctx, m, "acme"); !errors.As(err, &ce) || ce.Seq != 2 {
+		t.Fatalf("edited record: err = %v, want a break at seq 2", err)
+	}
+	m.recs["acme"][1].ActorID = "usr_1"
+
+	// So does dropping the newest record, which no link points past.
+	m.recs["acme"] = m.recs["acme"][:2]
+	if _, err := Verify(ctx, m, "acme"); !errors.As(err, &ce) || ce.Seq != 3 {
+		t.Fatalf("removed record: err = %v, want the head to disagree at seq 3", err)
+	}
+}
+
+func TestRequest_RecordsChangesWithTheCallsActor(t *testing.T) {
+	m := useLog(t)
+	ctx, req := WithRequest(context.Background())
+
+	Note(ctx, "acme", "order", "ord_1", "order.update", []hooks.FieldChange{{Field: "status", Before: "open", After: "cancelled"}})
+	if len(m.recs["acme"]) != 0 {
+		t.Fatal("a change was recorded before its call was known")
+	}
+
+	call := Call{Org: "acme", Actor: Actor{Type: ActorAPIKey, ID: "tok_1"}, Method: "PATCH", Route: "/order/:orderid", Status: 200}
+	if err := req.Flush(ctx, call); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	recs := m.recs["acme"]
+	if len(recs) != 1 || recs[0].ActorType != ActorAPIKey || recs[0].ActorID != "tok_1" ||
+		recs[0].ResourceID != "ord_1" || recs[0].Route != "/order/:orderid" {
+		t.Fatalf("records = %+v", recs)
+	}
+
+	// A call that changed nothing still leaves a record of itself.
+	_, bare := WithRequest(context.Background())
+	if err := bare.Flush(ctx, call); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if recs := m.recs["acme"]; len(recs) != 2 || recs[1].Action != "request" {
+		t.Fatalf("records = %+v, want the bare call recorded", recs)
+	}
+
+	// An anonymous call that changed nothing — one auth refused — does not.
+	_, refused := WithRequest(context.Background())
+	anon := Call{Actor: Actor{Type: ActorAnonymous}, Method: "POST", Route: "/order", Status: 401}
+	if err := refused.Flush(ctx, anon); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if recs := m.recs[SystemOrg]; len(recs) != 0 {
+		t.Fatalf("system chain = %+v, want the refused call unrecorded", recs)
+	}
+}
+
+func TestNote_OutsideARequestIsTheSystems(t *testing.T) {
+	m := useLog(t)
+	Note(context.Background(), "", "billing-payout", "po_1", "ledger.payout.record",
+		[]hooks.FieldChange{{Field: "apiSecret", After: "sk_live_x"}, {Field: "amount", After: 500.0}})
+
+	recs := m.recs[SystemOrg]
+	if len(recs) != 1 || recs[0].ActorType != ActorSystem {
+		t.Fatalf("records = %+v, want one system record on the system chain", recs)
+	}
+	if string(recs[0].Diff) != `[{"field":"apiSecret","before":null,"after":"[redacted]"},{"field":"amount","before":null,"after":500}]` {
+		t.Fatalf("diff = %s", recs[0].Diff)
+	}
+}
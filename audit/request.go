@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// Call is a mutating API call, as the audit middleware sees it once the
+// handler has run.
+type Call struct {
+	Org       string
+	Actor     Actor
+	Method    string
+	Route     string
+	Status    int
+	RequestID string
+}
+
+type requestKey struct{}
+
+// Request collects the model changes one API call makes, so they can be
+// recorded with the call's actor and outcome. Neither is known while the
+// changes are made: the actor is settled by auth middleware that runs inside
+// the audit middleware, and the status only once the handler returns.
+type Request struct {
+	mu      sync.Mutex
+	changes []change
+	call    *Call
+}
+
+// change is one model write, or one action given to Note.
+type change struct {
+	ctx    context.Context
+	org    string
+	kind   string
+	id     string
+	action string
+	diff   []hooks.FieldChange
+}
+
+// WithRequest returns ctx carrying a new Request.
+func WithRequest(ctx context.Context) (context.Context, *Request) {
+	r := &Request{}
+	return context.WithValue(ctx, requestKey{}, r), r
+}
+
+// FromContext returns the Request ctx carries, or nil.
+func FromContext(ctx context.Context) *Request {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(requestKey{}).(*Request)
+	return r
+}
+
+// add records c with the call, or holds it until the call is flushed. A write
+// that lands after the flush — work the handler left running — is recorded at
+// once under the call it belonged to.
+func (r *Request) add(c change) {
+	r.mu.Lock()
+	if r.call == nil {
+		r.changes = append(r.changes, c)
+		r.mu.Unlock()
+		return
+	}
+	call := *r.call
+	r.mu.Unlock()
+
+	if err := Record(c.ctx, c.entry(call)); err != nil {
+		log.Error("audit: record %s %s: %v", c.action, c.id, err, c.ctx)
+	}
+}
+
+// Flush records call and the model changes made under it. A call that changed
+// no model is recorded once, as the call itself, so that a mutating request
+// leaves a record even when it failed or its handler writes outside the
+// models.
+//
+// An anonymous call that changed no model is not recorded. It is one auth or
+// the rate limiter refused, or a storefront call that wrote nothing, and has
+// no org: each would be a write to the system chain, serialised with every
+// other, that anybody on the internet could make as often as they liked.
+func (r *Request) Flush(ctx context.Context, call Call) error {
+	r.mu.Lock()
+	r.call = &call
+	changes := r.changes
+	r.changes = nil
+	r.mu.Unlock()
+
+	if len(changes) == 0 {
+		if call.Actor.Type == ActorAnonymous {
+			return nil
+		}
+		return Record(ctx, Entry{
+			Org:       call.Org,
+			Actor:     call.Actor,
+			Method:    call.Method,
+			Route:     call.Route,
+			Status:    call.Status,
+			Action:    "request",
+			RequestID: call.RequestID,
+		})
+	}
+
+	var first error
+	for _, c := range changes {
+		if err := Record(ctx, c.entry(call)); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// entry is c recorded under call. It goes on the chain of the org whose
+// namespace it was written in, which is the call's org unless a platform
+// admin was working in another's.
+func (c change) entry(call Call) Entry {
+	org := c.org
+	if org == "" {
+		org = call.Org
+	}
+	return Entry{
+		Org:          org,
+		Actor:        call.Actor,
+		Method:       call.Method,
+		Route:        call.Route,
+		Status:       call.Status,
+		ResourceKind: c.kind,
+		ResourceID:   c.id,
+		Action:       c.action,
+		RequestID:    call.RequestID,
+		Diff:         c.diff,
+	}
+}
+
+// moneyKinds are the models whose every write is recorded, on a request or
+// not: a refund issued by a task or a payout made by a cron moves money just
+// as surely as one made through the API.
+var moneyKinds = map[string]bool{
+	"refund":              true,
+	"billing-payout":      true,
+	"transfer":            true,
+	"payment":             true,
+	"payment-intent":      true,
+	"dispute":             true,
+	"balance-transaction": true,
+	"customer-balance":    true,
+	"credit-grant":        true,
+	"transaction":         true,
+	"husd-settlement":     true,
+}
+
+// Install binds the recorder to r's after-commit model hooks, for every kind.
+//
+// Binding for every kind means every model write reads the stored entity
+// first, for the diff. That read is the price of recording what a write
+// changed rather than only that it happened.
+func Install(r *hooks.Registry) {
+	r.OnModelAfterCreate(hooks.AnyKind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "audit", Func: recorder("create")})
+	r.OnModelAfterUpdate(hooks.AnyKind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "audit", Func: recorder("update")})
+	r.OnModelAfterDelete(hooks.AnyKind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "audit", Func: recorder("delete")})
+}
+
+func recorder(op string) func(*hooks.ModelEvent) error {
+	return func(e *hooks.ModelEvent) error {
+		if op == "update" && len(e.Changes) == 0 {
+			return e.Next()
+		}
+
+		c := change{
+			ctx:    e.Context,
+			kind:   e.Kind,
+			id:     modelID(e),
+			action: e.Kind + "." + op,
+			diff:   e.Changes,
+		}
+		if e.Context != nil {
+			c.org = nscontext.GetNamespace(e.Context)
+		}
+
+		if FromContext(e.Context) != nil || moneyKinds[e.Kind] {
+			note(c)
+		}
+		return e.Next()
+	}
+}
+
+// Note records an action that is not a model write — a ledger posting, say —
+// on kind and id, in org's chain, or the chain of ctx's namespace when org is
+// empty. Under a request it is recorded with the call's actor, as the
+// request's model changes are; otherwise it is commerce's own, and recorded as
+// the System actor's at once. Failures are logged.
+func Note(ctx context.Context, org, kind, id, action string, diff []hooks.FieldChange) {
+	c := change{ctx: ctx, org: org, kind: kind, id: id, action: action, diff: diff}
+	if c.org == "" && ctx != nil {
+		c.org = nscontext.GetNamespace(ctx)
+	}
+	note(c)
+}
+
+func note(c change) {
+	if req := FromContext(c.ctx); req != nil {
+		req.add(c)
+		return
+	}
+	if err := Record(c.ctx, c.entry(Call{Actor: System})); err != nil {
+		log.Error("audit: record %s %s: %v", c.action, c.id, err, c.ctx)
+	}
+}
+
+func modelID(e *hooks.ModelEvent) string {
+	if m, ok := e.Model.(interface{ Id() string }); ok {
+		return m.Id()
+	}
+	for _, snap := range []map[string]interface{}{e.After, e.Before} {
+		if id, ok := snap["id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hanzoai/commerce/db"
+)
+
+// ChainError is a break in an org's chain: the first record that is not what
+// the chain says it should be. Everything before Seq checked out.
+type ChainError struct {
+	Org    string
+	Seq    uint64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit: %s chain broken at seq %d: %s", e.Org, e.Seq, e.Reason)
+}
+
+// Verify walks org's chain from its first record and checks that the seqs run
+// without a gap, that each record links to the hash of the one before, that
+// each record's hash matches its content, and that the chain ends where its
+// head says. It returns how many records it checked, and a *ChainError at the
+// first break.
+func Verify(ctx context.Context, log db.AuditLog, org string) (int, error) {
+	const page = 500
+
+	var (
+		n    int
+		seq  uint64
+		prev string
+	)
+	for {
+		recs, err := log.ScanAudit(ctx, org, seq, page)
+		if err != nil {
+			return n, err
+		}
+		for _, rec := range recs {
+			switch {
+			case rec.Seq != seq+1:
+				return n, &ChainError{Org: org, Seq: seq + 1, Reason: fmt.Sprintf("missing; next record is seq %d", rec.Seq)}
+			case rec.PrevHash != prev:
+				return n, &ChainError{Org: org, Seq: rec.Seq, Reason: "does not link to the record before it"}
+			case rec.Hash != Hash(rec):
+				return n, &ChainError{Org: org, Seq: rec.Seq, Reason: "content does not match its hash"}
+			}
+			seq, prev = rec.Seq, rec.Hash
+			n++
+		}
+		if len(recs) < page {
+			break
+		}
+	}
+
+	headSeq, headHash, err := log.AuditHead(ctx, org)
+	if err != nil {
+		return n, err
+	}
+	if headSeq != seq || headHash != prev {
+		return n, &ChainError{Org: org, Seq: headSeq, Reason: fmt.Sprintf("head is seq %d but the chain ends at seq %d", headSeq, seq)}
+	}
+	return n, nil
+}
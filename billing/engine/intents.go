@@ -6,6 +6,7 @@ import (
 	"github.com/hanzoai/money"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
 	"github.com/hanzoai/commerce/models/paymentintent"
 	"github.com/hanzoai/commerce/models/paymentmethod"
 	"github.com/hanzoai/commerce/models/setupintent"
@@ -94,36 +95,132 @@ func ConfirmPaymentIntent(ctx context.Context, db *datastore.Datastore, pi *paym
 		return fmt.Errorf("payment method not found: %w", err)
 	}
 
-	req := processor.PaymentRequest{
+	req := intentPaymentRequest(pi, pm.ProviderRef)
+
+	if pi.CaptureMethod == "manual" {
+		// Authorize only
+		result, err := proc.Authorize(ctx, req)
+		return applyPaymentResult(pi, proc, "authorization", result, err)
+	}
+
+	// Charge immediately
+	result, err := proc.Charge(ctx, req)
+	return applyPaymentResult(pi, proc, "charge", result, err)
+}
+
+// LockPaymentIntent locks the intent with id against the other paths that
+// settle a challenged payment: the customer's resume and the processor's
+// webhook. Each reads the intent again under the lock, so the one that comes
+// second finds it settled and does not settle it again.
+func LockPaymentIntent(db *datastore.Datastore, id string) (unlock func(), err error) {
+	return lock.Hold(db, "paymentintent", id)
+}
+
+// ResumePaymentIntent finishes an intent that stopped at RequiresAction, once
+// the customer has completed the challenge. data is what the challenge handed
+// back (the return URL's query, or the processor SDK's result) and is passed
+// to the processor as is. proc must be the processor that issued the
+// challenge, or a router over it.
+//
+// The outcome is applied exactly as a confirm's would be: the intent succeeds
+// or waits for capture, goes back to RequiresPaymentMethod when the customer
+// failed or abandoned the challenge, or stays at RequiresAction when the
+// issuer wants a second one. The caller holds the intent's lock
+// (LockPaymentIntent) and read pi under it.
+func ResumePaymentIntent(ctx context.Context, db *datastore.Datastore, pi *paymentintent.PaymentIntent, data map[string]interface{}, proc processor.PaymentProcessor) error {
+	ap, ok := proc.(processor.AuthenticationProcessor)
+	if !ok || !proc.IsAvailable(ctx) {
+		return fmt.Errorf("no processor available to resume payment intent %s", pi.Id())
+	}
+	if err := pi.Resume(); err != nil {
+		return err
+	}
+
+	// The payment method is only needed by processors that resume by paying
+	// again; one that has since been deleted does not stop the others.
+	token := ""
+	pm := paymentmethod.New(db)
+	if err := pm.GetById(pi.PaymentMethodId); err == nil {
+		token = pm.ProviderRef
+	}
+
+	result, err := ap.ResumePayment(ctx, processor.ResumeRequest{
+		TransactionID: pi.ProviderRef,
+		Request:       intentPaymentRequest(pi, token),
+		AuthorizeOnly: pi.CaptureMethod == "manual",
+		Data:          data,
+	})
+	return applyPaymentResult(pi, proc, "authentication", result, err)
+}
+
+// CompletePaymentIntentAction settles an intent waiting on a challenge from
+// the processor's own report of how it ended, for when the customer completes
+// it and never comes back: a closed tab, a lost connection, an app-to-app
+// flow that returns somewhere else. The processor's webhook is then the only
+// news of the payment. An intent that is no longer RequiresAction was already
+// resumed and is left alone; the caller holds its lock, as for
+// ResumePaymentIntent.
+func CompletePaymentIntentAction(ctx context.Context, pi *paymentintent.PaymentIntent, approved bool, reason string) error {
+	if pi.Status != paymentintent.RequiresAction {
+		return nil
+	}
+	switch {
+	case !approved:
+		if reason == "" {
+			reason = "authentication failed"
+		}
+		pi.MarkFailed(reason)
+	case pi.CaptureMethod == "manual":
+		pi.MarkRequiresCapture(pi.ProviderRef)
+	default:
+		pi.MarkSucceeded(pi.ProviderRef, pi.Amount)
+	}
+	return pi.Update()
+}
+
+// intentPaymentRequest is the processor request for pi, paid with token.
+func intentPaymentRequest(pi *paymentintent.PaymentIntent, token string) processor.PaymentRequest {
+	return processor.PaymentRequest{
 		Amount:      currency.Cents(pi.Amount),
 		Currency:    pi.Currency,
 		Description: pi.Description,
 		CustomerID:  pi.CustomerId,
-		Token:       pm.ProviderRef,
+		Token:       token,
+		ReturnURL:   pi.ReturnUrl,
 	}
+}
 
-	if pi.CaptureMethod == "manual" {
-		// Authorize only
-		result, err := proc.Authorize(ctx, req)
-		if err != nil {
-			pi.LastError = err.Error()
-			pi.Status = paymentintent.RequiresPaymentMethod
-			_ = pi.Update()
-			return fmt.Errorf("authorization failed: %w", err)
+// applyPaymentResult moves pi on from Processing by the processor's answer to
+// op and saves it.
+//
+// A result that is neither an error nor a success is a decline, and used to be
+// marked succeeded: only err was checked. A result that requires action is
+// neither too, and parks the intent on its challenge.
+func applyPaymentResult(pi *paymentintent.PaymentIntent, proc processor.PaymentProcessor, op string, result *processor.PaymentResult, err error) error {
+	pi.ProviderType = string(proc.Type())
+
+	switch {
+	case err == nil && result == nil:
+		err = fmt.Errorf("processor %s returned no result", proc.Type())
+		fallthrough
+	case err != nil:
+		pi.MarkFailed(err.Error())
+		_ = pi.Update()
+		return fmt.Errorf("%s failed: %w", op, err)
+	case result.RequiresAction():
+		pi.MarkRequiresAction(result.TransactionID, result.NextAction)
+	case !result.Success:
+		reason := result.ErrorMessage
+		if reason == "" {
+			reason = "payment declined"
 		}
+		pi.MarkFailed(reason)
+		_ = pi.Update()
+		return fmt.Errorf("payment declined: %s", reason)
+	case pi.CaptureMethod == "manual":
 		pi.MarkRequiresCapture(result.ProcessorRef)
-		pi.ProviderType = string(proc.Type())
-	} else {
-		// Charge immediately
-		result, err := proc.Charge(ctx, req)
-		if err != nil {
-			pi.LastError = err.Error()
-			pi.Status = paymentintent.RequiresPaymentMethod
-			_ = pi.Update()
-			return fmt.Errorf("charge failed: %w", err)
-		}
+	default:
 		pi.MarkSucceeded(result.ProcessorRef, pi.Amount)
-		pi.ProviderType = string(proc.Type())
 	}
 
 	return pi.Update()
@@ -138,8 +138,9 @@ func RenewSubscription(ctx context.Context, db *datastore.Datastore, sub *subscr
 		return inv, result, fmt.Errorf("collection error: %w", err)
 	}
 
-	// Update invoice after collection
-	if err := inv.Update(); err != nil {
+	// Update invoice after collection, with invoice.paid or
+	// invoice.payment_failed in the same write.
+	if err := inv.UpdateWithEvents(collectedInvoiceEvent(inv)); err != nil {
 		return inv, result, fmt.Errorf("failed to update invoice: %w", err)
 	}
 
@@ -196,7 +197,7 @@ func CreatePaidFirstInvoice(db *datastore.Datastore, sub *subscription.Subscript
 	if err := inv.MarkPaid(method, providerRef); err != nil {
 		return inv, fmt.Errorf("failed to mark first invoice paid: %w", err)
 	}
-	if err := inv.Update(); err != nil {
+	if err := inv.UpdateWithEvents(invoiceEvent(inv, "invoice.paid")); err != nil {
 		return inv, fmt.Errorf("failed to persist paid first invoice: %w", err)
 	}
 
@@ -270,7 +271,7 @@ func buildPeriodInvoice(db *datastore.Datastore, sub *subscription.Subscription)
 	}
 
 	// Persist invoice
-	if err := inv.Create(); err != nil {
+	if err := inv.CreateWithEvents(invoiceEvent(inv, "invoice.finalized")); err != nil {
 		return inv, fmt.Errorf("failed to create invoice: %w", err)
 	}
 
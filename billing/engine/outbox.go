@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/events/outbox"
+	"github.com/hanzoai/commerce/models/billinginvoice"
+	"github.com/hanzoai/commerce/models/refund"
+	"github.com/hanzoai/commerce/models/subscription"
+)
+
+// Outbox events, written in the same transaction as the invoice or refund
+// they describe (CreateWithEvents / UpdateWithEvents). Unlike Emit, which is
+// the fire-and-forget audit ledger, these are the durable feed: a consumer
+// that sees invoice.paid can rely on the invoice being paid, and on having
+// seen that invoice's earlier events first.
+
+// invoiceEvent describes inv as it is being written.
+func invoiceEvent(inv *billinginvoice.BillingInvoice, eventType string) *db.OutboxMessage {
+	return outbox.New("billing-invoice", inv.Id(), eventType, map[string]interface{}{
+		"id":             inv.Id(),
+		"number":         inv.NumberStr,
+		"userId":         inv.UserId,
+		"subscriptionId": inv.SubscriptionId,
+		"status":         inv.Status,
+		"currency":       inv.Currency,
+		"subtotal":       inv.Subtotal,
+		"amountDue":      inv.AmountDue,
+		"amountPaid":     inv.AmountPaid,
+		"periodStart":    inv.PeriodStart,
+		"periodEnd":      inv.PeriodEnd,
+	})
+}
+
+// collectedInvoiceEvent is invoice.paid or invoice.payment_failed, by how
+// collection left inv.
+func collectedInvoiceEvent(inv *billinginvoice.BillingInvoice) *db.OutboxMessage {
+	if inv.Status == billinginvoice.Paid {
+		return invoiceEvent(inv, "invoice.paid")
+	}
+	return invoiceEvent(inv, "invoice.payment_failed")
+}
+
+// refundEvent is refund.succeeded or refund.failed, by r's status.
+func refundEvent(r *refund.Refund) *db.OutboxMessage {
+	eventType := "refund.succeeded"
+	if r.Status == refund.Failed {
+		eventType = "refund.failed"
+	}
+	return outbox.New("refund", r.Id(), eventType, map[string]interface{}{
+		"id":              r.Id(),
+		"status":          r.Status,
+		"amount":          r.Amount,
+		"currency":        r.Currency,
+		"reason":          r.Reason,
+		"paymentIntentId": r.PaymentIntentId,
+		"invoiceId":       r.InvoiceId,
+		"providerRef":     r.ProviderRef,
+		"failureReason":   r.FailureReason,
+	})
+}
+
+// SubscriptionEvent describes sub as it is being written, for the callers in
+// api/billing that own the subscription's writes.
+func SubscriptionEvent(sub *subscription.Subscription, eventType string) *db.OutboxMessage {
+	return outbox.New("subscription", sub.Id(), eventType, map[string]interface{}{
+		"id":                   sub.Id(),
+		"userId":               sub.UserId,
+		"planId":               sub.PlanId,
+		"status":               sub.Status,
+		"quantity":             sub.Quantity,
+		"cancelAtPeriodEnd":    sub.EndCancel,
+		"canceled":             sub.Canceled,
+		"currentPeriodStart":   sub.PeriodStart,
+		"currentPeriodEnd":     sub.PeriodEnd,
+		"currentInvoiceId":     sub.CurrentInvoiceId,
+		"providerType":         sub.ProviderType,
+		"defaultPaymentMethod": sub.DefaultPaymentMethod,
+	})
+}
@@ -88,7 +88,7 @@ func CreateRefund(ctx context.Context, db *datastore.Datastore, params CreateRef
 			})
 			if err != nil {
 				_ = r.MarkFailed(err.Error())
-				if createErr := r.Create(); createErr != nil {
+				if createErr := r.CreateWithEvents(refundEvent(r)); createErr != nil {
 					return nil, createErr
 				}
 				return r, err
@@ -100,7 +100,7 @@ func CreateRefund(ctx context.Context, db *datastore.Datastore, params CreateRef
 	// Mark as succeeded for internal refunds
 	_ = r.MarkSucceeded()
 
-	if err := r.Create(); err != nil {
+	if err := r.CreateWithEvents(refundEvent(r)); err != nil {
 		return nil, fmt.Errorf("failed to create refund: %w", err)
 	}
 
@@ -0,0 +1,301 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hanzoai/money"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	"github.com/hanzoai/commerce/models/paymentmethod"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+// ---------------------------------------------------------------------------
+// challengeProcessor
+// ---------------------------------------------------------------------------
+
+// challengeProcessor is a card processor whose issuer decides by token, so a
+// test knows ahead of time which payments are challenged:
+//
+//	card_ok       approved outright
+//	card_decline  declined outright
+//	card_3ds      challenged; the resume decides
+//
+// A resume is approved when the challenge reports "outcome": "authenticated",
+// challenged again on "challenge", and fails otherwise.
+type challengeProcessor struct {
+	*processor.BaseProcessor
+	resumed []processor.ResumeRequest
+	seq     int
+}
+
+func newChallengeProcessor() *challengeProcessor {
+	p := &challengeProcessor{
+		BaseProcessor: processor.NewBaseProcessor(processor.Adyen, []currency.Type{currency.EUR, currency.USD}),
+	}
+	p.SetConfigured(true)
+	return p
+}
+
+func (p *challengeProcessor) pay(req processor.PaymentRequest, authorize bool) (*processor.PaymentResult, error) {
+	p.seq++
+	txID := fmt.Sprintf("psp_%d", p.seq)
+
+	switch req.Token {
+	case "card_ok":
+		return p.approved(txID, authorize), nil
+	case "card_decline":
+		return &processor.PaymentResult{TransactionID: txID, Status: "failed", ErrorMessage: "Refused"}, nil
+	case "card_3ds":
+		return p.challenge(txID, req), nil
+	}
+	return nil, fmt.Errorf("unknown test card %q", req.Token)
+}
+
+func (p *challengeProcessor) approved(txID string, authorize bool) *processor.PaymentResult {
+	status := "succeeded"
+	if authorize {
+		status = "authorized"
+	}
+	return &processor.PaymentResult{Success: true, TransactionID: txID, ProcessorRef: "ref_" + txID, Status: status}
+}
+
+func (p *challengeProcessor) challenge(txID string, req processor.PaymentRequest) *processor.PaymentResult {
+	return &processor.PaymentResult{
+		TransactionID: txID,
+		ProcessorRef:  txID,
+		Status:        processor.StatusRequiresAction,
+		NextAction: &processor.NextAction{
+			Type:        processor.NextActionRedirect,
+			RedirectURL: "https://acs.example/challenge/" + txID + "?return=" + req.ReturnURL,
+		},
+	}
+}
+
+func (p *challengeProcessor) Charge(_ context.Context, req processor.PaymentRequest) (*processor.PaymentResult, error) {
+	return p.pay(req, false)
+}
+
+func (p *challengeProcessor) Authorize(_ context.Context, req processor.PaymentRequest) (*processor.PaymentResult, error) {
+	return p.pay(req, true)
+}
+
+func (p *challengeProcessor) ResumePayment(_ context.Context, req processor.ResumeRequest) (*processor.PaymentResult, error) {
+	p.resumed = append(p.resumed, req)
+
+	switch req.Data["outcome"] {
+	case "authenticated":
+		return p.approved(req.TransactionID, req.AuthorizeOnly), nil
+	case "challenge":
+		p.seq++
+		return p.challenge(fmt.Sprintf("psp_%d", p.seq), req.Request), nil
+	}
+	return &processor.PaymentResult{TransactionID: req.TransactionID, Status: "failed", ErrorMessage: "authentication failed"}, nil
+}
+
+func (p *challengeProcessor) Refund(context.Context, processor.RefundRequest) (*processor.RefundResult, error) {
+	return nil, processor.ErrRefundFailed
+}
+
+func (p *challengeProcessor) GetTransaction(context.Context, string) (*processor.Transaction, error) {
+	return nil, processor.ErrTransactionNotFound
+}
+
+func (p *challengeProcessor) ValidateWebhook(context.Context, []byte, string) (*processor.WebhookEvent, error) {
+	return nil, processor.ErrWebhookValidationFailed
+}
+
+func (p *challengeProcessor) Capture(_ context.Context, txID string, _ money.Amount) (*processor.PaymentResult, error) {
+	return &processor.PaymentResult{Success: true, TransactionID: txID, Status: "captured"}, nil
+}
+
+var _ processor.AuthenticationProcessor = (*challengeProcessor)(nil)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+func scaDB(t *testing.T) *datastore.Datastore {
+	t.Helper()
+	c := ae.NewContext()
+	t.Cleanup(c.Close)
+	db := datastore.New(c)
+	db.SetNamespace("sca")
+	return db
+}
+
+// scaIntent creates a confirmable intent paid with the given test card.
+func scaIntent(t *testing.T, db *datastore.Datastore, card, captureMethod string) *paymentintent.PaymentIntent {
+	t.Helper()
+
+	pm := paymentmethod.New(db)
+	pm.CustomerId = "cus_sca"
+	pm.ProviderRef = card
+	pm.ProviderType = string(processor.Adyen)
+	if err := pm.Create(); err != nil {
+		t.Fatalf("create payment method: %v", err)
+	}
+
+	pi, err := CreatePaymentIntent(db, CreatePaymentIntentParams{
+		CustomerId:      "cus_sca",
+		Amount:          12000,
+		Currency:        currency.EUR,
+		PaymentMethodId: pm.Id(),
+		CaptureMethod:   captureMethod,
+	})
+	if err != nil {
+		t.Fatalf("create payment intent: %v", err)
+	}
+	pi.ReturnUrl = "https://shop.example/return"
+	return pi
+}
+
+func reload(t *testing.T, db *datastore.Datastore, pi *paymentintent.PaymentIntent) *paymentintent.PaymentIntent {
+	t.Helper()
+	got := paymentintent.New(db)
+	if err := got.GetById(pi.Id()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	return got
+}
+
+// ---------------------------------------------------------------------------
+// Tests
+// ---------------------------------------------------------------------------
+
+func TestConfirmPaymentIntent_ChallengeThenResume(t *testing.T) {
+	db := scaDB(t)
+	proc := newChallengeProcessor()
+	pi := scaIntent(t, db, "card_3ds", "")
+
+	if err := ConfirmPaymentIntent(context.Background(), db, pi, "", proc); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	saved := reload(t, db, pi)
+	if saved.Status != paymentintent.RequiresAction {
+		t.Fatalf("status = %s, want requires_action", saved.Status)
+	}
+	if saved.NextAction == nil || saved.NextAction.RedirectURL != "https://acs.example/challenge/psp_1?return=https://shop.example/return" {
+		t.Fatalf("next action = %+v", saved.NextAction)
+	}
+
+	if err := ResumePaymentIntent(context.Background(), db, saved, map[string]interface{}{"outcome": "authenticated"}, proc); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(proc.resumed) != 1 || proc.resumed[0].TransactionID != "psp_1" || proc.resumed[0].Request.Token != "card_3ds" {
+		t.Fatalf("resumed with %+v", proc.resumed)
+	}
+
+	saved = reload(t, db, pi)
+	if saved.Status != paymentintent.Succeeded || saved.AmountReceived != 12000 {
+		t.Fatalf("status = %s received %d, want succeeded 12000", saved.Status, saved.AmountReceived)
+	}
+	if saved.ProviderRef != "ref_psp_1" || saved.NextAction != nil {
+		t.Fatalf("providerRef = %q nextAction = %+v", saved.ProviderRef, saved.NextAction)
+	}
+}
+
+func TestConfirmPaymentIntent_ChallengeManualCapture(t *testing.T) {
+	db := scaDB(t)
+	proc := newChallengeProcessor()
+	pi := scaIntent(t, db, "card_3ds", "manual")
+
+	if err := ConfirmPaymentIntent(context.Background(), db, pi, "", proc); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := ResumePaymentIntent(context.Background(), db, pi, map[string]interface{}{"outcome": "authenticated"}, proc); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if !proc.resumed[0].AuthorizeOnly {
+		t.Fatal("a manual-capture intent resumed as a charge")
+	}
+	if pi.Status != paymentintent.RequiresCapture || pi.AmountCapturable != 12000 {
+		t.Fatalf("status = %s capturable %d", pi.Status, pi.AmountCapturable)
+	}
+}
+
+func TestResumePaymentIntent_FailedChallenge(t *testing.T) {
+	db := scaDB(t)
+	proc := newChallengeProcessor()
+	pi := scaIntent(t, db, "card_3ds", "")
+
+	if err := ConfirmPaymentIntent(context.Background(), db, pi, "", proc); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := ResumePaymentIntent(context.Background(), db, pi, map[string]interface{}{"outcome": "abandoned"}, proc); err == nil {
+		t.Fatal("a failed challenge resumed without error")
+	}
+
+	saved := reload(t, db, pi)
+	if saved.Status != paymentintent.RequiresPaymentMethod || saved.LastError != "authentication failed" || saved.NextAction != nil {
+		t.Fatalf("after failure: status %s lastError %q nextAction %+v", saved.Status, saved.LastError, saved.NextAction)
+	}
+}
+
+func TestResumePaymentIntent_SecondChallenge(t *testing.T) {
+	db := scaDB(t)
+	proc := newChallengeProcessor()
+	pi := scaIntent(t, db, "card_3ds", "")
+
+	if err := ConfirmPaymentIntent(context.Background(), db, pi, "", proc); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := ResumePaymentIntent(context.Background(), db, pi, map[string]interface{}{"outcome": "challenge"}, proc); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if pi.Status != paymentintent.RequiresAction || pi.ProviderRef != "psp_2" {
+		t.Fatalf("status = %s providerRef %q, want a second challenge", pi.Status, pi.ProviderRef)
+	}
+	if err := ResumePaymentIntent(context.Background(), db, pi, map[string]interface{}{"outcome": "authenticated"}, proc); err != nil {
+		t.Fatalf("second resume: %v", err)
+	}
+	if pi.Status != paymentintent.Succeeded {
+		t.Fatalf("status = %s, want succeeded", pi.Status)
+	}
+}
+
+// The webhook can beat the customer back: the intent settles from it, and
+// the late return finds nothing left to resume.
+func TestCompletePaymentIntentAction(t *testing.T) {
+	db := scaDB(t)
+	proc := newChallengeProcessor()
+	pi := scaIntent(t, db, "card_3ds", "")
+
+	if err := ConfirmPaymentIntent(context.Background(), db, pi, "", proc); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := CompletePaymentIntentAction(context.Background(), pi, true, ""); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	saved := reload(t, db, pi)
+	if saved.Status != paymentintent.Succeeded || saved.ProviderRef != "psp_1" {
+		t.Fatalf("status = %s providerRef %q", saved.Status, saved.ProviderRef)
+	}
+
+	if err := ResumePaymentIntent(context.Background(), db, saved, map[string]interface{}{"outcome": "authenticated"}, proc); err == nil {
+		t.Fatal("resumed an intent the webhook already settled")
+	}
+	if len(proc.resumed) != 0 {
+		t.Fatal("processor was asked to resume a settled payment")
+	}
+}
+
+// A decline comes back as an unsuccessful result, not an error, and must not
+// succeed the intent.
+func TestConfirmPaymentIntent_Declined(t *testing.T) {
+	db := scaDB(t)
+	pi := scaIntent(t, db, "card_decline", "")
+
+	if err := ConfirmPaymentIntent(context.Background(), db, pi, "", newChallengeProcessor()); err == nil {
+		t.Fatal("a declined charge confirmed without error")
+	}
+	saved := reload(t, db, pi)
+	if saved.Status != paymentintent.RequiresPaymentMethod || saved.LastError != "Refused" {
+		t.Fatalf("status = %s lastError %q", saved.Status, saved.LastError)
+	}
+}
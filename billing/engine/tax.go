@@ -1,12 +1,13 @@
 package engine
 
 import (
+	"strconv"
+
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/billinginvoice"
-	"github.com/hanzoai/commerce/models/taxrate"
-	"github.com/hanzoai/commerce/models/taxregion"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax"
 	"github.com/hanzoai/commerce/types"
-	"github.com/hanzoai/money"
 )
 
 // TaxLine represents a single tax computation on an invoice.
@@ -19,83 +20,63 @@ type TaxLine struct {
 	Jurisdiction string  `json:"jurisdiction"`
 }
 
-// CalculateInvoiceTax computes tax for an invoice based on the customer address
-// using the existing TaxRate and TaxRegion models. Returns tax lines and total.
+// CalculateInvoiceTax computes tax for an invoice based on the customer address,
+// through the same tax providers as cart and order: the tax region covering the
+// address decides which, and the built-in rules apply its rates otherwise.
+// Returns one tax line per rate and the total, and records the rates and
+// whether the invoice is reverse-charged on inv for the caller to save.
+//
+// An invoice to a business abroad under a valid CustomerTaxId is
+// reverse-charged, and has no tax; SellerCountry is where the seller is.
+//
+// Each rate is rounded on its own line rather than once over the combined rate,
+// because each jurisdiction is remitted the amount on ITS line.
 func CalculateInvoiceTax(db *datastore.Datastore, inv *billinginvoice.BillingInvoice, customerAddress *types.Address) ([]TaxLine, int64, error) {
 	if customerAddress == nil {
 		return nil, 0, nil
 	}
 
-	rootKey := db.NewKey("synckey", "", 1, nil)
-
-	// Find matching tax regions by country and state/province
-	regions := make([]*taxregion.TaxRegion, 0)
-	rq := taxregion.Query(db).Ancestor(rootKey)
-	if customerAddress.Country != "" {
-		rq = rq.Filter("CountryCode=", customerAddress.Country)
+	req := &tax.Request{
+		Reference: inv.Id(),
+		Currency:  inv.Currency,
+		Address: tax.Address{
+			Country:    customerAddress.Country,
+			Province:   customerAddress.State,
+			City:       customerAddress.City,
+			PostalCode: customerAddress.PostalCode,
+		},
+		Customer: tax.Customer{Id: inv.UserId, TaxId: inv.CustomerTaxId},
+		Origin:   inv.SellerCountry,
 	}
-	if _, err := rq.GetAll(&regions); err != nil {
-		return nil, 0, nil // no regions = no tax
-	}
-
-	// Filter by state/province if available
-	matchedRegions := make([]*taxregion.TaxRegion, 0)
-	for _, r := range regions {
-		if r.ProvinceCode == "" || r.ProvinceCode == customerAddress.State {
-			matchedRegions = append(matchedRegions, r)
+	for i, li := range inv.LineItems {
+		id := li.Id
+		if id == "" {
+			id = strconv.Itoa(i)
 		}
+		req.Lines = append(req.Lines, tax.Line{Id: id, Quantity: 1, UnitPrice: currency.Cents(li.Amount), Taxable: true})
 	}
-
-	if len(matchedRegions) == 0 {
-		return nil, 0, nil
+	if len(req.Lines) == 0 {
+		req.Lines = []tax.Line{{Id: "subtotal", Quantity: 1, UnitPrice: currency.Cents(inv.Subtotal), Taxable: true}}
 	}
 
-	// Get tax rates for matched regions
-	var taxLines []TaxLine
-	var totalTax int64
-
-	for _, region := range matchedRegions {
-		rates := make([]*taxrate.TaxRate, 0)
-		tq := taxrate.Query(db).Ancestor(rootKey).
-			Filter("TaxRegionId=", region.Id())
-		if _, err := tq.GetAll(&rates); err != nil {
-			continue
-		}
-
-		for _, rate := range rates {
-			// Each rate is a separate jurisdiction's claim on the same subtotal, so each
-			// is rounded on its own and the total is their sum — a jurisdiction is
-			// remitted the amount on ITS line, and a total rounded once over the combined
-			// rate would not match the lines that make it up.
-			//
-			// These rates are our own TaxRate rows, not a figure returned by a tax
-			// provider, so the part-cent is ours to compute and truncating it
-			// under-collected tax we still owe.
-			r, err := money.RateFromFloat(rate.Rate)
-			if err != nil {
-				return nil, 0, err
-			}
-			taxAmount, err := money.ScaleMinor(inv.Subtotal, r)
-			if err != nil {
-				return nil, 0, err
-			}
-
-			jurisdiction := region.CountryCode
-			if region.ProvinceCode != "" {
-				jurisdiction += "-" + region.ProvinceCode
-			}
+	q, err := tax.Calculate(db.Context, req)
+	if err != nil {
+		return nil, 0, err
+	}
 
-			taxLines = append(taxLines, TaxLine{
-				TaxRateId:    rate.Id(),
-				Description:  rate.Name,
-				Amount:       taxAmount,
-				Rate:         rate.Rate,
-				Jurisdiction: jurisdiction,
-			})
+	inv.TaxRates = q.Rates()
+	inv.ReverseCharge = q.ReverseCharge
 
-			totalTax += taxAmount
-		}
+	var taxLines []TaxLine
+	for _, r := range inv.TaxRates {
+		taxLines = append(taxLines, TaxLine{
+			TaxRateId:    r.TaxRateId,
+			Description:  r.Name,
+			Amount:       int64(r.Amount),
+			Rate:         r.Rate,
+			Inclusive:    q.Inclusive,
+			Jurisdiction: r.Jurisdiction,
+		})
 	}
-
-	return taxLines, totalTax, nil
+	return taxLines, int64(q.Tax), nil
 }
@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"context"
+
+	"github.com/hanzoai/commerce/audit"
+	"github.com/hanzoai/commerce/hooks"
+)
+
+// Audited returns l with every operation that moves money recorded in the
+// audit log, on the chain of the tenant it belongs to: account creation,
+// entries, holds and their capture or void, and the high-level payment,
+// refund, payout and dispute postings. Reads pass straight through.
+//
+// A ledger's writes are not model writes, so the model hooks that record the
+// rest of commerce never see them; this is the ledger's equivalent. Recording
+// follows the operation and only a successful one is recorded. A failure to
+// record is logged and never fails the operation: the money has moved either
+// way, and the log's job is to say so, not to undo it.
+func Audited(l Ledger) Ledger {
+	return &auditedLedger{Ledger: l}
+}
+
+type auditedLedger struct {
+	Ledger
+}
+
+// note records v, whole, as the state the action left behind.
+func note(ctx context.Context, tenantID, kind, id, action string, v interface{}) {
+	audit.Note(ctx, tenantID, kind, id, action, hooks.Diff(nil, hooks.Snapshot(v)))
+}
+
+func (a *auditedLedger) CreateAccount(ctx context.Context, account *Account) error {
+	if err := a.Ledger.CreateAccount(ctx, account); err != nil {
+		return err
+	}
+	note(ctx, account.TenantID, "ledger-account", account.ID, "ledger.account.create", account)
+	return nil
+}
+
+func (a *auditedLedger) PostEntry(ctx context.Context, entry *Entry) error {
+	if err := a.Ledger.PostEntry(ctx, entry); err != nil {
+		return err
+	}
+	note(ctx, entry.TenantID, "ledger-entry", entry.ID, "ledger.entry.post", entry)
+	return nil
+}
+
+func (a *auditedLedger) CreateHold(ctx context.Context, hold *Hold) error {
+	if err := a.Ledger.CreateHold(ctx, hold); err != nil {
+		return err
+	}
+	note(ctx, hold.TenantID, "ledger-hold", hold.ID, "ledger.hold.create", hold)
+	return nil
+}
+
+func (a *auditedLedger) CaptureHold(ctx context.Context, holdID string, amount int64) (*Entry, error) {
+	entry, err := a.Ledger.CaptureHold(ctx, holdID, amount)
+	if err != nil {
+		return nil, err
+	}
+	note(ctx, entry.TenantID, "ledger-hold", holdID, "ledger.hold.capture", entry)
+	return entry, nil
+}
+
+// VoidHold records no tenant of its own: the hold is the only place it is
+// written, and reading it back for one would put a read on the void path. The
+// record goes on the chain of ctx's namespace.
+func (a *auditedLedger) VoidHold(ctx context.Context, holdID string) error {
+	if err := a.Ledger.VoidHold(ctx, holdID); err != nil {
+		return err
+	}
+	note(ctx, "", "ledger-hold", holdID, "ledger.hold.void", map[string]interface{}{"id": holdID, "status": HoldVoided})
+	return nil
+}
+
+func (a *auditedLedger) RecordPayment(ctx context.Context, tenantID, paymentIntentID string, amount int64, currency string, customerID string, fees int64) (*Entry, error) {
+	entry, err := a.Ledger.RecordPayment(ctx, tenantID, paymentIntentID, amount, currency, customerID, fees)
+	if err != nil {
+		return nil, err
+	}
+	note(ctx, tenantID, "payment-intent", paymentIntentID, "ledger.payment.record", entry)
+	return entry, nil
+}
+
+func (a *auditedLedger) RecordRefund(ctx context.Context, tenantID, refundID string, amount int64, currency string, customerID string) (*Entry, error) {
+	entry, err := a.Ledger.RecordRefund(ctx, tenantID, refundID, amount, currency, customerID)
+	if err != nil {
+		return nil, err
+	}
+	note(ctx, tenantID, "refund", refundID, "ledger.refund.record", entry)
+	return entry, nil
+}
+
+func (a *auditedLedger) RecordPayout(ctx context.Context, tenantID, payoutID string, amount int64, currency string, merchantID string) (*Entry, error) {
+	entry, err := a.Ledger.RecordPayout(ctx, tenantID, payoutID, amount, currency, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	note(ctx, tenantID, "billing-payout", payoutID, "ledger.payout.record", entry)
+	return entry, nil
+}
+
+func (a *auditedLedger) RecordDispute(ctx context.Context, tenantID, disputeID string, amount int64, currency string, customerID string) (*Entry, error) {
+	entry, err := a.Ledger.RecordDispute(ctx, tenantID, disputeID, amount, currency, customerID)
+	if err != nil {
+		return nil, err
+	}
+	note(ctx, tenantID, "dispute", disputeID, "ledger.dispute.record", entry)
+	return entry, nil
+}
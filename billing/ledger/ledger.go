@@ -166,6 +166,7 @@ type Ledger interface {
 
 	// Holds (auth captures)
 	CreateHold(ctx context.Context, hold *Hold) error
+	GetHold(ctx context.Context, id string) (*Hold, error)
 	CaptureHold(ctx context.Context, holdID string, amount int64) (*Entry, error)
 	VoidHold(ctx context.Context, holdID string) error
 
@@ -301,19 +302,26 @@ func (m *MemLedger) EnsureAccount(ctx context.Context, tenantID, name string, ac
 // Entries
 // ---------------------------------------------------------------------------
 
-func (m *MemLedger) PostEntry(_ context.Context, e *Entry) error {
-	if len(e.Postings) < 2 {
+// checkPostings enforces invariant 1 before anything is written: at least two
+// legs, summing to exactly zero.
+func checkPostings(postings []Posting) error {
+	if len(postings) < 2 {
 		return ErrEmptyPostings
 	}
-
-	// Validate zero-sum
 	var sum int64
-	for _, p := range e.Postings {
+	for _, p := range postings {
 		sum += p.Amount
 	}
 	if sum != 0 {
 		return fmt.Errorf("%w: sum=%d", ErrPostingsNotBalanced, sum)
 	}
+	return nil
+}
+
+func (m *MemLedger) PostEntry(_ context.Context, e *Entry) error {
+	if err := checkPostings(e.Postings); err != nil {
+		return err
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -398,6 +406,9 @@ func (m *MemLedger) ListEntries(_ context.Context, f EntryFilter) ([]*Entry, err
 		if f.TenantID != "" && e.TenantID != f.TenantID {
 			continue
 		}
+		if f.AccountID != "" && !touches(e, f.AccountID) {
+			continue
+		}
 		if f.PaymentIntentID != "" && e.PaymentIntentID != f.PaymentIntentID {
 			continue
 		}
@@ -424,6 +435,16 @@ func (m *MemLedger) ListEntries(_ context.Context, f EntryFilter) ([]*Entry, err
 	return result, nil
 }
 
+// touches reports whether any of e's postings is to accountID.
+func touches(e *Entry, accountID string) bool {
+	for _, p := range e.Postings {
+		if p.AccountID == accountID {
+			return true
+		}
+	}
+	return false
+}
+
 // ---------------------------------------------------------------------------
 // Holds
 // ---------------------------------------------------------------------------
@@ -439,6 +460,9 @@ func (m *MemLedger) CreateHold(_ context.Context, h *Hold) error {
 	if _, ok := m.accounts[h.AccountID]; !ok {
 		return fmt.Errorf("%w: %s", ErrAccountNotFound, h.AccountID)
 	}
+	if h.Currency == "" {
+		h.Currency = "usd"
+	}
 
 	now := time.Now()
 	if h.ID == "" {
@@ -467,6 +491,17 @@ func (m *MemLedger) CreateHold(_ context.Context, h *Hold) error {
 	return nil
 }
 
+func (m *MemLedger) GetHold(_ context.Context, id string) (*Hold, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	h, ok := m.holds[id]
+	if !ok {
+		return nil, ErrHoldNotFound
+	}
+	return h, nil
+}
+
 func (m *MemLedger) CaptureHold(ctx context.Context, holdID string, amount int64) (*Entry, error) {
 	m.mu.Lock()
 	h, ok := m.holds[holdID]
@@ -559,6 +594,11 @@ func (m *MemLedger) VoidHold(_ context.Context, holdID string) error {
 	return nil
 }
 
+// FindAccount looks up a tenant's account by name.
+func (m *MemLedger) FindAccount(_ context.Context, tenantID, name string) (*Account, error) {
+	return m.findOrFailAccount(tenantID, name)
+}
+
 // findOrFailAccount looks up an account by name (no lock held).
 func (m *MemLedger) findOrFailAccount(tenantID, name string) (*Account, error) {
 	m.mu.RLock()
@@ -599,172 +639,22 @@ func (m *MemLedger) GetBalance(_ context.Context, accountID string, currency str
 // High-Level Operations
 // ---------------------------------------------------------------------------
 
-// RecordPayment creates a journal entry for a successful payment:
-//
-//	Debit  platform:cash              (amount)
-//	Credit customer_balance:{cust}    (amount - fees)
-//	Credit platform:fees              (fees)
-//
-// If fees == 0, the full amount credits the customer balance account.
-func (m *MemLedger) RecordPayment(ctx context.Context, tenantID, paymentIntentID string, amount int64, cur string, customerID string, fees int64) (*Entry, error) {
-	if amount <= 0 {
-		return nil, ErrInvalidAmount
-	}
-	if cur == "" {
-		cur = "usd"
-	}
-
-	cashAcct, err := m.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
-	if err != nil {
-		return nil, err
-	}
-	custAcct, err := m.EnsureAccount(ctx, tenantID, "customer_balance:"+customerID, Liability, cur)
-	if err != nil {
-		return nil, err
-	}
-
-	postings := []Posting{
-		{AccountID: cashAcct.ID, Amount: amount, Currency: cur},           // debit cash
-		{AccountID: custAcct.ID, Amount: -(amount - fees), Currency: cur}, // credit customer
-	}
-
-	if fees > 0 {
-		feeAcct, err := m.EnsureAccount(ctx, tenantID, "platform:fees", Revenue, cur)
-		if err != nil {
-			return nil, err
-		}
-		postings[1].Amount = -(amount - fees)
-		postings = append(postings, Posting{
-			AccountID: feeAcct.ID, Amount: -fees, Currency: cur, // credit fees
-		})
-	}
+// The postings each makes are in record.go.
 
-	entry := &Entry{
-		TenantID:        tenantID,
-		IdempotencyKey:  "payment:" + paymentIntentID,
-		Description:     fmt.Sprintf("Payment %s: %d %s (fees %d)", paymentIntentID, amount, cur, fees),
-		PaymentIntentID: paymentIntentID,
-		Postings:        postings,
-	}
-
-	if err := m.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
-		return nil, err
-	}
-	return entry, nil
+func (m *MemLedger) RecordPayment(ctx context.Context, tenantID, paymentIntentID string, amount int64, cur string, customerID string, fees int64) (*Entry, error) {
+	return recordPayment(ctx, m, tenantID, paymentIntentID, amount, cur, customerID, fees)
 }
 
-// RecordRefund creates a journal entry reversing a payment:
-//
-//	Debit  customer_balance:{cust}    (amount)
-//	Credit platform:cash              (amount)
 func (m *MemLedger) RecordRefund(ctx context.Context, tenantID, refundID string, amount int64, cur string, customerID string) (*Entry, error) {
-	if amount <= 0 {
-		return nil, ErrInvalidAmount
-	}
-	if cur == "" {
-		cur = "usd"
-	}
-
-	cashAcct, err := m.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
-	if err != nil {
-		return nil, err
-	}
-	custAcct, err := m.EnsureAccount(ctx, tenantID, "customer_balance:"+customerID, Liability, cur)
-	if err != nil {
-		return nil, err
-	}
-
-	entry := &Entry{
-		TenantID:       tenantID,
-		IdempotencyKey: "refund:" + refundID,
-		Description:    fmt.Sprintf("Refund %s: %d %s to customer %s", refundID, amount, cur, customerID),
-		RefundID:       refundID,
-		Postings: []Posting{
-			{AccountID: custAcct.ID, Amount: amount, Currency: cur},  // debit customer (reduce liability)
-			{AccountID: cashAcct.ID, Amount: -amount, Currency: cur}, // credit cash (reduce asset)
-		},
-	}
-
-	if err := m.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
-		return nil, err
-	}
-	return entry, nil
+	return recordRefund(ctx, m, tenantID, refundID, amount, cur, customerID)
 }
 
-// RecordPayout creates a journal entry for a merchant payout:
-//
-//	Debit  merchant_settlement:{merchant}    (amount)
-//	Credit platform:cash                     (amount)
 func (m *MemLedger) RecordPayout(ctx context.Context, tenantID, payoutID string, amount int64, cur string, merchantID string) (*Entry, error) {
-	if amount <= 0 {
-		return nil, ErrInvalidAmount
-	}
-	if cur == "" {
-		cur = "usd"
-	}
-
-	cashAcct, err := m.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
-	if err != nil {
-		return nil, err
-	}
-	merchAcct, err := m.EnsureAccount(ctx, tenantID, "merchant_settlement:"+merchantID, Liability, cur)
-	if err != nil {
-		return nil, err
-	}
-
-	entry := &Entry{
-		TenantID:       tenantID,
-		IdempotencyKey: "payout:" + payoutID,
-		Description:    fmt.Sprintf("Payout %s: %d %s to merchant %s", payoutID, amount, cur, merchantID),
-		PayoutID:       payoutID,
-		Postings: []Posting{
-			{AccountID: merchAcct.ID, Amount: amount, Currency: cur}, // debit merchant (reduce liability)
-			{AccountID: cashAcct.ID, Amount: -amount, Currency: cur}, // credit cash (reduce asset)
-		},
-	}
-
-	if err := m.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
-		return nil, err
-	}
-	return entry, nil
+	return recordPayout(ctx, m, tenantID, payoutID, amount, cur, merchantID)
 }
 
-// RecordDispute creates a journal entry moving funds into a dispute hold account:
-//
-//	Debit  platform:disputes_held            (amount)
-//	Credit platform:cash                     (amount)
 func (m *MemLedger) RecordDispute(ctx context.Context, tenantID, disputeID string, amount int64, cur string, customerID string) (*Entry, error) {
-	if amount <= 0 {
-		return nil, ErrInvalidAmount
-	}
-	if cur == "" {
-		cur = "usd"
-	}
-
-	cashAcct, err := m.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
-	if err != nil {
-		return nil, err
-	}
-	disputeAcct, err := m.EnsureAccount(ctx, tenantID, "platform:disputes_held", Asset, cur)
-	if err != nil {
-		return nil, err
-	}
-
-	entry := &Entry{
-		TenantID:       tenantID,
-		IdempotencyKey: "dispute:" + disputeID,
-		Description:    fmt.Sprintf("Dispute %s: %d %s from customer %s", disputeID, amount, cur, customerID),
-		DisputeID:      disputeID,
-		Postings: []Posting{
-			{AccountID: disputeAcct.ID, Amount: amount, Currency: cur}, // debit disputes held
-			{AccountID: cashAcct.ID, Amount: -amount, Currency: cur},   // credit cash
-		},
-	}
-
-	if err := m.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
-		return nil, err
-	}
-	return entry, nil
+	return recordDispute(ctx, m, tenantID, disputeID, amount, cur, customerID)
 }
 
 // Compile-time interface check.
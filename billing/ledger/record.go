@@ -0,0 +1,184 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// accountPoster is what the high-level operations need of a ledger: named
+// accounts made on first use, and entries. Every implementation records a
+// payment, refund, payout or dispute through the functions below, so the
+// chart of accounts and the postings are the same whichever one holds them.
+type accountPoster interface {
+	EnsureAccount(ctx context.Context, tenantID, name string, acctType AccountType, currency string) (*Account, error)
+	PostEntry(ctx context.Context, entry *Entry) error
+}
+
+// recordPayment creates a journal entry for a successful payment:
+//
+//	Debit  platform:cash              (amount)
+//	Credit customer_balance:{cust}    (amount - fees)
+//	Credit platform:fees              (fees)
+//
+// If fees == 0, the full amount credits the customer balance account.
+func recordPayment(ctx context.Context, l accountPoster, tenantID, paymentIntentID string, amount int64, cur string, customerID string, fees int64) (*Entry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if cur == "" {
+		cur = "usd"
+	}
+
+	cashAcct, err := l.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
+	if err != nil {
+		return nil, err
+	}
+	custAcct, err := l.EnsureAccount(ctx, tenantID, "customer_balance:"+customerID, Liability, cur)
+	if err != nil {
+		return nil, err
+	}
+
+	postings := []Posting{
+		{AccountID: cashAcct.ID, Amount: amount, Currency: cur},           // debit cash
+		{AccountID: custAcct.ID, Amount: -(amount - fees), Currency: cur}, // credit customer
+	}
+
+	if fees > 0 {
+		feeAcct, err := l.EnsureAccount(ctx, tenantID, "platform:fees", Revenue, cur)
+		if err != nil {
+			return nil, err
+		}
+		postings[1].Amount = -(amount - fees)
+		postings = append(postings, Posting{
+			AccountID: feeAcct.ID, Amount: -fees, Currency: cur, // credit fees
+		})
+	}
+
+	entry := &Entry{
+		TenantID:        tenantID,
+		IdempotencyKey:  "payment:" + paymentIntentID,
+		Description:     fmt.Sprintf("Payment %s: %d %s (fees %d)", paymentIntentID, amount, cur, fees),
+		PaymentIntentID: paymentIntentID,
+		Postings:        postings,
+	}
+
+	if err := l.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// recordRefund creates a journal entry reversing a payment:
+//
+//	Debit  customer_balance:{cust}    (amount)
+//	Credit platform:cash              (amount)
+func recordRefund(ctx context.Context, l accountPoster, tenantID, refundID string, amount int64, cur string, customerID string) (*Entry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if cur == "" {
+		cur = "usd"
+	}
+
+	cashAcct, err := l.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
+	if err != nil {
+		return nil, err
+	}
+	custAcct, err := l.EnsureAccount(ctx, tenantID, "customer_balance:"+customerID, Liability, cur)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		TenantID:       tenantID,
+		IdempotencyKey: "refund:" + refundID,
+		Description:    fmt.Sprintf("Refund %s: %d %s to customer %s", refundID, amount, cur, customerID),
+		RefundID:       refundID,
+		Postings: []Posting{
+			{AccountID: custAcct.ID, Amount: amount, Currency: cur},  // debit customer (reduce liability)
+			{AccountID: cashAcct.ID, Amount: -amount, Currency: cur}, // credit cash (reduce asset)
+		},
+	}
+
+	if err := l.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// recordPayout creates a journal entry for a merchant payout:
+//
+//	Debit  merchant_settlement:{merchant}    (amount)
+//	Credit platform:cash                     (amount)
+func recordPayout(ctx context.Context, l accountPoster, tenantID, payoutID string, amount int64, cur string, merchantID string) (*Entry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if cur == "" {
+		cur = "usd"
+	}
+
+	cashAcct, err := l.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
+	if err != nil {
+		return nil, err
+	}
+	merchAcct, err := l.EnsureAccount(ctx, tenantID, "merchant_settlement:"+merchantID, Liability, cur)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		TenantID:       tenantID,
+		IdempotencyKey: "payout:" + payoutID,
+		Description:    fmt.Sprintf("Payout %s: %d %s to merchant %s", payoutID, amount, cur, merchantID),
+		PayoutID:       payoutID,
+		Postings: []Posting{
+			{AccountID: merchAcct.ID, Amount: amount, Currency: cur}, // debit merchant (reduce liability)
+			{AccountID: cashAcct.ID, Amount: -amount, Currency: cur}, // credit cash (reduce asset)
+		},
+	}
+
+	if err := l.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// recordDispute creates a journal entry moving funds into a dispute hold account:
+//
+//	Debit  platform:disputes_held            (amount)
+//	Credit platform:cash                     (amount)
+func recordDispute(ctx context.Context, l accountPoster, tenantID, disputeID string, amount int64, cur string, customerID string) (*Entry, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if cur == "" {
+		cur = "usd"
+	}
+
+	cashAcct, err := l.EnsureAccount(ctx, tenantID, "platform:cash", Asset, cur)
+	if err != nil {
+		return nil, err
+	}
+	disputeAcct, err := l.EnsureAccount(ctx, tenantID, "platform:disputes_held", Asset, cur)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{
+		TenantID:       tenantID,
+		IdempotencyKey: "dispute:" + disputeID,
+		Description:    fmt.Sprintf("Dispute %s: %d %s from customer %s", disputeID, amount, cur, customerID),
+		DisputeID:      disputeID,
+		Postings: []Posting{
+			{AccountID: disputeAcct.ID, Amount: amount, Currency: cur}, // debit disputes held
+			{AccountID: cashAcct.ID, Amount: -amount, Currency: cur},   // credit cash
+		},
+	}
+
+	if err := l.PostEntry(ctx, entry); err != nil && !errors.Is(err, ErrDuplicateEntry) {
+		return nil, err
+	}
+	return entry, nil
+}
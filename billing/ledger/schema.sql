@@ -1,8 +1,10 @@
 -- Double-Entry Ledger Schema
 -- All monetary amounts are stored in the currency's smallest unit (cents for USD).
 -- Every ledger_entry MUST have postings that sum to exactly zero.
-
-BEGIN;
+--
+-- This is the Postgres schema; schema_sqlite.sql is the same tables for
+-- SQLite. SQLLedger applies it, in one transaction, every time it opens a
+-- store, so every statement here must be safe to run again.
 
 -- ---------------------------------------------------------------------------
 -- 1. Chart of Accounts
@@ -33,7 +35,7 @@ COMMENT ON COLUMN ledger_accounts.normal_balance IS 'debit for asset/expense, cr
 --   customer_balance:{customer_id}   -- prepaid customer credit (liability)
 --   merchant_settlement:{merchant_id} -- owed to merchant (liability)
 
-CREATE INDEX idx_ledger_accounts_tenant ON ledger_accounts (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_accounts_tenant ON ledger_accounts (tenant_id);
 
 -- ---------------------------------------------------------------------------
 -- 2. Journal Entries (groups of postings)
@@ -57,12 +59,12 @@ CREATE TABLE IF NOT EXISTS ledger_entries (
 
 COMMENT ON TABLE ledger_entries IS 'Journal entries. Each entry groups one or more postings that must sum to zero.';
 
-CREATE INDEX idx_ledger_entries_tenant          ON ledger_entries (tenant_id);
-CREATE INDEX idx_ledger_entries_payment_intent  ON ledger_entries (payment_intent_id) WHERE payment_intent_id IS NOT NULL;
-CREATE INDEX idx_ledger_entries_refund          ON ledger_entries (refund_id)          WHERE refund_id IS NOT NULL;
-CREATE INDEX idx_ledger_entries_payout          ON ledger_entries (payout_id)          WHERE payout_id IS NOT NULL;
-CREATE INDEX idx_ledger_entries_dispute         ON ledger_entries (dispute_id)         WHERE dispute_id IS NOT NULL;
-CREATE INDEX idx_ledger_entries_created         ON ledger_entries (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_tenant          ON ledger_entries (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_payment_intent  ON ledger_entries (payment_intent_id) WHERE payment_intent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_refund          ON ledger_entries (refund_id)          WHERE refund_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_payout          ON ledger_entries (payout_id)          WHERE payout_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_dispute         ON ledger_entries (dispute_id)         WHERE dispute_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_created         ON ledger_entries (tenant_id, created_at);
 
 -- ---------------------------------------------------------------------------
 -- 3. Individual Postings (debits and credits)
@@ -74,14 +76,15 @@ CREATE TABLE IF NOT EXISTS ledger_postings (
     account_id  TEXT        NOT NULL REFERENCES ledger_accounts(id),
     amount      BIGINT      NOT NULL,  -- positive = debit, negative = credit
     currency    TEXT        NOT NULL DEFAULT 'usd',
+    position    INTEGER     NOT NULL DEFAULT 0,  -- order within the entry
     created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
 COMMENT ON TABLE  ledger_postings IS 'Individual debit/credit legs of a journal entry.';
 COMMENT ON COLUMN ledger_postings.amount IS 'Positive = debit, negative = credit. Sum per entry MUST equal zero.';
 
-CREATE INDEX idx_ledger_postings_entry   ON ledger_postings (entry_id);
-CREATE INDEX idx_ledger_postings_account ON ledger_postings (account_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry   ON ledger_postings (entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account ON ledger_postings (account_id);
 
 -- ---------------------------------------------------------------------------
 -- 4. Authorization Holds
@@ -103,10 +106,10 @@ CREATE TABLE IF NOT EXISTS ledger_holds (
 
 COMMENT ON TABLE ledger_holds IS 'Pending authorization holds that reduce available balance without moving funds.';
 
-CREATE INDEX idx_ledger_holds_tenant  ON ledger_holds (tenant_id);
-CREATE INDEX idx_ledger_holds_account ON ledger_holds (account_id, status);
-CREATE INDEX idx_ledger_holds_payment ON ledger_holds (payment_intent_id) WHERE payment_intent_id IS NOT NULL;
-CREATE INDEX idx_ledger_holds_expires ON ledger_holds (expires_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_tenant  ON ledger_holds (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_account ON ledger_holds (account_id, status);
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_payment ON ledger_holds (payment_intent_id) WHERE payment_intent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_expires ON ledger_holds (expires_at) WHERE status = 'pending';
 
 -- ---------------------------------------------------------------------------
 -- 5. Materialized Balances
@@ -155,10 +158,10 @@ $$ LANGUAGE plpgsql;
 -- The trigger fires as a constraint trigger at commit time so all postings
 -- for a single entry can be inserted before the check runs.
 
+DROP TRIGGER IF EXISTS trg_check_entry_balance ON ledger_postings;
+
 CREATE CONSTRAINT TRIGGER trg_check_entry_balance
     AFTER INSERT ON ledger_postings
     DEFERRABLE INITIALLY DEFERRED
     FOR EACH ROW
     EXECUTE FUNCTION check_entry_balance();
-
-COMMIT;
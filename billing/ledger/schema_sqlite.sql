@@ -0,0 +1,95 @@
+-- Double-Entry Ledger Schema (SQLite)
+-- The tables of schema.sql, for a SQLite store. Amounts are the same smallest
+-- unit, and what differs is what SQLite lacks:
+--   * no JSONB: metadata is JSON text.
+--   * no TIMESTAMPTZ: times are fixed-width RFC 3339 UTC text, which sorts in
+--     time order as text.
+--   * no deferred constraint trigger: SQLLedger checks that an entry's
+--     postings sum to zero before it writes any of them, in the same
+--     transaction, and SQLite runs one writer at a time.
+--
+-- SQLLedger applies this every time it opens a store, one statement at a
+-- time, so every statement must be safe to run again and none may contain a
+-- semicolon but the one that ends it.
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id              TEXT    PRIMARY KEY,
+    tenant_id       TEXT    NOT NULL,
+    name            TEXT    NOT NULL,
+    type            TEXT    NOT NULL CHECK (type IN ('asset', 'liability', 'equity', 'revenue', 'expense')),
+    currency        TEXT    NOT NULL DEFAULT 'usd',
+    normal_balance  TEXT    NOT NULL CHECK (normal_balance IN ('debit', 'credit')),
+    metadata        TEXT    NOT NULL DEFAULT '{}',
+    created_at      TEXT    NOT NULL,
+
+    UNIQUE (tenant_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_accounts_tenant ON ledger_accounts (tenant_id);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id                  TEXT    PRIMARY KEY,
+    tenant_id           TEXT    NOT NULL,
+    idempotency_key     TEXT    NOT NULL,
+    description         TEXT    NOT NULL DEFAULT '',
+    payment_intent_id   TEXT,
+    refund_id           TEXT,
+    payout_id           TEXT,
+    transfer_id         TEXT,
+    dispute_id          TEXT,
+    metadata            TEXT    NOT NULL DEFAULT '{}',
+    created_at          TEXT    NOT NULL,
+
+    UNIQUE (tenant_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_tenant          ON ledger_entries (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_payment_intent  ON ledger_entries (payment_intent_id) WHERE payment_intent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_refund          ON ledger_entries (refund_id)          WHERE refund_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_payout          ON ledger_entries (payout_id)          WHERE payout_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_dispute         ON ledger_entries (dispute_id)         WHERE dispute_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_created         ON ledger_entries (tenant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id          TEXT    PRIMARY KEY,
+    entry_id    TEXT    NOT NULL REFERENCES ledger_entries(id),
+    account_id  TEXT    NOT NULL REFERENCES ledger_accounts(id),
+    amount      BIGINT  NOT NULL,  -- positive = debit, negative = credit
+    currency    TEXT    NOT NULL DEFAULT 'usd',
+    position    INTEGER NOT NULL DEFAULT 0,  -- order within the entry
+    created_at  TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry   ON ledger_postings (entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account ON ledger_postings (account_id);
+
+CREATE TABLE IF NOT EXISTS ledger_holds (
+    id                  TEXT    PRIMARY KEY,
+    tenant_id           TEXT    NOT NULL,
+    account_id          TEXT    NOT NULL REFERENCES ledger_accounts(id),
+    amount              BIGINT  NOT NULL CHECK (amount > 0),
+    currency            TEXT    NOT NULL DEFAULT 'usd',
+    status              TEXT    NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'captured', 'voided', 'expired')),
+    payment_intent_id   TEXT,
+    captured_entry_id   TEXT    REFERENCES ledger_entries(id),
+    expires_at          TEXT    NOT NULL,
+    created_at          TEXT    NOT NULL,
+    updated_at          TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_tenant  ON ledger_holds (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_account ON ledger_holds (account_id, status);
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_payment ON ledger_holds (payment_intent_id) WHERE payment_intent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_holds_expires ON ledger_holds (expires_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS ledger_balances (
+    account_id          TEXT    NOT NULL REFERENCES ledger_accounts(id),
+    currency            TEXT    NOT NULL DEFAULT 'usd',
+    posted_balance      BIGINT  NOT NULL DEFAULT 0,
+    pending_balance     BIGINT  NOT NULL DEFAULT 0,
+    held_balance        BIGINT  NOT NULL DEFAULT 0,
+    available_balance   BIGINT  NOT NULL DEFAULT 0,
+    updated_at          TEXT    NOT NULL,
+
+    PRIMARY KEY (account_id, currency)
+);
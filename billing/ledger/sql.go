@@ -0,0 +1,758 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+)
+
+//go:embed schema.sql
+var postgresSchema string
+
+//go:embed schema_sqlite.sql
+var sqliteSchema string
+
+// SQLLedger is the durable Ledger: the tables of schema.sql, in a SQLite or
+// Postgres store.
+//
+// Every write is one transaction through db.SQLStore.WriteSQL, so an entry,
+// its postings and the balance snapshots they move commit together or not at
+// all. On Postgres that transaction is SERIALIZABLE and retried when it loses
+// a race; on SQLite the store runs one writer at a time. Either way two
+// postings to one account can never both read the same snapshot.
+//
+// The database, not this code, is what makes an idempotency key unique: an
+// entry is inserted with ON CONFLICT DO NOTHING on (tenant_id, idempotency_key),
+// and an insert that does nothing is a replay. Two processes posting the same
+// key at once get one entry between them.
+//
+// Balances are read from ledger_balances, which every posting and hold
+// updates in its own transaction, so a read is one row however long the
+// account's history.
+type SQLLedger struct {
+	store    db.SQLStore
+	postgres bool
+}
+
+// NewSQLLedger opens the ledger in store, creating its tables if they are not
+// there. The store must offer db.SQLStore: the SQLite and Postgres stores do,
+// and so does an org's store from db.Manager.Org.
+func NewSQLLedger(ctx context.Context, store db.DB) (*SQLLedger, error) {
+	s, ok := store.(db.SQLStore)
+	if !ok {
+		return nil, fmt.Errorf("ledger: store %T has no SQL access", store)
+	}
+	l := &SQLLedger{store: s, postgres: s.SQLDialect() == db.DialectPostgres}
+	if err := l.migrate(ctx); err != nil {
+		return nil, fmt.Errorf("ledger: apply schema: %w", err)
+	}
+	return l, nil
+}
+
+// migrate applies the schema. Postgres takes the file whole — its function
+// body has semicolons of its own; SQLite one statement at a time.
+func (l *SQLLedger) migrate(ctx context.Context) error {
+	return l.store.WriteSQL(ctx, func(tx *sql.Tx) error {
+		if l.postgres {
+			_, err := tx.ExecContext(ctx, postgresSchema)
+			return err
+		}
+		for _, stmt := range strings.Split(sqliteSchema, ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// querier is what both a *sql.DB and a *sql.Tx offer, so a lookup reads the
+// same inside a write as outside one.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// bind rewrites ? placeholders to $1, $2, … for Postgres. None of the
+// statements in this file carry a literal question mark.
+func (l *SQLLedger) bind(query string) string {
+	if !l.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (l *SQLLedger) read(ctx context.Context, fn func(querier) error) error {
+	return l.store.ReadSQL(ctx, func(h *sql.DB) error { return fn(h) })
+}
+
+func (l *SQLLedger) write(ctx context.Context, fn func(querier) error) error {
+	return l.store.WriteSQL(ctx, func(tx *sql.Tx) error { return fn(tx) })
+}
+
+// timeLayout is how SQLite holds a time: fixed-width and UTC, so that text
+// order is time order and created_at can be compared and sorted as it is.
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// now is the time a write stamps, at the microsecond Postgres keeps, so what
+// a write returns is what a read of it gives back.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (l *SQLLedger) ts(t time.Time) interface{} {
+	if l.postgres {
+		return t
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+// sqlTime scans either backend's time column.
+type sqlTime struct{ t *time.Time }
+
+func (s sqlTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+	case time.Time:
+		*s.t = v
+	case string:
+		return s.parse(v)
+	case []byte:
+		return s.parse(string(v))
+	default:
+		return fmt.Errorf("ledger: cannot scan %T as a time", src)
+	}
+	return nil
+}
+
+func (s sqlTime) parse(v string) error {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return fmt.Errorf("ledger: bad time %q: %w", v, err)
+	}
+	*s.t = t
+	return nil
+}
+
+// nullable stores an empty optional reference as NULL, which is what the
+// partial indexes on them leave out.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func encodeMetadata(m map[string]interface{}) (string, error) {
+	if len(m) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("ledger: encode metadata: %w", err)
+	}
+	return string(b), nil
+}
+
+func decodeMetadata(s string) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("ledger: decode metadata: %w", err)
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ---------------------------------------------------------------------------
+// Accounts
+// ---------------------------------------------------------------------------
+
+const accountColumns = `id, tenant_id, name, type, currency, normal_balance, metadata, created_at`
+
+func scanAccount(row scanner) (*Account, error) {
+	var (
+		a        Account
+		metadata string
+	)
+	if err := row.Scan(&a.ID, &a.TenantID, &a.Name, &a.Type, &a.Currency, &a.NormalBalance, &metadata, sqlTime{&a.CreatedAt}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	m, err := decodeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	a.Metadata = m
+	return &a, nil
+}
+
+// insertAccount writes a unless the tenant has an account of that name, and
+// says whether it did.
+func (l *SQLLedger) insertAccount(ctx context.Context, q querier, a *Account) (bool, error) {
+	metadata, err := encodeMetadata(a.Metadata)
+	if err != nil {
+		return false, err
+	}
+	res, err := q.ExecContext(ctx, l.bind(`INSERT INTO ledger_accounts (`+accountColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, name) DO NOTHING`),
+		a.ID, a.TenantID, a.Name, string(a.Type), a.Currency, a.NormalBalance, metadata, l.ts(a.CreatedAt))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (l *SQLLedger) accountByID(ctx context.Context, q querier, id string) (*Account, error) {
+	return scanAccount(q.QueryRowContext(ctx, l.bind(`SELECT `+accountColumns+` FROM ledger_accounts WHERE id = ?`), id))
+}
+
+func (l *SQLLedger) accountByName(ctx context.Context, q querier, tenantID, name string) (*Account, error) {
+	return scanAccount(q.QueryRowContext(ctx, l.bind(`SELECT `+accountColumns+` FROM ledger_accounts WHERE tenant_id = ? AND name = ?`), tenantID, name))
+}
+
+func (l *SQLLedger) CreateAccount(ctx context.Context, a *Account) error {
+	if a.ID == "" {
+		a.ID = newID()
+	}
+	if a.Currency == "" {
+		a.Currency = "usd"
+	}
+	if a.NormalBalance == "" {
+		a.NormalBalance = a.Type.NormalBalance()
+	}
+	a.CreatedAt = now()
+
+	return l.write(ctx, func(q querier) error {
+		created, err := l.insertAccount(ctx, q, a)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return fmt.Errorf("ledger: account %q already exists for tenant %s", a.Name, a.TenantID)
+		}
+		return nil
+	})
+}
+
+func (l *SQLLedger) GetAccount(ctx context.Context, id string) (*Account, error) {
+	var a *Account
+	err := l.read(ctx, func(q querier) (err error) {
+		a, err = l.accountByID(ctx, q, id)
+		return err
+	})
+	return a, err
+}
+
+// FindAccount looks up a tenant's account by name.
+func (l *SQLLedger) FindAccount(ctx context.Context, tenantID, name string) (*Account, error) {
+	var a *Account
+	err := l.read(ctx, func(q querier) (err error) {
+		a, err = l.accountByName(ctx, q, tenantID, name)
+		return err
+	})
+	return a, err
+}
+
+// EnsureAccount finds or creates a named account within a tenant. Two callers
+// ensuring the same account at once get the same one.
+func (l *SQLLedger) EnsureAccount(ctx context.Context, tenantID, name string, acctType AccountType, currency string) (*Account, error) {
+	var a *Account
+	err := l.write(ctx, func(q querier) error {
+		if _, err := l.insertAccount(ctx, q, &Account{
+			ID:            newID(),
+			TenantID:      tenantID,
+			Name:          name,
+			Type:          acctType,
+			Currency:      currency,
+			NormalBalance: acctType.NormalBalance(),
+			CreatedAt:     now(),
+		}); err != nil {
+			return err
+		}
+		var err error
+		a, err = l.accountByName(ctx, q, tenantID, name)
+		return err
+	})
+	return a, err
+}
+
+// ---------------------------------------------------------------------------
+// Entries
+// ---------------------------------------------------------------------------
+
+const entryColumns = `id, tenant_id, idempotency_key, description, payment_intent_id, refund_id,
+	payout_id, transfer_id, dispute_id, metadata, created_at`
+
+const postingColumns = `id, entry_id, account_id, amount, currency, created_at`
+
+func scanEntry(row scanner) (*Entry, error) {
+	var (
+		e                                     Entry
+		pi, refund, payout, transfer, dispute sql.NullString
+		metadata                              string
+	)
+	if err := row.Scan(&e.ID, &e.TenantID, &e.IdempotencyKey, &e.Description, &pi, &refund,
+		&payout, &transfer, &dispute, &metadata, sqlTime{&e.CreatedAt}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntryNotFound
+		}
+		return nil, err
+	}
+	e.PaymentIntentID, e.RefundID, e.PayoutID = pi.String, refund.String, payout.String
+	e.TransferID, e.DisputeID = transfer.String, dispute.String
+	m, err := decodeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	e.Metadata = m
+	return &e, nil
+}
+
+func (l *SQLLedger) PostEntry(ctx context.Context, e *Entry) error {
+	if err := checkPostings(e.Postings); err != nil {
+		return err
+	}
+	return l.write(ctx, func(q querier) error { return l.postEntry(ctx, q, e) })
+}
+
+// postEntry writes e, its postings and the balances they move, inside the
+// caller's transaction. A replayed idempotency key writes nothing: e becomes
+// the entry first posted under it and the result is ErrDuplicateEntry.
+func (l *SQLLedger) postEntry(ctx context.Context, q querier, e *Entry) error {
+	for _, p := range e.Postings {
+		if _, err := l.accountByID(ctx, q, p.AccountID); err != nil {
+			if errors.Is(err, ErrAccountNotFound) {
+				return fmt.Errorf("%w: %s", ErrAccountNotFound, p.AccountID)
+			}
+			return err
+		}
+	}
+
+	metadata, err := encodeMetadata(e.Metadata)
+	if err != nil {
+		return err
+	}
+	at := now()
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	e.CreatedAt = at
+
+	res, err := q.ExecContext(ctx, l.bind(`INSERT INTO ledger_entries (`+entryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tenant_id, idempotency_key) DO NOTHING`),
+		e.ID, e.TenantID, e.IdempotencyKey, e.Description, nullable(e.PaymentIntentID), nullable(e.RefundID),
+		nullable(e.PayoutID), nullable(e.TransferID), nullable(e.DisputeID), metadata, l.ts(at))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		existing, err := l.entryByKey(ctx, q, e.TenantID, e.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+		*e = *existing
+		return ErrDuplicateEntry
+	}
+
+	for i := range e.Postings {
+		p := &e.Postings[i]
+		p.ID = newID()
+		p.EntryID = e.ID
+		if p.Currency == "" {
+			p.Currency = "usd"
+		}
+		p.CreatedAt = at
+		if _, err := q.ExecContext(ctx, l.bind(`INSERT INTO ledger_postings
+			(id, entry_id, account_id, amount, currency, position, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			p.ID, p.EntryID, p.AccountID, p.Amount, p.Currency, i, l.ts(at)); err != nil {
+			return err
+		}
+		if err := l.movePosted(ctx, q, p.AccountID, p.Currency, p.Amount, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// movePosted adds amount to an account's posted balance snapshot.
+func (l *SQLLedger) movePosted(ctx context.Context, q querier, accountID, currency string, amount int64, at time.Time) error {
+	_, err := q.ExecContext(ctx, l.bind(`INSERT INTO ledger_balances
+		(account_id, currency, posted_balance, held_balance, available_balance, updated_at)
+		VALUES (?, ?, ?, 0, ?, ?)
+		ON CONFLICT (account_id, currency) DO UPDATE SET
+			posted_balance = ledger_balances.posted_balance + excluded.posted_balance,
+			available_balance = ledger_balances.posted_balance + excluded.posted_balance - ledger_balances.held_balance,
+			updated_at = excluded.updated_at`),
+		accountID, currency, amount, amount, l.ts(at))
+	return err
+}
+
+// moveHeld adds amount, which may be negative, to an account's held balance
+// snapshot.
+func (l *SQLLedger) moveHeld(ctx context.Context, q querier, accountID, currency string, amount int64, at time.Time) error {
+	_, err := q.ExecContext(ctx, l.bind(`INSERT INTO ledger_balances
+		(account_id, currency, posted_balance, held_balance, available_balance, updated_at)
+		VALUES (?, ?, 0, ?, ?, ?)
+		ON CONFLICT (account_id, currency) DO UPDATE SET
+			held_balance = ledger_balances.held_balance + excluded.held_balance,
+			available_balance = ledger_balances.posted_balance - ledger_balances.held_balance - excluded.held_balance,
+			updated_at = excluded.updated_at`),
+		accountID, currency, amount, -amount, l.ts(at))
+	return err
+}
+
+func (l *SQLLedger) entryByKey(ctx context.Context, q querier, tenantID, key string) (*Entry, error) {
+	e, err := scanEntry(q.QueryRowContext(ctx, l.bind(`SELECT `+entryColumns+` FROM ledger_entries
+		WHERE tenant_id = ? AND idempotency_key = ?`), tenantID, key))
+	if err != nil {
+		return nil, err
+	}
+	return e, l.loadPostings(ctx, q, []*Entry{e})
+}
+
+// loadPostings fills in the postings of entries, in the order they were
+// posted, with one query.
+func (l *SQLLedger) loadPostings(ctx context.Context, q querier, entries []*Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Entry, len(entries))
+	args := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		e.Postings = nil
+		byID[e.ID] = e
+		args = append(args, e.ID)
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := q.QueryContext(ctx, l.bind(`SELECT `+postingColumns+` FROM ledger_postings
+		WHERE entry_id IN (`+marks+`) ORDER BY entry_id, position`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Posting
+		if err := rows.Scan(&p.ID, &p.EntryID, &p.AccountID, &p.Amount, &p.Currency, sqlTime{&p.CreatedAt}); err != nil {
+			return err
+		}
+		if e := byID[p.EntryID]; e != nil {
+			e.Postings = append(e.Postings, p)
+		}
+	}
+	return rows.Err()
+}
+
+func (l *SQLLedger) GetEntry(ctx context.Context, id string) (*Entry, error) {
+	var e *Entry
+	err := l.read(ctx, func(q querier) error {
+		var err error
+		if e, err = scanEntry(q.QueryRowContext(ctx, l.bind(`SELECT `+entryColumns+` FROM ledger_entries WHERE id = ?`), id)); err != nil {
+			return err
+		}
+		return l.loadPostings(ctx, q, []*Entry{e})
+	})
+	return e, err
+}
+
+// ListEntries returns the entries f matches, oldest first.
+func (l *SQLLedger) ListEntries(ctx context.Context, f EntryFilter) ([]*Entry, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	eq := func(column, value string) {
+		if value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	eq("tenant_id", f.TenantID)
+	eq("payment_intent_id", f.PaymentIntentID)
+	eq("refund_id", f.RefundID)
+	eq("payout_id", f.PayoutID)
+	eq("dispute_id", f.DisputeID)
+	if f.AccountID != "" {
+		where = append(where, "id IN (SELECT entry_id FROM ledger_postings WHERE account_id = ?)")
+		args = append(args, f.AccountID)
+	}
+	if !f.CreatedAfter.IsZero() {
+		where = append(where, "created_at > ?")
+		args = append(args, l.ts(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, l.ts(f.CreatedBefore))
+	}
+
+	query := `SELECT ` + entryColumns + ` FROM ledger_entries`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at, id`
+	if f.Limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(f.Limit)
+	}
+
+	var result []*Entry
+	err := l.read(ctx, func(q querier) error {
+		rows, err := q.QueryContext(ctx, l.bind(query), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e, err := scanEntry(rows)
+			if err != nil {
+				return err
+			}
+			result = append(result, e)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return l.loadPostings(ctx, q, result)
+	})
+	return result, err
+}
+
+// ---------------------------------------------------------------------------
+// Holds
+// ---------------------------------------------------------------------------
+
+const holdColumns = `id, tenant_id, account_id, amount, currency, status, payment_intent_id,
+	captured_entry_id, expires_at, created_at, updated_at`
+
+func scanHold(row scanner) (*Hold, error) {
+	var (
+		h                Hold
+		pi, capturedFrom sql.NullString
+	)
+	if err := row.Scan(&h.ID, &h.TenantID, &h.AccountID, &h.Amount, &h.Currency, &h.Status, &pi,
+		&capturedFrom, sqlTime{&h.ExpiresAt}, sqlTime{&h.CreatedAt}, sqlTime{&h.UpdatedAt}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	h.PaymentIntentID, h.CapturedEntryID = pi.String, capturedFrom.String
+	return &h, nil
+}
+
+// holdForUpdate reads a hold that the transaction is about to settle. On
+// Postgres the row is locked, so a second capture waits for the first rather
+// than failing serialization after doing all its work.
+func (l *SQLLedger) holdForUpdate(ctx context.Context, q querier, id string) (*Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM ledger_holds WHERE id = ?`
+	if l.postgres {
+		query += ` FOR UPDATE`
+	}
+	return scanHold(q.QueryRowContext(ctx, l.bind(query), id))
+}
+
+func (l *SQLLedger) CreateHold(ctx context.Context, h *Hold) error {
+	if h.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if h.Currency == "" {
+		h.Currency = "usd"
+	}
+
+	return l.write(ctx, func(q querier) error {
+		if _, err := l.accountByID(ctx, q, h.AccountID); err != nil {
+			if errors.Is(err, ErrAccountNotFound) {
+				return fmt.Errorf("%w: %s", ErrAccountNotFound, h.AccountID)
+			}
+			return err
+		}
+
+		at := now()
+		if h.ID == "" {
+			h.ID = newID()
+		}
+		h.Status = HoldPending
+		h.CreatedAt = at
+		h.UpdatedAt = at
+
+		if _, err := q.ExecContext(ctx, l.bind(`INSERT INTO ledger_holds (`+holdColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, NULL, ?, ?, ?)`),
+			h.ID, h.TenantID, h.AccountID, h.Amount, h.Currency, string(h.Status), nullable(h.PaymentIntentID),
+			l.ts(h.ExpiresAt), l.ts(at), l.ts(at)); err != nil {
+			return err
+		}
+		return l.moveHeld(ctx, q, h.AccountID, h.Currency, h.Amount, at)
+	})
+}
+
+func (l *SQLLedger) GetHold(ctx context.Context, id string) (*Hold, error) {
+	var h *Hold
+	err := l.read(ctx, func(q querier) (err error) {
+		h, err = scanHold(q.QueryRowContext(ctx, l.bind(`SELECT `+holdColumns+` FROM ledger_holds WHERE id = ?`), id))
+		return err
+	})
+	return h, err
+}
+
+// CaptureHold settles a pending hold and posts amount of it — all of it when
+// amount is not positive — from the held account to the tenant's
+// platform:cash. The hold is released whole, whatever was captured. Settling
+// the hold and posting the entry are one transaction: a capture that cannot
+// post leaves the hold pending.
+func (l *SQLLedger) CaptureHold(ctx context.Context, holdID string, amount int64) (*Entry, error) {
+	var entry *Entry
+	err := l.write(ctx, func(q querier) error {
+		h, err := l.holdForUpdate(ctx, q, holdID)
+		if err != nil {
+			return err
+		}
+		if h.Status != HoldPending {
+			return ErrHoldNotPending
+		}
+		capture := amount
+		if capture <= 0 {
+			capture = h.Amount
+		}
+		if capture > h.Amount {
+			return ErrCaptureExceedsHold
+		}
+
+		cash, err := l.accountByName(ctx, q, h.TenantID, "platform:cash")
+		if err != nil {
+			return fmt.Errorf("ledger: cannot capture hold without platform:cash account: %w", err)
+		}
+
+		entry = &Entry{
+			TenantID:        h.TenantID,
+			IdempotencyKey:  "capture:" + holdID,
+			Description:     fmt.Sprintf("Capture hold %s for %d", holdID, capture),
+			PaymentIntentID: h.PaymentIntentID,
+			Postings: []Posting{
+				{AccountID: h.AccountID, Amount: -capture, Currency: h.Currency}, // credit source
+				{AccountID: cash.ID, Amount: capture, Currency: h.Currency},      // debit platform cash
+			},
+		}
+		if err := l.postEntry(ctx, q, entry); err != nil {
+			return err
+		}
+
+		at := now()
+		if _, err := q.ExecContext(ctx, l.bind(`UPDATE ledger_holds
+			SET status = ?, captured_entry_id = ?, updated_at = ? WHERE id = ?`),
+			string(HoldCaptured), entry.ID, l.ts(at), holdID); err != nil {
+			return err
+		}
+		return l.moveHeld(ctx, q, h.AccountID, h.Currency, -h.Amount, at)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (l *SQLLedger) VoidHold(ctx context.Context, holdID string) error {
+	return l.write(ctx, func(q querier) error {
+		h, err := l.holdForUpdate(ctx, q, holdID)
+		if err != nil {
+			return err
+		}
+		if h.Status != HoldPending {
+			return ErrHoldNotPending
+		}
+
+		at := now()
+		if _, err := q.ExecContext(ctx, l.bind(`UPDATE ledger_holds SET status = ?, updated_at = ? WHERE id = ?`),
+			string(HoldVoided), l.ts(at), holdID); err != nil {
+			return err
+		}
+		return l.moveHeld(ctx, q, h.AccountID, h.Currency, -h.Amount, at)
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Balances
+// ---------------------------------------------------------------------------
+
+func (l *SQLLedger) GetBalance(ctx context.Context, accountID string, currency string) (*Balance, error) {
+	if currency == "" {
+		currency = "usd"
+	}
+
+	var b *Balance
+	err := l.read(ctx, func(q querier) error {
+		if _, err := l.accountByID(ctx, q, accountID); err != nil {
+			return err
+		}
+		b = &Balance{AccountID: accountID, Currency: currency}
+		err := q.QueryRowContext(ctx, l.bind(`SELECT posted_balance, pending_balance, held_balance, available_balance, updated_at
+			FROM ledger_balances WHERE account_id = ? AND currency = ?`), accountID, currency).
+			Scan(&b.PostedBalance, &b.PendingBalance, &b.HeldBalance, &b.AvailableBalance, sqlTime{&b.UpdatedAt})
+		if errors.Is(err, sql.ErrNoRows) {
+			b.UpdatedAt = time.Now()
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// ---------------------------------------------------------------------------
+// High-Level Operations
+// ---------------------------------------------------------------------------
+
+func (l *SQLLedger) RecordPayment(ctx context.Context, tenantID, paymentIntentID string, amount int64, cur string, customerID string, fees int64) (*Entry, error) {
+	return recordPayment(ctx, l, tenantID, paymentIntentID, amount, cur, customerID, fees)
+}
+
+func (l *SQLLedger) RecordRefund(ctx context.Context, tenantID, refundID string, amount int64, cur string, customerID string) (*Entry, error) {
+	return recordRefund(ctx, l, tenantID, refundID, amount, cur, customerID)
+}
+
+func (l *SQLLedger) RecordPayout(ctx context.Context, tenantID, payoutID string, amount int64, cur string, merchantID string) (*Entry, error) {
+	return recordPayout(ctx, l, tenantID, payoutID, amount, cur, merchantID)
+}
+
+func (l *SQLLedger) RecordDispute(ctx context.Context, tenantID, disputeID string, amount int64, cur string, customerID string) (*Entry, error) {
+	return recordDispute(ctx, l, tenantID, disputeID, amount, cur, customerID)
+}
+
+// Compile-time interface check.
+var _ Ledger = (*SQLLedger)(nil)
@@ -0,0 +1,177 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/hanzoai/commerce/db"
+)
+
+func openSQLite(t *testing.T, path string) *db.SQLiteDB {
+	t.Helper()
+	sdb, err := db.NewSQLiteDB(&db.SQLiteDBConfig{
+		Path:       path,
+		Config:     db.DefaultConfig().SQLite,
+		TenantID:   "acme",
+		TenantType: "org",
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { sdb.Close() })
+	return sdb
+}
+
+func sqliteLedger(t *testing.T) testLedger {
+	t.Helper()
+	l, err := NewSQLLedger(context.Background(), openSQLite(t, filepath.Join(t.TempDir(), "ledger.db")))
+	if err != nil {
+		t.Fatalf("NewSQLLedger: %v", err)
+	}
+	return l
+}
+
+// postgresLedger is env-gated like the db package's Postgres tests. Point it
+// at a THROWAWAY database: it empties the ledger tables before every test.
+//
+//	COMMERCE_TEST_POSTGRES_DSN='postgres://postgres:x@127.0.0.1:15433/postgres?sslmode=disable' \
+//	  go test ./billing/ledger/ -count=1
+func postgresLedger(t *testing.T) testLedger {
+	t.Helper()
+	dsn := os.Getenv("COMMERCE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("COMMERCE_TEST_POSTGRES_DSN not set")
+	}
+	pdb, err := db.NewPostgresDB(&db.PostgresDBConfig{
+		DSN:      dsn,
+		TenantID: "acme", TenantType: "org",
+		MaxOpenConns: 16, MaxIdleConns: 16,
+	})
+	if err != nil {
+		t.Fatalf("NewPostgresDB: %v", err)
+	}
+	t.Cleanup(func() { pdb.Close() })
+
+	ctx := context.Background()
+	l, err := NewSQLLedger(ctx, pdb)
+	if err != nil {
+		t.Fatalf("NewSQLLedger: %v", err)
+	}
+	// The tables outlive the test, and tenants and idempotency keys repeat
+	// from one test to the next.
+	if err := pdb.WriteSQL(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `TRUNCATE ledger_balances, ledger_holds, ledger_postings, ledger_entries, ledger_accounts`)
+		return err
+	}); err != nil {
+		t.Fatalf("clearing the throwaway ledger tables: %v", err)
+	}
+	return l
+}
+
+// The point of the SQL ledger: the books are where they were after a restart,
+// and opening the store again is harmless.
+func TestSQLLedger_SurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ledger.db")
+
+	l, err := NewSQLLedger(ctx, openSQLite(t, path))
+	if err != nil {
+		t.Fatalf("NewSQLLedger: %v", err)
+	}
+	paid, err := l.RecordPayment(ctx, "t1", "pi_1", 10000, "usd", "cust_1", 250)
+	if err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+	cash, _ := l.FindAccount(ctx, "t1", "platform:cash")
+	hold := &Hold{TenantID: "t1", AccountID: cash.ID, Amount: 4000, Currency: "usd"}
+	if err := l.CreateHold(ctx, hold); err != nil {
+		t.Fatalf("CreateHold: %v", err)
+	}
+
+	reopened, err := NewSQLLedger(ctx, openSQLite(t, path))
+	if err != nil {
+		t.Fatalf("NewSQLLedger again: %v", err)
+	}
+	bal, err := reopened.GetBalance(ctx, cash.ID, "usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal.PostedBalance != 10000 || bal.HeldBalance != 4000 || bal.AvailableBalance != 6000 {
+		t.Fatalf("balance after reopen: posted=%d held=%d available=%d, want 10000/4000/6000",
+			bal.PostedBalance, bal.HeldBalance, bal.AvailableBalance)
+	}
+
+	entry, err := reopened.GetEntry(ctx, paid.ID)
+	if err != nil {
+		t.Fatalf("GetEntry: %v", err)
+	}
+	if len(entry.Postings) != 3 || entry.Postings[0].AccountID != cash.ID || entry.Postings[2].Amount != -250 {
+		t.Fatalf("postings after reopen = %+v, want them as posted", entry.Postings)
+	}
+
+	if _, err := reopened.CaptureHold(ctx, hold.ID, 0); err != nil {
+		t.Fatalf("CaptureHold after reopen: %v", err)
+	}
+	if got, _ := reopened.GetHold(ctx, hold.ID); got.Status != HoldCaptured || got.CapturedEntryID == "" {
+		t.Fatalf("hold after capture = %+v", got)
+	}
+}
+
+// However many writers race one idempotency key, one entry is posted and
+// every writer gets it back.
+func TestLedger_IdempotencyUnderConcurrency(t *testing.T) {
+	forEachLedger(t, func(t *testing.T, ctx context.Context, l testLedger) {
+		cash, _, custBal := createTestAccounts(t, ctx, l, "t1")
+
+		const writers = 8
+		ids := make([]string, writers)
+		errs := make([]error, writers)
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				e := &Entry{
+					TenantID:       "t1",
+					IdempotencyKey: "race-1",
+					Postings: []Posting{
+						{AccountID: cash.ID, Amount: 700, Currency: "usd"},
+						{AccountID: custBal.ID, Amount: -700, Currency: "usd"},
+					},
+				}
+				errs[i] = l.PostEntry(ctx, e)
+				ids[i] = e.ID
+			}(i)
+		}
+		wg.Wait()
+
+		posted := 0
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				posted++
+			case !errors.Is(err, ErrDuplicateEntry):
+				t.Fatalf("writer %d: %v", i, err)
+			}
+			if ids[i] != ids[0] {
+				t.Fatalf("writer %d got entry %s, writer 0 got %s", i, ids[i], ids[0])
+			}
+		}
+		if posted != 1 {
+			t.Fatalf("%d writers posted, want exactly 1", posted)
+		}
+
+		bal, err := l.GetBalance(ctx, cash.ID, "usd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bal.PostedBalance != 700 {
+			t.Fatalf("cash posted = %d, want the entry counted once", bal.PostedBalance)
+		}
+	})
+}
@@ -6,6 +6,7 @@
 //   - which model prefixes are allowed
 //   - a daily replenishing credit allowance (the generic mechanism; the
 //     Free tier's allowance is 0, see below)
+//   - how fast its callers may hit the API (RateLimits)
 //
 // THERE IS NO FREE TIER. A zero-balance account is gated (the metering
 // client refuses when effective available balance <= 0). Onboarding funds an
@@ -17,6 +18,8 @@
 // managed by the existing billing engine.
 package tier
 
+import "time"
+
 // Name is the canonical tier identifier stored in IAM user properties.
 type Name string
 
@@ -48,6 +51,42 @@ type Config struct {
 	// AllowedModels lists the model prefixes the tier may invoke.
 	// A single entry of "*" means all models are allowed.
 	AllowedModels []string `json:"allowedModels"`
+
+	// RateLimits caps API requests per route group. A group is named by a
+	// path segment — "checkout" covers /checkout/charge, "search" both /search
+	// and /products/search — and "*" covers every route no group names. An
+	// org is rate-limited by the tier its plan is on (see middleware.RateLimit).
+	RateLimits map[string]RateLimit `json:"rateLimits"`
+}
+
+// RateLimit is how many requests fit in a window.
+type RateLimit struct {
+	// Requests is what one caller may make per window: one API key, one
+	// publishable key, one IAM user, or one client IP for a caller that is
+	// none of those.
+	Requests int `json:"requests"`
+
+	// OrgRequests is what all of an org's callers may make together per
+	// window, so a hundred keys are not a hundred times the limit. 0 leaves
+	// the org uncapped.
+	OrgRequests int `json:"orgRequests"`
+
+	WindowSeconds int `json:"windowSeconds"`
+}
+
+// Window is the period the limit counts over.
+func (l RateLimit) Window() time.Duration {
+	return time.Duration(l.WindowSeconds) * time.Second
+}
+
+// RateLimitFor is the limit on a route group, or on "*" when the tier sets
+// none for it. ok is false when the tier is not rate-limited at all.
+func (c *Config) RateLimitFor(group string) (RateLimit, bool) {
+	if l, ok := c.RateLimits[group]; ok {
+		return l, l.Requests > 0 && l.WindowSeconds > 0
+	}
+	l, ok := c.RateLimits["*"]
+	return l, ok && l.Requests > 0 && l.WindowSeconds > 0
 }
 
 // registry is the authoritative tier configuration.
@@ -60,6 +99,11 @@ var registry = map[Name]*Config{
 		// is gated. The one-time starter grant is the only onboarding funding.
 		DailyCreditsCents: 0,
 		AllowedModels:     []string{"claude-sonnet", "zen3"},
+		RateLimits: map[string]RateLimit{
+			"*":        {Requests: 120, OrgRequests: 600, WindowSeconds: 60},
+			"checkout": {Requests: 20, OrgRequests: 100, WindowSeconds: 60},
+			"search":   {Requests: 240, OrgRequests: 1200, WindowSeconds: 60},
+		},
 	},
 	Starter: {
 		Name:              Starter,
@@ -67,6 +111,11 @@ var registry = map[Name]*Config{
 		MaxAgents:         3,
 		DailyCreditsCents: 0,
 		AllowedModels:     []string{"claude-sonnet", "claude-haiku", "zen3", "zen4"},
+		RateLimits: map[string]RateLimit{
+			"*":        {Requests: 600, OrgRequests: 3000, WindowSeconds: 60},
+			"checkout": {Requests: 60, OrgRequests: 300, WindowSeconds: 60},
+			"search":   {Requests: 1200, OrgRequests: 6000, WindowSeconds: 60},
+		},
 	},
 	Pro: {
 		Name:              Pro,
@@ -74,6 +123,11 @@ var registry = map[Name]*Config{
 		MaxAgents:         10,
 		DailyCreditsCents: 0,
 		AllowedModels:     []string{"*"},
+		RateLimits: map[string]RateLimit{
+			"*":        {Requests: 2400, OrgRequests: 12000, WindowSeconds: 60},
+			"checkout": {Requests: 240, OrgRequests: 1200, WindowSeconds: 60},
+			"search":   {Requests: 4800, OrgRequests: 24000, WindowSeconds: 60},
+		},
 	},
 	Enterprise: {
 		Name:              Enterprise,
@@ -81,6 +135,13 @@ var registry = map[Name]*Config{
 		MaxAgents:         0, // 0 = unlimited
 		DailyCreditsCents: 0,
 		AllowedModels:     []string{"*"},
+		// Per caller only: an enterprise org's aggregate traffic is sized
+		// with it, not capped here.
+		RateLimits: map[string]RateLimit{
+			"*":        {Requests: 12000, WindowSeconds: 60},
+			"checkout": {Requests: 1200, WindowSeconds: 60},
+			"search":   {Requests: 24000, WindowSeconds: 60},
+		},
 	},
 }
 
@@ -2,6 +2,7 @@ package tier_test
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -86,6 +87,35 @@ var _ = Describe("Tier", func() {
 		})
 	})
 
+	Describe("RateLimitFor", func() {
+		It("returns a group's own limit, or the catch-all", func() {
+			cfg := tier.Get(tier.Free)
+			checkout, ok := cfg.RateLimitFor("checkout")
+			Expect(ok).To(BeTrue())
+			Expect(checkout.Requests).To(BeNumerically("<", cfg.RateLimits["*"].Requests))
+
+			other, ok := cfg.RateLimitFor("order")
+			Expect(ok).To(BeTrue())
+			Expect(other).To(Equal(cfg.RateLimits["*"]))
+			Expect(other.Window()).To(Equal(time.Minute))
+		})
+
+		It("gives every paid tier more room than the one below it", func() {
+			prev := 0
+			for _, n := range []tier.Name{tier.Free, tier.Starter, tier.Pro, tier.Enterprise} {
+				l, ok := tier.Get(n).RateLimitFor("*")
+				Expect(ok).To(BeTrue())
+				Expect(l.Requests).To(BeNumerically(">", prev))
+				prev = l.Requests
+			}
+		})
+
+		It("is not limited when a tier sets no limits", func() {
+			_, ok := (&tier.Config{}).RateLimitFor("checkout")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
 	Describe("All", func() {
 		It("returns all four tiers", func() {
 			all := tier.All()
@@ -0,0 +1,370 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/billing/engine"
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/cart"
+	"github.com/hanzoai/commerce/models/checkoutsession"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/payment"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	"github.com/hanzoai/commerce/models/types/accounts"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/models/types/fulfillment"
+	"github.com/hanzoai/commerce/payment/processor"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+// Complete checks out the session with id at version: it holds the cart's
+// stock, pays for it through proc, and places the order, confirming the
+// stock to it and recording the payment. proc may be nil only for a session
+// with nothing to pay.
+//
+// A payment the customer must authenticate leaves the session
+// RequiresAction, holding its stock, and returns ErrRequiresAction; once the
+// payment intent is resumed, Complete is called again and carries on from
+// it. Completing a complete session returns its order again.
+//
+// Completion is not one write, so it is made safe to repeat. The session
+// is saved naming its payment intent before the payment is taken, and the
+// order names the session: a completion that dies after the processor
+// charged is completed again (at the session's version as it is now) from
+// that intent rather than charged twice, and one that dies after the order
+// is placed finds the order by its cart (see placed). A session left with
+// an intent that never settled is reopened, the intent cancelled, when it
+// is completed again; one never completed again gives its payment back
+// when it lapses or is cancelled.
+func Complete(ctx context.Context, db *datastore.Datastore, org *organization.Organization, id string, version int, now time.Time, proc processor.PaymentProcessor) (*checkoutsession.CheckoutSession, *order.Order, error) {
+	unlock, err := lock.Hold(db, "session", id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	s, err := Get(db, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.Status == checkoutsession.Complete {
+		ord := order.New(db)
+		if err := ord.GetById(s.OrderId); err != nil {
+			return nil, nil, err
+		}
+		return s, ord, nil
+	}
+	if err := Check(s, version, now); err != nil {
+		if errors.Is(err, ErrExpired) {
+			expire(ctx, db, s)
+		}
+		return nil, nil, err
+	}
+	if !s.Reached(checkoutsession.StepPayment) {
+		return nil, nil, fmt.Errorf("%w: payment comes before completing", ErrStep)
+	}
+
+	// One cart, one order: another session on the same cart waits here, and
+	// finds the cart ordered when its turn comes.
+	unlockCart, err := lock.Hold(db, "cart", s.CartId)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlockCart()
+
+	// An order this session placed whose completion was never recorded is
+	// found by its cart, and the session completed with it.
+	if ord := placed(db, s); ord != nil {
+		finish(ctx, s, ord, now)
+		return s, ord, nil
+	}
+
+	// Until a payment is started there is nothing of this call's to undo;
+	// after, a failure gives back the payment and the stock held for it.
+	fail := func(err error) error {
+		if s.PaymentIntentId == "" {
+			return err
+		}
+		return abandon(ctx, db, s, proc, err)
+	}
+
+	car, err := Recompute(ctx, db, org, s)
+	if err != nil {
+		return nil, nil, fail(err)
+	}
+
+	// The stock is held for the cart, replacing whatever it held already,
+	// so the cart does not hold it twice and the order placed from it
+	// confirms it.
+	lines, err := allocation.Lines(db, car.Items)
+	if err != nil {
+		return nil, nil, fail(err)
+	}
+	plan, err := allocation.PlanFor(db, lines, allocation.DestinationOf(s.ShippingAddress), allocation.Options{AllowSplit: true})
+	if err != nil {
+		return nil, nil, fail(err)
+	}
+	if _, err := allocation.Reserve(db, plan, allocation.Hold{OwnerId: car.Id(), ExpiresAt: now.Add(TTL)}); err != nil {
+		return nil, nil, fail(err)
+	}
+
+	var pi *paymentintent.PaymentIntent
+	if s.Total > 0 || s.PaymentIntentId != "" {
+		if pi, err = pay(ctx, db, s, proc); err != nil {
+			if errors.Is(err, ErrRequiresAction) {
+				s.Status = checkoutsession.RequiresAction
+				s.Version++
+				s.ExpiresAt = now.Add(TTL)
+				if uerr := s.Update(); uerr != nil {
+					return nil, nil, uerr
+				}
+				return s, nil, err
+			}
+			return nil, nil, abandon(ctx, db, s, proc, err)
+		}
+	}
+
+	ord, err := place(db, s, car, pi)
+	if err != nil {
+		return nil, nil, abandon(ctx, db, s, proc, err)
+	}
+
+	// The order hook confirms a cart's hold to the order placed from it as
+	// well; confirming here keeps that true where hooks are not installed,
+	// and finds nothing left to confirm where they are.
+	if _, err := allocation.Confirm(db, car.Id(), ord.Id()); err != nil {
+		log.Error("checkout: confirm stock of cart %s to order %s: %v", car.Id(), ord.Id(), err, ctx)
+	}
+
+	car.Status = cart.Ordered
+	car.OrderId = ord.Id()
+	if err := car.Update(); err != nil {
+		log.Error("checkout: mark cart %s ordered: %v", car.Id(), err, ctx)
+	}
+
+	finish(ctx, s, ord, now)
+	return s, ord, nil
+}
+
+// finish records that s completed with ord. The order stands either way; a
+// session that failed to say so is completed again by placed on retry, so
+// the failure is logged rather than returned.
+func finish(ctx context.Context, s *checkoutsession.CheckoutSession, ord *order.Order, now time.Time) {
+	s.Status = checkoutsession.Complete
+	s.OrderId = ord.Id()
+	s.CompletedAt = now
+	s.Version++
+	if err := s.Update(); err != nil {
+		log.Error("checkout: mark session %s complete with order %s: %v", s.Id(), ord.Id(), err, ctx)
+	}
+}
+
+// placed is the order s already placed from its cart, or nil.
+func placed(db *datastore.Datastore, s *checkoutsession.CheckoutSession) *order.Order {
+	car := cart.New(db)
+	if err := car.GetById(s.CartId); err != nil || car.Status != cart.Ordered || car.OrderId == "" {
+		return nil
+	}
+	ord := order.New(db)
+	if err := ord.GetById(car.OrderId); err != nil {
+		return nil
+	}
+	if id, _ := ord.Metadata["checkoutSessionId"].(string); id != s.Id() {
+		return nil
+	}
+	return ord
+}
+
+// pay takes the session's payment: it starts a payment intent for the total,
+// saves s naming it at its next version, and confirms it through proc; or,
+// when one was started before, picks up where it is. It returns the intent
+// once it has succeeded or is authorized.
+func pay(ctx context.Context, db *datastore.Datastore, s *checkoutsession.CheckoutSession, proc processor.PaymentProcessor) (*paymentintent.PaymentIntent, error) {
+	pi := paymentintent.New(db)
+	if s.PaymentIntentId != "" {
+		if err := pi.GetById(s.PaymentIntentId); err != nil {
+			return nil, fmt.Errorf("%w: no payment intent %s", ErrPayment, s.PaymentIntentId)
+		}
+	} else {
+		// ConfirmPaymentIntent settles an intent internally, as paid, when
+		// it has no processor to charge; checkout must never do that.
+		if proc == nil || !proc.IsAvailable(ctx) {
+			return nil, ErrNoProcessor
+		}
+		var err error
+		pi, err = engine.CreatePaymentIntent(db, engine.CreatePaymentIntentParams{
+			CustomerId:      customerOf(s),
+			Amount:          int64(s.Total),
+			Currency:        s.Currency,
+			PaymentMethodId: s.PaymentMethodId,
+			Description:     "Checkout " + s.Id(),
+			ReceiptEmail:    s.Email,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.PaymentIntentId = pi.Id()
+		pi.ReturnUrl = s.ReturnUrl
+		pi.Metadata = map[string]interface{}{"checkoutSessionId": s.Id()}
+
+		// Saved before the processor is asked, so whatever becomes of
+		// this call the session knows the intent it may have paid.
+		s.Version++
+		if err := s.Update(); err != nil {
+			return pi, err
+		}
+		if err := engine.ConfirmPaymentIntent(ctx, db, pi, "", proc); err != nil {
+			return pi, fmt.Errorf("%w: %v", ErrPayment, err)
+		}
+	}
+
+	switch pi.Status {
+	case paymentintent.RequiresAction:
+		return pi, ErrRequiresAction
+	case paymentintent.Succeeded, paymentintent.RequiresCapture:
+	default:
+		return pi, fmt.Errorf("%w: payment intent is %s", ErrPayment, pi.Status)
+	}
+	if pi.Amount != int64(s.Total) {
+		return pi, fmt.Errorf("%w: paid %d, total is %d", ErrTotalChanged, pi.Amount, s.Total)
+	}
+	return pi, nil
+}
+
+// place creates the order s checks out to, and the payment record of pi
+// under it.
+func place(db *datastore.Datastore, s *checkoutsession.CheckoutSession, car *cart.Cart, pi *paymentintent.PaymentIntent) (*order.Order, error) {
+	ord := order.New(db)
+	ord.SetKey(ord.Key())
+	ord.Number = ord.NumberFromId()
+	ord.CartId = car.Id()
+	ord.StoreId = car.StoreId
+	ord.UserId = s.UserId
+	ord.Email = s.Email
+	ord.Status = order.Open
+	ord.PaymentStatus = payment.Unpaid
+	ord.Fulfillment.Status = fulfillment.Pending
+	ord.RegionId = car.RegionId
+	ord.SalesChannelId = car.SalesChannelId
+	ord.Currency = s.Currency
+	ord.Items = car.Items
+	ord.CouponCodes = s.CouponCodes
+	ord.Promotions = s.Promotions
+	ord.ShippingAddress = s.ShippingAddress
+	ord.BillingAddress = s.BillingAddress
+	ord.ShippingMethod = s.ShippingOptionId
+	ord.CustomerTaxId = car.CustomerTaxId
+	ord.TaxReverseCharge = car.TaxReverseCharge
+	ord.LineTotal = s.LineTotal
+	ord.TaxableLineTotal = s.LineTotal
+	ord.Discount = s.Discount
+	ord.Subtotal = s.Subtotal
+	ord.Shipping = s.Shipping
+	ord.ShippingDiscount = s.ShippingDiscount
+	ord.Tax = s.Tax
+	ord.TaxInclusive = s.TaxInclusive
+	ord.Total = s.Total
+	ord.Metadata = Map{"checkoutSessionId": s.Id()}
+
+	var pay *payment.Payment
+	if pi != nil {
+		ord.Metadata["paymentIntentId"] = pi.Id()
+		ord.PaymentMethodId = pi.PaymentMethodId
+
+		pay = payment.New(db)
+		pay.Parent = ord.Key()
+		pay.OrderId = ord.Id()
+		pay.UserId = ord.UserId
+		pay.Type = accounts.Type(pi.ProviderType)
+		pay.Currency = ord.Currency
+		pay.Amount = currency.Cents(pi.Amount)
+		pay.Description = ord.Description()
+		pay.Captured = pi.Status == paymentintent.Succeeded
+		pay.Metadata = Map{"paymentIntentId": pi.Id(), "checkoutSessionId": s.Id()}
+		ord.Type = pay.Type
+		if pay.Captured {
+			pay.Status = payment.Paid
+			ord.Paid = ord.Total
+			ord.PaymentStatus = payment.Paid
+		}
+		if err := pay.Create(); err != nil {
+			return nil, err
+		}
+		ord.PaymentIds = append(ord.PaymentIds, pay.Id())
+	} else {
+		ord.PaymentStatus = payment.Paid
+	}
+
+	event := "order.created"
+	if ord.PaymentStatus == payment.Paid {
+		event = "order.paid"
+	}
+	if err := ord.CreateWithEvents(ord.OutboxEvent(event)); err != nil {
+		if pay != nil {
+			if derr := pay.Delete(); derr != nil {
+				log.Error("checkout: remove payment %s of unplaced order: %v", pay.Id(), derr, db.Context)
+			}
+		}
+		return nil, err
+	}
+	return ord, nil
+}
+
+// abandon undoes what completing s did before it failed with err, puts s
+// back to open at its next version and returns err.
+func abandon(ctx context.Context, db *datastore.Datastore, s *checkoutsession.CheckoutSession, proc processor.PaymentProcessor, err error) error {
+	unpay(ctx, db, s, proc)
+	s.Status = checkoutsession.Open
+	s.Version++
+	if uerr := s.Update(); uerr != nil {
+		log.Error("checkout: reopen session %s: %v", s.Id(), uerr, ctx)
+	}
+	return err
+}
+
+// unpay gives back what s took: its payment is refunded if it went through
+// and cancelled if not, and the stock held for its cart released. s is left
+// with no payment, unsaved. Failures are logged, for the caller is failing
+// already; a hold left behind lapses, a payment left behind is on the
+// payment intent for the merchant to refund. So is one a processor took
+// when there is no proc to give it back through: recording it refunded
+// would only say so.
+func unpay(ctx context.Context, db *datastore.Datastore, s *checkoutsession.CheckoutSession, proc processor.PaymentProcessor) {
+	if s.PaymentIntentId != "" {
+		pi := paymentintent.New(db)
+		if err := pi.GetById(s.PaymentIntentId); err != nil {
+			log.Error("checkout: load payment intent %s of session %s: %v", s.PaymentIntentId, s.Id(), err, ctx)
+		} else {
+			switch pi.Status {
+			case paymentintent.Canceled:
+			case paymentintent.Succeeded:
+				if proc == nil && pi.ProviderRef != "" && pi.ProviderRef != "internal" {
+					log.Error("checkout: payment intent %s of session %s was paid through %s; refund it there", pi.Id(), s.Id(), pi.ProviderType, ctx)
+					break
+				}
+				if _, err := engine.CreateRefund(ctx, db, engine.CreateRefundParams{
+					PaymentIntentId: pi.Id(),
+					Reason:          "requested_by_customer",
+				}, proc); err != nil {
+					log.Error("checkout: refund payment intent %s of session %s: %v", pi.Id(), s.Id(), err, ctx)
+				}
+			default:
+				if err := engine.CancelPaymentIntent(ctx, pi, "checkout not completed"); err != nil {
+					log.Error("checkout: cancel payment intent %s of session %s: %v", pi.Id(), s.Id(), err, ctx)
+				}
+			}
+		}
+		s.PaymentIntentId = ""
+	}
+	if _, err := allocation.Release(db, s.CartId); err != nil {
+		log.Error("checkout: release stock of cart %s: %v", s.CartId, err, ctx)
+	}
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/checkoutsession"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	"github.com/hanzoai/commerce/models/paymentmethod"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// charger is a processor that records, at each charge, the session it is
+// charging as it is saved.
+type charger struct {
+	*processor.BaseProcessor
+	db      *datastore.Datastore
+	session string
+	charges []*checkoutsession.CheckoutSession
+}
+
+func (c *charger) Charge(context.Context, processor.PaymentRequest) (*processor.PaymentResult, error) {
+	s, err := Get(c.db, c.session)
+	if err != nil {
+		return nil, err
+	}
+	c.charges = append(c.charges, s)
+	return &processor.PaymentResult{Success: true, TransactionID: "ch_1", ProcessorRef: "ch_1", Status: "succeeded"}, nil
+}
+func (c *charger) Refund(context.Context, processor.RefundRequest) (*processor.RefundResult, error) {
+	return &processor.RefundResult{Success: true}, nil
+}
+func (c *charger) GetTransaction(context.Context, string) (*processor.Transaction, error) {
+	return &processor.Transaction{}, nil
+}
+func (c *charger) ValidateWebhook(context.Context, []byte, string) (*processor.WebhookEvent, error) {
+	return &processor.WebhookEvent{}, nil
+}
+
+// A completion that dies once the processor has charged leaves a session
+// that knows its payment; completing it again picks that payment up and
+// does not charge twice.
+func TestPay_SavesIntentBeforeCharging(t *testing.T) {
+	db := datastore.New(nscontext.WithNamespace(context.Background(), "checkout-pay-recovery"))
+
+	pm := paymentmethod.New(db)
+	pm.Type = "card"
+	pm.ProviderRef = "card_1"
+	pm.ProviderType = string(processor.Stripe)
+	if err := pm.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := checkoutsession.New(db)
+	s.Status = checkoutsession.Open
+	s.Version = 4
+	s.Email = "shopper@example.com"
+	s.Currency = currency.USD
+	s.Total = 5000
+	s.PaymentMethodId = pm.Id()
+	if err := s.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	bp := processor.NewBaseProcessor(processor.Stripe, []currency.Type{currency.USD})
+	bp.SetConfigured(true)
+	proc := &charger{BaseProcessor: bp, db: db, session: s.Id()}
+
+	pi, err := pay(context.Background(), db, s, proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proc.charges) != 1 {
+		t.Fatalf("charges = %d, want 1", len(proc.charges))
+	}
+	if saved := proc.charges[0]; saved.PaymentIntentId != pi.Id() || saved.Version != 5 {
+		t.Errorf("session at charge = intent %q version %d, want %q version 5", saved.PaymentIntentId, saved.Version, pi.Id())
+	}
+
+	// The process dies here: the order is never placed. The session is
+	// read again as the retry reads it.
+	retry, err := Get(db, s.Id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := pay(context.Background(), db, retry, proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proc.charges) != 1 {
+		t.Errorf("charges after retry = %d, want 1", len(proc.charges))
+	}
+	if again.Id() != pi.Id() || again.Status != paymentintent.Succeeded {
+		t.Errorf("retry paid with %s (%s), want %s succeeded", again.Id(), again.Status, pi.Id())
+	}
+}
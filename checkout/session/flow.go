@@ -0,0 +1,320 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment/shipping"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/cart"
+	"github.com/hanzoai/commerce/models/checkoutsession"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/paymentmethod"
+	"github.com/hanzoai/commerce/util/nscontext"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+// Get returns the session with id.
+func Get(db *datastore.Datastore, id string) (*checkoutsession.CheckoutSession, error) {
+	s := checkoutsession.New(db)
+	if err := s.GetById(id); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s, nil
+}
+
+// Start opens a session on the cart with cartId, filled in with what the
+// cart already knows of the customer.
+func Start(ctx context.Context, db *datastore.Datastore, org *organization.Organization, cartId string, now time.Time) (*checkoutsession.CheckoutSession, error) {
+	car := cart.New(db)
+	if err := car.GetById(cartId); err != nil {
+		return nil, fmt.Errorf("%w: no cart %s", ErrCart, cartId)
+	}
+
+	s := checkoutsession.New(db)
+	s.CartId = car.Id()
+	s.StoreId = car.StoreId
+	s.Step = checkoutsession.StepCart
+	s.Version = 1
+	s.ExpiresAt = now.Add(TTL)
+	s.Email = car.Email
+	s.UserId = car.UserId
+	s.ShippingAddress = car.ShippingAddress
+	s.BillingAddress = car.BillingAddress
+	s.CouponCodes = car.CouponCodes
+
+	if _, err := Recompute(ctx, db, org, s); err != nil {
+		return nil, err
+	}
+	if err := s.Create(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Recompute totals s from its cart as the steps taken so far leave it, and
+// saves the cart with them, so the cart shows what checkout charges.
+//
+// Tax is not shown before the tax step, though the cart would quote it as
+// soon as it has an address: the total a shopper sees on the address step is
+// not one they were told includes tax. Prices that include tax still do.
+func Recompute(ctx context.Context, db *datastore.Datastore, org *organization.Organization, s *checkoutsession.CheckoutSession) (*cart.Cart, error) {
+	car := cart.New(db)
+	if err := car.GetById(s.CartId); err != nil {
+		return nil, fmt.Errorf("%w: no cart %s", ErrCart, s.CartId)
+	}
+	if car.Status != cart.Active {
+		return nil, fmt.Errorf("%w: it is %s", ErrCart, car.Status)
+	}
+	if len(car.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	car.Email = s.Email
+	car.ShippingAddress = s.ShippingAddress
+	car.BillingAddress = s.BillingAddress
+	car.CouponCodes = s.CouponCodes
+
+	car.Shipping = 0
+	s.ShippingOptionName = ""
+	if s.ShippingOptionId != "" {
+		options, err := shipping.Options(ctx, db, org, car)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, o := range options {
+			if o.Id == s.ShippingOptionId {
+				car.Shipping = o.Amount
+				s.ShippingOptionName = o.Name
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrShippingOption, s.ShippingOptionId)
+		}
+	}
+
+	if err := car.Tally(); err != nil {
+		return nil, err
+	}
+
+	s.StoreId = car.StoreId
+	s.Currency = car.Currency
+	s.LineTotal = car.LineTotal
+	s.Discount = car.Discount
+	s.Subtotal = car.Subtotal
+	s.Shipping = car.Shipping
+	s.ShippingDiscount = car.ShippingDiscount
+	s.Tax = car.Tax
+	s.TaxInclusive = car.TaxInclusive
+	s.Total = car.Total
+	s.Promotions = car.Promotions
+	if !s.Reached(checkoutsession.StepTax) {
+		if !s.TaxInclusive {
+			s.Total -= s.Tax
+		}
+		s.Tax = 0
+	}
+
+	if err := car.Update(); err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+// Apply changes the session with id by fn, if it is still at version, and
+// saves it at the next version with its totals recomputed and its life
+// extended. A session found lapsed is marked so.
+func Apply(ctx context.Context, db *datastore.Datastore, org *organization.Organization, id string, version int, now time.Time, fn func(*checkoutsession.CheckoutSession) error) (*checkoutsession.CheckoutSession, error) {
+	// A version check and the write after it are not atomic in the store,
+	// so two requests at the same version would otherwise both pass it.
+	unlock, err := lock.Hold(db, "session", id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	s, err := Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := Check(s, version, now); err != nil {
+		if errors.Is(err, ErrExpired) {
+			expire(ctx, db, s)
+		}
+		return nil, err
+	}
+	if err := fn(s); err != nil {
+		return nil, err
+	}
+	if _, err := Recompute(ctx, db, org, s); err != nil {
+		return nil, err
+	}
+	s.Version++
+	s.ExpiresAt = now.Add(TTL)
+	if err := s.Update(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// expire marks s lapsed and lets go of what it was holding. Failures are
+// logged: the session is refused either way, and a hold left behind lapses
+// on its own.
+func expire(ctx context.Context, db *datastore.Datastore, s *checkoutsession.CheckoutSession) {
+	if s.PaymentIntentId != "" {
+		unpay(ctx, db, s, nil)
+	}
+	s.Status = checkoutsession.Expired
+	s.Version++
+	if err := s.Update(); err != nil {
+		log.Error("checkout: expire session %s: %v", s.Id(), err, ctx)
+	}
+}
+
+// Cancel abandons the session with id at version, giving back what it held.
+func Cancel(ctx context.Context, db *datastore.Datastore, id string, version int, now time.Time) (*checkoutsession.CheckoutSession, error) {
+	unlock, err := lock.Hold(db, "session", id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	s, err := Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Status == checkoutsession.Canceled {
+		return s, nil
+	}
+	if err := Check(s, version, now); err != nil && !errors.Is(err, ErrExpired) {
+		return nil, err
+	}
+	if s.PaymentIntentId != "" {
+		unpay(ctx, db, s, nil)
+	}
+	s.Status = checkoutsession.Canceled
+	s.Version++
+	if err := s.Update(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Customer is the customer step: who the order is for. The user, if any,
+// is the cart's; only the email is the shopper's to give.
+func Customer(email string) func(*checkoutsession.CheckoutSession) error {
+	return func(s *checkoutsession.CheckoutSession) error {
+		email = strings.TrimSpace(email)
+		if a, err := mail.ParseAddress(email); err != nil || a.Address != email {
+			return fmt.Errorf("%w: %q", ErrEmail, email)
+		}
+		if err := Take(s, checkoutsession.StepCustomer); err != nil {
+			return err
+		}
+		s.Email = email
+		return nil
+	}
+}
+
+// Addresses is the address step: where the order ships, and where it is
+// billed, which is where it ships unless given.
+func Addresses(ship, bill Address) func(*checkoutsession.CheckoutSession) error {
+	return func(s *checkoutsession.CheckoutSession) error {
+		if strings.TrimSpace(ship.Country) == "" {
+			return ErrAddress
+		}
+		if err := Take(s, checkoutsession.StepAddress); err != nil {
+			return err
+		}
+		if bill.Empty() {
+			bill = ship
+		}
+		s.ShippingAddress = ship
+		s.BillingAddress = bill
+		return nil
+	}
+}
+
+// ShippingMethod is the shipping step: the option the order ships with,
+// which must be one offered for the cart when it is recomputed.
+func ShippingMethod(optionId string) func(*checkoutsession.CheckoutSession) error {
+	return func(s *checkoutsession.CheckoutSession) error {
+		if optionId == "" {
+			return fmt.Errorf("%w: none chosen", ErrShippingOption)
+		}
+		if err := Take(s, checkoutsession.StepShipping); err != nil {
+			return err
+		}
+		s.ShippingOptionId = optionId
+		return nil
+	}
+}
+
+// QuoteTax is the tax step: the recompute after it shows the tax quoted
+// for the address and shipping chosen.
+func QuoteTax() func(*checkoutsession.CheckoutSession) error {
+	return func(s *checkoutsession.CheckoutSession) error {
+		return Take(s, checkoutsession.StepTax)
+	}
+}
+
+// Promotions is the promotions step: the coupon codes to apply. Codes that
+// do not apply are kept and take nothing off, as they are on a cart.
+func Promotions(codes []string) func(*checkoutsession.CheckoutSession) error {
+	return func(s *checkoutsession.CheckoutSession) error {
+		if err := Take(s, checkoutsession.StepPromotions); err != nil {
+			return err
+		}
+		var kept []string
+		for _, code := range codes {
+			if code = strings.TrimSpace(code); code != "" {
+				kept = append(kept, code)
+			}
+		}
+		s.CouponCodes = kept
+		return nil
+	}
+}
+
+// Payment is the payment step: the payment method to charge and, if not
+// the org's payment router, the processor to charge it through. The method
+// must be one saved for the session's customer, or for nobody.
+func Payment(db *datastore.Datastore, processorName, paymentMethodId, returnUrl string) func(*checkoutsession.CheckoutSession) error {
+	return func(s *checkoutsession.CheckoutSession) error {
+		if paymentMethodId == "" {
+			return ErrPaymentMethod
+		}
+		pm := paymentmethod.New(db)
+		if err := pm.GetById(paymentMethodId); err != nil {
+			return fmt.Errorf("%w: no payment method %s", ErrPaymentMethod, paymentMethodId)
+		}
+		if pm.CustomerId != "" && pm.CustomerId != customerOf(s) {
+			return fmt.Errorf("%w: no payment method %s", ErrPaymentMethod, paymentMethodId)
+		}
+		if err := Take(s, checkoutsession.StepPayment); err != nil {
+			return err
+		}
+		s.Processor = processorName
+		s.PaymentMethodId = paymentMethodId
+		s.ReturnUrl = returnUrl
+		return nil
+	}
+}
+
+// customerOf is who s is paid by: its user, or a guest by their email.
+func customerOf(s *checkoutsession.CheckoutSession) string {
+	if s.UserId != "" {
+		return s.UserId
+	}
+	return s.Email
+}
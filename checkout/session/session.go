@@ -0,0 +1,101 @@
+// Package session runs first-party checkout sessions (models/checkoutsession)
+// whatever processor ends up taking the money: a cart is walked through the
+// customer's email, a shipping address, a shipping method, a tax quote and
+// its promotions to a payment, and completed into an order.
+//
+// Steps are taken in order, and taking one again undoes those after it. The
+// totals are never the client's: every step recomputes them from the cart
+// through the same tally, shipping options and tax quote the cart itself is
+// shown with, so a cart changed in another tab is checked out at what it
+// costs now. Every change is made against the version it read and refused if
+// the session has moved on since; a session left alone for TTL lapses.
+//
+// Completing holds the cart's stock, takes payment, and then creates the
+// order, confirms the stock to it and records the payment. The store's
+// transactions give no isolation to lean on, so a step that fails after an
+// earlier one succeeded undoes it instead: stock is given back when payment
+// fails, and payment is refunded when the order cannot be made.
+//
+// The rules of the steps are here; flow.go and complete.go load and save
+// around them.
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/models/checkoutsession"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+)
+
+// TTL is how long a session lasts untouched. It is as long as the stock a
+// cart holds, for the same reason.
+const TTL = allocation.DefaultTTL
+
+var (
+	ErrNotFound       = errors.New("checkout: no such session")
+	ErrClosed         = errors.New("checkout: session is closed")
+	ErrExpired        = errors.New("checkout: session has expired")
+	ErrVersion        = errors.New("checkout: session was changed since it was read")
+	ErrStep           = errors.New("checkout: an earlier step has not been taken")
+	ErrPaying         = errors.New("checkout: session is being paid")
+	ErrCart           = errors.New("checkout: cart cannot be checked out")
+	ErrEmptyCart      = errors.New("checkout: cart is empty")
+	ErrEmail          = errors.New("checkout: a valid email is required")
+	ErrAddress        = errors.New("checkout: shipping address needs a country")
+	ErrShippingOption = errors.New("checkout: shipping option is not offered for the cart")
+	ErrPaymentMethod  = errors.New("checkout: a payment method is required")
+	ErrNoProcessor    = errors.New("checkout: no payment processor is available")
+	ErrPayment        = errors.New("checkout: payment failed")
+	ErrRequiresAction = errors.New("checkout: payment requires the customer to authenticate")
+	ErrTotalChanged   = errors.New("checkout: total changed after payment was started")
+)
+
+// Check reports whether s can be changed at version now: it is open, has
+// not lapsed and is still at version.
+func Check(s *checkoutsession.CheckoutSession, version int, now time.Time) error {
+	if !s.IsOpen() {
+		return fmt.Errorf("%w: %s", ErrClosed, s.Status)
+	}
+	if !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt) {
+		return ErrExpired
+	}
+	if version != s.Version {
+		return fmt.Errorf("%w: it is at version %d, not %d", ErrVersion, s.Version, version)
+	}
+	return nil
+}
+
+// Take takes step on s. The step before it must have been taken; the steps
+// after it are undone, and what they chose cleared. Nothing can be changed
+// while a payment is under way.
+func Take(s *checkoutsession.CheckoutSession, step checkoutsession.Step) error {
+	i := step.Index()
+	if i < 0 {
+		return fmt.Errorf("%w: %q is not a step", ErrStep, step)
+	}
+	if s.PaymentIntentId != "" {
+		return ErrPaying
+	}
+	if i > 0 && !s.Reached(checkoutsession.Steps[i-1]) {
+		return fmt.Errorf("%w: %s comes before %s", ErrStep, checkoutsession.Steps[i-1], step)
+	}
+	undo(s, step)
+	s.Step = step
+	return nil
+}
+
+// undo clears what the steps after step chose.
+func undo(s *checkoutsession.CheckoutSession, step checkoutsession.Step) {
+	i := step.Index()
+	if i < checkoutsession.StepShipping.Index() {
+		s.ShippingOptionId = ""
+		s.ShippingOptionName = ""
+	}
+	if i < checkoutsession.StepPayment.Index() {
+		s.Processor = ""
+		s.PaymentMethodId = ""
+		s.ReturnUrl = ""
+	}
+}
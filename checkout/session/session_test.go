@@ -0,0 +1,113 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/checkoutsession"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	s := &checkoutsession.CheckoutSession{Status: checkoutsession.Open, Version: 3, ExpiresAt: now.Add(time.Minute)}
+
+	if err := Check(s, 3, now); err != nil {
+		t.Errorf("check = %v", err)
+	}
+	if err := Check(s, 2, now); !errors.Is(err, ErrVersion) {
+		t.Errorf("stale version = %v, want ErrVersion", err)
+	}
+	if err := Check(s, 3, now.Add(2*time.Minute)); !errors.Is(err, ErrExpired) {
+		t.Errorf("lapsed = %v, want ErrExpired", err)
+	}
+
+	s.Status = checkoutsession.RequiresAction
+	if err := Check(s, 3, now); err != nil {
+		t.Errorf("requires action = %v, want open", err)
+	}
+	s.Status = checkoutsession.Complete
+	if err := Check(s, 3, now); !errors.Is(err, ErrClosed) {
+		t.Errorf("complete = %v, want ErrClosed", err)
+	}
+}
+
+func TestTake(t *testing.T) {
+	s := &checkoutsession.CheckoutSession{Step: checkoutsession.StepCart}
+
+	if err := Take(s, checkoutsession.StepShipping); !errors.Is(err, ErrStep) {
+		t.Errorf("skip = %v, want ErrStep", err)
+	}
+	for _, step := range checkoutsession.Steps[1:] {
+		if err := Take(s, step); err != nil {
+			t.Fatalf("take %s: %v", step, err)
+		}
+	}
+	if !s.Reached(checkoutsession.StepPayment) {
+		t.Fatalf("step = %s, want payment", s.Step)
+	}
+
+	s.ShippingOptionId = "ground"
+	s.PaymentMethodId = "pm"
+	if err := Take(s, checkoutsession.StepTax); err != nil {
+		t.Fatal(err)
+	}
+	if s.PaymentMethodId != "" || s.ShippingOptionId != "ground" {
+		t.Errorf("retaken tax = %+v, want payment undone and shipping kept", s)
+	}
+	if s.Reached(checkoutsession.StepPromotions) {
+		t.Errorf("promotions still reached after tax was taken again")
+	}
+
+	if err := Take(s, checkoutsession.StepAddress); err != nil {
+		t.Fatal(err)
+	}
+	if s.ShippingOptionId != "" {
+		t.Errorf("retaken address kept shipping option %q", s.ShippingOptionId)
+	}
+
+	s.PaymentIntentId = "pi"
+	if err := Take(s, checkoutsession.StepCustomer); !errors.Is(err, ErrPaying) {
+		t.Errorf("while paying = %v, want ErrPaying", err)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	s := &checkoutsession.CheckoutSession{Step: checkoutsession.StepCart}
+
+	if err := Customer("not an email")(s); !errors.Is(err, ErrEmail) {
+		t.Errorf("bad email = %v, want ErrEmail", err)
+	}
+	if err := Customer(" shopper@example.com ")(s); err != nil || s.Email != "shopper@example.com" {
+		t.Errorf("email = %q, %v", s.Email, err)
+	}
+
+	if err := Addresses(Address{City: "Nowhere"}, Address{})(s); !errors.Is(err, ErrAddress) {
+		t.Errorf("no country = %v, want ErrAddress", err)
+	}
+	ship := Address{Line1: "1 Main St", Country: "US"}
+	if err := Addresses(ship, Address{})(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.BillingAddress != ship {
+		t.Errorf("billing = %+v, want the shipping address", s.BillingAddress)
+	}
+
+	if err := ShippingMethod("")(s); !errors.Is(err, ErrShippingOption) {
+		t.Errorf("no option = %v, want ErrShippingOption", err)
+	}
+	if err := ShippingMethod("ground")(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := QuoteTax()(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := Promotions([]string{" SAVE10 ", ""})(s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.CouponCodes) != 1 || s.CouponCodes[0] != "SAVE10" {
+		t.Errorf("codes = %v, want [SAVE10]", s.CouponCodes)
+	}
+}
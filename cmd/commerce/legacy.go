@@ -13,6 +13,7 @@ import (
 
 	commerce "github.com/hanzoai/commerce"
 	api "github.com/hanzoai/commerce/api"
+	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/middleware/iammiddleware"
 )
 
@@ -68,6 +69,10 @@ func bootLegacy(dataDir, httpAddr string, dev, requireIdentity bool) error {
 	// set, and middleware.GetOrganization panics with "key organization
 	// does not exist". Pin IAMTokenRequired on the /v1 root so the
 	// header → org resolution runs for everything api.Route() registers.
+	//
+	// Audit goes first so that its request context is the one every handler
+	// below derives from, and it sees the actor whichever auth path admits.
+	apiGroup.Use(middleware.Audit())
 	apiGroup.Use(iammiddleware.IAMTokenRequired())
 	api.Route(apiGroup)
 
@@ -33,9 +33,9 @@ import (
 )
 
 func main() {
-	// One subcommand, and it is the only thing this binary does that is not
-	// serving: `commerce sweep <chain> <token> --to <addr>` moves money out of
-	// custody and exits. It is read before flag.Parse because it takes its own
+	// Subcommands are the things this binary does that are not serving.
+	// `commerce sweep <chain> <token> --to <addr>` moves money out of custody
+	// and exits. It is read before flag.Parse because it takes its own
 	// flags — a sweep has nothing to say about listen addresses.
 	//
 	// There is a cobra tree in the library (App.RootCmd, serve/admin/seed) and
@@ -49,6 +49,34 @@ func main() {
 		return
 	}
 
+	// The other: `commerce tasks <list|retry|purge>` inspects and repairs the
+	// durable task queue's dead letters. Same reasoning, same place.
+	if len(os.Args) > 1 && os.Args[1] == "tasks" {
+		if err := runTasks(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "commerce: tasks: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `commerce audit verify` checks the audit log's hash chains.
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := runAudit(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "commerce: audit: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `commerce search reindex --org name` rebuilds an org's search index.
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		if err := runSearch(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "commerce: search: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
 		dataDir         = flag.String("data", envStr("COMMERCE_DIR", "./commerce_data"), "data directory")
 		httpAddr        = flag.String("http", envStr("COMMERCE_HTTP", "127.0.0.1:8090"), "HTTP listen address")
@@ -0,0 +1,177 @@
+// Copyright (c) 2014-present Hanzo AI, Inc.
+// Licensed under MIT OR Apache-2.0. See LICENSE-MIT and LICENSE-APACHE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	commerce "github.com/hanzoai/commerce"
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/note"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/product/recommend"
+	"github.com/hanzoai/commerce/models/product/storefront"
+	"github.com/hanzoai/commerce/models/user"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/search"
+	"github.com/hanzoai/commerce/util/search/fts"
+)
+
+const searchUsage = `usage: commerce search reindex --org name
+
+  reindex  Empty the org's search indexes and index every order, user, product
+           and note in its store again, and the products its storefront can
+           see. Searches made while it runs see a partial index. Then embed
+           every product again for recommendations, and count every bought
+           order again into what was bought together.
+
+`
+
+// reindexBatch is how many models are loaded at a time.
+const reindexBatch = 500
+
+// runSearch maintains the built-in search index (package fts). Models are
+// indexed as they are written; reindex is for an index that fell behind, or
+// for an org whose data predates it.
+//
+//	commerce search reindex --org name
+func runSearch(args []string) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, searchUsage)
+		return fmt.Errorf("search needs a command: reindex")
+	}
+	cmd := args[0]
+
+	fs := flag.NewFlagSet("search "+cmd, flag.ExitOnError)
+	dataDir := fs.String("data", envStr("COMMERCE_DIR", "./commerce_data"), "data directory")
+	org := fs.String("org", "", "reindex: the org whose index to rebuild")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, searchUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if cmd != "reindex" {
+		fs.Usage()
+		return fmt.Errorf("unknown search command %q", cmd)
+	}
+	if *org == "" {
+		fs.Usage()
+		return errors.New("reindex needs --org")
+	}
+
+	cfg := commerce.DefaultConfig()
+	cfg.DataDir = *dataDir
+	app := commerce.NewWithConfig(cfg)
+	if err := app.Bootstrap(); err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown() }()
+
+	backend, ok := search.GetBackend().(*fts.Backend)
+	if !ok {
+		return fmt.Errorf("the search backend is %T, not the built-in index", search.GetBackend())
+	}
+	ix, err := backend.Open(mixin.DefaultIndex)
+	if err != nil {
+		return err
+	}
+
+	ctx := nscontext.WithNamespace(context.Background(), *org)
+	db := datastore.NewNamespaced(ctx)
+	if db.DB() == nil {
+		return fmt.Errorf("org %q has no store", *org)
+	}
+	if err := backend.Drop(ctx, mixin.DefaultIndex); err != nil {
+		return err
+	}
+
+	kinds := []struct {
+		kind    string
+		reindex func() (int, error)
+	}{
+		{"order", func() (int, error) {
+			return reindex[order.Order](ctx, ix, func() datastore.Query { return order.Query(db) })
+		}},
+		{"user", func() (int, error) {
+			return reindex[user.User](ctx, ix, func() datastore.Query { return user.Query(db) })
+		}},
+		{"product", func() (int, error) {
+			return reindex[product.Product](ctx, ix, func() datastore.Query { return product.Query(db) })
+		}},
+		{"note", func() (int, error) {
+			return reindex[note.Note](ctx, ix, func() datastore.Query { return note.Query(db) })
+		}},
+	}
+	for _, k := range kinds {
+		n, err := k.reindex()
+		if err != nil {
+			return fmt.Errorf("%s: %s after %d indexed: %w", *org, k.kind, n, err)
+		}
+		fmt.Printf("%s: %d %s(s) indexed\n", *org, n, k.kind)
+	}
+
+	if err := backend.Drop(ctx, storefront.Index); err != nil {
+		return err
+	}
+	n, err := storefront.Reindex(db)
+	if err != nil {
+		return fmt.Errorf("%s: storefront products after %d indexed: %w", *org, n, err)
+	}
+	fmt.Printf("%s: %d storefront product(s) indexed\n", *org, n)
+
+	if rec := recommend.Default(); rec != nil {
+		n, err := rec.Reindex(db)
+		if err != nil {
+			return fmt.Errorf("%s: product embeddings after %d embedded: %w", *org, n, err)
+		}
+		fmt.Printf("%s: %d product(s) embedded\n", *org, n)
+
+		switch n, err = rec.RecountOrders(db); {
+		case errors.Is(err, recommend.ErrNoSQL):
+			fmt.Printf("%s: no SQL store, bought-together counts skipped\n", *org)
+		case err != nil:
+			return fmt.Errorf("%s: bought-together counts after %d orders: %w", *org, n, err)
+		default:
+			fmt.Printf("%s: %d bought order(s) counted\n", *org, n)
+		}
+	}
+	return nil
+}
+
+// reindex puts the document of every T that query finds, a batch at a time.
+func reindex[T any](ctx context.Context, ix search.Index, query func() datastore.Query) (int, error) {
+	n := 0
+	for offset := 0; ; offset += reindexBatch {
+		var batch []*T
+		if _, err := query().Order("CreatedAt").Offset(offset).Limit(reindexBatch).GetAll(&batch); err != nil {
+			return n, err
+		}
+		for _, m := range batch {
+			s, ok := any(m).(mixin.Searchable)
+			if !ok {
+				return n, fmt.Errorf("%T is not searchable", m)
+			}
+			doc := s.Document()
+			if doc == nil || doc.Id() == "" {
+				continue
+			}
+			if _, err := ix.Put(ctx, doc.Id(), doc); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(batch) < reindexBatch {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2014-present Hanzo AI, Inc.
+// Licensed under MIT OR Apache-2.0. See LICENSE-MIT and LICENSE-APACHE.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	commerce "github.com/hanzoai/commerce"
+	"github.com/hanzoai/commerce/db"
+)
+
+const tasksUsage = `usage: commerce tasks <list|retry|purge> [flags] [task-id ...]
+
+  list    Show queued tasks. Dead-lettered ones by default; --status pending,
+          leased or all for the rest.
+  retry   Return dead-lettered tasks to the queue with their attempts reset.
+  purge   Delete dead-lettered tasks for good.
+
+retry and purge act on the task ids given, or on every dead task with --all.
+Only dead tasks are ever retried or purged: a pending or leased task is still
+the queue's to run.
+
+`
+
+// runTasks operates on the durable task queue (delay/durable.go).
+//
+// Unlike runSweep it boots with Bootstrap alone and not Embed. Embed starts the
+// background schedules, and one of them is the task poller: an operator
+// listing the dead-letter queue would otherwise have this process quietly
+// leasing and running live tasks while they read.
+//
+//	commerce tasks list [--status dead|pending|leased|all] [--limit N]
+//	commerce tasks retry <id ...> | --all
+//	commerce tasks purge <id ...> | --all
+func runTasks(args []string) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, tasksUsage)
+		return fmt.Errorf("tasks needs a command: list, retry or purge")
+	}
+	cmd := args[0]
+
+	fs := flag.NewFlagSet("tasks "+cmd, flag.ExitOnError)
+	dataDir := fs.String("data", envStr("COMMERCE_DIR", "./commerce_data"), "data directory")
+	status := fs.String("status", string(db.TaskDead), "list: dead, pending, leased or all")
+	limit := fs.Int("limit", 100, "list: most tasks to show")
+	all := fs.Bool("all", false, "retry/purge: every dead task")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, tasksUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	ids := fs.Args()
+
+	switch cmd {
+	case "list":
+	case "retry", "purge":
+		// Refused before anything boots. Naming nothing must not mean
+		// everything: --all says so on purpose.
+		if len(ids) == 0 && !*all {
+			fs.Usage()
+			return fmt.Errorf("%s needs task ids, or --all for every dead task", cmd)
+		}
+		if len(ids) > 0 && *all {
+			return fmt.Errorf("%s takes task ids or --all, not both", cmd)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown tasks command %q", cmd)
+	}
+
+	cfg := commerce.DefaultConfig()
+	cfg.DataDir = *dataDir
+	app := commerce.NewWithConfig(cfg)
+	if err := app.Bootstrap(); err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown() }()
+
+	q, err := app.TaskQueue()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch cmd {
+	case "list":
+		s := db.TaskStatus(*status)
+		if *status == "all" {
+			s = ""
+		}
+		tasks, err := q.ListTasks(ctx, s, *limit)
+		if err != nil {
+			return err
+		}
+		printTasks(tasks)
+	case "retry":
+		n, err := q.RetryDeadTasks(ctx, ids...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d dead task(s) returned to the queue\n", n)
+		if len(ids) > n {
+			fmt.Printf("%d id(s) were not dead tasks and were left alone\n", len(ids)-n)
+		}
+	case "purge":
+		n, err := q.PurgeDeadTasks(ctx, ids...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d dead task(s) purged\n", n)
+		if len(ids) > n {
+			fmt.Printf("%d id(s) were not dead tasks and were left alone\n", len(ids)-n)
+		}
+	}
+	return nil
+}
+
+func printTasks(tasks []*db.QueuedTask) {
+	if len(tasks) == 0 {
+		fmt.Println("no tasks")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFUNC\tSTATUS\tATTEMPTS\tRUN AT\tLAST ERROR")
+	for _, t := range tasks {
+		lastErr := t.LastError
+		if len(lastErr) > 80 {
+			lastErr = lastErr[:77] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\n",
+			t.ID, t.Key, t.Status, t.Attempts, t.MaxAttempts,
+			t.RunAt.UTC().Format(time.RFC3339), lastErr)
+	}
+	w.Flush()
+}
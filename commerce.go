@@ -37,7 +37,9 @@ import (
 	billingPkg "github.com/hanzoai/commerce/api/billing"
 	catalogapi "github.com/hanzoai/commerce/api/catalog"
 	currencyapi "github.com/hanzoai/commerce/api/currency"
+	jobsApi "github.com/hanzoai/commerce/api/jobs"
 	uploadApi "github.com/hanzoai/commerce/api/upload"
+	"github.com/hanzoai/commerce/audit"
 	"github.com/hanzoai/commerce/auth"
 	billingUI "github.com/hanzoai/commerce/billing"
 	"github.com/hanzoai/commerce/billing/depositledger"
@@ -48,22 +50,35 @@ import (
 	"github.com/hanzoai/commerce/db"
 	"github.com/hanzoai/commerce/delay"
 	"github.com/hanzoai/commerce/events"
+	"github.com/hanzoai/commerce/events/outbox"
 	"github.com/hanzoai/commerce/hooks"
 	"github.com/hanzoai/commerce/infra"
+	"github.com/hanzoai/commerce/lock"
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/middleware/iammiddleware"
 	"github.com/hanzoai/commerce/models/catalogentry"
 	currencymodel "github.com/hanzoai/commerce/models/currency"
+	"github.com/hanzoai/commerce/models/idempotencykey"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/order"
 	orgModel "github.com/hanzoai/commerce/models/organization"
 	planModel "github.com/hanzoai/commerce/models/plan"
+	"github.com/hanzoai/commerce/models/product/recommend"
+	"github.com/hanzoai/commerce/models/product/storefront"
 	"github.com/hanzoai/commerce/models/sbomrecord"
 	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/notify"
+	"github.com/hanzoai/commerce/ratelimit"
+	"github.com/hanzoai/commerce/scheduler"
 	commercestore "github.com/hanzoai/commerce/store"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/thirdparty/kms"
 	"github.com/hanzoai/commerce/treasury"
 	"github.com/hanzoai/commerce/types"
 	"github.com/hanzoai/commerce/ui"
 	"github.com/hanzoai/commerce/util/husd"
+	"github.com/hanzoai/commerce/util/search"
+	"github.com/hanzoai/commerce/util/search/fts"
 )
 
 // Version, GitCommit, and BuildTime are set via -ldflags at build time.
@@ -115,6 +130,16 @@ type Config struct {
 	// CORS allowed origins
 	AllowedOrigins []string
 
+	// TrustedProxies are the IPs and CIDRs of the proxies in front of
+	// commerce, whose ProxyHeader names the client. Empty believes no proxy:
+	// the client is the peer, as rate limits count it. Sourced from
+	// COMMERCE_TRUSTED_PROXIES, comma separated.
+	TrustedProxies []string
+
+	// ProxyHeader is the header the trusted proxies name the client in.
+	// Sourced from COMMERCE_PROXY_HEADER; X-Forwarded-For by default.
+	ProxyHeader string
+
 	// SharedApp, when non-nil, is the host binary's zip app — the NATIVE
 	// co-residence contract (HIP-0106): Bootstrap registers commerce's routes
 	// directly on it (one router, one specificity space) and setupRoutes
@@ -137,6 +162,31 @@ type Config struct {
 	// Query timeout
 	QueryTimeout time.Duration
 
+	// DurableTasks writes delay tasks to the system store's task queue instead
+	// of running them in goroutines that a restart loses. Sourced from
+	// COMMERCE_DURABLE_TASKS. See delay/durable.go.
+	DurableTasks bool
+
+	// OutboxSink is where the event outbox relay publishes: "pubsub" for the
+	// COMMERCE JetStream stream, or an http(s) URL. Empty runs no relay, and
+	// events wait in the outbox. Sourced from COMMERCE_OUTBOX_SINK; see
+	// outbox.go.
+	OutboxSink string
+
+	// OutboxSecret signs events posted to an http(s) OutboxSink, the way
+	// webhook deliveries are signed. Sourced from COMMERCE_OUTBOX_SECRET.
+	OutboxSecret string
+
+	// NotifySink sends notifications nowhere: a file path they are appended
+	// to as JSON lines, or "log" to log them. Every channel delivers to it
+	// instead of its provider, for development and tests. Sourced from
+	// COMMERCE_NOTIFY_SINK; see notifications.go.
+	NotifySink string
+
+	// Jobs schedules the recurring jobs: JSON, a job's name to its cron
+	// schedule and catch-up policy. Sourced from COMMERCE_JOBS; see jobs.go.
+	Jobs string
+
 	// KMS configuration for secret management
 	KMS kms.Config
 
@@ -161,10 +211,16 @@ func DefaultConfig() *Config {
 		Secret:            getEnv("COMMERCE_SECRET", "change-me-in-production"),
 		HTTPAddr:          getEnv("COMMERCE_HTTP", "127.0.0.1:8090"),
 		AllowedOrigins:    []string{"*"},
+		ProxyHeader:       getEnv("COMMERCE_PROXY_HEADER", "X-Forwarded-For"),
 		AnalyticsEndpoint: getEnv("ANALYTICS_ENDPOINT", ""),
 		DatastoreDSN:      getEnv("DATASTORE_URL", ""),
 		Infra:             *infraConfigFromEnv(),
 		QueryTimeout:      30 * time.Second,
+		DurableTasks:      getEnv("COMMERCE_DURABLE_TASKS", "false") == "true",
+		OutboxSink:        getEnv("COMMERCE_OUTBOX_SINK", ""),
+		OutboxSecret:      getEnv("COMMERCE_OUTBOX_SECRET", ""),
+		NotifySink:        getEnv("COMMERCE_NOTIFY_SINK", ""),
+		Jobs:              getEnv("COMMERCE_JOBS", ""),
 	}
 
 	cfg.KMS.Enabled = getEnv("KMS_ENABLED", "false") == "true"
@@ -187,6 +243,10 @@ func DefaultConfig() *Config {
 	}
 	cfg.IAM.JwksURI = getEnv("IAM_JWKS_URI", "")
 
+	if proxies := getEnv("COMMERCE_TRUSTED_PROXIES", ""); proxies != "" {
+		cfg.TrustedProxies = strings.Split(proxies, ",")
+	}
+
 	return cfg
 }
 
@@ -335,6 +395,30 @@ type App struct {
 	shutdownOnce sync.Once
 	shutdownCh   chan struct{}
 
+	// tasks is the system store's durable task queue, when it has one. It is
+	// set whether or not DurableTasks is on, so `commerce tasks` can still see
+	// what a previous configuration left behind.
+	tasks db.TaskQueue
+
+	// relay publishes the event outbox to OutboxSink. Nil when no sink is
+	// configured.
+	relay *outbox.Relay
+
+	// outboxScope is which org stores the relay walks (OutboxStores).
+	outboxScope outboxScope
+
+	// reservations gives back the stock of lapsed cart holds.
+	reservations *allocation.Sweeper
+
+	// notifications delivers the queued email, SMS and push of every org.
+	notifications *notify.Dispatcher
+
+	// idempotencyKeys forgets the lapsed idempotency records of every org.
+	idempotencyKeys *idempotencykey.Sweeper
+
+	// Scheduler runs the recurring jobs (jobs.go), one replica at a time.
+	Scheduler *scheduler.Scheduler
+
 	// State
 	bootstrapped bool
 	mu           sync.RWMutex
@@ -353,6 +437,10 @@ func NewWithConfig(config *Config) *App {
 		shutdownCh: make(chan struct{}),
 	}
 
+	// Model writes reach their hooks through the process registry, since the
+	// code making them does not hold the App.
+	hooks.SetDefault(app.Hooks)
+
 	// Set Gin mode
 
 	// Initialize CLI
@@ -618,6 +706,74 @@ func (app *App) Bootstrap() error {
 	commerceDatastore.SetDefaultDB(systemDB)
 	commerceQuery.SetDefaultDB(systemDB)
 
+	// Durable background tasks. The queue lives in the system store, so on
+	// Postgres every replica leases from the same table and a task queued by a
+	// pod that is being replaced is run by its successor. Fail closed when it
+	// was asked for and the store cannot provide it: an operator who turned it
+	// on is relying on tasks surviving a restart, and silently running them in
+	// goroutines would break that without telling anyone. Only the backend is
+	// set here; Serve and Embed start the poller, as with the deposit watcher.
+	app.tasks, _ = systemDB.(db.TaskQueue)
+	if app.config.DurableTasks {
+		if app.tasks == nil {
+			return fmt.Errorf("commerce: COMMERCE_DURABLE_TASKS is set but the system store %T cannot queue tasks", systemDB)
+		}
+		delay.SetBackend(app.tasks)
+	}
+
+	// The audit log lives in the system store too, beyond the reach of the
+	// orgs it records. A store without one leaves recording off, said once.
+	if auditStore, ok := systemDB.(db.AuditLog); ok {
+		audit.SetStore(auditStore)
+		audit.Install(app.Hooks)
+	} else {
+		fmt.Printf("Commerce: system store %T has no audit log; audit recording is off\n", systemDB)
+	}
+
+	// Stock reservations follow the carts and orders they hold stock for.
+	// Lapsed holds are the sweeper's, which starts with the poller.
+	allocation.Install(app.Hooks)
+	app.reservations = allocation.NewSweeper(app.orgNamespaces)
+
+	// Notifications are queued by whoever creates them and delivered by the
+	// dispatcher, which also starts with the poller.
+	if app.config.NotifySink != "" {
+		notify.UseSink(app.config.NotifySink)
+	}
+	app.notifications = notify.NewDispatcher(app.orgs)
+
+	// The responses TokenRequired keeps for Idempotency-Key retries lapse
+	// after a day; the sweeper deletes them. Serve starts it.
+	app.idempotencyKeys = idempotencykey.NewSweeper(app.orgNamespaces)
+
+	// Search is the built-in full-text index, kept in each org's own store,
+	// unless an embedder set a backend of its own before Bootstrap. Either
+	// way searchable models are indexed once their writes commit, by the
+	// after-commit hooks alone; BaseModel's synchronous PutDocument is left
+	// unconfigured so a write is not indexed twice.
+	if search.GetBackend() == nil {
+		search.SetBackend(fts.New())
+	}
+	fts.Install(app.Hooks)
+	// The storefront's product index, in the same backend.
+	storefront.Install(app.Hooks)
+
+	// Recommendations embed products into each org's vector store, with the
+	// hashing embedder unless an embedder set a recommender of its own.
+	if recommend.Default() == nil {
+		recommend.SetDefault(recommend.New(recommend.HashingEmbedder{Dimensions: dbConfig.VectorDimensions}))
+	}
+	recommend.Default().Install(app.Hooks)
+
+	// Paid, refunded and cancelled orders are committed, refunded and voided
+	// with the tax provider that taxed them. Providers other than the built-in
+	// rules are registered with tax.Register before Bootstrap.
+	order.InstallTax(app.Hooks)
+
+	// Customers' tax numbers are checked, and verified by whatever registry
+	// was set with taxid.RegisterVerifier, as they are saved.
+	taxid.Install(app.Hooks, "company", "user", "cart")
+
 	// Route the generic REST merchant datastore (product/order/store/customer/
 	// collection/discount/variant/…) to per-org SQLite via db.Manager.Org(<caller
 	// org>). systemDB above remains the store for global kinds (organization/user/
@@ -724,6 +880,12 @@ func (app *App) Bootstrap() error {
 	}
 	app.CommerceStore = cStore
 
+	// Rate limits count an anonymous caller by the client IP, read through
+	// the proxies in front of commerce and no others.
+	if err := middleware.SetTrustedProxies(app.config.ProxyHeader, app.config.TrustedProxies); err != nil {
+		return fmt.Errorf("commerce: invalid COMMERCE_TRUSTED_PROXIES: %w", err)
+	}
+
 	// Initialize infrastructure manager. Attach the base-backed KV client
 	// (sharing the commerce store) before Connect so Connect reuses it.
 	app.Infra = infra.New(&app.config.Infra)
@@ -744,6 +906,15 @@ func (app *App) Bootstrap() error {
 			kvc = infra.NewKVClientFromStore(&app.config.Infra.KV, cStore)
 		}
 		app.Infra.SetKV(kvc)
+
+		// API rate limits count in the same KV, so replicas sharing an
+		// external KV share the counts. An org's limits are its plan tier's.
+		middleware.SetRateLimiter(ratelimit.New(kvc))
+		middleware.SetRateLimitTier(billingPkg.OrgTier)
+
+		// The locks that serialise an order's refunds, a session's
+		// completion and a level's reservations are held there too.
+		lock.SetStore(kvc)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), app.config.Infra.ConnectTimeout)
 	defer cancel()
@@ -829,6 +1000,26 @@ func (app *App) Bootstrap() error {
 		fmt.Println("Commerce event publisher initialized (NATS/JetStream)")
 	}
 
+	// The outbox relay is built here and started where the deposit watcher
+	// and task poller are, so the one-shot cmd/ tools never publish.
+	relay, err := app.newOutboxRelay()
+	if err != nil {
+		return err
+	}
+	app.relay = relay
+
+	// So is the scheduler, which bills customers and must not run in a tool.
+	sched, err := app.newScheduler()
+	if err != nil {
+		return err
+	}
+	app.Scheduler = sched
+	jobsApi.SetScheduler(sched)
+
+	// The notification dispatcher is elected as the jobs are, so replicas
+	// do not all scan every org's queue.
+	app.notifications.Locker = &jobLocker{app.Infra}
+
 	// Initialize router — native zip (zap-proto/fiber): zero net/http
 	// adaptation. Co-resident mode registers on the host's shared app; the
 	// host owns Recover/logging for its whole surface.
@@ -1071,6 +1262,7 @@ func (app *App) setupRoutes() {
 		// Core middleware required by Commerce API handlers
 		api.Use(middleware.AddHost())
 		api.Use(middleware.RequestContext())
+		api.Use(middleware.Audit())
 		api.Use(middleware.DetectOverrides())
 		api.Use(middleware.ErrorHandlerJSON())
 		api.Use(middleware.AccessControl("*"))
@@ -1083,6 +1275,15 @@ func (app *App) setupRoutes() {
 			api.Use(iammiddleware.IAMTokenRequired())
 		}
 
+		// Rate-limit callers with no credential by client IP. Credentialed
+		// callers are limited by TokenRequired, per key and per org, once
+		// it has verified them.
+		api.Use(middleware.RateLimit())
+
+		// Guard Idempotency-Key retries on the routes that know their org
+		// already (IAM callers); TokenRequired guards the rest.
+		api.Use(middleware.Idempotency())
+
 		// Default cache policy: private, no-store for all API routes.
 		// Individual route groups or handlers may override with CachePublic().
 		api.Use(middleware.CachePrivate())
@@ -1225,6 +1426,10 @@ func (app *App) setupRoutes() {
 		api.Get("/deposits", billingPkg.DepositWatcherStatus)
 	}
 
+	// The payment router's live outcomes and breakers — why traffic moved.
+	// Same audience and same rules as /deposits.
+	api.Get("/payments/router", billingPkg.PaymentRouterStats)
+
 	// SPA fallback — the least-specific catch-all; standalone only. A host
 	// binary owns its own root surface.
 	if !embedded {
@@ -1245,6 +1450,29 @@ func (app *App) Serve() error {
 	// asset is configured. Shutdown stops it.
 	depositledger.Default().Start()
 
+	// Webhooks stored before Enabled was read are turned on before the task
+	// poller can make a delivery to them.
+	app.upgradeWebhooks(context.Background())
+
+	// Run durable tasks, including any a previous process queued and did not
+	// get to. A no-op unless Bootstrap set a backend.
+	delay.Start()
+
+	// Publish the event outbox. A no-op without COMMERCE_OUTBOX_SINK.
+	app.startOutboxRelay()
+
+	// Give back the stock of carts that stopped checking out.
+	app.startReservationSweeper()
+
+	// Deliver queued notifications.
+	app.startNotificationDispatcher()
+
+	// Forget the responses kept for Idempotency-Key retries once they lapse.
+	app.startIdempotencySweeper()
+
+	// Run the recurring jobs on their schedules.
+	app.startScheduler()
+
 	// Trigger OnServe hooks
 	if err := app.Hooks.TriggerServe(app); err != nil {
 		return fmt.Errorf("serve hook error: %w", err)
@@ -1301,11 +1529,46 @@ func (app *App) Shutdown() error {
 		}
 		cancelDrain()
 
+		// The store the durable queue writes to closes below. A task queued
+		// after this point runs in-process rather than failing to write.
+		if app.config.DurableTasks {
+			delay.SetBackend(nil)
+		}
+
 		// Stop the crypto deposit watcher before the database closes: a pass in
 		// flight is holding the ledger open, and a half-written credit is the one
 		// thing this rail must never produce.
 		depositledger.Default().Stop()
 
+		// The relay leases from the same stores. An event it was publishing
+		// when stopped stays in the outbox and goes out on the next start.
+		if app.relay != nil {
+			app.relay.Stop()
+		}
+
+		// A hold the sweeper was releasing when stopped is released by the
+		// next pass after a start.
+		if app.reservations != nil {
+			app.reservations.Stop()
+		}
+
+		// A notification being sent when stopped is recorded before Stop
+		// returns; the rest wait, pending, for the next start.
+		if app.notifications != nil {
+			app.notifications.Stop()
+		}
+
+		// A sweep stopped part way deletes the rest next time.
+		if app.idempotencyKeys != nil {
+			app.idempotencyKeys.Stop()
+		}
+
+		// A job stopped part way is recorded as failed, and its next slot
+		// runs it again.
+		if app.Scheduler != nil {
+			app.Scheduler.Stop()
+		}
+
 		// Stop ZAP node
 		if app.ZAP != nil {
 			app.ZAP.Stop()
@@ -1336,6 +1599,20 @@ func (app *App) Shutdown() error {
 	return err
 }
 
+// TaskQueue returns the system store's durable task queue, or an error when the
+// store has none. It is what `commerce tasks` operates on.
+func (app *App) TaskQueue() (db.TaskQueue, error) {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	if !app.bootstrapped {
+		return nil, fmt.Errorf("commerce: not bootstrapped")
+	}
+	if app.tasks == nil {
+		return nil, fmt.Errorf("commerce: the system store cannot queue tasks")
+	}
+	return app.tasks, nil
+}
+
 // Config returns the current configuration
 func (app *App) Config() *Config {
 	return app.config
@@ -13,6 +13,7 @@ import (
 	"github.com/hanzoai/commerce/datastore/query"
 	"github.com/hanzoai/commerce/datastore/utils"
 	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/hooks"
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/util/nscontext"
 )
@@ -62,6 +63,9 @@ type Datastore struct {
 	database            db.DB
 	namespace           string
 	allocateCounter     int64
+
+	// outbox holds events staged by WithOutbox for the next Put.
+	outbox []*db.OutboxMessage
 }
 
 // SetDefaultDB sets the global default database used by New() when no explicit db.DB is provided.
@@ -229,11 +233,20 @@ func (d *Datastore) RunInTransaction(fn func(db *Datastore) error, opts *Transac
 }
 
 // RunInTransaction runs a function within a transaction
+//
+// The body runs under a commit scope (hooks.BeginCommit), so model After
+// hooks fired by writes made through ds wait until fn has returned. They run
+// whether or not it failed: the body is not a real transaction, and a write
+// it made before failing stayed written, so its hooks — an index update, an
+// audit entry — are owed just the same.
 func RunInTransaction(ctx context.Context, fn func(db *Datastore) error, opts *TransactionOptions) error {
 	// For now, just run the function directly
 	// The proper implementation would use db.DB.RunInTransaction
+	ctx, end := hooks.BeginCommit(ctx)
 	ds := New(ctx)
-	return fn(ds)
+	err := fn(ds)
+	end(true)
+	return err
 }
 
 // toDBKey converts a Key to db.Key
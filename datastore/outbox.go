@@ -0,0 +1,59 @@
+package datastore
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// WithOutbox returns a copy of this datastore whose next Put also appends msgs
+// to the store's outbox, in the same transaction as the entity (see
+// db.Outbox). The copy is for that one write: the Put consumes the messages,
+// and later Puts through it are plain again.
+//
+// It is a copy so that the staging cannot leak. The datastore a request holds
+// is shared by every model built on it; staging events on it directly would
+// hand them to whichever of those models happened to write next.
+//
+// A store without an outbox refuses the write rather than making it without
+// its events. The caller asked for the two together, and an entity whose
+// events were silently dropped is the failure the outbox exists to prevent.
+func (d *Datastore) WithOutbox(msgs ...*db.OutboxMessage) *Datastore {
+	c := *d
+	c.outbox = append([]*db.OutboxMessage(nil), msgs...)
+	return &c
+}
+
+// OutboxPending reports whether events staged by WithOutbox have not been
+// written yet.
+func (d *Datastore) OutboxPending() bool {
+	return len(d.outbox) > 0
+}
+
+func (d *Datastore) putWithOutbox(k db.Key, val interface{}) (db.Key, error) {
+	o, ok := d.database.(db.Outbox)
+	if !ok {
+		return nil, fmt.Errorf("datastore: store %T has no outbox; refusing to write %s without its events", d.database, k.Kind())
+	}
+	resultKey, err := o.PutWithOutbox(d.Context, k, val, d.outbox...)
+	if err != nil {
+		return nil, err
+	}
+	d.outbox = nil
+	if fn := outboxNotify.Load(); fn != nil {
+		(*fn)(nscontext.GetNamespace(d.Context))
+	}
+	return resultKey, nil
+}
+
+var outboxNotify atomic.Pointer[func(namespace string)]
+
+// SetOutboxNotify has fn told the namespace of every write that carried
+// events, once it is committed: the empty namespace for the shared store, an
+// org's for its own. The relay learns from it which stores have events
+// waiting without opening every org's to look.
+func SetOutboxNotify(fn func(namespace string)) {
+	outboxNotify.Store(&fn)
+}
@@ -41,7 +41,13 @@ func (d *Datastore) Put(keyOrKind interface{}, val interface{}) (*key.DatastoreK
 	dskey := convertKeyOrKind(d, keyOrKind)
 	dbKey := dskey.ToDBKey(d.database)
 
-	resultKey, err := d.database.Put(d.Context, dbKey, val)
+	var resultKey db.Key
+	var err error
+	if len(d.outbox) > 0 {
+		resultKey, err = d.putWithOutbox(dbKey, val)
+	} else {
+		resultKey, err = d.database.Put(d.Context, dbKey, val)
+	}
 	if err != nil {
 		d.warn("Unable to put (%v, %#v): %v", dskey, val, err, d.Context)
 		return nil, err
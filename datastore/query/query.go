@@ -394,6 +394,8 @@ func (q *Query) ById(id string, dst interface{}) (iface.Key, bool, error) {
 		"gift-card", "gift-card-redemption", "exchange", "idempotency-key",
 		"product-option", "product-option-value", "product-category",
 		"product-tag", "product-type", "return-reason", "refund-reason",
+		"webhook-delivery", "checkout-session", "notificationtemplate",
+		"notificationpreference", "roleassignment", "jobrun", "promotion-redemption",
 		// Commerce paywall invite (WithStringKey deterministic id, code-indexed).
 		"commerce-invite":
 		// These kinds are always identified by hashid-encoded keys only.
@@ -0,0 +1,28 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hanzoai/commerce/hooks"
+)
+
+// A body that fails after a write still owes that write's After hooks: the
+// body is not a real transaction, so the write stayed.
+func TestRunInTransaction_FailedBodyRunsHooks(t *testing.T) {
+	var ran []string
+	err := RunInTransaction(context.Background(), func(ds *Datastore) error {
+		hooks.AfterCommit(ds.Context, func() { ran = append(ran, "written") })
+		if len(ran) != 0 {
+			t.Fatal("hook ran inside the body")
+		}
+		return errors.New("later step failed")
+	}, nil)
+	if err == nil {
+		t.Fatal("the body's error was swallowed")
+	}
+	if len(ran) != 1 {
+		t.Fatalf("ran = %v, want the written entity's hook", ran)
+	}
+}
@@ -0,0 +1,341 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// auditDDL is the ONE definition of the audit log, identical in shape on both
+// backends like the task queue and the outbox. It lives in the system store:
+// an org's own store is the org's to write, and a log its subject can rewrite
+// records nothing.
+//
+// The primary key is (org, seq), so a chain can have neither a gap filled nor a
+// link written twice, whatever the caller does.
+const auditDDL = `CREATE TABLE IF NOT EXISTS _audit (
+		org TEXT NOT NULL,
+		seq BIGINT NOT NULL,
+		id TEXT NOT NULL,
+		at BIGINT NOT NULL,
+		actor_type TEXT NOT NULL DEFAULT '',
+		actor_id TEXT NOT NULL DEFAULT '',
+		method TEXT NOT NULL DEFAULT '',
+		route TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		resource_kind TEXT NOT NULL DEFAULT '',
+		resource_id TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		request_id TEXT NOT NULL DEFAULT '',
+		diff BYTEA NOT NULL,
+		prev_hash TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		PRIMARY KEY (org, seq)
+	)`
+
+const auditResourceIndexDDL = `CREATE INDEX IF NOT EXISTS idx_audit_resource ON _audit(org, resource_kind, resource_id)`
+
+// auditHeadsDDL holds each chain's newest link. Appending reads and moves it in
+// the transaction that writes the record, so it is also the lock that puts two
+// writers to one org's chain in order.
+const auditHeadsDDL = `CREATE TABLE IF NOT EXISTS _audit_heads (
+		org TEXT PRIMARY KEY,
+		seq BIGINT NOT NULL,
+		hash TEXT NOT NULL
+	)`
+
+const auditColumns = `id, org, seq, at, actor_type, actor_id, method, route, status,
+	resource_kind, resource_id, action, request_id, diff, prev_hash, hash`
+
+// sqlAudit is the audit log over one database/sql handle, on the task queue's
+// handle, lock and placeholder rewriting.
+type sqlAudit struct {
+	sqlTaskQueue
+}
+
+func scanAudit(rows *sql.Rows) ([]*AuditRecord, error) {
+	defer rows.Close()
+
+	var out []*AuditRecord
+	for rows.Next() {
+		var (
+			r       AuditRecord
+			seq, at int64
+		)
+		if err := rows.Scan(&r.ID, &r.Org, &seq, &at, &r.ActorType, &r.ActorID,
+			&r.Method, &r.Route, &r.Status, &r.ResourceKind, &r.ResourceID,
+			&r.Action, &r.RequestID, &r.Diff, &r.PrevHash, &r.Hash); err != nil {
+			return nil, err
+		}
+		r.Seq = uint64(seq)
+		r.At = fromMillis(at)
+		out = append(out, &r)
+	}
+	return out, rows.Err()
+}
+
+// appendRecord links rec onto its org's chain. The head row is created if the
+// chain is new and then read under lock — FOR UPDATE on Postgres, writeMu on
+// SQLite — so a second writer waits for this one to commit and then links
+// onto its record, never onto the same predecessor.
+func (q sqlAudit) appendRecord(ctx context.Context, rec *AuditRecord, seal func(*AuditRecord) error) error {
+	if rec.Org == "" || rec.Action == "" {
+		return fmt.Errorf("db: audit record needs an org and an action")
+	}
+
+	unlock := q.lock()
+	defer unlock()
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q.bind(`
+		INSERT INTO _audit_heads (org, seq, hash) VALUES (?, 0, '')
+		ON CONFLICT (org) DO NOTHING
+	`), rec.Org); err != nil {
+		return fmt.Errorf("db: audit head for %s: %w", rec.Org, err)
+	}
+
+	forUpdate := ""
+	if q.postgres {
+		forUpdate = " FOR UPDATE"
+	}
+	var seq int64
+	var prev string
+	if err := tx.QueryRowContext(ctx, q.bind(`SELECT seq, hash FROM _audit_heads WHERE org = ?`+forUpdate),
+		rec.Org).Scan(&seq, &prev); err != nil {
+		return fmt.Errorf("db: audit head for %s: %w", rec.Org, err)
+	}
+
+	rec.ID = newTaskToken("aud_")
+	rec.Seq = uint64(seq + 1)
+	rec.PrevHash = prev
+	if rec.At.IsZero() {
+		rec.At = time.Now()
+	}
+	if rec.Diff == nil {
+		rec.Diff = []byte("null")
+	}
+	if err := seal(rec); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, q.bind(`
+		INSERT INTO _audit (`+auditColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`), rec.ID, rec.Org, seq+1, millis(rec.At), rec.ActorType, rec.ActorID,
+		rec.Method, rec.Route, rec.Status, rec.ResourceKind, rec.ResourceID,
+		rec.Action, rec.RequestID, rec.Diff, rec.PrevHash, rec.Hash); err != nil {
+		return fmt.Errorf("db: write audit record: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, q.bind(`UPDATE _audit_heads SET seq = ?, hash = ? WHERE org = ?`),
+		seq+1, rec.Hash, rec.Org); err != nil {
+		return fmt.Errorf("db: move audit head for %s: %w", rec.Org, err)
+	}
+
+	return tx.Commit()
+}
+
+func (q sqlAudit) list(ctx context.Context, f AuditFilter) ([]*AuditRecord, error) {
+	if f.Org == "" {
+		return nil, fmt.Errorf("db: audit query needs an org")
+	}
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+
+	where := []string{"org = ?"}
+	args := []interface{}{f.Org}
+	add := func(clause string, arg interface{}) {
+		where = append(where, clause)
+		args = append(args, arg)
+	}
+	if f.ActorID != "" {
+		add("actor_id = ?", f.ActorID)
+	}
+	if f.ResourceKind != "" {
+		add("resource_kind = ?", f.ResourceKind)
+	}
+	if f.ResourceID != "" {
+		add("resource_id = ?", f.ResourceID)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if !f.Since.IsZero() {
+		add("at >= ?", millis(f.Since))
+	}
+	if !f.Until.IsZero() {
+		add("at < ?", millis(f.Until))
+	}
+	if f.Before > 0 {
+		add("seq < ?", int64(f.Before))
+	}
+	args = append(args, f.Limit)
+
+	rows, err := q.db.QueryContext(ctx, q.bind(`SELECT `+auditColumns+` FROM _audit
+		WHERE `+strings.Join(where, " AND ")+` ORDER BY seq DESC LIMIT ?`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("db: list audit: %w", err)
+	}
+	return scanAudit(rows)
+}
+
+func (q sqlAudit) scan(ctx context.Context, org string, afterSeq uint64, n int) ([]*AuditRecord, error) {
+	if n <= 0 {
+		n = 500
+	}
+	rows, err := q.db.QueryContext(ctx, q.bind(`SELECT `+auditColumns+` FROM _audit
+		WHERE org = ? AND seq > ? ORDER BY seq LIMIT ?`), org, int64(afterSeq), n)
+	if err != nil {
+		return nil, fmt.Errorf("db: scan audit: %w", err)
+	}
+	return scanAudit(rows)
+}
+
+func (q sqlAudit) head(ctx context.Context, org string) (uint64, string, error) {
+	var seq int64
+	var hash string
+	err := q.db.QueryRowContext(ctx, q.bind(`SELECT seq, hash FROM _audit_heads WHERE org = ?`), org).Scan(&seq, &hash)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("db: audit head for %s: %w", org, err)
+	}
+	return uint64(seq), hash, nil
+}
+
+func (q sqlAudit) orgs(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT org FROM _audit_heads ORDER BY org`)
+	if err != nil {
+		return nil, fmt.Errorf("db: list audit orgs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var org string
+		if err := rows.Scan(&org); err != nil {
+			return nil, err
+		}
+		out = append(out, org)
+	}
+	return out, rows.Err()
+}
+
+// SQLite: appends go to the writer pool under writeMu.
+
+func (db *SQLiteDB) audit() sqlAudit {
+	return sqlAudit{db.tasks()}
+}
+
+func (db *SQLiteDB) AppendAudit(ctx context.Context, rec *AuditRecord, seal func(*AuditRecord) error) error {
+	return db.audit().appendRecord(ctx, rec, seal)
+}
+
+func (db *SQLiteDB) ListAudit(ctx context.Context, f AuditFilter) ([]*AuditRecord, error) {
+	return db.audit().list(ctx, f)
+}
+
+func (db *SQLiteDB) ScanAudit(ctx context.Context, org string, afterSeq uint64, n int) ([]*AuditRecord, error) {
+	return db.audit().scan(ctx, org, afterSeq, n)
+}
+
+func (db *SQLiteDB) AuditHead(ctx context.Context, org string) (uint64, string, error) {
+	return db.audit().head(ctx, org)
+}
+
+func (db *SQLiteDB) AuditOrgs(ctx context.Context) ([]string, error) {
+	return db.audit().orgs(ctx)
+}
+
+// Postgres: the head row lock is what orders two replicas appending to one
+// org's chain.
+
+func (db *PostgresDB) audit() sqlAudit {
+	return sqlAudit{db.tasks()}
+}
+
+func (db *PostgresDB) AppendAudit(ctx context.Context, rec *AuditRecord, seal func(*AuditRecord) error) error {
+	return db.audit().appendRecord(ctx, rec, seal)
+}
+
+func (db *PostgresDB) ListAudit(ctx context.Context, f AuditFilter) ([]*AuditRecord, error) {
+	return db.audit().list(ctx, f)
+}
+
+func (db *PostgresDB) ScanAudit(ctx context.Context, org string, afterSeq uint64, n int) ([]*AuditRecord, error) {
+	return db.audit().scan(ctx, org, afterSeq, n)
+}
+
+func (db *PostgresDB) AuditHead(ctx context.Context, org string) (uint64, string, error) {
+	return db.audit().head(ctx, org)
+}
+
+func (db *PostgresDB) AuditOrgs(ctx context.Context) ([]string, error) {
+	return db.audit().orgs(ctx)
+}
+
+// tenantDB forwards the audit log like the outbox, so the system store works
+// whether it was opened as a Postgres pool or as the "system" tenant of the
+// SQLite manager. Each call borrows the store once.
+
+func (d tenantDB) withAudit(ctx context.Context, fn func(AuditLog) error) error {
+	return d.do(ctx, func(db DB) error {
+		a, ok := db.(AuditLog)
+		if !ok {
+			return fmt.Errorf("db: tenant store %T has no audit log", db)
+		}
+		return fn(a)
+	})
+}
+
+func (d tenantDB) AppendAudit(ctx context.Context, rec *AuditRecord, seal func(*AuditRecord) error) error {
+	return d.withAudit(ctx, func(a AuditLog) error { return a.AppendAudit(ctx, rec, seal) })
+}
+
+func (d tenantDB) ListAudit(ctx context.Context, f AuditFilter) ([]*AuditRecord, error) {
+	var out []*AuditRecord
+	err := d.withAudit(ctx, func(a AuditLog) (err error) {
+		out, err = a.ListAudit(ctx, f)
+		return err
+	})
+	return out, err
+}
+
+func (d tenantDB) ScanAudit(ctx context.Context, org string, afterSeq uint64, n int) ([]*AuditRecord, error) {
+	var out []*AuditRecord
+	err := d.withAudit(ctx, func(a AuditLog) (err error) {
+		out, err = a.ScanAudit(ctx, org, afterSeq, n)
+		return err
+	})
+	return out, err
+}
+
+func (d tenantDB) AuditHead(ctx context.Context, org string) (uint64, string, error) {
+	var (
+		seq  uint64
+		hash string
+	)
+	err := d.withAudit(ctx, func(a AuditLog) (err error) {
+		seq, hash, err = a.AuditHead(ctx, org)
+		return err
+	})
+	return seq, hash, err
+}
+
+func (d tenantDB) AuditOrgs(ctx context.Context) ([]string, error) {
+	var out []string
+	err := d.withAudit(ctx, func(a AuditLog) (err error) {
+		out, err = a.AuditOrgs(ctx)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// The audit log's store promises that each org's records form one unbroken
+// chain — consecutive seqs, each linked to the hash before it — and that
+// queries page through them newest first. The hashing itself is the audit
+// package's; here seal just names the link.
+
+func appendAudit(t *testing.T, a AuditLog, org, kind, id, action string) *AuditRecord {
+	t.Helper()
+	rec := &AuditRecord{Org: org, ActorType: "iam", ActorID: "usr_1", ResourceKind: kind, ResourceID: id, Action: action}
+	if err := a.AppendAudit(context.Background(), rec, func(r *AuditRecord) error {
+		r.Hash = fmt.Sprintf("%s/%d", r.Org, r.Seq)
+		return nil
+	}); err != nil {
+		t.Fatalf("AppendAudit: %v", err)
+	}
+	return rec
+}
+
+func TestAudit_ChainsPerOrg(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+
+	a1 := appendAudit(t, sdb, "acme", "order", "ord_1", "order.update")
+	b1 := appendAudit(t, sdb, "globex", "order", "ord_9", "order.update")
+	a2 := appendAudit(t, sdb, "acme", "refund", "rf_1", "refund.create")
+
+	if a1.Seq != 1 || a1.PrevHash != "" || a2.Seq != 2 || a2.PrevHash != "acme/1" {
+		t.Fatalf("acme chain = %+v, %+v", a1, a2)
+	}
+	if b1.Seq != 1 || b1.PrevHash != "" {
+		t.Fatalf("globex chain = %+v", b1)
+	}
+	if seq, hash, err := sdb.AuditHead(ctx, "acme"); err != nil || seq != 2 || hash != "acme/2" {
+		t.Fatalf("acme head = %d %q %v", seq, hash, err)
+	}
+	if orgs, _ := sdb.AuditOrgs(ctx); len(orgs) != 2 || orgs[0] != "acme" || orgs[1] != "globex" {
+		t.Fatalf("orgs = %v", orgs)
+	}
+
+	// A seal that fails writes nothing and leaves the head where it was.
+	err := sdb.AppendAudit(ctx, &AuditRecord{Org: "acme", Action: "x"}, func(*AuditRecord) error {
+		return errors.New("no key")
+	})
+	if err == nil {
+		t.Fatal("a failed seal was written")
+	}
+	if seq, _, _ := sdb.AuditHead(ctx, "acme"); seq != 2 {
+		t.Fatalf("head moved to %d after a failed seal", seq)
+	}
+
+	recs, err := sdb.ScanAudit(ctx, "acme", 0, 10)
+	if err != nil || len(recs) != 2 || recs[0].ID != a1.ID || recs[1].ID != a2.ID {
+		t.Fatalf("scan = %+v, %v", recs, err)
+	}
+}
+
+func TestAudit_ListFiltersAndPages(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		appendAudit(t, sdb, "acme", "order", fmt.Sprintf("ord_%d", i%2), "order.update")
+	}
+	appendAudit(t, sdb, "acme", "refund", "rf_1", "refund.create")
+
+	page, err := sdb.ListAudit(ctx, AuditFilter{Org: "acme", ResourceKind: "order", Limit: 2})
+	if err != nil || len(page) != 2 || page[0].Seq != 5 || page[1].Seq != 4 {
+		t.Fatalf("first page = %+v, %v", page, err)
+	}
+	next, err := sdb.ListAudit(ctx, AuditFilter{Org: "acme", ResourceKind: "order", Limit: 2, Before: page[1].Seq})
+	if err != nil || len(next) != 2 || next[0].Seq != 3 || next[1].Seq != 2 {
+		t.Fatalf("second page = %+v, %v", next, err)
+	}
+
+	one, _ := sdb.ListAudit(ctx, AuditFilter{Org: "acme", ResourceKind: "order", ResourceID: "ord_1"})
+	if len(one) != 2 {
+		t.Fatalf("ord_1 has %d records, want 2", len(one))
+	}
+	if _, err := sdb.ListAudit(ctx, AuditFilter{}); err == nil {
+		t.Fatal("a query without an org was accepted")
+	}
+}
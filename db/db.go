@@ -513,6 +513,246 @@ const sequenceDDL = `CREATE TABLE IF NOT EXISTS _sequences (
 		value BIGINT NOT NULL DEFAULT 0
 	)`
 
+// TaskQueue is a backend that can hold background work durably: a task written
+// here survives the process that queued it, and is handed to exactly one worker
+// at a time under a lease.
+//
+// It exists because delay ran every task in a goroutine of the process that
+// queued it. A deploy or a crash took every pending webhook emit, counter shard
+// and .After(...) re-queue down with that process, and nothing anywhere knew
+// they had existed. A row in this table is the record that they did.
+//
+// The delivery guarantee is AT LEAST ONCE, and the lease is what makes it that.
+// LeaseTasks marks a task leased until now+visibility and hands back a lease id;
+// the worker then reports the outcome under that id. A worker that dies mid-task
+// reports nothing, its lease runs out, and the next LeaseTasks hands the task to
+// somebody else. So a task can run twice — once by the worker that vanished and
+// once by its successor — and never zero times. Every outcome is conditional on
+// the lease id, so the worker that vanished cannot, on waking, complete or
+// reschedule a task that now belongs to its successor: it gets ErrLeaseLost.
+//
+// A task whose attempts are used up is not deleted. It is marked TaskDead and
+// kept, payload and last error included, until an operator retries or purges
+// it (`commerce tasks`). Dropping it would be the goroutine behaviour again,
+// only slower.
+//
+// Like Sequencer, it is deliberately NOT part of the DB interface: a caller
+// type-asserts, and a store that cannot offer it is one delay simply does not
+// run durably on.
+type TaskQueue interface {
+	// EnqueueTask stores t as pending, runnable from t.RunAt. An empty ID is
+	// assigned; the stored task's ID is written back to t.
+	EnqueueTask(ctx context.Context, t *QueuedTask) error
+
+	// LeaseTasks claims up to n runnable tasks for visibility and returns them
+	// with Attempts already counting this run. A task is runnable when it is
+	// pending and due, or leased and its lease has run out. A task whose lease
+	// ran out on its final attempt is dead-lettered here instead.
+	LeaseTasks(ctx context.Context, n int, visibility time.Duration) ([]*QueuedTask, error)
+
+	// CompleteTask deletes a task that ran successfully under lease.
+	CompleteTask(ctx context.Context, id, lease string) error
+
+	// RescheduleTask returns a failed task to pending, runnable from runAt.
+	RescheduleTask(ctx context.Context, id, lease string, runAt time.Time, reason string) error
+
+	// DeadLetterTask marks a task dead: it will not run again unless retried.
+	DeadLetterTask(ctx context.Context, id, lease string, reason string) error
+
+	// ListTasks returns up to limit tasks in status, oldest first. An empty
+	// status lists every task.
+	ListTasks(ctx context.Context, status TaskStatus, limit int) ([]*QueuedTask, error)
+
+	// RetryDeadTasks returns dead tasks to pending with their attempts reset
+	// and reports how many it moved. No ids means every dead task.
+	RetryDeadTasks(ctx context.Context, ids ...string) (int, error)
+
+	// PurgeDeadTasks deletes dead tasks and reports how many it removed. No
+	// ids means every dead task. Only dead tasks can be purged.
+	PurgeDeadTasks(ctx context.Context, ids ...string) (int, error)
+}
+
+// TaskStatus is where a queued task is in its life. A task that completes is
+// deleted, so there is no status for it.
+type TaskStatus string
+
+const (
+	TaskPending TaskStatus = "pending"
+	TaskLeased  TaskStatus = "leased"
+	TaskDead    TaskStatus = "dead"
+)
+
+// ErrLeaseLost is returned when a task's outcome is reported under a lease it
+// no longer holds: the lease ran out and the task went to another worker, or
+// an operator moved it.
+var ErrLeaseLost = errors.New("db: task lease lost")
+
+// QueuedTask is one row of the task queue. Payload is opaque here; delay
+// stores its gob-encoded invocation in it and Key names the func it belongs to.
+type QueuedTask struct {
+	ID          string        `json:"id"`
+	Queue       string        `json:"queue,omitempty"`
+	Name        string        `json:"name,omitempty"`
+	Key         string        `json:"key"`
+	Payload     []byte        `json:"-"`
+	Status      TaskStatus    `json:"status"`
+	Attempts    int           `json:"attempts"`
+	MaxAttempts int           `json:"maxAttempts"`
+	RetryDelay  time.Duration `json:"retryDelay,omitempty"` // zero: the worker's default
+	RunAt       time.Time     `json:"runAt"`
+	Lease       string        `json:"-"`
+	LeaseUntil  time.Time     `json:"leaseUntil,omitempty"`
+	LastError   string        `json:"lastError,omitempty"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	UpdatedAt   time.Time     `json:"updatedAt"`
+}
+
+// Outbox is a backend that can record events in the SAME transaction as the
+// entity write they describe, and hand them back, in order, to be published.
+//
+// It exists because every event this service sent was sent after the write,
+// separately from it. events.Client posts over HTTP and billing's Emit runs in
+// a goroutine, so a sink that was down, or a process that died between the
+// write and the send, lost the event while the order it described stayed paid.
+// And two events for one order raced each other to the sink, so a consumer
+// could see order.refunded before order.completed. A row written here commits
+// or rolls back with the entity, so the event exists exactly when the change
+// does, and it stays until a relay has delivered it.
+//
+// Ordering is per aggregate — the entity an event is about, named by type and
+// id — and it is carried by Seq, which PutWithOutbox allocates from a per-
+// aggregate counter inside the transaction. LeaseOutbox only ever hands out the
+// oldest undelivered event of an aggregate, so the next one is not leased until
+// the one before it is acknowledged: a failing event holds back its
+// aggregate's later events, and no other aggregate's. Events of different
+// aggregates carry no order relative to each other.
+//
+// The delivery guarantee is AT LEAST ONCE, exactly as for TaskQueue, and for
+// the same reason: a relay that dies after publishing and before AckOutbox
+// leaves the lease to run out and the event to be published again. There is no
+// dead letter. An event is never given up on, because giving one up would let
+// its aggregate's later events overtake it; a sink that refuses an event for
+// good stalls that one aggregate, loudly, until somebody looks.
+//
+// Like TaskQueue, it is deliberately NOT part of the DB interface.
+type Outbox interface {
+	// PutWithOutbox stores src under key, as Put does, and appends msgs to the
+	// outbox, all in one transaction. Each message's ID, Seq, Tenant and
+	// CreatedAt are assigned and written back.
+	PutWithOutbox(ctx context.Context, key Key, src interface{}, msgs ...*OutboxMessage) (Key, error)
+
+	// LeaseOutbox claims up to n deliverable events for visibility. An event
+	// is deliverable when it is the oldest event of its aggregate still in the
+	// outbox and it is due, or its lease has run out.
+	LeaseOutbox(ctx context.Context, n int, visibility time.Duration) ([]*OutboxMessage, error)
+
+	// AckOutbox deletes an event that was delivered under lease.
+	AckOutbox(ctx context.Context, id, lease string) error
+
+	// RetryOutbox returns an event whose delivery failed to pending, due
+	// again from runAt.
+	RetryOutbox(ctx context.Context, id, lease string, runAt time.Time, reason string) error
+
+	// ListOutbox returns up to limit undelivered events, oldest first.
+	ListOutbox(ctx context.Context, limit int) ([]*OutboxMessage, error)
+}
+
+// OutboxMessage is one row of the outbox. Payload is opaque here; it is
+// whatever the writer put in it, and events/outbox puts the event's data.
+type OutboxMessage struct {
+	ID            string    `json:"id"`
+	Tenant        string    `json:"tenant,omitempty"`
+	AggregateType string    `json:"aggregateType"`
+	AggregateID   string    `json:"aggregateId"`
+	Seq           uint64    `json:"seq"`
+	Type          string    `json:"type"`
+	Payload       []byte    `json:"-"`
+	Attempts      int       `json:"attempts"`
+	RunAt         time.Time `json:"runAt"`
+	Lease         string    `json:"-"`
+	LeaseUntil    time.Time `json:"leaseUntil,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// AuditLog is a backend that keeps an append-only, hash-chained record of who
+// changed what.
+//
+// Each org's records form one chain: a record carries the hash of the record
+// before it, and its own hash covers that and its content. Editing or deleting
+// a record, or slipping one in, breaks every hash after it, which is what lets
+// `commerce audit verify` say the log is the log that was written. The chain is
+// per org rather than global so that one org's volume never serialises
+// another's writes, and so that an org's log can be handed over and checked on
+// its own.
+//
+// What the hash covers is not decided here. AppendAudit assigns the record's
+// place in the chain — Seq and PrevHash — under the chain head's lock, and then
+// calls seal to compute Hash, so the audit package owns the hashing and a
+// change to it never needs a migration.
+//
+// The store keeps no UPDATE or DELETE path for records: nothing in this
+// interface can change one once written.
+//
+// Like Outbox, it is deliberately NOT part of the DB interface, and it lives
+// in the system store only.
+type AuditLog interface {
+	// AppendAudit appends rec to its org's chain: it sets rec.ID, rec.Seq and
+	// rec.PrevHash, calls seal to set rec.Hash, and writes the record and the
+	// new chain head in one transaction. An error from seal writes nothing.
+	AppendAudit(ctx context.Context, rec *AuditRecord, seal func(*AuditRecord) error) error
+
+	// ListAudit returns an org's records matching f, newest first.
+	ListAudit(ctx context.Context, f AuditFilter) ([]*AuditRecord, error)
+
+	// ScanAudit returns up to n of an org's records after seq afterSeq,
+	// oldest first. It is the walk verification takes.
+	ScanAudit(ctx context.Context, org string, afterSeq uint64, n int) ([]*AuditRecord, error)
+
+	// AuditHead returns the seq and hash of an org's newest record, or 0 and
+	// "" when it has none.
+	AuditHead(ctx context.Context, org string) (uint64, string, error)
+
+	// AuditOrgs lists the orgs that have a chain.
+	AuditOrgs(ctx context.Context) ([]string, error)
+}
+
+// AuditRecord is one entry of the audit log. Diff is opaque here, as an
+// outbox payload is; the audit package puts the JSON field changes in it.
+type AuditRecord struct {
+	ID           string    `json:"id"`
+	Org          string    `json:"org"`
+	Seq          uint64    `json:"seq"`
+	At           time.Time `json:"at"`
+	ActorType    string    `json:"actorType"`
+	ActorID      string    `json:"actorId,omitempty"`
+	Method       string    `json:"method,omitempty"`
+	Route        string    `json:"route,omitempty"`
+	Status       int       `json:"status,omitempty"`
+	ResourceKind string    `json:"resourceKind,omitempty"`
+	ResourceID   string    `json:"resourceId,omitempty"`
+	Action       string    `json:"action"`
+	RequestID    string    `json:"requestId,omitempty"`
+	Diff         []byte    `json:"-"`
+	PrevHash     string    `json:"prevHash"`
+	Hash         string    `json:"hash"`
+}
+
+// AuditFilter selects records for ListAudit. Org is required; every other
+// field is ignored when zero. Before is a cursor: only records with a seq
+// below it are returned, so passing the last seq of one page gets the next.
+type AuditFilter struct {
+	Org          string
+	ActorID      string
+	ResourceKind string
+	ResourceID   string
+	Action       string
+	Since        time.Time
+	Until        time.Time
+	Before       uint64
+	Limit        int
+}
+
 // Datastore is the interface for Hanzo Datastore (Datastore) analytics queries
 type Datastore interface {
 	// Query executes datastore queries
@@ -7,7 +7,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"time"
+
+	"github.com/hanzoai/commerce/hooks"
 )
 
 var (
@@ -242,6 +245,12 @@ func (m *Model) GetByID(ctx context.Context, id string) error {
 
 // Put saves the entity to the database
 func (m *Model) Put(ctx context.Context) error {
+	return m.hooked(ctx, hooks.OpUpdate, true, func() error { return m.put(ctx) })
+}
+
+// put writes the entity; Put, Create and Update each wrap it in the hooks
+// once.
+func (m *Model) put(ctx context.Context) error {
 	// Set timestamps
 	now := time.Now()
 	if m.CreatedAt.IsZero() {
@@ -283,7 +292,7 @@ func (m *Model) Create(ctx context.Context) error {
 		}
 	}
 
-	if err := m.Put(ctx); err != nil {
+	if err := m.hooked(ctx, hooks.OpCreate, false, func() error { return m.put(ctx) }); err != nil {
 		return err
 	}
 
@@ -321,7 +330,7 @@ func (m *Model) Update(ctx context.Context) error {
 		}
 	}
 
-	if err := m.Put(ctx); err != nil {
+	if err := m.hooked(ctx, hooks.OpUpdate, false, func() error { return m.put(ctx) }); err != nil {
 		return err
 	}
 
@@ -348,7 +357,7 @@ func (m *Model) Delete(ctx context.Context) error {
 		return nil
 	}
 
-	if err := m.db.Delete(ctx, m.Key()); err != nil {
+	if err := m.hooked(ctx, hooks.OpDelete, false, func() error { return m.db.Delete(ctx, m.Key()) }); err != nil {
 		return err
 	}
 
@@ -362,6 +371,37 @@ func (m *Model) Delete(ctx context.Context) error {
 	return nil
 }
 
+// hooked makes write with the process's model hooks around it (see
+// hooks.RunModelWrite), so a model on a tenant DB fires the same hooks as one
+// on the commerce datastore.
+func (m *Model) hooked(ctx context.Context, op hooks.Op, upsert bool, write func() error) error {
+	if m.Mock {
+		return write()
+	}
+	return hooks.Default().RunModelWrite(&hooks.ModelWrite{
+		Context: ctx,
+		Kind:    m.Kind(),
+		Op:      op,
+		Upsert:  upsert,
+		Model:   m.entity,
+		Load: func() (interface{}, error) {
+			typ := reflect.TypeOf(m.entity)
+			if m.key == nil || m.key.Incomplete() || typ.Kind() != reflect.Ptr {
+				return nil, nil
+			}
+			prev := reflect.New(typ.Elem()).Interface()
+			if err := m.db.Get(ctx, m.key, prev); err != nil {
+				if errors.Is(err, ErrNoSuchEntity) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			return prev, nil
+		},
+		Write: write,
+	})
+}
+
 // SoftDelete marks the entity as deleted without removing it
 func (m *Model) SoftDelete(ctx context.Context) error {
 	m.Deleted = true
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// outboxDDL is the ONE definition of the outbox, identical in shape on both
+// backends, like taskQueueDDL and for the same reasons: unix milliseconds in
+// BIGINT, payload as BYTEA.
+//
+// Unlike _tasks it is written in every store, not only the system one, because
+// an event has to be in the same database as the entity it commits with, and
+// merchant entities live in their org's own store. tenant records the namespace
+// the entity was written under, so a relay draining a shared store can still
+// say whose event it is.
+//
+// The UNIQUE constraint is a backstop, not the mechanism: seq comes from
+// _outbox_aggregates, whose row the writing transaction holds until it commits,
+// so two writers to one aggregate queue on it. Should anything ever allocate a
+// seq around that, the duplicate is refused instead of delivered out of order.
+const outboxDDL = `CREATE TABLE IF NOT EXISTS _outbox (
+		id TEXT PRIMARY KEY,
+		tenant TEXT NOT NULL DEFAULT '',
+		aggregate_type TEXT NOT NULL,
+		aggregate_id TEXT NOT NULL,
+		seq BIGINT NOT NULL,
+		type TEXT NOT NULL,
+		payload BYTEA NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		run_at BIGINT NOT NULL,
+		lease_id TEXT NOT NULL DEFAULT '',
+		lease_until BIGINT NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		UNIQUE (tenant, aggregate_type, aggregate_id, seq)
+	)`
+
+const outboxIndexDDL = `CREATE INDEX IF NOT EXISTS idx_outbox_status_run ON _outbox(status, run_at)`
+
+// outboxAggregatesDDL holds the last seq handed out per aggregate. It outlives
+// the events themselves — a delivered event is deleted — so that an
+// aggregate's numbering never restarts.
+const outboxAggregatesDDL = `CREATE TABLE IF NOT EXISTS _outbox_aggregates (
+		tenant TEXT NOT NULL DEFAULT '',
+		aggregate_type TEXT NOT NULL,
+		aggregate_id TEXT NOT NULL,
+		seq BIGINT NOT NULL,
+		PRIMARY KEY (tenant, aggregate_type, aggregate_id)
+	)`
+
+const outboxColumns = `id, tenant, aggregate_type, aggregate_id, seq, type, payload,
+	attempts, run_at, lease_id, lease_until, last_error, created_at`
+
+const (
+	outboxPending = "pending"
+	outboxLeased  = "leased"
+)
+
+// sqlOutbox is the outbox over one database/sql handle. It runs on the same
+// handle, lock and placeholder rewriting as the task queue.
+type sqlOutbox struct {
+	sqlTaskQueue
+}
+
+func scanOutbox(rows *sql.Rows) ([]*OutboxMessage, error) {
+	defer rows.Close()
+
+	var out []*OutboxMessage
+	for rows.Next() {
+		var (
+			m                         OutboxMessage
+			seq                       int64
+			runAt, leaseUntil, create int64
+		)
+		if err := rows.Scan(&m.ID, &m.Tenant, &m.AggregateType, &m.AggregateID, &seq,
+			&m.Type, &m.Payload, &m.Attempts, &runAt, &m.Lease, &leaseUntil,
+			&m.LastError, &create); err != nil {
+			return nil, err
+		}
+		m.Seq = uint64(seq)
+		m.RunAt = fromMillis(runAt)
+		m.LeaseUntil = fromMillis(leaseUntil)
+		m.CreatedAt = fromMillis(create)
+		out = append(out, &m)
+	}
+	return out, rows.Err()
+}
+
+// put runs putEntity and appends msgs in one transaction. putEntity is the
+// backend's own upsert, against the transaction rather than the pool, so the
+// entity row and its events commit together or not at all.
+//
+// Each message's seq is allocated by an upsert on its aggregate's counter row,
+// inside the transaction. That row stays locked until commit, so a second
+// writer to the same aggregate waits for the first to commit and then reads
+// its value — the seqs of an aggregate are in commit order, which is the order
+// its changes actually happened in.
+func (q sqlOutbox) put(ctx context.Context, tenant string, putEntity func(*sql.Tx) error, msgs []*OutboxMessage) error {
+	for _, m := range msgs {
+		if m.AggregateType == "" || m.AggregateID == "" || m.Type == "" {
+			return fmt.Errorf("db: outbox message needs an aggregate type, aggregate id and type")
+		}
+	}
+
+	unlock := q.lock()
+	defer unlock()
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := putEntity(tx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, m := range msgs {
+		var seq int64
+		if err := tx.QueryRowContext(ctx, q.bind(`
+			INSERT INTO _outbox_aggregates (tenant, aggregate_type, aggregate_id, seq)
+			VALUES (?, ?, ?, 1)
+			ON CONFLICT (tenant, aggregate_type, aggregate_id)
+				DO UPDATE SET seq = _outbox_aggregates.seq + 1
+			RETURNING seq
+		`), tenant, m.AggregateType, m.AggregateID).Scan(&seq); err != nil {
+			return fmt.Errorf("db: allocate outbox seq for %s %s: %w", m.AggregateType, m.AggregateID, err)
+		}
+
+		m.ID = newTaskToken("evt_")
+		m.Tenant = tenant
+		m.Seq = uint64(seq)
+		m.Attempts = 0
+		m.CreatedAt, m.RunAt = now, now
+		if m.Payload == nil {
+			m.Payload = []byte("null")
+		}
+
+		if _, err := tx.ExecContext(ctx, q.bind(`
+			INSERT INTO _outbox (id, tenant, aggregate_type, aggregate_id, seq, type,
+				payload, status, run_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), m.ID, tenant, m.AggregateType, m.AggregateID, seq, m.Type, m.Payload,
+			outboxPending, millis(now), millis(now), millis(now)); err != nil {
+			return fmt.Errorf("db: write outbox %s: %w", m.Type, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// lease claims heads only: an event is claimable when no earlier event of its
+// aggregate is still in the table, pending or leased. Delivered events are
+// deleted, so "still in the table" is exactly "not yet delivered". One UPDATE,
+// as in the task queue, so two relays never claim one row.
+func (q sqlOutbox) lease(ctx context.Context, n int, visibility time.Duration) ([]*OutboxMessage, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	lease := newTaskToken("lease_")
+
+	unlock := q.lock()
+	defer unlock()
+
+	skipLocked := ""
+	if q.postgres {
+		skipLocked = "FOR UPDATE SKIP LOCKED"
+	}
+	rows, err := q.db.QueryContext(ctx, q.bind(`
+		UPDATE _outbox SET status = ?, lease_id = ?, lease_until = ?,
+			attempts = attempts + 1, updated_at = ?
+		WHERE id IN (
+			SELECT o.id FROM _outbox o
+			WHERE ((o.status = ? AND o.run_at <= ?) OR (o.status = ? AND o.lease_until <= ?))
+				AND NOT EXISTS (
+					SELECT 1 FROM _outbox p
+					WHERE p.tenant = o.tenant
+						AND p.aggregate_type = o.aggregate_type
+						AND p.aggregate_id = o.aggregate_id
+						AND p.seq < o.seq
+				)
+			ORDER BY o.created_at, o.seq
+			LIMIT ? `+skipLocked+`
+		)
+		RETURNING `+outboxColumns),
+		outboxLeased, lease, millis(now.Add(visibility)), millis(now),
+		outboxPending, millis(now), outboxLeased, millis(now), n)
+	if err != nil {
+		return nil, fmt.Errorf("db: lease outbox: %w", err)
+	}
+	return scanOutbox(rows)
+}
+
+func (q sqlOutbox) ack(ctx context.Context, id, lease string) error {
+	return q.settle(ctx, `DELETE FROM _outbox WHERE id = ? AND lease_id = ? AND status = ?`,
+		id, lease, outboxLeased)
+}
+
+func (q sqlOutbox) retry(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return q.settle(ctx, `
+		UPDATE _outbox SET status = ?, run_at = ?, lease_id = '', lease_until = 0,
+			last_error = ?, updated_at = ?
+		WHERE id = ? AND lease_id = ? AND status = ?
+	`, outboxPending, millis(runAt), reason, millis(time.Now()), id, lease, outboxLeased)
+}
+
+func (q sqlOutbox) list(ctx context.Context, limit int) ([]*OutboxMessage, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := q.db.QueryContext(ctx, q.bind(`SELECT `+outboxColumns+` FROM _outbox
+		ORDER BY created_at, seq LIMIT ?`), limit)
+	if err != nil {
+		return nil, fmt.Errorf("db: list outbox: %w", err)
+	}
+	return scanOutbox(rows)
+}
+
+// SQLite: the transaction goes to the writer pool under writeMu, which is what
+// makes the counter upsert above exclusive within the process.
+
+func (db *SQLiteDB) outbox() sqlOutbox {
+	return sqlOutbox{db.tasks()}
+}
+
+func (db *SQLiteDB) PutWithOutbox(ctx context.Context, key Key, src interface{}, msgs ...*OutboxMessage) (Key, error) {
+	if key == nil {
+		return nil, ErrInvalidKey
+	}
+	data, err := marshalForDB(src)
+	if err != nil {
+		return nil, fmt.Errorf("db: failed to marshal entity: %w", err)
+	}
+	var parentID *string
+	if p := key.Parent(); p != nil {
+		id := p.Encode()
+		parentID = &id
+	}
+	ns := getNamespace(ctx)
+
+	err = db.outbox().put(ctx, ns, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO _entities (id, kind, namespace, parent_id, data, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(id, kind, namespace) DO UPDATE SET
+				parent_id = excluded.parent_id,
+				data = excluded.data, updated_at = CURRENT_TIMESTAMP
+		`, key.Encode(), key.Kind(), ns, parentID, data)
+		return err
+	}, msgs)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (db *SQLiteDB) LeaseOutbox(ctx context.Context, n int, visibility time.Duration) ([]*OutboxMessage, error) {
+	return db.outbox().lease(ctx, n, visibility)
+}
+
+func (db *SQLiteDB) AckOutbox(ctx context.Context, id, lease string) error {
+	return db.outbox().ack(ctx, id, lease)
+}
+
+func (db *SQLiteDB) RetryOutbox(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return db.outbox().retry(ctx, id, lease, runAt, reason)
+}
+
+func (db *SQLiteDB) ListOutbox(ctx context.Context, limit int) ([]*OutboxMessage, error) {
+	return db.outbox().list(ctx, limit)
+}
+
+// Postgres: the counter row lock is what orders two replicas writing to one
+// aggregate, and SKIP LOCKED keeps two relays off the same head.
+
+func (db *PostgresDB) outbox() sqlOutbox {
+	return sqlOutbox{db.tasks()}
+}
+
+func (db *PostgresDB) PutWithOutbox(ctx context.Context, key Key, src interface{}, msgs ...*OutboxMessage) (Key, error) {
+	if key == nil {
+		return nil, ErrInvalidKey
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, fmt.Errorf("db: failed to marshal entity: %w", err)
+	}
+	var parentID *string
+	if p := key.Parent(); p != nil {
+		id := p.Encode()
+		parentID = &id
+	}
+	tenant := db.tenantFor(ctx)
+
+	err = db.outbox().put(ctx, tenant, func(tx *sql.Tx) error {
+		_, err := tx.StmtContext(ctx, db.stmtPut).ExecContext(ctx, key.Encode(), key.Kind(), tenant, parentID, data)
+		return err
+	}, msgs)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (db *PostgresDB) LeaseOutbox(ctx context.Context, n int, visibility time.Duration) ([]*OutboxMessage, error) {
+	return db.outbox().lease(ctx, n, visibility)
+}
+
+func (db *PostgresDB) AckOutbox(ctx context.Context, id, lease string) error {
+	return db.outbox().ack(ctx, id, lease)
+}
+
+func (db *PostgresDB) RetryOutbox(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return db.outbox().retry(ctx, id, lease, runAt, reason)
+}
+
+func (db *PostgresDB) ListOutbox(ctx context.Context, limit int) ([]*OutboxMessage, error) {
+	return db.outbox().list(ctx, limit)
+}
+
+// tenantDB forwards the outbox like the task queue. PutWithOutbox is one
+// transaction, so one borrow holds all of it.
+
+func (d tenantDB) withOutbox(ctx context.Context, fn func(Outbox) error) error {
+	return d.do(ctx, func(db DB) error {
+		o, ok := db.(Outbox)
+		if !ok {
+			return fmt.Errorf("db: tenant store %T has no outbox", db)
+		}
+		return fn(o)
+	})
+}
+
+func (d tenantDB) PutWithOutbox(ctx context.Context, key Key, src interface{}, msgs ...*OutboxMessage) (Key, error) {
+	var out Key
+	err := d.withOutbox(ctx, func(o Outbox) (err error) {
+		out, err = o.PutWithOutbox(ctx, key, src, msgs...)
+		return err
+	})
+	return out, err
+}
+
+func (d tenantDB) LeaseOutbox(ctx context.Context, n int, visibility time.Duration) ([]*OutboxMessage, error) {
+	var out []*OutboxMessage
+	err := d.withOutbox(ctx, func(o Outbox) (err error) {
+		out, err = o.LeaseOutbox(ctx, n, visibility)
+		return err
+	})
+	return out, err
+}
+
+func (d tenantDB) AckOutbox(ctx context.Context, id, lease string) error {
+	return d.withOutbox(ctx, func(o Outbox) error { return o.AckOutbox(ctx, id, lease) })
+}
+
+func (d tenantDB) RetryOutbox(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return d.withOutbox(ctx, func(o Outbox) error { return o.RetryOutbox(ctx, id, lease, runAt, reason) })
+}
+
+func (d tenantDB) ListOutbox(ctx context.Context, limit int) ([]*OutboxMessage, error) {
+	var out []*OutboxMessage
+	err := d.withOutbox(ctx, func(o Outbox) (err error) {
+		out, err = o.ListOutbox(ctx, limit)
+		return err
+	})
+	return out, err
+}
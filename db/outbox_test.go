@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// The outbox promises three things: an event exists exactly when the write it
+// describes does, an aggregate's events come out in the order they went in,
+// and an event nobody acknowledged comes back. These walk each on SQLite; the
+// statements are shared with Postgres.
+
+type outboxEntity struct {
+	Status string `json:"status"`
+}
+
+func putEvents(t *testing.T, o Outbox, key Key, status string, types ...string) []*OutboxMessage {
+	t.Helper()
+	var msgs []*OutboxMessage
+	for _, typ := range types {
+		msgs = append(msgs, &OutboxMessage{AggregateType: key.Kind(), AggregateID: key.Encode(), Type: typ, Payload: []byte(`{}`)})
+	}
+	if _, err := o.PutWithOutbox(context.Background(), key, &outboxEntity{Status: status}, msgs...); err != nil {
+		t.Fatalf("PutWithOutbox: %v", err)
+	}
+	return msgs
+}
+
+func TestOutbox_WritesEntityAndEventsTogether(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	key := sdb.NewKey("order", "ord_1", 0, nil)
+
+	msgs := putEvents(t, sdb, key, "paid", "order.created", "order.paid")
+	if msgs[0].Seq != 1 || msgs[1].Seq != 2 || msgs[0].ID == "" {
+		t.Fatalf("seqs = %d, %d; id %q", msgs[0].Seq, msgs[1].Seq, msgs[0].ID)
+	}
+
+	var got outboxEntity
+	if err := sdb.Get(ctx, key, &got); err != nil || got.Status != "paid" {
+		t.Fatalf("entity = %+v, %v", got, err)
+	}
+	if all, _ := sdb.ListOutbox(ctx, 10); len(all) != 2 {
+		t.Fatalf("outbox holds %d events, want 2", len(all))
+	}
+
+	// A message that cannot be written takes the entity down with it.
+	bad := &OutboxMessage{AggregateType: "order", Type: "order.paid"}
+	if _, err := sdb.PutWithOutbox(ctx, sdb.NewKey("order", "ord_2", 0, nil), &outboxEntity{Status: "paid"}, bad); err == nil {
+		t.Fatal("a message without an aggregate id was accepted")
+	}
+	if err := sdb.Get(ctx, sdb.NewKey("order", "ord_2", 0, nil), &got); !errors.Is(err, ErrNoSuchEntity) {
+		t.Fatalf("entity written without its event: %v", err)
+	}
+}
+
+// Only an aggregate's oldest event is ever out for delivery, so a failure holds
+// back that aggregate's later events and nobody else's.
+func TestOutbox_LeasesInOrderPerAggregate(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	a := sdb.NewKey("order", "ord_a", 0, nil)
+	b := sdb.NewKey("order", "ord_b", 0, nil)
+
+	putEvents(t, sdb, a, "paid", "order.created", "order.paid")
+	putEvents(t, sdb, b, "open", "order.created")
+	putEvents(t, sdb, a, "refunded", "order.refunded")
+
+	first, err := sdb.LeaseOutbox(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("LeaseOutbox: %v", err)
+	}
+	if len(first) != 2 {
+		t.Fatalf("leased %d events, want one head per aggregate", len(first))
+	}
+	heads := map[string]*OutboxMessage{}
+	for _, m := range first {
+		heads[m.AggregateID] = m
+	}
+	if heads[a.Encode()].Seq != 1 || heads[b.Encode()].Seq != 1 || heads[a.Encode()].Attempts != 1 {
+		t.Fatalf("heads = %+v", heads)
+	}
+
+	// a's head fails; b's is delivered. a's next event stays behind its head.
+	if err := sdb.RetryOutbox(ctx, heads[a.Encode()].ID, heads[a.Encode()].Lease, time.Now(), "sink down"); err != nil {
+		t.Fatalf("RetryOutbox: %v", err)
+	}
+	if err := sdb.AckOutbox(ctx, heads[b.Encode()].ID, heads[b.Encode()].Lease); err != nil {
+		t.Fatalf("AckOutbox: %v", err)
+	}
+
+	var order []string
+	for i := 0; i < 5; i++ {
+		got, err := sdb.LeaseOutbox(ctx, 10, time.Minute)
+		if err != nil {
+			t.Fatalf("LeaseOutbox: %v", err)
+		}
+		if len(got) == 0 {
+			break
+		}
+		if len(got) != 1 {
+			t.Fatalf("leased %+v, want only a's head", got)
+		}
+		order = append(order, got[0].Type)
+		if err := sdb.AckOutbox(ctx, got[0].ID, got[0].Lease); err != nil {
+			t.Fatalf("AckOutbox: %v", err)
+		}
+	}
+	want := []string{"order.created", "order.paid", "order.refunded"}
+	if len(order) != len(want) {
+		t.Fatalf("delivered %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("delivered %v, want %v", order, want)
+		}
+	}
+
+	// Delivered events are gone, but the numbering carries on.
+	if msgs := putEvents(t, sdb, a, "closed", "order.closed"); msgs[0].Seq != 4 {
+		t.Fatalf("seq after delivery = %d, want 4", msgs[0].Seq)
+	}
+}
+
+func TestOutbox_ExpiredLeaseIsRedelivered(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	putEvents(t, sdb, sdb.NewKey("invoice", "inv_1", 0, nil), "paid", "invoice.paid")
+
+	first, err := sdb.LeaseOutbox(ctx, 1, time.Millisecond)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("LeaseOutbox = %v, %v", first, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	second, err := sdb.LeaseOutbox(ctx, 1, time.Minute)
+	if err != nil || len(second) != 1 || second[0].ID != first[0].ID || second[0].Attempts != 2 {
+		t.Fatalf("expired lease not redelivered: %+v, %v", second, err)
+	}
+	if err := sdb.AckOutbox(ctx, first[0].ID, first[0].Lease); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("stale ack = %v, want ErrLeaseLost", err)
+	}
+	if err := sdb.AckOutbox(ctx, second[0].ID, second[0].Lease); err != nil {
+		t.Fatalf("AckOutbox: %v", err)
+	}
+}
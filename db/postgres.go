@@ -255,6 +255,33 @@ func (db *PostgresDB) initSchema() error {
 		return err
 	}
 
+	// The durable task queue. See db.TaskQueue. Untenanted for the same
+	// reason: it is the process's queue, and the org a task works on travels
+	// in its arguments.
+	for _, stmt := range []string{taskQueueDDL, taskQueueIndexDDL} {
+		if _, err = db.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// The transactional event outbox. See db.Outbox. Its rows carry the tenant
+	// they were written under rather than being keyed by it: the relay drains
+	// the whole table, as the task poller does.
+	for _, stmt := range []string{outboxDDL, outboxIndexDDL, outboxAggregatesDDL} {
+		if _, err = db.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// The hash-chained audit log. See db.AuditLog. Keyed by the org the record
+	// is about, not by tenant: the log lives in the system store, out of reach
+	// of the orgs it records.
+	for _, stmt := range []string{auditDDL, auditResourceIndexDDL, auditHeadsDDL} {
+		if _, err = db.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
 	// The credential guard travels with the table it protects — see guard.go.
 	for _, stmt := range postgresGuardDDL() {
 		if _, err := db.db.Exec(stmt); err != nil {
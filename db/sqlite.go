@@ -189,6 +189,17 @@ var baseSchemaDDL = []string{
 	`CREATE INDEX IF NOT EXISTS idx_entities_deleted ON _entities(deleted)`,
 	// The named-counter table. See db.Sequencer.
 	sequenceDDL,
+	// The durable task queue. See db.TaskQueue.
+	taskQueueDDL,
+	taskQueueIndexDDL,
+	// The transactional event outbox. See db.Outbox.
+	outboxDDL,
+	outboxIndexDDL,
+	outboxAggregatesDDL,
+	// The hash-chained audit log. See db.AuditLog.
+	auditDDL,
+	auditResourceIndexDDL,
+	auditHeadsDDL,
 }
 
 // initSchema creates the base tables.
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Dialects SQLStore reports, so a caller holding only the interface can pick
+// its DDL and placeholders.
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
+// SQLStore hands out the store's database/sql handle, for a subsystem that
+// keeps relational tables of its own beside the entities — a double-entry
+// ledger, whose invariants are constraints and whose postings must commit
+// together, is the case it exists for. Everything else goes through DB.
+//
+// Writes go through WriteSQL only. On SQLite the transaction runs on the
+// writer pool under the same writeMu the store's own writes take, so it can
+// never meet SQLITE_BUSY half way; on Postgres it runs SERIALIZABLE, and a
+// serialization failure is retried from the top, so fn must be safe to run
+// more than once and must keep no state outside the transaction.
+//
+// Like Sequencer it is a capability, not part of DB: callers type-assert and
+// refuse a store that lacks it.
+type SQLStore interface {
+	// SQLDialect is DialectSQLite or DialectPostgres.
+	SQLDialect() string
+
+	// ReadSQL runs fn against the reader pool. It sees committed data only.
+	ReadSQL(ctx context.Context, fn func(*sql.DB) error) error
+
+	// WriteSQL runs fn in one transaction and commits it if fn returns nil.
+	WriteSQL(ctx context.Context, fn func(*sql.Tx) error) error
+}
+
+// serializationRetries is how many times a Postgres write that lost a
+// serialization race is run again before its error is returned. Contention
+// on one account is short-lived; a write that loses this many times in a row
+// is being starved, and its caller should hear about it.
+const serializationRetries = 5
+
+func (db *SQLiteDB) SQLDialect() string { return DialectSQLite }
+
+func (db *SQLiteDB) ReadSQL(ctx context.Context, fn func(*sql.DB) error) error {
+	return fn(db.readDB)
+}
+
+func (db *SQLiteDB) WriteSQL(ctx context.Context, fn func(*sql.Tx) error) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return runTx(ctx, db.writeDB, nil, fn)
+}
+
+func (db *PostgresDB) SQLDialect() string { return DialectPostgres }
+
+func (db *PostgresDB) ReadSQL(ctx context.Context, fn func(*sql.DB) error) error {
+	return fn(db.db)
+}
+
+func (db *PostgresDB) WriteSQL(ctx context.Context, fn func(*sql.Tx) error) error {
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db.db, opts, fn)
+		if err == nil || !isSerializationFailure(err) || attempt == serializationRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+		}
+	}
+}
+
+func runTx(ctx context.Context, h *sql.DB, opts *sql.TxOptions, fn func(*sql.Tx) error) error {
+	tx, err := h.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isSerializationFailure reports whether Postgres aborted the transaction
+// to keep it serializable (SQLSTATE 40001) or to break a deadlock (40P01).
+// Either way nothing was written and running it again is the remedy.
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// tenantDB forwards like the task queue. The handle is only good inside fn:
+// the registry may close an idle tenant's store once the borrow ends.
+
+func (d tenantDB) withSQL(ctx context.Context, fn func(SQLStore) error) error {
+	return d.do(ctx, func(db DB) error {
+		s, ok := db.(SQLStore)
+		if !ok {
+			return fmt.Errorf("db: tenant store %T has no SQL access", db)
+		}
+		return fn(s)
+	})
+}
+
+func (d tenantDB) SQLDialect() string {
+	dialect := ""
+	_ = d.withSQL(context.Background(), func(s SQLStore) error {
+		dialect = s.SQLDialect()
+		return nil
+	})
+	return dialect
+}
+
+func (d tenantDB) ReadSQL(ctx context.Context, fn func(*sql.DB) error) error {
+	return d.withSQL(ctx, func(s SQLStore) error { return s.ReadSQL(ctx, fn) })
+}
+
+func (d tenantDB) WriteSQL(ctx context.Context, fn func(*sql.Tx) error) error {
+	return d.withSQL(ctx, func(s SQLStore) error { return s.WriteSQL(ctx, fn) })
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// A write commits when fn succeeds and leaves nothing behind when it fails,
+// and the reader pool sees what was committed.
+func TestSQLiteSQLStore_WriteCommitsOrRollsBack(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+
+	if got := sdb.SQLDialect(); got != DialectSQLite {
+		t.Fatalf("dialect = %q, want %q", got, DialectSQLite)
+	}
+	if err := sdb.WriteSQL(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notes (body TEXT NOT NULL)`)
+		return err
+	}); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	if err := sdb.WriteSQL(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO notes (body) VALUES (?)`, "kept")
+		return err
+	}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	boom := errors.New("boom")
+	if err := sdb.WriteSQL(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO notes (body) VALUES (?)`, "dropped"); err != nil {
+			return err
+		}
+		return boom
+	}); !errors.Is(err, boom) {
+		t.Fatalf("failed write: err = %v, want fn's error back", err)
+	}
+
+	var n int
+	if err := sdb.ReadSQL(ctx, func(h *sql.DB) error {
+		return h.QueryRowContext(ctx, `SELECT COUNT(*) FROM notes`).Scan(&n)
+	}); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("rows = %d, want only the committed one", n)
+	}
+}
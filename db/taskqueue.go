@@ -0,0 +1,461 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// taskQueueDDL is the ONE definition of the task table, identical in shape on
+// both backends, like sequenceDDL. Times are unix milliseconds in BIGINT
+// columns rather than each dialect's own timestamp type, so the comparisons
+// the lease depends on read the same on both.
+//
+// payload is declared BYTEA, which Postgres requires; SQLite has no such type
+// and gives the column NUMERIC affinity, which stores a blob verbatim.
+//
+// The table is not keyed by tenant, again like _sequences: it belongs to the
+// process's system store, and the org a task works on is in its arguments.
+const taskQueueDDL = `CREATE TABLE IF NOT EXISTS _tasks (
+		id TEXT PRIMARY KEY,
+		queue TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		func_key TEXT NOT NULL,
+		payload BYTEA NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL DEFAULT 1,
+		retry_delay BIGINT NOT NULL DEFAULT 0,
+		run_at BIGINT NOT NULL,
+		lease_id TEXT NOT NULL DEFAULT '',
+		lease_until BIGINT NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`
+
+const taskQueueIndexDDL = `CREATE INDEX IF NOT EXISTS idx_tasks_status_run ON _tasks(status, run_at)`
+
+const taskColumns = `id, queue, name, func_key, payload, status, attempts, max_attempts,
+	retry_delay, run_at, lease_id, lease_until, last_error, created_at, updated_at`
+
+// sqlTaskQueue is the task queue over one database/sql handle. The statements
+// are the same on both backends bar two things, and both are fields here:
+// Postgres numbers its placeholders, and SQLite serialises writers in-process
+// with the store's writeMu.
+type sqlTaskQueue struct {
+	db       *sql.DB
+	mu       *sync.Mutex
+	postgres bool
+}
+
+func (q sqlTaskQueue) lock() func() {
+	if q.mu == nil {
+		return func() {}
+	}
+	q.mu.Lock()
+	return q.mu.Unlock
+}
+
+// bind rewrites ? placeholders to $1, $2, … for Postgres. None of the
+// statements below carry a literal question mark.
+func (q sqlTaskQueue) bind(query string) string {
+	if !q.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func newTaskToken(prefix string) string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("db: task id entropy: %w", err))
+	}
+	return prefix + hex.EncodeToString(b)
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func scanTasks(rows *sql.Rows) ([]*QueuedTask, error) {
+	defer rows.Close()
+
+	var out []*QueuedTask
+	for rows.Next() {
+		var (
+			t                                               QueuedTask
+			status                                          string
+			retryDelay, runAt, leaseUntil, created, updated int64
+		)
+		if err := rows.Scan(&t.ID, &t.Queue, &t.Name, &t.Key, &t.Payload, &status,
+			&t.Attempts, &t.MaxAttempts, &retryDelay, &runAt, &t.Lease, &leaseUntil,
+			&t.LastError, &created, &updated); err != nil {
+			return nil, err
+		}
+		t.Status = TaskStatus(status)
+		t.RetryDelay = time.Duration(retryDelay) * time.Millisecond
+		t.RunAt = fromMillis(runAt)
+		t.LeaseUntil = fromMillis(leaseUntil)
+		t.CreatedAt = fromMillis(created)
+		t.UpdatedAt = fromMillis(updated)
+		out = append(out, &t)
+	}
+	return out, rows.Err()
+}
+
+func (q sqlTaskQueue) enqueue(ctx context.Context, t *QueuedTask) error {
+	if t.Key == "" {
+		return fmt.Errorf("db: task has no func key")
+	}
+	if t.ID == "" {
+		t.ID = newTaskToken("task_")
+	}
+	if t.MaxAttempts < 1 {
+		t.MaxAttempts = 1
+	}
+	now := time.Now()
+	if t.RunAt.IsZero() {
+		t.RunAt = now
+	}
+	t.Status = TaskPending
+	t.Attempts = 0
+	t.CreatedAt, t.UpdatedAt = now, now
+
+	unlock := q.lock()
+	defer unlock()
+
+	_, err := q.db.ExecContext(ctx, q.bind(`
+		INSERT INTO _tasks (id, queue, name, func_key, payload, status, attempts,
+			max_attempts, retry_delay, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?, ?)
+	`), t.ID, t.Queue, t.Name, t.Key, t.Payload, string(TaskPending),
+		t.MaxAttempts, t.RetryDelay.Milliseconds(), millis(t.RunAt), millis(now), millis(now))
+	if err != nil {
+		return fmt.Errorf("db: enqueue task %s: %w", t.Key, err)
+	}
+	return nil
+}
+
+// lease is two statements and each is atomic on its own; they need not be
+// atomic together. The first buries tasks whose final lease ran out — a worker
+// died holding them and there is no attempt left to give. The second claims
+// the rest in one UPDATE, so two workers can never claim the same row: SQLite
+// runs it under its single-writer lock, and on Postgres SKIP LOCKED has a
+// concurrent claimer pass over rows another transaction is already taking
+// instead of queueing behind it and then taking them too.
+func (q sqlTaskQueue) lease(ctx context.Context, n int, visibility time.Duration) ([]*QueuedTask, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	lease := newTaskToken("lease_")
+
+	unlock := q.lock()
+	defer unlock()
+
+	if _, err := q.db.ExecContext(ctx, q.bind(`
+		UPDATE _tasks SET status = ?, lease_id = '', lease_until = 0, updated_at = ?,
+			last_error = 'lease expired on the final attempt; the worker running it was lost'
+		WHERE status = ? AND lease_until <= ? AND attempts >= max_attempts
+	`), string(TaskDead), millis(now), string(TaskLeased), millis(now)); err != nil {
+		return nil, fmt.Errorf("db: dead-letter expired tasks: %w", err)
+	}
+
+	skipLocked := ""
+	if q.postgres {
+		skipLocked = "FOR UPDATE SKIP LOCKED"
+	}
+	rows, err := q.db.QueryContext(ctx, q.bind(`
+		UPDATE _tasks SET status = ?, lease_id = ?, lease_until = ?,
+			attempts = attempts + 1, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM _tasks
+			WHERE attempts < max_attempts
+				AND ((status = ? AND run_at <= ?) OR (status = ? AND lease_until <= ?))
+			ORDER BY run_at
+			LIMIT ? `+skipLocked+`
+		)
+		RETURNING `+taskColumns),
+		string(TaskLeased), lease, millis(now.Add(visibility)), millis(now),
+		string(TaskPending), millis(now), string(TaskLeased), millis(now), n)
+	if err != nil {
+		return nil, fmt.Errorf("db: lease tasks: %w", err)
+	}
+	return scanTasks(rows)
+}
+
+// settle applies one outcome to a task under lease, refusing with ErrLeaseLost
+// when the lease is no longer the one on the row.
+func (q sqlTaskQueue) settle(ctx context.Context, query string, args ...interface{}) error {
+	unlock := q.lock()
+	defer unlock()
+
+	res, err := q.db.ExecContext(ctx, q.bind(query), args...)
+	if err != nil {
+		return fmt.Errorf("db: settle task: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("db: settle task: %w", err)
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q sqlTaskQueue) complete(ctx context.Context, id, lease string) error {
+	return q.settle(ctx, `DELETE FROM _tasks WHERE id = ? AND lease_id = ? AND status = ?`,
+		id, lease, string(TaskLeased))
+}
+
+func (q sqlTaskQueue) reschedule(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return q.settle(ctx, `
+		UPDATE _tasks SET status = ?, run_at = ?, lease_id = '', lease_until = 0,
+			last_error = ?, updated_at = ?
+		WHERE id = ? AND lease_id = ? AND status = ?
+	`, string(TaskPending), millis(runAt), reason, millis(time.Now()), id, lease, string(TaskLeased))
+}
+
+func (q sqlTaskQueue) deadLetter(ctx context.Context, id, lease, reason string) error {
+	return q.settle(ctx, `
+		UPDATE _tasks SET status = ?, lease_id = '', lease_until = 0,
+			last_error = ?, updated_at = ?
+		WHERE id = ? AND lease_id = ? AND status = ?
+	`, string(TaskDead), reason, millis(time.Now()), id, lease, string(TaskLeased))
+}
+
+func (q sqlTaskQueue) list(ctx context.Context, status TaskStatus, limit int) ([]*QueuedTask, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	query := `SELECT ` + taskColumns + ` FROM _tasks`
+	args := []interface{}{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, string(status))
+	}
+	query += ` ORDER BY created_at LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := q.db.QueryContext(ctx, q.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("db: list tasks: %w", err)
+	}
+	return scanTasks(rows)
+}
+
+// whereDead scopes a statement to dead tasks, and to ids when there are any.
+func whereDead(ids []string) (string, []interface{}) {
+	where := ` WHERE status = ?`
+	args := []interface{}{string(TaskDead)}
+	if len(ids) > 0 {
+		where += ` AND id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	return where, args
+}
+
+func (q sqlTaskQueue) retryDead(ctx context.Context, ids []string) (int, error) {
+	now := millis(time.Now())
+	where, args := whereDead(ids)
+	args = append([]interface{}{string(TaskPending), now, now}, args...)
+
+	unlock := q.lock()
+	defer unlock()
+
+	res, err := q.db.ExecContext(ctx, q.bind(`
+		UPDATE _tasks SET status = ?, attempts = 0, run_at = ?, updated_at = ?`+where), args...)
+	if err != nil {
+		return 0, fmt.Errorf("db: retry dead tasks: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (q sqlTaskQueue) purgeDead(ctx context.Context, ids []string) (int, error) {
+	where, args := whereDead(ids)
+
+	unlock := q.lock()
+	defer unlock()
+
+	res, err := q.db.ExecContext(ctx, q.bind(`DELETE FROM _tasks`+where), args...)
+	if err != nil {
+		return 0, fmt.Errorf("db: purge dead tasks: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// SQLite: every statement goes to the writer pool under writeMu, reads
+// included, so a list never races the lease that is changing what it lists.
+
+func (db *SQLiteDB) tasks() sqlTaskQueue {
+	return sqlTaskQueue{db: db.writeDB, mu: &db.writeMu}
+}
+
+func (db *SQLiteDB) EnqueueTask(ctx context.Context, t *QueuedTask) error {
+	return db.tasks().enqueue(ctx, t)
+}
+
+func (db *SQLiteDB) LeaseTasks(ctx context.Context, n int, visibility time.Duration) ([]*QueuedTask, error) {
+	return db.tasks().lease(ctx, n, visibility)
+}
+
+func (db *SQLiteDB) CompleteTask(ctx context.Context, id, lease string) error {
+	return db.tasks().complete(ctx, id, lease)
+}
+
+func (db *SQLiteDB) RescheduleTask(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return db.tasks().reschedule(ctx, id, lease, runAt, reason)
+}
+
+func (db *SQLiteDB) DeadLetterTask(ctx context.Context, id, lease string, reason string) error {
+	return db.tasks().deadLetter(ctx, id, lease, reason)
+}
+
+func (db *SQLiteDB) ListTasks(ctx context.Context, status TaskStatus, limit int) ([]*QueuedTask, error) {
+	return db.tasks().list(ctx, status, limit)
+}
+
+func (db *SQLiteDB) RetryDeadTasks(ctx context.Context, ids ...string) (int, error) {
+	return db.tasks().retryDead(ctx, ids)
+}
+
+func (db *SQLiteDB) PurgeDeadTasks(ctx context.Context, ids ...string) (int, error) {
+	return db.tasks().purgeDead(ctx, ids)
+}
+
+// Postgres: the pool is shared by every replica, which is what lets a task
+// queued by one be run by another.
+
+func (db *PostgresDB) tasks() sqlTaskQueue {
+	return sqlTaskQueue{db: db.db, postgres: true}
+}
+
+func (db *PostgresDB) EnqueueTask(ctx context.Context, t *QueuedTask) error {
+	return db.tasks().enqueue(ctx, t)
+}
+
+func (db *PostgresDB) LeaseTasks(ctx context.Context, n int, visibility time.Duration) ([]*QueuedTask, error) {
+	return db.tasks().lease(ctx, n, visibility)
+}
+
+func (db *PostgresDB) CompleteTask(ctx context.Context, id, lease string) error {
+	return db.tasks().complete(ctx, id, lease)
+}
+
+func (db *PostgresDB) RescheduleTask(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return db.tasks().reschedule(ctx, id, lease, runAt, reason)
+}
+
+func (db *PostgresDB) DeadLetterTask(ctx context.Context, id, lease string, reason string) error {
+	return db.tasks().deadLetter(ctx, id, lease, reason)
+}
+
+func (db *PostgresDB) ListTasks(ctx context.Context, status TaskStatus, limit int) ([]*QueuedTask, error) {
+	return db.tasks().list(ctx, status, limit)
+}
+
+func (db *PostgresDB) RetryDeadTasks(ctx context.Context, ids ...string) (int, error) {
+	return db.tasks().retryDead(ctx, ids)
+}
+
+func (db *PostgresDB) PurgeDeadTasks(ctx context.Context, ids ...string) (int, error) {
+	return db.tasks().purgeDead(ctx, ids)
+}
+
+// tenantDB satisfies TaskQueue exactly when the store behind it does, the same
+// way it forwards Sequencer: one borrow per call, because every guarantee here
+// is a property of one statement.
+
+func (d tenantDB) withTasks(ctx context.Context, fn func(TaskQueue) error) error {
+	return d.do(ctx, func(db DB) error {
+		q, ok := db.(TaskQueue)
+		if !ok {
+			return fmt.Errorf("db: tenant store %T cannot queue tasks", db)
+		}
+		return fn(q)
+	})
+}
+
+func (d tenantDB) EnqueueTask(ctx context.Context, t *QueuedTask) error {
+	return d.withTasks(ctx, func(q TaskQueue) error { return q.EnqueueTask(ctx, t) })
+}
+
+func (d tenantDB) LeaseTasks(ctx context.Context, n int, visibility time.Duration) ([]*QueuedTask, error) {
+	var out []*QueuedTask
+	err := d.withTasks(ctx, func(q TaskQueue) (err error) {
+		out, err = q.LeaseTasks(ctx, n, visibility)
+		return err
+	})
+	return out, err
+}
+
+func (d tenantDB) CompleteTask(ctx context.Context, id, lease string) error {
+	return d.withTasks(ctx, func(q TaskQueue) error { return q.CompleteTask(ctx, id, lease) })
+}
+
+func (d tenantDB) RescheduleTask(ctx context.Context, id, lease string, runAt time.Time, reason string) error {
+	return d.withTasks(ctx, func(q TaskQueue) error { return q.RescheduleTask(ctx, id, lease, runAt, reason) })
+}
+
+func (d tenantDB) DeadLetterTask(ctx context.Context, id, lease string, reason string) error {
+	return d.withTasks(ctx, func(q TaskQueue) error { return q.DeadLetterTask(ctx, id, lease, reason) })
+}
+
+func (d tenantDB) ListTasks(ctx context.Context, status TaskStatus, limit int) ([]*QueuedTask, error) {
+	var out []*QueuedTask
+	err := d.withTasks(ctx, func(q TaskQueue) (err error) {
+		out, err = q.ListTasks(ctx, status, limit)
+		return err
+	})
+	return out, err
+}
+
+func (d tenantDB) RetryDeadTasks(ctx context.Context, ids ...string) (int, error) {
+	var n int
+	err := d.withTasks(ctx, func(q TaskQueue) (err error) {
+		n, err = q.RetryDeadTasks(ctx, ids...)
+		return err
+	})
+	return n, err
+}
+
+func (d tenantDB) PurgeDeadTasks(ctx context.Context, ids ...string) (int, error) {
+	var n int
+	err := d.withTasks(ctx, func(q TaskQueue) (err error) {
+		n, err = q.PurgeDeadTasks(ctx, ids...)
+		return err
+	})
+	return n, err
+}
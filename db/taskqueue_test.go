@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// The task queue's promise is at least once: a task is handed to one worker at
+// a time, comes back if that worker vanishes, and is kept rather than dropped
+// when its attempts run out. These tests walk those three paths on the SQLite
+// store; the statements are shared with Postgres.
+
+func enqueueOne(t *testing.T, q TaskQueue, maxAttempts int) *QueuedTask {
+	t.Helper()
+	task := &QueuedTask{Key: "test-func", Payload: []byte{0x01, 0x02}, MaxAttempts: maxAttempts}
+	if err := q.EnqueueTask(context.Background(), task); err != nil {
+		t.Fatalf("EnqueueTask: %v", err)
+	}
+	if task.ID == "" {
+		t.Fatal("EnqueueTask did not assign an id")
+	}
+	return task
+}
+
+func TestTaskQueue_LeaseIsExclusive(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	task := enqueueOne(t, sdb, 3)
+
+	leased, err := sdb.LeaseTasks(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("LeaseTasks: %v", err)
+	}
+	if len(leased) != 1 || leased[0].ID != task.ID || leased[0].Attempts != 1 {
+		t.Fatalf("leased %+v, want the one task on its first attempt", leased)
+	}
+	if string(leased[0].Payload) != string(task.Payload) {
+		t.Fatalf("payload = %x, want %x", leased[0].Payload, task.Payload)
+	}
+
+	again, err := sdb.LeaseTasks(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("LeaseTasks: %v", err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("a task under lease was leased again: %+v", again)
+	}
+
+	if err := sdb.CompleteTask(ctx, task.ID, leased[0].Lease); err != nil {
+		t.Fatalf("CompleteTask: %v", err)
+	}
+	if all, _ := sdb.ListTasks(ctx, "", 10); len(all) != 0 {
+		t.Fatalf("completed task still queued: %+v", all)
+	}
+}
+
+// A worker that dies holding a task must not hold it forever, and must not be
+// able to settle it once it is somebody else's.
+func TestTaskQueue_ExpiredLeaseIsReleased(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	task := enqueueOne(t, sdb, 3)
+
+	first, err := sdb.LeaseTasks(ctx, 1, time.Millisecond)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("LeaseTasks = %v, %v", first, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	second, err := sdb.LeaseTasks(ctx, 1, time.Minute)
+	if err != nil || len(second) != 1 || second[0].ID != task.ID {
+		t.Fatalf("expired lease not released: %v, %v", second, err)
+	}
+	if second[0].Attempts != 2 {
+		t.Fatalf("attempts = %d, want 2", second[0].Attempts)
+	}
+
+	if err := sdb.CompleteTask(ctx, task.ID, first[0].Lease); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("settling under the lost lease = %v, want ErrLeaseLost", err)
+	}
+	if err := sdb.CompleteTask(ctx, task.ID, second[0].Lease); err != nil {
+		t.Fatalf("CompleteTask under the live lease: %v", err)
+	}
+}
+
+func TestTaskQueue_RescheduleWaitsForRunAt(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	task := enqueueOne(t, sdb, 3)
+
+	leased, _ := sdb.LeaseTasks(ctx, 1, time.Minute)
+	if err := sdb.RescheduleTask(ctx, task.ID, leased[0].Lease, time.Now().Add(time.Hour), "boom"); err != nil {
+		t.Fatalf("RescheduleTask: %v", err)
+	}
+
+	if early, _ := sdb.LeaseTasks(ctx, 1, time.Minute); len(early) != 0 {
+		t.Fatalf("a task rescheduled an hour out was leased now: %+v", early)
+	}
+	pending, _ := sdb.ListTasks(ctx, TaskPending, 10)
+	if len(pending) != 1 || pending[0].LastError != "boom" || pending[0].Attempts != 1 {
+		t.Fatalf("pending = %+v, want the task with its error and one attempt", pending)
+	}
+}
+
+// A task whose final lease runs out is dead-lettered, not run a fourth time and
+// not dropped. Retry brings it back with fresh attempts; purge removes it.
+func TestTaskQueue_DeadLetterRetryPurge(t *testing.T) {
+	sdb := seqDB(t)
+	ctx := context.Background()
+	lost := enqueueOne(t, sdb, 1)
+	failed := enqueueOne(t, sdb, 1)
+
+	leased, err := sdb.LeaseTasks(ctx, 2, time.Millisecond)
+	if err != nil || len(leased) != 2 {
+		t.Fatalf("LeaseTasks = %v, %v", leased, err)
+	}
+	for _, l := range leased {
+		if l.ID == failed.ID {
+			if err := sdb.DeadLetterTask(ctx, l.ID, l.Lease, "exhausted"); err != nil {
+				t.Fatalf("DeadLetterTask: %v", err)
+			}
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// This lease finds nothing to run, and buries the task whose worker was lost.
+	if again, _ := sdb.LeaseTasks(ctx, 2, time.Minute); len(again) != 0 {
+		t.Fatalf("an exhausted task was leased again: %+v", again)
+	}
+	dead, _ := sdb.ListTasks(ctx, TaskDead, 10)
+	if len(dead) != 2 {
+		t.Fatalf("dead = %+v, want both tasks", dead)
+	}
+
+	n, err := sdb.RetryDeadTasks(ctx, lost.ID)
+	if err != nil || n != 1 {
+		t.Fatalf("RetryDeadTasks = %d, %v", n, err)
+	}
+	retried, _ := sdb.LeaseTasks(ctx, 2, time.Minute)
+	if len(retried) != 1 || retried[0].ID != lost.ID || retried[0].Attempts != 1 {
+		t.Fatalf("retried = %+v, want the lost task on a fresh first attempt", retried)
+	}
+
+	// Purge never touches a task that is not dead, even when named.
+	n, err = sdb.PurgeDeadTasks(ctx, lost.ID, failed.ID)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeadTasks = %d, %v; want only the dead one", n, err)
+	}
+	if all, _ := sdb.ListTasks(ctx, "", 10); len(all) != 1 || all[0].ID != lost.ID {
+		t.Fatalf("after purge = %+v, want only the leased task", all)
+	}
+}
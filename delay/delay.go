@@ -134,8 +134,10 @@ func Func(key string, i interface{}) *Function {
 	return f
 }
 
-// Call invokes a delayed function asynchronously using goroutines.
-// The function is executed in a background goroutine after any configured delay.
+// Call invokes a delayed function asynchronously. With a durable backend
+// configured (SetBackend) the task is written to it and run by whichever
+// process leases it; otherwise it is executed in a background goroutine after
+// any configured delay.
 func (f *Function) Call(c context.Context, args ...interface{}) error {
 	t, err := f.Task(args...)
 	if err != nil {
@@ -148,6 +150,10 @@ func (f *Function) Call(c context.Context, args ...interface{}) error {
 		t.Options.Name = f.name
 	}
 
+	if q := Backend(); q != nil {
+		return enqueue(c, q, t, f)
+	}
+
 	// Execute the task asynchronously
 	return executeTask(c, t, f)
 }
@@ -121,6 +121,10 @@ func pause(stop <-chan struct{}, d time.Duration) bool {
 // Draining is not permanent. Once the wait is over the queue re-arms, so a
 // process that drains for a checkpoint keeps working and a test binary running
 // several contexts in sequence gets a clean queue for each.
+//
+// With a durable backend, Drain also stops the poller: nothing further is
+// leased, the leased tasks already running are waited for like any other, and
+// pending tasks stay in the backend for the next Start. See durable.go.
 func Drain(ctx context.Context) error {
 	mu.Lock()
 	close(stopCh)
@@ -0,0 +1,245 @@
+package delay
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/log"
+)
+
+// Without a backend, a task lives in a goroutine of the process that queued it
+// and dies with that process: a deploy or a crash loses every webhook emit,
+// counter shard and .After(...) re-queue that had not run yet, and leaves no
+// trace that it was ever there.
+//
+// With one (SetBackend), Call writes the task to a db.TaskQueue instead — the
+// same gob-encoded invocation Task has always carried, under its func's key —
+// and a poller started by Start leases tasks off the table and runs them. A
+// task is removed only once it has run successfully; a failure re-queues it
+// after its RetryDelay (DefaultRetryDelay without one) until its retries are
+// used up, and then it is dead-lettered and kept for `commerce tasks` to retry or purge.
+//
+// The guarantee is at least once, not exactly once. A worker that dies holding
+// a task holds it only until LeaseTimeout, after which any replica may run it
+// again. A task that runs longer than LeaseTimeout can therefore run twice —
+// which is why the timeout is generous, and why a delayed func must already be
+// safe to retry, as it has been under the in-process retry loop all along.
+//
+// Drain keeps its meaning. It stops the poller, so nothing new is leased, and
+// waits for the tasks already leased to finish and settle before the database
+// closes. What it no longer has to do is choose between running pending work
+// and dropping it: pending work is in the table, and the next process to Start
+// picks it up. Unlike the in-process queue, the poller does not re-arm after a
+// drain; a process that drains and carries on calls Start again.
+//
+// Later is not affected. It takes a closure, and a closure cannot be written
+// down; it stays in-process.
+
+var (
+	// LeaseTimeout is how long a leased task stays invisible to other pollers.
+	// It must comfortably exceed the longest a task runs, or the task is run a
+	// second time while the first run is still going.
+	LeaseTimeout = 5 * time.Minute
+
+	// PollInterval is how long the poller waits after finding nothing to do.
+	PollInterval = time.Second
+
+	// Workers bounds how many leased tasks one process runs at once.
+	Workers = 8
+)
+
+// backend and polling are guarded by mu, with the rest of the queue's state.
+var (
+	backend db.TaskQueue
+	polling bool
+)
+
+// SetBackend makes q the durable queue Call writes to. nil returns Call to
+// running tasks in-process. It does not start the poller; Start does.
+//
+// Setting a backend and starting the poller are separate on purpose. Bootstrap
+// sets the backend, because every process that can queue work should queue it
+// durably — including the one-shot cmd/ tools, whose work is then run by a
+// serving replica instead of lost when the tool exits. Only the serving entry
+// points start the poller, as with every other background schedule here.
+func SetBackend(q db.TaskQueue) {
+	mu.Lock()
+	defer mu.Unlock()
+	backend = q
+}
+
+// Backend returns the durable queue, or nil when tasks run in-process.
+func Backend() db.TaskQueue {
+	mu.Lock()
+	defer mu.Unlock()
+	return backend
+}
+
+// Start begins leasing and running tasks from the durable backend. It is a
+// no-op without a backend and when the poller is already running.
+func Start() {
+	mu.Lock()
+	q, stop := backend, stopCh
+	if q == nil || polling {
+		mu.Unlock()
+		return
+	}
+	polling = true
+	mu.Unlock()
+
+	spawn(func() { poll(q, stop) })
+}
+
+// Polling reports whether this process is running tasks from the backend.
+func Polling() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return polling
+}
+
+// enqueue writes t to q. A task that cannot be written is run in-process
+// instead: losing it in a crash is the old risk, and dropping it now would be a
+// new one.
+func enqueue(c context.Context, q db.TaskQueue, t *Task, f *Function) error {
+	retryCount := DefaultRetryCount
+	if t.Options.RetryCount > 0 {
+		retryCount = t.Options.RetryCount
+	}
+
+	// The caller's context is often a request that is about to end; the write
+	// must not be cancelled with it.
+	err := q.EnqueueTask(context.WithoutCancel(c), &db.QueuedTask{
+		Queue:       t.Options.Queue,
+		Name:        t.Options.Name,
+		Key:         f.key,
+		Payload:     t.Payload,
+		MaxAttempts: retryCount + 1,
+		RetryDelay:  t.Options.RetryDelay,
+		RunAt:       time.Now().Add(f.delay),
+	})
+	if err != nil {
+		log.Error("delay: failed to queue %s durably, running in-process: %v", f.key, err, c)
+		return executeTask(c, t, f)
+	}
+	return nil
+}
+
+// poll leases as many tasks as there are free workers, runs each in a counted
+// goroutine, and sleeps PollInterval whenever a lease comes back short. A drain
+// ends the sleep and the loop with it; the tasks already in hand are counted,
+// so the drain waits for them.
+func poll(q db.TaskQueue, stop <-chan struct{}) {
+	defer func() {
+		mu.Lock()
+		polling = false
+		mu.Unlock()
+	}()
+
+	slots := make(chan struct{}, Workers)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		free := cap(slots) - len(slots)
+		if free > 0 {
+			tasks, err := q.LeaseTasks(context.Background(), free, LeaseTimeout)
+			if err != nil {
+				log.Error("delay: failed to lease tasks: %v", err)
+			}
+			for _, t := range tasks {
+				slots <- struct{}{}
+				t := t
+				spawn(func() {
+					defer func() { <-slots }()
+					runLeased(q, t)
+				})
+			}
+			if err == nil && len(tasks) == free {
+				continue // a full batch: there may be more waiting
+			}
+		}
+
+		if !pause(stop, PollInterval) {
+			return
+		}
+	}
+}
+
+// runLeased runs one leased task and settles it: completed, re-queued or
+// dead-lettered. A task whose func this binary does not know, or whose payload
+// it cannot decode, is dead-lettered at once — retrying it cannot help, and a
+// newer binary, or an operator, can.
+func runLeased(q db.TaskQueue, t *db.QueuedTask) {
+	ctx := context.Background()
+	if t.Name != "" {
+		ctx = context.WithValue(ctx, taskIDContextKey, t.Name)
+	}
+
+	funcsMu.RLock()
+	f := Funcs[t.Key]
+	funcsMu.RUnlock()
+	if f == nil {
+		settle(ctx, t, q.DeadLetterTask(ctx, t.ID, t.Lease, "no func registered for key "+t.Key))
+		return
+	}
+
+	var inv invocation
+	if err := gob.NewDecoder(bytes.NewReader(t.Payload)).Decode(&inv); err != nil {
+		settle(ctx, t, q.DeadLetterTask(ctx, t.ID, t.Lease, "failed decoding task payload: "+err.Error()))
+		return
+	}
+
+	err := runRecovered(ctx, f, inv.Args)
+	if err == nil {
+		settle(ctx, t, q.CompleteTask(ctx, t.ID, t.Lease))
+		return
+	}
+
+	log.Error("delay: func %s failed (attempt %d/%d): %v", t.Key, t.Attempts, t.MaxAttempts, err, ctx)
+
+	if t.Attempts >= t.MaxAttempts {
+		log.Error("delay: func %s exhausted all retries, dead-lettering task %s: %v", t.Key, t.ID, err, ctx)
+		settle(ctx, t, q.DeadLetterTask(ctx, t.ID, t.Lease, err.Error()))
+		return
+	}
+
+	retryDelay := DefaultRetryDelay
+	if t.RetryDelay > 0 {
+		retryDelay = t.RetryDelay
+	}
+	settle(ctx, t, q.RescheduleTask(ctx, t.ID, t.Lease, time.Now().Add(retryDelay), err.Error()))
+}
+
+// runRecovered is executeInvocation with a panic turned into an error. In
+// process, a panicking task took the process down; here it would also be
+// leased again after every restart until its attempts ran out, so it is
+// recorded as the failure it is instead.
+func runRecovered(ctx context.Context, f *Function, args []interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return executeInvocation(ctx, f, args)
+}
+
+// settle logs an outcome that could not be recorded. A lost lease is expected
+// now and then — the task outran LeaseTimeout and is someone else's — and is
+// only worth a warning.
+func settle(ctx context.Context, t *db.QueuedTask, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, db.ErrLeaseLost):
+		log.Warn("delay: lease on task %s (%s) ran out before it finished", t.ID, t.Key, ctx)
+	default:
+		log.Error("delay: failed to settle task %s (%s): %v", t.ID, t.Key, err, ctx)
+	}
+}
@@ -0,0 +1,190 @@
+package delay
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+)
+
+// durableQueue installs a fresh SQLite task queue as the backend and fast
+// timings for the test, and puts everything back afterwards.
+func durableQueue(t *testing.T) db.TaskQueue {
+	t.Helper()
+	sdb, err := db.NewSQLiteDB(&db.SQLiteDBConfig{
+		Path:       filepath.Join(t.TempDir(), "tasks.db"),
+		Config:     db.DefaultConfig().SQLite,
+		TenantID:   "system",
+		TenantType: "org",
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+
+	poll, retry := PollInterval, DefaultRetryDelay
+	PollInterval, DefaultRetryDelay = 5*time.Millisecond, time.Millisecond
+	SetBackend(sdb)
+
+	t.Cleanup(func() {
+		ctx, cancel := drainCtx(t)
+		defer cancel()
+		Drain(ctx)
+		SetBackend(nil)
+		PollInterval, DefaultRetryDelay = poll, retry
+		sdb.Close()
+	})
+	return sdb
+}
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func countTasks(q db.TaskQueue, status db.TaskStatus) int {
+	tasks, _ := q.ListTasks(context.Background(), status, 100)
+	return len(tasks)
+}
+
+// With a backend, Call writes the task down and runs nothing itself: the task
+// is there for whichever process starts polling, including one started after
+// this one has gone.
+func TestDurable_CallQueuesUntilStart(t *testing.T) {
+	q := durableQueue(t)
+	var got atomic.Value
+
+	f := Func("durable-queues", func(ctx context.Context, s string) error {
+		got.Store(s)
+		return nil
+	})
+	if err := f.Call(context.Background(), "hello"); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if got.Load() != nil {
+		t.Fatal("task ran before anything was polling")
+	}
+	if n := countTasks(q, db.TaskPending); n != 1 {
+		t.Fatalf("pending tasks = %d, want 1", n)
+	}
+
+	Start()
+	waitFor(t, "the task to run", func() bool { return got.Load() == "hello" })
+	waitFor(t, "the task to be completed", func() bool { return countTasks(q, "") == 0 })
+}
+
+// A task that keeps failing is retried DefaultRetryCount times and then kept
+// as dead, not dropped.
+func TestDurable_ExhaustedTaskIsDeadLettered(t *testing.T) {
+	q := durableQueue(t)
+	var runs atomic.Int32
+
+	f := Func("durable-fails", func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("endpoint down")
+	})
+	if err := f.Call(context.Background()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	Start()
+
+	waitFor(t, "the task to be dead-lettered", func() bool { return countTasks(q, db.TaskDead) == 1 })
+	if got, want := runs.Load(), int32(DefaultRetryCount+1); got != want {
+		t.Fatalf("ran %d times, want %d", got, want)
+	}
+	dead, _ := q.ListTasks(context.Background(), db.TaskDead, 1)
+	if dead[0].LastError != "endpoint down" {
+		t.Fatalf("last error = %q", dead[0].LastError)
+	}
+}
+
+// A failed task waits out its own RetryDelay before the next attempt, as it
+// does in-process, not DefaultRetryDelay.
+func TestDurable_RetryHonoursTaskDelay(t *testing.T) {
+	q := durableQueue(t)
+	var runs atomic.Int32
+
+	f := Func("durable-retry-delay", func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("endpoint down")
+	})
+	task, err := f.Task()
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Options.RetryDelay = time.Hour
+	if err := enqueue(context.Background(), q, task, f); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	Start()
+
+	waitFor(t, "the first attempt to be re-queued", func() bool {
+		return runs.Load() == 1 && countTasks(q, db.TaskPending) == 1
+	})
+	pending, _ := q.ListTasks(context.Background(), db.TaskPending, 1)
+	if wait := time.Until(pending[0].RunAt); wait < 59*time.Minute {
+		t.Fatalf("retry runs in %s, want the task's hour", wait)
+	}
+}
+
+// A panicking task is a failed attempt, not a crashed process.
+func TestDurable_PanicIsAFailure(t *testing.T) {
+	q := durableQueue(t)
+	retries := DefaultRetryCount
+	DefaultRetryCount = 0
+	defer func() { DefaultRetryCount = retries }()
+
+	f := Func("durable-panics", func(ctx context.Context) {
+		panic("nil map")
+	})
+	if err := f.Call(context.Background()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	Start()
+
+	waitFor(t, "the task to be dead-lettered", func() bool { return countTasks(q, db.TaskDead) == 1 })
+}
+
+// Drain stops the poller and leaves scheduled work where it is. A task behind
+// a delay is not run early and is not lost: it is still in the queue for the
+// next process.
+func TestDurable_DrainLeavesPendingTasks(t *testing.T) {
+	q := durableQueue(t)
+	var ran atomic.Bool
+
+	f := Func("durable-later", func(ctx context.Context) error {
+		ran.Store(true)
+		return nil
+	}).After(time.Hour)
+	if err := f.Call(context.Background()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	Start()
+
+	ctx, cancel := drainCtx(t)
+	defer cancel()
+	if err := Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if Polling() {
+		t.Fatal("poller still running after Drain")
+	}
+	if ran.Load() {
+		t.Fatal("a task scheduled an hour out ran")
+	}
+	if n := countTasks(q, db.TaskPending); n != 1 {
+		t.Fatalf("pending tasks after drain = %d, want 1", n)
+	}
+}
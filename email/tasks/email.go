@@ -14,7 +14,8 @@ import (
 	"github.com/hanzoai/commerce/types/integration"
 )
 
-func getEmailSender(c context.Context, in integration.Integration) (email.Sender, error) {
+// Sender is the email provider in is the integration of.
+func Sender(c context.Context, in integration.Integration) (email.Sender, error) {
 	switch in.Type {
 	case integration.MandrillType:
 		log.Info("Using Mandrill", c)
@@ -35,7 +36,7 @@ func getEmailSender(c context.Context, in integration.Integration) (email.Sender
 var Send = delay.Func("email-send", func(c context.Context, in integration.Integration, message *email.Message) error {
 	log.Debug("Sending email to %s, %v", message.To[0], message, c)
 
-	provider, err := getEmailSender(c, in)
+	provider, err := Sender(c, in)
 	if err != nil {
 		return log.Error("Email provider integration not found: %v", err, c)
 	}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/hanzoai/commerce/billing/creditledger"
 	"github.com/hanzoai/commerce/billing/depositledger"
+	"github.com/hanzoai/commerce/delay"
 )
 
 // EmbedConfig configures the in-process Commerce server. Empty values
@@ -167,6 +168,30 @@ func Embed(ctx context.Context, cfg EmbedConfig) (*Embedded, error) {
 	depositWatcher := depositledger.Default()
 	depositWatcher.Start()
 
+	// Old webhooks are upgraded first, so the poller never delivers to one
+	// still carrying the enabled=false it was stored with by default.
+	app.upgradeWebhooks(ctx)
+
+	// The durable task poller, for the same reason and under the same rule:
+	// Bootstrap only set the backend. A no-op when COMMERCE_DURABLE_TASKS is
+	// off. Stop drains it.
+	delay.Start()
+
+	// And the event outbox relay; a no-op without COMMERCE_OUTBOX_SINK.
+	app.startOutboxRelay()
+
+	// And the reservation sweeper, which lapsed cart holds wait on.
+	app.startReservationSweeper()
+
+	// And the notification dispatcher, so queued email goes out.
+	app.startNotificationDispatcher()
+
+	// And the idempotency sweeper, so replayable responses do not pile up.
+	app.startIdempotencySweeper()
+
+	// And the scheduler, for the recurring jobs COMMERCE_JOBS schedules.
+	app.startScheduler()
+
 	cfg.Logger.Info("commerce.Embed ready",
 		"http", appCfg.HTTPAddr,
 		"data", appCfg.DataDir,
@@ -179,6 +204,7 @@ func Embed(ctx context.Context, cfg EmbedConfig) (*Embedded, error) {
 		// GET /v1/commerce/deposits, so the answer does not depend on catching it.
 		"deposit_watcher", depositWatcher.Running(),
 		"deposit_assets", len(depositWatcher.Assets()),
+		"durable_tasks", delay.Polling(),
 	)
 
 	return &Embedded{cfg: cfg, app: app}, nil
@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/log"
+)
+
+// ClaimStore is the atomic key/value surface Dedup needs. *infra.KVClient
+// provides it, on either of its backends; so does anything else that can
+// set-if-absent and compare-and-swap under a TTL.
+type ClaimStore interface {
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	CompareAndDelete(key string, want []byte) (bool, error)
+	CompareAndExtend(key string, want []byte, ttl time.Duration) (bool, error)
+}
+
+// Dedup is the consumer side of at-least-once: it runs a handler once per
+// event ID however many times the event is delivered.
+//
+// Handle claims the ID before running the handler and keeps the claim for
+// Window once the handler succeeds, so a redelivery inside Window is
+// recognised and skipped. A handler that fails gives its claim back, so the
+// broker's redelivery runs it again. A consumer that dies mid-handler holds
+// its claim only for Processing, after which the next delivery may run it.
+//
+// That last case is the limit of the guarantee: a handler that did its work
+// and died before returning will run again. Handlers whose effects must be
+// exactly-once should make the effect itself idempotent on the event ID, as
+// the money paths here do with idempotency keys; Dedup takes the routine
+// duplicates off their hands.
+type Dedup struct {
+	Store ClaimStore
+
+	// Prefix namespaces the claims, so two consumers of the same event — an
+	// indexer and a mailer, say — each get to handle it once.
+	Prefix string
+
+	// Processing is how long a claim lasts while its handler runs.
+	Processing time.Duration
+
+	// Window is how long a handled event is remembered. It should exceed the
+	// longest the broker can take to redeliver.
+	Window time.Duration
+}
+
+// NewDedup returns a Dedup for the consumer named prefix, with a five-minute
+// processing claim and a seven-day memory.
+func NewDedup(store ClaimStore, prefix string) *Dedup {
+	return &Dedup{Store: store, Prefix: prefix, Processing: 5 * time.Minute, Window: 7 * 24 * time.Hour}
+}
+
+// Handle runs fn unless the event with this id was handled already, or is
+// being handled right now. It reports whether fn ran. An fn error is returned
+// as is, so the caller can nak the delivery.
+func (d *Dedup) Handle(id string, fn func() error) (bool, error) {
+	if id == "" {
+		return false, fmt.Errorf("outbox: dedup needs an event id")
+	}
+	key := "outbox:dedup:" + d.Prefix + ":" + id
+
+	token := make([]byte, 12)
+	if _, err := rand.Read(token); err != nil {
+		return false, err
+	}
+	claim := []byte(hex.EncodeToString(token))
+
+	ok, err := d.Store.SetNX(key, claim, d.Processing)
+	if err != nil {
+		return false, fmt.Errorf("outbox: claim %s: %w", id, err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	if err := fn(); err != nil {
+		if _, derr := d.Store.CompareAndDelete(key, claim); derr != nil {
+			return true, fmt.Errorf("%w (and releasing the claim failed: %v)", err, derr)
+		}
+		return true, err
+	}
+
+	// Keep the claim as the record that this event was handled. If it ran out
+	// while fn was running, a second delivery may already have run fn too;
+	// nothing here can undo that. Either way fn succeeded, and reporting an
+	// error would only have the caller nak it into running a third time.
+	if kept, err := d.Store.CompareAndExtend(key, claim, d.Window); err != nil {
+		log.Warn("outbox: record %s handled: %v", id, err)
+	} else if !kept {
+		log.Warn("outbox: claim on %s ran out while it was being handled", id)
+	}
+	return true, nil
+}
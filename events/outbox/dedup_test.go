@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memClaims is a ClaimStore in a map. Expiry is not modelled; the tests do not
+// wait for a claim to run out.
+type memClaims struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (s *memClaims) SetNX(key string, value []byte, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[key]; ok {
+		return false, nil
+	}
+	s.m[key] = value
+	return true, nil
+}
+
+func (s *memClaims) CompareAndDelete(key string, want []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !bytes.Equal(s.m[key], want) {
+		return false, nil
+	}
+	delete(s.m, key)
+	return true, nil
+}
+
+func (s *memClaims) CompareAndExtend(key string, want []byte, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Equal(s.m[key], want), nil
+}
+
+func TestDedup_HandlesOncePerConsumer(t *testing.T) {
+	claims := &memClaims{m: map[string][]byte{}}
+	indexer, mailer := NewDedup(claims, "indexer"), NewDedup(claims, "mailer")
+
+	runs := 0
+	handle := func() error { runs++; return nil }
+
+	for i := 0; i < 3; i++ {
+		if _, err := indexer.Handle("evt_1", handle); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+	}
+	if ran, _ := mailer.Handle("evt_1", handle); !ran {
+		t.Fatal("a second consumer was denied an event the first one handled")
+	}
+	if runs != 2 {
+		t.Fatalf("handler ran %d times, want once per consumer", runs)
+	}
+}
+
+// A failed handler gives its claim back, so the redelivery runs it.
+func TestDedup_FailureReleasesClaim(t *testing.T) {
+	d := NewDedup(&memClaims{m: map[string][]byte{}}, "indexer")
+
+	boom := errors.New("index down")
+	if ran, err := d.Handle("evt_1", func() error { return boom }); !ran || !errors.Is(err, boom) {
+		t.Fatalf("Handle = %v, %v", ran, err)
+	}
+	if ran, err := d.Handle("evt_1", func() error { return nil }); !ran || err != nil {
+		t.Fatalf("redelivery after failure = %v, %v; want it to run", ran, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package outbox publishes commerce events from the transactional outbox.
+//
+// An event is written with the change it describes — order.paid in the same
+// transaction as the order, invoice.paid with the invoice — by passing it to
+// the model's PutWithEvents, CreateWithEvents or UpdateWithEvents (see
+// db.Outbox). Nothing is sent at that point. A Relay leases the events back
+// out of every store, hands each to a Sink, and deletes it once the sink has
+// taken it.
+//
+// What a consumer can rely on follows from that:
+//
+//   - Nothing is lost. An event is only deleted after a sink accepted it, so a
+//     sink that is down, or a relay that dies, delays events and drops none.
+//   - An aggregate's events arrive in the order its changes committed, each
+//     numbered by Sequence, one after another from 1. The relay does not
+//     publish an aggregate's next event until its previous one was accepted.
+//   - An event can arrive more than once. The relay publishes, then deletes;
+//     dying in between means publishing again. Every event keeps its ID across
+//     redeliveries, and Dedup is the consumer-side half that makes handling it
+//     idempotent.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+)
+
+// Event is what a sink publishes: the stored data, wrapped in the envelope a
+// consumer needs to order and de-duplicate it. Field names follow the bus
+// format of events.CommerceEvent.
+type Event struct {
+	// ID is the event's identity, stable across redeliveries.
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	// OrganizationID is the namespace the change was written under.
+	OrganizationID string `json:"organization_id,omitempty"`
+
+	AggregateType string `json:"aggregate_type"`
+	AggregateID   string `json:"aggregate_id"`
+
+	// Sequence numbers an aggregate's events from 1 in commit order. A gap
+	// means an event is still on its way; it never means one was skipped.
+	Sequence uint64 `json:"sequence"`
+
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Subject is the bus subject the event is published on: the type under the
+// commerce prefix, so the COMMERCE stream (events.StreamSubjects) captures it.
+func (e *Event) Subject() string {
+	return "commerce." + e.Type
+}
+
+// New returns an outbox message for an event of eventType about the aggregate
+// named by aggregateType and aggregateID, carrying data. Pass it to the
+// aggregate's own write.
+//
+// data is encoded now, when the change is made, and never re-read: the event
+// says what the aggregate was when it changed, not what it is when delivered.
+func New(aggregateType, aggregateID, eventType string, data map[string]interface{}) *db.OutboxMessage {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		// Event data is built from model fields, which always encode; a value
+		// that does not is a programming error at the call site.
+		panic(fmt.Errorf("outbox: encode %s data: %w", eventType, err))
+	}
+	return &db.OutboxMessage{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Type:          eventType,
+		Payload:       payload,
+	}
+}
+
+// FromMessage unwraps a leased outbox row into the Event a sink publishes.
+func FromMessage(m *db.OutboxMessage) *Event {
+	return &Event{
+		ID:             m.ID,
+		Type:           m.Type,
+		OrganizationID: m.Tenant,
+		AggregateType:  m.AggregateType,
+		AggregateID:    m.AggregateID,
+		Sequence:       m.Seq,
+		Timestamp:      m.CreatedAt.UTC(),
+		Data:           json.RawMessage(m.Payload),
+	}
+}
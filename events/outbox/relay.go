@@ -0,0 +1,237 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/log"
+)
+
+// Relay drains outboxes into a Sink.
+//
+// Each pass walks every store Stores returns, leasing events, publishing them
+// one at a time and acknowledging each as the sink takes it. A failed publish
+// puts the event back with a backoff that doubles per attempt up to
+// MaxBackoff, and — because only an aggregate's oldest event is ever leased —
+// holds back that aggregate's later events while it waits. Events of other
+// aggregates keep flowing.
+//
+// Any number of relays may run against the same stores, in one process or in
+// several: the lease hands each event to one of them at a time. The cost of
+// more than one is only duplicate polling.
+type Relay struct {
+	Sink Sink
+
+	// Stores returns the outboxes to drain. It is called once per pass, so a
+	// store that appears later — a new org's — is picked up without a restart.
+	Stores func(ctx context.Context) ([]db.Outbox, error)
+
+	// Batch is how many events one lease claims.
+	Batch int
+
+	// LeaseTimeout is how long an event stays leased to this relay. A batch
+	// shares one lease, and nothing is published once it has run out: another
+	// relay may have leased the event again by then, and published it and its
+	// aggregate's next event ahead of this one. Each publish is cut off at
+	// what is left of the lease, less a tenth of it to settle the event in,
+	// and the events a batch has no time left for wait out their lease.
+	LeaseTimeout time.Duration
+
+	// PollInterval is how long the relay waits after a pass that found nothing.
+	PollInterval time.Duration
+
+	// MinBackoff and MaxBackoff bound the wait before a failed event is retried.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRelay returns a relay with the default batch, lease and backoff.
+func NewRelay(sink Sink, stores func(ctx context.Context) ([]db.Outbox, error)) *Relay {
+	return &Relay{
+		Sink:         sink,
+		Stores:       stores,
+		Batch:        100,
+		LeaseTimeout: time.Minute,
+		PollInterval: time.Second,
+		MinBackoff:   time.Second,
+		MaxBackoff:   10 * time.Minute,
+	}
+}
+
+// backoff is the wait before attempt+1: MinBackoff doubled per attempt already
+// made, capped at MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.MinBackoff
+	for i := 1; i < attempts && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d
+}
+
+// Drain makes one pass over every store and reports how many events the sink
+// accepted. A store that fails to list or lease is logged and skipped; the
+// pass carries on with the rest, so one unreachable org does not stall every
+// other org's events.
+func (r *Relay) Drain(ctx context.Context) (int, error) {
+	stores, err := r.Stores(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, store := range stores {
+		n, err := r.drainStore(ctx, store)
+		delivered += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+			log.Error("outbox: drain %T: %v", store, err, ctx)
+		}
+	}
+	return delivered, nil
+}
+
+// drainStore leases until the store has nothing left that is due. Every batch
+// is at most one event per aggregate, so a store whose aggregates have several
+// events each takes several batches — each batch publishes the heads the
+// previous one acknowledged into place.
+func (r *Relay) drainStore(ctx context.Context, store db.Outbox) (int, error) {
+	delivered := 0
+	for ctx.Err() == nil {
+		msgs, err := store.LeaseOutbox(ctx, r.Batch, r.LeaseTimeout)
+		if err != nil {
+			return delivered, err
+		}
+		if len(msgs) == 0 {
+			return delivered, nil
+		}
+
+		progressed := false
+		for _, m := range msgs {
+			if r.leaseLeft(m) <= 0 {
+				// The rest of the batch is still leased to this relay, but
+				// not for long enough to publish in. Leased again once it
+				// lapses, each goes out in its aggregate's order.
+				return delivered, nil
+			}
+			if r.deliver(ctx, store, m) {
+				delivered++
+				progressed = true
+			}
+		}
+		if !progressed {
+			// Every head failed and is backing off; leasing again now would
+			// only find what is left of this batch.
+			return delivered, nil
+		}
+	}
+	return delivered, ctx.Err()
+}
+
+// leaseLeft is how long m may still be published for: the time left on its
+// lease, less the margin its ack or retry needs to land while it is held.
+func (r *Relay) leaseLeft(m *db.OutboxMessage) time.Duration {
+	until := m.LeaseUntil
+	if until.IsZero() {
+		return r.LeaseTimeout - r.LeaseTimeout/10
+	}
+	return time.Until(until) - r.LeaseTimeout/10
+}
+
+// deliver publishes one leased event, within what is left of its lease, and
+// settles it, reporting whether the sink took it.
+func (r *Relay) deliver(ctx context.Context, store db.Outbox, m *db.OutboxMessage) bool {
+	pubCtx, cancel := context.WithTimeout(ctx, r.leaseLeft(m))
+	err := r.Sink.Publish(pubCtx, FromMessage(m))
+	cancel()
+
+	if err != nil {
+		wait := r.backoff(m.Attempts)
+		log.Warn("outbox: publish %s %s (%s %s seq %d, attempt %d) failed, retrying in %s: %v",
+			m.Type, m.ID, m.AggregateType, m.AggregateID, m.Seq, m.Attempts, wait, err, ctx)
+		if rerr := store.RetryOutbox(ctx, m.ID, m.Lease, time.Now().Add(wait), err.Error()); rerr != nil && !errors.Is(rerr, db.ErrLeaseLost) {
+			log.Error("outbox: requeue %s: %v", m.ID, rerr, ctx)
+		}
+		return false
+	}
+
+	if err := store.AckOutbox(ctx, m.ID, m.Lease); err != nil {
+		// The sink has it. If the lease was lost another relay will publish it
+		// again, which at-least-once allows and Dedup absorbs.
+		log.Warn("outbox: ack %s after publish: %v", m.ID, err, ctx)
+	}
+	return true
+}
+
+// Start runs passes until Stop, sleeping PollInterval after a pass that
+// delivered nothing. It is a no-op when the relay is already running.
+func (r *Relay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return
+	}
+	r.running = true
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go r.loop(r.stop, r.done)
+}
+
+func (r *Relay) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		n, err := r.Drain(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error("outbox: relay pass: %v", err, ctx)
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// Stop ends the loop and waits for the pass in progress to wind down. An event
+// it was publishing when stopped is left leased, and is published again once
+// the lease runs out.
+func (r *Relay) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	stop, done := r.stop, r.done
+	r.mu.Unlock()
+
+	close(stop)
+	<-done
+}
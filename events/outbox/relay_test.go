@@ -0,0 +1,195 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+func outboxStore(t *testing.T) *db.SQLiteDB {
+	t.Helper()
+	sdb, err := db.NewSQLiteDB(&db.SQLiteDBConfig{
+		Path:       filepath.Join(t.TempDir(), "outbox.db"),
+		Config:     db.DefaultConfig().SQLite,
+		TenantID:   "acme",
+		TenantType: "org",
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { sdb.Close() })
+	return sdb
+}
+
+func write(t *testing.T, store *db.SQLiteDB, id string, events ...string) {
+	t.Helper()
+	ctx := nscontext.WithNamespace(context.Background(), "acme")
+	var msgs []*db.OutboxMessage
+	for _, typ := range events {
+		msgs = append(msgs, New("order", id, typ, map[string]interface{}{"orderId": id}))
+	}
+	if _, err := store.PutWithOutbox(ctx, store.NewKey("order", id, 0, nil), map[string]string{"id": id}, msgs...); err != nil {
+		t.Fatalf("PutWithOutbox: %v", err)
+	}
+}
+
+// recorder is a sink that fails while down and records what it took.
+type recorder struct {
+	down bool
+	got  []*Event
+}
+
+func (s *recorder) Publish(_ context.Context, e *Event) error {
+	if s.down {
+		return errors.New("sink down")
+	}
+	s.got = append(s.got, e)
+	return nil
+}
+
+func relayFor(sink Sink, stores ...db.Outbox) *Relay {
+	r := NewRelay(sink, func(context.Context) ([]db.Outbox, error) { return stores, nil })
+	r.MinBackoff = 0
+	return r
+}
+
+func TestRelay_DeliversEachAggregateInOrder(t *testing.T) {
+	store := outboxStore(t)
+	write(t, store, "ord_1", "order.created", "order.paid")
+	write(t, store, "ord_2", "order.created")
+	write(t, store, "ord_1", "order.refunded")
+
+	sink := &recorder{}
+	n, err := relayFor(sink, store).Drain(context.Background())
+	if err != nil || n != 4 {
+		t.Fatalf("Drain = %d, %v; want 4", n, err)
+	}
+
+	seqs := map[string][]uint64{}
+	for _, e := range sink.got {
+		seqs[e.AggregateID] = append(seqs[e.AggregateID], e.Sequence)
+		if e.OrganizationID != "acme" || e.Subject() != "commerce."+e.Type {
+			t.Fatalf("envelope = %+v", e)
+		}
+	}
+	if got := seqs["ord_1"]; len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("ord_1 delivered as %v, want [1 2 3]", got)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(sink.got[0].Data, &data); err != nil || data["orderId"] == "" {
+		t.Fatalf("data = %s, %v", sink.got[0].Data, err)
+	}
+
+	if left, _ := store.ListOutbox(context.Background(), 10); len(left) != 0 {
+		t.Fatalf("delivered events left in the outbox: %+v", left)
+	}
+}
+
+// A sink outage loses nothing: the events wait, and go out once it is back.
+func TestRelay_SinkDownKeepsEvents(t *testing.T) {
+	store := outboxStore(t)
+	write(t, store, "ord_1", "order.created", "order.paid")
+
+	sink := &recorder{down: true}
+	r := relayFor(sink, store)
+	if n, err := r.Drain(context.Background()); err != nil || n != 0 {
+		t.Fatalf("Drain with sink down = %d, %v", n, err)
+	}
+	left, _ := store.ListOutbox(context.Background(), 10)
+	if len(left) != 2 || left[0].LastError != "sink down" {
+		t.Fatalf("outbox after failed publish = %+v", left)
+	}
+
+	sink.down = false
+	if n, err := r.Drain(context.Background()); err != nil || n != 2 {
+		t.Fatalf("Drain after recovery = %d, %v", n, err)
+	}
+	if sink.got[0].Type != "order.created" || sink.got[1].Type != "order.paid" {
+		t.Fatalf("delivered %s, %s", sink.got[0].Type, sink.got[1].Type)
+	}
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	r := NewRelay(nil, nil)
+	r.MinBackoff, r.MaxBackoff = time.Second, 5*time.Second
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		if got := r.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+// leased is an outbox holding one leased batch, which records how each of
+// its events was settled.
+type leased struct {
+	db.Outbox
+	batch   []*db.OutboxMessage
+	settled map[string]string
+}
+
+func (s *leased) LeaseOutbox(context.Context, int, time.Duration) ([]*db.OutboxMessage, error) {
+	batch := s.batch
+	s.batch = nil
+	return batch, nil
+}
+
+func (s *leased) AckOutbox(_ context.Context, id, _ string) error {
+	s.settled[id] = "acked"
+	return nil
+}
+
+func (s *leased) RetryOutbox(_ context.Context, id, _ string, _ time.Time, _ string) error {
+	s.settled[id] = "retried"
+	return nil
+}
+
+// stall is a sink that never answers, and records how long it was given.
+type stall struct {
+	deadlines []time.Time
+}
+
+func (s *stall) Publish(ctx context.Context, _ *Event) error {
+	d, _ := ctx.Deadline()
+	s.deadlines = append(s.deadlines, d)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// A publish that outlasts the lease is cut off before the lease runs out, and
+// the rest of the batch is not published on a lease another relay may by now
+// hold.
+func TestRelay_PublishesWithinLease(t *testing.T) {
+	const lease = 200 * time.Millisecond
+	until := time.Now().Add(lease)
+	store := &leased{settled: map[string]string{}}
+	for _, id := range []string{"ord_1", "ord_2", "ord_3"} {
+		store.batch = append(store.batch, &db.OutboxMessage{
+			ID: id, AggregateType: "order", AggregateID: id, Type: "order.created",
+			Lease: "lease_1", LeaseUntil: until,
+		})
+	}
+
+	sink := &stall{}
+	r := relayFor(sink, store)
+	r.LeaseTimeout = lease
+	if n, err := r.Drain(context.Background()); err != nil || n != 0 {
+		t.Fatalf("Drain = %d, %v; want nothing delivered", n, err)
+	}
+
+	if len(sink.deadlines) != 1 {
+		t.Fatalf("published %d events, want only the first", len(sink.deadlines))
+	}
+	if latest := until.Add(-lease / 10); sink.deadlines[0].After(latest) {
+		t.Errorf("publish allowed until %s, past %s", sink.deadlines[0], latest)
+	}
+	if store.settled["ord_1"] != "retried" || store.settled["ord_2"] != "" || store.settled["ord_3"] != "" {
+		t.Errorf("settled = %v, want only ord_1, retried", store.settled)
+	}
+}
@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hanzoai/commerce/infra"
+	"github.com/hanzoai/commerce/models/webhook"
+)
+
+// Sink is where the relay delivers events. Publish returns nil only once the
+// sink has durably taken the event — stored, acknowledged, answered 2xx —
+// because the relay deletes the event on nil and it is not sent again.
+//
+// A sink sees each event at least once, and an aggregate's events in order.
+// It should pass the event's ID along for the consumer to de-duplicate on, and
+// use it itself where the transport can.
+type Sink interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// SinkFunc adapts a function to Sink.
+type SinkFunc func(ctx context.Context, e *Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, e *Event) error { return f(ctx, e) }
+
+// ---------------------------------------------------------------------------
+// JetStream
+// ---------------------------------------------------------------------------
+
+// PubSubSink publishes to the COMMERCE JetStream stream through the existing
+// infra.PubSubClient, on the event's Subject. The event ID goes as the message
+// id, so a republish inside the stream's duplicate window is dropped by the
+// stream itself and consumers never see it.
+type PubSubSink struct {
+	PubSub *infra.PubSubClient
+}
+
+func (s *PubSubSink) Publish(ctx context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	if _, err := s.PubSub.PublishToStreamWithID(ctx, e.Subject(), e.ID, data); err != nil {
+		return fmt.Errorf("publish %s to stream: %w", e.Subject(), err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// NATS / Kafka-compatible brokers
+// ---------------------------------------------------------------------------
+
+// Producer is the one call a log-structured broker client has to offer: write
+// value under key to topic, with headers, and return once the broker has it. A
+// Kafka producer with acks=all, or a NATS JetStream publish, fits as is.
+type Producer interface {
+	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+}
+
+// BrokerSink publishes through a Producer. The message key is the aggregate,
+// so a partitioned broker keeps each aggregate on one partition and in order;
+// the event ID and sequence travel as headers for consumers that want them
+// without decoding the body.
+type BrokerSink struct {
+	Producer Producer
+
+	// Topic maps an event to its topic. Nil publishes every event on its
+	// Subject.
+	Topic func(e *Event) string
+}
+
+func (s *BrokerSink) Publish(ctx context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	topic := e.Subject()
+	if s.Topic != nil {
+		topic = s.Topic(e)
+	}
+	key := []byte(e.OrganizationID + "/" + e.AggregateType + "/" + e.AggregateID)
+	headers := map[string]string{
+		"event-id":       e.ID,
+		"event-type":     e.Type,
+		"event-sequence": strconv.FormatUint(e.Sequence, 10),
+	}
+	if err := s.Producer.Produce(ctx, topic, key, data, headers); err != nil {
+		return fmt.Errorf("produce %s to %s: %w", e.Type, topic, err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// HTTP
+// ---------------------------------------------------------------------------
+
+// HTTPSink POSTs each event as JSON to URL. Any 2xx is acceptance; anything
+// else, or no answer, is a failure and the event is retried.
+//
+// The event ID is sent as Idempotency-Key. With a Secret the body is signed
+// exactly as webhook deliveries are (webhook.SignatureHeader), so a receiver
+// already verifying those verifies these with the same code.
+type HTTPSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewHTTPSink returns an HTTPSink with a bounded client timeout.
+func NewHTTPSink(url, secret string) *HTTPSink {
+	return &HTTPSink{URL: url, Secret: secret, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSink) Publish(ctx context.Context, e *Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", e.ID)
+	if s.Secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(webhook.SignatureHeader, "t="+strconv.FormatInt(ts, 10)+",v1="+webhook.Sign(s.Secret, ts, body))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post %s: %w", e.Type, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post %s: %s", e.Type, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/webhook"
+)
+
+func TestHTTPSink_SignsAndCarriesEventID(t *testing.T) {
+	var (
+		gotKey, gotSig string
+		gotBody        []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("Idempotency-Key")
+		gotSig = r.Header.Get(webhook.SignatureHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	e := &Event{ID: "evt_1", Type: "order.paid", AggregateType: "order", AggregateID: "ord_1", Sequence: 2, Data: json.RawMessage(`{}`)}
+	if err := NewHTTPSink(srv.URL, "whsec_test").Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if gotKey != "evt_1" {
+		t.Fatalf("Idempotency-Key = %q", gotKey)
+	}
+	if err := webhook.Verify(gotSig, "whsec_test", gotBody, time.Minute); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
+
+func TestHTTPSink_NonSuccessIsFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if err := NewHTTPSink(srv.URL, "").Publish(context.Background(), &Event{ID: "evt_1", Type: "order.paid"}); err == nil {
+		t.Fatal("a 503 was taken as delivered")
+	}
+}
+
+type memProducer struct {
+	topic   string
+	key     []byte
+	headers map[string]string
+}
+
+func (p *memProducer) Produce(_ context.Context, topic string, key, _ []byte, headers map[string]string) error {
+	p.topic, p.key, p.headers = topic, key, headers
+	return nil
+}
+
+// The aggregate is the message key, so a partitioned broker keeps it in order.
+func TestBrokerSink_KeysByAggregate(t *testing.T) {
+	p := &memProducer{}
+	e := &Event{ID: "evt_1", Type: "invoice.paid", OrganizationID: "acme", AggregateType: "billing-invoice", AggregateID: "inv_1", Sequence: 3}
+	if err := (&BrokerSink{Producer: p}).Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if p.topic != "commerce.invoice.paid" || string(p.key) != "acme/billing-invoice/inv_1" {
+		t.Fatalf("topic %q key %q", p.topic, p.key)
+	}
+	if p.headers["event-id"] != "evt_1" || p.headers["event-sequence"] != "3" {
+		t.Fatalf("headers = %v", p.headers)
+	}
+}
@@ -0,0 +1,173 @@
+// Package fulfillment is how orders are shipped: the warehouses and carriers
+// a merchant ships through, behind one Provider interface, so that what
+// quotes a rate at checkout, buys the label and reports where the parcel is
+// can be ShipStation, Shipwire or the merchant packing boxes themselves
+// without the caller knowing which.
+//
+// A merchant's fulfillmentprovider names the Provider by its registered name
+// (see Register); shipping options with a calculated price are quoted by the
+// provider they name, and a fulfillment is shipped, cancelled and tracked
+// through the provider it was made with. Tracking comes back as events on
+// the fulfillment, and onto its order (see Record).
+package fulfillment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+var (
+	// ErrUnsupported is returned by a provider for what it cannot do, such
+	// as validating addresses or quoting rates; callers fall back to what
+	// they would do without it.
+	ErrUnsupported = errors.New("fulfillment: not supported by provider")
+
+	// ErrUnknownProvider is returned for a provider name nothing registered.
+	ErrUnknownProvider = errors.New("fulfillment: no provider registered named")
+
+	// ErrAddress is returned for an address a parcel cannot be delivered
+	// to.
+	ErrAddress = errors.New("fulfillment: address cannot be delivered to")
+
+	// ErrDisabled is returned for a fulfillmentprovider the merchant turned
+	// off.
+	ErrDisabled = errors.New("fulfillment: provider is disabled")
+)
+
+// Address is where a parcel goes from or to.
+type Address struct {
+	Name       string `json:"name,omitempty"`
+	Company    string `json:"company,omitempty"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone,omitempty"`
+	Email      string `json:"email,omitempty"`
+
+	// Residential is a home rather than business address, which carriers
+	// charge more to deliver to.
+	Residential bool `json:"residential,omitempty"`
+}
+
+// Item is some of a product in a parcel.
+type Item struct {
+	LineItemId string `json:"lineItemId,omitempty"`
+	SKU        string `json:"sku"`
+	Title      string `json:"title,omitempty"`
+	Quantity   int    `json:"quantity"`
+
+	// Weight is of one, in grams, and Value what one sold for, for customs.
+	Weight float64        `json:"weight,omitempty"`
+	Value  currency.Cents `json:"value,omitempty"`
+}
+
+// Parcel is a box of items. Providers that pack for themselves, as a
+// warehouse does, use only its items.
+type Parcel struct {
+	Items []Item `json:"items"`
+
+	// Weight is the whole parcel's, in grams, and Length, Width and Height
+	// its outside dimensions in centimetres; zero for the provider to work
+	// out.
+	Weight float64 `json:"weight,omitempty"`
+	Length float64 `json:"length,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+}
+
+// Request is parcels to ship from one address to another, to quote, buy a
+// label for, or return.
+type Request struct {
+	// Reference is the order the parcels are of, and Number its number,
+	// which warehouses and carriers print and report back.
+	Reference string `json:"reference,omitempty"`
+	Number    int    `json:"number,omitempty"`
+
+	From     Address       `json:"from"`
+	To       Address       `json:"to"`
+	Parcels  []Parcel      `json:"parcels"`
+	Currency currency.Type `json:"currency,omitempty"`
+
+	// Carrier and Service are what to ship with, as a Rate named them;
+	// empty for the provider's cheapest.
+	Carrier string `json:"carrier,omitempty"`
+	Service string `json:"service,omitempty"`
+}
+
+// Items is every item in the request's parcels.
+func (r *Request) Items() []Item {
+	var items []Item
+	for _, p := range r.Parcels {
+		items = append(items, p.Items...)
+	}
+	return items
+}
+
+// Rate is what a carrier service costs to ship a request.
+type Rate struct {
+	Provider    string         `json:"provider"`
+	Carrier     string         `json:"carrier"`
+	Service     string         `json:"service"`
+	Name        string         `json:"name,omitempty"`
+	Amount      currency.Cents `json:"amount"`
+	Currency    currency.Type  `json:"currency"`
+	MinDays     int            `json:"minDays,omitempty"`
+	MaxDays     int            `json:"maxDays,omitempty"`
+	DeliveredBy time.Time      `json:"deliveredBy,omitempty"`
+}
+
+// Shipment is a request as a provider took it: labels bought, or an order
+// handed to a warehouse to pick, pack and label.
+type Shipment struct {
+	// Id is the provider's, for cancelling and tracking it.
+	Id      string         `json:"id"`
+	Carrier string         `json:"carrier,omitempty"`
+	Service string         `json:"service,omitempty"`
+	Cost    currency.Cents `json:"cost,omitempty"`
+
+	// Labels are empty for a warehouse until it ships, when Track finds
+	// them.
+	Labels []fulfillmentmodel.FulfillmentLabel `json:"labels,omitempty"`
+}
+
+// Tracking is where a shipment is, as its carrier last scanned it.
+type Tracking struct {
+	Status fulfillmentmodel.TrackingStatus     `json:"status"`
+	Labels []fulfillmentmodel.FulfillmentLabel `json:"labels,omitempty"`
+	Events []fulfillmentmodel.FulfillmentEvent `json:"events,omitempty"`
+}
+
+// Provider ships through a warehouse or carrier service. Each is opened for
+// one merchant, with its credentials (see Factory).
+type Provider interface {
+	// Name is what a fulfillmentprovider calls it.
+	Name() string
+
+	// ValidateAddress returns addr corrected as the carrier would deliver
+	// to it, or an error why it cannot be.
+	ValidateAddress(ctx context.Context, addr Address) (Address, error)
+
+	// Rates quotes the services that can ship req.
+	Rates(ctx context.Context, req *Request) ([]Rate, error)
+
+	// CreateShipment buys labels for req, or has it shipped.
+	CreateShipment(ctx context.Context, req *Request) (*Shipment, error)
+
+	// CancelShipment voids a shipment's labels, or cancels it with the
+	// warehouse, if it has not gone.
+	CancelShipment(ctx context.Context, id string) error
+
+	// Track is where a shipment is.
+	Track(ctx context.Context, id string) (*Tracking, error)
+
+	// CreateReturnLabel buys a label for the customer to send req back, from
+	// req.To to req.From; shipment is the one being returned.
+	CreateReturnLabel(ctx context.Context, shipment string, req *Request) (*Shipment, error)
+}
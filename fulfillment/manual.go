@@ -0,0 +1,80 @@
+package fulfillment
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hanzoai/commerce/models/fulfillmentprovider"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/util/json"
+)
+
+// ManualName is the name of Manual.
+const ManualName = "manual"
+
+// Manual is the merchant shipping by hand, or handing over at a counter:
+// nothing is bought or tracked, and labels are what the merchant enters when
+// marking a fulfillment shipped. It is the provider of fulfillments that
+// name none.
+//
+// It quotes the flat rates in its fulfillmentprovider's metadata, under
+// "rates", for calculated shipping options that name it:
+//
+//	{"rates": [{"service": "local", "name": "Local delivery", "amount": 500}]}
+type Manual struct {
+	FlatRates []Rate
+}
+
+func openManual(org *organization.Organization, cfg *fulfillmentprovider.FulfillmentProvider) (Provider, error) {
+	m := &Manual{}
+	if rates, ok := cfg.Metadata["rates"]; ok {
+		if err := json.DecodeBytes(json.EncodeBytes(rates), &m.FlatRates); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Manual) Name() string { return ManualName }
+
+// ValidateAddress checks addr has what a parcel needs to be delivered, and
+// no more: there is no carrier to ask.
+func (m *Manual) ValidateAddress(ctx context.Context, addr Address) (Address, error) {
+	addr.Country = strings.ToUpper(strings.TrimSpace(addr.Country))
+	if strings.TrimSpace(addr.Line1) == "" || strings.TrimSpace(addr.City) == "" || len(addr.Country) != 2 {
+		return addr, ErrAddress
+	}
+	return addr, nil
+}
+
+func (m *Manual) Rates(ctx context.Context, req *Request) ([]Rate, error) {
+	if len(m.FlatRates) == 0 {
+		return nil, ErrUnsupported
+	}
+	rates := make([]Rate, len(m.FlatRates))
+	for i, r := range m.FlatRates {
+		r.Provider = ManualName
+		if r.Carrier == "" {
+			r.Carrier = ManualName
+		}
+		r.Currency = req.Currency
+		rates[i] = r
+	}
+	return rates, nil
+}
+
+// CreateShipment takes the shipment as the merchant's to ship; there is no
+// label to buy.
+func (m *Manual) CreateShipment(ctx context.Context, req *Request) (*Shipment, error) {
+	return &Shipment{Carrier: req.Carrier, Service: req.Service}, nil
+}
+
+func (m *Manual) CancelShipment(ctx context.Context, id string) error { return nil }
+
+func (m *Manual) Track(ctx context.Context, id string) (*Tracking, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *Manual) CreateReturnLabel(ctx context.Context, shipment string, req *Request) (*Shipment, error) {
+	return nil, ErrUnsupported
+}
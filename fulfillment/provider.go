@@ -0,0 +1,64 @@
+package fulfillment
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/fulfillmentprovider"
+	"github.com/hanzoai/commerce/models/organization"
+)
+
+// Factory opens the provider of one merchant, with the credentials in its
+// organization's integrations and the settings of its fulfillmentprovider.
+type Factory func(org *organization.Organization, cfg *fulfillmentprovider.FulfillmentProvider) (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{ManualName: openManual}
+)
+
+// Register makes f open the provider of every fulfillmentprovider named
+// name, replacing any registered under that name before. Adapters register
+// themselves from init.
+func Register(name string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = f
+}
+
+// Registered reports whether a provider is registered under name.
+func Registered(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Open opens the provider of the fulfillmentprovider with id in db, for
+// org. No id is the merchant shipping by hand, Manual.
+func Open(db *datastore.Datastore, org *organization.Organization, id string) (Provider, error) {
+	cfg := fulfillmentprovider.New(db)
+	if id == "" {
+		cfg.Name = ManualName
+		return OpenConfig(org, cfg)
+	}
+	if err := cfg.GetById(id); err != nil {
+		return nil, fmt.Errorf("fulfillment: provider %s: %w", id, err)
+	}
+	if !cfg.IsEnabled {
+		return nil, fmt.Errorf("%w: %s", ErrDisabled, cfg.Name)
+	}
+	return OpenConfig(org, cfg)
+}
+
+// OpenConfig opens the provider cfg names, for org.
+func OpenConfig(org *organization.Organization, cfg *fulfillmentprovider.FulfillmentProvider) (Provider, error) {
+	factoriesMu.RLock()
+	f, ok := factories[cfg.Name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, cfg.Name)
+	}
+	return f(org, cfg)
+}
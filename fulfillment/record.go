@@ -0,0 +1,204 @@
+package fulfillment
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/stocklocation"
+	"github.com/hanzoai/commerce/models/store"
+	orderfulfillment "github.com/hanzoai/commerce/models/types/fulfillment"
+	"github.com/hanzoai/commerce/types"
+)
+
+// AddressOf is a to or from address as fulfillment takes it.
+func AddressOf(a types.Address) Address {
+	return Address{
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+// OrderRequest is the request to ship f's items of ord from from, in one
+// parcel; a fulfillment without items ships all of the order's.
+func OrderRequest(ord *order.Order, f *fulfillmentmodel.Fulfillment, from Address) *Request {
+	to := AddressOf(ord.ShippingAddress)
+	to.Email = ord.Email
+
+	var parcel Parcel
+	if len(f.Items) > 0 {
+		for _, it := range f.Items {
+			parcel.Items = append(parcel.Items, Item{LineItemId: it.LineItemId, SKU: it.SKU, Title: it.Title, Quantity: it.Quantity})
+		}
+	} else {
+		for _, li := range ord.Items {
+			parcel.Items = append(parcel.Items, Item{SKU: li.SKU(), Title: li.DisplayName(), Quantity: li.Quantity, Value: li.Price})
+		}
+	}
+
+	return &Request{
+		Reference: ord.Id(),
+		Number:    ord.Number,
+		From:      from,
+		To:        to,
+		Parcels:   []Parcel{parcel},
+		Currency:  ord.Currency,
+	}
+}
+
+// Shipped records s, as a provider took f's request, on f.
+func Shipped(f *fulfillmentmodel.Fulfillment, s *Shipment) {
+	f.ExternalId = s.Id
+	f.Labels = mergeLabels(f.Labels, s.Labels)
+	if len(s.Labels) > 0 && f.TrackingStatus == "" {
+		f.TrackingStatus = fulfillmentmodel.LabelCreated
+	}
+}
+
+// Record puts tracking from f's provider onto f and onto ord, its order,
+// for the caller to save: new labels and scans onto f, where the parcel is,
+// when it was shipped and delivered; and the same onto the order's
+// fulfillment, which is what the customer's order page and shipping emails
+// read. Scans already recorded are not recorded again, so tracking can be
+// recorded as often as it is polled or pushed.
+func Record(ord *order.Order, f *fulfillmentmodel.Fulfillment, t *Tracking) {
+	f.Labels = mergeLabels(f.Labels, t.Labels)
+	f.Events = mergeEvents(f.Events, t.Events)
+	if t.Status != "" {
+		f.TrackingStatus = t.Status
+	}
+
+	for _, e := range f.Events {
+		switch e.Status {
+		case fulfillmentmodel.InTransit, fulfillmentmodel.OutForDelivery:
+			if f.ShippedAt == nil {
+				at := e.At
+				f.ShippedAt = &at
+			}
+		case fulfillmentmodel.Delivered:
+			if f.DeliveredAt == nil {
+				at := e.At
+				f.DeliveredAt = &at
+			}
+		}
+	}
+
+	if ord == nil {
+		return
+	}
+	for _, l := range f.Labels {
+		if l.TrackingNumber == "" {
+			continue
+		}
+		trk := orderTracking(ord, l.TrackingNumber)
+		trk.Url = l.TrackingUrl
+		for _, e := range f.Events {
+			if e.TrackingNumber != "" && e.TrackingNumber != l.TrackingNumber {
+				continue
+			}
+			trk.Summary, trk.SummaryAt = e.Description, e.At
+			switch e.Status {
+			case fulfillmentmodel.LabelCreated:
+				trk.LabelCreatedAt = e.At
+			case fulfillmentmodel.Delivered:
+				trk.DeliveredAt = e.At
+			default:
+				if trk.FirstScanAt.IsZero() {
+					trk.FirstScanAt = e.At
+				}
+			}
+		}
+	}
+
+	switch f.TrackingStatus {
+	case fulfillmentmodel.Delivered:
+		ord.Fulfillment.Status = orderfulfillment.Delivered
+	case fulfillmentmodel.ReturnedToSender:
+		ord.Fulfillment.Status = orderfulfillment.Returned
+	case fulfillmentmodel.LabelCreated, fulfillmentmodel.InTransit, fulfillmentmodel.OutForDelivery, fulfillmentmodel.Exception:
+		if ord.Fulfillment.Status != orderfulfillment.Delivered {
+			ord.Fulfillment.Status = orderfulfillment.Tracked
+		}
+	}
+}
+
+// orderTracking is ord's tracking of a number, added if it has none.
+func orderTracking(ord *order.Order, number string) *orderfulfillment.Tracking {
+	for i := range ord.Fulfillment.Trackings {
+		if ord.Fulfillment.Trackings[i].Number == number {
+			return &ord.Fulfillment.Trackings[i]
+		}
+	}
+	ord.Fulfillment.Trackings = append(ord.Fulfillment.Trackings, orderfulfillment.Tracking{Number: number, CreatedAt: time.Now()})
+	return &ord.Fulfillment.Trackings[len(ord.Fulfillment.Trackings)-1]
+}
+
+func mergeLabels(have, labels []fulfillmentmodel.FulfillmentLabel) []fulfillmentmodel.FulfillmentLabel {
+next:
+	for _, l := range labels {
+		for i := range have {
+			if have[i].TrackingNumber == l.TrackingNumber {
+				if l.TrackingUrl != "" {
+					have[i].TrackingUrl = l.TrackingUrl
+				}
+				if l.LabelUrl != "" {
+					have[i].LabelUrl = l.LabelUrl
+				}
+				continue next
+			}
+		}
+		have = append(have, l)
+	}
+	return have
+}
+
+// mergeEvents is have and the events not in it, in the order they happened.
+func mergeEvents(have, events []fulfillmentmodel.FulfillmentEvent) []fulfillmentmodel.FulfillmentEvent {
+next:
+	for _, e := range events {
+		for _, h := range have {
+			if h.TrackingNumber == e.TrackingNumber && h.Status == e.Status && h.At.Equal(e.At) {
+				continue next
+			}
+		}
+		have = append(have, e)
+	}
+	sort.SliceStable(have, func(i, j int) bool { return have[i].At.Before(have[j].At) })
+	return have
+}
+
+// ShipFrom is where f ships from: its stock location, or else the address of
+// the store ord was placed in.
+func ShipFrom(db *datastore.Datastore, ord *order.Order, f *fulfillmentmodel.Fulfillment) Address {
+	if f.LocationId != "" {
+		loc := stocklocation.New(db)
+		if err := loc.GetById(f.LocationId); err == nil {
+			return Address{
+				Name:       loc.Name,
+				Line1:      loc.AddressLine1,
+				Line2:      loc.AddressLine2,
+				City:       loc.City,
+				State:      loc.Province,
+				PostalCode: loc.PostalCode,
+				Country:    loc.Country,
+				Phone:      loc.Phone,
+			}
+		}
+	}
+	if ord.StoreId != "" {
+		stor := store.New(db)
+		if err := stor.GetById(ord.StoreId); err == nil {
+			from := AddressOf(stor.Address)
+			from.Company = stor.Name
+			return from
+		}
+	}
+	return Address{}
+}
@@ -0,0 +1,97 @@
+package fulfillment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/order"
+	orderfulfillment "github.com/hanzoai/commerce/models/types/fulfillment"
+)
+
+func TestRecord(t *testing.T) {
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	ord := &order.Order{}
+	f := &fulfillmentmodel.Fulfillment{}
+
+	Shipped(f, &Shipment{Id: "42", Labels: []fulfillmentmodel.FulfillmentLabel{{TrackingNumber: "1Z1"}}})
+	if f.ExternalId != "42" || f.TrackingStatus != fulfillmentmodel.LabelCreated {
+		t.Fatalf("shipped: %q %q", f.ExternalId, f.TrackingStatus)
+	}
+
+	trk := &Tracking{
+		Status: fulfillmentmodel.InTransit,
+		Labels: []fulfillmentmodel.FulfillmentLabel{{TrackingNumber: "1Z1", TrackingUrl: "https://track/1Z1"}},
+		Events: []fulfillmentmodel.FulfillmentEvent{
+			{TrackingNumber: "1Z1", Status: fulfillmentmodel.InTransit, Description: "Departed", At: day.Add(24 * time.Hour)},
+			{TrackingNumber: "1Z1", Status: fulfillmentmodel.LabelCreated, Description: "Label created", At: day},
+		},
+	}
+	Record(ord, f, trk)
+	Record(ord, f, trk)
+
+	if len(f.Labels) != 1 || f.Labels[0].TrackingUrl != "https://track/1Z1" {
+		t.Errorf("labels = %+v", f.Labels)
+	}
+	if len(f.Events) != 2 || f.Events[0].Status != fulfillmentmodel.LabelCreated {
+		t.Errorf("events = %+v", f.Events)
+	}
+	if f.ShippedAt == nil || !f.ShippedAt.Equal(day.Add(24*time.Hour)) {
+		t.Errorf("shippedAt = %v", f.ShippedAt)
+	}
+	if ord.Fulfillment.Status != orderfulfillment.Tracked {
+		t.Errorf("order status = %q", ord.Fulfillment.Status)
+	}
+	if n := len(ord.Fulfillment.Trackings); n != 1 {
+		t.Fatalf("order trackings = %d", n)
+	}
+	ot := ord.Fulfillment.Trackings[0]
+	if ot.Summary != "Departed" || !ot.LabelCreatedAt.Equal(day) || !ot.FirstScanAt.Equal(day.Add(24*time.Hour)) {
+		t.Errorf("order tracking = %+v", ot)
+	}
+
+	Record(ord, f, &Tracking{
+		Status: fulfillmentmodel.Delivered,
+		Events: []fulfillmentmodel.FulfillmentEvent{{TrackingNumber: "1Z1", Status: fulfillmentmodel.Delivered, Description: "Delivered", At: day.Add(72 * time.Hour)}},
+	})
+	if f.DeliveredAt == nil || ord.Fulfillment.Status != orderfulfillment.Delivered {
+		t.Errorf("delivered: %v %q", f.DeliveredAt, ord.Fulfillment.Status)
+	}
+	if !ord.Fulfillment.Trackings[0].DeliveredAt.Equal(day.Add(72 * time.Hour)) {
+		t.Errorf("order tracking deliveredAt = %v", ord.Fulfillment.Trackings[0].DeliveredAt)
+	}
+}
+
+func TestRecord_NoOrder(t *testing.T) {
+	f := &fulfillmentmodel.Fulfillment{}
+	Record(nil, f, &Tracking{Status: fulfillmentmodel.Exception})
+	if f.TrackingStatus != fulfillmentmodel.Exception {
+		t.Errorf("status = %q", f.TrackingStatus)
+	}
+}
+
+func TestManual(t *testing.T) {
+	m := &Manual{FlatRates: []Rate{{Service: "local", Name: "Local delivery", Amount: 500}}}
+
+	rates, err := m.Rates(context.Background(), &Request{Currency: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].Provider != ManualName || rates[0].Carrier != ManualName || rates[0].Currency != "usd" {
+		t.Errorf("rates = %+v", rates)
+	}
+
+	if _, err := (&Manual{}).Rates(context.Background(), &Request{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("no rates: %v", err)
+	}
+
+	addr, err := m.ValidateAddress(context.Background(), Address{Line1: "1 Main St", City: "Austin", Country: " us"})
+	if err != nil || addr.Country != "US" {
+		t.Errorf("valid address: %q %v", addr.Country, err)
+	}
+	if _, err := m.ValidateAddress(context.Background(), Address{City: "Austin", Country: "US"}); !errors.Is(err, ErrAddress) {
+		t.Errorf("no street: %v", err)
+	}
+}
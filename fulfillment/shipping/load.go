@@ -0,0 +1,272 @@
+package shipping
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/cart"
+	"github.com/hanzoai/commerce/models/geozone"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/promotion/engine"
+	"github.com/hanzoai/commerce/models/shippingoption"
+	"github.com/hanzoai/commerce/models/shippingoptionrule"
+	"github.com/hanzoai/commerce/models/shippingprofile"
+	"github.com/hanzoai/commerce/models/store"
+	"github.com/hanzoai/commerce/models/types/weight"
+)
+
+// Options returns the shipping options car can ship with, priced and
+// cheapest first.
+//
+// A calculated option its provider cannot quote, or quotes in another
+// currency than the cart's, is left out rather than failing the rest: a
+// carrier being down should cost the shopper one option, not checkout.
+func Options(ctx context.Context, db *datastore.Datastore, org *organization.Organization, car *cart.Cart) ([]Option, error) {
+	c, err := CartOf(db, car)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := Load(db)
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := engine.Load(db, car.CouponCodes)
+	if err != nil {
+		return nil, err
+	}
+	promoCart := &engine.Cart{
+		Currency:         string(car.Currency),
+		CustomerId:       car.UserId,
+		CustomerGroupIds: c.CustomerGroupIds,
+		SalesChannelId:   car.SalesChannelId,
+		RegionId:         car.RegionId,
+		Codes:            car.CouponCodes,
+		Items:            engine.LineItems(car.Items),
+	}
+	now := time.Now()
+
+	var req *fulfillment.Request
+	options := make([]Option, 0, len(candidates))
+	for _, cand := range Eligible(c, candidates) {
+		opt := cand.Option
+		o := Option{
+			Id:         opt.Id(),
+			Name:       opt.Name,
+			PriceType:  opt.PriceType,
+			ProfileId:  opt.ProfileId,
+			ProviderId: opt.ProviderId,
+			Currency:   car.Currency,
+		}
+
+		if opt.PriceType == shippingoption.Calculated {
+			if req == nil {
+				req = request(db, car)
+			}
+			rate, err := quote(ctx, db, org, opt, req)
+			if err != nil {
+				log.Warn("shipping: option %s of cart %s not quoted: %v", opt.Id(), car.Id(), err, ctx)
+				continue
+			}
+			o.Amount = rate.Amount
+			o.Carrier, o.Service = rate.Carrier, rate.Service
+			o.MinDays, o.MaxDays = rate.MinDays, rate.MaxDays
+		} else {
+			o.Amount = Price(c, opt)
+		}
+
+		promoCart.Shipping = o.Amount
+		o.Discount = engine.Evaluate(promoCart, promotions, now).ShippingDiscount
+		o.Total = o.Amount - o.Discount
+		options = append(options, o)
+	}
+
+	Sort(options)
+	return options, nil
+}
+
+// CartOf is car as shipping sees it. Items without a shipping profile ship
+// under the store's default profile.
+func CartOf(db *datastore.Datastore, car *cart.Cart) (*Cart, error) {
+	groups, err := engine.CustomerGroups(db, car.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaults []*shippingprofile.ShippingProfile
+	if _, err := shippingprofile.Query(db).Filter("Type=", "default").Limit(1).GetAll(&defaults); err != nil {
+		return nil, err
+	}
+	var defaultProfile string
+	if len(defaults) > 0 {
+		defaultProfile = defaults[0].Id()
+	}
+
+	c := &Cart{
+		Currency:         car.Currency,
+		Subtotal:         car.Subtotal,
+		CustomerGroupIds: groups,
+		Destination: allocation.Destination{
+			Country:    car.ShippingAddress.Country,
+			Province:   car.ShippingAddress.State,
+			City:       car.ShippingAddress.City,
+			PostalCode: car.ShippingAddress.PostalCode,
+		},
+	}
+	for i := range car.Items {
+		li := &car.Items[i]
+		if li.Free || li.IsSubscribeable {
+			continue
+		}
+		// The profile is on the product; a line item only keeps it in
+		// memory for the request that added it.
+		if li.Product == nil && li.ProductId != "" {
+			p := product.New(db)
+			if err := p.GetById(li.ProductId); err == nil {
+				li.Product = p
+			}
+		}
+		it := Item{
+			Id:        li.Id(),
+			ProfileId: defaultProfile,
+			Quantity:  li.Quantity,
+			UnitPrice: li.Price,
+			Weight:    grams(*li),
+		}
+		if li.Product != nil && li.Product.ShippingProfileId != "" {
+			it.ProfileId = li.Product.ShippingProfileId
+		}
+		c.Items = append(c.Items, it)
+	}
+	return c, nil
+}
+
+// grams is the weight of one unit of li. A weight with no unit is in grams.
+func grams(li lineitem.LineItem) float64 {
+	if li.WeightUnit == "" {
+		return float64(li.Weight)
+	}
+	return float64(weight.Convert(li.Weight, li.WeightUnit, weight.Gram))
+}
+
+// Load fetches every shipping option with its rules and the geo zones of
+// its service zone.
+func Load(db *datastore.Datastore) ([]Candidate, error) {
+	var opts []*shippingoption.ShippingOption
+	if _, err := shippingoption.Query(db).GetAll(&opts); err != nil {
+		return nil, err
+	}
+
+	zones := make(map[string][]allocation.Zone)
+	candidates := make([]Candidate, 0, len(opts))
+	for _, opt := range opts {
+		var rules []*shippingoptionrule.ShippingOptionRule
+		if _, err := shippingoptionrule.Query(db).Filter("ShippingOptionId=", opt.Id()).GetAll(&rules); err != nil {
+			return nil, err
+		}
+
+		c := Candidate{Option: opt, Rules: rules}
+		if opt.ServiceZoneId != "" {
+			z, seen := zones[opt.ServiceZoneId]
+			if !seen {
+				var gzs []*geozone.GeoZone
+				if _, err := geozone.Query(db).Filter("ServiceZoneId=", opt.ServiceZoneId).GetAll(&gzs); err != nil {
+					return nil, err
+				}
+				for _, g := range gzs {
+					z = append(z, allocation.Zone{
+						Type:             g.Type,
+						CountryCode:      g.CountryCode,
+						ProvinceCode:     g.ProvinceCode,
+						City:             g.City,
+						PostalExpression: g.PostalExpression,
+					})
+				}
+				zones[opt.ServiceZoneId] = z
+			}
+			c.Zones = z
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// request is car as a fulfillment provider quotes it: every item in one
+// parcel, from the store's address.
+func request(db *datastore.Datastore, car *cart.Cart) *fulfillment.Request {
+	req := &fulfillment.Request{
+		Reference: car.Id(),
+		To:        fulfillment.AddressOf(car.ShippingAddress),
+		Currency:  car.Currency,
+	}
+	req.To.Email = car.Email
+	req.To.Company = car.Company
+
+	if car.StoreId != "" {
+		stor := store.New(db)
+		if err := stor.GetById(car.StoreId); err == nil {
+			req.From = fulfillment.AddressOf(stor.Address)
+			req.From.Company = stor.Name
+		}
+	}
+
+	var parcel fulfillment.Parcel
+	for _, li := range car.Items {
+		if li.Free || li.IsSubscribeable {
+			continue
+		}
+		parcel.Items = append(parcel.Items, fulfillment.Item{
+			SKU:      li.SKU(),
+			Title:    li.DisplayName(),
+			Quantity: li.Quantity,
+			Weight:   grams(li),
+			Value:    li.Price,
+		})
+	}
+	req.Parcels = []fulfillment.Parcel{parcel}
+	return req
+}
+
+// quote is the rate opt's provider quotes for req: the rate of the carrier
+// and service the option names, or the cheapest in the cart's currency.
+func quote(ctx context.Context, db *datastore.Datastore, org *organization.Organization, opt *shippingoption.ShippingOption, req *fulfillment.Request) (*fulfillment.Rate, error) {
+	p, err := fulfillment.Open(db, org, opt.ProviderId)
+	if err != nil {
+		return nil, err
+	}
+
+	carrier, service := opt.Service()
+	r := *req
+	r.Carrier, r.Service = carrier, service
+	rates, err := p.Rates(ctx, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *fulfillment.Rate
+	for i := range rates {
+		rate := &rates[i]
+		if !strings.EqualFold(string(rate.Currency), string(req.Currency)) {
+			continue
+		}
+		if carrier != "" && rate.Carrier != carrier {
+			continue
+		}
+		if service != "" && rate.Service != service {
+			continue
+		}
+		if best == nil || rate.Amount < best.Amount {
+			best = rate
+		}
+	}
+	if best == nil {
+		return nil, fulfillment.ErrUnsupported
+	}
+	return best, nil
+}
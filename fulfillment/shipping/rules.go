@@ -0,0 +1,146 @@
+package shipping
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hanzoai/commerce/models/shippingoptionrule"
+)
+
+// Attributes a shipping option rule can test. Subtotal is in cents and
+// weight in grams.
+const (
+	AttrSubtotal      = "subtotal"
+	AttrWeight        = "weight"
+	AttrItemQuantity  = "item_quantity"
+	AttrCustomerGroup = "customer_group"
+	AttrCountry       = "country"
+	AttrProvince      = "province"
+	AttrCurrency      = "currency"
+)
+
+// Operators. eq/in and ne/nin are the same test, whether any of the
+// attribute's values is among the rule's, which are comma separated. The
+// ordered ones compare a number.
+const (
+	OpEq  = "eq"
+	OpNe  = "ne"
+	OpIn  = "in"
+	OpNin = "nin"
+	OpGt  = "gt"
+	OpGte = "gte"
+	OpLt  = "lt"
+	OpLte = "lte"
+)
+
+type subject struct {
+	strings map[string][]string
+	numbers map[string]int64
+}
+
+func cartSubject(c *Cart) subject {
+	return subject{
+		strings: map[string][]string{
+			AttrCustomerGroup: c.CustomerGroupIds,
+			AttrCountry:       nonEmpty(strings.ToUpper(c.Destination.Country)),
+			AttrProvince:      nonEmpty(strings.ToUpper(c.Destination.Province)),
+			AttrCurrency:      nonEmpty(strings.ToLower(string(c.Currency))),
+		},
+		numbers: map[string]int64{
+			AttrSubtotal:     int64(c.Subtotal),
+			AttrWeight:       int64(c.Weight()),
+			AttrItemQuantity: int64(c.Quantity()),
+		},
+	}
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+// matchAll reports whether every rule holds for s. No rules is a match.
+func matchAll(rules []*shippingoptionrule.ShippingOptionRule, s subject) bool {
+	for _, r := range rules {
+		if !match(r, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// match tests one rule. A rule naming an attribute or operator this package
+// does not know fails, so an option is never offered past a condition that
+// could not be read.
+func match(r *shippingoptionrule.ShippingOptionRule, s subject) bool {
+	attr := strings.ToLower(r.Attribute)
+	op := strings.ToLower(r.Operator)
+	if op == "" {
+		op = OpEq
+	}
+	values := split(r.Value)
+	if len(values) == 0 {
+		return false
+	}
+
+	if n, ok := s.numbers[attr]; ok {
+		if op == OpIn || op == OpNin || op == OpEq || op == OpNe {
+			in := false
+			for _, v := range values {
+				if want, err := strconv.ParseInt(v, 10, 64); err == nil && want == n {
+					in = true
+					break
+				}
+			}
+			return in == (op == OpIn || op == OpEq)
+		}
+		want, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case OpGt:
+			return n > want
+		case OpGte:
+			return n >= want
+		case OpLt:
+			return n < want
+		case OpLte:
+			return n <= want
+		}
+		return false
+	}
+
+	have, ok := s.strings[attr]
+	if !ok {
+		return false
+	}
+	in := false
+	for _, h := range have {
+		for _, v := range values {
+			if strings.EqualFold(h, v) {
+				in = true
+			}
+		}
+	}
+	switch op {
+	case OpEq, OpIn:
+		return in
+	case OpNe, OpNin:
+		return !in
+	}
+	return false
+}
+
+// split is a rule's comma separated values, trimmed.
+func split(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+// Package shipping decides which shipping options a cart can ship with and
+// what each costs it.
+//
+// An option is offered when its service zone reaches the cart's address, its
+// shipping profile is one the cart's items ship under, and its rules hold for
+// the cart. It is priced flat, by tier of subtotal or weight, or by its
+// fulfillment provider's quote, and then shown with what the cart's shipping
+// promotions would take off it, so free shipping reads as free before the
+// shopper picks it.
+//
+// Eligible and Price are pure, as the promotion engine is; Options (load.go)
+// loads the cart's candidates, quotes the calculated ones and applies the
+// promotions.
+package shipping
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/shippingoption"
+	"github.com/hanzoai/commerce/models/shippingoptionrule"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// Item is one line of the cart as shipping sees it.
+type Item struct {
+	Id        string         `json:"id"`
+	ProfileId string         `json:"profileId,omitempty"`
+	Quantity  int            `json:"quantity"`
+	UnitPrice currency.Cents `json:"unitPrice"`
+
+	// Weight of one unit, in grams.
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// Cart is everything an option can be offered or priced on.
+type Cart struct {
+	Currency         currency.Type          `json:"currency"`
+	Subtotal         currency.Cents         `json:"subtotal"`
+	CustomerGroupIds []string               `json:"customerGroupIds,omitempty"`
+	Destination      allocation.Destination `json:"destination"`
+	Items            []Item                 `json:"items"`
+}
+
+// Weight is the cart's weight in grams.
+func (c *Cart) Weight() float64 {
+	var w float64
+	for _, it := range c.Items {
+		w += it.Weight * float64(it.Quantity)
+	}
+	return w
+}
+
+// Quantity is the number of units in the cart.
+func (c *Cart) Quantity() int {
+	var n int
+	for _, it := range c.Items {
+		n += it.Quantity
+	}
+	return n
+}
+
+// Profiles are the shipping profiles the cart's items ship under.
+func (c *Cart) Profiles() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, it := range c.Items {
+		if !seen[it.ProfileId] {
+			seen[it.ProfileId] = true
+			out = append(out, it.ProfileId)
+		}
+	}
+	return out
+}
+
+// Candidate is a shipping option with where it ships and its rules.
+type Candidate struct {
+	Option *shippingoption.ShippingOption
+	Rules  []*shippingoptionrule.ShippingOptionRule
+
+	// Zones are the geo zones of the option's service zone. None is
+	// anywhere.
+	Zones []allocation.Zone
+}
+
+// Option is a shipping option offered to a cart, priced. Total is what the
+// shopper pays for it: Amount less the Discount promotions take off.
+type Option struct {
+	Id         string                   `json:"id"`
+	Name       string                   `json:"name"`
+	PriceType  shippingoption.PriceType `json:"priceType"`
+	ProfileId  string                   `json:"profileId,omitempty"`
+	ProviderId string                   `json:"providerId,omitempty"`
+
+	Amount   currency.Cents `json:"amount"`
+	Discount currency.Cents `json:"discount,omitempty"`
+	Total    currency.Cents `json:"total"`
+	Currency currency.Type  `json:"currency"`
+
+	// Carrier and service of a calculated option, as its provider quoted.
+	Carrier string `json:"carrier,omitempty"`
+	Service string `json:"service,omitempty"`
+	MinDays int    `json:"minDays,omitempty"`
+	MaxDays int    `json:"maxDays,omitempty"`
+}
+
+// Eligible returns the candidates cart can ship with, in the order given.
+func Eligible(cart *Cart, candidates []Candidate) []Candidate {
+	profiles := cart.Profiles()
+	s := cartSubject(cart)
+
+	out := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.Option.ProfileId != "" && !contains(profiles, c.Option.ProfileId) {
+			continue
+		}
+		if !reaches(c.Zones, cart.Destination) {
+			continue
+		}
+		if !matchAll(c.Rules, s) {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// reaches reports whether any of zones covers dest. A cart without an
+// address yet is reached by every option, so options can be shown before
+// the shopper has given one.
+func reaches(zones []allocation.Zone, dest allocation.Destination) bool {
+	if len(zones) == 0 || dest.Country == "" {
+		return true
+	}
+	for _, z := range zones {
+		if z.Covers(dest) {
+			return true
+		}
+	}
+	return false
+}
+
+// Price is what a flat or tiered option costs cart: a flat option its
+// Amount, a tiered one the amount of the highest tier the cart reaches, or
+// its Amount below the lowest. A calculated option is quoted by its
+// provider instead.
+func Price(cart *Cart, opt *shippingoption.ShippingOption) currency.Cents {
+	if opt.PriceType != shippingoption.Tiered || len(opt.Tiers) == 0 {
+		return opt.Amount
+	}
+
+	var measure int64
+	switch strings.ToLower(opt.TierBy) {
+	case shippingoption.TierByWeight:
+		measure = int64(cart.Weight())
+	default:
+		measure = int64(cart.Subtotal)
+	}
+
+	tiers := append([]shippingoption.Tier(nil), opt.Tiers...)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Min < tiers[j].Min })
+
+	amount := opt.Amount
+	for _, t := range tiers {
+		if measure < t.Min {
+			break
+		}
+		amount = t.Amount
+	}
+	return amount
+}
+
+// Sort orders options cheapest first, by name between equals.
+func Sort(options []Option) {
+	sort.SliceStable(options, func(i, j int) bool {
+		if options[i].Total != options[j].Total {
+			return options[i].Total < options[j].Total
+		}
+		return options[i].Name < options[j].Name
+	})
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package shipping
+
+import (
+	"testing"
+
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/shippingoption"
+	"github.com/hanzoai/commerce/models/shippingoptionrule"
+)
+
+func option(id string) *shippingoption.ShippingOption {
+	return &shippingoption.ShippingOption{Name: id, PriceType: shippingoption.FlatRate}
+}
+
+func rule(attr, op, value string) *shippingoptionrule.ShippingOptionRule {
+	return &shippingoptionrule.ShippingOptionRule{Attribute: attr, Operator: op, Value: value}
+}
+
+func ids(cs []Candidate) []string {
+	out := make([]string, len(cs))
+	for i, c := range cs {
+		out[i] = c.Option.Name
+	}
+	return out
+}
+
+func testCart() *Cart {
+	return &Cart{
+		Currency:    "usd",
+		Subtotal:    6000,
+		Destination: allocation.Destination{Country: "US", Province: "CA", PostalCode: "94103"},
+		Items: []Item{
+			{Id: "a", ProfileId: "default", Quantity: 2, UnitPrice: 2000, Weight: 500},
+			{Id: "b", ProfileId: "default", Quantity: 1, UnitPrice: 2000, Weight: 1000},
+		},
+	}
+}
+
+func TestEligible_Zones(t *testing.T) {
+	us := Candidate{Option: option("us"), Zones: []allocation.Zone{{Type: "country", CountryCode: "US"}}}
+	ca := Candidate{Option: option("ca"), Zones: []allocation.Zone{{Type: "province", CountryCode: "US", ProvinceCode: "CA"}}}
+	ny := Candidate{Option: option("ny"), Zones: []allocation.Zone{{Type: "province", CountryCode: "US", ProvinceCode: "NY"}}}
+	gb := Candidate{Option: option("gb"), Zones: []allocation.Zone{{Type: "country", CountryCode: "GB"}}}
+	anywhere := Candidate{Option: option("anywhere")}
+
+	got := ids(Eligible(testCart(), []Candidate{us, ca, ny, gb, anywhere}))
+	want := []string{"us", "ca", "anywhere"}
+	if len(got) != len(want) {
+		t.Fatalf("eligible = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("eligible = %v, want %v", got, want)
+		}
+	}
+
+	// Without an address every option is shown.
+	c := testCart()
+	c.Destination = allocation.Destination{}
+	if got := Eligible(c, []Candidate{us, ny, gb}); len(got) != 3 {
+		t.Errorf("no address: eligible = %v", ids(got))
+	}
+}
+
+func TestEligible_Profiles(t *testing.T) {
+	standard := option("standard")
+	standard.ProfileId = "default"
+	oversized := option("oversized")
+	oversized.ProfileId = "oversized"
+	unprofiled := option("unprofiled")
+
+	got := Eligible(testCart(), []Candidate{{Option: standard}, {Option: oversized}, {Option: unprofiled}})
+	if len(got) != 2 || got[0].Option != standard || got[1].Option != unprofiled {
+		t.Errorf("eligible = %v", ids(got))
+	}
+}
+
+func TestEligible_Rules(t *testing.T) {
+	for _, tc := range []struct {
+		rule *shippingoptionrule.ShippingOptionRule
+		want bool
+	}{
+		{rule(AttrSubtotal, OpGte, "5000"), true},
+		{rule(AttrSubtotal, OpLt, "5000"), false},
+		{rule(AttrWeight, OpLte, "2000"), true},
+		{rule(AttrWeight, OpGt, "2000"), false},
+		{rule(AttrItemQuantity, OpEq, "3"), true},
+		{rule(AttrCountry, OpIn, "us, ca"), true},
+		{rule(AttrCountry, OpNin, "US"), false},
+		{rule(AttrProvince, OpEq, "ca"), true},
+		{rule(AttrCustomerGroup, OpIn, "vip"), false},
+		{rule(AttrCurrency, OpNe, "eur"), true},
+		{rule("color", OpEq, "red"), false},
+		{rule(AttrSubtotal, "between", "1"), false},
+		{rule(AttrSubtotal, OpGt, ""), false},
+	} {
+		got := len(Eligible(testCart(), []Candidate{{Option: option("o"), Rules: []*shippingoptionrule.ShippingOptionRule{tc.rule}}})) == 1
+		if got != tc.want {
+			t.Errorf("%s %s %q: eligible = %v, want %v", tc.rule.Attribute, tc.rule.Operator, tc.rule.Value, got, tc.want)
+		}
+	}
+
+	c := testCart()
+	c.CustomerGroupIds = []string{"wholesale", "vip"}
+	r := []*shippingoptionrule.ShippingOptionRule{rule(AttrCustomerGroup, OpIn, "vip")}
+	if len(Eligible(c, []Candidate{{Option: option("o"), Rules: r}})) != 1 {
+		t.Error("customer group rule did not match a member")
+	}
+}
+
+func TestPrice(t *testing.T) {
+	c := testCart()
+
+	flat := option("flat")
+	flat.Amount = 800
+	if got := Price(c, flat); got != 800 {
+		t.Errorf("flat = %d", got)
+	}
+
+	bySubtotal := option("subtotal")
+	bySubtotal.PriceType = shippingoption.Tiered
+	bySubtotal.TierBy = shippingoption.TierBySubtotal
+	bySubtotal.Amount = 1200
+	bySubtotal.Tiers = []shippingoption.Tier{{Min: 10000, Amount: 0}, {Min: 5000, Amount: 500}}
+	if got := Price(c, bySubtotal); got != 500 {
+		t.Errorf("subtotal tier = %d, want 500", got)
+	}
+	c.Subtotal = 12000
+	if got := Price(c, bySubtotal); got != 0 {
+		t.Errorf("free tier = %d, want 0", got)
+	}
+	c.Subtotal = 1000
+	if got := Price(c, bySubtotal); got != 1200 {
+		t.Errorf("below tiers = %d, want 1200", got)
+	}
+
+	byWeight := option("weight")
+	byWeight.PriceType = shippingoption.Tiered
+	byWeight.TierBy = shippingoption.TierByWeight
+	byWeight.Tiers = []shippingoption.Tier{{Min: 0, Amount: 400}, {Min: 1000, Amount: 700}, {Min: 5000, Amount: 1500}}
+	if got := Price(c, byWeight); got != 700 {
+		t.Errorf("weight tier = %d, want 700 for %vg", got, c.Weight())
+	}
+}
+
+func TestSort(t *testing.T) {
+	options := []Option{{Name: "b", Total: 500}, {Name: "c", Total: 0}, {Name: "a", Total: 500}}
+	Sort(options)
+	if options[0].Name != "c" || options[1].Name != "a" || options[2].Name != "b" {
+		t.Errorf("sorted = %+v", options)
+	}
+}
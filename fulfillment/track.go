@@ -0,0 +1,121 @@
+package fulfillment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// pollBatch is how many fulfillments of one tracking status Poll tracks in an
+// org per run; the rest wait for the next.
+const pollBatch = 200
+
+// inFlight are the tracking statuses of parcels that have not arrived, which
+// Poll asks after.
+var inFlight = []fulfillmentmodel.TrackingStatus{
+	fulfillmentmodel.LabelCreated,
+	fulfillmentmodel.InTransit,
+	fulfillmentmodel.OutForDelivery,
+	fulfillmentmodel.Exception,
+}
+
+// Lock takes the lock of the fulfillment with id in db, which buying its
+// labels and recording its tracking hold, and returns its release.
+func Lock(db *datastore.Datastore, id string) (unlock func(), err error) {
+	return lock.Hold(db, "fulfillment", id)
+}
+
+// Track asks f's provider where its parcels are, and records it on f and its
+// order and saves both. The caller holds f's lock (see Lock) and read f under
+// it.
+func Track(ctx context.Context, db *datastore.Datastore, org *organization.Organization, f *fulfillmentmodel.Fulfillment) error {
+	p, err := Open(db, org, f.ProviderId)
+	if err != nil {
+		return err
+	}
+	t, err := p.Track(ctx, f.ExternalId)
+	if err != nil {
+		return err
+	}
+
+	ord := order.New(db)
+	if err := ord.GetById(f.OrderId); err != nil {
+		ord = nil
+	}
+	Record(ord, f, t)
+	if err := f.Update(); err != nil {
+		return err
+	}
+	if ord != nil {
+		if err := ord.Update(); err != nil {
+			return fmt.Errorf("fulfillment: order %s: %w", ord.Id(), err)
+		}
+	}
+	return nil
+}
+
+// Poll tracks every fulfillment of orgs that a provider shipped and that has
+// not arrived, so an order's tracking moves without anybody asking for it.
+// It returns how many it tracked. A fulfillment that fails is logged and
+// tried again on the next poll; one whose provider does not report tracking
+// is skipped.
+func Poll(ctx context.Context, orgs []*organization.Organization) (int, error) {
+	n := 0
+	for _, org := range orgs {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		ns := org.Namespace()
+		if ns == "" {
+			continue
+		}
+		db := datastore.NewNamespaced(nscontext.WithNamespace(ctx, ns))
+		for _, status := range inFlight {
+			var fs []*fulfillmentmodel.Fulfillment
+			if _, err := fulfillmentmodel.Query(db).
+				Filter("TrackingStatus=", string(status)).
+				Limit(pollBatch).
+				GetAll(&fs); err != nil {
+				log.Error("fulfillment: poll %s %s: %v", ns, status, err, ctx)
+				continue
+			}
+			for _, f := range fs {
+				if f.ExternalId == "" || f.CanceledAt != nil {
+					continue
+				}
+				if err := pollOne(ctx, db, org, f.Id()); err != nil {
+					log.Error("fulfillment: track %s of %s: %v", f.Id(), ns, err, ctx)
+					continue
+				}
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// pollOne tracks the fulfillment with id under its lock.
+func pollOne(ctx context.Context, db *datastore.Datastore, org *organization.Organization, id string) error {
+	unlock, err := Lock(db, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f := fulfillmentmodel.New(db)
+	if err := f.GetById(id); err != nil {
+		return err
+	}
+	if err := Track(ctx, db, org, f); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
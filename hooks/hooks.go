@@ -12,6 +12,12 @@
 //   - OnModelCreate: Called before creating a model
 //   - OnModelUpdate: Called before updating a model
 //   - OnModelDelete: Called before deleting a model
+//   - OnModelAfterCreate/Update/Delete: Called once the write has committed
+//
+// Model hooks fire for every write made through a model — mixin.Model,
+// mixin.BaseModel and db.Model alike, whichever store backs it — and carry
+// the entity before and after the write with a field-level diff. Bind to
+// AnyKind to see every kind.
 //
 // Usage:
 //
@@ -121,6 +127,15 @@ func (h *Hook[T]) Trigger(event T, defaultFn func(T) error) error {
 		index:     0,
 	}
 
+	// Hand the chain to the event, so a handler's e.Next() reaches the next
+	// handler rather than ending the chain where it stands.
+	switch e := any(event).(type) {
+	case interface{ setChain(*handlerChain[T]) }:
+		e.setChain(chain)
+	case Resolver:
+		e.setNextFunc(func() error { return chain.next(event) })
+	}
+
 	return chain.next(event)
 }
 
@@ -169,6 +184,8 @@ func (e *AppEvent) Next() error {
 	return nil
 }
 
+func (e *AppEvent) setChain(c *handlerChain[*AppEvent]) { e.chain = c }
+
 // RouteEvent is emitted when setting up routes
 type RouteEvent struct {
 	App    interface{}
@@ -184,22 +201,7 @@ func (e *RouteEvent) Next() error {
 	return nil
 }
 
-// ModelEvent is emitted for model operations
-type ModelEvent struct {
-	App   interface{}
-	Kind  string
-	Model interface{}
-	IsNew bool
-	chain *handlerChain[*ModelEvent]
-}
-
-// Next calls the next handler in the chain
-func (e *ModelEvent) Next() error {
-	if e.chain != nil {
-		return e.chain.next(e)
-	}
-	return nil
-}
+func (e *RouteEvent) setChain(c *handlerChain[*RouteEvent]) { e.chain = c }
 
 // Registry manages all hooks for an application
 type Registry struct {
@@ -211,11 +213,15 @@ type Registry struct {
 	// Route hooks
 	onRouteSetup *Hook[*RouteEvent]
 
-	// Model hooks (by kind)
-	onModelValidate map[string]*Hook[*ModelEvent]
-	onModelCreate   map[string]*Hook[*ModelEvent]
-	onModelUpdate   map[string]*Hook[*ModelEvent]
-	onModelDelete   map[string]*Hook[*ModelEvent]
+	// Model hooks (by kind). The plain ones run before the write and can
+	// refuse it; the After ones run once it has committed. See model.go.
+	onModelValidate    map[string]*Hook[*ModelEvent]
+	onModelCreate      map[string]*Hook[*ModelEvent]
+	onModelUpdate      map[string]*Hook[*ModelEvent]
+	onModelDelete      map[string]*Hook[*ModelEvent]
+	onModelAfterCreate map[string]*Hook[*ModelEvent]
+	onModelAfterUpdate map[string]*Hook[*ModelEvent]
+	onModelAfterDelete map[string]*Hook[*ModelEvent]
 
 	mu sync.RWMutex
 }
@@ -223,14 +229,17 @@ type Registry struct {
 // NewRegistry creates a new hook registry
 func NewRegistry() *Registry {
 	return &Registry{
-		onBootstrap:     NewHook[*AppEvent](),
-		onServe:         NewHook[*AppEvent](),
-		onTerminate:     NewHook[*AppEvent](),
-		onRouteSetup:    NewHook[*RouteEvent](),
-		onModelValidate: make(map[string]*Hook[*ModelEvent]),
-		onModelCreate:   make(map[string]*Hook[*ModelEvent]),
-		onModelUpdate:   make(map[string]*Hook[*ModelEvent]),
-		onModelDelete:   make(map[string]*Hook[*ModelEvent]),
+		onBootstrap:        NewHook[*AppEvent](),
+		onServe:            NewHook[*AppEvent](),
+		onTerminate:        NewHook[*AppEvent](),
+		onRouteSetup:       NewHook[*RouteEvent](),
+		onModelValidate:    make(map[string]*Hook[*ModelEvent]),
+		onModelCreate:      make(map[string]*Hook[*ModelEvent]),
+		onModelUpdate:      make(map[string]*Hook[*ModelEvent]),
+		onModelDelete:      make(map[string]*Hook[*ModelEvent]),
+		onModelAfterCreate: make(map[string]*Hook[*ModelEvent]),
+		onModelAfterUpdate: make(map[string]*Hook[*ModelEvent]),
+		onModelAfterDelete: make(map[string]*Hook[*ModelEvent]),
 	}
 }
 
@@ -254,60 +263,59 @@ func (r *Registry) OnRouteSetup() *Hook[*RouteEvent] {
 	return r.onRouteSetup
 }
 
-// OnModelValidate returns the model validate hook for a kind
-func (r *Registry) OnModelValidate(kind string) *Hook[*ModelEvent] {
+// modelHook returns the hook for kind in hooks, creating it on first use.
+func (r *Registry) modelHook(hooks map[string]*Hook[*ModelEvent], kind string) *Hook[*ModelEvent] {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if h, ok := r.onModelValidate[kind]; ok {
+	if h, ok := hooks[kind]; ok {
 		return h
 	}
 
 	h := NewHook[*ModelEvent]()
-	r.onModelValidate[kind] = h
+	hooks[kind] = h
 	return h
 }
 
-// OnModelCreate returns the model create hook for a kind
-func (r *Registry) OnModelCreate(kind string) *Hook[*ModelEvent] {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if h, ok := r.onModelCreate[kind]; ok {
-		return h
-	}
+// OnModelValidate returns the model validate hook for a kind
+func (r *Registry) OnModelValidate(kind string) *Hook[*ModelEvent] {
+	return r.modelHook(r.onModelValidate, kind)
+}
 
-	h := NewHook[*ModelEvent]()
-	r.onModelCreate[kind] = h
-	return h
+// OnModelCreate returns the model create hook for a kind. Its handlers run
+// before the entity is written, and an error from any of them refuses it.
+func (r *Registry) OnModelCreate(kind string) *Hook[*ModelEvent] {
+	return r.modelHook(r.onModelCreate, kind)
 }
 
-// OnModelUpdate returns the model update hook for a kind
+// OnModelUpdate returns the model update hook for a kind. Its handlers run
+// before the entity is written, and an error from any of them refuses it.
 func (r *Registry) OnModelUpdate(kind string) *Hook[*ModelEvent] {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if h, ok := r.onModelUpdate[kind]; ok {
-		return h
-	}
-
-	h := NewHook[*ModelEvent]()
-	r.onModelUpdate[kind] = h
-	return h
+	return r.modelHook(r.onModelUpdate, kind)
 }
 
-// OnModelDelete returns the model delete hook for a kind
+// OnModelDelete returns the model delete hook for a kind. Its handlers run
+// before the entity is deleted, and an error from any of them refuses it.
 func (r *Registry) OnModelDelete(kind string) *Hook[*ModelEvent] {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	return r.modelHook(r.onModelDelete, kind)
+}
 
-	if h, ok := r.onModelDelete[kind]; ok {
-		return h
-	}
+// OnModelAfterCreate returns the hook that runs once a create of kind has
+// committed. Its handlers cannot undo the write; an error is logged.
+func (r *Registry) OnModelAfterCreate(kind string) *Hook[*ModelEvent] {
+	return r.modelHook(r.onModelAfterCreate, kind)
+}
 
-	h := NewHook[*ModelEvent]()
-	r.onModelDelete[kind] = h
-	return h
+// OnModelAfterUpdate returns the hook that runs once an update of kind has
+// committed. Its handlers cannot undo the write; an error is logged.
+func (r *Registry) OnModelAfterUpdate(kind string) *Hook[*ModelEvent] {
+	return r.modelHook(r.onModelAfterUpdate, kind)
+}
+
+// OnModelAfterDelete returns the hook that runs once a delete of kind has
+// committed. Its handlers cannot undo the write; an error is logged.
+func (r *Registry) OnModelAfterDelete(kind string) *Hook[*ModelEvent] {
+	return r.modelHook(r.onModelAfterDelete, kind)
 }
 
 // TriggerBootstrap triggers the bootstrap hook
@@ -336,58 +344,48 @@ func (r *Registry) TriggerRouteSetup(router zip.Router) error {
 
 // TriggerModelValidate triggers the model validate hook
 func (r *Registry) TriggerModelValidate(kind string, model interface{}, isNew bool) error {
-	r.mu.RLock()
-	h, ok := r.onModelValidate[kind]
-	r.mu.RUnlock()
-
-	if !ok {
-		return nil
-	}
-
-	event := &ModelEvent{Kind: kind, Model: model, IsNew: isNew}
-	return h.Trigger(event, nil)
+	return r.triggerModel(r.onModelValidate, &ModelEvent{Kind: kind, Model: model, IsNew: isNew})
 }
 
 // TriggerModelCreate triggers the model create hook
 func (r *Registry) TriggerModelCreate(kind string, model interface{}) error {
-	r.mu.RLock()
-	h, ok := r.onModelCreate[kind]
-	r.mu.RUnlock()
-
-	if !ok {
-		return nil
-	}
-
-	event := &ModelEvent{Kind: kind, Model: model, IsNew: true}
-	return h.Trigger(event, nil)
+	return r.triggerModel(r.onModelCreate, &ModelEvent{Kind: kind, Model: model, IsNew: true})
 }
 
 // TriggerModelUpdate triggers the model update hook
 func (r *Registry) TriggerModelUpdate(kind string, model interface{}) error {
-	r.mu.RLock()
-	h, ok := r.onModelUpdate[kind]
-	r.mu.RUnlock()
-
-	if !ok {
-		return nil
-	}
-
-	event := &ModelEvent{Kind: kind, Model: model, IsNew: false}
-	return h.Trigger(event, nil)
+	return r.triggerModel(r.onModelUpdate, &ModelEvent{Kind: kind, Model: model, IsNew: false})
 }
 
 // TriggerModelDelete triggers the model delete hook
 func (r *Registry) TriggerModelDelete(kind string, model interface{}) error {
+	return r.triggerModel(r.onModelDelete, &ModelEvent{Kind: kind, Model: model, IsNew: false})
+}
+
+// triggerModel runs the event's kind-specific handlers and then the AnyKind
+// ones, as one chain: a handler that stops the chain stops both.
+func (r *Registry) triggerModel(hooks map[string]*Hook[*ModelEvent], event *ModelEvent) error {
 	r.mu.RLock()
-	h, ok := r.onModelDelete[kind]
+	h, ok := hooks[event.Kind]
+	all, allOk := hooks[AnyKind]
 	r.mu.RUnlock()
 
-	if !ok {
-		return nil
+	if event.Kind == AnyKind {
+		allOk = false
 	}
 
-	event := &ModelEvent{Kind: kind, Model: model, IsNew: false}
-	return h.Trigger(event, nil)
+	var rest func(*ModelEvent) error
+	if allOk {
+		rest = func(e *ModelEvent) error { return all.Trigger(e, nil) }
+	}
+
+	switch {
+	case ok:
+		return h.Trigger(event, rest)
+	case rest != nil:
+		return rest(event)
+	}
+	return nil
 }
 
 // handlerIDCounter for generating unique IDs
@@ -0,0 +1,333 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/hanzoai/commerce/log"
+)
+
+// AnyKind is the kind that model hooks bound for every kind are registered
+// under: OnModelAfterUpdate(AnyKind) sees every update of every model. Its
+// handlers run after the kind-specific ones, in the same chain.
+const AnyKind = "*"
+
+// FieldChange is one field that a write changed, by its JSON name. Before is
+// nil for a field the entity did not have; After is nil for one it lost.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// ModelEvent is emitted for model operations.
+//
+// Model is the entity itself. Before and After are its JSON form as stored
+// before the write and as written: Before is nil for a create, After for a
+// delete. Changes is the difference between the two, field by field.
+//
+// In the hooks that run before the write, After is the entity as it is about
+// to be written, and a handler may still change Model — a later handler, and
+// the write, see the change. Before and After are snapshots and changing them
+// changes nothing.
+type ModelEvent struct {
+	App   interface{}
+	Kind  string
+	Model interface{}
+	IsNew bool
+
+	// Context is the context the entity is being written under, carrying its
+	// namespace.
+	Context context.Context
+
+	Before  map[string]interface{}
+	After   map[string]interface{}
+	Changes []FieldChange
+
+	chain *handlerChain[*ModelEvent]
+}
+
+// Next calls the next handler in the chain
+func (e *ModelEvent) Next() error {
+	if e.chain != nil {
+		return e.chain.next(e)
+	}
+	return nil
+}
+
+func (e *ModelEvent) setChain(c *handlerChain[*ModelEvent]) { e.chain = c }
+
+// Changed reports whether the write changed any of fields (by JSON name).
+func (e *ModelEvent) Changed(fields ...string) bool {
+	for _, c := range e.Changes {
+		for _, f := range fields {
+			if c.Field == f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Snapshot returns the JSON form of v as a map, the form ModelEvent's Before
+// and After take, with its credentials redacted (see redactTag). It is nil
+// when v is nil or does not encode to an object.
+func Snapshot(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	redact(reflect.ValueOf(v), m)
+	return m
+}
+
+// Diff returns the fields whose values differ between before and after,
+// sorted by name. Values are compared in their JSON form, so a field nested
+// under an object is reported as a change to the whole object.
+func Diff(before, after map[string]interface{}) []FieldChange {
+	var changes []FieldChange
+	for field, a := range after {
+		b, ok := before[field]
+		if !ok || !reflect.DeepEqual(a, b) {
+			changes = append(changes, FieldChange{Field: field, Before: b, After: a})
+		}
+	}
+	for field, b := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, Before: b})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// Op is the kind of write a ModelWrite makes.
+type Op int
+
+const (
+	OpCreate Op = iota
+	OpUpdate
+	OpDelete
+)
+
+// ModelWrite is one write of one entity, as the model layers hand it to
+// RunModelWrite.
+type ModelWrite struct {
+	Context context.Context
+	Kind    string
+	Op      Op
+	Model   interface{}
+
+	// Upsert marks a write that creates or updates depending on whether the
+	// entity is stored yet: Op is taken as OpCreate when Load finds nothing.
+	Upsert bool
+
+	// Load returns the entity as stored, for Before, or nil when there is
+	// none. It is only called when a hook is bound for the kind, so a write
+	// nobody is watching costs no read. Nil for a create.
+	Load func() (interface{}, error)
+
+	// Write makes the write.
+	Write func() error
+}
+
+// RunModelWrite makes w's write with the model hooks around it.
+//
+// The validate hook and then the before hook for w.Op run first; an error from
+// either refuses the write and is returned. Once the write succeeds, the After
+// hook is run when it commits (see AfterCommit). When no hook is bound for the
+// kind this is just w.Write.
+func (r *Registry) RunModelWrite(w *ModelWrite) error {
+	if r == nil || !r.watches(w.Kind) {
+		return w.Write()
+	}
+
+	op := w.Op
+	var before interface{}
+	if op != OpCreate && w.Load != nil {
+		prev, err := w.Load()
+		if err != nil {
+			return err
+		}
+		before = prev
+	}
+	if w.Upsert && before == nil {
+		op = OpCreate
+	}
+
+	event := &ModelEvent{
+		Kind:    w.Kind,
+		Model:   w.Model,
+		IsNew:   op == OpCreate,
+		Context: w.Context,
+		Before:  Snapshot(before),
+	}
+	if op != OpDelete {
+		event.After = Snapshot(w.Model)
+	}
+	event.Changes = Diff(event.Before, event.After)
+
+	var pre, post map[string]*Hook[*ModelEvent]
+	switch op {
+	case OpCreate:
+		pre, post = r.onModelCreate, r.onModelAfterCreate
+	case OpUpdate:
+		pre, post = r.onModelUpdate, r.onModelAfterUpdate
+	default:
+		pre, post = r.onModelDelete, r.onModelAfterDelete
+	}
+
+	if op != OpDelete {
+		if err := r.triggerModel(r.onModelValidate, event); err != nil {
+			return err
+		}
+	}
+	if err := r.triggerModel(pre, event); err != nil {
+		return err
+	}
+
+	if err := w.Write(); err != nil {
+		return err
+	}
+
+	// A fresh event for the After hooks: the write may have moved timestamps
+	// and ids, and a before handler may have changed the entity.
+	done := &ModelEvent{
+		Kind:    w.Kind,
+		Model:   w.Model,
+		IsNew:   event.IsNew,
+		Context: w.Context,
+		Before:  event.Before,
+	}
+	if op != OpDelete {
+		done.After = Snapshot(w.Model)
+	}
+	done.Changes = Diff(done.Before, done.After)
+
+	AfterCommit(w.Context, func() {
+		if err := r.triggerModel(post, done); err != nil {
+			log.Error("hooks: after %s hook: %v", w.Kind, err, w.Context)
+		}
+	})
+	return nil
+}
+
+// watches reports whether any model hook is bound for kind, directly or
+// through AnyKind.
+func (r *Registry) watches(kind string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, hooks := range []map[string]*Hook[*ModelEvent]{
+		r.onModelValidate,
+		r.onModelCreate, r.onModelUpdate, r.onModelDelete,
+		r.onModelAfterCreate, r.onModelAfterUpdate, r.onModelAfterDelete,
+	} {
+		if h, ok := hooks[kind]; ok && h.Len() > 0 {
+			return true
+		}
+		if h, ok := hooks[AnyKind]; ok && h.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+// The process registry
+// ---------------------------------------------------------------------------
+
+var (
+	defaultRegistry   = NewRegistry()
+	defaultRegistryMu sync.RWMutex
+)
+
+// Default returns the registry that model writes report to. Models are
+// written from everywhere — handlers, tasks, the billing engine — none of
+// which hold the App, so the hooks they fire live at process level. The App
+// installs its own registry here (SetDefault) when it is built.
+func Default() *Registry {
+	defaultRegistryMu.RLock()
+	defer defaultRegistryMu.RUnlock()
+	return defaultRegistry
+}
+
+// SetDefault makes r the registry model writes report to.
+func SetDefault(r *Registry) {
+	defaultRegistryMu.Lock()
+	defaultRegistry = r
+	defaultRegistryMu.Unlock()
+}
+
+// ---------------------------------------------------------------------------
+// Commit scopes
+// ---------------------------------------------------------------------------
+
+type commitScopeKey struct{}
+
+// commitScope collects the work to run when a transaction commits.
+type commitScope struct {
+	mu      sync.Mutex
+	pending []func()
+}
+
+// BeginCommit returns a context under which AfterCommit defers its work, and
+// the function that ends the scope: end(true) runs the deferred work, in the
+// order it was deferred; end(false) drops it.
+//
+// A transaction opens one around its body and ends it with whether it
+// committed. A scope opened under another joins it, and its work waits for
+// the outer commit: an inner block that succeeded inside an outer one that
+// rolled back did not commit either.
+func BeginCommit(ctx context.Context) (context.Context, func(committed bool)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Value(commitScopeKey{}).(*commitScope); ok {
+		return ctx, func(bool) {}
+	}
+
+	scope := &commitScope{}
+	return context.WithValue(ctx, commitScopeKey{}, scope), func(committed bool) {
+		scope.mu.Lock()
+		pending := scope.pending
+		scope.pending = nil
+		scope.mu.Unlock()
+
+		if !committed {
+			return
+		}
+		for _, fn := range pending {
+			fn()
+		}
+	}
+}
+
+// AfterCommit runs fn once the write just made under ctx has committed: at
+// the end of the enclosing commit scope if there is one (BeginCommit), and
+// otherwise now, because a write outside a transaction committed when it
+// returned.
+func AfterCommit(ctx context.Context, fn func()) {
+	if ctx != nil {
+		if scope, ok := ctx.Value(commitScopeKey{}).(*commitScope); ok {
+			scope.mu.Lock()
+			scope.pending = append(scope.pending, fn)
+			scope.mu.Unlock()
+			return
+		}
+	}
+	fn()
+}
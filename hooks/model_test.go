@@ -0,0 +1,152 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type widget struct {
+	Name  string `json:"name"`
+	Stock int    `json:"stock"`
+}
+
+func TestRunModelWrite_BeforeSeesDiffAndCanRefuse(t *testing.T) {
+	r := NewRegistry()
+	stored := &widget{Name: "bolt", Stock: 5}
+
+	var seen *ModelEvent
+	r.OnModelUpdate("widget").BindFunc(func(e *ModelEvent) error {
+		seen = e
+		if e.After["stock"].(float64) < 0 {
+			return errors.New("out of stock")
+		}
+		return e.Next()
+	})
+
+	w := &widget{Name: "bolt", Stock: 3}
+	wrote := false
+	err := r.RunModelWrite(&ModelWrite{
+		Context: context.Background(),
+		Kind:    "widget",
+		Op:      OpUpdate,
+		Model:   w,
+		Load:    func() (interface{}, error) { return stored, nil },
+		Write:   func() error { wrote = true; return nil },
+	})
+	if err != nil || !wrote {
+		t.Fatalf("write: err=%v wrote=%v", err, wrote)
+	}
+	if len(seen.Changes) != 1 || seen.Changes[0].Field != "stock" || !seen.Changed("stock") || seen.Changed("name") {
+		t.Fatalf("changes = %+v, want just stock", seen.Changes)
+	}
+	if seen.Changes[0].Before.(float64) != 5 || seen.Changes[0].After.(float64) != 3 {
+		t.Fatalf("stock change = %+v, want 5 -> 3", seen.Changes[0])
+	}
+
+	w.Stock = -1
+	wrote = false
+	err = r.RunModelWrite(&ModelWrite{
+		Kind:  "widget",
+		Op:    OpUpdate,
+		Model: w,
+		Load:  func() (interface{}, error) { return stored, nil },
+		Write: func() error { wrote = true; return nil },
+	})
+	if err == nil || wrote {
+		t.Fatalf("refused write: err=%v wrote=%v", err, wrote)
+	}
+}
+
+func TestRunModelWrite_UpsertOfNewEntityIsCreate(t *testing.T) {
+	r := NewRegistry()
+	var created, updated int
+	r.OnModelCreate(AnyKind).BindFunc(func(e *ModelEvent) error { created++; return e.Next() })
+	r.OnModelUpdate(AnyKind).BindFunc(func(e *ModelEvent) error { updated++; return e.Next() })
+
+	err := r.RunModelWrite(&ModelWrite{
+		Kind:   "widget",
+		Op:     OpUpdate,
+		Upsert: true,
+		Model:  &widget{Name: "nut"},
+		Load:   func() (interface{}, error) { return nil, nil },
+		Write:  func() error { return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || updated != 0 {
+		t.Fatalf("created=%d updated=%d, want a create", created, updated)
+	}
+}
+
+func TestRunModelWrite_AfterWaitsForCommit(t *testing.T) {
+	r := NewRegistry()
+	var after []string
+	r.OnModelAfterCreate("widget").BindFunc(func(e *ModelEvent) error {
+		after = append(after, e.After["name"].(string))
+		return e.Next()
+	})
+	write := func(ctx context.Context, name string) {
+		t.Helper()
+		if err := r.RunModelWrite(&ModelWrite{
+			Context: ctx,
+			Kind:    "widget",
+			Op:      OpCreate,
+			Model:   &widget{Name: name},
+			Write:   func() error { return nil },
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Outside a transaction the write has committed when it returns.
+	write(context.Background(), "a")
+	if len(after) != 1 {
+		t.Fatalf("after = %v, want it run at once", after)
+	}
+
+	ctx, end := BeginCommit(context.Background())
+	write(ctx, "b")
+	inner, endInner := BeginCommit(ctx)
+	write(inner, "c")
+	endInner(true)
+	if len(after) != 1 {
+		t.Fatalf("after = %v, ran before the outer commit", after)
+	}
+	end(true)
+	if len(after) != 3 || after[1] != "b" || after[2] != "c" {
+		t.Fatalf("after = %v, want [a b c]", after)
+	}
+
+	ctx, end = BeginCommit(context.Background())
+	write(ctx, "d")
+	end(false)
+	if len(after) != 3 {
+		t.Fatalf("after = %v, ran for a rolled-back write", after)
+	}
+}
+
+func TestTrigger_NextReachesEveryHandler(t *testing.T) {
+	r := NewRegistry()
+	var order []string
+	r.OnModelDelete("widget").Bind(&Handler[*ModelEvent]{ID: "one", Priority: 1, Func: func(e *ModelEvent) error {
+		order = append(order, "one")
+		return e.Next()
+	}})
+	r.OnModelDelete("widget").Bind(&Handler[*ModelEvent]{ID: "two", Priority: 2, Func: func(e *ModelEvent) error {
+		order = append(order, "two")
+		return e.Next()
+	}})
+	r.OnModelDelete(AnyKind).BindFunc(func(e *ModelEvent) error {
+		order = append(order, "any")
+		return e.Next()
+	})
+
+	if err := r.TriggerModelDelete("widget", &widget{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "one" || order[1] != "two" || order[2] != "any" {
+		t.Fatalf("order = %v, want [one two any]", order)
+	}
+}
@@ -0,0 +1,141 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Redacted fields are credentials: an API key, an access token, a signing
+// secret. They are tagged
+//
+//	APIKey string `json:"apiKey" audit:"redact"`
+//
+// and a Snapshot never carries their value, so neither do the ModelEvents
+// built from it nor the audit entries recorded from those. A set field reads
+// as a marker keyed by a secret of the process's, so a Diff still sees that a
+// credential was set, rotated or cleared, but not what it was.
+const redactTag = "redact"
+
+var redactKey = func() []byte {
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		panic("hooks: " + err.Error())
+	}
+	return k
+}()
+
+// redactMark is what a redacted value reads as in a snapshot.
+func redactMark(v interface{}) interface{} {
+	data, _ := json.Marshal(v)
+	mac := hmac.New(sha256.New, redactKey)
+	mac.Write(data)
+	return "[redacted:" + hex.EncodeToString(mac.Sum(nil)[:4]) + "]"
+}
+
+// redact replaces the values of rv's redacted fields in snap, its JSON form,
+// at any depth.
+func redact(rv reflect.Value, snap interface{}) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		m, ok := snap.(map[string]interface{})
+		if !ok {
+			return
+		}
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, skip := jsonName(f)
+			if skip {
+				continue
+			}
+			if name == "" {
+				// Embedded without a name: its fields are the struct's own.
+				redact(rv.Field(i), m)
+				continue
+			}
+			val, ok := m[name]
+			if !ok {
+				continue
+			}
+			if f.Tag.Get("audit") == redactTag {
+				if !isEmpty(val) {
+					m[name] = redactMark(val)
+				}
+				continue
+			}
+			redact(rv.Field(i), val)
+		}
+
+	case reflect.Slice, reflect.Array:
+		s, ok := snap.([]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < rv.Len() && i < len(s); i++ {
+			redact(rv.Index(i), s[i])
+		}
+
+	case reflect.Map:
+		m, ok := snap.(map[string]interface{})
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, k := range rv.MapKeys() {
+			if val, ok := m[k.String()]; ok {
+				redact(rv.MapIndex(k), val)
+			}
+		}
+	}
+}
+
+// jsonName is the key f encodes under: "" for an embedded struct whose fields
+// are promoted, and skip for a field that does not encode.
+func jsonName(f reflect.StructField) (name string, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if name != "" {
+		return name, false
+	}
+	if f.Anonymous {
+		t := f.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			return "", false
+		}
+	}
+	if !f.IsExported() {
+		return "", true
+	}
+	return f.Name, false
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
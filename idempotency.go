@@ -0,0 +1,8 @@
+package commerce
+
+// startIdempotencySweeper starts the sweeper Bootstrap built.
+func (app *App) startIdempotencySweeper() {
+	if app.idempotencyKeys != nil {
+		app.idempotencyKeys.Start()
+	}
+}
@@ -53,6 +53,7 @@ type kvBackend interface {
 	setNX(key string, value []byte, ttl time.Duration) (bool, error)
 	compareAndDelete(key string, want []byte) (bool, error)
 	compareAndExtend(key string, want []byte, ttl time.Duration) (bool, error)
+	incrBy(key string, by int64, ttl time.Duration) (int64, error)
 	ping(ctx context.Context) error
 	close() error
 }
@@ -77,6 +78,9 @@ func (b *baseBackend) compareAndDelete(k string, w []byte) (bool, error) {
 func (b *baseBackend) compareAndExtend(k string, w []byte, ttl time.Duration) (bool, error) {
 	return b.kv.CompareAndExtend(k, w, ttl)
 }
+func (b *baseBackend) incrBy(k string, by int64, ttl time.Duration) (int64, error) {
+	return b.kv.IncrBy(k, by, ttl)
+}
 func (b *baseBackend) ping(context.Context) error {
 	// Local SQLite store; a cheap existence probe forces a real query.
 	_, err := b.kv.Exists("__ping__")
@@ -109,6 +113,11 @@ func (b *baseBackend) close() error {
 var (
 	casDelScript    = kv.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
 	casExtendScript = kv.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+
+	// incrScript expires the counter only while it has no expiry — on the
+	// increment that created it — as the base store's IncrBy does, so a
+	// rate-limit window's counter closes when it was opened to.
+	incrScript = kv.NewScript(`local n = redis.call("incrby", KEYS[1], ARGV[1]) if tonumber(ARGV[2]) > 0 and redis.call("pttl", KEYS[1]) == -1 then redis.call("pexpire", KEYS[1], ARGV[2]) end return n`)
 )
 
 // externalBackend is the external Hanzo KV engine over the kv-go client.
@@ -146,6 +155,9 @@ func (r *externalBackend) compareAndExtend(k string, want []byte, ttl time.Durat
 	}
 	return n == 1, nil
 }
+func (r *externalBackend) incrBy(k string, by int64, ttl time.Duration) (int64, error) {
+	return incrScript.Run(context.Background(), r.c, []string{k}, by, ttl.Milliseconds()).Int64()
+}
 func (r *externalBackend) ping(ctx context.Context) error { return r.c.Ping(ctx).Err() }
 func (r *externalBackend) close() error                   { return r.c.Close() }
 
@@ -287,6 +299,17 @@ func (c *KVClient) CompareAndExtend(key string, want []byte, ttl time.Duration)
 	return c.backend.compareAndExtend(c.key(key), want, ttl)
 }
 
+// IncrBy atomically adds by to the counter at key and returns its new value.
+// A missing or expired counter starts from 0 and expires after ttl (0 means
+// never); bumping a live one leaves its expiry alone.
+func (c *KVClient) IncrBy(key string, by int64, ttl time.Duration) (int64, error) {
+	n, err := c.backend.incrBy(c.key(key), by, ttl)
+	if err != nil {
+		return 0, fmt.Errorf("kv incr failed: %w", err)
+	}
+	return n, nil
+}
+
 // Health checks the backing store with a round-trip set/get/delete on a
 // reserved health key.
 func (c *KVClient) Health(ctx context.Context) HealthStatus {
@@ -259,3 +259,16 @@ func TestLockMutualExclusion(t *testing.T) {
 		t.Fatalf("no goroutine acquired the lock")
 	}
 }
+
+func TestKVClientIncrBy(t *testing.T) {
+	ctx := context.Background()
+	kv, _ := newTestKV(t, "rl")
+	for want := int64(1); want <= 3; want++ {
+		if n, err := kv.IncrBy("window", 1, time.Minute); err != nil || n != want {
+			t.Fatalf("IncrBy = (%d, %v), want (%d, nil)", n, err, want)
+		}
+	}
+	if v, _ := kv.Get(ctx, "window"); v != "3" {
+		t.Fatalf("Get = %q, want %q", v, "3")
+	}
+}
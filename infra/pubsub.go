@@ -238,6 +238,28 @@ func (c *PubSubClient) PublishToStream(ctx context.Context, subject string, data
 	}, nil
 }
 
+// PublishToStreamWithID publishes a message to a JetStream stream under a
+// message id. The stream drops a second message with the same id inside its
+// duplicate window, so a publisher that retries after a lost ack does not
+// store the message twice.
+func (c *PubSubClient) PublishToStreamWithID(ctx context.Context, subject, id string, data []byte) (*PubAck, error) {
+	if c.js == nil {
+		return nil, fmt.Errorf("jetstream not enabled")
+	}
+
+	ack, err := c.js.Publish(ctx, subject, data, jetstream.WithMsgID(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish to stream: %w", err)
+	}
+
+	return &PubAck{
+		Stream:    ack.Stream,
+		Sequence:  ack.Sequence,
+		Domain:    ack.Domain,
+		Duplicate: ack.Duplicate,
+	}, nil
+}
+
 // PublishJSONToStream publishes a JSON message to a stream
 func (c *PubSubClient) PublishJSONToStream(ctx context.Context, subject string, v interface{}) (*PubAck, error) {
 	data, err := json.Marshal(v)
@@ -460,6 +482,10 @@ type PubAck struct {
 	Stream   string
 	Sequence uint64
 	Domain   string
+
+	// Duplicate is set when the stream already held a message with the same
+	// id (PublishToStreamWithID) and stored nothing.
+	Duplicate bool
 }
 
 // StreamMessage represents a message from a stream
@@ -0,0 +1,220 @@
+package commerce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	billingPkg "github.com/hanzoai/commerce/api/billing"
+	payoutcron "github.com/hanzoai/commerce/cron/payout/contributor"
+	commerceDatastore "github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment"
+	"github.com/hanzoai/commerce/infra"
+	"github.com/hanzoai/commerce/models/jobrun"
+	"github.com/hanzoai/commerce/scheduler"
+)
+
+// jobHistoryTTL is how long a job run is kept.
+const jobHistoryTTL = 90 * 24 * time.Hour
+
+// jobs are the recurring jobs commerce runs itself. None that moves money has
+// a schedule until COMMERCE_JOBS gives it one, so a deployment still driving
+// the admin endpoints from a CronJob does not have them run twice the day it
+// upgrades; each can be triggered by hand regardless.
+func (app *App) jobs() []scheduler.Job {
+	return []scheduler.Job{{
+		// Renew due subscriptions and grant the month's allotments, in every
+		// org. A run does everything due, so a missed hour needs one run.
+		Name:    "billing-cycle",
+		CatchUp: scheduler.CatchUpOnce,
+		Timeout: 30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := billingPkg.RunBillingCycles(ctx, app.KMS)
+			return err
+		},
+	}, {
+		// Top up the balances that fell below their auto-recharge threshold.
+		Name:    "auto-recharge",
+		CatchUp: scheduler.CatchUpOnce,
+		Timeout: 15 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := billingPkg.RunAutoRecharge(ctx, app.KMS, app.Events)
+			return err
+		},
+	}, {
+		// Accrue last month's OSS contributor share as payables. A run
+		// accrues the whole month again, so a missed one is not made up
+		// automatically; trigger it by hand.
+		Name:    "contributor-accrual",
+		CatchUp: scheduler.CatchUpSkip,
+		Timeout: 30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			return payoutcron.Payout(ctx, payoutcron.Config{Publisher: app.Publisher})
+		},
+	}, {
+		// Ask providers where every parcel in flight is, so orders move to
+		// delivered without anybody asking (see fulfillment.Poll).
+		Name:     "fulfillment-tracking",
+		Schedule: "@hourly",
+		CatchUp:  scheduler.CatchUpSkip,
+		Timeout:  30 * time.Minute,
+		Run: func(ctx context.Context) error {
+			orgs, err := app.orgs(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = fulfillment.Poll(ctx, orgs)
+			return err
+		},
+	}, {
+		// Forget job runs older than jobHistoryTTL.
+		Name:     "job-history-prune",
+		Schedule: "@daily",
+		CatchUp:  scheduler.CatchUpSkip,
+		Run: func(ctx context.Context) error {
+			_, err := jobrun.Prune(commerceDatastore.New(ctx), time.Now().Add(-jobHistoryTTL))
+			return err
+		},
+	}}
+}
+
+// newScheduler builds the scheduler with the jobs, scheduled as Jobs
+// configures them.
+//
+// Jobs is JSON, a job's name to its schedule and catch-up policy:
+//
+//	{"billing-cycle": {"schedule": "5 * * * *"},
+//	 "auto-recharge": {"schedule": "*/15 * * * *", "catchUp": "skip"}}
+//
+// A name that is not a job, or a schedule that does not parse, fails the
+// boot: a typo must not leave customers unbilled without a word.
+func (app *App) newScheduler() (*scheduler.Scheduler, error) {
+	cfg := map[string]scheduler.Config{}
+	if raw := strings.TrimSpace(app.config.Jobs); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+			return nil, fmt.Errorf("COMMERCE_JOBS: %w", err)
+		}
+	}
+
+	s := scheduler.New(&jobLocker{app.Infra}, jobHistory{})
+	for _, job := range app.jobs() {
+		if c, ok := cfg[job.Name]; ok {
+			job = job.Configure(c)
+			delete(cfg, job.Name)
+		}
+		if err := s.Add(job); err != nil {
+			return nil, fmt.Errorf("COMMERCE_JOBS: %w", err)
+		}
+	}
+	if len(cfg) > 0 {
+		names := make([]string, 0, len(cfg))
+		for name := range cfg {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("COMMERCE_JOBS: no job named %s", strings.Join(names, ", "))
+	}
+	return s, nil
+}
+
+// startScheduler starts the scheduler Bootstrap built.
+func (app *App) startScheduler() {
+	if app.Scheduler != nil {
+		app.Scheduler.Start()
+	}
+}
+
+// jobLocker elects a job's replica with an infra lock. Replicas agree only
+// when they share a KV store: with each on its own embedded one, each is its
+// own leader.
+type jobLocker struct {
+	infra *infra.Manager
+}
+
+func (l *jobLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (scheduler.Lock, error) {
+	lock, err := l.infra.Acquire(ctx, key, ttl)
+	if errors.Is(err, infra.ErrLockNotAcquired) {
+		return nil, scheduler.ErrHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// jobHistory keeps job runs as jobrun records in the system store.
+type jobHistory struct{}
+
+func (jobHistory) Record(ctx context.Context, run *scheduler.Run) error {
+	db := commerceDatastore.New(ctx)
+	r := jobrun.New(db)
+	if run.Id != "" {
+		if err := r.GetById(run.Id); err != nil {
+			return err
+		}
+	}
+	r.Job = run.Job
+	r.Trigger = string(run.Trigger)
+	r.ScheduledAt = run.ScheduledAt
+	r.StartedAt = run.StartedAt
+	r.EndedAt = run.EndedAt
+	r.Outcome = string(run.Outcome)
+	r.Error = run.Error
+	r.Host = run.Host
+	if run.Id == "" {
+		if err := r.Create(); err != nil {
+			return err
+		}
+		run.Id = r.Id()
+		return nil
+	}
+	return r.Update()
+}
+
+func (jobHistory) LastScheduled(ctx context.Context, job string) (*scheduler.Run, error) {
+	db := commerceDatastore.New(ctx)
+	r := jobrun.New(db)
+	_, ok, err := jobrun.Query(db).
+		Filter("Job=", job).
+		Filter("Trigger=", string(scheduler.TriggerSchedule)).
+		Order("-ScheduledAt").
+		First(r)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return runOf(r), nil
+}
+
+func (jobHistory) List(ctx context.Context, job string, limit int) ([]*scheduler.Run, error) {
+	var recs []*jobrun.JobRun
+	if _, err := jobrun.Query(commerceDatastore.New(ctx)).
+		Filter("Job=", job).
+		Order("-StartedAt").
+		Limit(limit).
+		GetAll(&recs); err != nil {
+		return nil, err
+	}
+	runs := make([]*scheduler.Run, 0, len(recs))
+	for _, r := range recs {
+		runs = append(runs, runOf(r))
+	}
+	return runs, nil
+}
+
+func runOf(r *jobrun.JobRun) *scheduler.Run {
+	return &scheduler.Run{
+		Id:          r.Id(),
+		Job:         r.Job,
+		Trigger:     scheduler.Trigger(r.Trigger),
+		ScheduledAt: r.ScheduledAt,
+		StartedAt:   r.StartedAt,
+		EndedAt:     r.EndedAt,
+		Outcome:     scheduler.Outcome(r.Outcome),
+		Error:       r.Error,
+		Host:        r.Host,
+	}
+}
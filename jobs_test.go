@@ -0,0 +1,52 @@
+package commerce
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/commerce/scheduler"
+)
+
+func TestNewSchedulerConfig(t *testing.T) {
+	app := &App{config: &Config{Jobs: `{
+		"billing-cycle": {"schedule": "5 * * * *"},
+		"auto-recharge": {"schedule": "*/15 * * * *", "catchUp": "skip"},
+		"job-history-prune": {"schedule": "off"}
+	}`}}
+	s, err := app.newScheduler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]scheduler.JobStatus{}
+	for _, j := range s.Jobs() {
+		got[j.Name] = j
+	}
+	if j := got["billing-cycle"]; j.Schedule != "5 * * * *" || j.CatchUp != scheduler.CatchUpOnce || j.Next.IsZero() {
+		t.Errorf("billing-cycle = %+v", j)
+	}
+	if j := got["auto-recharge"]; j.Schedule != "*/15 * * * *" || j.CatchUp != scheduler.CatchUpSkip {
+		t.Errorf("auto-recharge = %+v", j)
+	}
+	// Unconfigured, a job that moves money is left to be run by hand.
+	if j, ok := got["contributor-accrual"]; !ok || j.Schedule != "" || !j.Next.IsZero() {
+		t.Errorf("contributor-accrual = %+v, %v", j, ok)
+	}
+	if j := got["job-history-prune"]; j.Schedule != "" {
+		t.Errorf("job-history-prune was turned off but is scheduled %q", j.Schedule)
+	}
+}
+
+func TestNewSchedulerConfigRejects(t *testing.T) {
+	for _, c := range []struct{ jobs, want string }{
+		{`{"biling-cycle": {"schedule": "@hourly"}}`, `no job named biling-cycle`},
+		{`{"billing-cycle": {"schedule": "0 * * *"}}`, `billing-cycle`},
+		{`{"billing-cycle": {"schedule": "@hourly", "catchUp": "later"}}`, `catch-up`},
+		{`billing-cycle=@hourly`, `COMMERCE_JOBS`},
+	} {
+		app := &App{config: &Config{Jobs: c.jobs}}
+		if _, err := app.newScheduler(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("COMMERCE_JOBS=%s: err = %v, want one mentioning %q", c.jobs, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package lock serialises the read-modify-writes the store cannot: a check of
+// what an order has left to refund, a session's version, a level's reserved
+// quantity, and the write that follows. The store's transactions give no
+// isolation, so two requests that read the same state would otherwise both
+// pass the check.
+//
+// A lock is held in the infra KV store (SetStore), so it holds across every
+// replica that shares the store: the base SQLite store embedded, an external
+// KV when KV_URL is set. Each is taken with set-if-absent and a ttl, renewed
+// while its holder lives, so one whose holder died goes away on its own; and
+// released with compare-and-delete, so a holder that lost it cannot release
+// the next holder's.
+//
+// In front of the KV, holders in one process queue on a mutex, so only one of
+// them polls the store at a time. Those mutexes are dropped when nobody holds
+// or waits for them. Without a store (KV disabled) the mutex is the lock, which
+// serialises one process and no more.
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/rand"
+)
+
+// TTL is how long a lock outlives a holder that died holding it. A live
+// holder renews it every third of that, however long it holds it: a checkout
+// that waits on a slow processor must not lose its lock to a second one.
+const TTL = time.Minute
+
+// ttl is TTL, shortened by tests.
+var ttl = TTL
+
+// Wait is how long Hold waits for a lock held elsewhere before giving up.
+const Wait = 10 * time.Second
+
+// wait is Wait, shortened by tests.
+var wait = Wait
+
+// ErrBusy is returned when the lock was held elsewhere for all of Wait.
+var ErrBusy = errors.New("lock: held elsewhere")
+
+// Store is the KV store locks are kept in; infra.KVClient is one.
+type Store interface {
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	CompareAndDelete(key string, want []byte) (bool, error)
+	CompareAndExtend(key string, want []byte, ttl time.Duration) (bool, error)
+}
+
+var (
+	storeMu sync.RWMutex
+	store   Store
+)
+
+// SetStore sets the KV store locks are held in (called once at bootstrap).
+// Until it is called locks hold within the process only.
+func SetStore(s Store) {
+	storeMu.Lock()
+	store = s
+	storeMu.Unlock()
+}
+
+func currentStore() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// Hold takes the lock named by key in db's namespace, waiting up to Wait for
+// another holder to let it go, and returns its release. Orgs never contend.
+//
+// An error means the lock was not taken and the caller must not go on to
+// write: ErrBusy when another holder kept it, or the store's own error.
+func Hold(db *datastore.Datastore, key ...string) (unlock func(), err error) {
+	return hold(nscontext.GetNamespace(db.Context) + "\x00" + strings.Join(key, "\x00"))
+}
+
+func hold(key string) (func(), error) {
+	release := local(key)
+
+	s := currentStore()
+	if s == nil {
+		return release, nil
+	}
+
+	kvKey := storeKey(key)
+	token := []byte(rand.ShortId())
+
+	deadline := time.Now().Add(wait)
+	pause := 5 * time.Millisecond
+	for {
+		ok, err := s.SetNX(kvKey, token, ttl)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			release()
+			return nil, ErrBusy
+		}
+		time.Sleep(pause)
+		pause = min(2*pause, 200*time.Millisecond)
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go keep(s, kvKey, token, stop, done)
+
+	return func() {
+		close(stop)
+		<-done
+		if ok, err := s.CompareAndDelete(kvKey, token); err != nil || !ok {
+			// Expired, and perhaps taken since: it could not be renewed.
+			log.Warn("lock: released %s after it was lost: %v", kvKey, err)
+		}
+		release()
+	}, nil
+}
+
+// keep renews the lock at key every third of its ttl until stop is closed. A
+// renewal the store fails is tried again at the next; one that finds the lock
+// gone — it expired while the store was unreachable — gives up.
+func keep(s Store, key string, token []byte, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	t := time.NewTicker(ttl / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			ok, err := s.CompareAndExtend(key, token, ttl)
+			if err != nil {
+				log.Warn("lock: renew %s: %v", key, err)
+				continue
+			}
+			if !ok {
+				log.Error("lock: %s expired while held", key)
+				return
+			}
+		}
+	}
+}
+
+// storeKey is key's name in the store.
+func storeKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "lock:hold:" + hex.EncodeToString(sum[:16])
+}
+
+// mutex is a process-local lock and how many hold or wait for it.
+type mutex struct {
+	sync.Mutex
+	refs int
+}
+
+var (
+	localMu sync.Mutex
+	locals  = make(map[string]*mutex)
+)
+
+// local locks key within the process and returns the unlock, which drops the
+// mutex once nobody holds or waits for it.
+func local(key string) func() {
+	localMu.Lock()
+	m := locals[key]
+	if m == nil {
+		m = new(mutex)
+		locals[key] = m
+	}
+	m.refs++
+	localMu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		localMu.Lock()
+		if m.refs--; m.refs == 0 {
+			delete(locals, key)
+		}
+		localMu.Unlock()
+	}
+}
@@ -0,0 +1,142 @@
+package lock
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kv is a Store in memory.
+type kv struct {
+	mu      sync.Mutex
+	vals    map[string][]byte
+	extends int
+}
+
+func (s *kv) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.vals[key]; ok {
+		return false, nil
+	}
+	s.vals[key] = value
+	return true, nil
+}
+
+func (s *kv) CompareAndDelete(key string, want []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !bytes.Equal(s.vals[key], want) {
+		return false, nil
+	}
+	delete(s.vals, key)
+	return true, nil
+}
+
+func (s *kv) CompareAndExtend(key string, want []byte, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !bytes.Equal(s.vals[key], want) {
+		return false, nil
+	}
+	s.extends++
+	return true, nil
+}
+
+// Holders of one key take turns, and the process-local mutex is dropped once
+// the last of them lets go.
+func TestHold_Serialises(t *testing.T) {
+	s := &kv{vals: make(map[string][]byte)}
+	SetStore(s)
+	defer SetStore(nil)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		in, most int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := hold("acme\x00order\x00o1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			in++
+			most = max(most, in)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			in--
+			mu.Unlock()
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if most != 1 {
+		t.Fatalf("%d holders at once, want 1", most)
+	}
+	if len(locals) != 0 || len(s.vals) != 0 {
+		t.Fatalf("left behind %d mutexes and %d kv locks", len(locals), len(s.vals))
+	}
+}
+
+// A lock another replica holds is waited for, then refused.
+func TestHold_BusyElsewhere(t *testing.T) {
+	s := &kv{vals: make(map[string][]byte)}
+	SetStore(s)
+	defer SetStore(nil)
+
+	defer func(w time.Duration) { wait = w }(wait)
+	wait = 50 * time.Millisecond
+
+	// The other replica's holder.
+	s.vals[storeKey("acme\x00order\x00o1")] = []byte("theirs")
+
+	start := time.Now()
+	if _, err := hold("acme\x00order\x00o1"); err != ErrBusy {
+		t.Fatalf("err = %v, want ErrBusy", err)
+	}
+	if waited := time.Since(start); waited < wait {
+		t.Fatalf("gave up after %s, want %s", waited, wait)
+	}
+	if len(locals) != 0 || string(s.vals[storeKey("acme\x00order\x00o1")]) != "theirs" {
+		t.Fatal("a refused hold left its mutex, or took the other replica's lock")
+	}
+}
+
+// A lock is renewed for as long as it is held, and no longer.
+func TestHold_Renews(t *testing.T) {
+	s := &kv{vals: make(map[string][]byte)}
+	SetStore(s)
+	defer SetStore(nil)
+
+	defer func(d time.Duration) { ttl = d }(ttl)
+	ttl = 30 * time.Millisecond
+
+	unlock, err := hold("acme\x00session\x00cs_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(4 * ttl)
+	unlock()
+
+	s.mu.Lock()
+	renewed := s.extends
+	s.mu.Unlock()
+	if renewed < 3 {
+		t.Fatalf("renewed %d times over four ttls, want at least 3", renewed)
+	}
+
+	time.Sleep(ttl)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.extends != renewed || len(s.vals) != 0 {
+		t.Fatalf("renewed after release, or left the lock behind")
+	}
+}
@@ -229,7 +229,7 @@ func TokenRequired(masks ...bit.Mask) zip.Handler {
 					c.Locals("permissions", bit.Field(permission.Admin|permission.Live))
 				}
 				c.Locals("organization", org)
-				return c.Next()
+				return idempotent(c)
 			}
 		}
 
@@ -252,7 +252,7 @@ func TokenRequired(masks ...bit.Mask) zip.Handler {
 				// IAM principal's org "just works" with no commerce-side provisioning.
 				// Idempotent — a no-op when iammiddleware already resolved it upstream.
 				ensureIAMOrg(c)
-				return c.Next()
+				return admit(c)
 			}
 			return http.Fail(c, 403, "Token doesn't support this scope",
 				errors.New("IAM principal lacks required permission scope"))
@@ -297,8 +297,21 @@ func TokenRequired(masks ...bit.Mask) zip.Handler {
 		c.Locals("permissions", tok.Permissions)
 		c.Locals("organization", org)
 		c.Locals("token", tok)
-		return c.Next()
+
+		return admit(c)
+	}
+}
+
+// admit runs the rest of the chain for a caller TokenRequired has verified:
+// the request is counted against the rate limits of the caller and its org,
+// then run under its idempotency key. The service token is the platform
+// calling itself and is never rate-limited, so it goes straight to
+// idempotent.
+func admit(c *zip.Ctx) error {
+	if !withinRateLimit(c) {
+		return nil
 	}
+	return idempotent(c)
 }
 
 func GetAccessToken(c *zip.Ctx) string {
@@ -0,0 +1,81 @@
+// Copyright (c) 2014-present Hanzo AI, Inc.
+// Licensed under MIT OR Apache-2.0. See LICENSE-MIT and LICENSE-APACHE.
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/audit"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/middleware/iammiddleware"
+	"github.com/hanzoai/commerce/types/accesstoken"
+)
+
+// Audit records every mutating call (POST, PUT, PATCH, DELETE) in the audit
+// log, with the model changes it made.
+//
+// It is mounted on a group ahead of the auth middleware, so the request
+// context it installs is the one every handler derives from, and it reads the
+// actor and org only after the handler has returned — by then whichever auth
+// path admitted the call has left them in the locals. A call that auth
+// refused is anonymous, and is recorded only if it changed a model (see
+// audit.Request.Flush), so unauthenticated traffic cannot write to the
+// chain faster than the rate limiter lets it change anything.
+//
+// Recording happens after the response is decided and its failure is only
+// logged: the audit log never changes a request's outcome.
+func Audit() zip.Handler {
+	return func(c *zip.Ctx) error {
+		switch c.Method() {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		ctx, req := audit.WithRequest(c.Context())
+		c.SetContext(ctx)
+
+		err := c.Next()
+
+		call := audit.Call{
+			Actor:     AuditActor(c),
+			Method:    c.Method(),
+			Route:     c.Path(),
+			Status:    c.Fiber().Response().StatusCode(),
+			RequestID: c.Header("X-Request-Id"),
+		}
+		if route := c.Fiber().Route(); route != nil && route.Path != "" {
+			call.Route = route.Path
+		}
+		if org, ok := GetOrganizationOK(c); ok && org != nil {
+			call.Org = org.Name
+		}
+		if ferr := req.Flush(ctx, call); ferr != nil {
+			log.Error("audit: %s %s: %v", call.Method, call.Route, ferr, ctx)
+		}
+		return err
+	}
+}
+
+// AuditActor names who made this call, with the same precedence RequireAdmin
+// gives the auth paths: the service token, then an IAM principal, then an org
+// access token. An API key is named by its token id, never its secret.
+func AuditActor(c *zip.Ctx) audit.Actor {
+	if IsServiceToken(c) {
+		return audit.Actor{Type: audit.ActorService}
+	}
+	if iammiddleware.IsIAMAuthenticated(c) {
+		return audit.Actor{Type: audit.ActorIAM, ID: iammiddleware.GetIAMClaims(c).Subject}
+	}
+	if tok, ok := c.Locals("token").(*accesstoken.AccessToken); ok && tok != nil {
+		id := tok.JTI
+		if id == "" {
+			id = tok.Name
+		}
+		return audit.Actor{Type: audit.ActorAPIKey, ID: id}
+	}
+	return audit.Actor{Type: audit.ActorAnonymous}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/zap-proto/zip"
+)
+
+var (
+	proxyHeader    string
+	trustedProxies []netip.Prefix
+)
+
+// SetTrustedProxies says which peers are proxies the client IP may be read
+// through (called once at bootstrap). header names where they put it, e.g.
+// X-Forwarded-For; proxies are IPs or CIDRs. Until it is called, or with no
+// proxies, the client IP is the peer's, and a header naming another is not
+// believed.
+func SetTrustedProxies(header string, proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(p)
+			if aerr != nil {
+				return fmt.Errorf("trusted proxy %q: %w", p, err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	proxyHeader, trustedProxies = strings.TrimSpace(header), prefixes
+	return nil
+}
+
+// ClientIP is the IP of the client that made the request. When the peer is
+// a trusted proxy, it is the last address in the proxy header that is not
+// one: each proxy appends the peer it heard from, so the addresses before
+// the first untrusted one from the right are the client's to write. When the
+// peer is not a trusted proxy, it is the peer, whatever the header says.
+func ClientIP(c *zip.Ctx) string {
+	peer := c.Fiber().IP()
+	if proxyHeader == "" || !trustedProxy(peer) {
+		return peer
+	}
+	hops := strings.Split(c.Header(proxyHeader), ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		client = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// trustedProxy is whether ip is one of the trusted proxies.
+func trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
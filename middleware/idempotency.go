@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/idempotencykey"
+	jsonhttp "github.com/hanzoai/commerce/util/json/http"
+)
+
+// IdempotencyTTL is how long a key's response is kept to replay. A retry
+// after it runs the request again.
+const IdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKey bounds the keys accepted; a UUID is 36.
+const maxIdempotencyKey = 255
+
+// ctxKeyIdempotent marks a request whose key is already being guarded, so
+// the second TokenRequired on a route does not guard it again.
+const ctxKeyIdempotent = "idempotent"
+
+// idempotent runs the rest of the chain for TokenRequired, once per request,
+// and makes a POST, PATCH or DELETE that carries an Idempotency-Key (or
+// X-Idempotency-Key) safe to retry: the first request with a key runs, and
+// its response — status, headers and body — is kept and answered again to
+// every retry with that key for IdempotencyTTL. The headers that describe
+// the first exchange rather than the response (see replayedHeader) are not
+// kept.
+//
+// Keys belong to the org and the caller who sent them (an IAM user, an API
+// key, the service), so two callers cannot collide on, or read, each other's.
+// A key is tied to the request it was first sent with — method, path, query
+// and body — and reusing it for another is refused with a 422. A retry that
+// arrives while the first is still running is refused with a 409. Routes
+// TokenRequired does not run on are guarded by Idempotency.
+//
+// Only a response worth replaying is kept. A 5xx, an error the handler
+// returned, a refused credential (401, 403), a 409 or a 429 gives the key
+// back, so a retry runs afresh. And
+// if the guard's own store fails, the request runs unguarded, as the billing
+// handlers that guard themselves do: refusing every write because the
+// idempotency records cannot be read would be the bigger outage.
+func idempotent(c *zip.Ctx) error {
+	switch c.Method() {
+	case http.MethodPost, http.MethodPatch, http.MethodDelete:
+	default:
+		return c.Next()
+	}
+	if c.Locals(ctxKeyIdempotent) != nil {
+		return c.Next()
+	}
+	key := idempotencyKeyOf(c)
+	if key == "" {
+		return c.Next()
+	}
+	c.Locals(ctxKeyIdempotent, true)
+	if len(key) > maxIdempotencyKey {
+		return jsonhttp.Fail(c, 400, "Idempotency-Key may be at most 255 characters", errors.New("idempotency key too long"))
+	}
+	org, ok := GetOrganizationOK(c)
+	if !ok || org == nil {
+		return c.Next()
+	}
+
+	actor := AuditActor(c)
+	scope := "http:" + string(actor.Type) + ":" + actor.ID
+	fingerprint := requestFingerprint(c)
+	db := datastore.NewNamespaced(org.Namespaced(c.Context()))
+
+	rec, replay, err := idempotencykey.Start(db, scope, key, fingerprint, time.Now().Add(IdempotencyTTL))
+	if errors.Is(err, lock.ErrBusy) {
+		return jsonhttp.Fail(c, 409, "A request with this Idempotency-Key is still in progress", err)
+	}
+	if err != nil {
+		log.Error("idempotency: start %s %s: %v", c.Method(), c.Path(), err, c)
+		return c.Next()
+	}
+	if replay {
+		switch {
+		case rec.Fingerprint != fingerprint:
+			return jsonhttp.Fail(c, 422, "Idempotency-Key was already used for a different request", errors.New("idempotency key reused"))
+		case rec.Status != idempotencykey.StatusCompleted:
+			return jsonhttp.Fail(c, 409, "A request with this Idempotency-Key is still in progress", errors.New("idempotency key in flight"))
+		}
+		status := rec.StatusCode
+		if status == 0 {
+			status = 200
+		}
+		for name, values := range rec.Headers {
+			for _, v := range values {
+				c.Fiber().Response().Header.Add(name, v)
+			}
+		}
+		if rec.ContentType != "" {
+			c.SetHeader("Content-Type", rec.ContentType)
+		}
+		c.SetHeader("Idempotent-Replayed", "true")
+		return c.Bytes(status, []byte(rec.Response))
+	}
+
+	err = c.Next()
+	resp := c.Fiber().Response()
+	status := resp.StatusCode()
+	if err != nil || status >= 500 || status == 401 || status == 403 || status == 409 || status == 429 {
+		if aerr := idempotencykey.Abandon(rec); aerr != nil {
+			log.Error("idempotency: abandon %s: %v", c.Path(), aerr, c)
+		}
+		return err
+	}
+	var headers map[string][]string
+	for k, v := range resp.Header.All() {
+		name := http.CanonicalHeaderKey(string(k))
+		if !replayedHeader(name) {
+			continue
+		}
+		if headers == nil {
+			headers = map[string][]string{}
+		}
+		headers[name] = append(headers[name], string(v))
+	}
+	if cerr := idempotencykey.CompleteResponse(rec, status, string(resp.Header.ContentType()), headers, string(resp.Body())); cerr != nil {
+		log.Error("idempotency: complete %s: %v", c.Path(), cerr, c)
+	}
+	return nil
+}
+
+// Idempotency guards the requests of routes that do not run TokenRequired
+// as TokenRequired guards its own. Mount it on the API group after the
+// identity middleware: a request whose org is known by then is guarded
+// here, and any other is left to TokenRequired, which guards it once it has
+// verified the caller. Either way a request is guarded once.
+func Idempotency() zip.Handler {
+	return func(c *zip.Ctx) error {
+		if org, ok := GetOrganizationOK(c); !ok || org == nil {
+			return c.Next()
+		}
+		return idempotent(c)
+	}
+}
+
+// unreplayedHeaders are the response headers a replay does not answer with
+// again: the hop-by-hop ones, those that describe the first exchange rather
+// than the response (its length, date and server), cookies that may have
+// been rotated since, and those the replay sets itself.
+var unreplayedHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+	"Date":                true,
+	"Server":              true,
+	"Set-Cookie":          true,
+	"Retry-After":         true,
+	"Idempotent-Replayed": true,
+}
+
+// replayedHeader is whether a replay answers with the response header name
+// (canonical) again. The RateLimit headers are the first request's count;
+// a retry is counted on its own and carries its own.
+func replayedHeader(name string) bool {
+	return !unreplayedHeaders[name] && !strings.HasPrefix(name, "Ratelimit-")
+}
+
+// idempotencyKeyOf is the request's idempotency key, from either header.
+func idempotencyKeyOf(c *zip.Ctx) string {
+	if key := strings.TrimSpace(c.Header("Idempotency-Key")); key != "" {
+		return key
+	}
+	return strings.TrimSpace(c.Header("X-Idempotency-Key"))
+}
+
+// requestFingerprint hashes what makes a request the request it is: its
+// method, path, query and body.
+func requestFingerprint(c *zip.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Path() + "?"))
+	h.Write(c.Fiber().Request().URI().QueryString())
+	h.Write([]byte{0})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
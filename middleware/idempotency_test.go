@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+// TestRequestFingerprint proves a key pins method, path, query and body: a
+// retry fingerprints the same, and a change to any of them does not.
+func TestRequestFingerprint(t *testing.T) {
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	app.All("/*", func(c *zip.Ctx) error {
+		return c.String(http.StatusOK, idempotencyKeyOf(c)+" "+requestFingerprint(c))
+	})
+
+	fingerprint := func(method, target, body string) string {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Idempotency-Key", " key_1 ")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		key, fp, _ := strings.Cut(string(body), " ")
+		if key != "key_1" {
+			t.Fatalf("key = %q, want key_1", key)
+		}
+		return fp
+	}
+
+	first := fingerprint(http.MethodPost, "/v1/commerce/order?x=1", `{"total":100}`)
+	if again := fingerprint(http.MethodPost, "/v1/commerce/order?x=1", `{"total":100}`); again != first {
+		t.Fatal("the same request fingerprints differently")
+	}
+	for _, other := range []string{
+		fingerprint(http.MethodPatch, "/v1/commerce/order?x=1", `{"total":100}`),
+		fingerprint(http.MethodPost, "/v1/commerce/cart?x=1", `{"total":100}`),
+		fingerprint(http.MethodPost, "/v1/commerce/order?x=2", `{"total":100}`),
+		fingerprint(http.MethodPost, "/v1/commerce/order?x=1", `{"total":101}`),
+	} {
+		if other == first {
+			t.Fatal("a different request fingerprints the same")
+		}
+	}
+}
+
+// TestIdempotency_WithoutTokenRequired guards a route TokenRequired does not
+// run on, once its org is known: a retry is answered from the first
+// response, and the handler runs once.
+func TestIdempotency_WithoutTokenRequired(t *testing.T) {
+	ctx := ae.NewContext()
+	defer ctx.Close()
+
+	base := nscontext.WithNamespace(ctx, "idem-no-token")
+	org := organization.New(datastore.New(base))
+	org.Name = "idem-no-token"
+
+	runs := 0
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	app.Use(zip.H(func(c *zip.Ctx) error {
+		// As IAMTokenRequired: the org is known before any route runs.
+		c.SetContext(base)
+		c.Locals("organization", org)
+		return c.Next()
+	}))
+	app.Use(Idempotency())
+	app.Post("/v1/commerce/promo", func(c *zip.Ctx) error {
+		runs++
+		return c.JSON(http.StatusCreated, map[string]any{"run": runs})
+	})
+
+	post := func() (*http.Response, string) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/commerce/promo", strings.NewReader(`{"on":true}`))
+		req.Header.Set("Idempotency-Key", "promo-1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	first, body := post()
+	again, replayed := post()
+	if runs != 1 {
+		t.Fatalf("handler ran %d times, want 1", runs)
+	}
+	if again.StatusCode != first.StatusCode || replayed != body || again.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry = %d %q (replayed %q), want %d %q replayed", again.StatusCode, replayed, again.Header.Get("Idempotent-Replayed"), first.StatusCode, body)
+	}
+}
+
+// TestIdempotency_ReplaysHeaders answers a retry with the headers the first
+// response carried, such as the Location of what it created, but not those
+// of the first exchange, such as its rate limit count.
+func TestIdempotency_ReplaysHeaders(t *testing.T) {
+	ctx := ae.NewContext()
+	defer ctx.Close()
+
+	base := nscontext.WithNamespace(ctx, "idem-headers")
+	org := organization.New(datastore.New(base))
+	org.Name = "idem-headers"
+
+	runs := 0
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	app.Use(zip.H(func(c *zip.Ctx) error {
+		c.SetContext(base)
+		c.Locals("organization", org)
+		return c.Next()
+	}))
+	app.Use(Idempotency())
+	app.Post("/v1/commerce/order", func(c *zip.Ctx) error {
+		runs++
+		c.SetHeader("Location", "/v1/commerce/order/ord_1")
+		c.SetHeader("X-Request-Run", strconv.Itoa(runs))
+		c.SetHeader("RateLimit-Remaining", strconv.Itoa(10-runs))
+		return c.JSON(http.StatusCreated, map[string]any{"id": "ord_1"})
+	})
+
+	post := func() *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/v1/commerce/order", strings.NewReader(`{"total":100}`))
+		req.Header.Set("Idempotency-Key", "order-1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	post()
+	again := post()
+	if runs != 1 {
+		t.Fatalf("handler ran %d times, want 1", runs)
+	}
+	if again.StatusCode != http.StatusCreated || again.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry = %d, replayed %q; want a replayed 201", again.StatusCode, again.Header.Get("Idempotent-Replayed"))
+	}
+	if loc := again.Header.Get("Location"); loc != "/v1/commerce/order/ord_1" {
+		t.Fatalf("replayed Location = %q, want the first response's", loc)
+	}
+	if run := again.Header.Get("X-Request-Run"); run != "1" {
+		t.Fatalf("replayed X-Request-Run = %q, want 1", run)
+	}
+	if rl := again.Header.Get("RateLimit-Remaining"); rl != "" {
+		t.Fatalf("replayed RateLimit-Remaining = %q, want none: a retry is counted on its own", rl)
+	}
+	if ct := again.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("replayed Content-Type = %q", ct)
+	}
+}
@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/billing/tier"
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/middleware/iammiddleware"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/publishableapikey"
+	"github.com/hanzoai/commerce/ratelimit"
+	"github.com/hanzoai/commerce/types/accesstoken"
+	jsonhttp "github.com/hanzoai/commerce/util/json/http"
+)
+
+// publishableKeyHeader carries a storefront's publishable API key (the same
+// header api/storefront reads).
+const publishableKeyHeader = "x-publishable-api-key"
+
+// ctxKeyRateLimited marks a request already counted. Routes often run
+// TokenRequired twice — the bundle's, then their own with stricter masks —
+// and the second must not count the request again.
+const ctxKeyRateLimited = "rate-limited"
+
+// orgTierTTL is how long an org's tier is remembered for rate limiting. A
+// plan change reaches its limits within it.
+const orgTierTTL = time.Minute
+
+var (
+	rateLimiter *ratelimit.Limiter
+	orgTierOf   func(context.Context, *organization.Organization) (tier.Name, error)
+
+	orgTiersMu sync.Mutex
+	orgTiers   = map[string]cachedTier{}
+)
+
+type cachedTier struct {
+	name    tier.Name
+	expires time.Time
+}
+
+// SetRateLimiter turns rate limiting on (called once at bootstrap, with the
+// infra KV client to count in). Until it is called, nothing is limited.
+func SetRateLimiter(l *ratelimit.Limiter) {
+	rateLimiter = l
+}
+
+// SetRateLimitTier sets how an org's plan tier is found. Without it every
+// org is limited as Free.
+func SetRateLimitTier(f func(context.Context, *organization.Organization) (tier.Name, error)) {
+	orgTierOf = f
+}
+
+// RateLimit limits, by client IP at the Free tier's limits, every request
+// that is not from a verified caller: those with no credential, and those
+// whose credential fails to verify or is never checked. Mount it once on
+// the API group. A caller TokenRequired verifies is limited there instead,
+// once it knows who the caller is and which org's plan applies. The client
+// IP is the one ClientIP reads through the trusted proxies, not the last
+// proxy's.
+//
+// Whether a credential verifies is known only once the route has run, so a
+// request carrying one is checked against its IP's count before, and
+// counted after unless it was admitted: guessing at keys is held to the
+// rate of asking with none.
+func RateLimit() zip.Handler {
+	return func(c *zip.Ctx) error {
+		if rateLimiter == nil || c.Method() == http.MethodOptions || iammiddleware.IsIAMAuthenticated(c) {
+			return c.Next()
+		}
+		cfg, ip := tier.Get(tier.Free), "ip:"+ClientIP(c)
+		parseAccessToken(c)
+		if GetAccessToken(c) == "" {
+			if !limit(c, cfg, ip, "") {
+				return nil
+			}
+			return c.Next()
+		}
+
+		if !underLimit(c, cfg, ip) {
+			return nil
+		}
+		err := c.Next()
+		if c.Locals(ctxKeyRateLimited) == nil && c.Locals(ctxKeyServiceToken) == nil {
+			group := rateLimitGroup(cfg, c.Path())
+			if l, ok := cfg.RateLimitFor(group); ok {
+				if _, terr := rateLimiter.Take(c.Context(), group+"/"+ip, l.Requests, l.Window()); terr != nil {
+					log.Warn("ratelimit: %s %s: %v", group, ip, terr, c)
+				}
+			}
+		}
+		return err
+	}
+}
+
+// withinRateLimit counts a request TokenRequired admitted against the caller
+// and its org, at the limits of the org's tier. It renders a 429 and returns
+// false when either is spent. The caller is, in order, the IAM user, the
+// verified API key, and the client IP. A storefront's publishable key, once
+// it is found to be one of the org's usable keys, narrows the API key it is
+// sent with, so one storefront does not spend another's; a key that is not
+// the org's is not a caller of its own.
+func withinRateLimit(c *zip.Ctx) bool {
+	if rateLimiter == nil || c.Method() == http.MethodOptions || c.Locals(ctxKeyRateLimited) != nil {
+		return true
+	}
+	c.Locals(ctxKeyRateLimited, true)
+	org, ok := GetOrganizationOK(c)
+	if !ok || org == nil {
+		return true
+	}
+
+	var caller string
+	switch tok, _ := c.Locals("token").(*accesstoken.AccessToken); {
+	case iammiddleware.IsIAMAuthenticated(c) && iammiddleware.GetIAMClaims(c).Subject != "":
+		caller = "user:" + iammiddleware.GetIAMClaims(c).Subject
+	case tok != nil && tok.Name != "":
+		caller = "apikey:" + tok.Name
+		if pk := publishableKey(c, org); pk != "" {
+			caller += "/pk:" + pk
+		}
+	default:
+		caller = "ip:" + ClientIP(c)
+	}
+
+	name, err := orgTier(c.Context(), org)
+	if err != nil {
+		// Limiting a paying org at Free's limits because its plan could not be
+		// read would be worse than not limiting it for a moment.
+		log.Warn("ratelimit: tier of org %s: %v", org.Id(), err, c)
+		return true
+	}
+	return limit(c, tier.Get(name), "org/"+org.Id()+"/"+caller, "org/"+org.Id())
+}
+
+// publishableKey is the publishable key the request carries when it is one
+// of org's usable keys, and "" otherwise.
+func publishableKey(c *zip.Ctx, org *organization.Organization) string {
+	id := strings.TrimSpace(c.Header(publishableKeyHeader))
+	if id == "" {
+		return ""
+	}
+	k := publishableapikey.New(datastore.New(org.Namespaced(c.Context())))
+	if err := k.GetById(id); err != nil || !k.Usable() {
+		return ""
+	}
+	return k.Id()
+}
+
+// orgTier is the tier org's limits are read from, remembered for orgTierTTL.
+func orgTier(ctx context.Context, org *organization.Organization) (tier.Name, error) {
+	if orgTierOf == nil {
+		return tier.Free, nil
+	}
+	now := time.Now()
+	orgTiersMu.Lock()
+	cached, ok := orgTiers[org.Id()]
+	orgTiersMu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.name, nil
+	}
+
+	name, err := orgTierOf(ctx, org)
+	if err != nil {
+		return "", err
+	}
+	orgTiersMu.Lock()
+	orgTiers[org.Id()] = cachedTier{name: name, expires: now.Add(orgTierTTL)}
+	orgTiersMu.Unlock()
+	return name, nil
+}
+
+// limit counts the request against caller and, when org is set, the org as a
+// whole, then sets the RateLimit headers from whichever is nearer its limit.
+// It renders a 429 and returns false when either is spent.
+//
+// A store error lets the request through: the API does not go down with the
+// KV store.
+func limit(c *zip.Ctx, cfg *tier.Config, caller, org string) bool {
+	group := rateLimitGroup(cfg, c.Path())
+	l, ok := cfg.RateLimitFor(group)
+	if !ok {
+		return true
+	}
+
+	r, err := rateLimiter.Take(c.Context(), group+"/"+caller, l.Requests, l.Window())
+	if err != nil {
+		log.Warn("ratelimit: %s %s: %v", group, caller, err, c)
+		return true
+	}
+	policy := l.Requests
+	if r.Allowed && org != "" && l.OrgRequests > 0 {
+		o, err := rateLimiter.Take(c.Context(), group+"/"+org, l.OrgRequests, l.Window())
+		switch {
+		case err != nil:
+			log.Warn("ratelimit: %s %s: %v", group, org, err, c)
+		case !o.Allowed || o.Remaining < r.Remaining:
+			r, policy = o, l.OrgRequests
+		}
+	}
+
+	if r.Allowed {
+		headers(c, r, policy, l.WindowSeconds)
+		return true
+	}
+	refuse(c, r, policy, l.WindowSeconds, caller)
+	return false
+}
+
+// headers sets the RateLimit headers of r, counted under policy requests
+// per window seconds.
+func headers(c *zip.Ctx, r ratelimit.Result, policy, window int) {
+	c.SetHeader("RateLimit-Limit", strconv.Itoa(r.Limit))
+	c.SetHeader("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	c.SetHeader("RateLimit-Reset", strconv.Itoa(seconds(r.Reset)))
+	c.SetHeader("RateLimit-Policy", strconv.Itoa(policy)+";w="+strconv.Itoa(window))
+}
+
+// refuse renders the 429 of refused result r for caller.
+func refuse(c *zip.Ctx, r ratelimit.Result, policy, window int, caller string) {
+	headers(c, r, policy, window)
+	retry := seconds(r.RetryAfter)
+	c.SetHeader("Retry-After", strconv.Itoa(retry))
+	_ = jsonhttp.Fail(c, http.StatusTooManyRequests,
+		"Rate limit exceeded; retry in "+strconv.Itoa(retry)+"s",
+		errors.New("rate limit exceeded for "+caller))
+}
+
+// underLimit is whether one more request from caller would be within its
+// limit, without counting it. It renders a 429 and returns false when not.
+func underLimit(c *zip.Ctx, cfg *tier.Config, caller string) bool {
+	group := rateLimitGroup(cfg, c.Path())
+	l, ok := cfg.RateLimitFor(group)
+	if !ok {
+		return true
+	}
+	r, err := rateLimiter.Peek(c.Context(), group+"/"+caller, l.Requests, l.Window())
+	if err != nil {
+		log.Warn("ratelimit: %s %s: %v", group, caller, err, c)
+		return true
+	}
+	if r.Allowed {
+		return true
+	}
+	refuse(c, r, l.Requests, l.WindowSeconds, caller)
+	return false
+}
+
+// rateLimitGroup is the route group path is in: the first of its segments
+// that cfg sets a limit for, or "*".
+func rateLimitGroup(cfg *tier.Config, path string) string {
+	for _, seg := range strings.Split(strings.ToLower(path), "/") {
+		if _, ok := cfg.RateLimits[seg]; ok && seg != "" && seg != "*" {
+			return seg
+		}
+	}
+	return "*"
+}
+
+// seconds rounds d up to whole seconds, as the headers carry it.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
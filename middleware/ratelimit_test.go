@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zap-proto/zip"
+
+	"github.com/hanzoai/commerce/billing/tier"
+	"github.com/hanzoai/commerce/ratelimit"
+)
+
+// memCounter is an in-memory ratelimit.Counter.
+type memCounter struct {
+	mu sync.Mutex
+	n  map[string]int64
+}
+
+func (m *memCounter) IncrBy(key string, by int64, _ time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.n[key] += by
+	return m.n[key], nil
+}
+
+func (m *memCounter) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, ok := m.n[key]; ok {
+		return strconv.FormatInt(n, 10), nil
+	}
+	return "", nil
+}
+
+// TestRateLimit_AnonymousByIP spends the Free tier's checkout limit from one
+// client IP with no credential: every request in it carries the RateLimit
+// headers, and the one past it is a 429 with Retry-After.
+func TestRateLimit_AnonymousByIP(t *testing.T) {
+	SetRateLimiter(ratelimit.New(&memCounter{n: map[string]int64{}}))
+	t.Cleanup(func() { SetRateLimiter(nil) })
+
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	app.Use(RateLimit())
+	app.Post("/v1/commerce/checkout/charge", func(c *zip.Ctx) error {
+		return c.JSON(http.StatusOK, map[string]any{"ok": true})
+	})
+
+	limit, _ := tier.Get(tier.Free).RateLimitFor("checkout")
+	for i := 1; i <= limit.Requests+1; i++ {
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/v1/commerce/checkout/charge", nil))
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if i <= limit.Requests {
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("request %d = %d, want 200", i, resp.StatusCode)
+			}
+			if got, want := resp.Header.Get("RateLimit-Remaining"), strconv.Itoa(limit.Requests-i); got != want {
+				t.Fatalf("request %d RateLimit-Remaining = %q, want %q", i, got, want)
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("request past the limit = %d, want 429", resp.StatusCode)
+		}
+		if resp.Header.Get("Retry-After") == "" || resp.Header.Get("RateLimit-Limit") != strconv.Itoa(limit.Requests) {
+			t.Fatalf("429 headers = %v", resp.Header)
+		}
+	}
+
+	// A credential nothing verifies does not get the IP round its limit.
+	req := httptest.NewRequest(http.MethodPost, "/v1/commerce/checkout/charge", nil)
+	req.Header.Set("Authorization", "Bearer some-org-key")
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unverified credential past the limit = %v, %v; want 429", resp, err)
+	}
+}
+
+// TestRateLimit_FailedAuthByIP counts the requests whose credential fails
+// against their IP, and not those whose credential is admitted.
+func TestRateLimit_FailedAuthByIP(t *testing.T) {
+	SetRateLimiter(ratelimit.New(&memCounter{n: map[string]int64{}}))
+	t.Cleanup(func() { SetRateLimiter(nil) })
+
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	app.Use(RateLimit())
+	app.Post("/v1/commerce/checkout/charge", func(c *zip.Ctx) error {
+		// As TokenRequired: a good key is admitted, any other refused.
+		if c.Header("Authorization") != "Bearer good" {
+			return c.JSON(http.StatusUnauthorized, map[string]any{"ok": false})
+		}
+		c.Locals(ctxKeyRateLimited, true)
+		return c.JSON(http.StatusOK, map[string]any{"ok": true})
+	})
+	call := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/commerce/checkout/charge", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	limit, _ := tier.Get(tier.Free).RateLimitFor("checkout")
+	for i := 1; i <= limit.Requests+5; i++ {
+		if got := call("good"); got != http.StatusOK {
+			t.Fatalf("admitted request %d = %d, want 200", i, got)
+		}
+	}
+	for i := 1; i <= limit.Requests; i++ {
+		if got := call("guess-" + strconv.Itoa(i)); got != http.StatusUnauthorized {
+			t.Fatalf("failed request %d = %d, want 401", i, got)
+		}
+	}
+	if got := call("guess-again"); got != http.StatusTooManyRequests {
+		t.Fatalf("failed request past the limit = %d, want 429", got)
+	}
+}
+
+// TestRateLimit_ForwardedClientIP counts an anonymous caller behind a trusted
+// proxy by the client the proxy names, and one behind any other peer by the
+// peer, whatever its header says.
+func TestRateLimit_ForwardedClientIP(t *testing.T) {
+	SetRateLimiter(ratelimit.New(&memCounter{n: map[string]int64{}}))
+	t.Cleanup(func() { SetRateLimiter(nil); _ = SetTrustedProxies("", nil) })
+
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	var peer string
+	app.Get("/peer", func(c *zip.Ctx) error {
+		peer = c.Fiber().IP()
+		return c.JSON(http.StatusOK, map[string]any{"ok": true})
+	})
+	app.Use(RateLimit())
+	app.Post("/v1/commerce/checkout/charge", func(c *zip.Ctx) error {
+		return c.JSON(http.StatusOK, map[string]any{"ok": true})
+	})
+	if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/peer", nil)); err != nil || peer == "" {
+		t.Fatalf("peer = %q, %v", peer, err)
+	}
+	call := func(forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/commerce/checkout/charge", nil)
+		req.Header.Set("X-Forwarded-For", forwarded)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	limit, _ := tier.Get(tier.Free).RateLimitFor("checkout")
+	if err := SetTrustedProxies("X-Forwarded-For", []string{peer}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= limit.Requests; i++ {
+		if got := call("203.0.113.7"); got != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200", i, got)
+		}
+	}
+	if got := call("203.0.113.7"); got != http.StatusTooManyRequests {
+		t.Fatalf("forwarded client past the limit = %d, want 429", got)
+	}
+	if got := call("203.0.113.8"); got != http.StatusOK {
+		t.Fatalf("another forwarded client = %d, want 200: it has a count of its own", got)
+	}
+
+	// Trusting no proxy, the header is the client's own to write: every
+	// request is the peer's, and spends one count.
+	if err := SetTrustedProxies("X-Forwarded-For", nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= limit.Requests; i++ {
+		if got := call("198.51.100." + strconv.Itoa(i)); got != http.StatusOK {
+			t.Fatalf("request %d from the peer = %d, want 200", i, got)
+		}
+	}
+	if got := call("198.51.100.250"); got != http.StatusTooManyRequests {
+		t.Fatalf("peer past the limit with a new header = %d, want 429", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	t.Cleanup(func() { _ = SetTrustedProxies("", nil) })
+
+	app := zip.New(zip.Config{DisableStartupMessage: true})
+	var peer, got string
+	app.Get("/", func(c *zip.Ctx) error {
+		peer, got = c.Fiber().IP(), ClientIP(c)
+		return c.JSON(http.StatusOK, map[string]any{"ok": true})
+	})
+	ip := func(forwarded string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	ip("")
+
+	if err := SetTrustedProxies("X-Forwarded-For", []string{peer, "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	for forwarded, want := range map[string]string{
+		"":                                    peer,
+		"203.0.113.7":                         "203.0.113.7",
+		"203.0.113.7, 10.0.0.2":               "203.0.113.7",
+		"198.51.100.1, 203.0.113.7, 10.1.2.3": "203.0.113.7",
+		"10.0.0.3, 10.0.0.2":                  "10.0.0.3",
+		"garbage, 10.0.0.2":                   "10.0.0.2",
+	} {
+		if got := ip(forwarded); got != want {
+			t.Errorf("ClientIP with X-Forwarded-For %q = %q, want %q", forwarded, got, want)
+		}
+	}
+
+	if err := SetTrustedProxies("X-Forwarded-For", []string{"not-an-ip"}); err == nil {
+		t.Error("SetTrustedProxies accepted a proxy that is neither an IP nor a CIDR")
+	}
+}
+
+func TestRateLimitGroup(t *testing.T) {
+	cfg := tier.Get(tier.Pro)
+	for path, want := range map[string]string{
+		"/v1/commerce/checkout/charge":    "checkout",
+		"/v1/commerce/products/search":    "search",
+		"/v1/commerce/order/abc":          "*",
+		"/v1/commerce/Checkout/authorize": "checkout",
+	} {
+		if got := rateLimitGroup(cfg, path); got != want {
+			t.Errorf("rateLimitGroup(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
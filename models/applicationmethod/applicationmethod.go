@@ -11,6 +11,27 @@ import (
 
 func init() { orm.Register[ApplicationMethod]("applicationmethod") }
 
+// Types: how Value reads. A percentage is in basis points (1500 = 15%); a
+// fixed amount is in the currency's minor unit.
+const (
+	Percentage = "percentage"
+	Fixed      = "fixed"
+)
+
+// Target types: what the discount comes off.
+const (
+	TargetOrder    = "order"
+	TargetItems    = "items"
+	TargetShipping = "shipping_methods"
+)
+
+// Allocations for a fixed amount on items: Each takes it off every unit,
+// Across splits it once over all of them.
+const (
+	AllocationEach   = "each"
+	AllocationAcross = "across"
+)
+
 type ApplicationMethod struct {
 	mixin.Model[ApplicationMethod]
 
@@ -22,6 +43,11 @@ type ApplicationMethod struct {
 	TargetType   string `json:"targetType"`
 	Allocation   string `json:"allocation"`
 
+	// Buy-get only: every BuyRulesMinQuantity qualifying units bought earn
+	// ApplyToQuantity target units at this method's discount.
+	BuyRulesMinQuantity int `json:"buyRulesMinQuantity,omitempty"`
+	ApplyToQuantity     int `json:"applyToQuantity,omitempty"`
+
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-"`
 	Metadata_ string `json:"-" datastore:",noindex"`
 }
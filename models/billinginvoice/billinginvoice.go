@@ -7,6 +7,8 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/val"
 	"github.com/hanzoai/orm"
@@ -88,6 +90,17 @@ type BillingInvoice struct {
 
 	Currency currency.Type `json:"currency" orm:"default:usd"`
 
+	// Tax treatment, as last calculated: the tax by rate and jurisdiction,
+	// the country the seller charged from, the buyer's tax number and
+	// whether that made the invoice reverse-charged, and the evidence of
+	// where the buyer is.
+	TaxRates      []tax.Rate   `json:"taxRates,omitempty" datastore:"-"`
+	TaxRates_     string       `json:"-" datastore:",noindex"`
+	SellerCountry string       `json:"sellerCountry,omitempty"`
+	CustomerTaxId taxid.TaxId  `json:"customerTaxId,omitempty"`
+	ReverseCharge bool         `json:"reverseCharge,omitempty"`
+	TaxEvidence   tax.Evidence `json:"taxEvidence,omitempty"`
+
 	// Status lifecycle: draft -> open -> paid | void | uncollectible
 	Status   Status    `json:"status" orm:"default:draft"`
 	DueDate  time.Time `json:"dueDate,omitempty"`
@@ -126,6 +139,12 @@ func (inv *BillingInvoice) Load(ps []datastore.Property) (err error) {
 		}
 	}
 
+	if len(inv.TaxRates_) > 0 {
+		if err = json.DecodeBytes([]byte(inv.TaxRates_), &inv.TaxRates); err != nil {
+			return err
+		}
+	}
+
 	if len(inv.Metadata_) > 0 {
 		err = json.DecodeBytes([]byte(inv.Metadata_), &inv.Metadata)
 	}
@@ -135,6 +154,7 @@ func (inv *BillingInvoice) Load(ps []datastore.Property) (err error) {
 
 func (inv *BillingInvoice) Save() (ps []datastore.Property, err error) {
 	inv.LineItems_ = string(json.EncodeBytes(&inv.LineItems))
+	inv.TaxRates_ = string(json.EncodeBytes(inv.TaxRates))
 	inv.Metadata_ = string(json.EncodeBytes(&inv.Metadata))
 	return datastore.SaveStruct(inv)
 }
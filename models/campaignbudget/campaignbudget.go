@@ -11,6 +11,14 @@ import (
 
 func init() { orm.Register[CampaignBudget]("campaignbudget") }
 
+// Budget types. A spend budget caps the money a campaign's promotions give
+// away, in CurrencyCode's minor unit; a usage budget caps how many orders
+// they are redeemed on.
+const (
+	Spend = "spend"
+	Usage = "usage"
+)
+
 type CampaignBudget struct {
 	mixin.Model[CampaignBudget]
 
@@ -11,7 +11,9 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/coupon"
 	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/promotion/engine"
 	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/val"
 	"github.com/hanzoai/orm"
@@ -53,6 +55,11 @@ type Cart struct {
 	// Status
 	Status Status `json:"status" orm:"default:active"`
 
+	// Region and sales channel the cart is shopped in, for promotion rules
+	// that are limited to them.
+	RegionId       string `json:"regionId,omitempty"`
+	SalesChannelId string `json:"salesChannelId,omitempty"`
+
 	// 3-letter ISO currency code (lowercase).
 	Currency currency.Type `json:"currency"`
 
@@ -68,9 +75,21 @@ type Cart struct {
 	// Shipping cost applied. Amount in cents.
 	Shipping currency.Cents `json:"shipping"`
 
+	// Part of Shipping taken off by promotions. Amount in cents.
+	ShippingDiscount currency.Cents `json:"shippingDiscount,omitempty"`
+
 	// Sales tax applied. Amount in cents.
 	Tax currency.Cents `json:"tax"`
 
+	// Whether Tax is included in the prices rather than added to them.
+	TaxInclusive bool `json:"taxInclusive,omitempty"`
+
+	// CustomerTaxId is the tax number the shopper buys under, if any, and
+	// TaxReverseCharge that it makes the sale one the buyer accounts for
+	// the tax on.
+	CustomerTaxId    taxid.TaxId `json:"customerTaxId,omitempty"`
+	TaxReverseCharge bool        `json:"taxReverseCharge,omitempty"`
+
 	// Total = subtotal + shipping + taxes + adjustments. Amount in cents.
 	Total currency.Cents `json:"total"`
 
@@ -87,6 +106,10 @@ type Cart struct {
 	CouponCodes []string        `json:"couponCodes,omitempty" datastore:",noindex"`
 	ReferrerId  string          `json:"referrerId,omitempty"`
 
+	// Promotions applied when the cart was last tallied.
+	Promotions  []engine.Adjustment `json:"promotions,omitempty" datastore:"-"`
+	Promotions_ string              `json:"-" datastore:",noindex"`
+
 	// Series of events that have occured relevant to this order
 	History []Event `json:"-,omitempty" datastore:",noindex"`
 
@@ -142,6 +165,10 @@ func (c *Cart) Load(ps []datastore.Property) (err error) {
 		err = json.DecodeBytes([]byte(c.Items_), &c.Items)
 	}
 
+	if len(c.Promotions_) > 0 {
+		err = json.DecodeBytes([]byte(c.Promotions_), &c.Promotions)
+	}
+
 	if len(c.Metadata_) > 0 {
 		err = json.DecodeBytes([]byte(c.Metadata_), &c.Metadata)
 	}
@@ -153,6 +180,7 @@ func (c *Cart) Save() (ps []datastore.Property, err error) {
 	// Serialize unsupported properties
 	c.Metadata_ = string(json.EncodeBytes(&c.Metadata))
 	c.Items_ = string(json.EncodeBytes(c.Items))
+	c.Promotions_ = string(json.EncodeBytes(c.Promotions))
 
 	// Save properties
 	return datastore.SaveStruct(c)
@@ -0,0 +1,73 @@
+package cart
+
+import (
+	"time"
+
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/promotion/engine"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// Tally totals the cart with the promotions it qualifies for, through the
+// same engine checkout uses, so the total a shopper is shown is the total the
+// order will come to before tax and shipping are priced.
+//
+// Discount is the promotions' discount. Coupons are still applied by the
+// order at checkout, not here. Shipping is left as quoted and what promotions
+// take off it is ShippingDiscount. Tax is quoted once there is a shipping
+// address a tax region covers, on what the promotions left.
+func (c *Cart) Tally() error {
+	db := c.Datastore()
+
+	// Tag and category rules need the product; a line item only keeps it in
+	// memory for the request that added it.
+	for i := range c.Items {
+		li := &c.Items[i]
+		if li.Product != nil || li.ProductId == "" {
+			continue
+		}
+		p := product.New(db)
+		if err := p.GetById(li.ProductId); err == nil {
+			li.Product = p
+		}
+	}
+
+	groups, err := engine.CustomerGroups(db, c.UserId)
+	if err != nil {
+		return err
+	}
+
+	items := engine.LineItems(c.Items)
+	var lineTotal currency.Cents
+	for _, it := range items {
+		lineTotal += it.UnitPrice * currency.Cents(it.Quantity)
+	}
+
+	res, err := engine.Apply(db, &engine.Cart{
+		Currency:         string(c.Currency),
+		CustomerId:       c.UserId,
+		CustomerGroupIds: groups,
+		SalesChannelId:   c.SalesChannelId,
+		RegionId:         c.RegionId,
+		Codes:            c.CouponCodes,
+		Items:            items,
+		Shipping:         c.Shipping,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	c.Promotions = res.Adjustments
+	c.LineTotal = lineTotal
+	c.Discount = res.Discount
+	c.Subtotal = lineTotal - res.Discount
+	c.ShippingDiscount = res.ShippingDiscount
+	if err := c.tallyTax(res.Adjustments); err != nil {
+		return err
+	}
+	c.Total = c.Subtotal + c.Shipping - c.ShippingDiscount
+	if !c.TaxInclusive {
+		c.Total += c.Tax
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package cart
+
+import (
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/promotion/engine"
+	"github.com/hanzoai/commerce/models/store"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax"
+	"github.com/hanzoai/commerce/tax/taxid"
+)
+
+// TaxIdentity makes Cart a taxid.Holder, so the number a shopper gives is
+// checked when the cart is saved.
+func (c *Cart) TaxIdentity() *taxid.TaxId { return &c.CustomerTaxId }
+
+// tallyTax quotes the tax on the cart as the order placed from it would be
+// taxed: each line less what promotions took off it, and shipping less its
+// discount, from the store's country. A cart with no shipping address, or
+// one no tax region covers, keeps the tax it has.
+func (c *Cart) tallyTax(adjustments []engine.Adjustment) error {
+	if c.ShippingAddress.Country == "" {
+		return nil
+	}
+
+	discounts := make(map[string]currency.Cents)
+	for _, adj := range adjustments {
+		if adj.Target == applicationmethod.TargetItems {
+			discounts[adj.ItemId] += adj.Amount
+		}
+	}
+
+	var origin string
+	if c.StoreId != "" {
+		stor := store.New(c.Datastore())
+		if err := stor.GetById(c.StoreId); err == nil {
+			origin = stor.Address.Country
+		}
+	}
+
+	q, err := tax.Calculate(c.Context(), &tax.Request{
+		Currency: c.Currency,
+		Address: tax.Address{
+			Country:    c.ShippingAddress.Country,
+			Province:   c.ShippingAddress.State,
+			City:       c.ShippingAddress.City,
+			PostalCode: c.ShippingAddress.PostalCode,
+		},
+		Customer: tax.Customer{Id: c.UserId, TaxId: c.CustomerTaxId},
+		RegionId: c.RegionId,
+		Origin:   origin,
+		Lines:    tax.LineItems(c.Items, discounts),
+		Shipping: c.Shipping - c.ShippingDiscount,
+	})
+	if err != nil {
+		return err
+	}
+	if q.Jurisdiction == "" {
+		return nil
+	}
+	c.Tax = q.Tax
+	c.TaxInclusive = q.Inclusive
+	c.TaxReverseCharge = q.ReverseCharge
+	return nil
+}
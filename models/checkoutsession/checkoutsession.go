@@ -0,0 +1,176 @@
+// Package checkoutsession is a first-party checkout: a cart walked through
+// the customer's email, where it ships, how, the tax on it, the promotions
+// taken off it and how it is paid, to the order it becomes. The steps and
+// what each one needs are in checkout/session; this is what is stored.
+package checkoutsession
+
+import (
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/promotion/engine"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/util/json"
+	"github.com/hanzoai/orm"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+func init() { orm.Register[CheckoutSession]("checkout-session") }
+
+// Status is where the session is as a whole.
+type Status string
+
+const (
+	// Open is a session still being filled in.
+	Open Status = "open"
+
+	// RequiresAction is a session whose payment waits on the customer
+	// authenticating it (3-D Secure).
+	RequiresAction Status = "requires_action"
+
+	Complete Status = "complete"
+	Expired  Status = "expired"
+	Canceled Status = "canceled"
+)
+
+// Step is a step of checkout, in the order they are taken.
+type Step string
+
+const (
+	StepCart       Step = "cart"
+	StepCustomer   Step = "customer"
+	StepAddress    Step = "address"
+	StepShipping   Step = "shipping"
+	StepTax        Step = "tax"
+	StepPromotions Step = "promotions"
+	StepPayment    Step = "payment"
+)
+
+// Steps are the steps in order.
+var Steps = []Step{StepCart, StepCustomer, StepAddress, StepShipping, StepTax, StepPromotions, StepPayment}
+
+// Index is where step comes in Steps, or -1 for a step that is not one.
+func (s Step) Index() int {
+	for i, step := range Steps {
+		if step == s {
+			return i
+		}
+	}
+	return -1
+}
+
+type CheckoutSession struct {
+	mixin.Model[CheckoutSession]
+
+	CartId  string `json:"cartId"`
+	StoreId string `json:"storeId,omitempty"`
+
+	Status Status `json:"status"`
+
+	// Step is the last step taken. Taking a step again undoes the ones after
+	// it: a new address needs its shipping method chosen and its tax quoted
+	// again.
+	Step Step `json:"step"`
+
+	// Version is bumped by every change; a change made against an older
+	// version than the stored one is refused, so two tabs editing one
+	// checkout cannot each overwrite the other.
+	Version int `json:"version"`
+
+	// ExpiresAt is when an untouched session lapses. Every step moves it.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	Email           string  `json:"email,omitempty"`
+	UserId          string  `json:"userId,omitempty"`
+	ShippingAddress Address `json:"shippingAddress,omitempty"`
+	BillingAddress  Address `json:"billingAddress,omitempty"`
+
+	ShippingOptionId   string `json:"shippingOptionId,omitempty"`
+	ShippingOptionName string `json:"shippingOptionName,omitempty"`
+
+	CouponCodes []string `json:"couponCodes,omitempty" datastore:",noindex"`
+
+	// Totals, as last recomputed from the cart. Amounts in cents.
+	Currency         currency.Type  `json:"currency"`
+	LineTotal        currency.Cents `json:"lineTotal"`
+	Discount         currency.Cents `json:"discount"`
+	Subtotal         currency.Cents `json:"subtotal"`
+	Shipping         currency.Cents `json:"shipping"`
+	ShippingDiscount currency.Cents `json:"shippingDiscount,omitempty"`
+	Tax              currency.Cents `json:"tax"`
+	TaxInclusive     bool           `json:"taxInclusive,omitempty"`
+	Total            currency.Cents `json:"total"`
+
+	Promotions  []engine.Adjustment `json:"promotions,omitempty" datastore:"-"`
+	Promotions_ string              `json:"-" datastore:",noindex"`
+
+	// How the session is paid: the processor to charge through (empty is
+	// the org's payment router), the payment method to charge, and where a
+	// 3-D Secure challenge returns to.
+	Processor       string `json:"processor,omitempty"`
+	PaymentMethodId string `json:"paymentMethodId,omitempty"`
+	ReturnUrl       string `json:"returnUrl,omitempty"`
+
+	// PaymentIntentId is the payment made for the session, once it is
+	// being paid.
+	PaymentIntentId string `json:"paymentIntentId,omitempty"`
+
+	OrderId     string    `json:"orderId,omitempty"`
+	CompletedAt time.Time `json:"completedAt,omitempty"`
+
+	Metadata  Map    `json:"metadata,omitempty" datastore:"-"`
+	Metadata_ string `json:"-" datastore:",noindex"`
+}
+
+func (s *CheckoutSession) Load(ps []datastore.Property) (err error) {
+	if err = datastore.LoadStruct(s, ps); err != nil {
+		return err
+	}
+	if len(s.Promotions_) > 0 {
+		if err = json.DecodeBytes([]byte(s.Promotions_), &s.Promotions); err != nil {
+			return err
+		}
+	}
+	if len(s.Metadata_) > 0 {
+		err = json.DecodeBytes([]byte(s.Metadata_), &s.Metadata)
+	}
+	return err
+}
+
+func (s *CheckoutSession) Save() ([]datastore.Property, error) {
+	s.Promotions_ = string(json.EncodeBytes(s.Promotions))
+	s.Metadata_ = string(json.EncodeBytes(&s.Metadata))
+	return datastore.SaveStruct(s)
+}
+
+func (s *CheckoutSession) Defaults() {
+	if s.Status == "" {
+		s.Status = Open
+	}
+	if s.Metadata == nil {
+		s.Metadata = make(Map)
+	}
+}
+
+// IsOpen reports whether the session can still be changed or completed.
+func (s *CheckoutSession) IsOpen() bool {
+	return s.Status == Open || s.Status == RequiresAction
+}
+
+// Reached reports whether step has been taken.
+func (s *CheckoutSession) Reached(step Step) bool {
+	return s.Step != "" && s.Step.Index() >= step.Index()
+}
+
+func New(db *datastore.Datastore) *CheckoutSession {
+	s := new(CheckoutSession)
+	s.Init(db)
+	s.Defaults()
+	return s
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("checkout-session")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/orm"
 
@@ -37,6 +38,16 @@ type Company struct {
 
 	CurrencyCode currency.Type `json:"currencyCode" orm:"default:usd"`
 
+	// TaxExempt companies, buying for resale or otherwise exempt, are charged
+	// no tax. TaxExemptionNumber is the certificate that says so, passed to
+	// the tax provider with the sale.
+	TaxExempt          bool   `json:"taxExempt,omitempty"`
+	TaxExemptionNumber string `json:"taxExemptionNumber,omitempty"`
+
+	// TaxId is the company's VAT, GST or business number, for reverse-charged
+	// sales across borders.
+	TaxId taxid.TaxId `json:"taxId,omitempty"`
+
 	// SpendingLimitResetFrequency governs how often committed spend resets
 	// against employee limits: never/daily/weekly/monthly/yearly.
 	SpendingLimitResetFrequency string `json:"spendingLimitResetFrequency" orm:"default:never"`
@@ -72,6 +83,9 @@ func (c *Company) Address() string {
 	return strings.Join(parts, ", ")
 }
 
+// TaxIdentity makes Company a taxid.Holder.
+func (c *Company) TaxIdentity() *taxid.TaxId { return &c.TaxId }
+
 func New(db *datastore.Datastore) *Company {
 	c := new(Company)
 	c.Init(db)
@@ -84,7 +84,7 @@ type Form struct {
 
 	Mailchimp struct {
 		ListId string `json:"listId"`
-		APIKey string `json:"apiKey"`
+		APIKey string `json:"apiKey" audit:"redact"`
 	} `json:"mailchimp,omitempty"`
 }
 
@@ -19,6 +19,28 @@ type FulfillmentLabel struct {
 	LabelUrl       string `json:"labelUrl"`
 }
 
+// TrackingStatus is where a parcel is, in words every carrier's scans come
+// down to.
+type TrackingStatus string
+
+const (
+	LabelCreated     TrackingStatus = "label_created"
+	InTransit        TrackingStatus = "in_transit"
+	OutForDelivery   TrackingStatus = "out_for_delivery"
+	Delivered        TrackingStatus = "delivered"
+	Exception        TrackingStatus = "exception"
+	ReturnedToSender TrackingStatus = "returned"
+)
+
+// FulfillmentEvent is a carrier's scan of a parcel.
+type FulfillmentEvent struct {
+	TrackingNumber string         `json:"trackingNumber,omitempty"`
+	Status         TrackingStatus `json:"status"`
+	Description    string         `json:"description,omitempty"`
+	Location       string         `json:"location,omitempty"`
+	At             time.Time      `json:"at"`
+}
+
 type FulfillmentItem struct {
 	Title           string `json:"title"`
 	SKU             string `json:"sku"`
@@ -39,12 +61,25 @@ type Fulfillment struct {
 	DeliveredAt      *time.Time `json:"deliveredAt,omitempty"`
 	CanceledAt       *time.Time `json:"canceledAt,omitempty"`
 
+	// ShipmentRequestedAt is when the provider was last asked to ship it,
+	// saved before it was asked, so a request it answered that was never
+	// recorded is not made again unawares.
+	ShipmentRequestedAt *time.Time `json:"shipmentRequestedAt,omitempty"`
+
+	// ExternalId is the provider's id of the shipment, and TrackingStatus
+	// where its parcels last were.
+	ExternalId     string         `json:"externalId,omitempty"`
+	TrackingStatus TrackingStatus `json:"trackingStatus,omitempty"`
+
 	Items  []FulfillmentItem `json:"items" datastore:"-" orm:"default:[]"`
 	Items_ string            `json:"-" datastore:",noindex"`
 
 	Labels  []FulfillmentLabel `json:"labels" datastore:"-" orm:"default:[]"`
 	Labels_ string             `json:"-" datastore:",noindex"`
 
+	Events  []FulfillmentEvent `json:"events,omitempty" datastore:"-"`
+	Events_ string             `json:"-" datastore:",noindex"`
+
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-" orm:"default:{}"`
 	Metadata_ string `json:"-" datastore:",noindex"`
 }
@@ -62,6 +97,10 @@ func (f *Fulfillment) Load(ps []datastore.Property) (err error) {
 		err = json.DecodeBytes([]byte(f.Labels_), &f.Labels)
 	}
 
+	if len(f.Events_) > 0 {
+		err = json.DecodeBytes([]byte(f.Events_), &f.Events)
+	}
+
 	if len(f.Metadata_) > 0 {
 		err = json.DecodeBytes([]byte(f.Metadata_), &f.Metadata)
 	}
@@ -72,6 +111,7 @@ func (f *Fulfillment) Load(ps []datastore.Property) (err error) {
 func (f *Fulfillment) Save() ([]datastore.Property, error) {
 	f.Items_ = string(json.EncodeBytes(f.Items))
 	f.Labels_ = string(json.EncodeBytes(f.Labels))
+	f.Events_ = string(json.EncodeBytes(f.Events))
 	f.Metadata_ = string(json.EncodeBytes(&f.Metadata))
 
 	return datastore.SaveStruct(f)
@@ -13,18 +13,23 @@
 //	  replay == false ⇒ we recorded the in-flight marker first; perform the
 //	                    side effect, then idempotencykey.Complete(rec, response).
 //
-// LIMITATION (documented, not hidden): Begin uses read-then-write, and this
-// backend has no atomic compare-and-swap reachable from mixin.Model[T]
-// (db.SQLiteDB.RunInTransaction is real but the datastore layer routes to the
-// no-op datastore.RunInTransaction). So two callers racing on a FIRST-EVER key
-// can both observe "not started" and both proceed. The deterministic id still
-// guarantees a single STORED record (the second Create upserts), but the side
-// effect could run twice in that narrow window. Callers whose side effect is
-// itself non-idempotent (e.g. a raw gateway refund) MUST additionally pass the
-// SAME key through to the gateway (Stripe/Square both honor an idempotency key)
-// so the gateway de-dups the money move. This guard de-dups OUR ledger and
-// replays OUR response; the gateway key closes the money-move window. See
-// api/checkout refund for the wired example.
+// Begin reads then writes, and this backend has no atomic compare-and-swap
+// reachable from mixin.Model[T] (db.SQLiteDB.RunInTransaction is real but the
+// datastore layer routes to the no-op datastore.RunInTransaction). So the
+// read and the write are made under the shared lock of the guard's id (see
+// package lock): two callers racing on a FIRST-EVER key take turns, and the
+// second finds the first's "started" marker and replays (in-flight). The lock
+// holds across replicas that share the infra KV store, and within the process
+// otherwise. Callers whose side effect is itself non-idempotent (e.g. a raw
+// gateway refund) should still pass the SAME key through to the gateway
+// (Stripe/Square both honor an idempotency key), which also covers a guard
+// recovered after StartedTTL. See api/checkout refund for the wired example.
+//
+// middleware.TokenRequired guards every mutating API call the same way, through
+// Start: it pins what the key was first sent with (Fingerprint), stores the
+// whole response (status, headers and body) and gives the record an
+// ExpiresAt, after which ExpireBefore forgets it. Records a handler writes
+// through Begin have no ExpiresAt and are kept.
 package idempotencykey
 
 import (
@@ -34,6 +39,7 @@ import (
 	"time"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/orm"
 )
@@ -79,6 +85,20 @@ type IdempotencyKey struct {
 	// RecoveryPoint lets a caller record how far a multi-step side effect got,
 	// so a retry can resume rather than restart. Optional.
 	RecoveryPoint string `json:"recoveryPoint,omitempty"`
+
+	// Fingerprint is a hash of the request the key was first used for. Set
+	// by Start; a key sent again with a different request is refused.
+	Fingerprint string `json:"fingerprint,omitempty" datastore:",noindex"`
+
+	// StatusCode, ContentType and Headers complete Response for a guard
+	// that stores a whole HTTP response (CompleteResponse). Headers are the
+	// rest of the response's headers a replay answers with.
+	StatusCode  int                 `json:"statusCode,omitempty" datastore:",noindex"`
+	ContentType string              `json:"contentType,omitempty" datastore:",noindex"`
+	Headers     map[string][]string `json:"headers,omitempty" datastore:",noindex"`
+
+	// ExpiresAt is when the record may be forgotten. Zero keeps it for good.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
 }
 
 func (k *IdempotencyKey) Load(ps []datastore.Property) error {
@@ -97,8 +117,29 @@ func (k *IdempotencyKey) Save() ([]datastore.Property, error) {
 // replay=false with a freshly-created "started" marker when this is the first
 // sighting; the caller performs the side effect then calls Complete.
 func Begin(db *datastore.Datastore, scope, key string) (rec *IdempotencyKey, replay bool, err error) {
+	return begin(db, scope, key, "", time.Time{})
+}
+
+// Start is Begin for a guard that pins the request it was first used for and
+// expires: fingerprint identifies the request, and a key found with another
+// fingerprint is a replay the caller must refuse rather than answer — check
+// rec.Fingerprint. expires is when ExpireBefore may drop the record.
+func Start(db *datastore.Datastore, scope, key, fingerprint string, expires time.Time) (rec *IdempotencyKey, replay bool, err error) {
+	return begin(db, scope, key, fingerprint, expires)
+}
+
+func begin(db *datastore.Datastore, scope, key, fingerprint string, expires time.Time) (rec *IdempotencyKey, replay bool, err error) {
 	id := DeterministicID(scope, key)
 
+	// One caller at a time reads and claims a key, so of two first sightings
+	// racing, one runs and the other finds it in flight. A lock held past
+	// its wait fails the caller with lock.ErrBusy.
+	unlock, err := lock.Hold(db, "idempotency-key", id)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
 	// Replay: the guard for this (scope,key) already exists. Its STORAGE id is
 	// deterministic, so concurrent first-time Begins collapse onto ONE row via
 	// the backend ON CONFLICT(id,kind,namespace) upsert — no ledger fork.
@@ -114,14 +155,18 @@ func Begin(db *datastore.Datastore, scope, key string) (rec *IdempotencyKey, rep
 	// bit solely in production. A kind-qualified Get round-trips on both backends.
 	existing := New(db)
 	guardKey := db.NewKey(existing.Kind(), id, 0, nil)
-	if e := existing.Get(guardKey); e == nil {
+
+	// A record past its ExpiresAt is forgotten even before ExpireBefore gets
+	// to it: the key starts over, on the same row.
+	if e := existing.Get(guardKey); e == nil && !existing.Lapsed() {
 		// Completed → always a replay (return the stored response).
 		if existing.Status == StatusCompleted {
 			return existing, true, nil
 		}
 		// Started + FRESH → a genuine concurrent in-flight op. Replay (caller
-		// 409s) — do not run a second money move alongside it.
-		if !existing.Recoverable() {
+		// 409s) — do not run a second money move alongside it. A stale one
+		// pinned to another request is not this caller's to re-claim either.
+		if !existing.Recoverable() || existing.Fingerprint != fingerprint {
 			return existing, true, nil
 		}
 		// Started + STALE → the original crashed between Begin and Complete.
@@ -131,11 +176,14 @@ func Begin(db *datastore.Datastore, scope, key string) (rec *IdempotencyKey, rep
 		// of an otherwise-stuck guard.
 		existing.SetId(id)
 		existing.Status = StatusStarted
+		if !expires.IsZero() {
+			existing.ExpiresAt = expires
+		}
 		if e := existing.Put(); e != nil {
 			return nil, false, e
 		}
 		return existing, false, nil
-	} else if !errors.Is(e, datastore.ErrNoSuchEntity) {
+	} else if e != nil && !errors.Is(e, datastore.ErrNoSuchEntity) {
 		return nil, false, e
 	}
 
@@ -144,6 +192,8 @@ func Begin(db *datastore.Datastore, scope, key string) (rec *IdempotencyKey, rep
 	rec.Scope = scope
 	rec.IdemKey = key
 	rec.Status = StatusStarted
+	rec.Fingerprint = fingerprint
+	rec.ExpiresAt = expires
 	if e := rec.Create(); e != nil {
 		return nil, false, e
 	}
@@ -170,6 +220,43 @@ func Complete(rec *IdempotencyKey, response string) error {
 	return rec.Put()
 }
 
+// CompleteResponse is Complete for a whole HTTP response, so a replay can
+// answer with the status, content type and headers the first request got as
+// well as its body. Which headers are worth answering with again is the
+// caller's to decide.
+func CompleteResponse(rec *IdempotencyKey, status int, contentType string, headers map[string][]string, body string) error {
+	rec.StatusCode = status
+	rec.ContentType = contentType
+	rec.Headers = headers
+	return Complete(rec, body)
+}
+
+// Abandon drops a started guard whose request failed without an answer worth
+// keeping, so a retry with the same key runs afresh instead of waiting out
+// StartedTTL.
+func Abandon(rec *IdempotencyKey) error {
+	rec.SetId(DeterministicID(rec.Scope, rec.IdemKey))
+	return rec.Delete()
+}
+
+// ExpireBefore deletes the records whose ExpiresAt has passed by now, and
+// returns how many it deleted. Records with no ExpiresAt are never touched.
+func ExpireBefore(db *datastore.Datastore, now time.Time) (int, error) {
+	var recs []*IdempotencyKey
+	if _, err := Query(db).Filter("ExpiresAt>", time.Time{}).Filter("ExpiresAt<=", now).GetAll(&recs); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, rec := range recs {
+		rec.Init(db)
+		if err := Abandon(rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
 // New returns an initialized IdempotencyKey bound to db.
 func New(db *datastore.Datastore) *IdempotencyKey {
 	k := new(IdempotencyKey)
@@ -189,3 +276,8 @@ func Query(db *datastore.Datastore) datastore.Query {
 func (k *IdempotencyKey) Recoverable() bool {
 	return k.Status == StatusStarted && nowFn().Sub(k.UpdatedAt) >= StartedTTL
 }
+
+// Lapsed reports whether the record's ExpiresAt has passed.
+func (k *IdempotencyKey) Lapsed() bool {
+	return !k.ExpiresAt.IsZero() && !nowFn().Before(k.ExpiresAt)
+}
@@ -93,6 +93,40 @@ func TestBegin_ConcurrentSameKey(t *testing.T) {
 	}
 }
 
+// Of many first sightings of one key at once, exactly one runs; the rest
+// find it in flight.
+func TestStart_ConcurrentSameKeyOneRuns(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+
+	const n = 20
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		runs int
+	)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			_, replay, err := Start(nsDB(c, "acme"), "http:user:u1", "once_key", "fp", time.Now().Add(time.Hour))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !replay {
+				mu.Lock()
+				runs++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != 1 {
+		t.Fatalf("%d of %d concurrent first sightings ran; want 1", runs, n)
+	}
+}
+
 func TestBegin_TenantIsolation(t *testing.T) {
 	c := ae.NewContext()
 	defer c.Close()
@@ -175,3 +209,121 @@ func TestBegin_StaleStartedRecovers(t *testing.T) {
 		t.Fatalf("post-recovery replay: replay=%v status=%q resp=%q", replay3, got.Status, got.Response)
 	}
 }
+
+// TestStart_ReplaysWholeResponse proves a key sent again with the same
+// request gets back the status, content type, headers and body the first one
+// stored, and that the record carries the fingerprint it was started with, so
+// a caller can tell a retry from a reuse.
+func TestStart_ReplaysWholeResponse(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+	expires := time.Now().Add(time.Hour)
+
+	rec, replay, err := Start(db, "http:apikey:k1", "key_1", "fp_a", expires)
+	if err != nil || replay {
+		t.Fatalf("start: err=%v replay=%v", err, replay)
+	}
+	location := map[string][]string{"Location": {"/v1/commerce/order/ord_1"}}
+	if err := CompleteResponse(rec, 201, "application/json", location, `{"id":"ord_1"}`); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	got, replay, err := Start(db, "http:apikey:k1", "key_1", "fp_b", expires)
+	if err != nil || !replay {
+		t.Fatalf("second start: err=%v replay=%v; want a replay", err, replay)
+	}
+	if got.Fingerprint != "fp_a" {
+		t.Fatalf("fingerprint = %q, want the first request's", got.Fingerprint)
+	}
+	if got.StatusCode != 201 || got.ContentType != "application/json" || got.Response != `{"id":"ord_1"}` {
+		t.Fatalf("replayed %d %q %q", got.StatusCode, got.ContentType, got.Response)
+	}
+	if loc := got.Headers["Location"]; len(loc) != 1 || loc[0] != "/v1/commerce/order/ord_1" {
+		t.Fatalf("replayed headers %v, want the first response's Location", got.Headers)
+	}
+}
+
+// TestStart_StaleOtherRequestNotReclaimed proves a crashed guard is only
+// re-claimed by a retry of the request that started it.
+func TestStart_StaleOtherRequestNotReclaimed(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+	expires := time.Now().Add(time.Hour)
+
+	if _, _, err := Start(db, "http:user:u1", "k", "fp_a", expires); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	orig := nowFn
+	nowFn = func() time.Time { return orig().Add(StartedTTL + time.Minute) }
+	defer func() { nowFn = orig }()
+
+	if rec, replay, _ := Start(db, "http:user:u1", "k", "fp_b", expires); !replay || rec.Fingerprint != "fp_a" {
+		t.Fatalf("other request re-claimed a stale guard: replay=%v", replay)
+	}
+	if _, replay, err := Start(db, "http:user:u1", "k", "fp_a", expires); err != nil || replay {
+		t.Fatalf("retry of the same request: err=%v replay=%v; want re-claimed", err, replay)
+	}
+}
+
+// TestAbandon_KeyStartsOver proves an abandoned guard lets the next request
+// with the key run rather than 409.
+func TestAbandon_KeyStartsOver(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+
+	rec, _, err := Start(db, "http:user:u1", "k", "fp", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := Abandon(rec); err != nil {
+		t.Fatalf("abandon: %v", err)
+	}
+	if _, replay, err := Start(db, "http:user:u1", "k", "fp", time.Now().Add(time.Hour)); err != nil || replay {
+		t.Fatalf("after abandon: err=%v replay=%v; want a fresh start", err, replay)
+	}
+}
+
+// TestExpireBefore proves lapsed records are ignored, then deleted, and that
+// records with no ExpiresAt — the money guards' — are kept.
+func TestExpireBefore(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+	now := time.Now()
+
+	rec, _, err := Start(db, "http:user:u1", "old", "fp", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := CompleteResponse(rec, 200, "application/json", nil, `{}`); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, _, err := Start(db, "http:user:u1", "new", "fp", now.Add(48*time.Hour)); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, _, err := Begin(db, "refund:ord_1", "kept"); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+
+	later := now.Add(time.Hour)
+	orig := nowFn
+	nowFn = func() time.Time { return later }
+	defer func() { nowFn = orig }()
+
+	n, err := ExpireBefore(db, later)
+	if err != nil || n != 1 {
+		t.Fatalf("ExpireBefore = %d, %v; want 1", n, err)
+	}
+	if _, replay, _ := Start(db, "http:user:u1", "new", "fp", later.Add(time.Hour)); !replay {
+		t.Fatal("unexpired record was deleted")
+	}
+	if _, replay, _ := Begin(db, "refund:ord_1", "kept"); !replay {
+		t.Fatal("record with no ExpiresAt was deleted")
+	}
+	if _, replay, _ := Start(db, "http:user:u1", "old", "fp", later.Add(time.Hour)); replay {
+		t.Fatal("expired record still replays")
+	}
+}
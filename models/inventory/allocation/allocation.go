@@ -0,0 +1,442 @@
+// Package allocation decides which stock locations fulfil an order, and holds
+// their stock for it until the order is placed or the shopper walks away.
+//
+// Allocate is the decision, and it is pure: the locations, the zones they ship
+// to and what each has on hand are loaded by the caller (load.go), so the
+// ranking can be tested without a datastore and a preview holds nothing.
+// Reserve, Release and the rest (reserve.go) are what makes a decision stick:
+// they move stock between a level's available and reserved quantities and
+// record each move as a reservation. A held reservation lapses; the Sweeper
+// gives lapsed stock back.
+package allocation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Line is one inventory item an order needs, and how many. A line item whose
+// variant is made of several inventory items is one Line per item.
+type Line struct {
+	LineItemId      string `json:"lineItemId"`
+	VariantId       string `json:"variantId,omitempty"`
+	InventoryItemId string `json:"inventoryItemId"`
+	Quantity        int    `json:"quantity"`
+
+	// AllowBackorder lets the line be allocated past what is on hand; the
+	// shortfall is reserved at a location that stocks the item, and ships when
+	// it arrives.
+	AllowBackorder bool `json:"allowBackorder,omitempty"`
+}
+
+// Destination is where an order ships. An empty Country is a destination not
+// known yet — a cart without an address — and every location reaches it
+// equally.
+type Destination struct {
+	Country    string `json:"country"`
+	Province   string `json:"province,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+}
+
+// Zone is an area a location ships to: one geo zone of a service zone of one
+// of its fulfillment sets.
+type Zone struct {
+	Type             string `json:"type"` // "country", "province", "city", "zip"
+	CountryCode      string `json:"countryCode"`
+	ProvinceCode     string `json:"provinceCode,omitempty"`
+	City             string `json:"city,omitempty"`
+	PostalExpression string `json:"postalExpression,omitempty"`
+}
+
+// Location is a stock location as Allocate sees it.
+type Location struct {
+	Id       string `json:"id"`
+	Priority int    `json:"priority"`
+	Country  string `json:"country"`
+
+	// Zones are where the location ships. None means anywhere.
+	Zones []Zone `json:"zones,omitempty"`
+
+	// Available is what the location can promise, by inventory item. An item
+	// the location has no level for is absent; one it stocks but is out of is
+	// present at zero or below.
+	Available map[string]int `json:"available"`
+}
+
+// Allocation is a quantity of one line sent from one location. A line split
+// across locations is several allocations.
+type Allocation struct {
+	LineItemId      string `json:"lineItemId"`
+	VariantId       string `json:"variantId,omitempty"`
+	InventoryItemId string `json:"inventoryItemId"`
+	LocationId      string `json:"locationId"`
+	Quantity        int    `json:"quantity"`
+
+	// Backorder is set on the part of a line allocated past what the location
+	// has.
+	Backorder bool `json:"backorder,omitempty"`
+}
+
+// Plan is where an order's lines come from.
+type Plan struct {
+	Allocations []Allocation `json:"allocations"`
+
+	// Locations are the locations the plan ships from, one shipment each, in
+	// the order they were first used.
+	Locations []string `json:"locations"`
+}
+
+// Split reports whether the plan ships from more than one location.
+func (p *Plan) Split() bool {
+	return len(p.Locations) > 1
+}
+
+// Options are how an order may be allocated.
+type Options struct {
+	// AllowSplit lets an order that no one location can fill ship from
+	// several. Without it such an order is refused, not partly allocated.
+	AllowSplit bool `json:"allowSplit"`
+}
+
+var (
+	// ErrUnserviceable is returned when no location ships to the destination.
+	ErrUnserviceable = errors.New("no stock location ships to the destination")
+
+	// ErrInsufficientStock is what a ShortageError is.
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// ShortageError is returned when an item cannot be allocated in full.
+// Available is what the locations that reach the destination had between them
+// — or, for an order that may not split, what the best of them had.
+type ShortageError struct {
+	InventoryItemId string
+	Wanted          int
+	Available       int
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("insufficient stock of %s: wanted %d, %d available", e.InventoryItemId, e.Wanted, e.Available)
+}
+
+func (e *ShortageError) Unwrap() error { return ErrInsufficientStock }
+
+// Allocate plans where each line ships from.
+//
+// Locations are ranked by how closely they reach dest — a zone naming its
+// postal code beats one naming its city, then its province, then its country,
+// and a location with no zones reaches everywhere but last; among equals, one
+// in dest's own country goes first — then by Priority, then by how much they
+// have of what the order needs, so that a tie goes to the location least
+// likely to run out. A location with zones, none of which reach dest, is not
+// considered at all.
+//
+// The order ships from one location if any can fill it, the best-ranked such.
+// Otherwise, with opts.AllowSplit, each line is taken from a location already
+// shipping part of the order if one can fill it, else the best-ranked location
+// that can, else from each location in rank order until it is filled. A line
+// that still falls short is backordered if it allows that, and a shortage
+// otherwise.
+func Allocate(lines []Line, dest Destination, locations []Location, opts Options) (*Plan, error) {
+	plan := &Plan{Allocations: []Allocation{}, Locations: []string{}}
+	if len(lines) == 0 {
+		return plan, nil
+	}
+
+	ranked := rank(lines, dest, locations)
+	if len(ranked) == 0 {
+		return nil, ErrUnserviceable
+	}
+
+	if loc := single(lines, ranked); loc != nil {
+		left := copyAvailable(loc.Available)
+		for _, l := range lines {
+			plan.take(l, loc.Id, l.Quantity, left)
+		}
+		return plan, nil
+	}
+
+	if !opts.AllowSplit {
+		return nil, shortage(lines, ranked[:1])
+	}
+
+	left := make(map[string]map[string]int, len(ranked))
+	for _, loc := range ranked {
+		left[loc.Id] = copyAvailable(loc.Available)
+	}
+
+	for _, l := range lines {
+		if loc := plan.filler(l, ranked, left); loc != nil {
+			plan.take(l, loc.Id, l.Quantity, left[loc.Id])
+			continue
+		}
+
+		need := l.Quantity
+		for _, loc := range ranked {
+			if n := min(need, left[loc.Id][l.InventoryItemId]); n > 0 {
+				plan.take(l, loc.Id, n, left[loc.Id])
+				need -= n
+			}
+			if need == 0 {
+				break
+			}
+		}
+		if need == 0 {
+			continue
+		}
+
+		if !l.AllowBackorder {
+			return nil, shortage([]Line{l}, ranked)
+		}
+		loc := stocking(l.InventoryItemId, ranked)
+		if loc == nil {
+			return nil, shortage([]Line{l}, ranked)
+		}
+		plan.take(l, loc.Id, need, left[loc.Id])
+	}
+	return plan, nil
+}
+
+// take allocates n of l from location id, backordering what left does not
+// cover, and takes it out of left.
+func (p *Plan) take(l Line, id string, n int, left map[string]int) {
+	have := max(left[l.InventoryItemId], 0)
+	if from := min(n, have); from > 0 {
+		p.add(l, id, from, false)
+	}
+	if n > have {
+		p.add(l, id, n-have, true)
+	}
+	left[l.InventoryItemId] -= n
+}
+
+func (p *Plan) add(l Line, id string, n int, backorder bool) {
+	p.Allocations = append(p.Allocations, Allocation{
+		LineItemId:      l.LineItemId,
+		VariantId:       l.VariantId,
+		InventoryItemId: l.InventoryItemId,
+		LocationId:      id,
+		Quantity:        n,
+		Backorder:       backorder,
+	})
+	for _, used := range p.Locations {
+		if used == id {
+			return
+		}
+	}
+	p.Locations = append(p.Locations, id)
+}
+
+// filler is the location l can be taken from whole: one the plan already
+// ships from if possible, else the best-ranked one.
+func (p *Plan) filler(l Line, ranked []*Location, left map[string]map[string]int) *Location {
+	var best *Location
+	for _, loc := range ranked {
+		if left[loc.Id][l.InventoryItemId] < l.Quantity {
+			continue
+		}
+		for _, used := range p.Locations {
+			if used == loc.Id {
+				return loc
+			}
+		}
+		if best == nil {
+			best = loc
+		}
+	}
+	return best
+}
+
+// single is the best-ranked location that can fill every line, counting lines
+// of one item together. A backorderable line needs only that the location
+// stock its item.
+func single(lines []Line, ranked []*Location) *Location {
+	need := needs(lines)
+	for _, loc := range ranked {
+		ok := true
+		for _, l := range lines {
+			have, stocked := loc.Available[l.InventoryItemId]
+			if !stocked || (!l.AllowBackorder && have < need[l.InventoryItemId]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return loc
+		}
+	}
+	return nil
+}
+
+// stocking is the best-ranked location with a level for item, where a
+// backorder can wait for it.
+func stocking(item string, ranked []*Location) *Location {
+	for _, loc := range ranked {
+		if _, ok := loc.Available[item]; ok {
+			return loc
+		}
+	}
+	return nil
+}
+
+// shortage is the error for the first line of lines that locs cannot cover.
+func shortage(lines []Line, locs []*Location) error {
+	need := needs(lines)
+	for _, l := range lines {
+		if l.AllowBackorder && stocking(l.InventoryItemId, locs) != nil {
+			continue
+		}
+		have := 0
+		for _, loc := range locs {
+			have += max(loc.Available[l.InventoryItemId], 0)
+		}
+		if have < need[l.InventoryItemId] {
+			return &ShortageError{InventoryItemId: l.InventoryItemId, Wanted: need[l.InventoryItemId], Available: have}
+		}
+	}
+	return ErrInsufficientStock
+}
+
+func needs(lines []Line) map[string]int {
+	need := make(map[string]int, len(lines))
+	for _, l := range lines {
+		need[l.InventoryItemId] += l.Quantity
+	}
+	return need
+}
+
+func copyAvailable(m map[string]int) map[string]int {
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// rank returns the locations that reach dest, best first.
+func rank(lines []Line, dest Destination, locations []Location) []*Location {
+	type ranked struct {
+		loc   *Location
+		reach int
+		stock int
+	}
+	need := needs(lines)
+
+	rs := make([]ranked, 0, len(locations))
+	for i := range locations {
+		loc := &locations[i]
+		r := Reach(loc, dest)
+		if r == 0 {
+			continue
+		}
+		stock := 0
+		for item := range need {
+			stock += max(loc.Available[item], 0)
+		}
+		rs = append(rs, ranked{loc: loc, reach: r, stock: stock})
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		a, b := rs[i], rs[j]
+		if a.reach != b.reach {
+			return a.reach > b.reach
+		}
+		if a.loc.Priority != b.loc.Priority {
+			return a.loc.Priority < b.loc.Priority
+		}
+		if a.stock != b.stock {
+			return a.stock > b.stock
+		}
+		return a.loc.Id < b.loc.Id
+	})
+
+	out := make([]*Location, len(rs))
+	for i, r := range rs {
+		out[i] = r.loc
+	}
+	return out
+}
+
+// How closely a zone reaches a destination.
+const (
+	reachNone = iota
+	reachAnywhere
+	reachCountry
+	reachProvince
+	reachCity
+	reachPostal
+)
+
+// Reach scores how closely loc reaches dest; zero is not at all. It is twice
+// the closest zone match, plus one when the location is in dest's country.
+func Reach(loc *Location, dest Destination) int {
+	if dest.Country == "" {
+		return reachAnywhere * 2
+	}
+
+	best := reachNone
+	if len(loc.Zones) == 0 {
+		best = reachAnywhere
+	}
+	for _, z := range loc.Zones {
+		if r := z.reach(dest); r > best {
+			best = r
+		}
+	}
+	if best == reachNone {
+		return 0
+	}
+
+	score := best * 2
+	if strings.EqualFold(loc.Country, dest.Country) {
+		score++
+	}
+	return score
+}
+
+// Covers reports whether dest is inside z.
+func (z Zone) Covers(dest Destination) bool {
+	return z.reach(dest) != reachNone
+}
+
+func (z Zone) reach(dest Destination) int {
+	if !strings.EqualFold(z.CountryCode, dest.Country) {
+		return reachNone
+	}
+	switch z.Type {
+	case "province":
+		if strings.EqualFold(z.ProvinceCode, dest.Province) {
+			return reachProvince
+		}
+	case "city":
+		if strings.EqualFold(z.City, dest.City) &&
+			(z.ProvinceCode == "" || strings.EqualFold(z.ProvinceCode, dest.Province)) {
+			return reachCity
+		}
+	case "zip":
+		if postalMatches(z.PostalExpression, dest.PostalCode) {
+			return reachPostal
+		}
+	default:
+		return reachCountry
+	}
+	return reachNone
+}
+
+// postalMatches reports whether code matches expr, a regular expression for
+// the whole postal code, ignoring case and spaces ("SW1A\d[A-Z]{2}"). An
+// expression that does not compile matches nothing.
+func postalMatches(expr, code string) bool {
+	if expr == "" || code == "" {
+		return false
+	}
+	re, err := regexp.Compile(`(?i)^(?:` + expr + `)$`)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(strings.ReplaceAll(code, " ", ""))
+}
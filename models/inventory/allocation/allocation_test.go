@@ -0,0 +1,120 @@
+package allocation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func warehouses() []Location {
+	return []Location{
+		{
+			Id: "loc_reno", Country: "US", Priority: 2,
+			Zones:     []Zone{{Type: "country", CountryCode: "US"}},
+			Available: map[string]int{"shirt": 10, "hat": 1},
+		},
+		{
+			Id: "loc_la", Country: "US", Priority: 1,
+			Zones:     []Zone{{Type: "province", CountryCode: "US", ProvinceCode: "CA"}},
+			Available: map[string]int{"shirt": 2, "hat": 5},
+		},
+		{
+			Id: "loc_berlin", Country: "DE",
+			Zones:     []Zone{{Type: "country", CountryCode: "DE"}},
+			Available: map[string]int{"shirt": 50, "hat": 50},
+		},
+	}
+}
+
+var california = Destination{Country: "US", Province: "CA", City: "Los Angeles", PostalCode: "90012"}
+
+func TestAllocate_PrefersTheClosestLocationThatFillsTheOrder(t *testing.T) {
+	lines := []Line{{LineItemId: "li_1", InventoryItemId: "hat", Quantity: 2}}
+	plan, err := Allocate(lines, california, warehouses(), Options{})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if !reflect.DeepEqual(plan.Locations, []string{"loc_la"}) {
+		t.Fatalf("locations = %v, want the province zone over the country one", plan.Locations)
+	}
+
+	// Two shirts and two hats: LA is closer but has only two shirts, so the
+	// whole order goes from LA — it has both.
+	lines = append(lines, Line{LineItemId: "li_2", InventoryItemId: "shirt", Quantity: 2})
+	if plan, err = Allocate(lines, california, warehouses(), Options{}); err != nil || plan.Split() {
+		t.Fatalf("plan = %+v, %v; want one shipment", plan, err)
+	}
+
+	// Berlin has plenty but does not ship to the US.
+	lines[1].Quantity = 20
+	if _, err := Allocate(lines, california, warehouses(), Options{AllowSplit: true}); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("err = %v, want a shortage", err)
+	}
+}
+
+func TestAllocate_SplitsOnlyWhenAllowed(t *testing.T) {
+	lines := []Line{
+		{LineItemId: "li_1", InventoryItemId: "hat", Quantity: 3},
+		{LineItemId: "li_2", InventoryItemId: "shirt", Quantity: 6},
+	}
+
+	var short *ShortageError
+	if _, err := Allocate(lines, california, warehouses(), Options{}); !errors.As(err, &short) || short.InventoryItemId != "shirt" {
+		t.Fatalf("err = %v, want the shirts short at the best location", err)
+	}
+
+	plan, err := Allocate(lines, california, warehouses(), Options{AllowSplit: true})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	want := []Allocation{
+		{LineItemId: "li_1", InventoryItemId: "hat", LocationId: "loc_la", Quantity: 3},
+		{LineItemId: "li_2", InventoryItemId: "shirt", LocationId: "loc_reno", Quantity: 6},
+	}
+	if !reflect.DeepEqual(plan.Allocations, want) {
+		t.Fatalf("allocations = %+v, want %+v", plan.Allocations, want)
+	}
+
+	// Eleven shirts is more than either has; the line itself splits.
+	lines[1].Quantity = 11
+	if plan, err = Allocate(lines, california, warehouses(), Options{AllowSplit: true}); err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if got := plan.Allocations[1:]; len(got) != 2 || got[0].LocationId != "loc_la" || got[0].Quantity != 2 ||
+		got[1].LocationId != "loc_reno" || got[1].Quantity != 9 {
+		t.Fatalf("shirt allocations = %+v", got)
+	}
+}
+
+func TestAllocate_BackordersAndUnservedDestinations(t *testing.T) {
+	lines := []Line{{LineItemId: "li_1", InventoryItemId: "hat", Quantity: 7, AllowBackorder: true}}
+	plan, err := Allocate(lines, california, warehouses(), Options{})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	want := []Allocation{
+		{LineItemId: "li_1", InventoryItemId: "hat", LocationId: "loc_la", Quantity: 5},
+		{LineItemId: "li_1", InventoryItemId: "hat", LocationId: "loc_la", Quantity: 2, Backorder: true},
+	}
+	if !reflect.DeepEqual(plan.Allocations, want) {
+		t.Fatalf("allocations = %+v, want %+v", plan.Allocations, want)
+	}
+
+	if _, err := Allocate(lines, Destination{Country: "JP"}, warehouses(), Options{}); !errors.Is(err, ErrUnserviceable) {
+		t.Fatalf("err = %v, want unserviceable", err)
+	}
+}
+
+func TestReach_RanksZonesByHowCloselyTheyMatch(t *testing.T) {
+	postal := Location{Country: "GB", Zones: []Zone{{Type: "zip", CountryCode: "GB", PostalExpression: `SW1A\d[A-Z]{2}`}}}
+	country := Location{Country: "GB", Zones: []Zone{{Type: "country", CountryCode: "GB"}}}
+	anywhere := Location{Country: "FR"}
+
+	dest := Destination{Country: "GB", PostalCode: "sw1a 1aa"}
+	if p, c, a := Reach(&postal, dest), Reach(&country, dest), Reach(&anywhere, dest); !(p > c && c > a && a > 0) {
+		t.Fatalf("reach postal=%d country=%d anywhere=%d, want strictly decreasing and served", p, c, a)
+	}
+	if r := Reach(&postal, Destination{Country: "GB", PostalCode: "EC1A 1BB"}); r != 0 {
+		t.Fatalf("reach outside the postal zone = %d, want 0", r)
+	}
+}
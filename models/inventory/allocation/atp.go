@@ -0,0 +1,58 @@
+package allocation
+
+import (
+	"sort"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/inventorylevel"
+)
+
+// Promise is how many units of a variant one location can promise: what it
+// has on hand and not reserved, and what it has on the way.
+type Promise struct {
+	LocationId string `json:"locationId"`
+	Available  int    `json:"available"`
+	Incoming   int    `json:"incoming"`
+}
+
+// AvailableToPromise returns, per location, how many of variantId could be
+// sold now. A variant made of several inventory items can only be promised as
+// many times as its scarcest item, and only from a location that stocks all of
+// them. managed is false for a variant with no inventory items, which is never
+// out of stock.
+func AvailableToPromise(db *datastore.Datastore, variantId string) (promises []Promise, managed bool, err error) {
+	items, err := InventoryItems(db, variantId)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(items) == 0 {
+		return []Promise{}, false, nil
+	}
+
+	byLocation := make(map[string][]*inventorylevel.InventoryLevel)
+	for _, item := range items {
+		levels, err := Levels(db, item)
+		if err != nil {
+			return nil, true, err
+		}
+		for _, l := range levels {
+			byLocation[l.LocationId] = append(byLocation[l.LocationId], l)
+		}
+	}
+
+	promises = make([]Promise, 0, len(byLocation))
+	for loc, levels := range byLocation {
+		if len(levels) < len(items) {
+			continue
+		}
+		p := Promise{LocationId: loc, Available: levels[0].AvailableQuantity(), Incoming: levels[0].IncomingQuantity}
+		for _, l := range levels[1:] {
+			p.Available = min(p.Available, l.AvailableQuantity())
+			p.Incoming = min(p.Incoming, l.IncomingQuantity)
+		}
+		p.Available = max(p.Available, 0)
+		promises = append(promises, p)
+	}
+	sort.Slice(promises, func(i, j int) bool { return promises[i].LocationId < promises[j].LocationId })
+	return promises, true, nil
+}
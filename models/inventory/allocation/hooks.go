@@ -0,0 +1,62 @@
+package allocation
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+)
+
+// Install ties reservations to the carts and orders they are for, through r's
+// model hooks: an order placed from a cart confirms what the cart held, a
+// cancelled order gives its stock back, and so does a discarded cart. Expiry is
+// the Sweeper's.
+//
+// A failure is logged and does not fail the write that triggered it. The order
+// is placed or cancelled either way; stock left held by a failed release goes
+// back when the hold lapses, and a hold a failed confirm left behind lapses as
+// if the order had never been placed, which a merchant sees as stock to
+// recount rather than an order refused.
+func Install(r *hooks.Registry) {
+	r.OnModelAfterCreate("order").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "allocation", Func: orderPlaced})
+	r.OnModelAfterUpdate("order").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "allocation", Func: orderChanged})
+	r.OnModelAfterUpdate("cart").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "allocation", Func: cartChanged})
+}
+
+func orderPlaced(e *hooks.ModelEvent) error {
+	cartId, _ := e.After["cartId"].(string)
+	orderId := idOf(e)
+	if cartId != "" && orderId != "" && e.Context != nil {
+		if _, err := Confirm(datastore.New(e.Context), cartId, orderId); err != nil {
+			log.Error("allocation: confirm cart %s for order %s: %v", cartId, orderId, err, e.Context)
+		}
+	}
+	return e.Next()
+}
+
+func orderChanged(e *hooks.ModelEvent) error {
+	orderId := idOf(e)
+	if e.Changed("status") && e.After["status"] == "cancelled" && orderId != "" && e.Context != nil {
+		if _, err := ReleaseOrder(datastore.New(e.Context), orderId); err != nil {
+			log.Error("allocation: release cancelled order %s: %v", orderId, err, e.Context)
+		}
+	}
+	return e.Next()
+}
+
+func cartChanged(e *hooks.ModelEvent) error {
+	cartId := idOf(e)
+	if e.Changed("status") && e.After["status"] == "discarded" && cartId != "" && e.Context != nil {
+		if _, err := Release(datastore.New(e.Context), cartId); err != nil {
+			log.Error("allocation: release discarded cart %s: %v", cartId, err, e.Context)
+		}
+	}
+	return e.Next()
+}
+
+func idOf(e *hooks.ModelEvent) string {
+	if m, ok := e.Model.(interface{ Id() string }); ok {
+		return m.Id()
+	}
+	id, _ := e.After["id"].(string)
+	return id
+}
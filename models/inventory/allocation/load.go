@@ -0,0 +1,167 @@
+package allocation
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/geozone"
+	"github.com/hanzoai/commerce/models/inventorylevel"
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/servicezone"
+	"github.com/hanzoai/commerce/models/stocklocation"
+	"github.com/hanzoai/commerce/models/variantinventorylink"
+
+	. "github.com/hanzoai/commerce/types"
+)
+
+// Lines turns line items into the inventory lines they need: one per
+// inventory item linked to the item's variant, for the item's quantity. A line
+// item whose variant has no inventory items is not stock-managed and needs
+// none.
+func Lines(db *datastore.Datastore, items []lineitem.LineItem) ([]Line, error) {
+	lines := make([]Line, 0, len(items))
+	linked := make(map[string][]string)
+	for _, li := range items {
+		if li.VariantId == "" || li.Quantity <= 0 {
+			continue
+		}
+		itemIds, seen := linked[li.VariantId]
+		if !seen {
+			var err error
+			if itemIds, err = InventoryItems(db, li.VariantId); err != nil {
+				return nil, err
+			}
+			linked[li.VariantId] = itemIds
+		}
+		for _, id := range itemIds {
+			lines = append(lines, Line{
+				LineItemId:      li.Id(),
+				VariantId:       li.VariantId,
+				InventoryItemId: id,
+				Quantity:        li.Quantity,
+			})
+		}
+	}
+	return lines, nil
+}
+
+// InventoryItems returns the ids of the inventory items variantId is made of.
+func InventoryItems(db *datastore.Datastore, variantId string) ([]string, error) {
+	var links []*variantinventorylink.VariantInventoryLink
+	if _, err := variantinventorylink.Query(db).Filter("VariantId=", variantId).GetAll(&links); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(links))
+	for _, l := range links {
+		ids = append(ids, l.InventoryItemId)
+	}
+	return ids, nil
+}
+
+// Locations loads every stock location, with the zones it ships to and what
+// it has available of items.
+func Locations(db *datastore.Datastore, items []string) ([]Location, error) {
+	var stored []*stocklocation.StockLocation
+	if _, err := stocklocation.Query(db).GetAll(&stored); err != nil {
+		return nil, err
+	}
+
+	zones := make(map[string][]Zone)
+	locations := make([]Location, 0, len(stored))
+	byId := make(map[string]*Location, len(stored))
+	for _, s := range stored {
+		loc := Location{
+			Id:        s.Id(),
+			Priority:  s.Priority,
+			Country:   s.Country,
+			Available: make(map[string]int),
+		}
+		for _, setId := range s.FulfillmentSetIds {
+			z, seen := zones[setId]
+			if !seen {
+				var err error
+				if z, err = setZones(db, setId); err != nil {
+					return nil, err
+				}
+				zones[setId] = z
+			}
+			loc.Zones = append(loc.Zones, z...)
+		}
+		locations = append(locations, loc)
+	}
+	for i := range locations {
+		byId[locations[i].Id] = &locations[i]
+	}
+
+	for _, item := range items {
+		levels, err := Levels(db, item)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range levels {
+			if loc := byId[l.LocationId]; loc != nil {
+				loc.Available[item] += l.AvailableQuantity()
+			}
+		}
+	}
+	return locations, nil
+}
+
+// Levels returns the inventory levels of item, one per location stocking it.
+func Levels(db *datastore.Datastore, item string) ([]*inventorylevel.InventoryLevel, error) {
+	var levels []*inventorylevel.InventoryLevel
+	if _, err := inventorylevel.Query(db).Filter("InventoryItemId=", item).GetAll(&levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// setZones returns the geo zones of every service zone of a fulfillment set.
+func setZones(db *datastore.Datastore, setId string) ([]Zone, error) {
+	var szs []*servicezone.ServiceZone
+	if _, err := servicezone.Query(db).Filter("FulfillmentSetId=", setId).GetAll(&szs); err != nil {
+		return nil, err
+	}
+	var zones []Zone
+	for _, sz := range szs {
+		var gzs []*geozone.GeoZone
+		if _, err := geozone.Query(db).Filter("ServiceZoneId=", sz.Id()).GetAll(&gzs); err != nil {
+			return nil, err
+		}
+		for _, g := range gzs {
+			zones = append(zones, Zone{
+				Type:             g.Type,
+				CountryCode:      g.CountryCode,
+				ProvinceCode:     g.ProvinceCode,
+				City:             g.City,
+				PostalExpression: g.PostalExpression,
+			})
+		}
+	}
+	return zones, nil
+}
+
+// PlanFor loads what allocating lines to dest needs and allocates them.
+func PlanFor(db *datastore.Datastore, lines []Line, dest Destination, opts Options) (*Plan, error) {
+	items := make([]string, 0, len(lines))
+	seen := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		if !seen[l.InventoryItemId] {
+			seen[l.InventoryItemId] = true
+			items = append(items, l.InventoryItemId)
+		}
+	}
+	locations, err := Locations(db, items)
+	if err != nil {
+		return nil, err
+	}
+	return Allocate(lines, dest, locations, opts)
+}
+
+// DestinationOf is where an address is, as Allocate reads it.
+func DestinationOf(a Address) Destination {
+	return Destination{
+		Country:    a.Country,
+		Province:   a.State,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+	}
+}
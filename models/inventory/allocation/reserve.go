@@ -0,0 +1,304 @@
+package allocation
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/models/inventorylevel"
+	"github.com/hanzoai/commerce/models/reservation"
+)
+
+// DefaultTTL is how long a cart's stock is held when the caller does not say.
+// It is the life of a checkout that is still being filled in, not of a cart
+// left in a tab: stock held for an hour nobody buys is stock nobody else can.
+const DefaultTTL = 30 * time.Minute
+
+// Hold is who reserved stock is held for, and until when.
+type Hold struct {
+	// OwnerId is the cart or checkout session the stock is held for.
+	OwnerId string
+
+	// ExpiresAt is when the hold lapses.
+	ExpiresAt time.Time
+}
+
+var (
+	ErrNoOwner    = errors.New("a reservation needs an owner")
+	ErrNoLevel    = errors.New("location does not stock the item")
+	ErrNotHolding = errors.New("nothing is held for the owner")
+)
+
+// LockLevel locks the level of item at location against every other change
+// to its reserved quantity made through this package, and returns the unlock.
+// Anything else that reads and rewrites a level — a stock adjustment — takes
+// it too. The store's own transactions give no isolation to lean on instead.
+func LockLevel(db *datastore.Datastore, item, location string) (unlock func(), err error) {
+	return lock.Hold(db, "inventorylevel", item, location)
+}
+
+// lockOwner locks the reservations of owner.
+func lockOwner(db *datastore.Datastore, owner string) (unlock func(), err error) {
+	return lock.Hold(db, "reservation", owner)
+}
+
+// levelAt loads the level of item at location.
+func levelAt(db *datastore.Datastore, item, location string) (*inventorylevel.InventoryLevel, error) {
+	l := inventorylevel.New(db)
+	ok, err := l.Query().Filter("InventoryItemId=", item).Filter("LocationId=", location).Get()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoLevel
+	}
+	return l, nil
+}
+
+// Reserve holds the stock plan allocates for hold's owner, replacing what was
+// held for it before: a cart that is allocated again — its items changed, or
+// its address — ends up holding what the new plan says and nothing else.
+//
+// Each allocation is checked against its level again as it is reserved; stock
+// can have gone between the plan and now. If any cannot be reserved, those
+// already reserved are given back and the owner holds nothing.
+func Reserve(db *datastore.Datastore, plan *Plan, hold Hold) ([]*reservation.ReservationItem, error) {
+	if hold.OwnerId == "" {
+		return nil, ErrNoOwner
+	}
+	if hold.ExpiresAt.IsZero() {
+		hold.ExpiresAt = time.Now().Add(DefaultTTL)
+	}
+
+	unlock, err := lockOwner(db, hold.OwnerId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := releaseHeld(db, hold.OwnerId); err != nil {
+		return nil, err
+	}
+
+	made := make([]*reservation.ReservationItem, 0, len(plan.Allocations))
+	for _, a := range plan.Allocations {
+		r, err := reserve(db, a, hold)
+		if err != nil {
+			for _, r := range made {
+				_ = release(db, r)
+			}
+			return nil, err
+		}
+		made = append(made, r)
+	}
+	return made, nil
+}
+
+func reserve(db *datastore.Datastore, a Allocation, hold Hold) (*reservation.ReservationItem, error) {
+	unlock, err := LockLevel(db, a.InventoryItemId, a.LocationId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	level, err := levelAt(db, a.InventoryItemId, a.LocationId)
+	if err != nil {
+		return nil, err
+	}
+	if have := level.AvailableQuantity(); !a.Backorder && have < a.Quantity {
+		return nil, &ShortageError{InventoryItemId: a.InventoryItemId, Wanted: a.Quantity, Available: max(have, 0)}
+	}
+
+	level.ReservedQuantity += a.Quantity
+	if err := level.Update(); err != nil {
+		return nil, err
+	}
+
+	r := reservation.New(db)
+	r.InventoryItemId = a.InventoryItemId
+	r.LocationId = a.LocationId
+	r.LineItemId = a.LineItemId
+	r.VariantId = a.VariantId
+	r.Quantity = a.Quantity
+	r.AllowBackorder = a.Backorder
+	r.OwnerId = hold.OwnerId
+	r.Status = reservation.Held
+	r.ExpiresAt = hold.ExpiresAt
+	if err := r.Create(); err != nil {
+		level.ReservedQuantity -= a.Quantity
+		_ = level.Update()
+		return nil, err
+	}
+	return r, nil
+}
+
+// release gives r's stock back to its level and deletes it.
+func release(db *datastore.Datastore, r *reservation.ReservationItem) error {
+	unlock, err := LockLevel(db, r.InventoryItemId, r.LocationId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	level, err := levelAt(db, r.InventoryItemId, r.LocationId)
+	switch {
+	case errors.Is(err, ErrNoLevel):
+		// The level went with its location; there is nothing to give back to.
+	case err != nil:
+		return err
+	default:
+		level.ReservedQuantity = max(level.ReservedQuantity-r.Quantity, 0)
+		if err := level.Update(); err != nil {
+			return err
+		}
+	}
+	return r.Delete()
+}
+
+// Held returns what is held for owner.
+func Held(db *datastore.Datastore, owner string) ([]*reservation.ReservationItem, error) {
+	var rs []*reservation.ReservationItem
+	_, err := reservation.Query(db).Filter("OwnerId=", owner).Filter("Status=", reservation.Held).GetAll(&rs)
+	return rs, err
+}
+
+func releaseHeld(db *datastore.Datastore, owner string) (int, error) {
+	rs, err := Held(db, owner)
+	if err != nil {
+		return 0, err
+	}
+	return releaseAll(db, rs)
+}
+
+func releaseAll(db *datastore.Datastore, rs []*reservation.ReservationItem) (int, error) {
+	n := 0
+	for _, r := range rs {
+		if err := release(db, r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Release gives back everything held for owner — a cart discarded, or a
+// checkout abandoned — and returns how many reservations that was.
+func Release(db *datastore.Datastore, owner string) (int, error) {
+	unlock, err := lockOwner(db, owner)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return releaseHeld(db, owner)
+}
+
+// Extend moves the lapse of everything held for owner to expiresAt, as a
+// checkout that is still being worked on keeps its stock.
+func Extend(db *datastore.Datastore, owner string, expiresAt time.Time) ([]*reservation.ReservationItem, error) {
+	unlock, err := lockOwner(db, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rs, err := Held(db, owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, ErrNotHolding
+	}
+	for _, r := range rs {
+		r.ExpiresAt = expiresAt
+		if err := r.Update(); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// Confirm turns what is held for owner into the reservations of the order it
+// became. They no longer lapse; the order's fulfilment or cancellation ends
+// them.
+func Confirm(db *datastore.Datastore, owner, orderId string) (int, error) {
+	unlock, err := lockOwner(db, owner)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rs, err := Held(db, owner)
+	if err != nil {
+		return 0, err
+	}
+	for i, r := range rs {
+		r.Status = reservation.Confirmed
+		r.OrderId = orderId
+		r.ExpiresAt = time.Time{}
+		if err := r.Update(); err != nil {
+			return i, err
+		}
+	}
+	return len(rs), nil
+}
+
+// ReleaseOrder gives back the stock reserved for a cancelled order.
+func ReleaseOrder(db *datastore.Datastore, orderId string) (int, error) {
+	var rs []*reservation.ReservationItem
+	if _, err := reservation.Query(db).Filter("OrderId=", orderId).Filter("Status=", reservation.Confirmed).GetAll(&rs); err != nil {
+		return 0, err
+	}
+	return releaseAll(db, rs)
+}
+
+// ReleaseExpired gives back every hold that lapsed by now.
+//
+// A lapsed reservation is released under its owner's lock and only if it is
+// still held and still lapsed once the lock is taken, so a checkout that
+// confirmed or extended it in the meantime keeps it.
+func ReleaseExpired(db *datastore.Datastore, now time.Time) (int, error) {
+	var rs []*reservation.ReservationItem
+	if _, err := reservation.Query(db).Filter("Status=", reservation.Held).Filter("ExpiresAt<=", now).GetAll(&rs); err != nil {
+		return 0, err
+	}
+
+	owners := make([]string, 0, len(rs))
+	seen := make(map[string]bool, len(rs))
+	for _, r := range rs {
+		if !seen[r.OwnerId] {
+			seen[r.OwnerId] = true
+			owners = append(owners, r.OwnerId)
+		}
+	}
+
+	n := 0
+	for _, owner := range owners {
+		released, err := releaseLapsed(db, owner, now)
+		n += released
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func releaseLapsed(db *datastore.Datastore, owner string, now time.Time) (int, error) {
+	unlock, err := lockOwner(db, owner)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rs, err := Held(db, owner)
+	if err != nil {
+		return 0, err
+	}
+	lapsed := rs[:0]
+	for _, r := range rs {
+		if !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(now) {
+			lapsed = append(lapsed, r)
+		}
+	}
+	return releaseAll(db, lapsed)
+}
@@ -0,0 +1,117 @@
+package allocation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/inventorylevel"
+	"github.com/hanzoai/commerce/models/reservation"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+func testDB(t *testing.T) *datastore.Datastore {
+	t.Helper()
+	tc := ae.NewContext()
+	t.Cleanup(tc.Close)
+	return datastore.New(nscontext.WithNamespace(context.Background(), "acme"))
+}
+
+func seedLevel(t *testing.T, db *datastore.Datastore, item, location string, stocked int) *inventorylevel.InventoryLevel {
+	t.Helper()
+	l := inventorylevel.New(db)
+	l.InventoryItemId = item
+	l.LocationId = location
+	l.StockedQuantity = stocked
+	if err := l.Create(); err != nil {
+		t.Fatalf("seed level: %v", err)
+	}
+	return l
+}
+
+func reserved(t *testing.T, db *datastore.Datastore, id string) int {
+	t.Helper()
+	l := inventorylevel.New(db)
+	if err := l.GetById(id); err != nil {
+		t.Fatalf("reload level: %v", err)
+	}
+	return l.ReservedQuantity
+}
+
+func hatsFrom(location string, n int) *Plan {
+	return &Plan{
+		Allocations: []Allocation{{LineItemId: "li_1", InventoryItemId: "hat", LocationId: location, Quantity: n}},
+		Locations:   []string{location},
+	}
+}
+
+func TestReserve_HoldsUntilItLapses(t *testing.T) {
+	db := testDB(t)
+	level := seedLevel(t, db, "hat", "loc_la", 5)
+
+	now := time.Now()
+	if _, err := Reserve(db, hatsFrom("loc_la", 3), Hold{OwnerId: "cart_1", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if got := reserved(t, db, level.Id()); got != 3 {
+		t.Fatalf("reserved = %d, want 3", got)
+	}
+
+	// Another cart cannot take what the first holds.
+	var short *ShortageError
+	if _, err := Reserve(db, hatsFrom("loc_la", 3), Hold{OwnerId: "cart_2", ExpiresAt: now.Add(time.Minute)}); !errors.As(err, &short) || short.Available != 2 {
+		t.Fatalf("second cart: err = %v, want a shortage with 2 available", err)
+	}
+
+	// Reserving again replaces the cart's hold rather than adding to it.
+	if _, err := Reserve(db, hatsFrom("loc_la", 4), Hold{OwnerId: "cart_1", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("Reserve again: %v", err)
+	}
+	if got := reserved(t, db, level.Id()); got != 4 {
+		t.Fatalf("reserved = %d, want the new hold of 4 only", got)
+	}
+
+	if n, err := ReleaseExpired(db, now); err != nil || n != 0 {
+		t.Fatalf("ReleaseExpired before the lapse = %d, %v; want nothing released", n, err)
+	}
+	if n, err := ReleaseExpired(db, now.Add(2*time.Minute)); err != nil || n != 1 {
+		t.Fatalf("ReleaseExpired after the lapse = %d, %v; want the hold released", n, err)
+	}
+	if got := reserved(t, db, level.Id()); got != 0 {
+		t.Fatalf("reserved = %d, want the stock back", got)
+	}
+}
+
+func TestConfirm_OutlivesTheHoldUntilTheOrderIsCancelled(t *testing.T) {
+	db := testDB(t)
+	level := seedLevel(t, db, "hat", "loc_la", 5)
+
+	now := time.Now()
+	if _, err := Reserve(db, hatsFrom("loc_la", 2), Hold{OwnerId: "cart_1", ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if n, err := Confirm(db, "cart_1", "ord_1"); err != nil || n != 1 {
+		t.Fatalf("Confirm = %d, %v", n, err)
+	}
+
+	if n, err := ReleaseExpired(db, now.Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("ReleaseExpired = %d, %v; a confirmed reservation does not lapse", n, err)
+	}
+	if got := reserved(t, db, level.Id()); got != 2 {
+		t.Fatalf("reserved = %d, want 2 held for the order", got)
+	}
+
+	if n, err := ReleaseOrder(db, "ord_1"); err != nil || n != 1 {
+		t.Fatalf("ReleaseOrder = %d, %v", n, err)
+	}
+	if got := reserved(t, db, level.Id()); got != 0 {
+		t.Fatalf("reserved = %d, want the stock back", got)
+	}
+	var left []*reservation.ReservationItem
+	if _, err := reservation.Query(db).Filter("OrderId=", "ord_1").GetAll(&left); err != nil || len(left) != 0 {
+		t.Fatalf("reservations left = %d, %v", len(left), err)
+	}
+}
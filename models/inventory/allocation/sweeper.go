@@ -0,0 +1,118 @@
+package allocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// Sweeper gives back the stock of lapsed holds, every org's, on an interval.
+//
+// Nothing else does: a shopper who leaves a checkout does not say so, and the
+// stock their cart held is only sellable again once somebody notices the hold
+// ran out. Until a pass runs, a lapsed hold still counts against what a
+// location can promise; Interval is how stale that can get.
+type Sweeper struct {
+	// Namespaces returns the orgs to sweep. It is called once per pass, so an
+	// org created since the last is swept on the next.
+	Namespaces func(ctx context.Context) ([]string, error)
+
+	// Interval is the time between passes.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSweeper returns a Sweeper over namespaces, passing once a minute.
+func NewSweeper(namespaces func(ctx context.Context) ([]string, error)) *Sweeper {
+	return &Sweeper{Namespaces: namespaces, Interval: time.Minute}
+}
+
+// Sweep runs one pass and returns how many reservations it released. An org
+// whose sweep fails is logged and left for the next pass; the others are
+// swept regardless.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	namespaces, err := s.Namespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	now := time.Now()
+	for _, ns := range namespaces {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		released, err := ReleaseExpired(datastore.New(nscontext.WithNamespace(ctx, ns)), now)
+		n += released
+		if err != nil {
+			log.Error("allocation: sweep %s: %v", ns, err, ctx)
+		}
+	}
+	return n, nil
+}
+
+// Start runs passes until Stop. It is a no-op when the sweeper is already
+// running.
+func (s *Sweeper) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go s.loop(s.stop, s.done)
+}
+
+func (s *Sweeper) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		if n, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Error("allocation: sweep: %v", err, ctx)
+		} else if n > 0 {
+			log.Info("allocation: released %d lapsed reservations", n, ctx)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.Interval):
+		}
+	}
+}
+
+// Stop ends the loop and waits for the pass in progress to finish the org it
+// is on.
+func (s *Sweeper) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+
+	close(stop)
+	<-done
+}
@@ -0,0 +1,65 @@
+// Package jobrun is the history of the scheduler's jobs: one record per run,
+// kept in the system store, since the jobs work across every org.
+package jobrun
+
+import (
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/orm"
+)
+
+func init() { orm.Register[JobRun]("jobrun") }
+
+type JobRun struct {
+	mixin.Model[JobRun]
+
+	// Job is the scheduler job's name, and Trigger what started the run:
+	// "schedule" or "manual".
+	Job     string `json:"job"`
+	Trigger string `json:"trigger"`
+
+	// ScheduledAt is the slot a scheduled run was for. Replicas read the
+	// latest to agree on which slots are done.
+	ScheduledAt time.Time `json:"scheduledAt,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	EndedAt     time.Time `json:"endedAt,omitempty"`
+
+	// Outcome is "running", "succeeded", "failed" or "skipped"; Error says
+	// why a run failed.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty" datastore:",noindex"`
+
+	// Host is the replica that ran it.
+	Host string `json:"host,omitempty"`
+}
+
+func New(db *datastore.Datastore) *JobRun {
+	r := new(JobRun)
+	r.Init(db)
+	return r
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("jobrun")
+}
+
+// Prune deletes the runs that started before before, and returns how many it
+// deleted. Keeping the history is for looking into recent runs, not an audit
+// trail: the jobs' effects are recorded by what they change.
+func Prune(db *datastore.Datastore, before time.Time) (int, error) {
+	var runs []*JobRun
+	if _, err := Query(db).Filter("StartedAt<", before).GetAll(&runs); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range runs {
+		r.Init(db)
+		if err := r.Delete(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
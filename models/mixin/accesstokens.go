@@ -19,7 +19,7 @@ type AccessTokens struct {
 	Entity Entity `json:"-" datastore:"-"`
 
 	// JWT secret (persisted for token verification)
-	SecretKey []byte `json:"secretKey,omitempty"`
+	SecretKey []byte `json:"secretKey,omitempty" audit:"redact"`
 
 	// UseTokenId as JWT "jti" param, randomly generate upon generating a new key to expire all existing keys
 	Tokens []accesstoken.AccessToken `json:"tokens,omitempty"`
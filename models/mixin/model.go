@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/hooks"
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/util/cache"
 	"github.com/hanzoai/commerce/util/hashid"
@@ -303,6 +304,12 @@ func (m *BaseModel) Created() bool {
 
 // Put entity in datastore
 func (m *BaseModel) Put() error {
+	return m.hooked(hooks.OpUpdate, true, m.put)
+}
+
+// put writes the entity; Put, Create and Update each wrap it in the hooks
+// once.
+func (m *BaseModel) put() error {
 	// Set CreatedAt, UpdatedAt
 	now := time.Now()
 	if !m.Created() {
@@ -361,7 +368,7 @@ func (m *BaseModel) Create() error {
 		}
 	}
 
-	if err := m.Put(); err != nil {
+	if err := m.hooked(hooks.OpCreate, false, m.put); err != nil {
 		return err
 	}
 
@@ -387,7 +394,7 @@ func (m *BaseModel) Update() error {
 		}
 	}
 
-	if err := m.Put(); err != nil {
+	if err := m.hooked(hooks.OpUpdate, false, m.put); err != nil {
 		return err
 	}
 
@@ -417,7 +424,7 @@ func (m *BaseModel) Delete() error {
 	// Errors are ignored
 	m.DeleteDocument()
 
-	if err := m.Db.Delete(m.key); err != nil {
+	if err := m.hooked(hooks.OpDelete, false, func() error { return m.Db.Delete(m.key) }); err != nil {
 		return err
 	}
 
@@ -431,6 +438,35 @@ func (m *BaseModel) Delete() error {
 	return nil
 }
 
+// hooked makes write with the process's model hooks around it; see
+// Model[T].hooked.
+func (m *BaseModel) hooked(op hooks.Op, upsert bool, write func() error) error {
+	if m.Mock {
+		return write()
+	}
+	return hooks.Default().RunModelWrite(&hooks.ModelWrite{
+		Context: m.Context(),
+		Kind:    m.Kind(),
+		Op:      op,
+		Upsert:  upsert,
+		Model:   m.Entity,
+		Load: func() (interface{}, error) {
+			if m.key == nil {
+				return nil, nil
+			}
+			prev := m.Zero()
+			if err := m.Db.Get(m.key, prev); err != nil {
+				if errors.Is(err, datastore.ErrNoSuchEntity) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			return prev, nil
+		},
+		Write: write,
+	})
+}
+
 // Set key or panic
 func (m *BaseModel) MustSetKey(key interface{}) {
 	if err := m.SetKey(key); err != nil {
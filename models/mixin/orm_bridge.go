@@ -16,6 +16,7 @@ package mixin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"time"
@@ -23,6 +24,8 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	dskey "github.com/hanzoai/commerce/datastore/key"
 	"github.com/hanzoai/commerce/datastore/query"
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/hooks"
 	"github.com/hanzoai/commerce/util/hashid"
 	"github.com/hanzoai/orm"
 )
@@ -228,29 +231,110 @@ func (b *Model[T]) callSave() {
 func (b *Model[T]) Put() error {
 	b.callSave()
 	b.ensureKey()
-	err := b.Model.Put()
-	b.updateId()
-	return err
+	return b.hooked(hooks.OpUpdate, true, func() error {
+		err := b.Model.Put()
+		b.updateId()
+		return err
+	})
 }
 
 func (b *Model[T]) Create() error {
 	b.callSave()
 	b.ensureKey()
-	err := b.Model.Create()
-	b.updateId()
-	return err
+	return b.hooked(hooks.OpCreate, false, func() error {
+		err := b.Model.Create()
+		b.updateId()
+		return err
+	})
 }
 
 func (b *Model[T]) Update() error {
 	b.callSave()
 	b.ensureKey()
-	err := b.Model.Update()
-	b.updateId()
-	return err
+	return b.hooked(hooks.OpUpdate, false, func() error {
+		err := b.Model.Update()
+		b.updateId()
+		return err
+	})
 }
 
 func (b *Model[T]) Delete() error {
-	return b.Model.Delete()
+	return b.hooked(hooks.OpDelete, false, b.Model.Delete)
+}
+
+// hooked makes write with the process's model hooks around it (see
+// hooks.RunModelWrite). upsert marks a Put, which is a create or an update
+// depending on whether the entity is stored yet.
+func (b *Model[T]) hooked(op hooks.Op, upsert bool, write func() error) error {
+	if b.Mock {
+		return write()
+	}
+	return hooks.Default().RunModelWrite(&hooks.ModelWrite{
+		Context: b.Context(),
+		Kind:    b.Model.Kind(),
+		Op:      op,
+		Upsert:  upsert,
+		Model:   b.self(),
+		Load:    b.loadStored,
+		Write:   write,
+	})
+}
+
+// loadStored reads the entity as it is stored now, for a hook's Before, into
+// a fresh T — never into b, whose unsaved changes are the write. Nil when it
+// is not stored.
+func (b *Model[T]) loadStored() (interface{}, error) {
+	if b.ds == nil || b.Model.Id_ == "" {
+		return nil, nil
+	}
+	prev := new(T)
+	if err := b.ds.Get(b.Key(), prev); err != nil {
+		if errors.Is(err, datastore.ErrNoSuchEntity) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return prev, nil
+}
+
+// PutWithEvents, CreateWithEvents and UpdateWithEvents are Put, Create and
+// Update with msgs written to the store's outbox in the same transaction as
+// the entity, so the events exist exactly when the change does. See db.Outbox.
+//
+// The write goes through the ORM exactly as it would without events — hooks,
+// Save side effects, timestamps — against a copy of the datastore with the
+// messages staged on it (Datastore.WithOutbox). The key is allocated first,
+// on the model's own datastore, so the copy never hands out an id.
+func (b *Model[T]) PutWithEvents(msgs ...*db.OutboxMessage) error {
+	return b.withEvents(msgs, b.Put)
+}
+
+func (b *Model[T]) CreateWithEvents(msgs ...*db.OutboxMessage) error {
+	return b.withEvents(msgs, b.Create)
+}
+
+func (b *Model[T]) UpdateWithEvents(msgs ...*db.OutboxMessage) error {
+	return b.withEvents(msgs, b.Update)
+}
+
+func (b *Model[T]) withEvents(msgs []*db.OutboxMessage, write func() error) error {
+	if len(msgs) == 0 || b.ds == nil {
+		return write()
+	}
+	b.ensureKey()
+
+	ds := b.ds
+	staged := ds.WithOutbox(msgs...)
+	b.Rebind(staged)
+	defer b.Rebind(ds)
+
+	if err := write(); err != nil {
+		return err
+	}
+	if staged.OutboxPending() {
+		return fmt.Errorf("orm bridge: %s was written without its events", b.Model.Kind())
+	}
+	return nil
 }
 
 // Get overrides orm.Model[T].Get to accept datastore.Key.
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/db"
 	"github.com/hanzoai/commerce/models/mixin"
 )
 
@@ -125,6 +126,57 @@ func Update(vals interface{}) error {
 	})
 }
 
+// eventWriter is an entity that can be written with outbox events.
+type eventWriter interface {
+	CreateWithEvents(msgs ...*db.OutboxMessage) error
+	UpdateWithEvents(msgs ...*db.OutboxMessage) error
+	PutWithEvents(msgs ...*db.OutboxMessage) error
+}
+
+// evented is an entity whose write in a batch carries msgs (WithEvents).
+type evented struct {
+	mixin.Entity
+	msgs []*db.OutboxMessage
+}
+
+func (e evented) writer() (eventWriter, error) {
+	w, ok := e.Entity.(eventWriter)
+	if !ok {
+		return nil, fmt.Errorf("multi: %T cannot be written with events", e.Entity)
+	}
+	return w, nil
+}
+
+func (e evented) Create() error {
+	w, err := e.writer()
+	if err != nil {
+		return err
+	}
+	return w.CreateWithEvents(e.msgs...)
+}
+
+func (e evented) Update() error {
+	w, err := e.writer()
+	if err != nil {
+		return err
+	}
+	return w.UpdateWithEvents(e.msgs...)
+}
+
+func (e evented) Put() error {
+	w, err := e.writer()
+	if err != nil {
+		return err
+	}
+	return w.PutWithEvents(e.msgs...)
+}
+
+// WithEvents puts entity in a batch with msgs written to the outbox with it,
+// as its CreateWithEvents, UpdateWithEvents or PutWithEvents would.
+func WithEvents(entity mixin.Entity, msgs ...*db.OutboxMessage) mixin.Entity {
+	return evented{Entity: entity, msgs: msgs}
+}
+
 func MustPut(vals interface{}) {
 	if err := Put(vals); err != nil {
 		panic(err)
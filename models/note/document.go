@@ -0,0 +1,52 @@
+package note
+
+import (
+	"github.com/hanzoai/commerce/models/mixin"
+)
+
+type Document struct {
+	mixin.DocumentSaveLoad `datastore:"-" json:"-"`
+
+	// Special Kind Option
+	Kind string `search:",facet"`
+
+	Id_     string
+	Source  string
+	Message string
+
+	Time      float64
+	CreatedAt float64
+	UpdatedAt float64
+
+	// Facets
+	SourceOption  string `search:"source,facet"`
+	EnabledOption string `search:"enabled,facet"`
+}
+
+func (d *Document) Id() string {
+	return d.Id_
+}
+
+func (d *Document) Init() {
+	d.SetDocument(d)
+}
+
+func (n Note) Document() mixin.Document {
+	doc := &Document{}
+	doc.Init()
+	doc.Kind = "note"
+	doc.Id_ = n.Id()
+	doc.Source = n.Source
+	doc.Message = n.Message
+
+	doc.Time = float64(n.Time.Unix())
+	doc.CreatedAt = float64(n.CreatedAt.Unix())
+	doc.UpdatedAt = float64(n.UpdatedAt.Unix())
+
+	doc.SourceOption = n.Source
+	if n.Enabled {
+		doc.EnabledOption = "enabled"
+	}
+
+	return doc
+}
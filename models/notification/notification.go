@@ -1,6 +1,8 @@
 package notification
 
 import (
+	"time"
+
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/util/json"
@@ -25,6 +27,10 @@ const (
 	Pending NotificationStatus = "pending"
 	Sent    NotificationStatus = "sent"
 	Failed  NotificationStatus = "failed"
+
+	// Skipped is a notification its recipient opted out of. It is not sent,
+	// and not retried.
+	Skipped NotificationStatus = "skipped"
 )
 
 type Notification struct {
@@ -37,6 +43,25 @@ type Notification struct {
 	ProviderId string             `json:"providerId"`
 	ExternalId string             `json:"externalId"`
 
+	// UserId is the customer it is for, whose preferences it honours. A
+	// guest's are looked up by To.
+	UserId string `json:"userId,omitempty"`
+
+	// Topic is what it is about ("order", "marketing", ...), which a customer
+	// can opt out of per topic.
+	Topic string `json:"topic,omitempty"`
+
+	// Locale picks the template's translation, falling back to the language
+	// and then to the template's default.
+	Locale string `json:"locale,omitempty"`
+
+	// Delivery attempts so far, when the next is due, and why the last
+	// failed. A notification is given up on, Failed, after MaxAttempts.
+	Attempts      int       `json:"attempts,omitempty"`
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string    `json:"lastError,omitempty" datastore:",noindex"`
+	SentAt        time.Time `json:"sentAt,omitempty"`
+
 	// Data stored as JSON in datastore
 	Data  Map    `json:"data,omitempty" datastore:"-" orm:"default:{}"`
 	Data_ string `json:"-" datastore:",noindex"`
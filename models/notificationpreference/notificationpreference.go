@@ -0,0 +1,56 @@
+// Package notificationpreference is what a customer has opted out of being
+// notified by, or about.
+package notificationpreference
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/orm"
+)
+
+func init() { orm.Register[NotificationPreference]("notificationpreference") }
+
+type NotificationPreference struct {
+	mixin.Model[NotificationPreference]
+
+	// UserId is the customer the preference is theirs. A guest's is kept by
+	// Address instead: the email, phone number or device token they are
+	// notified at.
+	UserId  string `json:"userId,omitempty"`
+	Address string `json:"address,omitempty"`
+
+	// Channels and Topics are those opted out of. A notification on an
+	// opted-out channel, or about an opted-out topic, is skipped.
+	Channels []notification.Channel `json:"channels,omitempty" datastore:",noindex"`
+	Topics   []string               `json:"topics,omitempty" datastore:",noindex"`
+}
+
+// OptedOut reports whether the preference excludes a notification on
+// channel about topic.
+func (p *NotificationPreference) OptedOut(channel notification.Channel, topic string) bool {
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	if topic == "" {
+		return false
+	}
+	for _, t := range p.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func New(db *datastore.Datastore) *NotificationPreference {
+	p := new(NotificationPreference)
+	p.Init(db)
+	return p
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("notificationpreference")
+}
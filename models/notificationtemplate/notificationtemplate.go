@@ -0,0 +1,46 @@
+// Package notificationtemplate is a merchant's wording of a notification: one
+// per template name, channel and locale. A notification names its template
+// and is rendered with the translation closest to its locale.
+package notificationtemplate
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/orm"
+)
+
+func init() { orm.Register[NotificationTemplate]("notificationtemplate") }
+
+type NotificationTemplate struct {
+	mixin.Model[NotificationTemplate]
+
+	// Name is what a notification's TemplateId refers to, such as
+	// "order-confirmation".
+	Name    string               `json:"name"`
+	Channel notification.Channel `json:"channel"`
+
+	// Locale is the BCP 47 tag it is written in ("fr", "fr-CA"); empty is
+	// the default, used when there is no translation closer to the
+	// notification's.
+	Locale string `json:"locale,omitempty"`
+
+	// Handlebars templates over the notification's data. Subject is the
+	// email subject or push title; Body the text of an SMS, a push or a
+	// plain-text email; HTML the email's HTML.
+	Subject string `json:"subject,omitempty" datastore:",noindex"`
+	Body    string `json:"body,omitempty" datastore:",noindex"`
+	HTML    string `json:"html,omitempty" datastore:",noindex"`
+
+	IsEnabled bool `json:"isEnabled" orm:"default:true"`
+}
+
+func New(db *datastore.Datastore) *NotificationTemplate {
+	t := new(NotificationTemplate)
+	t.Init(db)
+	return t
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("notificationtemplate")
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/models/coupon"
+	"github.com/hanzoai/commerce/models/promotion"
 	"github.com/hanzoai/commerce/models/types/currency"
 
 	"github.com/hanzoai/commerce/models/lineitem"
@@ -19,7 +20,7 @@ func (o *Order) GetCoupons() error {
 
 	log.Debug("CouponCodes: %#v", o.CouponCodes)
 	num := len(o.CouponCodes)
-	o.Coupons = make([]coupon.Coupon, num, num)
+	o.Coupons = make([]coupon.Coupon, 0, num)
 
 	for i := 0; i < num; i++ {
 		cpn := coupon.New(db)
@@ -29,11 +30,17 @@ func (o *Order) GetCoupons() error {
 		err := cpn.GetById(code)
 
 		if err != nil {
+			// Shoppers enter promotion codes in the same box as coupon codes.
+			// One that names an active promotion is the promotion engine's to
+			// apply (promotion.go), not an invalid coupon.
+			if n, perr := promotion.Query(db).Filter("Code=", code).Filter("Status=", "active").Count(); perr == nil && n > 0 {
+				continue
+			}
 			log.Warn("Could not find CouponCodes[%v] => %v, Error: %v", i, code, err, ctx)
 			return errors.New("Invalid coupon code: " + code)
 		}
 
-		o.Coupons[i] = *cpn
+		o.Coupons = append(o.Coupons, *cpn)
 	}
 
 	return nil
@@ -133,6 +140,16 @@ func (o *Order) CalcCouponDiscount() currency.Cents {
 // Order-wide coupons (no ProductId/VariantId) do not reduce the taxable base.
 func (o *Order) CalcItemCouponTaxableDiscount() currency.Cents {
 	var taxableDiscount currency.Cents
+	for _, d := range o.itemCouponTaxableDiscounts() {
+		taxableDiscount += d
+	}
+	return taxableDiscount
+}
+
+// itemCouponTaxableDiscounts is CalcItemCouponTaxableDiscount by line item id,
+// so that tax can be charged on each line as it was discounted.
+func (o *Order) itemCouponTaxableDiscounts() map[string]currency.Cents {
+	discounts := make(map[string]currency.Cents)
 
 	for i := range o.Coupons {
 		c := &o.Coupons[i]
@@ -152,18 +169,18 @@ func (o *Order) CalcItemCouponTaxableDiscount() currency.Cents {
 				if c.Once {
 					qty = 1
 				}
-				taxableDiscount += currency.Cents(qty * c.Amount)
+				discounts[item.Id()] += currency.Cents(qty * c.Amount)
 			case coupon.Percent:
 				// Same per-line rounding as the discount itself in CalcCouponDiscount:
 				// tax must be charged on the amount the customer was actually billed.
-				taxableDiscount += item.TotalPrice().Percent(c.Amount)
+				discounts[item.Id()] += item.TotalPrice().Percent(c.Amount)
 			}
 			if c.Once {
 				break
 			}
 		}
 	}
-	return taxableDiscount
+	return discounts
 }
 
 // Update discount using coupon codes/order info.
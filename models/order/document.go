@@ -215,7 +215,7 @@ func (o Order) Document() mixin.Document {
 	// money back out of the index.
 	doc.Discount = o.Currency.Amount(o.Discount).AsMajorUnits()
 	doc.Subtotal = o.Currency.Amount(o.Subtotal).AsMajorUnits()
-	doc.Shipping = o.Currency.Amount(o.Shipping).AsMajorUnits()
+	doc.Shipping = o.Currency.Amount(o.NetShipping()).AsMajorUnits()
 	doc.Tax = o.Currency.Amount(o.Tax).AsMajorUnits()
 	doc.Adjustment = o.Currency.Amount(o.Adjustment).AsMajorUnits()
 	doc.Total = o.Currency.Amount(o.Total).AsMajorUnits()
@@ -0,0 +1,25 @@
+package order
+
+import (
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/events/outbox"
+)
+
+// OutboxEvent describes the order as it is being written, for its
+// CreateWithEvents, UpdateWithEvents or PutWithEvents. The data is the order's
+// state at this write, not a reference to re-read later.
+func (o *Order) OutboxEvent(eventType string) *db.OutboxMessage {
+	return outbox.New("order", o.Id(), eventType, map[string]interface{}{
+		"id":                o.Id(),
+		"number":            o.Number,
+		"userId":            o.UserId,
+		"status":            o.Status,
+		"paymentStatus":     o.PaymentStatus,
+		"fulfillmentStatus": o.Fulfillment.Status,
+		"currency":          o.Currency,
+		"total":             o.Total,
+		"paid":              o.Paid,
+		"refunded":          o.Refunded,
+		"test":              o.Test,
+	})
+}
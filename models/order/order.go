@@ -22,6 +22,7 @@ import (
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/models/payment"
 	"github.com/hanzoai/commerce/models/paymentmethod"
+	"github.com/hanzoai/commerce/models/promotion/engine"
 	"github.com/hanzoai/commerce/models/referrer"
 	"github.com/hanzoai/commerce/models/store"
 	"github.com/hanzoai/commerce/models/types/accounts"
@@ -29,6 +30,8 @@ import (
 	"github.com/hanzoai/commerce/models/types/fulfillment"
 	"github.com/hanzoai/commerce/models/types/pricing"
 	"github.com/hanzoai/commerce/models/wallet"
+	"github.com/hanzoai/commerce/tax"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/util/hashid"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/val"
@@ -139,6 +142,9 @@ type Order struct {
 	// Shipping cost applied. Amount in cents.
 	Shipping currency.Cents `json:"shipping"`
 
+	// Part of Shipping taken off by promotions. Amount in cents.
+	ShippingDiscount currency.Cents `json:"shippingDiscount,omitempty"`
+
 	// Sales tax applied. Amount in cents.
 	Tax currency.Cents `json:"tax"`
 
@@ -173,6 +179,39 @@ type Order struct {
 	Coupons     []coupon.Coupon `json:"coupons,omitempty" datastore:",noindex"`
 	CouponCodes []string        `json:"couponCodes,omitempty" datastore:",noindex"`
 
+	// Promotions applied when the order was last tallied, one adjustment per
+	// promotion per line. Kept so the discount can be explained after the
+	// promotions themselves have changed, and so budgets are charged what the
+	// shopper was actually given.
+	Promotions  []engine.Adjustment `json:"promotions,omitempty" datastore:"-"`
+	Promotions_ string              `json:"-" datastore:",noindex"`
+
+	// Region and sales channel the order was placed in, for promotion rules
+	// that are limited to them.
+	RegionId       string `json:"regionId,omitempty"`
+	SalesChannelId string `json:"salesChannelId,omitempty"`
+
+	// Whether Tax is included in the prices rather than added to them, the
+	// provider that worked it out, and the sale as that provider recorded it
+	// once the order was paid, for voiding and refunding it there.
+	TaxInclusive     bool   `json:"taxInclusive,omitempty"`
+	TaxProvider      string `json:"taxProvider,omitempty"`
+	TaxTransactionId string `json:"taxTransactionId,omitempty"`
+
+	// Tax by rate and jurisdiction, for returns filed by rate such as the
+	// EU One-Stop-Shop.
+	TaxRates  []tax.Rate `json:"taxRates,omitempty" datastore:"-"`
+	TaxRates_ string     `json:"-" datastore:",noindex"`
+
+	// CustomerTaxId is the tax number the customer bought under, checked at
+	// checkout. A sale to a business abroad under a valid one is
+	// reverse-charged: TaxReverseCharge, and no tax.
+	CustomerTaxId    taxid.TaxId `json:"customerTaxId,omitempty"`
+	TaxReverseCharge bool        `json:"taxReverseCharge,omitempty"`
+
+	// TaxEvidence is where the customer was shown to be at checkout.
+	TaxEvidence tax.Evidence `json:"taxEvidence,omitempty"`
+
 	PaymentIds []string           `json:"payments" datastore:",noindex"`
 	Payments   []*payment.Payment `json:"-" datastore:"-"`
 
@@ -260,6 +299,14 @@ func (o *Order) Load(ps []datastore.Property) (err error) {
 		err = json.DecodeBytes([]byte(o.Items_), &o.Items)
 	}
 
+	if len(o.Promotions_) > 0 {
+		err = json.DecodeBytes([]byte(o.Promotions_), &o.Promotions)
+	}
+
+	if len(o.TaxRates_) > 0 {
+		err = json.DecodeBytes([]byte(o.TaxRates_), &o.TaxRates)
+	}
+
 	if len(o.Metadata_) > 0 {
 		err = json.DecodeBytes([]byte(o.Metadata_), &o.Metadata)
 	}
@@ -281,6 +328,8 @@ func (o *Order) Save() (ps []datastore.Property, err error) {
 	// Serialize unsupported properties
 	o.Discounts_ = string(json.EncodeBytes(o.Discounts))
 	o.Items_ = string(json.EncodeBytes(o.Items))
+	o.Promotions_ = string(json.EncodeBytes(o.Promotions))
+	o.TaxRates_ = string(json.EncodeBytes(o.TaxRates))
 	o.Metadata_ = string(json.EncodeBytes(&o.Metadata))
 	o.Number = o.NumberFromId()
 
@@ -647,7 +696,13 @@ func (o Order) DisplayTax() string {
 }
 
 func (o Order) DisplayShipping() string {
-	return DisplayPrice(o.Currency, o.Shipping)
+	return DisplayPrice(o.Currency, o.NetShipping())
+}
+
+// NetShipping is what the customer pays for shipping: Shipping less what
+// promotions took off it.
+func (o Order) NetShipping() currency.Cents {
+	return o.Shipping - o.ShippingDiscount
 }
 
 func (o Order) DisplayTotal() string {
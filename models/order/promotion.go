@@ -0,0 +1,70 @@
+package order
+
+import (
+	"time"
+
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/promotion/engine"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// PromotionCart is the order as the promotion engine sees it. Items need
+// their products fetched (GetItemEntities) for tag and category rules to see
+// them.
+func (o *Order) PromotionCart() (*engine.Cart, error) {
+	groups, err := engine.CustomerGroups(o.Datastore(), o.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	cart := &engine.Cart{
+		Currency:         string(o.Currency),
+		CustomerId:       o.UserId,
+		CustomerGroupIds: groups,
+		SalesChannelId:   o.SalesChannelId,
+		RegionId:         o.RegionId,
+		Codes:            o.CouponCodes,
+		Items:            engine.LineItems(o.Items),
+		Shipping:         o.Shipping,
+	}
+
+	return cart, nil
+}
+
+// ApplyPromotions evaluates the order's promotions and records what they
+// gave in Promotions. It changes no totals; UpdateAndTally decides where the
+// result goes.
+func (o *Order) ApplyPromotions() (*engine.Result, error) {
+	cart, err := o.PromotionCart()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := engine.Apply(o.Datastore(), cart, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	o.Promotions = res.Adjustments
+	return res, nil
+}
+
+// PromotionTaxableDiscount is the part of the promotions' discount that came
+// off taxable items specifically. Like item coupons it reduces the taxable
+// base; order-wide promotions, like order-wide coupons, do not.
+func (o *Order) PromotionTaxableDiscount() currency.Cents {
+	taxable := make(map[string]bool)
+	for _, item := range o.Items {
+		if item.Taxable {
+			taxable[item.Id()] = true
+		}
+	}
+
+	var discount currency.Cents
+	for _, adj := range o.Promotions {
+		if adj.Target == applicationmethod.TargetItems && taxable[adj.ItemId] {
+			discount += adj.Amount
+		}
+	}
+	return discount
+}
@@ -49,7 +49,11 @@ func (o *Order) TallySubtotalWithoutSubscriptions() {
 
 func (o *Order) TallyTotalWithoutSubscriptions() {
 	log.Debug("Tallying up order total")
-	o.Total = o.Subtotal + o.Tax + o.Shipping
+	o.Total = o.Subtotal + o.NetShipping()
+	// Tax included in the prices is already in the subtotal.
+	if !o.TaxInclusive {
+		o.Total += o.Tax
+	}
 }
 
 func (o *Order) SyncItems(stor *store.Store) {
@@ -164,27 +168,72 @@ func (o *Order) UpdateAndTally(stor *store.Store) error {
 			}
 			o.Shipping = match.Cost + o.Subtotal.Scale(rate)
 		}
+	}
 
-		o.Tax = 0
+	// Promotions come after shipping, which they may discount and so must
+	// have a price for, and before tax, which is charged on what is left.
+	// Shipping is therefore matched on the subtotal after coupons but before
+	// promotions. Shipping stays as quoted and what promotions take off it is
+	// ShippingDiscount, worked out afresh each tally: without a store the
+	// quote is the client's, and is never priced again here.
+	o.Promotions = nil
+	o.ShippingDiscount = 0
+	if o.Mode != DepositMode && o.Mode != ContributionMode && o.TokenSaleId == "" {
+		log.Debug("Applying promotions")
+		res, err := o.ApplyPromotions()
+		if err != nil {
+			log.Error(err, ctx)
+			return errors.New("Failed to apply promotions")
+		}
 
-		if trs, err := stor.GetTaxRates(); trs == nil {
-			log.Warn("Failed to get taxrates for discount rules: %v", err, ctx)
-		} else if match, _, _ := trs.Match(o.ShippingAddress.Country, o.ShippingAddress.State, o.ShippingAddress.City, o.ShippingAddress.PostalCode, o.Subtotal); match != nil {
-			// Whether shipping is taxable changes the BASE, not the arithmetic, so the
-			// rate is applied once. Rounded, not truncated: tax is computed on our own
-			// configured rate rather than handed to us by a provider, so the part-cent is
-			// ours to get right, and truncating it under-collected on every order that
-			// had one — money we still owe the jurisdiction.
-			base := o.TaxableLineTotal
-			if match.TaxShipping {
-				base += o.Shipping
+		o.Discount += res.Discount
+		o.Subtotal -= res.Discount
+		o.ShippingDiscount = res.ShippingDiscount
+
+		if taxableReduce := o.PromotionTaxableDiscount(); taxableReduce > 0 {
+			if o.TaxableLineTotal > taxableReduce {
+				o.TaxableLineTotal -= taxableReduce
+			} else {
+				o.TaxableLineTotal = 0
 			}
+		}
+	}
 
-			rate, err := money.RateFromFloat(match.Percent)
-			if err != nil {
-				return err
+	if !useFallback {
+		o.Tax = 0
+		o.TaxInclusive = false
+		o.TaxProvider = ""
+		o.TaxRates = nil
+		o.TaxReverseCharge = false
+
+		// Tax regions come first; the store's own rates are for addresses no
+		// region covers.
+		taxed, err := o.tallyTax()
+		if err != nil {
+			log.Error("Failed to calculate tax: %v", err, ctx)
+			return err
+		}
+
+		if !taxed {
+			if trs, err := stor.GetTaxRates(); trs == nil {
+				log.Warn("Failed to get taxrates for discount rules: %v", err, ctx)
+			} else if match, _, _ := trs.Match(o.ShippingAddress.Country, o.ShippingAddress.State, o.ShippingAddress.City, o.ShippingAddress.PostalCode, o.Subtotal); match != nil {
+				// Whether shipping is taxable changes the BASE, not the arithmetic, so the
+				// rate is applied once. Rounded, not truncated: tax is computed on our own
+				// configured rate rather than handed to us by a provider, so the part-cent is
+				// ours to get right, and truncating it under-collected on every order that
+				// had one — money we still owe the jurisdiction.
+				base := o.TaxableLineTotal
+				if match.TaxShipping {
+					base += o.NetShipping()
+				}
+
+				rate, err := money.RateFromFloat(match.Percent)
+				if err != nil {
+					return err
+				}
+				o.Tax = match.Cost + base.Scale(rate)
 			}
-			o.Tax = match.Cost + base.Scale(rate)
 		}
 	}
 
@@ -0,0 +1,65 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/promotion"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+// Tallying an order again, as every update through the API does, takes a
+// shipping promotion off the quoted shipping once: 50% off is 50% off however
+// many times the order is saved.
+func TestUpdateAndTally_ShippingDiscountOnce(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := datastore.New(nscontext.WithNamespace(context.Background(), "acme"))
+
+	p := product.New(db)
+	p.Slug = "shirt"
+	p.Price = 2000
+	p.Currency = currency.USD
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	promo := promotion.New(db)
+	promo.Code = "HALFSHIP"
+	promo.Status = "active"
+	promo.IsAutomatic = true
+	if err := promo.Create(); err != nil {
+		t.Fatal(err)
+	}
+	m := applicationmethod.New(db)
+	m.PromotionId = promo.Id()
+	m.Type = applicationmethod.Percentage
+	m.TargetType = applicationmethod.TargetShipping
+	m.Value = 5000
+	if err := m.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := New(db)
+	o.Currency = currency.USD
+	o.Items = []lineitem.LineItem{{ProductId: p.Id(), Quantity: 1}}
+	o.Shipping = 800
+
+	for i := 1; i <= 3; i++ {
+		if err := o.UpdateAndTally(nil); err != nil {
+			t.Fatal(err)
+		}
+		if o.Shipping != 800 || o.ShippingDiscount != 400 || o.NetShipping() != 400 {
+			t.Fatalf("tally %d: shipping %d less %d, want 800 less 400", i, o.Shipping, o.ShippingDiscount)
+		}
+		if o.Total != o.Subtotal+400 {
+			t.Fatalf("tally %d: total %d, want subtotal %d and 400 shipping", i, o.Total, o.Subtotal)
+		}
+	}
+}
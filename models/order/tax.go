@@ -0,0 +1,154 @@
+package order
+
+import (
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/payment"
+	"github.com/hanzoai/commerce/models/store"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax"
+)
+
+// TaxRequest is the order as a sale to tax: its lines less what item coupons
+// and promotions took off each, shipping, and where it ships to. Order-wide
+// discounts do not reduce the taxable base and are left out, as in the
+// tally. An order without items is taxed on its taxable total as one line.
+//
+// The sale is from the country of the store's address, when it was sold
+// from a store that has one.
+func (o *Order) TaxRequest() *tax.Request {
+	req := &tax.Request{
+		Currency: o.Currency,
+		Address: tax.Address{
+			Country:    o.ShippingAddress.Country,
+			Province:   o.ShippingAddress.State,
+			City:       o.ShippingAddress.City,
+			PostalCode: o.ShippingAddress.PostalCode,
+		},
+		Customer: tax.Customer{Id: o.UserId, TaxId: o.CustomerTaxId},
+		RegionId: o.RegionId,
+		Shipping: o.NetShipping(),
+	}
+	if o.StoreId != "" {
+		stor := store.New(o.Datastore())
+		if err := stor.GetById(o.StoreId); err == nil {
+			req.Origin = stor.Address.Country
+		}
+	}
+
+	if o.Mode == DepositMode || o.Mode == ContributionMode || o.TokenSaleId != "" {
+		if o.TaxableLineTotal > 0 {
+			req.Lines = []tax.Line{{Id: "subtotal", Quantity: 1, UnitPrice: o.TaxableLineTotal, Taxable: true}}
+		}
+		return req
+	}
+
+	discounts := o.itemCouponTaxableDiscounts()
+	for _, adj := range o.Promotions {
+		if adj.Target == applicationmethod.TargetItems {
+			discounts[adj.ItemId] += adj.Amount
+		}
+	}
+	req.Lines = tax.LineItems(o.Items, discounts)
+	return req
+}
+
+// tallyTax charges the tax the org's tax regions work out for the order, and
+// reports whether one covered its address. When none does the store's own tax
+// rates still apply, as they did before there were regions.
+func (o *Order) tallyTax() (bool, error) {
+	q, err := tax.Calculate(o.Context(), o.TaxRequest())
+	if err != nil {
+		return false, err
+	}
+	if q.Jurisdiction == "" {
+		return false, nil
+	}
+	o.Tax = q.Tax
+	o.TaxInclusive = q.Inclusive
+	o.TaxProvider = q.Provider
+	o.TaxRates = q.Rates()
+	o.TaxReverseCharge = q.ReverseCharge
+	return true, nil
+}
+
+// RecordTaxEvidence keeps where the customer was shown to be when paying:
+// the country of their billing address, of their IP address and of their
+// card.
+func (o *Order) RecordTaxEvidence(pay *payment.Payment) {
+	o.TaxEvidence = tax.Evidence{BillingCountry: o.BillingAddress.Country}
+	if pay == nil {
+		return
+	}
+	o.TaxEvidence.IPCountry = pay.Client.Country
+	o.TaxEvidence.CardCountry = pay.Account.Stripe.Country
+	if o.TaxEvidence.CardCountry == "" {
+		o.TaxEvidence.CardCountry = pay.Account.Country
+	}
+}
+
+// InstallTax keeps the tax provider's record of each order in step with it,
+// through r's model hooks: a paid order is committed as a sale, a refund
+// refunds its share of the tax, and an order cancelled before any refund is
+// voided. Orders taxed by the store's own rates have no provider and are
+// left alone.
+//
+// A failure is logged and does not fail the write that triggered it; the
+// payment has been taken or returned either way, and what the provider is
+// missing is for the merchant to reconcile, not the customer to retry.
+func InstallTax(r *hooks.Registry) {
+	r.OnModelAfterUpdate("order").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "tax", Func: taxChanged})
+}
+
+func taxChanged(e *hooks.ModelEvent) error {
+	o, ok := e.Model.(*Order)
+	if !ok || e.Context == nil || o.TaxProvider == "" {
+		return e.Next()
+	}
+	ctx := e.Context
+
+	switch {
+	case o.TaxTransactionId == "" && o.PaymentStatus == payment.Paid:
+		req := o.TaxRequest()
+		req.Reference = o.Id()
+		tx, err := tax.Commit(ctx, req)
+		if err != nil {
+			log.Error("tax: commit order %s with %s: %v", o.Id(), o.TaxProvider, err, ctx)
+			break
+		}
+		o.TaxTransactionId = tx.Id
+		if err := o.Update(); err != nil {
+			log.Error("tax: save transaction %s of order %s: %v", tx.Id, o.Id(), err, ctx)
+		}
+
+	case o.TaxTransactionId != "" && e.Changed("refunded"):
+		before, _ := e.Before["refunded"].(float64)
+		amount := o.taxShare(o.Refunded) - o.taxShare(currency.Cents(before))
+		if amount <= 0 {
+			break
+		}
+		if err := tax.Refund(ctx, o.TaxProvider, o.TaxTransactionId, amount); err != nil {
+			log.Error("tax: refund %d of order %s with %s: %v", amount, o.Id(), o.TaxProvider, err, ctx)
+		}
+
+	case o.TaxTransactionId != "" && e.Changed("status") && o.Status == Cancelled && o.Refunded == 0:
+		if err := tax.Void(ctx, o.TaxProvider, o.TaxTransactionId); err != nil {
+			log.Error("tax: void order %s with %s: %v", o.Id(), o.TaxProvider, err, ctx)
+		}
+	}
+	return e.Next()
+}
+
+// taxShare is the tax in refunded, in proportion to the total. It is taken
+// of the running total refunded rather than of each refund, so that the
+// shares of partial refunds round to exactly the tax once all is refunded.
+func (o *Order) taxShare(refunded currency.Cents) currency.Cents {
+	if o.Total <= 0 || refunded <= 0 {
+		return 0
+	}
+	if refunded >= o.Total {
+		return o.Tax
+	}
+	return currency.Cents((int64(refunded)*int64(o.Tax) + int64(o.Total)/2) / int64(o.Total))
+}
@@ -0,0 +1,62 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/coupon"
+	"github.com/hanzoai/commerce/models/promotion/engine"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// Each line is taxed less what an item coupon and an item promotion took off
+// it; order-wide discounts stay in the base, as in the tally.
+func TestTaxRequestDiscounts(t *testing.T) {
+	shirt := item(1000, 2)
+	shirt.ProductId = "shirt"
+	mug := item(500, 1)
+	mug.ProductId = "mug"
+
+	o := testOrder(shirt, mug)
+	o.Coupons = []coupon.Coupon{
+		{Type: coupon.Flat, Amount: 100, Enabled: true, ProductId: "shirt"},
+		pctCoupon(10),
+	}
+	o.Promotions = []engine.Adjustment{
+		{Target: applicationmethod.TargetItems, ItemId: "mug", Amount: 50},
+		{Target: applicationmethod.TargetShipping, Amount: 300},
+	}
+	o.Shipping = 700
+	o.ShippingAddress.Country = "US"
+	o.ShippingAddress.State = "NY"
+
+	req := o.TaxRequest()
+	if len(req.Lines) != 2 || req.Shipping != 700 || req.Address.Province != "NY" {
+		t.Fatalf("request = %+v", req)
+	}
+	for i, want := range []currency.Cents{200, 50} {
+		if got := req.Lines[i].Discount; got != want {
+			t.Errorf("line %s discount = %d, want %d", req.Lines[i].Id, got, want)
+		}
+	}
+}
+
+// The tax refunded across partial refunds adds up to the tax once the whole
+// order is refunded, whatever each share rounded to.
+func TestTaxShare(t *testing.T) {
+	o := testOrder()
+	o.Total = 1000
+	o.Tax = 77
+
+	var refunded, taxRefunded currency.Cents
+	for _, r := range []currency.Cents{333, 333, 334} {
+		taxRefunded += o.taxShare(refunded+r) - o.taxShare(refunded)
+		refunded += r
+	}
+	if taxRefunded != o.Tax {
+		t.Fatalf("refunded %d of tax %d", taxRefunded, o.Tax)
+	}
+	if got := o.taxShare(500); got != 39 {
+		t.Fatalf("half refunded: tax share %d, want 39", got)
+	}
+}
@@ -0,0 +1,59 @@
+package organization
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/types/integration"
+)
+
+// Updating an org's integrations records what changed, never a credential:
+// neither the org's own signing key nor an integration's tokens reach the
+// diff an audit entry is made from.
+func TestAudit_IntegrationUpdateRecordsNoSecrets(t *testing.T) {
+	stripe := func(token string) integration.Integration {
+		in := integration.Integration{Type: integration.StripeType, Id: "in_1", Enabled: true}
+		in.Stripe.AccessToken = token
+		in.Stripe.Live.AccessToken = token
+		in.Stripe.Live.RefreshToken = "rt_" + token
+		if err := integration.Encode(&in, &in); err != nil {
+			t.Fatal(err)
+		}
+		return in
+	}
+
+	org := func(key, token string) *Organization {
+		o := &Organization{Name: "acme"}
+		o.SecretKey = []byte(key)
+		o.Integrations = integration.Integrations{stripe(token)}
+		return o
+	}
+	before, after := org("org-signing-key-old", "sk_live_old"), org("org-signing-key-new", "sk_live_new")
+
+	diffs := map[string][]hooks.FieldChange{
+		"organization": hooks.Diff(hooks.Snapshot(before), hooks.Snapshot(after)),
+		"integration":  hooks.Diff(hooks.Snapshot(&before.Integrations[0]), hooks.Snapshot(&after.Integrations[0])),
+	}
+	for what, diff := range diffs {
+		data, err := json.Marshal(diff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{
+			"sk_live_old", "sk_live_new",
+			base64.StdEncoding.EncodeToString(before.SecretKey),
+			base64.StdEncoding.EncodeToString(after.SecretKey),
+		} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s diff %s carries %q", what, data, secret)
+			}
+		}
+		// The rotation itself is still on record.
+		if len(diff) == 0 {
+			t.Errorf("%s diff is empty, want the rotated credential marked changed", what)
+		}
+	}
+}
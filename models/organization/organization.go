@@ -20,6 +20,7 @@ import (
 	"github.com/hanzoai/commerce/models/types/pricing"
 	"github.com/hanzoai/commerce/models/user"
 	"github.com/hanzoai/commerce/models/wallet"
+	"github.com/hanzoai/commerce/payment/router"
 	"github.com/hanzoai/commerce/types/email"
 	"github.com/hanzoai/commerce/types/integration"
 	"github.com/hanzoai/commerce/types/socialmedia"
@@ -129,6 +130,12 @@ type Organization struct {
 	Integrations  integration.Integrations `json:"-" datastore:"-"`
 	Integrations_ string                   `json:"-" datastore:",noindex"`
 
+	// Payment routing: the rules and fall-through strategy payment.RouterForOrg
+	// builds this org's router from. Validated when set and again when loaded
+	// into a router; see router.Config.Validate.
+	PaymentRouting  router.Settings `json:"paymentRouting" datastore:"-"`
+	PaymentRouting_ string          `json:"-" datastore:",noindex"`
+
 	// integration (deprecated)
 
 	// Analytics config
@@ -169,6 +176,9 @@ type Organization struct {
 	// Shipwire settings
 	Shipwire integration.Shipwire `json:"-"`
 
+	// ShipStation settings
+	ShipStation integration.ShipStation `json:"-"`
+
 	// Square connection
 	Square integration.Square `json:"-"`
 
@@ -207,6 +217,12 @@ func (o *Organization) Load(ps []datastore.Property) (err error) {
 		return err
 	}
 
+	if len(o.PaymentRouting_) > 0 {
+		if err = json.DecodeBytes([]byte(o.PaymentRouting_), &o.PaymentRouting); err != nil {
+			return err
+		}
+	}
+
 	if len(o.Integrations_) > 0 {
 		err = json.DecodeBytes([]byte(o.Integrations_), &o.Integrations)
 	}
@@ -225,6 +241,7 @@ func (o *Organization) Load(ps []datastore.Property) (err error) {
 func (o *Organization) Save() (ps []datastore.Property, err error) {
 	// Serialize unsupported properties
 	o.Integrations_ = string(json.EncodeBytes(o.Integrations))
+	o.PaymentRouting_ = string(json.EncodeBytes(o.PaymentRouting))
 
 	// Save properties
 	return datastore.SaveStruct(o)
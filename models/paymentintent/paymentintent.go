@@ -7,6 +7,7 @@ import (
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
 	"github.com/hanzoai/orm"
 )
 
@@ -48,10 +49,16 @@ type PaymentIntent struct {
 	CanceledAt         time.Time              `json:"canceledAt,omitempty"`
 	CancellationReason string                 `json:"cancellationReason,omitempty"`
 	LastError          string                 `json:"lastError,omitempty"`
-	ClientSecret       string                 `json:"clientSecret,omitempty"`
+	ClientSecret       string                 `json:"clientSecret,omitempty" audit:"redact"`
 	InvoiceId          string                 `json:"invoiceId,omitempty"`
 	SetupFutureUsage   string                 `json:"setupFutureUsage,omitempty"`
 	Metadata           map[string]interface{} `json:"metadata,omitempty"`
+
+	// ReturnUrl is where the customer comes back to from a 3-D Secure
+	// redirect. NextAction is the challenge they must complete while the
+	// intent is RequiresAction; it is cleared when the intent leaves it.
+	ReturnUrl  string                `json:"returnUrl,omitempty"`
+	NextAction *processor.NextAction `json:"nextAction,omitempty"`
 }
 
 // Confirm transitions the intent from RequiresConfirmation to Processing.
@@ -66,12 +73,40 @@ func (pi *PaymentIntent) Confirm() error {
 	return nil
 }
 
+// MarkRequiresAction parks a processing intent on the challenge the processor
+// issued. providerRef is the processor's id for the pending payment, the one
+// it resumes by.
+func (pi *PaymentIntent) MarkRequiresAction(providerRef string, action *processor.NextAction) {
+	pi.Status = RequiresAction
+	pi.ProviderRef = providerRef
+	pi.NextAction = action
+}
+
+// Resume transitions from RequiresAction to Processing once the customer has
+// completed the challenge.
+func (pi *PaymentIntent) Resume() error {
+	if pi.Status != RequiresAction {
+		return fmt.Errorf("cannot resume payment intent in status %s", pi.Status)
+	}
+	pi.Status = Processing
+	return nil
+}
+
+// MarkFailed returns the intent to RequiresPaymentMethod after a decline or a
+// failed challenge, so the customer can try again with another method.
+func (pi *PaymentIntent) MarkFailed(reason string) {
+	pi.Status = RequiresPaymentMethod
+	pi.LastError = reason
+	pi.NextAction = nil
+}
+
 // MarkSucceeded marks the intent as succeeded after a charge completes.
 func (pi *PaymentIntent) MarkSucceeded(providerRef string, amountReceived int64) {
 	pi.Status = Succeeded
 	pi.ProviderRef = providerRef
 	pi.AmountReceived = amountReceived
 	pi.AmountCapturable = 0
+	pi.NextAction = nil
 }
 
 // MarkRequiresCapture marks the intent as authorized but not yet captured.
@@ -79,6 +114,7 @@ func (pi *PaymentIntent) MarkRequiresCapture(providerRef string) {
 	pi.Status = RequiresCapture
 	pi.ProviderRef = providerRef
 	pi.AmountCapturable = pi.Amount
+	pi.NextAction = nil
 }
 
 // Capture transitions from RequiresCapture to Succeeded.
@@ -103,6 +139,7 @@ func (pi *PaymentIntent) Cancel(reason string) error {
 	pi.Status = Canceled
 	pi.CancellationReason = reason
 	pi.CanceledAt = time.Now()
+	pi.NextAction = nil
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/payment/processor"
 )
 
 func testDB() *datastore.Datastore {
@@ -370,6 +371,59 @@ func TestFullLifecycle_ConfirmThenCancel(t *testing.T) {
 	}
 }
 
+func TestFullLifecycle_ChallengeThenSucceed(t *testing.T) {
+	pi := &PaymentIntent{
+		Status:          RequiresConfirmation,
+		PaymentMethodId: "pm_3ds",
+		Amount:          4200,
+	}
+	if err := pi.Confirm(); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	action := &processor.NextAction{Type: processor.NextActionRedirect, RedirectURL: "https://acs.example/challenge"}
+	pi.MarkRequiresAction("pi_pending", action)
+	if pi.Status != RequiresAction || pi.NextAction != action || pi.ProviderRef != "pi_pending" {
+		t.Fatalf("after challenge: %+v", pi)
+	}
+	if err := pi.Confirm(); err == nil {
+		t.Fatal("an intent awaiting its challenge was confirmed again")
+	}
+	if err := pi.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	pi.MarkSucceeded("ch_3ds", 4200)
+	if pi.Status != Succeeded || pi.NextAction != nil {
+		t.Errorf("expected Succeeded with no next action, got %s %+v", pi.Status, pi.NextAction)
+	}
+}
+
+func TestFullLifecycle_ChallengeFailed(t *testing.T) {
+	pi := &PaymentIntent{
+		Status:          RequiresAction,
+		PaymentMethodId: "pm_3ds",
+		NextAction:      &processor.NextAction{Type: processor.NextActionSDK},
+	}
+	if err := pi.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	pi.MarkFailed("authentication failed")
+	if pi.Status != RequiresPaymentMethod || pi.LastError != "authentication failed" || pi.NextAction != nil {
+		t.Errorf("after failure: %+v", pi)
+	}
+	if err := pi.Confirm(); err != nil {
+		t.Errorf("retry with another method: %v", err)
+	}
+}
+
+func TestResume_InvalidStatus(t *testing.T) {
+	for _, st := range []Status{RequiresConfirmation, Processing, Succeeded, Canceled} {
+		pi := &PaymentIntent{Status: st}
+		if err := pi.Resume(); err == nil {
+			t.Errorf("resumed from %s", st)
+		}
+	}
+}
+
 // --- Kind ---
 
 func TestKind(t *testing.T) {
@@ -98,6 +98,26 @@ type Product struct {
 	Options  []*Option `json:"options" datastore:"-"`
 	Options_ string    `json:"-" datastore:",noindex"`
 
+	// Taxonomy the product is filed under: product-category, product-tag and
+	// product-type ids
+	CategoryIds []string `json:"categoryIds" orm:"default:[]"`
+	TagIds      []string `json:"tagIds" orm:"default:[]"`
+	TypeId      string   `json:"typeId,omitempty"`
+
+	// Sales channels the product is sold through. None means all of them.
+	SalesChannelIds []string `json:"salesChannelIds" orm:"default:[]"`
+
+	// Units ordered, counted as orders are placed
+	Sold int `json:"sold"`
+
+	// Tax classification, as clothing or a digital good. A tax rate with the
+	// same code taxes the product instead of its region's default rate.
+	TaxCode string `json:"taxCode,omitempty"`
+
+	// Shipping profile the product ships under, which decides the shipping
+	// options offered for it. None is the store's default profile.
+	ShippingProfileId string `json:"shippingProfileId,omitempty"`
+
 	Reservation Reservation `json:"reservation"`
 
 	// Arbitrary key/value pairs associated with this order
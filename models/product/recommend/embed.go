@@ -0,0 +1,105 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/hanzoai/commerce/models/product"
+)
+
+// ErrNothingToEmbed is returned for a product with no text to embed.
+var ErrNothingToEmbed = errors.New("recommend: nothing to embed")
+
+// Embedder turns text into a vector. Vectors of similar text are near each
+// other by cosine, and every vector an Embedder returns has the length of the
+// store's vector column.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// EmbedderFunc is an Embedder in a func, for a local model.
+type EmbedderFunc func(ctx context.Context, text string) ([]float32, error)
+
+func (f EmbedderFunc) Embed(ctx context.Context, text string) ([]float32, error) {
+	return f(ctx, text)
+}
+
+// HashingEmbedder embeds text with no model at all, by feature hashing: each
+// word and each three-letter piece of a word adds to one of Dimensions
+// buckets, with a sign from the same hash so that collisions cancel rather
+// than pile up. Text sharing words and word stems lands near each other,
+// which is the whole of "similar" it knows. It is deterministic, so tests
+// can rely on its neighbours, and it is the default until a real model is
+// plugged in.
+type HashingEmbedder struct {
+	Dimensions int
+}
+
+// Words count double their pieces: a shared word says more than a shared
+// stem.
+const (
+	wordWeight  = 1.0
+	pieceWeight = 0.5
+)
+
+func (h HashingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if h.Dimensions <= 0 {
+		return nil, errors.New("recommend: HashingEmbedder needs Dimensions")
+	}
+	v := make([]float64, h.Dimensions)
+	add := func(feature string, weight float64) {
+		f := fnv.New64a()
+		f.Write([]byte(feature))
+		sum := f.Sum64()
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		v[sum%uint64(h.Dimensions)] += weight
+	}
+	for _, w := range words(text) {
+		add(w, wordWeight)
+		r := []rune("^" + w + "$")
+		for i := 0; i+3 <= len(r); i++ {
+			add(string(r[i:i+3]), pieceWeight)
+		}
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil, ErrNothingToEmbed
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x / norm)
+	}
+	return out, nil
+}
+
+// words is the lowercase runs of letters and digits in s.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textOf is what of p is embedded: what a shopper reads about it. The name
+// is what says most about what a product is, so it is in twice.
+func textOf(p *product.Product) string {
+	parts := []string{p.Name, p.Name, p.Headline, p.Excerpt, p.Description}
+	for _, o := range p.Options {
+		parts = append(parts, o.Values...)
+	}
+	return strings.Join(parts, " ")
+}
+
+// embedFields are the product fields, by JSON name, textOf reads. A product
+// is embedded again only when one of them changed.
+var embedFields = []string{"name", "headline", "excerpt", "description", "options"}
@@ -0,0 +1,68 @@
+package recommend
+
+import (
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/payment"
+	"github.com/hanzoai/commerce/models/product"
+)
+
+// Install keeps r current through the registry's model hooks: a product is
+// embedded when it is created and when the text it is embedded from
+// changes, and an order is counted into what was bought together once it is
+// bought — paid or completed — and not when it is only placed, so a basket
+// abandoned at checkout counts for nothing. Deleting a product leaves its
+// vector behind; the handlers skip products that are gone. A failure is
+// logged and does not fail the write.
+func (r *Recommender) Install(reg *hooks.Registry) {
+	reg.OnModelAfterCreate("product").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "recommend", Func: r.productWritten})
+	reg.OnModelAfterUpdate("product").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "recommend", Func: r.productWritten})
+
+	reg.OnModelAfterCreate("order").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "recommend", Func: r.orderWritten})
+	reg.OnModelAfterUpdate("order").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "recommend", Func: r.orderWritten})
+}
+
+func (r *Recommender) productWritten(e *hooks.ModelEvent) error {
+	p, ok := e.Model.(*product.Product)
+	if !ok || e.Context == nil || (e.Before != nil && !e.Changed(embedFields...)) {
+		return e.Next()
+	}
+	if err := r.Embed(e.Context, p); err != nil {
+		log.Error("recommend: embed product %s: %v", p.Id(), err, e.Context)
+	}
+	return e.Next()
+}
+
+// orderWritten counts an order the write that made it bought, and only that
+// one: an order saved again once paid is not counted twice.
+func (r *Recommender) orderWritten(e *hooks.ModelEvent) error {
+	if e.Context == nil || !boughtSnapshot(e.After) || boughtSnapshot(e.Before) {
+		return e.Next()
+	}
+	items, _ := e.After["items"].([]interface{})
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		item, _ := it.(map[string]interface{})
+		if id, _ := item["productId"].(string); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err := r.RecordOrder(e.Context, ids); err != nil {
+		log.Error("recommend: count order %v: %v", e.After["id"], err, e.Context)
+	}
+	return e.Next()
+}
+
+// boughtSnapshot is bought for an order's snapshot; false for none.
+func boughtSnapshot(snap map[string]interface{}) bool {
+	status, _ := snap["status"].(string)
+	paymentStatus, _ := snap["paymentStatus"].(string)
+	return bought(order.Status(status), payment.Status(paymentStatus))
+}
+
+// bought reports whether an order in status, with paymentStatus, is one the
+// customer bought: it was paid for, or fulfilled without a payment of ours.
+func bought(status order.Status, paymentStatus payment.Status) bool {
+	return paymentStatus == payment.Paid || status == order.Completed
+}
@@ -0,0 +1,563 @@
+// Package recommend recommends products three ways: products like one
+// product, by the nearness of their embeddings in the org's vector store;
+// products bought with one product, by how often they shared an order; and
+// products for one customer, blending the two over what the customer has
+// bought before.
+//
+// Products are embedded as they are written, and orders counted as they are
+// bought (see Install); RecountOrders counts the orders bought before. The embedding function is pluggable; the default,
+// HashingEmbedder, needs no model and runs anywhere, and a local model goes in
+// through EmbedderFunc. Vectors of one Embedder are not comparable with
+// another's, so changing it means embedding every product again (Reindex).
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// Reasons a product is recommended.
+const (
+	Similar        = "similar"
+	BoughtTogether = "bought-together"
+	ForYou         = "for-you"
+	Popular        = "popular"
+)
+
+const (
+	// vectorKind is the kind product embeddings are stored under.
+	vectorKind = "product"
+
+	// maxBasket is how many distinct products of one order are counted as
+	// bought together. A basket bigger than that is a restock or a wholesale
+	// order, which says little about what goes with what.
+	maxBasket = 20
+
+	// historyOrders and historyProducts bound how far back ForCustomer looks:
+	// a customer's last orders, and the products most recently bought in
+	// them.
+	historyOrders   = 50
+	historyProducts = 20
+
+	// DefaultLimit is how many recommendations a query returns when it does
+	// not say.
+	DefaultLimit = 10
+	MaxLimit     = 50
+
+	// DefaultBlend is the weight ForCustomer gives similarity against
+	// co-purchase.
+	DefaultBlend = 0.5
+)
+
+var (
+	// ErrNoStore is returned when the context's namespace has no store.
+	ErrNoStore = errors.New("recommend: no store for this namespace")
+
+	// ErrNoSQL is returned when the store cannot keep co-purchase counts.
+	ErrNoSQL = errors.New("recommend: store has no SQL access")
+)
+
+// VectorStore is the part of db.DB a Recommender needs for embeddings. The
+// co-purchase counts also need it to be a db.SQLStore.
+type VectorStore interface {
+	PutVector(ctx context.Context, kind string, id string, vector []float32, metadata map[string]interface{}) error
+	VectorSearch(ctx context.Context, opts *db.VectorSearchOptions) ([]db.VectorResult, error)
+}
+
+// Recommendation is a product recommended, how strongly, from 0 to 1, and
+// why.
+type Recommendation struct {
+	ProductId string  `json:"productId"`
+	Score     float64 `json:"score"`
+	Reason    string  `json:"reason"`
+}
+
+// Recommender embeds products into, and recommends from, the store of each
+// call's namespace.
+type Recommender struct {
+	Embedder Embedder
+
+	// Store returns the store of ctx's org, or nil when it has none.
+	Store func(ctx context.Context) VectorStore
+
+	// Blend is the weight ForCustomer gives similarity, from 0 to 1; the
+	// rest goes to co-purchase.
+	Blend float64
+
+	mu       sync.Mutex
+	migrated map[string]bool
+}
+
+// New returns a Recommender over each org's own store, as
+// datastore.NewNamespaced resolves it, embedding with e.
+func New(e Embedder) *Recommender {
+	return &Recommender{
+		Embedder: e,
+		Store: func(ctx context.Context) VectorStore {
+			if d := datastore.NewNamespaced(ctx).DB(); d != nil {
+				return d
+			}
+			return nil
+		},
+		Blend:    DefaultBlend,
+		migrated: make(map[string]bool),
+	}
+}
+
+var (
+	defaultRecommender *Recommender
+	defaultMu          sync.RWMutex
+)
+
+// SetDefault sets the Recommender the hooks and handlers use.
+func SetDefault(r *Recommender) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultRecommender = r
+}
+
+// Default returns the Recommender set by SetDefault, or nil.
+func Default() *Recommender {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRecommender
+}
+
+func (r *Recommender) store(ctx context.Context) (VectorStore, error) {
+	s := r.Store(ctx)
+	if s == nil {
+		return nil, ErrNoStore
+	}
+	return s, nil
+}
+
+// Embed stores p's embedding, replacing the last. A product with no text has
+// none, and is left as it was.
+func (r *Recommender) Embed(ctx context.Context, p *product.Product) error {
+	s, err := r.store(ctx)
+	if err != nil {
+		return err
+	}
+	v, err := r.Embedder.Embed(ctx, textOf(p))
+	if errors.Is(err, ErrNothingToEmbed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.PutVector(ctx, vectorKind, p.Id(), v, map[string]interface{}{"name": p.Name})
+}
+
+// Reindex embeds every product in db's org again and returns how many
+// products it went through.
+func (r *Recommender) Reindex(db *datastore.Datastore) (int, error) {
+	const batch = 500
+	n := 0
+	for offset := 0; ; offset += batch {
+		var ps []*product.Product
+		if _, err := product.Query(db).Order("CreatedAt").Offset(offset).Limit(batch).GetAll(&ps); err != nil {
+			return n, err
+		}
+		for _, p := range ps {
+			if err := r.Embed(db.Context, p); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(ps) < batch {
+			return n, nil
+		}
+	}
+}
+
+// Similar is the products nearest productId by embedding, nearest first.
+func (r *Recommender) Similar(ctx context.Context, productId string, limit int) ([]Recommendation, error) {
+	limit = clampLimit(limit)
+	p := product.New(datastore.New(ctx))
+	if err := p.GetById(productId); err != nil {
+		return nil, err
+	}
+	v, err := r.Embedder.Embed(ctx, textOf(p))
+	if errors.Is(err, ErrNothingToEmbed) {
+		return []Recommendation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	near, err := r.nearest(ctx, v, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Recommendation, 0, limit)
+	for _, n := range near {
+		if n.ProductId != productId && len(out) < limit {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// nearest is the limit products nearest v.
+func (r *Recommender) nearest(ctx context.Context, v []float32, limit int) ([]Recommendation, error) {
+	s, err := r.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.VectorSearch(ctx, &db.VectorSearchOptions{Kind: vectorKind, Vector: v, Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("recommend: vector search: %w", err)
+	}
+	out := make([]Recommendation, 0, len(results))
+	for _, res := range results {
+		out = append(out, Recommendation{ProductId: res.ID, Score: float64(res.Score), Reason: Similar})
+	}
+	return out, nil
+}
+
+// BoughtTogether is the products most often in the same order as productId,
+// scored by the share of productId's orders they were in.
+func (r *Recommender) BoughtTogether(ctx context.Context, productId string, limit int) ([]Recommendation, error) {
+	limit = clampLimit(limit)
+	s, err := r.sql(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Recommendation, 0, limit)
+	err = s.ReadSQL(ctx, func(h *sql.DB) error {
+		rows, err := h.QueryContext(ctx, s.bind(`
+			SELECT p.b, p.n, o.n FROM recommend_pairs p
+			JOIN recommend_pairs o ON o.ns = p.ns AND o.a = p.a AND o.b = p.a
+			WHERE p.ns = ? AND p.a = ? AND p.b <> p.a
+			ORDER BY p.n DESC, p.b LIMIT ?`), s.ns, productId, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			var together, orders int64
+			if err := rows.Scan(&id, &together, &orders); err != nil {
+				return err
+			}
+			out = append(out, Recommendation{ProductId: id, Score: float64(together) / float64(max(orders, 1)), Reason: BoughtTogether})
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ForCustomer is the products to show userId: those near what they have
+// bought, by the centroid of its embeddings, and those bought with it,
+// blended by Blend, leaving out what they have bought. A customer who has
+// bought nothing is shown the best sellers. If vector search fails the
+// blend is co-purchase alone, so a store without it still recommends.
+func (r *Recommender) ForCustomer(ctx context.Context, userId string, limit int) ([]Recommendation, error) {
+	limit = clampLimit(limit)
+	ds := datastore.New(ctx)
+
+	var orders []*order.Order
+	if _, err := order.Query(ds).Filter("UserId=", userId).Order("-CreatedAt").Limit(historyOrders).GetAll(&orders); err != nil {
+		return nil, err
+	}
+	var bought []string
+	for _, o := range orders {
+		for _, it := range o.Items {
+			if it.ProductId != "" && !contains(bought, it.ProductId) && len(bought) < historyProducts {
+				bought = append(bought, it.ProductId)
+			}
+		}
+	}
+	if len(bought) == 0 {
+		return r.popular(ds, limit)
+	}
+
+	type blend struct{ similar, together float64 }
+	scores := make(map[string]*blend)
+	score := func(id string) *blend {
+		if scores[id] == nil {
+			scores[id] = &blend{}
+		}
+		return scores[id]
+	}
+
+	if centroid, err := r.centroid(ds, bought); err != nil {
+		log.Error("recommend: centroid for user %s: %v", userId, err, ctx)
+	} else if centroid != nil {
+		near, err := r.nearest(ctx, centroid, limit+len(bought))
+		if err != nil {
+			log.Error("recommend: similar for user %s: %v", userId, err, ctx)
+		}
+		for _, n := range near {
+			score(n.ProductId).similar = n.Score
+		}
+	}
+
+	var most float64
+	for _, id := range bought {
+		together, err := r.BoughtTogether(ctx, id, MaxLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range together {
+			b := score(t.ProductId)
+			b.together += t.Score
+			most = max(most, b.together)
+		}
+	}
+
+	out := make([]Recommendation, 0, len(scores))
+	for id, b := range scores {
+		if contains(bought, id) {
+			continue
+		}
+		together := 0.0
+		if most > 0 {
+			together = b.together / most
+		}
+		out = append(out, Recommendation{ProductId: id, Score: r.Blend*b.similar + (1-r.Blend)*together, Reason: ForYou})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ProductId < out[j].ProductId
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// centroid is the normalised mean of the embeddings of the products ids, or
+// nil when none of them has one.
+func (r *Recommender) centroid(ds *datastore.Datastore, ids []string) ([]float32, error) {
+	var sum []float64
+	for _, id := range ids {
+		p := product.New(ds)
+		if err := p.GetById(id); err != nil {
+			continue
+		}
+		v, err := r.Embedder.Embed(ds.Context, textOf(p))
+		if errors.Is(err, ErrNothingToEmbed) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sum == nil {
+			sum = make([]float64, len(v))
+		}
+		for i := range v {
+			sum[i] += float64(v[i])
+		}
+	}
+	return normalize(sum), nil
+}
+
+// popular is the best sellers, scored against the best of them.
+func (r *Recommender) popular(ds *datastore.Datastore, limit int) ([]Recommendation, error) {
+	var ps []*product.Product
+	if _, err := product.Query(ds).Order("-Sold").Limit(limit).GetAll(&ps); err != nil {
+		return nil, err
+	}
+	out := make([]Recommendation, 0, len(ps))
+	for _, p := range ps {
+		score := 0.0
+		if ps[0].Sold > 0 {
+			score = float64(p.Sold) / float64(ps[0].Sold)
+		}
+		out = append(out, Recommendation{ProductId: p.Id(), Score: score, Reason: Popular})
+	}
+	return out, nil
+}
+
+// RecordOrder counts the products of one order as bought together: each
+// pair once, both ways round, and each product once with itself, which is
+// how many orders it was in.
+func (r *Recommender) RecordOrder(ctx context.Context, productIds []string) error {
+	var basket []string
+	for _, id := range productIds {
+		if id != "" && !contains(basket, id) {
+			basket = append(basket, id)
+		}
+	}
+	if len(basket) == 0 || len(basket) > maxBasket {
+		return nil
+	}
+	s, err := r.sql(ctx)
+	if err != nil {
+		return err
+	}
+	return s.WriteSQL(ctx, func(tx *sql.Tx) error {
+		for _, a := range basket {
+			for _, b := range basket {
+				if _, err := tx.ExecContext(ctx, s.bind(`
+					INSERT INTO recommend_pairs (ns, a, b, n) VALUES (?, ?, ?, 1)
+					ON CONFLICT (ns, a, b) DO UPDATE SET n = recommend_pairs.n + 1`), s.ns, a, b); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// RecountOrders counts every order bought in db's org again, in place of the
+// counts it has, and returns how many orders it counted: for an org whose
+// orders were bought before the counts were kept, or counts that fell
+// behind. An order bought while it runs may be counted twice; the counts
+// rank products, they are not a ledger.
+func (r *Recommender) RecountOrders(db *datastore.Datastore) (int, error) {
+	s, err := r.sql(db.Context)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.WriteSQL(db.Context, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(db.Context, s.bind(`DELETE FROM recommend_pairs WHERE ns = ?`), s.ns)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	const batch = 500
+	n := 0
+	for offset := 0; ; offset += batch {
+		var orders []*order.Order
+		if _, err := order.Query(db).Order("CreatedAt").Offset(offset).Limit(batch).GetAll(&orders); err != nil {
+			return n, err
+		}
+		for _, o := range orders {
+			if !bought(o.Status, o.PaymentStatus) {
+				continue
+			}
+			ids := make([]string, 0, len(o.Items))
+			for _, it := range o.Items {
+				ids = append(ids, it.ProductId)
+			}
+			if err := r.RecordOrder(db.Context, ids); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(orders) < batch {
+			return n, nil
+		}
+	}
+}
+
+// sqlStore is a namespace's SQL store, the co-purchase table in place.
+type sqlStore struct {
+	db.SQLStore
+	postgres bool
+	ns       string
+}
+
+// recommendSchema is the co-purchase counts: n is how many orders held both
+// a and b, and a row with a = b is how many held a.
+const recommendSchema = `CREATE TABLE IF NOT EXISTS recommend_pairs (
+	ns  TEXT   NOT NULL,
+	a   TEXT   NOT NULL,
+	b   TEXT   NOT NULL,
+	n   BIGINT NOT NULL,
+
+	PRIMARY KEY (ns, a, b)
+)`
+
+func (r *Recommender) sql(ctx context.Context) (*sqlStore, error) {
+	vs, err := r.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, ok := vs.(db.SQLStore)
+	if !ok {
+		return nil, ErrNoSQL
+	}
+	s := &sqlStore{
+		SQLStore: store,
+		postgres: store.SQLDialect() == db.DialectPostgres,
+		ns:       nscontext.GetNamespace(ctx),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.migrated == nil {
+		r.migrated = make(map[string]bool)
+	}
+	if !r.migrated[s.ns] {
+		if err := s.WriteSQL(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, recommendSchema)
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("recommend: schema: %w", err)
+		}
+		r.migrated[s.ns] = true
+	}
+	return s, nil
+}
+
+// bind rewrites ? placeholders as $1, $2, ... on Postgres.
+func (s *sqlStore) bind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	return min(limit, MaxLimit)
+}
+
+func normalize(v []float64) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x / norm)
+	}
+	return out
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
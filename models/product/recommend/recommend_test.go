@@ -0,0 +1,176 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+func embed(t *testing.T, e Embedder, text string) []float32 {
+	t.Helper()
+	v, err := e.Embed(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Embed(%q): %v", text, err)
+	}
+	return v
+}
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// The same text embeds the same, to a unit vector, and text sharing words
+// lands nearer than text that does not.
+func TestHashingEmbedder(t *testing.T) {
+	e := HashingEmbedder{Dimensions: 256}
+
+	shoe := embed(t, e, "Trail running shoe, red")
+	if !reflect.DeepEqual(shoe, embed(t, e, "Trail running shoe, red")) {
+		t.Fatal("the same text embedded differently")
+	}
+	if len(shoe) != 256 {
+		t.Fatalf("len = %d, want 256", len(shoe))
+	}
+	if n := cosine(shoe, shoe); math.Abs(n-1) > 1e-6 {
+		t.Fatalf("|v|² = %v, want 1", n)
+	}
+
+	runner := embed(t, e, "Road running shoes")
+	mug := embed(t, e, "Ceramic coffee mug")
+	if cosine(shoe, runner) <= cosine(shoe, mug) {
+		t.Fatalf("shoe~runner %v <= shoe~mug %v", cosine(shoe, runner), cosine(shoe, mug))
+	}
+
+	if _, err := e.Embed(context.Background(), " -- "); !errors.Is(err, ErrNothingToEmbed) {
+		t.Fatalf("blank text: err = %v, want ErrNothingToEmbed", err)
+	}
+	if _, err := (HashingEmbedder{}).Embed(context.Background(), "shoe"); err == nil {
+		t.Fatal("embedded with no dimensions")
+	}
+}
+
+func TestBind(t *testing.T) {
+	s := &sqlStore{postgres: true}
+	if got := s.bind("a = ? AND b = ?"); got != "a = $1 AND b = $2" {
+		t.Fatalf("bind = %q", got)
+	}
+	s.postgres = false
+	if got := s.bind("a = ?"); got != "a = ?" {
+		t.Fatalf("bind on sqlite = %q", got)
+	}
+}
+
+func sqliteStore(t *testing.T) db.DB {
+	t.Helper()
+	sdb, err := db.NewSQLiteDB(&db.SQLiteDBConfig{
+		Path:       filepath.Join(t.TempDir(), "recommend.db"),
+		Config:     db.DefaultConfig().SQLite,
+		TenantID:   "acme",
+		TenantType: "org",
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { sdb.Close() })
+	return sdb
+}
+
+// A product bought with another in two of its three orders scores 2/3, and
+// each namespace counts its own orders.
+func TestBoughtTogether(t *testing.T) {
+	store := sqliteStore(t)
+	r := New(HashingEmbedder{Dimensions: 8})
+	r.Store = func(context.Context) VectorStore { return store }
+
+	ctx := nscontext.WithNamespace(context.Background(), "acme")
+	for _, basket := range [][]string{
+		{"shoe", "sock", "shoe"},
+		{"shoe", "sock", "lace"},
+		{"shoe"},
+		{"sock", "lace"},
+	} {
+		if err := r.RecordOrder(ctx, basket); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := r.BoughtTogether(ctx, "shoe", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Recommendation{
+		{ProductId: "sock", Score: 2.0 / 3, Reason: BoughtTogether},
+		{ProductId: "lace", Score: 1.0 / 3, Reason: BoughtTogether},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("BoughtTogether(shoe) = %+v, want %+v", got, want)
+	}
+
+	other := nscontext.WithNamespace(context.Background(), "globex")
+	if got, err := r.BoughtTogether(other, "shoe", 0); err != nil || len(got) != 0 {
+		t.Fatalf("another namespace saw %+v, %v", got, err)
+	}
+}
+
+func TestRecordOrder_SkipsBulkBaskets(t *testing.T) {
+	r := New(HashingEmbedder{Dimensions: 8})
+	r.Store = func(context.Context) VectorStore { return nil }
+
+	bulk := make([]string, maxBasket+1)
+	for i := range bulk {
+		bulk[i] = string(rune('a' + i))
+	}
+	// Neither basket reaches the store, which would fail with ErrNoStore.
+	for _, basket := range [][]string{bulk, {"", ""}} {
+		if err := r.RecordOrder(context.Background(), basket); err != nil {
+			t.Fatalf("RecordOrder(%d products): %v", len(basket), err)
+		}
+	}
+}
+
+// An order counts once, when the write that pays for it or completes it
+// commits: not when it is placed, and not again when it is saved once paid.
+func TestOrderWritten_CountsBoughtOrdersOnce(t *testing.T) {
+	store := sqliteStore(t)
+	r := New(HashingEmbedder{Dimensions: 8})
+	r.Store = func(context.Context) VectorStore { return store }
+
+	ctx := nscontext.WithNamespace(context.Background(), "acme")
+	snap := func(status, paymentStatus string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":            "ord_1",
+			"status":        status,
+			"paymentStatus": paymentStatus,
+			"items":         []interface{}{map[string]interface{}{"productId": "shoe"}, map[string]interface{}{"productId": "sock"}},
+		}
+	}
+	for _, w := range []struct{ before, after map[string]interface{} }{
+		{nil, snap("open", "unpaid")},                     // placed
+		{snap("open", "unpaid"), snap("open", "paid")},    // paid
+		{snap("open", "paid"), snap("completed", "paid")}, // shipped
+		{nil, snap("cancelled", "unpaid")},                // abandoned elsewhere
+	} {
+		if err := r.orderWritten(&hooks.ModelEvent{Context: ctx, Kind: "order", Before: w.before, After: w.after}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := r.BoughtTogether(ctx, "shoe", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ProductId != "sock" || got[0].Score != 1 {
+		t.Fatalf("BoughtTogether(shoe) = %+v, want sock bought in its one order", got)
+	}
+}
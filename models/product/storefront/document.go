@@ -0,0 +1,286 @@
+// Package storefront is the product catalog as a storefront browses it: an
+// index of the products a shopper may see, searchable by keyword with typo
+// tolerance and faceted by category, collection, tag, type, option value,
+// price and stock, kept in its own search index beside the admin one.
+//
+// A product is indexed as a Document, built from the product and what it
+// hangs off — its taxonomy, the collections listing it, the stock its
+// variants can promise. Install keeps the index current as those are written;
+// Reindex rebuilds it.
+//
+// Sales channels scope it. A product sold through no channel in particular is
+// sold through all of them; a search made with a publishable key sees the
+// products of the key's channels and those.
+package storefront
+
+import (
+	"sort"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/collection"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/productcategory"
+	"github.com/hanzoai/commerce/models/producttag"
+	"github.com/hanzoai/commerce/models/producttype"
+)
+
+// Index is the search index the storefront's products are kept in.
+const Index = "storefront-products"
+
+// AllChannels is the sales channel facet value of a product sold through
+// every channel.
+const AllChannels = "*"
+
+// Document is a product as the storefront index holds it. Price, CreatedAt
+// and Sold are what results sort on, so they are top-level JSON numbers;
+// the rest is text to match and facets to refine on.
+type Document struct {
+	Id_         string `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	SKU         string `json:"sku,omitempty"`
+	Headline    string `json:"headline,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Price is the lowest of the product's prices, in the currency's
+	// smallest unit.
+	Price     float64 `json:"price"`
+	Currency  string  `json:"currency"`
+	CreatedAt float64 `json:"createdAt"`
+	Sold      float64 `json:"sold"`
+
+	// Names of what the ids below refer to, so "boots" finds the products
+	// in Boots.
+	Labels []string `json:"labels,omitempty"`
+
+	Categories    []string `json:"categories,omitempty"`
+	Collections   []string `json:"collections,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Type          string   `json:"type,omitempty"`
+	Options       []string `json:"options,omitempty"`
+	InStock       bool     `json:"inStock"`
+	SalesChannels []string `json:"salesChannels"`
+}
+
+func (d *Document) Id() string { return d.Id_ }
+
+// Save lays the document out for the index. Facets with several values are
+// a facet row per value, which the struct-tag codec the models' documents
+// use has no way to say.
+func (d *Document) Save() ([]mixin.SearchField, *mixin.SearchDocumentMetadata, error) {
+	fields := []mixin.SearchField{
+		{Name: "Name", Value: d.Name},
+		{Name: "Slug", Value: d.Slug},
+		{Name: "SKU", Value: d.SKU},
+		{Name: "Headline", Value: d.Headline},
+		{Name: "Description", Value: d.Description},
+	}
+	for _, l := range d.Labels {
+		fields = append(fields, mixin.SearchField{Name: "Label", Value: l})
+	}
+
+	meta := &mixin.SearchDocumentMetadata{Facets: []mixin.SearchFacet{
+		{Name: "price", Value: d.Price},
+		{Name: "inStock", Value: d.InStock},
+	}}
+	add := func(name string, values []string) {
+		for _, v := range values {
+			meta.Facets = append(meta.Facets, mixin.SearchFacet{Name: name, Value: v})
+		}
+	}
+	add("category", d.Categories)
+	add("collection", d.Collections)
+	add("tag", d.Tags)
+	if d.Type != "" {
+		add("type", []string{d.Type})
+	}
+	add("option", d.Options)
+	add("salesChannel", d.SalesChannels)
+	return fields, meta, nil
+}
+
+// OptionValue is how an option value is faceted: "Size:M".
+func OptionValue(name, value string) string {
+	return name + ":" + value
+}
+
+// builder makes Documents in one org, remembering the taxonomy and
+// collections it has loaded so a reindex loads each once.
+type builder struct {
+	db *datastore.Datastore
+
+	collections []*collection.Collection
+	loaded      bool
+
+	categories map[string]*productcategory.ProductCategory
+}
+
+func newBuilder(db *datastore.Datastore) *builder {
+	return &builder{
+		db:         db,
+		categories: make(map[string]*productcategory.ProductCategory),
+	}
+}
+
+// document is p as the storefront sees it, or nil when it is not to be seen.
+func (b *builder) document(p *product.Product) (*Document, error) {
+	if p.Hidden {
+		return nil, nil
+	}
+	d := &Document{
+		Id_:         p.Id(),
+		Name:        p.Name,
+		Slug:        p.Slug,
+		SKU:         p.SKU,
+		Headline:    p.Headline,
+		Description: p.Description,
+		Price:       float64(p.Price),
+		Currency:    string(p.Currency),
+		CreatedAt:   float64(p.CreatedAt.Unix()),
+		Sold:        float64(p.Sold),
+		Tags:        p.TagIds,
+		Type:        p.TypeId,
+	}
+	for i, v := range p.Variants {
+		if i == 0 || float64(v.Price) < d.Price {
+			d.Price = float64(v.Price)
+		}
+	}
+
+	for _, id := range p.CategoryIds {
+		b.addCategory(d, id)
+	}
+	for _, id := range p.TagIds {
+		if t := producttag.New(b.db); t.GetById(id) == nil {
+			d.Labels = append(d.Labels, t.Value)
+		}
+	}
+	if p.TypeId != "" {
+		if t := producttype.New(b.db); t.GetById(p.TypeId) == nil {
+			d.Labels = append(d.Labels, t.Value)
+		}
+	}
+
+	cols, err := b.collectionsOf(p.Id())
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cols {
+		d.Collections = append(d.Collections, c.Id())
+		d.Labels = append(d.Labels, c.Name)
+	}
+
+	for _, o := range p.Options {
+		d.Labels = append(d.Labels, o.Values...)
+		for _, v := range o.Values {
+			d.Options = append(d.Options, OptionValue(o.Name, v))
+		}
+	}
+
+	if d.InStock, err = b.inStock(p); err != nil {
+		return nil, err
+	}
+
+	d.SalesChannels = p.SalesChannelIds
+	if len(d.SalesChannels) == 0 {
+		d.SalesChannels = []string{AllChannels}
+	}
+	return d, nil
+}
+
+// addCategory files d under category id and every category above it, so
+// browsing a parent finds what is filed under its children. Inactive and
+// internal categories are not the storefront's to show, and neither is
+// anything under them.
+func (b *builder) addCategory(d *Document, id string) {
+	var path []*productcategory.ProductCategory
+	for seen := map[string]bool{}; id != "" && !seen[id]; {
+		seen[id] = true
+		c, ok := b.categories[id]
+		if !ok {
+			c = productcategory.New(b.db)
+			if err := c.GetById(id); err != nil {
+				c = nil
+			}
+			b.categories[id] = c
+		}
+		if c == nil || !c.IsActive || c.IsInternal {
+			return
+		}
+		path = append(path, c)
+		id = c.ParentId
+	}
+	for _, c := range path {
+		if !contains(d.Categories, c.Id()) {
+			d.Categories = append(d.Categories, c.Id())
+			d.Labels = append(d.Labels, c.Name)
+		}
+	}
+}
+
+// collectionsOf is the published collections listing productId. Collections
+// hold their product ids, which the datastore cannot filter on, so all of
+// them are loaded, once per builder; an org has tens.
+func (b *builder) collectionsOf(productId string) ([]*collection.Collection, error) {
+	if !b.loaded {
+		if _, err := collection.Query(b.db).GetAll(&b.collections); err != nil {
+			return nil, err
+		}
+		sort.Slice(b.collections, func(i, j int) bool { return b.collections[i].Id() < b.collections[j].Id() })
+		b.loaded = true
+	}
+	var out []*collection.Collection
+	for _, c := range b.collections {
+		if c.Published && contains(c.ProductIds, productId) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// inStock is whether any of p's variants can be promised now. A product
+// without variants is its own; one whose stock is not managed is always in
+// stock, and one not available is never.
+func (b *builder) inStock(p *product.Product) (bool, error) {
+	if !p.Available {
+		return false, nil
+	}
+	// Variants ride along inside the product as JSON, so their ids are
+	// read as stored rather than through Id, which would mint one for a
+	// variant that never had it.
+	ids := make([]string, 0, len(p.Variants))
+	for _, v := range p.Variants {
+		if v.Id_ != "" {
+			ids = append(ids, v.Id_)
+		}
+	}
+	if len(ids) == 0 {
+		ids = append(ids, p.Id())
+	}
+	for _, id := range ids {
+		promises, managed, err := allocation.AvailableToPromise(b.db, id)
+		if err != nil {
+			return false, err
+		}
+		if !managed {
+			return true, nil
+		}
+		for _, pr := range promises {
+			if pr.Available > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
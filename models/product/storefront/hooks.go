@@ -0,0 +1,238 @@
+package storefront
+
+import (
+	"context"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/variant"
+	"github.com/hanzoai/commerce/models/variantinventorylink"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// reindexBatch is how many products Reindex loads at a time.
+const reindexBatch = 500
+
+// Install keeps the storefront index current through r's model hooks. A
+// product is indexed as it is written, and again when a collection starts
+// or stops listing it or its stock changes; a placed order adds what it
+// ordered to its products' Sold, which reindexes them in turn.
+//
+// Renaming a category, tag or type does not reach the products filed under
+// it until they are next written or the index is rebuilt. A failure is
+// logged and does not fail the write.
+func Install(r *hooks.Registry) {
+	r.OnModelAfterCreate("product").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: productWritten})
+	r.OnModelAfterUpdate("product").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: productWritten})
+	r.OnModelAfterDelete("product").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: productDeleted})
+
+	r.OnModelAfterCreate("collection").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: collectionChanged})
+	r.OnModelAfterUpdate("collection").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: collectionChanged})
+	r.OnModelAfterDelete("collection").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: collectionChanged})
+
+	r.OnModelAfterCreate("inventorylevel").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: stockChanged})
+	r.OnModelAfterUpdate("inventorylevel").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: stockChanged})
+
+	r.OnModelAfterCreate("order").Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "storefront", Func: orderPlaced})
+}
+
+// Put indexes p, or takes it out of the index when it is hidden.
+func Put(db *datastore.Datastore, p *product.Product) error {
+	return put(newBuilder(db), p)
+}
+
+func put(b *builder, p *product.Product) error {
+	d, err := b.document(p)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return search.Delete(b.db.Context, Index, p.Id())
+	}
+	_, err = search.Put(b.db.Context, Index, d.Id(), d)
+	return err
+}
+
+// Reindex indexes every product in db's org, a batch at a time, and returns
+// how many it indexed. It does not empty the index first.
+func Reindex(db *datastore.Datastore) (int, error) {
+	b := newBuilder(db)
+	n := 0
+	for offset := 0; ; offset += reindexBatch {
+		var batch []*product.Product
+		if _, err := product.Query(db).Order("CreatedAt").Offset(offset).Limit(reindexBatch).GetAll(&batch); err != nil {
+			return n, err
+		}
+		for _, p := range batch {
+			if err := put(b, p); err != nil {
+				return n, err
+			}
+			if !p.Hidden {
+				n++
+			}
+		}
+		if len(batch) < reindexBatch {
+			return n, nil
+		}
+	}
+}
+
+// reindex indexes the products with the given ids again, as they are now.
+func reindex(ctx context.Context, why string, ids []string) {
+	db := datastore.New(ctx)
+	b := newBuilder(db)
+	for _, id := range ids {
+		p := product.New(db)
+		if err := p.GetById(id); err != nil {
+			continue
+		}
+		if err := put(b, p); err != nil {
+			log.Error("storefront: index product %s after %s: %v", id, why, err, ctx)
+		}
+	}
+}
+
+func productWritten(e *hooks.ModelEvent) error {
+	if p, ok := e.Model.(*product.Product); ok && e.Context != nil {
+		if err := Put(datastore.New(e.Context), p); err != nil {
+			log.Error("storefront: index product %s: %v", p.Id(), err, e.Context)
+		}
+	}
+	return e.Next()
+}
+
+func productDeleted(e *hooks.ModelEvent) error {
+	if id := idOf(e); id != "" && e.Context != nil {
+		if err := search.Delete(e.Context, Index, id); err != nil {
+			log.Error("storefront: unindex product %s: %v", id, err, e.Context)
+		}
+	}
+	return e.Next()
+}
+
+// collectionChanged reindexes the products a collection has started or
+// stopped listing, or all it lists when it is published, unpublished,
+// renamed or deleted.
+func collectionChanged(e *hooks.ModelEvent) error {
+	if e.Context == nil {
+		return e.Next()
+	}
+	before, after := stringsOf(e.Before["productIds"]), stringsOf(e.After["productIds"])
+	var ids []string
+	if e.After == nil || e.Before == nil || e.Changed("published", "name") {
+		ids = union(before, after)
+	} else if e.Changed("productIds") {
+		ids = union(difference(before, after), difference(after, before))
+	}
+	if len(ids) > 0 {
+		reindex(e.Context, "collection "+idOf(e), ids)
+	}
+	return e.Next()
+}
+
+// stockChanged reindexes the products stocked from an inventory level whose
+// quantities changed, in stock being a facet.
+func stockChanged(e *hooks.ModelEvent) error {
+	item, _ := e.After["inventoryItemId"].(string)
+	if item == "" || e.Context == nil || !(e.Before == nil || e.Changed("stockedQuantity", "reservedQuantity")) {
+		return e.Next()
+	}
+	db := datastore.New(e.Context)
+	var links []*variantinventorylink.VariantInventoryLink
+	if _, err := variantinventorylink.Query(db).Filter("InventoryItemId=", item).GetAll(&links); err != nil {
+		log.Error("storefront: variants of inventory item %s: %v", item, err, e.Context)
+		return e.Next()
+	}
+	var ids []string
+	for _, l := range links {
+		// A link is to a variant, or to a product sold without variants.
+		id := l.VariantId
+		if v := variant.New(db); v.GetById(l.VariantId) == nil && v.ProductId != "" {
+			id = v.ProductId
+		}
+		ids = union(ids, []string{id})
+	}
+	reindex(e.Context, "stock change", ids)
+	return e.Next()
+}
+
+// orderPlaced counts what an order ordered into its products' Sold. Orders
+// placed at once can lose a count to each other; best-selling is a ranking,
+// and the next order's count is right.
+func orderPlaced(e *hooks.ModelEvent) error {
+	if e.Context == nil {
+		return e.Next()
+	}
+	items, _ := e.After["items"].([]interface{})
+	sold := make(map[string]int)
+	var ids []string
+	for _, it := range items {
+		item, _ := it.(map[string]interface{})
+		id, _ := item["productId"].(string)
+		qty, _ := item["quantity"].(float64)
+		if id == "" || qty <= 0 {
+			continue
+		}
+		if _, seen := sold[id]; !seen {
+			ids = append(ids, id)
+		}
+		sold[id] += int(qty)
+	}
+
+	db := datastore.New(e.Context)
+	for _, id := range ids {
+		p := product.New(db)
+		if err := p.GetById(id); err != nil {
+			continue
+		}
+		p.Sold += sold[id]
+		if err := p.Update(); err != nil {
+			log.Error("storefront: count %d sold of product %s: %v", sold[id], id, err, e.Context)
+		}
+	}
+	return e.Next()
+}
+
+func idOf(e *hooks.ModelEvent) string {
+	if m, ok := e.Model.(interface{ Id() string }); ok {
+		return m.Id()
+	}
+	id, _ := e.After["id"].(string)
+	if id == "" {
+		id, _ = e.Before["id"].(string)
+	}
+	return id
+}
+
+func stringsOf(v interface{}) []string {
+	values, _ := v.([]interface{})
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func union(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, s := range b {
+		if !contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func difference(a, b []string) []string {
+	var out []string
+	for _, s := range a {
+		if !contains(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
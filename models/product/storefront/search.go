@@ -0,0 +1,214 @@
+package storefront
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// Sort is the order results come in.
+type Sort string
+
+const (
+	// Relevance ranks on how well the keywords match; with none it is the
+	// most recently changed first.
+	Relevance   Sort = "relevance"
+	PriceAsc    Sort = "price_asc"
+	PriceDesc   Sort = "price_desc"
+	Newest      Sort = "newest"
+	BestSelling Sort = "best_selling"
+)
+
+const (
+	// DefaultLimit and MaxLimit bound a page.
+	DefaultLimit = 24
+	MaxLimit     = 100
+
+	// facetValues is how many values of each facet a search returns.
+	facetValues = 50
+)
+
+var (
+	ErrBadCursor = errors.New("storefront: bad cursor")
+	ErrBadSort   = errors.New("storefront: unknown sort")
+)
+
+// Query is a storefront search. Values within one filter are alternatives
+// and different filters all have to hold: two categories is products in
+// either, a category and a tag is products in the one with the other.
+type Query struct {
+	// Text is the keywords, any of which may be misspelt.
+	Text string
+
+	Categories  []string
+	Collections []string
+	Tags        []string
+	Types       []string
+
+	// Options are OptionValues, "Size:M".
+	Options []string
+
+	// InStock leaves out what cannot be promised now.
+	InStock bool
+
+	// PriceMin and PriceMax bound the price, in the smallest currency unit:
+	// PriceMin <= price < PriceMax. Zero is no bound.
+	PriceMin, PriceMax float64
+
+	// PriceRanges are the buckets the price facet is counted in. Without
+	// them there is no price facet.
+	PriceRanges []search.Range
+
+	// SalesChannels are the channels of the publishable key searched with.
+	// Products in none of them, and not in every channel, are not found.
+	SalesChannels []string
+
+	Sort   Sort
+	Limit  int
+	Cursor string
+}
+
+// Result is a page of products, by id, and where the next page starts.
+type Result struct {
+	Ids    []string
+	Count  int
+	Facets map[string][]search.FacetResult
+
+	// Next is the cursor of the page after this one, empty on the last.
+	Next string
+}
+
+// options is q as a search of the storefront index.
+func (q *Query) options() (*search.SearchOptions, error) {
+	offset, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	opts := &search.SearchOptions{
+		IDsOnly: true,
+		Limit:   q.Limit,
+		Offset:  offset,
+		Fuzzy:   true,
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultLimit
+	}
+	opts.Limit = min(opts.Limit, MaxLimit)
+
+	refine := func(name string, values []string) {
+		for _, v := range values {
+			opts.Refinements = append(opts.Refinements, search.Facet{Name: name, Value: search.Atom(v)})
+		}
+	}
+	refine("salesChannel", append([]string{AllChannels}, q.SalesChannels...))
+	refine("category", q.Categories)
+	refine("collection", q.Collections)
+	refine("tag", q.Tags)
+	refine("type", q.Types)
+	refine("option", q.Options)
+	if q.InStock {
+		opts.Refinements = append(opts.Refinements, search.Facet{Name: "inStock", Value: true})
+	}
+	if q.PriceMin > 0 || q.PriceMax > 0 {
+		r := search.Range{Start: q.PriceMin, End: q.PriceMax}
+		if r.End <= 0 {
+			r.End = math.Inf(1)
+		}
+		opts.Refinements = append(opts.Refinements, search.Facet{Name: "price", Value: r})
+	}
+
+	for _, name := range []string{"category", "collection", "tag", "type", "option", "inStock"} {
+		opts.Facets = append(opts.Facets, search.FacetSearchOption{Name: name, ValueLimit: facetValues})
+	}
+	if len(q.PriceRanges) > 0 {
+		opts.Facets = append(opts.Facets, search.FacetSearchOption{Name: "price", Ranges: q.PriceRanges})
+	}
+
+	var sort *search.SortExpression
+	switch q.Sort {
+	case "", Relevance:
+	case PriceAsc:
+		sort = &search.SortExpression{Expr: "price"}
+	case PriceDesc:
+		sort = &search.SortExpression{Expr: "price", Reverse: true}
+	case Newest:
+		sort = &search.SortExpression{Expr: "createdAt", Reverse: true}
+	case BestSelling:
+		sort = &search.SortExpression{Expr: "sold", Reverse: true}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrBadSort, q.Sort)
+	}
+	if sort != nil {
+		opts.Sort = &search.SortOptions{Expressions: []search.SortExpression{*sort}}
+	}
+	return opts, nil
+}
+
+// Search runs q against the storefront index of ctx's org.
+func Search(ctx context.Context, q *Query) (*Result, error) {
+	opts, err := q.options()
+	if err != nil {
+		return nil, err
+	}
+	it, err := search.Search(ctx, Index, q.Text, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Ids: []string{}, Facets: make(map[string][]search.FacetResult)}
+	for {
+		id, err := it.Next(nil)
+		if err == search.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Ids = append(res.Ids, id)
+	}
+	res.Count = it.Count()
+
+	facets, err := it.Facets()
+	if err != nil {
+		return nil, err
+	}
+	for _, values := range facets {
+		if len(values) > 0 {
+			res.Facets[values[0].Name] = values
+		}
+	}
+
+	if end := opts.Offset + len(res.Ids); len(res.Ids) == opts.Limit && end < res.Count {
+		res.Next = encodeCursor(end)
+	}
+	return res, nil
+}
+
+// A cursor is where the next page starts, opaque to the storefront so what
+// it holds can change. A page is counted from the results as they stand
+// when it is asked for; a product indexed in between can shift the rest by
+// one.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrBadCursor
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(string(raw), "o:"))
+	if err != nil || n < 0 || !strings.HasPrefix(string(raw), "o:") {
+		return 0, ErrBadCursor
+	}
+	return n, nil
+}
@@ -0,0 +1,108 @@
+package storefront
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+func facetsOf(meta *mixin.SearchDocumentMetadata) map[string][]interface{} {
+	out := make(map[string][]interface{})
+	for _, f := range meta.Facets {
+		out[f.Name] = append(out[f.Name], f.Value)
+	}
+	return out
+}
+
+// Every value of a many-valued facet is a facet of its own.
+func TestDocument_Save(t *testing.T) {
+	d := &Document{
+		Id_:           "p1",
+		Name:          "Trail Runner",
+		Price:         8900,
+		Labels:        []string{"Shoes", "Red"},
+		Categories:    []string{"shoes", "footwear"},
+		Options:       []string{OptionValue("Color", "Red"), OptionValue("Size", "42")},
+		InStock:       true,
+		SalesChannels: []string{AllChannels},
+	}
+	fields, meta, err := d.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []interface{}
+	for _, f := range fields {
+		if f.Name == "Label" {
+			labels = append(labels, f.Value)
+		}
+	}
+	if !reflect.DeepEqual(labels, []interface{}{"Shoes", "Red"}) {
+		t.Fatalf("label fields = %v", labels)
+	}
+
+	got := facetsOf(meta)
+	want := map[string][]interface{}{
+		"price":        {8900.0},
+		"inStock":      {true},
+		"category":     {"shoes", "footwear"},
+		"option":       {"Color:Red", "Size:42"},
+		"salesChannel": {AllChannels},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("facets = %v, want %v", got, want)
+	}
+}
+
+// A search sees its key's channels and what every channel sells, and the
+// shopper's filters on top.
+func TestQuery_Options(t *testing.T) {
+	q := &Query{
+		Categories:    []string{"shoes", "boots"},
+		InStock:       true,
+		PriceMin:      1000,
+		SalesChannels: []string{"web"},
+		Sort:          PriceDesc,
+		Limit:         500,
+	}
+	opts, err := q.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []search.Facet{
+		{Name: "salesChannel", Value: search.Atom(AllChannels)},
+		{Name: "salesChannel", Value: search.Atom("web")},
+		{Name: "category", Value: search.Atom("shoes")},
+		{Name: "category", Value: search.Atom("boots")},
+		{Name: "inStock", Value: true},
+		{Name: "price", Value: search.Range{Start: 1000, End: math.Inf(1)}},
+	}
+	if !reflect.DeepEqual(opts.Refinements, want) {
+		t.Fatalf("refinements = %+v, want %+v", opts.Refinements, want)
+	}
+	if opts.Limit != MaxLimit || !opts.Fuzzy || !opts.IDsOnly {
+		t.Fatalf("limit %d, fuzzy %v, ids only %v", opts.Limit, opts.Fuzzy, opts.IDsOnly)
+	}
+	if s := opts.Sort.Expressions; len(s) != 1 || s[0].Expr != "price" || !s[0].Reverse {
+		t.Fatalf("sort = %+v, want price descending", s)
+	}
+
+	if _, err := (&Query{Sort: "cheapest"}).options(); !errors.Is(err, ErrBadSort) {
+		t.Fatalf("unknown sort: err = %v", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	n, err := decodeCursor(encodeCursor(48))
+	if err != nil || n != 48 {
+		t.Fatalf("round trip = %d, %v", n, err)
+	}
+	for _, bad := range []string{"48", "!!", encodeCursor(-1)} {
+		if _, err := decodeCursor(bad); !errors.Is(err, ErrBadCursor) {
+			t.Fatalf("decodeCursor(%q): err = %v, want ErrBadCursor", bad, err)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+// Package engine decides which promotions a cart gets and what they take off.
+//
+// It is the one place promotion arithmetic lives. Cart totals, order totals at
+// checkout and the /promotion/evaluate preview all put their cart into the
+// shape below and call Evaluate, so what a shopper is shown in the cart is what
+// they are charged at checkout — a second copy of these rules in any of those
+// would drift from this one, and the difference would be money.
+//
+// Evaluate is pure: candidates are loaded (load.go) and budgets redeemed by the
+// caller, so the rules can be tested without a datastore and a preview never
+// spends a campaign's budget.
+package engine
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/campaignbudget"
+	"github.com/hanzoai/commerce/models/promotion"
+	"github.com/hanzoai/commerce/models/promotionrule"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// Item is one line of the cart as the rules see it.
+type Item struct {
+	Id        string `json:"id"`
+	ProductId string `json:"productId,omitempty"`
+	VariantId string `json:"variantId,omitempty"`
+
+	CollectionIds []string `json:"collectionIds,omitempty"`
+	TagIds        []string `json:"tagIds,omitempty"`
+	CategoryIds   []string `json:"categoryIds,omitempty"`
+
+	Quantity  int            `json:"quantity"`
+	UnitPrice currency.Cents `json:"unitPrice"`
+}
+
+// Cart is everything a promotion can be conditioned on or discount.
+type Cart struct {
+	Currency         string   `json:"currency"`
+	CustomerId       string   `json:"customerId,omitempty"`
+	CustomerGroupIds []string `json:"customerGroupIds,omitempty"`
+	SalesChannelId   string   `json:"salesChannelId,omitempty"`
+	RegionId         string   `json:"regionId,omitempty"`
+
+	// Codes the shopper entered. Automatic promotions need none.
+	Codes []string `json:"codes,omitempty"`
+
+	Items []Item `json:"items"`
+
+	// Subtotal stands in for the items when there are none (a contribution,
+	// or a preview that only knows the total). With items it is ignored: the
+	// items are the subtotal.
+	Subtotal currency.Cents `json:"subtotal"`
+
+	Shipping currency.Cents `json:"shipping"`
+}
+
+// Candidate is a promotion with everything needed to evaluate it.
+type Candidate struct {
+	Promotion *promotion.Promotion
+	Method    *applicationmethod.ApplicationMethod
+	Rules     []*promotionrule.PromotionRule
+
+	// Budget is the campaign's budget, if it has one.
+	Budget *campaignbudget.CampaignBudget
+}
+
+// Adjustment is one promotion's discount on one line, or on shipping.
+type Adjustment struct {
+	PromotionId string         `json:"promotionId"`
+	Code        string         `json:"code,omitempty"`
+	CampaignId  string         `json:"campaignId,omitempty"`
+	Target      string         `json:"target"`
+	ItemId      string         `json:"itemId,omitempty"`
+	Amount      currency.Cents `json:"amount"`
+}
+
+// Result is what Evaluate decided. Discount comes off the subtotal and
+// ShippingDiscount off shipping; the two are kept apart because they change
+// different lines of the bill and different tax bases.
+type Result struct {
+	Adjustments      []Adjustment   `json:"adjustments"`
+	Discount         currency.Cents `json:"discount"`
+	ShippingDiscount currency.Cents `json:"shippingDiscount"`
+}
+
+// line tracks what is left to discount on one item. Promotions apply one
+// after another, each to what the ones before it left, so two promotions can
+// never take a line below zero between them.
+type line struct {
+	item      Item
+	total     currency.Cents
+	remaining currency.Cents
+}
+
+// proposal is a discount not yet committed: the line it comes off, or -1 for
+// shipping.
+type proposal struct {
+	line   int
+	amount currency.Cents
+}
+
+const shippingLine = -1
+
+// Evaluate applies every candidate that the cart qualifies for, highest
+// Priority first.
+//
+// A candidate qualifies when it is active, inside its window, automatic or its
+// code was entered, in the cart's currency if it names one, its promotion rules
+// hold for the cart, and its campaign budget has room. An exclusive promotion
+// applies only if nothing has yet, and once one applies nothing after it does.
+func Evaluate(cart *Cart, candidates []Candidate, now time.Time) *Result {
+	res := &Result{Adjustments: make([]Adjustment, 0)}
+
+	lines := make([]*line, 0, len(cart.Items))
+	for _, it := range cart.Items {
+		if it.Quantity <= 0 {
+			continue
+		}
+		total := it.UnitPrice * currency.Cents(it.Quantity)
+		lines = append(lines, &line{item: it, total: total, remaining: total})
+	}
+	if len(cart.Items) == 0 && cart.Subtotal > 0 {
+		lines = append(lines, &line{item: Item{Quantity: 1, UnitPrice: cart.Subtotal}, total: cart.Subtotal, remaining: cart.Subtotal})
+	}
+	shipping := cart.Shipping
+
+	eligible := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if qualifies(cart, lines, c, now) {
+			eligible = append(eligible, c)
+		}
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		a, b := eligible[i].Promotion, eligible[j].Promotion
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		return a.Id() < b.Id()
+	})
+
+	// What each budget has left within this evaluation, so two promotions of
+	// one campaign cannot each spend the same remainder.
+	spent := make(map[*campaignbudget.CampaignBudget]int)
+
+	applied := false
+	for _, c := range eligible {
+		if applied && c.Promotion.Exclusive {
+			continue
+		}
+
+		proposals := propose(cart, lines, shipping, c)
+		proposals = capToBudget(proposals, c.Budget, spent)
+
+		var total currency.Cents
+		for _, p := range proposals {
+			if p.amount <= 0 {
+				continue
+			}
+			total += p.amount
+
+			adj := Adjustment{
+				PromotionId: c.Promotion.Id(),
+				Code:        c.Promotion.Code,
+				CampaignId:  c.Promotion.CampaignId,
+				Target:      targetOf(c.Method),
+				Amount:      p.amount,
+			}
+			if p.line == shippingLine {
+				shipping -= p.amount
+				res.ShippingDiscount += p.amount
+			} else {
+				lines[p.line].remaining -= p.amount
+				adj.ItemId = lines[p.line].item.Id
+				res.Discount += p.amount
+			}
+			res.Adjustments = append(res.Adjustments, adj)
+		}
+		if total <= 0 {
+			continue
+		}
+
+		if b := c.Budget; b != nil {
+			if b.Type == campaignbudget.Usage {
+				spent[b]++
+			} else {
+				spent[b] += int(total)
+			}
+		}
+
+		applied = true
+		if c.Promotion.Exclusive {
+			break
+		}
+	}
+
+	return res
+}
+
+func qualifies(cart *Cart, lines []*line, c Candidate, now time.Time) bool {
+	p, m := c.Promotion, c.Method
+	if p == nil || m == nil {
+		return false
+	}
+	if p.Status != "active" {
+		return false
+	}
+	if p.StartsAt != nil && p.StartsAt.After(now) {
+		return false
+	}
+	if p.EndsAt != nil && p.EndsAt.Before(now) {
+		return false
+	}
+	if !p.IsAutomatic && !offered(cart.Codes, p.Code) {
+		return false
+	}
+	if m.CurrencyCode != "" && !strings.EqualFold(m.CurrencyCode, cart.Currency) {
+		return false
+	}
+	if b := c.Budget; b != nil && b.CurrencyCode != "" && b.Type != campaignbudget.Usage && !strings.EqualFold(b.CurrencyCode, cart.Currency) {
+		// A spend budget counts money in one currency; spending it in another
+		// would count a yen as a dollar.
+		return false
+	}
+	return matchAll(scoped(c.Rules, promotionrule.ScopePromotion), cartSubject(cart, lines))
+}
+
+func offered(codes []string, code string) bool {
+	if code == "" {
+		return false
+	}
+	for _, c := range codes {
+		if strings.EqualFold(strings.TrimSpace(c), code) {
+			return true
+		}
+	}
+	return false
+}
+
+func scoped(rules []*promotionrule.PromotionRule, scope string) []*promotionrule.PromotionRule {
+	var out []*promotionrule.PromotionRule
+	for _, r := range rules {
+		if r != nil && r.Scope == scope {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// targetOf reads a method's target. An empty one is the order, which is what
+// every method meant before targets were honoured.
+func targetOf(m *applicationmethod.ApplicationMethod) string {
+	if m.TargetType == "" {
+		return applicationmethod.TargetOrder
+	}
+	return m.TargetType
+}
+
+// propose works out what c would take off, without taking it.
+func propose(cart *Cart, lines []*line, shipping currency.Cents, c Candidate) []proposal {
+	m := c.Method
+	if m.Value <= 0 {
+		return nil
+	}
+
+	if c.Promotion.Type == promotion.BuyGet {
+		return proposeBuyGet(cart, lines, c)
+	}
+
+	switch targetOf(m) {
+	case applicationmethod.TargetShipping:
+		amount := shipping
+		if m.Type == applicationmethod.Percentage {
+			amount = shipping.BasisPoints(m.Value)
+		} else if currency.Cents(m.Value) < amount {
+			amount = currency.Cents(m.Value)
+		}
+		return []proposal{{line: shippingLine, amount: amount}}
+
+	case applicationmethod.TargetItems:
+		targets := scoped(c.Rules, promotionrule.ScopeTarget)
+		var out []proposal
+		var bases []currency.Cents
+		for i, l := range lines {
+			if l.remaining <= 0 || !matchAll(targets, itemSubject(cart, l)) {
+				continue
+			}
+			units := l.item.Quantity
+			if m.MaxQuantity > 0 && units > m.MaxQuantity {
+				units = m.MaxQuantity
+			}
+			base := l.item.UnitPrice * currency.Cents(units)
+
+			var amount currency.Cents
+			switch {
+			case m.Type == applicationmethod.Percentage:
+				amount = base.BasisPoints(m.Value)
+			case m.Allocation == applicationmethod.AllocationAcross:
+				// Settled below, once every eligible line is known.
+				amount = base
+			default:
+				amount = currency.Cents(m.Value) * currency.Cents(units)
+			}
+			out = append(out, proposal{line: i, amount: amount})
+			bases = append(bases, base)
+		}
+		if m.Type != applicationmethod.Percentage && m.Allocation == applicationmethod.AllocationAcross {
+			out = spread(out, bases, currency.Cents(m.Value))
+		}
+		return clamp(out, lines)
+
+	default:
+		var remaining currency.Cents
+		var out []proposal
+		var bases []currency.Cents
+		for i, l := range lines {
+			if l.remaining > 0 {
+				remaining += l.remaining
+				out = append(out, proposal{line: i})
+				bases = append(bases, l.remaining)
+			}
+		}
+		amount := currency.Cents(m.Value)
+		if m.Type == applicationmethod.Percentage {
+			amount = remaining.BasisPoints(m.Value)
+		}
+		return clamp(spread(out, bases, amount), lines)
+	}
+}
+
+// proposeBuyGet discounts target units for every BuyRulesMinQuantity buy
+// units in the cart: ApplyToQuantity of them per set, cheapest first, up to
+// MaxQuantity in all.
+//
+// A unit counts once. When the buy and target rules overlap — buy two shirts,
+// get a third free — the shirt that is discounted is not also one of the two
+// that earned it, so three shirts make one set and not one set with a spare.
+func proposeBuyGet(cart *Cart, lines []*line, c Candidate) []proposal {
+	m := c.Method
+	if m.BuyRulesMinQuantity <= 0 || m.ApplyToQuantity <= 0 {
+		return nil
+	}
+
+	buyRules := scoped(c.Rules, promotionrule.ScopeBuy)
+	targetRules := scoped(c.Rules, promotionrule.ScopeTarget)
+
+	type unit struct {
+		line  int
+		price currency.Cents
+		used  bool
+	}
+	var buys, targets []*unit
+	for i, l := range lines {
+		s := itemSubject(cart, l)
+		isBuy, isTarget := matchAll(buyRules, s), matchAll(targetRules, s)
+		for n := 0; n < l.item.Quantity; n++ {
+			u := &unit{line: i, price: l.item.UnitPrice}
+			if isBuy {
+				buys = append(buys, u)
+			}
+			if isTarget {
+				targets = append(targets, u)
+			}
+		}
+	}
+	// The cheapest units are the ones given away; the dearest are the ones
+	// that count as bought, which leaves the cheap ones free to be targets.
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].price < targets[j].price })
+	sort.SliceStable(buys, func(i, j int) bool { return buys[i].price > buys[j].price })
+
+	var granted []*unit
+	for m.MaxQuantity <= 0 || len(granted) < m.MaxQuantity {
+		var get, bought []*unit
+		for _, u := range targets {
+			if len(get) == m.ApplyToQuantity {
+				break
+			}
+			if !u.used {
+				u.used = true
+				get = append(get, u)
+			}
+		}
+		for _, u := range buys {
+			if len(bought) == m.BuyRulesMinQuantity {
+				break
+			}
+			if !u.used {
+				u.used = true
+				bought = append(bought, u)
+			}
+		}
+		if len(get) < m.ApplyToQuantity || len(bought) < m.BuyRulesMinQuantity {
+			break
+		}
+		granted = append(granted, get...)
+	}
+	if m.MaxQuantity > 0 && len(granted) > m.MaxQuantity {
+		granted = granted[:m.MaxQuantity]
+	}
+
+	perLine := make(map[int]currency.Cents)
+	for _, u := range granted {
+		amount := currency.Cents(m.Value)
+		if m.Type == applicationmethod.Percentage {
+			amount = u.price.BasisPoints(m.Value)
+		}
+		if amount > u.price {
+			amount = u.price
+		}
+		perLine[u.line] += amount
+	}
+
+	out := make([]proposal, 0, len(perLine))
+	for i := range lines {
+		if a, ok := perLine[i]; ok {
+			out = append(out, proposal{line: i, amount: a})
+		}
+	}
+	return clamp(out, lines)
+}
+
+// spread divides amount over ps in proportion to bases, never more than the
+// total of bases. The last share takes the rounding so the shares sum exactly.
+func spread(ps []proposal, bases []currency.Cents, amount currency.Cents) []proposal {
+	var total currency.Cents
+	for _, b := range bases {
+		total += b
+	}
+	if total <= 0 {
+		return nil
+	}
+	if amount > total {
+		amount = total
+	}
+
+	left := amount
+	for i := range ps {
+		if i == len(ps)-1 {
+			ps[i].amount = left
+			break
+		}
+		share := currency.Cents(int64(amount) * int64(bases[i]) / int64(total))
+		ps[i].amount = share
+		left -= share
+	}
+	return ps
+}
+
+// clamp keeps every proposal within what is left on its line.
+func clamp(ps []proposal, lines []*line) []proposal {
+	for i := range ps {
+		if ps[i].line == shippingLine {
+			continue
+		}
+		if r := lines[ps[i].line].remaining; ps[i].amount > r {
+			ps[i].amount = r
+		}
+	}
+	return ps
+}
+
+// capToBudget trims ps to what the campaign's budget has left. A usage budget
+// is all or nothing: one more use either fits or it does not. A spend budget
+// lets the promotion through for as much as is left, so the last shopper to
+// use it gets the remainder rather than nothing. A Limit of zero is no limit.
+func capToBudget(ps []proposal, b *campaignbudget.CampaignBudget, spent map[*campaignbudget.CampaignBudget]int) []proposal {
+	if b == nil || b.Limit <= 0 {
+		return ps
+	}
+	left := b.Limit - b.Used - spent[b]
+	if left <= 0 {
+		return nil
+	}
+	if b.Type == campaignbudget.Usage {
+		return ps
+	}
+
+	budget := currency.Cents(left)
+	for i := range ps {
+		if ps[i].amount > budget {
+			ps[i].amount = budget
+		}
+		budget -= ps[i].amount
+	}
+	return ps
+}
@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/campaignbudget"
+	"github.com/hanzoai/commerce/models/promotion"
+	"github.com/hanzoai/commerce/models/promotionrule"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+// Evaluate never touches the datastore; the models only need one to have ids.
+
+func testDB(t *testing.T) *datastore.Datastore {
+	t.Helper()
+	tc := ae.NewContext()
+	t.Cleanup(tc.Close)
+	return datastore.New(nscontext.WithNamespace(context.Background(), "acme"))
+}
+
+func candidate(db *datastore.Datastore, code string, m applicationmethod.ApplicationMethod, rules ...*promotionrule.PromotionRule) Candidate {
+	p := promotion.New(db)
+	p.Code = code
+	p.Status = "active"
+	p.IsAutomatic = true
+
+	am := applicationmethod.New(db)
+	am.Type = m.Type
+	am.TargetType = m.TargetType
+	am.Allocation = m.Allocation
+	am.Value = m.Value
+	am.MaxQuantity = m.MaxQuantity
+	am.BuyRulesMinQuantity = m.BuyRulesMinQuantity
+	am.ApplyToQuantity = m.ApplyToQuantity
+
+	return Candidate{Promotion: p, Method: am, Rules: rules}
+}
+
+func rule(scope, attr, op string, values ...string) *promotionrule.PromotionRule {
+	return &promotionrule.PromotionRule{Scope: scope, Attribute: attr, Operator: op, Values: values}
+}
+
+func shirtsAndHat() *Cart {
+	return &Cart{
+		Currency: "usd",
+		Items: []Item{
+			{Id: "shirt", ProductId: "shirt", TagIds: []string{"apparel"}, Quantity: 3, UnitPrice: 2000},
+			{Id: "hat", ProductId: "hat", CategoryIds: []string{"accessories"}, Quantity: 1, UnitPrice: 1000},
+		},
+		Shipping: 800,
+	}
+}
+
+func TestEvaluate_PromotionRulesGate(t *testing.T) {
+	db := testDB(t)
+	vip := candidate(db, "VIP", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetOrder, Value: 1000,
+	}, rule(promotionrule.ScopePromotion, AttrCustomerGroup, OpIn, "vip"))
+	big := candidate(db, "BIG", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 500,
+	}, rule(promotionrule.ScopePromotion, AttrSubtotal, OpGte, "10000"))
+	unknown := candidate(db, "ODD", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 500,
+	}, rule(promotionrule.ScopePromotion, "moon_phase", OpEq, "full"))
+
+	cart := shirtsAndHat()
+	res := Evaluate(cart, []Candidate{vip, big, unknown}, time.Now())
+	if res.Discount != 0 {
+		t.Fatalf("discount = %d, want 0: not vip, subtotal 7000, and an unreadable rule", res.Discount)
+	}
+
+	cart.CustomerGroupIds = []string{"vip"}
+	res = Evaluate(cart, []Candidate{vip, big, unknown}, time.Now())
+	if res.Discount != 700 {
+		t.Fatalf("discount = %d, want 700 (10%% of 7000 for vip)", res.Discount)
+	}
+}
+
+func TestEvaluate_CodeOnlyNeedsItsCode(t *testing.T) {
+	db := testDB(t)
+	c := candidate(db, "SPRING", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 500,
+	})
+	c.Promotion.IsAutomatic = false
+
+	cart := shirtsAndHat()
+	if res := Evaluate(cart, []Candidate{c}, time.Now()); res.Discount != 0 {
+		t.Fatalf("discount = %d without the code, want 0", res.Discount)
+	}
+	cart.Codes = []string{" spring "}
+	if res := Evaluate(cart, []Candidate{c}, time.Now()); res.Discount != 500 {
+		t.Fatalf("discount = %d with the code, want 500", res.Discount)
+	}
+}
+
+// Item targets discount only the items their rules pick, and no more of each
+// line than MaxQuantity units.
+func TestEvaluate_ItemTargetsAndMaxQuantity(t *testing.T) {
+	db := testDB(t)
+	c := candidate(db, "TEES", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetItems, Value: 5000, MaxQuantity: 2,
+	}, rule(promotionrule.ScopeTarget, AttrTag, OpIn, "apparel"))
+
+	res := Evaluate(shirtsAndHat(), []Candidate{c}, time.Now())
+	if res.Discount != 2000 {
+		t.Fatalf("discount = %d, want 2000 (half off two of three shirts)", res.Discount)
+	}
+	if len(res.Adjustments) != 1 || res.Adjustments[0].ItemId != "shirt" {
+		t.Fatalf("adjustments = %+v, want one on the shirt line", res.Adjustments)
+	}
+}
+
+func TestEvaluate_FixedAcrossIsSplitOnce(t *testing.T) {
+	db := testDB(t)
+	c := candidate(db, "TEN", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetItems,
+		Allocation: applicationmethod.AllocationAcross, Value: 700,
+	})
+
+	res := Evaluate(shirtsAndHat(), []Candidate{c}, time.Now())
+	if res.Discount != 700 {
+		t.Fatalf("discount = %d, want 700 split over the lines", res.Discount)
+	}
+	if len(res.Adjustments) != 2 || res.Adjustments[0].Amount != 600 || res.Adjustments[1].Amount != 100 {
+		t.Fatalf("adjustments = %+v, want 600/100 in proportion to 6000/1000", res.Adjustments)
+	}
+}
+
+func TestEvaluate_ShippingTarget(t *testing.T) {
+	db := testDB(t)
+	c := candidate(db, "SHIPFREE", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetShipping, Value: 10000,
+	})
+
+	res := Evaluate(shirtsAndHat(), []Candidate{c}, time.Now())
+	if res.ShippingDiscount != 800 || res.Discount != 0 {
+		t.Fatalf("result = %+v, want 800 off shipping and nothing off items", res)
+	}
+}
+
+// Buy two shirts, get one free: three shirts are one set, and the free shirt
+// is not one of the two that earned it.
+func TestEvaluate_BuyGetCountsEachUnitOnce(t *testing.T) {
+	db := testDB(t)
+	c := candidate(db, "B2G1", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetItems, Value: 10000,
+		BuyRulesMinQuantity: 2, ApplyToQuantity: 1,
+	},
+		rule(promotionrule.ScopeBuy, AttrProduct, OpEq, "shirt"),
+		rule(promotionrule.ScopeTarget, AttrProduct, OpEq, "shirt"),
+	)
+	c.Promotion.Type = promotion.BuyGet
+
+	res := Evaluate(shirtsAndHat(), []Candidate{c}, time.Now())
+	if res.Discount != 2000 {
+		t.Fatalf("discount = %d, want one free shirt (2000)", res.Discount)
+	}
+
+	cart := shirtsAndHat()
+	cart.Items[0].Quantity = 2
+	if res := Evaluate(cart, []Candidate{c}, time.Now()); res.Discount != 0 {
+		t.Fatalf("discount = %d with two shirts, want 0: the free one is not in the cart", res.Discount)
+	}
+}
+
+// Buy a shirt, get the cheapest accessory half off.
+func TestEvaluate_BuyGetAcrossProducts(t *testing.T) {
+	db := testDB(t)
+	c := candidate(db, "HATDEAL", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetItems, Value: 5000,
+		BuyRulesMinQuantity: 1, ApplyToQuantity: 1, MaxQuantity: 1,
+	},
+		rule(promotionrule.ScopeBuy, AttrTag, OpIn, "apparel"),
+		rule(promotionrule.ScopeTarget, AttrCategory, OpIn, "accessories"),
+	)
+	c.Promotion.Type = promotion.BuyGet
+
+	res := Evaluate(shirtsAndHat(), []Candidate{c}, time.Now())
+	if res.Discount != 500 || len(res.Adjustments) != 1 || res.Adjustments[0].ItemId != "hat" {
+		t.Fatalf("result = %+v, want 500 off the hat", res)
+	}
+}
+
+// Higher priority goes first; an exclusive promotion applies only to a cart
+// nothing else has discounted, and ends the evaluation when it does.
+func TestEvaluate_PriorityAndExclusivity(t *testing.T) {
+	db := testDB(t)
+	first := candidate(db, "FIRST", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 1000,
+	})
+	first.Promotion.Priority = 10
+	exclusive := candidate(db, "ALONE", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetOrder, Value: 5000,
+	})
+	exclusive.Promotion.Exclusive = true
+	stacked := candidate(db, "STACK", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Percentage, TargetType: applicationmethod.TargetOrder, Value: 1000,
+	})
+
+	res := Evaluate(shirtsAndHat(), []Candidate{stacked, exclusive, first}, time.Now())
+	// FIRST takes 1000; ALONE is skipped; STACK takes 10% of the 6000 left.
+	if res.Discount != 1600 {
+		t.Fatalf("discount = %d, want 1600", res.Discount)
+	}
+
+	exclusive.Promotion.Priority = 20
+	res = Evaluate(shirtsAndHat(), []Candidate{stacked, exclusive, first}, time.Now())
+	if res.Discount != 3500 || len(distinct(res)) != 1 {
+		t.Fatalf("result = %+v, want ALONE's 3500 and nothing else", res)
+	}
+}
+
+// A spend budget caps what its campaign gives away, across every promotion of
+// the campaign; a usage budget that is used up stops it altogether.
+func TestEvaluate_CampaignBudget(t *testing.T) {
+	db := testDB(t)
+	budget := campaignbudget.New(db)
+	budget.Type = campaignbudget.Spend
+	budget.CurrencyCode = "usd"
+	budget.Limit = 10000
+	budget.Used = 9200
+
+	a := candidate(db, "A", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 500,
+	})
+	b := candidate(db, "B", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 500,
+	})
+	a.Budget, b.Budget = budget, budget
+
+	res := Evaluate(shirtsAndHat(), []Candidate{a, b}, time.Now())
+	if res.Discount != 800 {
+		t.Fatalf("discount = %d, want the 800 left in the budget", res.Discount)
+	}
+
+	usage := campaignbudget.New(db)
+	usage.Type = campaignbudget.Usage
+	usage.Limit = 100
+	usage.Used = 100
+	a.Budget = usage
+	if res := Evaluate(shirtsAndHat(), []Candidate{a}, time.Now()); res.Discount != 0 {
+		t.Fatalf("discount = %d on a used-up usage budget, want 0", res.Discount)
+	}
+}
+
+// Two promotions never take a line below zero between them.
+func TestEvaluate_NeverBelowZero(t *testing.T) {
+	db := testDB(t)
+	a := candidate(db, "A", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetOrder, Value: 5000,
+	})
+	b := candidate(db, "B", applicationmethod.ApplicationMethod{
+		Type: applicationmethod.Fixed, TargetType: applicationmethod.TargetItems, Value: 5000,
+	})
+
+	res := Evaluate(shirtsAndHat(), []Candidate{a, b}, time.Now())
+	if res.Discount != 7000 {
+		t.Fatalf("discount = %d, want the whole 7000 and not a cent more", res.Discount)
+	}
+}
+
+// A retried capture redeems an order's promotions again; the budget is
+// charged once.
+func TestRedeem_OncePerOrder(t *testing.T) {
+	db := testDB(t)
+	budget := campaignbudget.New(db)
+	budget.CampaignId = "summer"
+	budget.Type = campaignbudget.Spend
+	budget.Limit = 10000
+	if err := budget.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	adjustments := []Adjustment{
+		{PromotionId: "A", CampaignId: "summer", Target: applicationmethod.TargetItems, ItemId: "shirt", Amount: 300},
+		{PromotionId: "A", CampaignId: "summer", Target: applicationmethod.TargetItems, ItemId: "hat", Amount: 200},
+	}
+	for i := 0; i < 2; i++ {
+		if err := Redeem(db, "order1", adjustments); err != nil {
+			t.Fatalf("redeem %d: %v", i, err)
+		}
+	}
+
+	got := campaignbudget.New(db)
+	if err := got.GetById(budget.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Used != 500 {
+		t.Fatalf("used = %d after redeeming one order twice, want 500", got.Used)
+	}
+
+	if err := Redeem(db, "order2", adjustments); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.GetById(budget.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Used != 1000 {
+		t.Fatalf("used = %d after a second order, want 1000", got.Used)
+	}
+}
+
+func distinct(res *Result) map[string]currency.Cents {
+	out := make(map[string]currency.Cents)
+	for _, a := range res.Adjustments {
+		out[a.PromotionId] += a.Amount
+	}
+	return out
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/applicationmethod"
+	"github.com/hanzoai/commerce/models/campaignbudget"
+	"github.com/hanzoai/commerce/models/customergroupmembership"
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/promotion"
+	"github.com/hanzoai/commerce/models/promotionredemption"
+	"github.com/hanzoai/commerce/models/promotionrule"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// Load fetches the promotions a cart offering codes could get: every active
+// automatic one, and every active one whose code is among codes. Windows,
+// currencies, rules and budgets are left to Evaluate.
+//
+// A promotion without an application method is skipped; it says what it is
+// but not what it takes off. Promotions of one campaign share one budget
+// value, which is what lets Evaluate stop them spending it twice between them.
+func Load(db *datastore.Datastore, codes []string) ([]Candidate, error) {
+	var promotions []*promotion.Promotion
+	if _, err := promotion.Query(db).Filter("Status=", "active").GetAll(&promotions); err != nil {
+		return nil, err
+	}
+
+	budgets := make(map[string]*campaignbudget.CampaignBudget)
+	candidates := make([]Candidate, 0, len(promotions))
+	for _, p := range promotions {
+		if !p.IsAutomatic && !offered(codes, p.Code) {
+			continue
+		}
+
+		m := applicationmethod.New(db)
+		if ok, err := m.Query().Filter("PromotionId=", p.Id()).Get(); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		var rules []*promotionrule.PromotionRule
+		if _, err := promotionrule.Query(db).Filter("PromotionId=", p.Id()).GetAll(&rules); err != nil {
+			return nil, err
+		}
+
+		c := Candidate{Promotion: p, Method: m, Rules: rules}
+		if p.CampaignId != "" {
+			b, seen := budgets[p.CampaignId]
+			if !seen {
+				cb := campaignbudget.New(db)
+				ok, err := cb.Query().Filter("CampaignId=", p.CampaignId).Get()
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					b = cb
+				}
+				budgets[p.CampaignId] = b
+			}
+			c.Budget = b
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// Apply loads the candidates for cart and evaluates them.
+func Apply(db *datastore.Datastore, cart *Cart, now time.Time) (*Result, error) {
+	candidates, err := Load(db, cart.Codes)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(cart, candidates, now), nil
+}
+
+// CustomerGroups returns the ids of the customer groups userId belongs to.
+func CustomerGroups(db *datastore.Datastore, userId string) ([]string, error) {
+	if userId == "" {
+		return nil, nil
+	}
+	var memberships []*customergroupmembership.CustomerGroupMembership
+	if _, err := customergroupmembership.Query(db).Filter("UserId=", userId).GetAll(&memberships); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		ids = append(ids, m.CustomerGroupId)
+	}
+	return ids, nil
+}
+
+// Redeem charges an order's adjustments to their campaigns' budgets: the
+// amount to a spend budget, one use per promotion to a usage budget. It is
+// called once an order is paid, not when it is totalled, so a cart that is
+// looked at and abandoned spends nothing.
+//
+// It may be called again for the same order, as a retried capture does. Each
+// promotion the order redeems is recorded (promotionredemption, keyed by order
+// and promotion) before its budget is charged, and one already recorded is
+// skipped; a failure between the two leaves the budget one order short, never
+// charged twice.
+//
+// A budget may end up past its limit when two orders are paid at once; the
+// limit stops the next order, it does not claw back the last.
+func Redeem(db *datastore.Datastore, orderId string, adjustments []Adjustment) error {
+	if orderId == "" {
+		return errors.New("engine: redeeming promotions needs the order they were redeemed on")
+	}
+
+	type redemption struct {
+		campaignId string
+		amount     currency.Cents
+	}
+	var promotionIds []string
+	redemptions := make(map[string]*redemption)
+	for _, a := range adjustments {
+		if a.CampaignId == "" || a.Amount <= 0 {
+			continue
+		}
+		r := redemptions[a.PromotionId]
+		if r == nil {
+			r = &redemption{campaignId: a.CampaignId}
+			redemptions[a.PromotionId] = r
+			promotionIds = append(promotionIds, a.PromotionId)
+		}
+		r.amount += a.Amount
+	}
+
+	for _, promotionId := range promotionIds {
+		r := redemptions[promotionId]
+		err := db.RunInTransaction(func(db *datastore.Datastore) error {
+			id := promotionredemption.DeterministicID(orderId, promotionId)
+			rec := promotionredemption.New(db)
+			if err := rec.Get(db.NewKey(rec.Kind(), id, 0, nil)); err == nil {
+				return nil
+			} else if !errors.Is(err, datastore.ErrNoSuchEntity) {
+				return err
+			}
+			rec.SetId(id)
+			rec.OrderId = orderId
+			rec.PromotionId = promotionId
+			rec.CampaignId = r.campaignId
+			rec.Amount = r.amount
+			if err := rec.Create(); err != nil {
+				return err
+			}
+
+			b := campaignbudget.New(db)
+			ok, err := b.Query().Filter("CampaignId=", r.campaignId).Get()
+			if err != nil || !ok {
+				return err
+			}
+			if b.Type == campaignbudget.Usage {
+				b.Used++
+			} else {
+				b.Used += int(r.amount)
+			}
+			return b.Update()
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LineItems puts line items into the engine's shape.
+//
+// Products carry no tag or category relations of their own, so a product's
+// tags and categories are read from its metadata: "tagIds" and "categoryIds",
+// each a list of ids. Only items whose Product is loaded have them. Free items
+// (added by a coupon) and subscriptions are left out, the same items a
+// subtotal leaves out.
+func LineItems(items []lineitem.LineItem) []Item {
+	out := make([]Item, 0, len(items))
+	for _, li := range items {
+		if li.Free || (li.Product != nil && li.Product.IsSubscribeable) {
+			continue
+		}
+		it := Item{
+			Id:        li.Id(),
+			ProductId: li.ProductId,
+			VariantId: li.VariantId,
+			Quantity:  li.Quantity,
+			UnitPrice: li.Price,
+		}
+		if li.CollectionId != "" {
+			it.CollectionIds = []string{li.CollectionId}
+		}
+		if li.Product != nil {
+			it.TagIds = metadataIds(li.Product.Metadata["tagIds"])
+			it.CategoryIds = metadataIds(li.Product.Metadata["categoryIds"])
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+func metadataIds(v interface{}) []string {
+	switch ids := v.(type) {
+	case []string:
+		return ids
+	case []interface{}:
+		out := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if s, ok := id.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		if ids != "" {
+			return []string{ids}
+		}
+	}
+	return nil
+}
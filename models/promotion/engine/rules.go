@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hanzoai/commerce/models/promotionrule"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// Attributes a rule can test. The item-membership attributes (product,
+// variant, collection, tag, category) read as "the cart contains one" in a
+// promotion rule and as "this item is one" in a target or buy rule; quantity
+// and subtotal read as the cart's in the first and the line's in the others.
+const (
+	AttrCustomer      = "customer"
+	AttrCustomerGroup = "customer_group"
+	AttrSalesChannel  = "sales_channel"
+	AttrRegion        = "region"
+	AttrCurrency      = "currency"
+	AttrProduct       = "product"
+	AttrVariant       = "variant"
+	AttrCollection    = "collection"
+	AttrTag           = "tag"
+	AttrCategory      = "category"
+	AttrItemQuantity  = "item_quantity"
+	AttrSubtotal      = "subtotal"
+)
+
+// Operators. eq/in and ne/nin are the same test: whether any of the
+// attribute's values is among the rule's. The ordered ones compare a number
+// against the rule's first value.
+const (
+	OpEq  = "eq"
+	OpNe  = "ne"
+	OpIn  = "in"
+	OpNin = "nin"
+	OpGt  = "gt"
+	OpGte = "gte"
+	OpLt  = "lt"
+	OpLte = "lte"
+)
+
+// subject is whatever a rule is tested against: the whole cart, or one item.
+type subject struct {
+	strings map[string][]string
+	numbers map[string]int64
+}
+
+func cartSubject(c *Cart, items []*line) subject {
+	s := subject{
+		strings: map[string][]string{
+			AttrCustomer:      nonEmpty(c.CustomerId),
+			AttrCustomerGroup: c.CustomerGroupIds,
+			AttrSalesChannel:  nonEmpty(c.SalesChannelId),
+			AttrRegion:        nonEmpty(c.RegionId),
+			AttrCurrency:      nonEmpty(strings.ToLower(c.Currency)),
+		},
+		numbers: map[string]int64{},
+	}
+
+	var quantity int64
+	var subtotal currency.Cents
+	for _, l := range items {
+		for attr, vs := range l.item.memberships() {
+			s.strings[attr] = append(s.strings[attr], vs...)
+		}
+		quantity += int64(l.item.Quantity)
+		subtotal += l.total
+	}
+	if len(items) == 0 {
+		subtotal = c.Subtotal
+	}
+	s.numbers[AttrItemQuantity] = quantity
+	s.numbers[AttrSubtotal] = int64(subtotal)
+	return s
+}
+
+func itemSubject(c *Cart, l *line) subject {
+	s := cartSubject(c, nil)
+	for attr, vs := range l.item.memberships() {
+		s.strings[attr] = vs
+	}
+	s.numbers[AttrItemQuantity] = int64(l.item.Quantity)
+	s.numbers[AttrSubtotal] = int64(l.total)
+	return s
+}
+
+func (i Item) memberships() map[string][]string {
+	return map[string][]string{
+		AttrProduct:    nonEmpty(i.ProductId),
+		AttrVariant:    nonEmpty(i.VariantId),
+		AttrCollection: i.CollectionIds,
+		AttrTag:        i.TagIds,
+		AttrCategory:   i.CategoryIds,
+	}
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+// matchAll reports whether every rule holds for s. No rules is a match.
+func matchAll(rules []*promotionrule.PromotionRule, s subject) bool {
+	for _, r := range rules {
+		if !match(r, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// match tests one rule. A rule naming an attribute or operator this engine
+// does not know fails: a promotion whose conditions cannot be read must not be
+// handed out as though it had none.
+func match(r *promotionrule.PromotionRule, s subject) bool {
+	attr := strings.ToLower(r.Attribute)
+	op := strings.ToLower(r.Operator)
+	if op == "" {
+		op = OpIn
+	}
+
+	if n, ok := s.numbers[attr]; ok {
+		if len(r.Values) == 0 {
+			return false
+		}
+		if op == OpIn || op == OpNin || op == OpEq || op == OpNe {
+			in := false
+			for _, v := range r.Values {
+				if want, err := strconv.ParseInt(v, 10, 64); err == nil && want == n {
+					in = true
+					break
+				}
+			}
+			return in == (op == OpIn || op == OpEq)
+		}
+		want, err := strconv.ParseInt(r.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case OpGt:
+			return n > want
+		case OpGte:
+			return n >= want
+		case OpLt:
+			return n < want
+		case OpLte:
+			return n <= want
+		}
+		return false
+	}
+
+	have, ok := s.strings[attr]
+	if !ok {
+		return false
+	}
+	found := false
+	for _, h := range have {
+		for _, v := range r.Values {
+			if strings.EqualFold(h, v) {
+				found = true
+			}
+		}
+	}
+	switch op {
+	case OpEq, OpIn:
+		return found
+	case OpNe, OpNin:
+		return !found
+	}
+	return false
+}
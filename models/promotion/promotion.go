@@ -13,11 +13,18 @@ import (
 
 func init() { orm.Register[Promotion]("promotion") }
 
+// Promotion types. A standard promotion discounts its targets; a buy-get
+// promotion discounts its targets only once enough qualifying items are bought.
+const (
+	Standard = "standard"
+	BuyGet   = "buyget"
+)
+
 type Promotion struct {
 	mixin.Model[Promotion]
 
 	Code           string     `json:"code"`
-	Type           string     `json:"type"`
+	Type           string     `json:"type" orm:"default:standard"`
 	Status         string     `json:"status" orm:"default:draft"`
 	IsAutomatic    bool       `json:"isAutomatic"`
 	IsTaxInclusive bool       `json:"isTaxInclusive"`
@@ -25,6 +32,14 @@ type Promotion struct {
 	StartsAt       *time.Time `json:"startsAt,omitempty"`
 	EndsAt         *time.Time `json:"endsAt,omitempty"`
 
+	// Priority orders promotions when more than one applies; higher goes
+	// first, and later ones discount what the earlier ones left.
+	Priority int `json:"priority"`
+
+	// Exclusive promotions do not stack. One applies only when nothing of
+	// higher priority already has, and once it applies nothing else does.
+	Exclusive bool `json:"exclusive"`
+
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-"`
 	Metadata_ string `json:"-" datastore:",noindex"`
 }
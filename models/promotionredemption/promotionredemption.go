@@ -0,0 +1,58 @@
+// Package promotionredemption records which promotions an order has been
+// charged to its campaign budget for.
+//
+// Each PromotionRedemption is one immutable fact: "order O redeemed promotion
+// P for this amount". Its id is DeterministicID(orderId, promotionId) and the
+// model registers WithStringKey, so charging the same order again — a retried
+// capture — finds the row already there instead of spending the budget twice.
+package promotionredemption
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/orm"
+)
+
+func init() {
+	orm.Register[PromotionRedemption]("promotion-redemption", orm.WithStringKey[PromotionRedemption]())
+}
+
+// PromotionRedemption records that an order's discount from a promotion was
+// charged to the promotion's campaign budget.
+type PromotionRedemption struct {
+	mixin.Model[PromotionRedemption]
+
+	OrderId     string         `json:"orderId"`
+	PromotionId string         `json:"promotionId"`
+	CampaignId  string         `json:"campaignId"`
+	Amount      currency.Cents `json:"amount"`
+}
+
+func (r *PromotionRedemption) Load(ps []datastore.Property) error {
+	return datastore.LoadStruct(r, ps)
+}
+
+func (r *PromotionRedemption) Save() ([]datastore.Property, error) {
+	return datastore.SaveStruct(r)
+}
+
+// DeterministicID derives the storage id for an (orderId, promotionId) pair.
+// Prefixed so the id is recognizable in logs and audits.
+func DeterministicID(orderId, promotionId string) string {
+	sum := sha256.Sum256([]byte(orderId + "\x00" + promotionId))
+	return "prr_" + hex.EncodeToString(sum[:16])
+}
+
+func New(db *datastore.Datastore) *PromotionRedemption {
+	r := new(PromotionRedemption)
+	r.Init(db)
+	return r
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("promotion-redemption")
+}
@@ -9,10 +9,20 @@ import (
 
 func init() { orm.Register[PromotionRule]("promotionrule") }
 
+// Scopes say what a rule constrains. A promotion rule decides whether the
+// promotion applies to the cart at all; a target rule picks the items it
+// discounts; a buy rule picks the items that qualify a buy-get promotion.
+const (
+	ScopePromotion = ""
+	ScopeTarget    = "target"
+	ScopeBuy       = "buy"
+)
+
 type PromotionRule struct {
 	mixin.Model[PromotionRule]
 
 	PromotionId string `json:"promotionId"`
+	Scope       string `json:"scope,omitempty"`
 	Attribute   string `json:"attribute"`
 	Operator    string `json:"operator"`
 
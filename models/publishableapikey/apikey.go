@@ -28,6 +28,17 @@ type PublishableApiKey struct {
 	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
 	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
 	RevokedBy  string     `json:"revokedBy"`
+
+	// Sales channels a publishable key's storefront sells through. Its
+	// requests see the products of these channels and no others.
+	SalesChannelIds []string `json:"salesChannelIds" orm:"default:[]"`
+}
+
+// Usable reports whether the key may be presented by a storefront: it is not
+// a secret key, and it has not been revoked. A key created without a Type is
+// publishable.
+func (k *PublishableApiKey) Usable() bool {
+	return k.Type != Secret && k.RevokedAt == nil
 }
 
 func New(db *datastore.Datastore) *PublishableApiKey {
@@ -1,6 +1,8 @@
 package reservation
 
 import (
+	"time"
+
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/util/json"
@@ -13,6 +15,18 @@ var IgnoreFieldMismatch = datastore.IgnoreFieldMismatch
 
 func init() { orm.Register[ReservationItem]("reservation") }
 
+type Status string
+
+const (
+	// Held is a reservation for a cart or checkout session that has not
+	// become an order. It lapses at ExpiresAt.
+	Held Status = "held"
+
+	// Confirmed is a reservation for a placed order. It lasts until the order
+	// is fulfilled or cancelled.
+	Confirmed Status = "confirmed"
+)
+
 type ReservationItem struct {
 	mixin.Model[ReservationItem]
 
@@ -24,6 +38,21 @@ type ReservationItem struct {
 	Description     string `json:"description"`
 	ExternalId      string `json:"externalId"`
 
+	// VariantId is the variant the line item is for, when the reservation was
+	// made by allocating one.
+	VariantId string `json:"variantId,omitempty"`
+
+	// OwnerId is the cart or checkout session the stock is held for, and
+	// OrderId the order it went to once confirmed.
+	OwnerId string `json:"ownerId,omitempty"`
+	OrderId string `json:"orderId,omitempty"`
+
+	Status Status `json:"status,omitempty"`
+
+	// ExpiresAt is when a held reservation lapses and its stock goes back to
+	// the location. Zero for a reservation that does not lapse.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+
 	// Arbitrary key/value pairs
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-" orm:"default:{}"`
 	Metadata_ string `json:"-" datastore:",noindex"`
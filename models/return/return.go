@@ -4,7 +4,9 @@ import (
 	"time"
 
 	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
 	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/models/types/currency"
 	"github.com/hanzoai/commerce/models/types/fulfillment"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/val"
@@ -16,6 +18,45 @@ import (
 
 func init() { orm.Register[Return]("return") }
 
+// Return lifecycle states. A return is requested, approved or rejected,
+// received once the parcel is back, and completed when it is settled; it
+// can be canceled until it is received.
+const (
+	Requested = "requested"
+	Approved  = "approved"
+	Rejected  = "rejected"
+	Received  = "received"
+	Completed = "completed"
+	Canceled  = "canceled"
+)
+
+// How a return is settled.
+const (
+	ResolutionRefund      = "refund"
+	ResolutionStoreCredit = "store_credit"
+	ResolutionExchange    = "exchange"
+)
+
+// Condition a returned unit arrives in. Only sellable units are restocked.
+const (
+	Sellable  = "sellable"
+	Damaged   = "damaged"
+	Defective = "defective"
+)
+
+// Line is one order line being returned: how many units and why, and once
+// the parcel is inspected, how many arrived and in what condition.
+type Line struct {
+	LineItemId string `json:"lineItemId"`
+	Quantity   int    `json:"quantity"`
+	ReasonId   string `json:"reasonId,omitempty"`
+	Note       string `json:"note,omitempty"`
+
+	ReceivedQuantity int    `json:"receivedQuantity,omitempty"`
+	Condition        string `json:"condition,omitempty"`
+	Restocked        int    `json:"restocked,omitempty"`
+}
+
 type Return struct {
 	mixin.Model[Return]
 
@@ -44,6 +85,30 @@ type Return struct {
 	// Make a custom string for this when we figure out the states...
 	Status string `json:"status"`
 
+	// Lines being returned, against the order's line items.
+	Lines  []Line `json:"lines,omitempty" datastore:"-"`
+	Lines_ string `json:"-" datastore:",noindex"`
+
+	// Whether the customer or the merchant asked for the return, and how it
+	// is to be settled.
+	RequestedBy string `json:"requestedBy,omitempty"`
+	Resolution  string `json:"resolution,omitempty"`
+
+	// Return labels the customer ships the parcel back with.
+	Labels  []fulfillmentmodel.FulfillmentLabel `json:"labels,omitempty" datastore:"-"`
+	Labels_ string                              `json:"-" datastore:",noindex"`
+
+	// Stock location received units are restocked at.
+	LocationId string `json:"locationId,omitempty"`
+
+	// What the settlement came to and what it produced.
+	Amount             currency.Cents `json:"amount,omitempty"`
+	Currency           currency.Type  `json:"currency,omitempty"`
+	RefundId           string         `json:"refundId,omitempty"`
+	GiftCardId         string         `json:"giftCardId,omitempty"`
+	ExchangeId         string         `json:"exchangeId,omitempty"`
+	ReplacementOrderId string         `json:"replacementOrderId,omitempty"`
+
 	// Save notes on order
 	Summary string `json:"summary,omitempty"`
 
@@ -51,6 +116,7 @@ type Return struct {
 	Metadata  Map    `json:"metadata" datastore:"-"`
 	Metadata_ string `json:"-" datastore:",noindex"`
 
+	ApprovedAt  time.Time `json:"approvedAt"`
 	CancelledAt time.Time `json:"cancelledAt"`
 	CompletedAt time.Time `json:"completedAt"`
 	ExpectedAt  time.Time `json:"expectedAt"`
@@ -84,6 +150,14 @@ func (c *Return) Load(ps []datastore.Property) (err error) {
 		err = json.DecodeBytes([]byte(c.Items_), &c.Items)
 	}
 
+	if len(c.Lines_) > 0 {
+		err = json.DecodeBytes([]byte(c.Lines_), &c.Lines)
+	}
+
+	if len(c.Labels_) > 0 {
+		err = json.DecodeBytes([]byte(c.Labels_), &c.Labels)
+	}
+
 	if len(c.Metadata_) > 0 {
 		err = json.DecodeBytes([]byte(c.Metadata_), &c.Metadata)
 	}
@@ -95,6 +169,8 @@ func (c *Return) Save() (ps []datastore.Property, err error) {
 	// Serialize unsupported properties
 	c.Metadata_ = string(json.EncodeBytes(&c.Metadata))
 	c.Items_ = string(json.EncodeBytes(c.Items))
+	c.Lines_ = string(json.EncodeBytes(c.Lines))
+	c.Labels_ = string(json.EncodeBytes(c.Labels))
 
 	// Save properties
 	return datastore.SaveStruct(c)
@@ -105,6 +181,12 @@ func (r *Return) Defaults() {
 	r.Metadata = make(Map)
 }
 
+// IsOpen reports whether the return can still be canceled: it has not been
+// received, settled or refused.
+func (r *Return) IsOpen() bool {
+	return r.Status == "" || r.Status == Requested || r.Status == Approved
+}
+
 func New(db *datastore.Datastore) *Return {
 	r := new(Return)
 	r.Init(db)
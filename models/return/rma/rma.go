@@ -0,0 +1,209 @@
+// Package rma runs returns: a customer or the merchant asks to send back some
+// of what an order shipped, the merchant approves it and has a return label
+// made, inspects what arrives and restocks what can be sold again, and
+// settles the return with a refund, store credit or an exchange.
+//
+// What can be returned is what was fulfilled less what is already on other
+// returns, so two requests cannot return the same unit twice. What a return
+// is worth is what the order charged for the units, after its discount; the
+// order's shipping and tax are left to the merchant to refund by hand.
+//
+// The rules here are pure; workflow.go loads and saves around them.
+package rma
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/order"
+	return_ "github.com/hanzoai/commerce/models/return"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+var (
+	ErrState         = errors.New("rma: return cannot do that in its status")
+	ErrNoLines       = errors.New("rma: a return needs at least one line")
+	ErrResolution    = errors.New("rma: resolution must be refund, store_credit or exchange")
+	ErrNotReturnable = errors.New("rma: more units than can be returned")
+	ErrNotReceived   = errors.New("rma: more units received than were returned")
+	ErrOverRefund    = errors.New("rma: refund would exceed what the order was paid")
+	ErrNoPayment     = errors.New("rma: order has no payment intent or invoice to refund")
+	ErrNoLabel       = errors.New("rma: order was not shipped through a provider that makes return labels")
+	ErrNoProcessor   = errors.New("rma: no processor to refund the payment through")
+)
+
+// transitions are the statuses each status can move to.
+var transitions = map[string][]string{
+	"":                {return_.Requested},
+	return_.Requested: {return_.Approved, return_.Rejected, return_.Canceled},
+	return_.Approved:  {return_.Received, return_.Canceled},
+	return_.Received:  {return_.Completed},
+}
+
+// Transition moves r to status to, stamping when, or fails with ErrState if
+// its status cannot move there.
+func Transition(r *return_.Return, to string, now time.Time) error {
+	allowed := false
+	for _, s := range transitions[r.Status] {
+		if s == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s to %s", ErrState, statusName(r.Status), to)
+	}
+
+	r.Status = to
+	switch to {
+	case return_.Requested:
+		r.SubmittedAt = now
+	case return_.Approved:
+		r.ApprovedAt = now
+	case return_.Received:
+		r.ReturnedAt = now
+	case return_.Completed:
+		r.CompletedAt = now
+	case return_.Canceled, return_.Rejected:
+		r.CancelledAt = now
+	}
+	return nil
+}
+
+func statusName(s string) string {
+	if s == "" {
+		return "new"
+	}
+	return s
+}
+
+// Returnable is how many units of each of ord's line items, by line item id,
+// can still be returned: fulfilled less what returns already hold. A
+// rejected or canceled return holds nothing; a received one holds what
+// arrived.
+func Returnable(ord *order.Order, fulfilled map[string]int, returns []*return_.Return) map[string]int {
+	out := make(map[string]int, len(ord.Items))
+	for _, li := range ord.Items {
+		out[li.Id()] += fulfilled[li.Id()]
+	}
+	for _, r := range returns {
+		if r.Status == return_.Rejected || r.Status == return_.Canceled {
+			continue
+		}
+		for _, l := range r.Lines {
+			n := l.Quantity
+			if r.Status == return_.Received || r.Status == return_.Completed {
+				n = l.ReceivedQuantity
+			}
+			out[l.LineItemId] -= n
+		}
+	}
+	return out
+}
+
+// Validate checks lines ask for a positive number of units of line items
+// that can be returned, and no more than can be, counting a line item named
+// twice once.
+func Validate(lines []return_.Line, returnable map[string]int) error {
+	if len(lines) == 0 {
+		return ErrNoLines
+	}
+	asked := make(map[string]int, len(lines))
+	for _, l := range lines {
+		if l.Quantity < 1 {
+			return fmt.Errorf("%w: %d of %s", ErrNotReturnable, l.Quantity, l.LineItemId)
+		}
+		asked[l.LineItemId] += l.Quantity
+	}
+	for id, n := range asked {
+		if n > returnable[id] {
+			return fmt.Errorf("%w: %d of %s, %d can be", ErrNotReturnable, n, id, max(returnable[id], 0))
+		}
+	}
+	return nil
+}
+
+// Receive records what arrived of r's lines: received has one entry per line
+// item inspected, with its received quantity and condition. A line not in
+// received arrived not at all.
+func Receive(r *return_.Return, received []return_.Line) error {
+	byId := make(map[string]return_.Line, len(received))
+	for _, l := range received {
+		byId[l.LineItemId] = l
+	}
+	for i := range r.Lines {
+		l := &r.Lines[i]
+		got, ok := byId[l.LineItemId]
+		if !ok {
+			l.ReceivedQuantity, l.Condition = 0, ""
+			continue
+		}
+		if got.ReceivedQuantity < 0 || got.ReceivedQuantity > l.Quantity {
+			return fmt.Errorf("%w: %d of %s, %d were returned", ErrNotReceived, got.ReceivedQuantity, l.LineItemId, l.Quantity)
+		}
+		l.ReceivedQuantity = got.ReceivedQuantity
+		l.Condition = got.Condition
+		if l.Condition == "" {
+			l.Condition = return_.Sellable
+		}
+		delete(byId, l.LineItemId)
+	}
+	for id := range byId {
+		return fmt.Errorf("%w: %s is not on the return", ErrNotReceived, id)
+	}
+	return nil
+}
+
+// Value is what the units r received are worth: what ord charged for them,
+// less their share of its discount, rounded down.
+func Value(ord *order.Order, r *return_.Return) currency.Cents {
+	byId := lineItems(ord)
+	var total currency.Cents
+	for _, l := range r.Lines {
+		li, ok := byId[l.LineItemId]
+		if !ok || l.ReceivedQuantity <= 0 {
+			continue
+		}
+		total += li.Price * currency.Cents(l.ReceivedQuantity)
+	}
+	if ord.Discount > 0 && ord.LineTotal > 0 {
+		total = total * (ord.LineTotal - ord.Discount) / ord.LineTotal
+	}
+	return total
+}
+
+// Refundable is what is left of what ord was paid to refund.
+func Refundable(ord *order.Order) currency.Cents {
+	paid := ord.Paid
+	if paid == 0 {
+		paid = ord.Total
+	}
+	if left := paid - ord.Refunded; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Items are r's lines as the order's line items, at the quantities returned,
+// for the Items every return carries.
+func Items(ord *order.Order, lines []return_.Line) []lineitem.LineItem {
+	byId := lineItems(ord)
+	items := make([]lineitem.LineItem, 0, len(lines))
+	for _, l := range lines {
+		if li, ok := byId[l.LineItemId]; ok {
+			li.Quantity = l.Quantity
+			items = append(items, li)
+		}
+	}
+	return items
+}
+
+func lineItems(ord *order.Order) map[string]lineitem.LineItem {
+	byId := make(map[string]lineitem.LineItem, len(ord.Items))
+	for _, li := range ord.Items {
+		byId[li.Id()] = li
+	}
+	return byId
+}
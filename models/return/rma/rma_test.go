@@ -0,0 +1,143 @@
+package rma
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/order"
+	return_ "github.com/hanzoai/commerce/models/return"
+)
+
+func testOrder() *order.Order {
+	return &order.Order{
+		Items: []lineitem.LineItem{
+			{VariantId: "shirt", Price: 2000, Quantity: 3},
+			{VariantId: "hat", Price: 1000, Quantity: 1},
+		},
+		LineTotal: 7000,
+		Total:     7000,
+	}
+}
+
+func TestTransition(t *testing.T) {
+	r := &return_.Return{}
+	now := time.Now()
+	for _, to := range []string{return_.Requested, return_.Approved, return_.Received, return_.Completed} {
+		if err := Transition(r, to, now); err != nil {
+			t.Fatalf("to %s: %v", to, err)
+		}
+	}
+	if r.SubmittedAt.IsZero() || r.ApprovedAt.IsZero() || r.ReturnedAt.IsZero() || r.CompletedAt.IsZero() {
+		t.Errorf("not stamped: %+v", r)
+	}
+
+	if err := Transition(r, return_.Canceled, now); !errors.Is(err, ErrState) {
+		t.Errorf("cancel completed = %v, want ErrState", err)
+	}
+	r = &return_.Return{Status: return_.Requested}
+	if err := Transition(r, return_.Received, now); !errors.Is(err, ErrState) {
+		t.Errorf("receive unapproved = %v, want ErrState", err)
+	}
+}
+
+func TestReturnable(t *testing.T) {
+	ord := testOrder()
+	fulfilled := map[string]int{"shirt": 3, "hat": 1}
+	returns := []*return_.Return{
+		{Status: return_.Requested, Lines: []return_.Line{{LineItemId: "shirt", Quantity: 1}}},
+		{Status: return_.Received, Lines: []return_.Line{{LineItemId: "shirt", Quantity: 2, ReceivedQuantity: 1}}},
+		{Status: return_.Rejected, Lines: []return_.Line{{LineItemId: "hat", Quantity: 1}}},
+	}
+
+	got := Returnable(ord, fulfilled, returns)
+	if got["shirt"] != 1 || got["hat"] != 1 {
+		t.Errorf("returnable = %v, want shirt 1, hat 1", got)
+	}
+
+	if err := Validate([]return_.Line{{LineItemId: "shirt", Quantity: 1}, {LineItemId: "hat", Quantity: 1}}, got); err != nil {
+		t.Errorf("validate = %v", err)
+	}
+	if err := Validate([]return_.Line{{LineItemId: "shirt", Quantity: 1}, {LineItemId: "shirt", Quantity: 1}}, got); !errors.Is(err, ErrNotReturnable) {
+		t.Errorf("validate twice = %v, want ErrNotReturnable", err)
+	}
+	if err := Validate([]return_.Line{{LineItemId: "socks", Quantity: 1}}, got); !errors.Is(err, ErrNotReturnable) {
+		t.Errorf("validate unknown = %v, want ErrNotReturnable", err)
+	}
+	if err := Validate([]return_.Line{{LineItemId: "hat", Quantity: 0}}, got); !errors.Is(err, ErrNotReturnable) {
+		t.Errorf("validate zero = %v, want ErrNotReturnable", err)
+	}
+	if err := Validate(nil, got); !errors.Is(err, ErrNoLines) {
+		t.Errorf("validate none = %v, want ErrNoLines", err)
+	}
+
+	// Nothing shipped, nothing to return.
+	if got := Returnable(ord, nil, nil); got["shirt"] != 0 || got["hat"] != 0 {
+		t.Errorf("unshipped returnable = %v", got)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	r := &return_.Return{Lines: []return_.Line{
+		{LineItemId: "shirt", Quantity: 2},
+		{LineItemId: "hat", Quantity: 1},
+	}}
+
+	if err := Receive(r, []return_.Line{{LineItemId: "shirt", ReceivedQuantity: 3}}); !errors.Is(err, ErrNotReceived) {
+		t.Errorf("too many = %v, want ErrNotReceived", err)
+	}
+	if err := Receive(r, []return_.Line{{LineItemId: "socks", ReceivedQuantity: 1}}); !errors.Is(err, ErrNotReceived) {
+		t.Errorf("not on return = %v, want ErrNotReceived", err)
+	}
+
+	if err := Receive(r, []return_.Line{{LineItemId: "shirt", ReceivedQuantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Lines[0].ReceivedQuantity != 2 || r.Lines[0].Condition != return_.Sellable {
+		t.Errorf("shirt = %+v, want 2 sellable", r.Lines[0])
+	}
+	if r.Lines[1].ReceivedQuantity != 0 {
+		t.Errorf("hat = %+v, want none received", r.Lines[1])
+	}
+}
+
+func TestValue(t *testing.T) {
+	ord := testOrder()
+	r := &return_.Return{Lines: []return_.Line{
+		{LineItemId: "shirt", Quantity: 2, ReceivedQuantity: 2, Condition: return_.Damaged},
+		{LineItemId: "hat", Quantity: 1},
+	}}
+	if got := Value(ord, r); got != 4000 {
+		t.Errorf("value = %d, want 4000", got)
+	}
+
+	// A tenth off the order is a tenth off what comes back.
+	ord.Discount = 700
+	if got := Value(ord, r); got != 3600 {
+		t.Errorf("discounted value = %d, want 3600", got)
+	}
+}
+
+func TestRefundable(t *testing.T) {
+	ord := testOrder()
+	ord.Refunded = 2500
+	if got := Refundable(ord); got != 4500 {
+		t.Errorf("refundable = %d, want 4500", got)
+	}
+	ord.Paid = 2000
+	if got := Refundable(ord); got != 0 {
+		t.Errorf("over-refunded refundable = %d, want 0", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := merge([]return_.Line{
+		{LineItemId: "shirt", Quantity: 1, ReasonId: "fit"},
+		{LineItemId: "hat", Quantity: 1},
+		{LineItemId: "shirt", Quantity: 1},
+	})
+	if len(got) != 2 || got[0].Quantity != 2 || got[0].ReasonId != "fit" || got[1].LineItemId != "hat" {
+		t.Errorf("merged = %+v", got)
+	}
+}
@@ -0,0 +1,565 @@
+package rma
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/billing/engine"
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/fulfillment"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/models/exchange"
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/giftcard"
+	"github.com/hanzoai/commerce/models/inventory/allocation"
+	"github.com/hanzoai/commerce/models/inventorylevel"
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	return_ "github.com/hanzoai/commerce/models/return"
+	"github.com/hanzoai/commerce/models/types/currency"
+	orderfulfillment "github.com/hanzoai/commerce/models/types/fulfillment"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/util/rand"
+)
+
+// CreditCodeLength and creditAlphabet shape the code of a gift card issued as
+// store credit, as a referral code is shaped: read back and typed in.
+const (
+	CreditCodeLength = 12
+	creditAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// lockOrder serialises everything that reads what an order has left to
+// return or refund and then writes against it, so two requests for the last
+// unit, or two refunds of the last dollar, cannot both pass their check.
+func lockOrder(db *datastore.Datastore, orderId string) (unlock func(), err error) {
+	return lock.Hold(db, "order", orderId)
+}
+
+// Fulfilled is how many units of each of ord's line items have shipped, by
+// line item id: what its shipped, uncancelled fulfillments carry, a
+// fulfillment without items carrying the whole order. An order fulfilled
+// before fulfillments were recorded counts as shipped whole once its own
+// fulfillment status says it went out.
+func Fulfilled(db *datastore.Datastore, ord *order.Order) (map[string]int, error) {
+	var fs []*fulfillmentmodel.Fulfillment
+	if _, err := fulfillmentmodel.Query(db).Filter("OrderId=", ord.Id()).GetAll(&fs); err != nil {
+		return nil, err
+	}
+
+	ordered := make(map[string]int, len(ord.Items))
+	for _, li := range ord.Items {
+		ordered[li.Id()] += li.Quantity
+	}
+
+	out := make(map[string]int, len(ord.Items))
+	shipped := false
+	for _, f := range fs {
+		if f.ShippedAt == nil || f.CanceledAt != nil {
+			continue
+		}
+		shipped = true
+		if len(f.Items) == 0 {
+			return ordered, nil
+		}
+		for _, it := range f.Items {
+			out[it.LineItemId] += it.Quantity
+		}
+	}
+	if !shipped {
+		switch ord.Fulfillment.Status {
+		case orderfulfillment.Delivered, orderfulfillment.Completed, orderfulfillment.Tracked:
+			return ordered, nil
+		}
+	}
+	for id, n := range out {
+		out[id] = min(n, ordered[id])
+	}
+	return out, nil
+}
+
+// Returns are the returns made against the order with id orderId.
+func Returns(db *datastore.Datastore, orderId string) ([]*return_.Return, error) {
+	var rs []*return_.Return
+	if _, err := return_.Query(db).Filter("OrderId=", orderId).GetAll(&rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Request opens a return of lines of ord, asked for by by ("customer" or
+// "admin") to be settled by resolution. A line item named twice is returned
+// once, at both quantities.
+func Request(db *datastore.Datastore, ord *order.Order, lines []return_.Line, by, resolution string) (*return_.Return, error) {
+	switch resolution {
+	case "":
+		resolution = return_.ResolutionRefund
+	case return_.ResolutionRefund, return_.ResolutionStoreCredit, return_.ResolutionExchange:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrResolution, resolution)
+	}
+
+	unlock, err := lockOrder(db, ord.Id())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	fulfilled, err := Fulfilled(db, ord)
+	if err != nil {
+		return nil, err
+	}
+	returns, err := Returns(db, ord.Id())
+	if err != nil {
+		return nil, err
+	}
+	lines = merge(lines)
+	if err := Validate(lines, Returnable(ord, fulfilled, returns)); err != nil {
+		return nil, err
+	}
+
+	r := return_.New(db)
+	r.OrderId = ord.Id()
+	r.UserId = ord.UserId
+	r.StoreId = ord.StoreId
+	r.Lines = lines
+	r.Items = Items(ord, lines)
+	r.RequestedBy = by
+	r.Resolution = resolution
+	r.Currency = ord.Currency
+	if err := Transition(r, return_.Requested, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := r.Create(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func merge(lines []return_.Line) []return_.Line {
+	out := make([]return_.Line, 0, len(lines))
+	at := make(map[string]int, len(lines))
+	for _, l := range lines {
+		if i, ok := at[l.LineItemId]; ok {
+			out[i].Quantity += l.Quantity
+			continue
+		}
+		at[l.LineItemId] = len(out)
+		out = append(out, l)
+	}
+	return out
+}
+
+// Label buys r's return label from the provider that shipped ord, for the
+// units r returns, and adds it to r for the caller to save. An order shipped
+// by hand, or through a provider that cannot make return labels, fails with
+// ErrNoLabel; the merchant sends the customer a label some other way.
+func Label(ctx context.Context, db *datastore.Datastore, org *organization.Organization, ord *order.Order, r *return_.Return) error {
+	if r.Status != return_.Approved {
+		return fmt.Errorf("%w: label for a %s return", ErrState, statusName(r.Status))
+	}
+
+	var fs []*fulfillmentmodel.Fulfillment
+	if _, err := fulfillmentmodel.Query(db).Filter("OrderId=", ord.Id()).GetAll(&fs); err != nil {
+		return err
+	}
+	var shipped *fulfillmentmodel.Fulfillment
+	for _, f := range fs {
+		if f.ShippedAt != nil && f.CanceledAt == nil && f.ProviderId != "" && f.ExternalId != "" {
+			shipped = f
+			break
+		}
+	}
+	if shipped == nil {
+		return ErrNoLabel
+	}
+
+	p, err := fulfillment.Open(db, org, shipped.ProviderId)
+	if err != nil {
+		return err
+	}
+
+	back := &fulfillmentmodel.Fulfillment{}
+	for _, li := range r.Items {
+		back.Items = append(back.Items, fulfillmentmodel.FulfillmentItem{
+			LineItemId: li.Id(),
+			SKU:        li.SKU(),
+			Title:      li.DisplayName(),
+			Quantity:   li.Quantity,
+		})
+	}
+	req := fulfillment.OrderRequest(ord, back, fulfillment.ShipFrom(db, ord, shipped))
+	req.Reference = r.Id()
+
+	s, err := p.CreateReturnLabel(ctx, shipped.ExternalId, req)
+	if err == fulfillment.ErrUnsupported {
+		return ErrNoLabel
+	}
+	if err != nil {
+		return err
+	}
+	r.Labels = append(r.Labels, s.Labels...)
+	if r.LocationId == "" {
+		r.LocationId = shipped.LocationId
+	}
+	return nil
+}
+
+// Inspect records what arrived of approved return r (see Receive) and
+// restocks its sellable units at location, or where r was to be restocked,
+// or else where the order shipped from. A return with nowhere to restock is
+// received without restocking, and its units are left to be counted in by
+// hand.
+func Inspect(db *datastore.Datastore, ord *order.Order, r *return_.Return, received []return_.Line, location string) error {
+	if r.Status != return_.Approved {
+		return fmt.Errorf("%w: receive a %s return", ErrState, statusName(r.Status))
+	}
+	if err := Receive(r, received); err != nil {
+		return err
+	}
+	if location != "" {
+		r.LocationId = location
+	}
+	if r.LocationId == "" {
+		var fs []*fulfillmentmodel.Fulfillment
+		if _, err := fulfillmentmodel.Query(db).Filter("OrderId=", ord.Id()).GetAll(&fs); err != nil {
+			return err
+		}
+		for _, f := range fs {
+			if f.ShippedAt != nil && f.LocationId != "" {
+				r.LocationId = f.LocationId
+				break
+			}
+		}
+	}
+	if err := Transition(r, return_.Received, time.Now()); err != nil {
+		return err
+	}
+	if r.LocationId == "" {
+		return nil
+	}
+	return Restock(db, ord, r)
+}
+
+// Restock puts r's received, sellable units not yet restocked back into
+// stock at r's location, under the same lock as reservations, and marks them
+// restocked on r. A level the location does not have yet for an item is
+// made.
+func Restock(db *datastore.Datastore, ord *order.Order, r *return_.Return) error {
+	byId := lineItems(ord)
+	var items []lineitem.LineItem
+	for _, l := range r.Lines {
+		if l.Condition != return_.Sellable || l.ReceivedQuantity <= l.Restocked {
+			continue
+		}
+		li, ok := byId[l.LineItemId]
+		if !ok {
+			continue
+		}
+		li.Quantity = l.ReceivedQuantity - l.Restocked
+		items = append(items, li)
+	}
+	stock, err := allocation.Lines(db, items)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stock {
+		if err := restock(db, s.InventoryItemId, r.LocationId, s.Quantity); err != nil {
+			return err
+		}
+	}
+
+	// A variant no inventory item backs is not stocked, and is not
+	// restocked; it is marked done all the same.
+	for i := range r.Lines {
+		l := &r.Lines[i]
+		if l.Condition == return_.Sellable {
+			l.Restocked = l.ReceivedQuantity
+		}
+	}
+	return nil
+}
+
+func restock(db *datastore.Datastore, item, location string, n int) error {
+	unlock, err := allocation.LockLevel(db, item, location)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	level := inventorylevel.New(db)
+	ok, err := level.Query().Filter("InventoryItemId=", item).Filter("LocationId=", location).Get()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		level = inventorylevel.New(db)
+		level.InventoryItemId = item
+		level.LocationId = location
+		level.StockedQuantity = n
+		return level.Create()
+	}
+	level.StockedQuantity += n
+	return level.Update()
+}
+
+// Payment is what a refund is made against: a payment intent or an invoice.
+// An order does not link to either, so the caller names it, or the order
+// carries it in its metadata as paymentIntentId or invoiceId.
+type Payment struct {
+	PaymentIntentId string `json:"paymentIntentId,omitempty"`
+	InvoiceId       string `json:"invoiceId,omitempty"`
+}
+
+// PaymentOf is p, or when p names nothing, the payment ord carries.
+func PaymentOf(ord *order.Order, p Payment) (Payment, error) {
+	if p.PaymentIntentId == "" && p.InvoiceId == "" {
+		p.PaymentIntentId, _ = ord.Metadata["paymentIntentId"].(string)
+		p.InvoiceId, _ = ord.Metadata["invoiceId"].(string)
+	}
+	if p.PaymentIntentId == "" && p.InvoiceId == "" {
+		return p, ErrNoPayment
+	}
+	return p, nil
+}
+
+// reload reads r and ord again, for a caller that has just taken ord's lock
+// and must check them as they are now, not as they were before it waited.
+func reload(ord *order.Order, r *return_.Return) error {
+	if err := r.GetById(r.Id()); err != nil {
+		return err
+	}
+	return ord.GetById(ord.Id())
+}
+
+// Refund settles received return r by refunding what it is worth against p
+// through proc, and completes and saves it. It never refunds past what the
+// order has left of what it was paid. r and ord are read again under the
+// order's lock; a return another request settled meanwhile fails with
+// ErrState and is left in r as it was settled.
+func Refund(ctx context.Context, db *datastore.Datastore, ord *order.Order, r *return_.Return, p Payment, proc processor.PaymentProcessor) error {
+	unlock, err := lockOrder(db, ord.Id())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := reload(ord, r); err != nil {
+		return err
+	}
+	if r.Status != return_.Received {
+		return fmt.Errorf("%w: refund a %s return", ErrState, statusName(r.Status))
+	}
+	amount := Value(ord, r)
+	if err := refund(ctx, db, ord, r, p, amount, proc); err != nil {
+		return err
+	}
+	r.Resolution = return_.ResolutionRefund
+	r.Amount = amount
+	return complete(ord, r)
+}
+
+// refund refunds amount of ord against p through proc, recording it on ord
+// and r. A payment a processor took is refunded through one or not at all,
+// and a refund the gateway declines records nothing on ord or r. The caller
+// holds ord's lock.
+func refund(ctx context.Context, db *datastore.Datastore, ord *order.Order, r *return_.Return, p Payment, amount currency.Cents, proc processor.PaymentProcessor) error {
+	if amount > Refundable(ord) {
+		return fmt.Errorf("%w: %d, %d left", ErrOverRefund, amount, Refundable(ord))
+	}
+	if amount <= 0 {
+		return nil
+	}
+	p, err := PaymentOf(ord, p)
+	if err != nil {
+		return err
+	}
+	if p.PaymentIntentId != "" && proc == nil {
+		pi := paymentintent.New(db)
+		if err := pi.GetById(p.PaymentIntentId); err != nil {
+			return err
+		}
+		if pi.ProviderRef != "" {
+			return ErrNoProcessor
+		}
+	}
+	ref, err := engine.CreateRefund(ctx, db, engine.CreateRefundParams{
+		PaymentIntentId: p.PaymentIntentId,
+		InvoiceId:       p.InvoiceId,
+		Amount:          int64(amount),
+		Reason:          "requested_by_customer",
+	}, proc)
+	if err != nil {
+		return err
+	}
+	ord.Refunded += amount
+	if err := ord.Update(); err != nil {
+		return err
+	}
+	r.RefundId = ref.Id()
+	return nil
+}
+
+// StoreCredit settles received return r with a gift card for what it is
+// worth, and completes and saves it. The credit comes out of what the order can still
+// be refunded, as a refund would. r and ord are read again under the order's
+// lock, as Refund reads them.
+func StoreCredit(db *datastore.Datastore, ord *order.Order, r *return_.Return) error {
+	unlock, err := lockOrder(db, ord.Id())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := reload(ord, r); err != nil {
+		return err
+	}
+	if r.Status != return_.Received {
+		return fmt.Errorf("%w: credit a %s return", ErrState, statusName(r.Status))
+	}
+	amount := Value(ord, r)
+	if err := credit(db, ord, r, amount); err != nil {
+		return err
+	}
+	r.Resolution = return_.ResolutionStoreCredit
+	r.Amount = amount
+	return complete(ord, r)
+}
+
+// credit issues amount of ord as a gift card, recording it on ord and r. The
+// caller holds ord's lock.
+func credit(db *datastore.Datastore, ord *order.Order, r *return_.Return, amount currency.Cents) error {
+	if amount > Refundable(ord) {
+		return fmt.Errorf("%w: %d, %d left", ErrOverRefund, amount, Refundable(ord))
+	}
+	if amount <= 0 {
+		return nil
+	}
+	g := giftcard.New(db)
+	g.Code = rand.String(CreditCodeLength, creditAlphabet)
+	g.InitialBalanceCents = amount
+	g.Currency = ord.Currency
+	g.OrderId = ord.Id()
+	g.Metadata = map[string]interface{}{"returnId": r.Id()}
+	if err := g.Create(); err != nil {
+		return err
+	}
+	ord.Refunded += amount
+	if err := ord.Update(); err != nil {
+		return err
+	}
+	r.GiftCardId = g.Id()
+	return nil
+}
+
+// ExchangeParams is what a return is exchanged for: the items to ship in
+// its place, and how to settle if they come to less than it is worth.
+type ExchangeParams struct {
+	Items []lineitem.LineItem `json:"items"`
+
+	// StoreCredit settles what is owed the customer as store credit
+	// rather than a refund against Payment.
+	StoreCredit bool    `json:"storeCredit,omitempty"`
+	Payment     Payment `json:"payment,omitempty"`
+}
+
+// Exchange settles received return r by shipping p.Items in its place. The
+// replacement order is credited what r is worth: when the items come to
+// more, the replacement is left open for the customer to pay the
+// difference; when they come to less, the difference is refunded or given
+// as store credit, a refund going through proc. The exchange is recorded
+// with its difference due. r and ord are read again under the order's lock,
+// as Refund reads them.
+func Exchange(ctx context.Context, db *datastore.Datastore, ord *order.Order, r *return_.Return, p ExchangeParams, proc processor.PaymentProcessor) (*order.Order, *exchange.Exchange, error) {
+	unlock, err := lockOrder(db, ord.Id())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	if err := reload(ord, r); err != nil {
+		return nil, nil, err
+	}
+	if r.Status != return_.Received {
+		return nil, nil, fmt.Errorf("%w: exchange a %s return", ErrState, statusName(r.Status))
+	}
+	if len(p.Items) == 0 {
+		return nil, nil, ErrNoLines
+	}
+
+	value := Value(ord, r)
+	var outbound currency.Cents
+	for _, li := range p.Items {
+		outbound += li.Price * currency.Cents(li.Quantity)
+	}
+	diff := outbound - value
+
+	if diff < 0 {
+		var err error
+		if p.StoreCredit {
+			err = credit(db, ord, r, -diff)
+		} else {
+			err = refund(ctx, db, ord, r, p.Payment, -diff, proc)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	repl := order.New(db)
+	repl.Currency = ord.Currency
+	repl.UserId = ord.UserId
+	repl.Email = ord.Email
+	repl.StoreId = ord.StoreId
+	repl.ShippingAddress = ord.ShippingAddress
+	repl.Status = order.Open
+	repl.Items = p.Items
+	repl.LineTotal = outbound
+	repl.Discount = min(value, outbound)
+	repl.Subtotal = outbound - repl.Discount
+	repl.Total = repl.Subtotal
+	repl.Metadata["replacesOrderId"] = ord.Id()
+	repl.Metadata["returnId"] = r.Id()
+	if err := repl.Create(); err != nil {
+		return nil, nil, err
+	}
+
+	e := exchange.New(db)
+	e.OrderId = ord.Id()
+	e.ReturnId = r.Id()
+	e.DifferenceDueCents = diff
+	e.CurrencyCode = ord.Currency
+	e.Status = exchange.StatusConfirmed
+	for _, l := range r.Lines {
+		if l.ReceivedQuantity > 0 {
+			e.InboundItems = append(e.InboundItems, exchange.ExchangeItem{ItemId: l.LineItemId, Quantity: l.ReceivedQuantity})
+		}
+	}
+	for _, li := range repl.Items {
+		e.OutboundItems = append(e.OutboundItems, exchange.ExchangeItem{ItemId: li.Id(), Quantity: li.Quantity})
+	}
+	e.Metadata = map[string]interface{}{"replacementOrderId": repl.Id()}
+	if err := e.Create(); err != nil {
+		return nil, nil, err
+	}
+
+	r.Resolution = return_.ResolutionExchange
+	r.Amount = value
+	r.ExchangeId = e.Id()
+	r.ReplacementOrderId = repl.Id()
+	return repl, e, complete(ord, r)
+}
+
+// complete marks r completed and saves it, still under ord's lock, so a
+// settled return is never seen as one to settle again.
+func complete(ord *order.Order, r *return_.Return) error {
+	r.Currency = ord.Currency
+	if err := Transition(r, return_.Completed, time.Now()); err != nil {
+		return err
+	}
+	return r.Update()
+}
@@ -0,0 +1,148 @@
+package rma
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/paymentintent"
+	return_ "github.com/hanzoai/commerce/models/return"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// gateway is a processor whose refunds fail with err, counting them.
+type gateway struct {
+	*processor.BaseProcessor
+	err     error
+	refunds int
+}
+
+func newGateway(err error) *gateway {
+	bp := processor.NewBaseProcessor(processor.Stripe, []currency.Type{currency.USD})
+	bp.SetConfigured(true)
+	return &gateway{BaseProcessor: bp, err: err}
+}
+
+func (g *gateway) Charge(context.Context, processor.PaymentRequest) (*processor.PaymentResult, error) {
+	return &processor.PaymentResult{Success: true}, nil
+}
+func (g *gateway) Refund(context.Context, processor.RefundRequest) (*processor.RefundResult, error) {
+	g.refunds++
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &processor.RefundResult{Success: true, RefundID: "re_1"}, nil
+}
+func (g *gateway) GetTransaction(context.Context, string) (*processor.Transaction, error) {
+	return &processor.Transaction{}, nil
+}
+func (g *gateway) ValidateWebhook(context.Context, []byte, string) (*processor.WebhookEvent, error) {
+	return &processor.WebhookEvent{}, nil
+}
+
+// received saves a paid order in ns, the payment intent it was charged
+// through, and a received return of two of its shirts, worth 4000.
+func received(t *testing.T, ns string) (*datastore.Datastore, *order.Order, *return_.Return) {
+	t.Helper()
+	db := datastore.New(nscontext.WithNamespace(context.Background(), ns))
+
+	pi := paymentintent.New(db)
+	pi.Amount = 7000
+	pi.Currency = currency.USD
+	pi.MarkSucceeded("ch_1", 7000)
+	if err := pi.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	ord := order.New(db)
+	src := testOrder()
+	ord.Items, ord.LineTotal, ord.Total = src.Items, src.LineTotal, src.Total
+	ord.Currency = currency.USD
+	ord.Metadata["paymentIntentId"] = pi.Id()
+	if err := ord.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := return_.New(db)
+	r.OrderId = ord.Id()
+	r.Status = return_.Received
+	r.Resolution = return_.ResolutionRefund
+	r.Lines = []return_.Line{{LineItemId: "shirt", Quantity: 2, ReceivedQuantity: 2, Condition: return_.Sellable}}
+	if err := r.Create(); err != nil {
+		t.Fatal(err)
+	}
+	return db, ord, r
+}
+
+// A refund the gateway declines leaves the return to settle and the order
+// unrefunded.
+func TestRefund_GatewayFailure(t *testing.T) {
+	db, ord, r := received(t, "rma-gateway-failure")
+	g := newGateway(errors.New("card_declined"))
+
+	if err := Refund(context.Background(), db, ord, r, Payment{}, g); err == nil {
+		t.Fatal("refund succeeded, want the gateway's error")
+	}
+	if g.refunds != 1 {
+		t.Errorf("gateway refunds = %d, want 1", g.refunds)
+	}
+
+	if err := reload(ord, r); err != nil {
+		t.Fatal(err)
+	}
+	if ord.Refunded != 0 {
+		t.Errorf("order refunded = %d, want 0", ord.Refunded)
+	}
+	if r.Status != return_.Received || r.RefundId != "" {
+		t.Errorf("return = %s refund %q, want it received and unrefunded", r.Status, r.RefundId)
+	}
+
+	// Without a processor, a payment one took is not refunded at all.
+	if err := Refund(context.Background(), db, ord, r, Payment{}, nil); !errors.Is(err, ErrNoProcessor) {
+		t.Errorf("refund without processor = %v, want ErrNoProcessor", err)
+	}
+
+	g.err = nil
+	if err := Refund(context.Background(), db, ord, r, Payment{}, g); err != nil {
+		t.Fatal(err)
+	}
+	if ord.Refunded != 4000 || r.Status != return_.Completed || r.RefundId == "" {
+		t.Errorf("order refunded %d, return %s refund %q; want 4000, completed, a refund", ord.Refunded, r.Status, r.RefundId)
+	}
+}
+
+// A return read before another request settled it is checked as it is
+// now, once the order's lock is held: it is not refunded twice.
+func TestRefund_StaleReturn(t *testing.T) {
+	db, ord, r := received(t, "rma-stale-return")
+	g := newGateway(nil)
+
+	staleOrd := order.New(db)
+	stale := return_.New(db)
+	if err := staleOrd.GetById(ord.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if err := stale.GetById(r.Id()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Refund(context.Background(), db, ord, r, Payment{}, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := Refund(context.Background(), db, staleOrd, stale, Payment{}, g); !errors.Is(err, ErrState) {
+		t.Errorf("stale refund = %v, want ErrState", err)
+	}
+	if err := StoreCredit(db, staleOrd, stale); !errors.Is(err, ErrState) {
+		t.Errorf("stale credit = %v, want ErrState", err)
+	}
+	if g.refunds != 1 {
+		t.Errorf("gateway refunds = %d, want 1", g.refunds)
+	}
+	if stale.Status != return_.Completed || staleOrd.Refunded != 4000 {
+		t.Errorf("stale return %s, order refunded %d; want them read back as settled", stale.Status, staleOrd.Refunded)
+	}
+}
@@ -0,0 +1,44 @@
+// Package roleassignment gives an org member or an API key its roles. A
+// subject with no assignment is authorized as it was before roles existed, by
+// its token's permissions; once it has one, its roles alone decide.
+package roleassignment
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/orm"
+)
+
+func init() { orm.Register[RoleAssignment]("roleassignment") }
+
+type SubjectType string
+
+const (
+	// User is an org member, by the IAM user id the gateway vouches for.
+	User SubjectType = "user"
+
+	// APIKey is one of the org's access tokens, by its name, which outlives
+	// the token being rolled.
+	APIKey SubjectType = "apikey"
+)
+
+type RoleAssignment struct {
+	mixin.Model[RoleAssignment]
+
+	SubjectType SubjectType `json:"subjectType"`
+	SubjectId   string      `json:"subjectId"`
+
+	// Roles are role names: a built-in one (see package rbac) or one of the
+	// org's own.
+	Roles []string `json:"roles" datastore:",noindex"`
+}
+
+func New(db *datastore.Datastore) *RoleAssignment {
+	a := new(RoleAssignment)
+	a.Init(db)
+	return a
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("roleassignment")
+}
@@ -38,7 +38,7 @@ type SetupIntent struct {
 	CanceledAt         time.Time              `json:"canceledAt,omitempty"`
 	CancellationReason string                 `json:"cancellationReason,omitempty"`
 	LastError          string                 `json:"lastError,omitempty"`
-	ClientSecret       string                 `json:"clientSecret,omitempty"`
+	ClientSecret       string                 `json:"clientSecret,omitempty" audit:"redact"`
 	Metadata           map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -14,9 +14,23 @@ type PriceType string
 
 const (
 	FlatRate   PriceType = "flat"
+	Tiered     PriceType = "tiered"
 	Calculated PriceType = "calculated"
 )
 
+// What a tiered option's tiers are measured against.
+const (
+	TierBySubtotal = "subtotal"
+	TierByWeight   = "weight"
+)
+
+// Tier is the price of a tiered option for carts from Min up, Min being
+// cents of subtotal or grams of weight as the option's TierBy says.
+type Tier struct {
+	Min    int64          `json:"min"`
+	Amount currency.Cents `json:"amount"`
+}
+
 func init() { orm.Register[ShippingOption]("shippingoption") }
 
 type ShippingOption struct {
@@ -30,6 +44,11 @@ type ShippingOption struct {
 	ProfileId     string         `json:"profileId"`
 	DataJSON      string         `json:"data" datastore:",noindex"`
 
+	// Tiers price a tiered option; a cart below the lowest pays Amount.
+	TierBy string `json:"tierBy,omitempty"`
+	Tiers  []Tier `json:"tiers,omitempty" datastore:"-"`
+	Tiers_ string `json:"-" datastore:",noindex"`
+
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-" orm:"default:{}"`
 	Metadata_ string `json:"-" datastore:",noindex"`
 }
@@ -43,15 +62,35 @@ func (s *ShippingOption) Load(ps []datastore.Property) (err error) {
 		err = json.DecodeBytes([]byte(s.Metadata_), &s.Metadata)
 	}
 
+	if len(s.Tiers_) > 0 {
+		err = json.DecodeBytes([]byte(s.Tiers_), &s.Tiers)
+	}
+
 	return err
 }
 
 func (s *ShippingOption) Save() ([]datastore.Property, error) {
 	s.Metadata_ = string(json.EncodeBytes(&s.Metadata))
+	s.Tiers_ = string(json.EncodeBytes(s.Tiers))
 
 	return datastore.SaveStruct(s)
 }
 
+// Service is the carrier and service a calculated option is quoted and
+// shipped at, from its data: {"carrier": "ups", "service": "ups_ground"}.
+// Neither is the provider's choice, its cheapest.
+func (s *ShippingOption) Service() (carrier, service string) {
+	if s.DataJSON == "" {
+		return "", ""
+	}
+	var data struct {
+		Carrier string `json:"carrier"`
+		Service string `json:"service"`
+	}
+	json.DecodeBytes([]byte(s.DataJSON), &data)
+	return data.Carrier, data.Service
+}
+
 func New(db *datastore.Datastore) *ShippingOption {
 	s := new(ShippingOption)
 	s.Init(db)
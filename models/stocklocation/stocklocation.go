@@ -28,6 +28,15 @@ type StockLocation struct {
 	PostalCode   string `json:"postalCode"`
 	Phone        string `json:"phone"`
 
+	// Priority orders locations that reach a destination equally well; the
+	// lowest ships first.
+	Priority int `json:"priority"`
+
+	// FulfillmentSetIds are the fulfillment sets the location ships through.
+	// Their service zones are where it can send an order; a location with
+	// none is taken to reach everywhere, behind any that reach by zone.
+	FulfillmentSetIds []string `json:"fulfillmentSetIds,omitempty" datastore:",noindex"`
+
 	// Arbitrary metadata
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-" orm:"default:{}"`
 	Metadata_ string `json:"-" datastore:",noindex"`
@@ -101,7 +101,7 @@ type Store struct {
 
 	Mailchimp struct {
 		ListId string `json:"listId"`
-		APIKey string `json:"apiKey"`
+		APIKey string `json:"apiKey" audit:"redact"`
 	} `json:"mailchimp,omitempty"`
 }
 
@@ -19,6 +19,15 @@ type TaxRegion struct {
 	ParentId     string `json:"parentId"`
 	ProviderId   string `json:"providerId"`
 
+	// TaxShipping is whether shipping is taxed at the region's default
+	// rates. A rate with a shipping rule taxes it either way.
+	TaxShipping bool `json:"taxShipping"`
+
+	// ReverseChargeUnverified opts the org in to reverse-charging sales to
+	// the region's businesses whose tax numbers are well formed but that no
+	// Verifier checks. Off, only a verified number is reverse-charged.
+	ReverseChargeUnverified bool `json:"reverseChargeUnverified"`
+
 	// Arbitrary key/value pairs associated with this tax region
 	Metadata  Map    `json:"metadata,omitempty" datastore:"-"`
 	Metadata_ string `json:"-" datastore:",noindex"`
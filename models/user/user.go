@@ -21,6 +21,7 @@ import (
 	"github.com/hanzoai/commerce/models/types/commission"
 	"github.com/hanzoai/commerce/models/types/currency"
 	"github.com/hanzoai/commerce/models/wallet"
+	"github.com/hanzoai/commerce/tax/taxid"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/val"
 	"github.com/hanzoai/orm"
@@ -73,6 +74,11 @@ type User struct {
 	StoreId          string   `json:"storeId,omitempty"`
 	WalletPassphrase string   `json:"-"`
 
+	// TaxId is the VAT, GST or business number the user buys under, as
+	// their billing profile gives it, for reverse-charged sales across
+	// borders. KYC.TaxId is their personal one.
+	TaxId taxid.TaxId `json:"taxId,omitempty"`
+
 	Facebook struct {
 		AccessToken string `facebook:"-"`
 		UserId      string `facebook:"id"`
@@ -131,6 +137,9 @@ type User struct {
 	Test bool `json:"test"`
 }
 
+// TaxIdentity makes User a taxid.Holder.
+func (u *User) TaxIdentity() *taxid.TaxId { return &u.TaxId }
+
 // Total implements referrer.Referrent. Users have no monetary total by themselves.
 func (u *User) Total() currency.Cents {
 	return currency.Cents(0)
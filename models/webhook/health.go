@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+)
+
+// A webhook whose endpoint keeps failing is disabled rather than retried
+// forever. Both limits must be crossed: a burst of failures during a deploy
+// clears the count long before it clears the window, and a low-traffic
+// endpoint down for a day has not necessarily failed often enough to be
+// called dead.
+var (
+	DisableAfterFailures = 20
+	DisableAfter         = 24 * time.Hour
+)
+
+// RecordSuccess clears the failure run after a delivered attempt.
+func (s *Webhook) RecordSuccess() {
+	now := nowFn()
+	s.LastDeliveryAt = &now
+	s.ConsecutiveFailures = 0
+	s.FailingSince = nil
+}
+
+// RecordFailure counts a failed attempt and disables the webhook once the
+// failure run is sustained. It reports whether this call disabled it.
+func (s *Webhook) RecordFailure() bool {
+	now := nowFn()
+	s.LastDeliveryAt = &now
+	s.ConsecutiveFailures++
+	if s.FailingSince == nil {
+		s.FailingSince = &now
+	}
+
+	if !s.Enabled {
+		return false
+	}
+
+	if s.ConsecutiveFailures < DisableAfterFailures || now.Sub(*s.FailingSince) < DisableAfter {
+		return false
+	}
+
+	s.Enabled = false
+	s.DisabledAt = &now
+	s.DisabledReason = fmt.Sprintf("%d consecutive failed deliveries since %s", s.ConsecutiveFailures, s.FailingSince.UTC().Format(time.RFC3339))
+	return true
+}
+
+// Lock takes the lock every writer of the webhook with id holds while it
+// reads the webhook and saves it again. A delivery's POST can take seconds;
+// a copy read before it and saved after would revert a secret rotated, or an
+// edit made, in between.
+func Lock(db *datastore.Datastore, id string) (unlock func(), err error) {
+	return lock.Hold(db, "webhook", id)
+}
+
+// RecordDelivery records the outcome of an attempt on the webhook with id as
+// it is stored now, under Lock, and saves it. Only the delivery health
+// changes. It returns the webhook as saved and whether this attempt disabled
+// it.
+func RecordDelivery(db *datastore.Datastore, id string, delivered bool) (*Webhook, bool, error) {
+	unlock, err := Lock(db, id)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	w := New(db)
+	if err := w.GetById(id); err != nil {
+		return nil, false, err
+	}
+	disabled := false
+	if delivered {
+		w.RecordSuccess()
+	} else {
+		disabled = w.RecordFailure()
+	}
+	if err := w.Update(); err != nil {
+		return nil, false, err
+	}
+	return w, disabled, nil
+}
+
+// Reenable turns a disabled webhook back on with a clean failure record.
+func (s *Webhook) Reenable() {
+	s.Enabled = true
+	s.DisabledAt = nil
+	s.DisabledReason = ""
+	s.ConsecutiveFailures = 0
+	s.FailingSince = nil
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature_VerifiesUnderSecret(t *testing.T) {
+	w := &Webhook{Secret: NewSecret()}
+	body := []byte(`{"event":"order.paid"}`)
+
+	header := w.Signature(time.Now(), body)
+	if err := Verify(header, w.Secret, body, SignatureTolerance); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	if err := Verify(header, NewSecret(), body, SignatureTolerance); err != ErrSignatureMismatch {
+		t.Fatalf("verify under wrong secret = %v, want mismatch", err)
+	}
+
+	if err := Verify(header, w.Secret, []byte(`{"event":"order.refunded"}`), SignatureTolerance); err != ErrSignatureMismatch {
+		t.Fatalf("verify of tampered body = %v, want mismatch", err)
+	}
+}
+
+func TestSignature_RejectsStaleTimestamp(t *testing.T) {
+	w := &Webhook{Secret: NewSecret()}
+	body := []byte(`{}`)
+
+	header := w.Signature(time.Now().Add(-time.Hour), body)
+	if err := Verify(header, w.Secret, body, SignatureTolerance); err != ErrSignatureExpired {
+		t.Fatalf("verify of hour-old signature = %v, want expired", err)
+	}
+}
+
+// TestRotateSecret_GraceWindow proves a receiver still holding the old secret
+// verifies deliveries until the grace window closes, and not after.
+func TestRotateSecret_GraceWindow(t *testing.T) {
+	now := time.Now()
+	nowFn = func() time.Time { return now }
+	defer func() { nowFn = time.Now }()
+
+	w := &Webhook{Secret: NewSecret()}
+	old := w.Secret
+	body := []byte(`{}`)
+
+	w.RotateSecret(time.Hour)
+	if w.Secret == old {
+		t.Fatal("rotate kept the same secret")
+	}
+
+	header := w.Signature(now, body)
+	if n := strings.Count(header, "v1="); n != 2 {
+		t.Fatalf("header %q carries %d signatures, want 2 during grace", header, n)
+	}
+	for _, secret := range []string{old, w.Secret} {
+		if err := Verify(header, secret, body, SignatureTolerance); err != nil {
+			t.Fatalf("verify during grace: %v", err)
+		}
+	}
+
+	later := now.Add(2 * time.Hour)
+	nowFn = func() time.Time { return later }
+	header = w.Signature(later, body)
+	if err := Verify(header, old, body, SignatureTolerance); err != ErrSignatureMismatch {
+		t.Fatalf("old secret after grace = %v, want mismatch", err)
+	}
+}
+
+func TestRotateSecret_NoGrace(t *testing.T) {
+	w := &Webhook{Secret: NewSecret()}
+	w.RotateSecret(0)
+	if w.PreviousSecret != "" || w.PreviousSecretExpiresAt != nil {
+		t.Fatalf("zero-grace rotate kept previous secret")
+	}
+	if n := strings.Count(w.Signature(time.Now(), nil), "v1="); n != 1 {
+		t.Fatalf("zero-grace rotate signs with %d secrets, want 1", n)
+	}
+}
+
+// TestRecordFailure_DisablesOnlyWhenSustained proves a burst of failures
+// does not disable a webhook until the failure run is also old enough, and
+// that a success in between starts the run over.
+func TestRecordFailure_DisablesOnlyWhenSustained(t *testing.T) {
+	start := time.Now()
+	now := start
+	nowFn = func() time.Time { return now }
+	defer func() { nowFn = time.Now }()
+
+	w := &Webhook{Enabled: true, All: true}
+	for i := 0; i < DisableAfterFailures*2; i++ {
+		if w.RecordFailure() {
+			t.Fatalf("disabled after %d failures within the window", i+1)
+		}
+	}
+
+	w.RecordSuccess()
+	if w.ConsecutiveFailures != 0 || w.FailingSince != nil {
+		t.Fatal("success did not clear the failure run")
+	}
+
+	for i := 0; i < DisableAfterFailures-1; i++ {
+		w.RecordFailure()
+	}
+	now = start.Add(DisableAfter)
+	if !w.RecordFailure() {
+		t.Fatal("sustained failure run did not disable the webhook")
+	}
+	if w.Enabled || w.DisabledAt == nil || w.DisabledReason == "" {
+		t.Fatalf("disabled webhook state = %+v", w)
+	}
+	if w.Subscribed("order.paid") {
+		t.Fatal("disabled webhook still subscribed")
+	}
+
+	w.Reenable()
+	if !w.Enabled || w.ConsecutiveFailures != 0 || w.DisabledAt != nil {
+		t.Fatalf("re-enabled webhook state = %+v", w)
+	}
+}
@@ -1,70 +1,210 @@
 package tasks
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/delay"
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/models/webhook"
+	"github.com/hanzoai/commerce/models/webhookdelivery"
 	"github.com/hanzoai/commerce/util/json"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/rand"
 )
 
+// Headers sent with every delivery besides webhook.SignatureHeader.
+const (
+	EventHeader    = "X-Hanzo-Event"
+	DeliveryHeader = "X-Hanzo-Delivery"
+	AttemptHeader  = "X-Hanzo-Attempt"
+)
+
+// Retry policy. A failed attempt (transport error, timeout or non-2xx) is
+// re-queued after RetryBase, doubling each time up to RetryMax, until
+// MaxAttempts have been made. The defaults span about two hours, which
+// covers a receiver that is restarting or mid-deploy.
+var (
+	MaxAttempts = 8
+	RetryBase   = time.Minute
+	RetryMax    = time.Hour
+)
+
+// Backoff returns the wait before attempt+1 after attempt failed.
+func Backoff(attempt int) time.Duration {
+	d := RetryBase
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= RetryMax {
+			return RetryMax
+		}
+	}
+	return d
+}
+
 type Payload struct {
+	Id          string      `json:"id"`
+	Event       string      `json:"event"`
+	Created     int64       `json:"created"`
 	Data        interface{} `json:"data"`
 	AccessToken string      `json:"accessToken"`
 }
 
-type Client struct {
-	ctx    context.Context
-	client *http.Client
+var client = &http.Client{
+	Timeout: 20 * time.Second,
 }
 
-func (c *Client) Post(url string, data interface{}) error {
-	req, err := http.NewRequest("POST", url, json.EncodeBuffer(data))
+// Send makes one signed attempt to deliver body to hook and records it. It
+// updates the webhook's failure run (disabling it when the run is sustained)
+// and hook.Enabled with it, but never schedules a retry; that is the caller's
+// decision. The returned
+// error is the attempt's failure, if any — the record is returned either way.
+func Send(ctx context.Context, db *datastore.Datastore, hook *webhook.Webhook, eventId, event string, body []byte, attempt int, replay bool) (*webhookdelivery.WebhookDelivery, error) {
+	d := webhookdelivery.New(db)
+	d.WebhookId = hook.Id()
+	d.EventId = eventId
+	d.Event = event
+	d.Url = hook.Url
+	d.Attempt = attempt
+	d.Replay = replay
+	d.Payload = string(body)
+
+	sendErr := post(ctx, hook, d, body)
+	if sendErr != nil {
+		d.Status = webhookdelivery.Failed
+		d.Error = sendErr.Error()
+	} else {
+		d.Status = webhookdelivery.Succeeded
+	}
+
+	// The health is recorded on the webhook as it is stored now, not on hook,
+	// which was read before the POST: saving hook would revert whatever was
+	// changed while it ran.
+	if saved, disabled, err := webhook.RecordDelivery(db, hook.Id(), sendErr == nil); err != nil {
+		log.Error("Failed to update webhook '%s' health: %v", hook.Id(), err, ctx)
+	} else {
+		hook.Enabled = saved.Enabled
+		if disabled {
+			log.Warn("Webhook '%s' disabled: %s", hook.Id(), saved.DisabledReason, ctx)
+		}
+	}
+
+	if err := d.Create(); err != nil {
+		log.Error("Failed to record delivery of '%s' to webhook '%s': %v", event, hook.Id(), err, ctx)
+	}
+
+	return d, sendErr
+}
+
+func post(ctx context.Context, hook *webhook.Webhook, d *webhookdelivery.WebhookDelivery, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.Url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("User-Agent", "Hanzo/1.0")
 	req.Header.Set("Content-Type", "application/json")
-
-	res, err := c.client.Do(req)
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.EventId)
+	req.Header.Set(AttemptHeader, strconv.Itoa(d.Attempt))
+	req.Header.Set(webhook.SignatureHeader, hook.Signature(time.Now(), body))
+
+	start := time.Now()
+	res, err := client.Do(req)
+	d.LatencyMs = time.Since(start).Milliseconds()
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	// Read response
-	body, _ := ioutil.ReadAll(res.Body)
-	log.Debug("Webhook endpoint '%s' responded with %v", url, body)
+	snippet, _ := io.ReadAll(io.LimitReader(res.Body, webhookdelivery.SnippetSize))
+	d.StatusCode = res.StatusCode
+	d.Response = string(snippet)
+
+	log.Debug("Webhook endpoint '%s' responded %d with %s", hook.Url, res.StatusCode, snippet)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded %d", res.StatusCode)
+	}
 
 	return nil
 }
 
-func createClient(ctx context.Context) *Client {
-	// Set timeout
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, time.Second*20)
-	defer cancel()
+func orgDB(ctx context.Context, org string) *datastore.Datastore {
+	return datastore.NewNamespaced(nscontext.WithNamespace(ctx, org))
+}
+
+// Deliver makes attempt number attempt for one event and re-queues itself
+// with backoff until it succeeds, MaxAttempts is reached or the webhook is
+// disabled. It returns nothing: retries are scheduled here, with their own
+// backoff, rather than by delay's fixed in-process retry.
+var Deliver *delay.Function
 
-	client := &http.Client{
-		Timeout: 20 * time.Second,
+func init() {
+	Deliver = delay.Func("webhook-deliver", deliver)
+}
+
+func deliver(ctx context.Context, org, hookId, eventId, event, body string, attempt int) {
+	db := orgDB(ctx, org)
+
+	hook := webhook.New(db)
+	if err := hook.GetById(hookId); err != nil {
+		log.Warn("Dropping delivery '%s': webhook '%s' not found: %v", eventId, hookId, err, ctx)
+		return
+	}
+
+	if !hook.Enabled {
+		log.Debug("Dropping delivery '%s': webhook '%s' is disabled", eventId, hookId, ctx)
+		return
+	}
+
+	d, err := Send(ctx, db, hook, eventId, event, []byte(body), attempt, false)
+	if err == nil {
+		return
 	}
 
-	return &Client{ctx: ctx, client: client}
+	if attempt >= MaxAttempts || !hook.Enabled {
+		log.Warn("Giving up delivering '%s' to webhook '%s' after %d attempts: %v", eventId, hookId, attempt, err, ctx)
+		return
+	}
+
+	wait := Backoff(attempt)
+	next := time.Now().Add(wait)
+	d.NextRetryAt = &next
+	if err := d.Update(); err != nil {
+		log.Warn("Failed to record retry of delivery '%s': %v", eventId, err, ctx)
+	}
+
+	Deliver.After(wait).Call(ctx, org, hookId, eventId, event, body, attempt+1)
+}
+
+// Replay re-sends a recorded delivery as a single new attempt, with a fresh
+// signature over the original payload. It is not retried.
+func Replay(ctx context.Context, db *datastore.Datastore, hook *webhook.Webhook, prev *webhookdelivery.WebhookDelivery) (*webhookdelivery.WebhookDelivery, error) {
+	if prev.WebhookId != hook.Id() {
+		return nil, errors.New("delivery does not belong to webhook")
+	}
+
+	attempts, err := webhookdelivery.Query(db).Filter("EventId=", prev.EventId).Count()
+	if err != nil {
+		return nil, err
+	}
+
+	return Send(ctx, db, hook, prev.EventId, prev.Event, []byte(prev.Payload), attempts+1, true)
 }
 
 // Fire webhooks
 var Emit = delay.Func("webhook-emit", func(ctx context.Context, org string, event string, data interface{}) {
 	log.JSON(fmt.Sprintf("Emit webhook '%s' for '%s'", event, org), data, ctx)
 
-	db := datastore.New(ctx)
-	db.SetNamespace(org)
+	db := orgDB(ctx, org)
 
 	// Fetch any webhooks for this organization
 	hooks := make([]*webhook.Webhook, 0)
@@ -79,25 +219,24 @@ var Emit = delay.Func("webhook-emit", func(ctx context.Context, org string, even
 		return
 	}
 
-	// Create client to send event data
-	client := createClient(ctx)
+	created := time.Now().Unix()
 
 	for _, hook := range hooks {
-		// Has all events enabled
-		if hook.All {
-			client.Post(hook.Url, Payload{
-				Data:        data,
-				AccessToken: hook.AccessToken,
-			})
+		if !hook.Subscribed(event) {
 			continue
 		}
 
-		// Check if current event is enabled
-		if enabled, ok := hook.Events[event]; ok && enabled {
-			client.Post(hook.Url, Payload{
-				Data:        data,
-				AccessToken: hook.AccessToken,
-			})
-		}
+		// Each webhook gets its own event id and body, so the access token in
+		// one endpoint's payload is never sent to another.
+		eventId := "evt_" + rand.ShortId()
+		body := json.EncodeBytes(Payload{
+			Id:          eventId,
+			Event:       event,
+			Created:     created,
+			Data:        data,
+			AccessToken: hook.AccessToken,
+		})
+
+		Deliver.Call(ctx, org, hook.Id(), eventId, event, string(body), 1)
 	}
 })
@@ -0,0 +1,162 @@
+package tasks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/webhook"
+	"github.com/hanzoai/commerce/models/webhookdelivery"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+func nsDB(parent context.Context, ns string) *datastore.Datastore {
+	return datastore.New(nscontext.WithNamespace(parent, ns))
+}
+
+// endpoint is a receiver that answers status and remembers the last request.
+type endpoint struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.header = r.Header.Clone()
+	e.body, _ = io.ReadAll(r.Body)
+	w.WriteHeader(e.status)
+	w.Write([]byte("received"))
+}
+
+func newHook(t *testing.T, db *datastore.Datastore, url string) *webhook.Webhook {
+	t.Helper()
+	hook := webhook.New(db)
+	hook.Url = url
+	hook.All = true
+	if err := hook.Create(); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	return hook
+}
+
+// TestSend_SignedAndRecorded proves a delivery carries a signature the
+// receiver can verify with the webhook's secret, and leaves a record of the
+// attempt.
+func TestSend_SignedAndRecorded(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+
+	ep := &endpoint{status: 200}
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	hook := newHook(t, db, srv.URL)
+	body := []byte(`{"id":"evt_1","event":"order.paid"}`)
+
+	d, err := Send(c, db, hook, "evt_1", "order.paid", body, 1, false)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if err := webhook.Verify(ep.header.Get(webhook.SignatureHeader), hook.Secret, ep.body, webhook.SignatureTolerance); err != nil {
+		t.Fatalf("receiver could not verify signature: %v", err)
+	}
+	if ep.header.Get(DeliveryHeader) != "evt_1" || ep.header.Get(EventHeader) != "order.paid" {
+		t.Fatalf("delivery headers = %v", ep.header)
+	}
+
+	if d.Status != webhookdelivery.Succeeded || d.StatusCode != 200 || d.Response != "received" {
+		t.Fatalf("delivery record = %+v", d)
+	}
+
+	stored := make([]*webhookdelivery.WebhookDelivery, 0)
+	if _, err := webhookdelivery.Query(db).Filter("WebhookId=", hook.Id()).GetAll(&stored); err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Payload != string(body) {
+		t.Fatalf("stored deliveries = %+v, want the one attempt with its payload", stored)
+	}
+}
+
+// TestSend_Non2xxIsFailure proves the endpoint's status decides the outcome:
+// a 500 is a failed attempt that counts against the webhook.
+func TestSend_Non2xxIsFailure(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+
+	ep := &endpoint{status: 503}
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	hook := newHook(t, db, srv.URL)
+
+	d, err := Send(c, db, hook, "evt_2", "order.paid", []byte(`{}`), 1, false)
+	if err == nil {
+		t.Fatal("send to a 503 endpoint reported success")
+	}
+	if d.Status != webhookdelivery.Failed || d.StatusCode != 503 {
+		t.Fatalf("delivery record = %+v", d)
+	}
+	if hook.ConsecutiveFailures != 1 {
+		t.Fatalf("consecutive failures = %d, want 1", hook.ConsecutiveFailures)
+	}
+}
+
+// TestReplay_ResendsSamePayload proves a replay re-signs and re-sends the
+// original body as a new attempt of the same event.
+func TestReplay_ResendsSamePayload(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := nsDB(c, "acme")
+
+	ep := &endpoint{status: 500}
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	hook := newHook(t, db, srv.URL)
+	body := []byte(`{"id":"evt_3"}`)
+
+	first, _ := Send(c, db, hook, "evt_3", "order.paid", body, 1, false)
+
+	ep.status = 200
+	ep.body = nil
+	replayed, err := Replay(c, db, hook, first)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if string(ep.body) != string(body) {
+		t.Fatalf("replayed body = %s, want %s", ep.body, body)
+	}
+	if !replayed.Replay || replayed.Attempt != 2 || replayed.EventId != "evt_3" {
+		t.Fatalf("replay record = %+v", replayed)
+	}
+	if hook.ConsecutiveFailures != 0 {
+		t.Fatal("successful replay did not clear the failure run")
+	}
+}
+
+func TestBackoff_DoublesToCap(t *testing.T) {
+	if got := Backoff(1); got != RetryBase {
+		t.Fatalf("Backoff(1) = %v, want %v", got, RetryBase)
+	}
+	if got := Backoff(3); got != 4*RetryBase {
+		t.Fatalf("Backoff(3) = %v, want %v", got, 4*RetryBase)
+	}
+	if got := Backoff(30); got != RetryMax {
+		t.Fatalf("Backoff(30) = %v, want cap %v", got, RetryMax)
+	}
+	var total time.Duration
+	for i := 1; i < MaxAttempts; i++ {
+		total += Backoff(i)
+	}
+	if total < time.Hour {
+		t.Fatalf("retry schedule spans %v; too short to ride out a restart", total)
+	}
+}
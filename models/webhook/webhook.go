@@ -1,6 +1,8 @@
 package webhook
 
 import (
+	"time"
+
 	"github.com/hanzoai/commerce/datastore"
 	"github.com/hanzoai/commerce/models/mixin"
 	"github.com/hanzoai/commerce/util/json"
@@ -27,16 +29,46 @@ type Webhook struct {
 	All bool `json:"all"`
 
 	// Random token to check against
-	AccessToken string `json:"accessToken"`
+	AccessToken string `json:"accessToken" audit:"redact"`
 
 	// Events to selectively send.
 	Events  Events `json:"events" datastore:"-" orm:"default:{}"`
 	Events_ string `json:"-" datastore:",noindex"`
 
-	// Whether this webhook is enabled or not.
-	Enabled bool `json:"enabled"`
+	// Whether this webhook is enabled or not. Disabled webhooks receive
+	// nothing; a sustained run of failed deliveries disables one.
+	Enabled bool `json:"enabled" orm:"default:true"`
+
+	// Secret signs every delivery (see SignatureHeader). Generated on first
+	// save and replaced only by RotateSecret. It is never rendered with the
+	// webhook: creating one and rotating it are the two places the API shows
+	// it (see WithSecret).
+	Secret string `json:"-" audit:"redact"`
+
+	// PreviousSecret keeps signing alongside Secret until
+	// PreviousSecretExpiresAt, so a receiver can roll its verifier without
+	// rejecting deliveries made in between.
+	PreviousSecret          string     `json:"-" audit:"redact"`
+	PreviousSecretExpiresAt *time.Time `json:"previousSecretExpiresAt,omitempty"`
+
+	// Delivery health. ConsecutiveFailures counts failed attempts since the
+	// last success and FailingSince is when that run began; together they
+	// decide when the webhook is disabled (see RecordFailure).
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	FailingSince        *time.Time `json:"failingSince,omitempty"`
+	LastDeliveryAt      *time.Time `json:"lastDeliveryAt,omitempty"`
+	DisabledAt          *time.Time `json:"disabledAt,omitempty"`
+	DisabledReason      string     `json:"disabledReason,omitempty"`
+
+	// Revision is the layout the webhook was last saved in. Webhooks saved
+	// before Enabled was honoured are 0 and stored enabled=false whatever
+	// was meant, because nothing read it; see Upgrade.
+	Revision int `json:"-"`
 }
 
+// revision is the Revision every save writes.
+const revision = 1
+
 func (s *Webhook) Load(ps []datastore.Property) (err error) {
 	// Ensure we're initialized
 	if s.Events == nil {
@@ -57,6 +89,12 @@ func (s *Webhook) Load(ps []datastore.Property) (err error) {
 }
 
 func (s *Webhook) Save() (ps []datastore.Property, err error) {
+	// A webhook is never stored unsigned.
+	if s.Secret == "" {
+		s.Secret = NewSecret()
+	}
+	s.Revision = revision
+
 	// Serialize unsupported properties
 	s.Events_ = string(json.EncodeBytes(&s.Events))
 
@@ -64,6 +102,72 @@ func (s *Webhook) Save() (ps []datastore.Property, err error) {
 	return datastore.SaveStruct(s)
 }
 
+// Subscribed reports whether event should be delivered to this webhook.
+func (s *Webhook) Subscribed(event string) bool {
+	if !s.Enabled {
+		return false
+	}
+
+	if s.All {
+		return true
+	}
+
+	enabled, ok := s.Events[event]
+	return ok && enabled
+}
+
+// Keep carries what the server owns of a webhook — its signing secrets, its
+// delivery health and its revision — over from stored, so a full replace
+// through the API changes only what the caller may set.
+func (s *Webhook) Keep(stored *Webhook) {
+	s.Secret = stored.Secret
+	s.PreviousSecret = stored.PreviousSecret
+	s.PreviousSecretExpiresAt = stored.PreviousSecretExpiresAt
+	s.ConsecutiveFailures = stored.ConsecutiveFailures
+	s.FailingSince = stored.FailingSince
+	s.LastDeliveryAt = stored.LastDeliveryAt
+	s.DisabledAt = stored.DisabledAt
+	s.DisabledReason = stored.DisabledReason
+	s.Revision = stored.Revision
+}
+
+// WithSecret renders a webhook with its signing secret, for the responses
+// that hand the secret out.
+type WithSecret struct {
+	*Webhook
+	Secret string `json:"secret"`
+}
+
+// Upgrade enables every webhook in db saved before Revision existed. Those
+// were stored enabled=false by default and delivered to all the same, since
+// Enabled was not read then; honouring it unconverted would silence them. A
+// webhook the delivery health disabled carries DisabledAt and is left alone.
+// It returns how many it saved, and is a no-op once every webhook has been
+// saved since.
+func Upgrade(db *datastore.Datastore) (int, error) {
+	hooks := make([]*Webhook, 0)
+	keys, err := Query(db).GetAll(&hooks)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i, w := range hooks {
+		if w.Revision >= revision {
+			continue
+		}
+		w.Init(db)
+		w.SetKey(keys[i])
+		if w.DisabledAt == nil {
+			w.Enabled = true
+		}
+		if err := w.Update(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
 func New(db *datastore.Datastore) *Webhook {
 	w := new(Webhook)
 	w.Init(db)
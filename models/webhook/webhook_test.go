@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/test/ae"
+)
+
+// TestUpgrade proves a webhook stored before Enabled was honoured is turned
+// on, one the delivery health disabled stays off, and a second pass writes
+// nothing.
+func TestUpgrade(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := datastore.New(nscontext.WithNamespace(c, "acme"))
+
+	// legacy stores w as a webhook saved before Revision existed.
+	legacy := func(w *Webhook) {
+		t.Helper()
+		if err := w.Create(); err != nil {
+			t.Fatalf("create webhook: %v", err)
+		}
+		w.Enabled = false
+		w.Revision = 0
+		if _, err := db.Put(w.Key(), w); err != nil {
+			t.Fatalf("store legacy webhook: %v", err)
+		}
+	}
+
+	quiet := New(db)
+	quiet.All = true
+	legacy(quiet)
+
+	failed := New(db)
+	failed.All = true
+	disabledAt := time.Now()
+	failed.DisabledAt = &disabledAt
+	legacy(failed)
+
+	n, err := Upgrade(db)
+	if err != nil || n != 2 {
+		t.Fatalf("Upgrade = %d, %v; want 2", n, err)
+	}
+
+	for _, tc := range []struct {
+		w    *Webhook
+		want bool
+	}{{quiet, true}, {failed, false}} {
+		got := New(db)
+		if err := got.GetById(tc.w.Id()); err != nil {
+			t.Fatal(err)
+		}
+		if got.Subscribed("order.paid") != tc.want || got.Revision != revision {
+			t.Errorf("upgraded webhook = %+v, want subscribed=%v", got, tc.want)
+		}
+	}
+
+	if n, err := Upgrade(db); err != nil || n != 0 {
+		t.Fatalf("second Upgrade = %d, %v; want 0", n, err)
+	}
+}
+
+// TestKeep proves a full replace keeps the signing secret and the delivery
+// health it cannot set.
+func TestKeep(t *testing.T) {
+	disabledAt := time.Now()
+	stored := &Webhook{Secret: NewSecret(), ConsecutiveFailures: 3, DisabledAt: &disabledAt, Revision: revision}
+
+	w := &Webhook{Url: "https://example.com/hook", Enabled: true}
+	w.Keep(stored)
+	if w.Secret != stored.Secret || w.ConsecutiveFailures != 3 || w.DisabledAt != stored.DisabledAt || w.Url != "https://example.com/hook" {
+		t.Fatalf("kept webhook = %+v", w)
+	}
+}
+
+// TestRecordDelivery proves an attempt's health lands on the webhook as it is
+// stored now: a secret rotated while the attempt ran is kept, and attempts
+// recorded together are each counted.
+func TestRecordDelivery(t *testing.T) {
+	c := ae.NewContext()
+	defer c.Close()
+	db := datastore.New(nscontext.WithNamespace(c, "acme"))
+
+	w := New(db)
+	w.All = true
+	if err := w.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotated by the API while a delivery, holding the old copy, is posting.
+	rotated := New(db)
+	if err := rotated.GetById(w.Id()); err != nil {
+		t.Fatal(err)
+	}
+	rotated.RotateSecret(time.Hour)
+	if err := rotated.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			if _, _, err := RecordDelivery(db, w.Id(), false); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := New(db)
+	if err := got.GetById(w.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != rotated.Secret || got.PreviousSecret != w.Secret {
+		t.Errorf("secret reverted by the health save")
+	}
+	if got.ConsecutiveFailures != n {
+		t.Errorf("consecutive failures = %d, want %d", got.ConsecutiveFailures, n)
+	}
+}
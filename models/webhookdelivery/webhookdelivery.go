@@ -0,0 +1,78 @@
+// Package webhookdelivery records every attempt to deliver an event to a
+// webhook endpoint: what was sent, when, what came back and how long it took.
+// One event that needs three attempts leaves three records sharing an
+// EventId, so the history of a delivery reads top to bottom and any one
+// attempt can be replayed byte for byte from its stored Payload.
+package webhookdelivery
+
+import (
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/orm"
+)
+
+func init() { orm.Register[WebhookDelivery]("webhook-delivery") }
+
+type Status string
+
+const (
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+)
+
+// SnippetSize bounds how much of the endpoint's response body is kept.
+const SnippetSize = 1024
+
+type WebhookDelivery struct {
+	mixin.Model[WebhookDelivery]
+
+	WebhookId string `json:"webhookId"`
+
+	// EventId identifies the event across its attempts and is sent to the
+	// endpoint as X-Hanzo-Delivery, so a receiver can de-duplicate retries.
+	EventId string `json:"eventId"`
+	Event   string `json:"event"`
+	Url     string `json:"url"`
+
+	// Attempt is 1 for the first try of an event and counts up with each
+	// retry. A manual replay is recorded with Replay set and its own count.
+	Attempt int  `json:"attempt"`
+	Replay  bool `json:"replay,omitempty"`
+
+	Status     Status `json:"status"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+
+	// Response is the first SnippetSize bytes of the endpoint's reply.
+	Response string `json:"response,omitempty" datastore:",noindex"`
+
+	// Payload is the exact body that was signed and sent.
+	Payload string `json:"payload" datastore:",noindex"`
+
+	// NextRetryAt is set on a failed attempt that has another one scheduled.
+	NextRetryAt *time.Time `json:"nextRetryAt,omitempty"`
+}
+
+func (d *WebhookDelivery) Load(ps []datastore.Property) error {
+	return datastore.LoadStruct(d, ps)
+}
+
+func (d *WebhookDelivery) Save() ([]datastore.Property, error) {
+	if len(d.Response) > SnippetSize {
+		d.Response = d.Response[:SnippetSize]
+	}
+	return datastore.SaveStruct(d)
+}
+
+func New(db *datastore.Datastore) *WebhookDelivery {
+	d := new(WebhookDelivery)
+	d.Init(db)
+	return d
+}
+
+func Query(db *datastore.Datastore) datastore.Query {
+	return db.Query("webhook-delivery")
+}
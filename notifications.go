@@ -0,0 +1,26 @@
+package commerce
+
+import (
+	"context"
+	"fmt"
+
+	commerceDatastore "github.com/hanzoai/commerce/datastore"
+	orgModel "github.com/hanzoai/commerce/models/organization"
+)
+
+// startNotificationDispatcher starts the dispatcher Bootstrap built.
+func (app *App) startNotificationDispatcher() {
+	if app.notifications != nil {
+		app.notifications.Start()
+	}
+}
+
+// orgs lists every org. The notification dispatcher needs the orgs
+// themselves, for the email and other integrations it sends through.
+func (app *App) orgs(ctx context.Context) ([]*orgModel.Organization, error) {
+	orgs := make([]*orgModel.Organization, 0)
+	if _, err := orgModel.Query(commerceDatastore.New(ctx)).GetAll(&orgs); err != nil {
+		return nil, fmt.Errorf("list orgs: %w", err)
+	}
+	return orgs, nil
+}
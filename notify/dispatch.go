@@ -0,0 +1,327 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/lock"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/scheduler"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// MaxAttempts is how many times a notification is tried before it is given
+// up on as Failed.
+const MaxAttempts = 8
+
+// Backoff is how long after its attempt-th failed attempt a notification is
+// tried again: a minute, doubling each time, to at most six hours. The
+// MaxAttempts attempts span a little over two hours, long enough to outlast
+// most provider outages without telling a customer about an order a day late.
+func Backoff(attempt int) time.Duration {
+	const ceiling = 6 * time.Hour
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 10 {
+		return ceiling
+	}
+	d := time.Minute << (attempt - 1)
+	if d > ceiling {
+		return ceiling
+	}
+	return d
+}
+
+// Deliver tries to send the notification with id, if it is still pending and
+// due at now, and records the outcome on it: Sent with the provider's id for
+// it, Skipped when its recipient opted out, or a failed attempt, retried
+// after Backoff until MaxAttempts and Failed after. A failure that retrying
+// will not fix — no template, no provider, a permanent provider error —
+// fails it at once. It returns whether it was sent, and the error of the
+// attempt, which has already been recorded.
+func Deliver(ctx context.Context, db *datastore.Datastore, org *organization.Organization, id string, now time.Time) (bool, error) {
+	// A resend racing the dispatcher must not send it twice.
+	unlock, err := lock.Hold(db, "notification", id)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	n := notification.New(db)
+	if err := n.GetById(id); err != nil {
+		return false, err
+	}
+	if n.Status != notification.Pending || n.NextAttemptAt.After(now) {
+		return false, nil
+	}
+
+	sendErr := send(ctx, db, org, n)
+	n.Attempts++
+	switch {
+	case sendErr == nil:
+		n.Status = notification.Sent
+		n.SentAt = now
+		n.LastError = ""
+		n.NextAttemptAt = time.Time{}
+	case errors.Is(sendErr, ErrOptedOut):
+		n.Status = notification.Skipped
+		n.LastError = sendErr.Error()
+	case permanent(sendErr) || n.Attempts >= MaxAttempts:
+		n.Status = notification.Failed
+		n.LastError = sendErr.Error()
+	default:
+		n.LastError = sendErr.Error()
+		n.NextAttemptAt = now.Add(Backoff(n.Attempts))
+	}
+
+	if err := n.Update(); err != nil {
+		// Sent but not recorded: the next pass sends it again. Better twice
+		// than an order confirmation never.
+		return false, err
+	}
+	if errors.Is(sendErr, ErrOptedOut) {
+		return false, nil
+	}
+	return sendErr == nil, sendErr
+}
+
+func permanent(err error) bool {
+	return errors.Is(err, ErrPermanent) ||
+		errors.Is(err, ErrNoProvider) ||
+		errors.Is(err, ErrNoTemplate) ||
+		errors.Is(err, ErrNoRecipient)
+}
+
+// send renders n and sends it through its provider, setting ProviderId and
+// ExternalId on n.
+func send(ctx context.Context, db *datastore.Datastore, org *organization.Organization, n *notification.Notification) error {
+	if n.To == "" {
+		return ErrNoRecipient
+	}
+
+	out, err := OptedOut(db, n)
+	if err != nil {
+		return err
+	}
+	if out {
+		return ErrOptedOut
+	}
+
+	m, err := message(db, n)
+	if err != nil {
+		return err
+	}
+
+	p, name, err := Open(ctx, org, n.Channel, n.ProviderId)
+	if err != nil {
+		return err
+	}
+	n.ProviderId = name
+
+	id, err := p.Send(ctx, m)
+	if err != nil {
+		return err
+	}
+	n.ExternalId = id
+	return nil
+}
+
+// message renders n from its template, or from its data when it names none.
+func message(db *datastore.Datastore, n *notification.Notification) (*Message, error) {
+	if n.TemplateId == "" {
+		return Render(nil, n)
+	}
+	t, err := Template(db, n)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Render(t, n)
+	if err != nil {
+		// A template that does not render never will.
+		return nil, Permanent(err)
+	}
+	return m, nil
+}
+
+// MaxAge is how old a pending notification can be and still be delivered
+// by Drain. One older is news nobody wants any more, or was queued before
+// there was a dispatcher to send it, and is left pending; a resend still
+// delivers it.
+const MaxAge = 24 * time.Hour
+
+// Drain delivers the pending notifications of one org that are due at now
+// and younger than MaxAge, most overdue first, at most limit of them (no
+// limit when limit <= 0). It returns how many were sent; a notification that
+// fails is recorded for retry and the rest are delivered regardless.
+func Drain(ctx context.Context, db *datastore.Datastore, org *organization.Organization, now time.Time, limit int) (int, error) {
+	q := notification.Query(db).
+		Filter("Status=", notification.Pending).
+		Filter("NextAttemptAt<=", now).
+		Filter("CreatedAt>=", now.Add(-MaxAge)).
+		Order("NextAttemptAt")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	var pending []*notification.Notification
+	if _, err := q.GetAll(&pending); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, n := range pending {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		ok, err := Deliver(ctx, db, org, n.Id(), now)
+		if ok {
+			sent++
+		} else if err != nil {
+			log.Warn("notify: %s %s to %s: %v", n.Channel, n.Id(), n.To, err, ctx)
+		}
+	}
+	return sent, nil
+}
+
+// Dispatcher drains every org's pending notifications on an interval, on
+// one replica at a time.
+type Dispatcher struct {
+	// Orgs returns the orgs to drain. It is called once per pass, so an org
+	// created since the last is drained on the next.
+	Orgs func(ctx context.Context) ([]*organization.Organization, error)
+
+	// Interval is the time between passes; Batch the most notifications one
+	// org has tried per pass, so one org's backlog does not hold up the
+	// others' for long.
+	Interval time.Duration
+	Batch    int
+
+	// Locker elects the replica that dispatches: a pass runs only under its
+	// lock, and is skipped while another replica holds it. With no Locker
+	// every replica dispatches.
+	Locker scheduler.Locker
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher over orgs, passing every ten seconds
+// and trying up to a hundred notifications of an org a pass.
+func NewDispatcher(orgs func(ctx context.Context) ([]*organization.Organization, error)) *Dispatcher {
+	return &Dispatcher{Orgs: orgs, Interval: 10 * time.Second, Batch: 100}
+}
+
+// dispatchLockTTL is how long a pass holds the dispatcher's lock, and so
+// the longest it runs: what it has not sent by then waits for the next.
+const dispatchLockTTL = 5 * time.Minute
+
+// Dispatch runs one pass, under the dispatcher's lock, and returns how many
+// notifications it sent. A pass another replica is running is skipped. An
+// org whose drain fails is logged and left for the next pass.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	if d.Locker != nil {
+		lock, err := d.Locker.Acquire(ctx, "notify:dispatch", dispatchLockTTL)
+		if errors.Is(err, scheduler.ErrHeld) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+				log.Warn("notify: release dispatch lock: %v", err, ctx)
+			}
+		}()
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dispatchLockTTL)
+		defer cancel()
+	}
+
+	orgs, err := d.Orgs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	now := time.Now()
+	for _, org := range orgs {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		ns := org.Namespace()
+		if ns == "" {
+			continue
+		}
+		n, err := Drain(ctx, datastore.New(nscontext.WithNamespace(ctx, ns)), org, now, d.Batch)
+		sent += n
+		if err != nil {
+			log.Error("notify: drain %s: %v", ns, err, ctx)
+		}
+	}
+	return sent, nil
+}
+
+// Start runs passes until Stop. It is a no-op when the dispatcher is already
+// running.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running {
+		return
+	}
+	d.running = true
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+
+	go d.loop(d.stop, d.done)
+}
+
+func (d *Dispatcher) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		if n, err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			log.Error("notify: dispatch: %v", err, ctx)
+		} else if n > 0 {
+			log.Info("notify: sent %d notifications", n, ctx)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(d.Interval):
+		}
+	}
+}
+
+// Stop ends the loop and waits for the notification being sent to be
+// recorded.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return
+	}
+	d.running = false
+	stop, done := d.stop, d.done
+	d.mu.Unlock()
+
+	close(stop)
+	<-done
+}
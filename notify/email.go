@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/hanzoai/commerce/config"
+	"github.com/hanzoai/commerce/email/tasks"
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/types/email"
+)
+
+func init() { Register(notification.Email, "email", openEmail) }
+
+// emailProvider sends through an org's email integration, as the rest of
+// commerce's email is sent.
+type emailProvider struct {
+	sender  email.Sender
+	from    email.Email
+	replyTo email.Email
+}
+
+// openEmail opens the email integration of org, or the one configured for
+// the platform when org has none, sending from the org's default sender.
+func openEmail(ctx context.Context, org *organization.Organization) (Provider, error) {
+	in := &config.Email.Provider
+	from, replyTo := config.Email.From, config.Email.ReplyTo
+	if org != nil {
+		if found, err := org.Integrations.EmailProvider(); err == nil && found != nil {
+			in = found
+		}
+		if org.Email.Defaults.From.Address != "" {
+			from = org.Email.Defaults.From
+		}
+		if org.Email.Defaults.ReplyTo.Address != "" {
+			replyTo = org.Email.Defaults.ReplyTo
+		}
+	}
+
+	sender, err := tasks.Sender(ctx, *in)
+	if err != nil {
+		return nil, err
+	}
+	return &emailProvider{sender: sender, from: from, replyTo: replyTo}, nil
+}
+
+func (p *emailProvider) Send(ctx context.Context, m *Message) (string, error) {
+	msg := email.NewMessage()
+	msg.Subject = m.Subject
+	msg.From = p.from
+	msg.ReplyTo = p.replyTo
+	if m.From.Address != "" {
+		msg.From = m.From
+	}
+	if m.ReplyTo.Address != "" {
+		msg.ReplyTo = m.ReplyTo
+	}
+	msg.AddTos(email.Email{Address: m.To})
+	msg.Text = m.Body
+	msg.HTML = m.HTML
+	if msg.HTML == "" {
+		// The SMTP relay sends HTML only.
+		msg.HTML = strings.ReplaceAll(html.EscapeString(m.Body), "\n", "<br>\n")
+	}
+	msg.Tags = append(msg.Tags, "notification")
+
+	if s, ok := p.sender.(email.IdSender); ok {
+		return s.SendId(msg)
+	}
+	return "", p.sender.Send(msg)
+}
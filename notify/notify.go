@@ -0,0 +1,140 @@
+// Package notify delivers notifications (models/notification): it renders
+// each pending one from its org's template in the recipient's language,
+// skips those its recipient opted out of, and sends the rest through the
+// provider for their channel, retrying failures with backoff until one goes
+// through or MaxAttempts is reached. The provider's id for what it sent is
+// kept on the notification as its ExternalId.
+//
+// Providers are registered per channel by name (see Register). Email is
+// sent through the org's own email integration — SendGrid, Mandrill or the
+// SMTP relay — as every other email is; SMS and push have no provider until
+// one is registered. A Sink stands in for all of them where nothing should
+// really be sent, in tests and development.
+//
+// Nothing in a request waits on delivery: creating a notification queues
+// it, and the Dispatcher drains the queue of every org on an interval.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/types/email"
+)
+
+var (
+	// ErrNoProvider is returned for a channel, or a provider name, nothing
+	// is registered for.
+	ErrNoProvider = errors.New("notify: no provider")
+
+	// ErrNoTemplate is returned for a notification whose template the org
+	// does not have, in any language.
+	ErrNoTemplate = errors.New("notify: no such template")
+
+	// ErrNoRecipient is returned for a notification with nobody to send to.
+	ErrNoRecipient = errors.New("notify: no recipient")
+
+	// ErrOptedOut is what Deliver records on a notification its recipient
+	// opted out of.
+	ErrOptedOut = errors.New("notify: recipient opted out")
+
+	// ErrPermanent marks a failure that trying again will not fix, such as a
+	// number that cannot receive SMS. Providers wrap what they return in it
+	// (see Permanent); the notification fails at once instead of retrying.
+	ErrPermanent = errors.New("notify: permanent failure")
+)
+
+// Permanent marks err as a failure not worth retrying.
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// Message is a notification rendered for its channel.
+type Message struct {
+	NotificationId string               `json:"notificationId"`
+	Channel        notification.Channel `json:"channel"`
+
+	// To is the email address, phone number or device token sent to.
+	To string `json:"to"`
+
+	// From and ReplyTo are the org's email defaults; email only.
+	From    email.Email `json:"from,omitempty"`
+	ReplyTo email.Email `json:"replyTo,omitempty"`
+
+	// Subject is an email's subject or a push's title; Body the text of an
+	// SMS, a push or a plain-text email; HTML an email's HTML.
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+	HTML    string `json:"html,omitempty"`
+
+	// Data is the notification's data, for providers that send some of it
+	// along, as push payloads do.
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Provider sends messages on one channel.
+type Provider interface {
+	// Send sends m and returns the provider's id for what it sent, or ""
+	// if it gives none.
+	Send(ctx context.Context, m *Message) (string, error)
+}
+
+// Factory opens the provider of one org, with the credentials in its
+// integrations.
+type Factory func(ctx context.Context, org *organization.Organization) (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[notification.Channel]map[string]Factory{}
+	defaults    = map[notification.Channel]string{}
+)
+
+// Register makes f open the provider named name on channel, replacing any
+// registered under that name before. The first provider registered on a
+// channel is its default until SetDefault says otherwise. Adapters register
+// themselves from init.
+func Register(channel notification.Channel, name string, f Factory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if providers[channel] == nil {
+		providers[channel] = map[string]Factory{}
+	}
+	providers[channel][name] = f
+	if defaults[channel] == "" {
+		defaults[channel] = name
+	}
+}
+
+// SetDefault makes the provider named name the one channel sends through
+// when a notification names none.
+func SetDefault(channel notification.Channel, name string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	defaults[channel] = name
+}
+
+// Open opens the provider named name on channel for org; no name is the
+// channel's default.
+func Open(ctx context.Context, org *organization.Organization, channel notification.Channel, name string) (Provider, string, error) {
+	providersMu.RLock()
+	if name == "" {
+		name = defaults[channel]
+	}
+	f, ok := providers[channel][name]
+	providersMu.RUnlock()
+	if !ok {
+		if name == "" {
+			return nil, "", fmt.Errorf("%w for %s", ErrNoProvider, channel)
+		}
+		return nil, "", fmt.Errorf("%w named %q for %s", ErrNoProvider, name, channel)
+	}
+	p, err := f(ctx, org)
+	if err != nil {
+		return nil, "", err
+	}
+	return p, name, nil
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/notificationpreference"
+	"github.com/hanzoai/commerce/models/notificationtemplate"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/scheduler"
+)
+
+func TestPick(t *testing.T) {
+	def := &notificationtemplate.NotificationTemplate{Name: "default", IsEnabled: true}
+	fr := &notificationtemplate.NotificationTemplate{Name: "fr", Locale: "fr", IsEnabled: true}
+	frCA := &notificationtemplate.NotificationTemplate{Name: "fr-CA", Locale: "fr_ca", IsEnabled: true}
+	de := &notificationtemplate.NotificationTemplate{Name: "de", Locale: "de", IsEnabled: false}
+	ts := []*notificationtemplate.NotificationTemplate{def, fr, frCA, de}
+
+	for locale, want := range map[string]*notificationtemplate.NotificationTemplate{
+		"fr-CA": frCA,
+		"FR-ca": frCA,
+		"fr-BE": fr,
+		"fr":    fr,
+		"de":    def,
+		"":      def,
+	} {
+		if got := Pick(ts, locale); got != want {
+			t.Errorf("Pick(%q) = %v, want %s", locale, got, want.Name)
+		}
+	}
+
+	if got := Pick([]*notificationtemplate.NotificationTemplate{fr}, "en"); got != nil {
+		t.Errorf("Pick without a default = %s, want nil", got.Name)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{
+		0:  time.Minute,
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		9:  6 * time.Hour,
+		64: 6 * time.Hour,
+	} {
+		if got := Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestOptedOut(t *testing.T) {
+	p := &notificationpreference.NotificationPreference{
+		Channels: []notification.Channel{notification.SMS},
+		Topics:   []string{"marketing"},
+	}
+	for _, c := range []struct {
+		channel notification.Channel
+		topic   string
+		want    bool
+	}{
+		{notification.SMS, "order", true},
+		{notification.Email, "marketing", true},
+		{notification.Email, "order", false},
+		{notification.Push, "", false},
+	} {
+		if got := p.OptedOut(c.channel, c.topic); got != c.want {
+			t.Errorf("OptedOut(%s, %q) = %v, want %v", c.channel, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent.jsonl")
+	s := NewSink(path)
+
+	for _, to := range []string{"a@example.com", "+15555550100"} {
+		if _, err := s.Send(context.Background(), &Message{Channel: notification.Email, To: to, Subject: "Hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var line struct {
+			Id string `json:"id"`
+			To string `json:"to"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, line.Id)
+	}
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("sink wrote ids %v, want two distinct", ids)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, _, err := Open(context.Background(), nil, notification.Channel("pager"), ""); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("unregistered channel = %v, want ErrNoProvider", err)
+	}
+	if !permanent(Permanent(errors.New("unreachable number"))) {
+		t.Errorf("Permanent error not treated as permanent")
+	}
+
+	UseSink("")
+	defer SetDefault(notification.Email, "email")
+	p, name, err := Open(context.Background(), nil, notification.SMS, "")
+	if err != nil || name != "sink" {
+		t.Fatalf("Open sms = %v, %q, %v; want the sink", p, name, err)
+	}
+}
+
+// elector holds the dispatch lock for one replica: held is whether another
+// has it.
+type elector struct {
+	held     bool
+	released int
+}
+
+func (e *elector) Acquire(context.Context, string, time.Duration) (scheduler.Lock, error) {
+	if e.held {
+		return nil, scheduler.ErrHeld
+	}
+	return e, nil
+}
+func (e *elector) Extend(context.Context, time.Duration) error { return nil }
+func (e *elector) Release(context.Context) error {
+	e.released++
+	return nil
+}
+
+// Only the replica holding the dispatcher's lock reads the orgs' queues.
+func TestDispatch_Elected(t *testing.T) {
+	passes := 0
+	d := NewDispatcher(func(context.Context) ([]*organization.Organization, error) {
+		passes++
+		return nil, nil
+	})
+	e := &elector{held: true}
+	d.Locker = e
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if passes != 0 {
+		t.Errorf("passes while another replica dispatches = %d, want 0", passes)
+	}
+
+	e.held = false
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if passes != 1 || e.released != 1 {
+		t.Errorf("passes = %d, released = %d; want 1 and 1", passes, e.released)
+	}
+}
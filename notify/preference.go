@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/notificationpreference"
+)
+
+// OptedOut reports whether n's recipient opted out of its channel or its
+// topic. A customer's preferences are found by their user id; a guest's, or
+// a customer's kept by address before they signed up, by the address n is
+// sent to.
+func OptedOut(db *datastore.Datastore, n *notification.Notification) (bool, error) {
+	prefs := make([]*notificationpreference.NotificationPreference, 0)
+	if n.UserId != "" {
+		if _, err := notificationpreference.Query(db).Filter("UserId=", n.UserId).GetAll(&prefs); err != nil {
+			return false, err
+		}
+	}
+	if n.To != "" {
+		byAddress := make([]*notificationpreference.NotificationPreference, 0)
+		if _, err := notificationpreference.Query(db).Filter("Address=", n.To).GetAll(&byAddress); err != nil {
+			return false, err
+		}
+		prefs = append(prefs, byAddress...)
+	}
+
+	for _, p := range prefs {
+		if p.OptedOut(n.Channel, n.Topic) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
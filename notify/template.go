@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aymerick/raymond"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/notification"
+	"github.com/hanzoai/commerce/models/notificationtemplate"
+)
+
+// Pick returns the template, of ts, written closest to locale: one in locale
+// itself, else in its language ("fr" for "fr-CA"), else the default, written
+// in none. Tags are compared without regard to case or to "_" for "-". It
+// returns nil when none of them will do.
+func Pick(ts []*notificationtemplate.NotificationTemplate, locale string) *notificationtemplate.NotificationTemplate {
+	for _, want := range fallbacks(locale) {
+		for _, t := range ts {
+			if t.IsEnabled && normalize(t.Locale) == want {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// fallbacks is locale and each shorter tag it falls back to, ending with "".
+func fallbacks(locale string) []string {
+	tag := normalize(locale)
+	out := make([]string, 0, 3)
+	for tag != "" {
+		out = append(out, tag)
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return append(out, "")
+}
+
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// Template loads the template n is rendered with, in the locale closest to
+// n's. It returns ErrNoTemplate when the org has none by that name for n's
+// channel.
+func Template(db *datastore.Datastore, n *notification.Notification) (*notificationtemplate.NotificationTemplate, error) {
+	ts := make([]*notificationtemplate.NotificationTemplate, 0)
+	_, err := notificationtemplate.Query(db).
+		Filter("Name=", n.TemplateId).
+		Filter("Channel=", n.Channel).
+		GetAll(&ts)
+	if err != nil {
+		return nil, err
+	}
+	t := Pick(ts, n.Locale)
+	if t == nil {
+		return nil, fmt.Errorf("%w: %q for %s", ErrNoTemplate, n.TemplateId, n.Channel)
+	}
+	return t, nil
+}
+
+// Render fills t in with n's data. A notification without a template is
+// rendered from its data alone, which then carries the "subject", "body"
+// and "html" to send as they are.
+func Render(t *notificationtemplate.NotificationTemplate, n *notification.Notification) (*Message, error) {
+	m := &Message{
+		NotificationId: n.Id(),
+		Channel:        n.Channel,
+		To:             n.To,
+		Data:           n.Data,
+	}
+
+	if t == nil {
+		m.Subject, _ = n.Data["subject"].(string)
+		m.Body, _ = n.Data["body"].(string)
+		m.HTML, _ = n.Data["html"].(string)
+		return m, nil
+	}
+
+	ctx := map[string]interface{}{}
+	for k, v := range n.Data {
+		ctx[k] = v
+	}
+	ctx["notification"] = map[string]interface{}{
+		"id":     n.Id(),
+		"to":     n.To,
+		"topic":  n.Topic,
+		"locale": n.Locale,
+	}
+
+	var err error
+	if m.Subject, err = render(t.Subject, ctx); err != nil {
+		return nil, fmt.Errorf("render %q subject: %w", t.Name, err)
+	}
+	if m.Body, err = render(t.Body, ctx); err != nil {
+		return nil, fmt.Errorf("render %q body: %w", t.Name, err)
+	}
+	if m.HTML, err = render(t.HTML, ctx); err != nil {
+		return nil, fmt.Errorf("render %q html: %w", t.Name, err)
+	}
+	return m, nil
+}
+
+func render(source string, ctx map[string]interface{}) (string, error) {
+	if source == "" {
+		return "", nil
+	}
+	return raymond.Render(source, ctx)
+}
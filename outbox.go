@@ -0,0 +1,158 @@
+package commerce
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	commerceDatastore "github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/events/outbox"
+	orgModel "github.com/hanzoai/commerce/models/organization"
+)
+
+// newOutboxRelay builds the relay for the configured sink, or returns nil when
+// no sink is configured.
+//
+// No sink is not an error and loses nothing: events are written with their
+// changes regardless, and wait in the outbox for a process that has a sink to
+// drain them. What it does mean is that nothing is being published, so it is
+// said once, at boot.
+//
+// OutboxSink names the sink: "pubsub" for the COMMERCE JetStream stream over
+// the existing PubSub client, or an http(s) URL to POST each event to, signed
+// with OutboxSecret. A Kafka or other broker sink takes a Producer, which is
+// code rather than configuration; an embedding host builds its own Relay with
+// outbox.BrokerSink and the same Stores.
+func (app *App) newOutboxRelay() (*outbox.Relay, error) {
+	commerceDatastore.SetOutboxNotify(app.outboxScope.written)
+
+	sinkName := strings.TrimSpace(app.config.OutboxSink)
+
+	var sink outbox.Sink
+	switch {
+	case sinkName == "":
+		fmt.Println("Commerce: event outbox has no sink (COMMERCE_OUTBOX_SINK unset); events are kept until one drains them")
+		return nil, nil
+	case sinkName == "pubsub":
+		pubsub, err := app.Infra.PubSub()
+		if err != nil {
+			return nil, fmt.Errorf("COMMERCE_OUTBOX_SINK=pubsub but PubSub is unavailable: %w", err)
+		}
+		sink = &outbox.PubSubSink{PubSub: pubsub}
+	case strings.HasPrefix(sinkName, "http://") || strings.HasPrefix(sinkName, "https://"):
+		sink = outbox.NewHTTPSink(sinkName, app.config.OutboxSecret)
+	default:
+		return nil, fmt.Errorf("COMMERCE_OUTBOX_SINK=%q: want \"pubsub\" or an http(s) URL", sinkName)
+	}
+
+	return outbox.NewRelay(sink, app.OutboxStores), nil
+}
+
+// startOutboxRelay starts the relay Bootstrap built, if it built one.
+func (app *App) startOutboxRelay() {
+	if app.relay != nil {
+		app.relay.Start()
+	}
+}
+
+// outboxSweepEvery is how often the relay walks every org's store, not only
+// those this process saw write events. It finds what another replica wrote,
+// or what was written before this process started.
+const outboxSweepEvery = 5 * time.Minute
+
+// outboxActiveFor is how long an org's store is walked on every pass after it
+// last wrote an event: as long as the relay's longest backoff, so that an
+// event put back after a failed publish is retried when it is due.
+const outboxActiveFor = 10 * time.Minute
+
+// outboxScope records which org stores have written events lately.
+type outboxScope struct {
+	mu     sync.Mutex
+	swept  time.Time
+	active map[string]time.Time // org namespace -> last event written
+}
+
+// written notes that ns wrote an event. It is the datastore's outbox notify.
+func (s *outboxScope) written(ns string) {
+	if ns == "" {
+		return
+	}
+	s.mu.Lock()
+	if s.active == nil {
+		s.active = make(map[string]time.Time)
+	}
+	s.active[ns] = time.Now()
+	s.mu.Unlock()
+}
+
+// namespaces returns the org namespaces to walk now, and whether that is a
+// sweep of every org, due when it returns nil.
+func (s *outboxScope) namespaces(now time.Time) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.swept) >= outboxSweepEvery {
+		s.swept = now
+		return nil, true
+	}
+	out := make([]string, 0, len(s.active))
+	for ns, at := range s.active {
+		if now.Sub(at) > outboxActiveFor {
+			delete(s.active, ns)
+			continue
+		}
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out, false
+}
+
+// OutboxStores lists the stores an event can be waiting in: the system store,
+// which holds billing's invoices, subscriptions and refunds, and the org
+// stores, which hold their orders. It is the relay's Stores.
+//
+// Listing every org and opening its store on each one-second pass would cost
+// more than the relay does, so a pass walks the orgs that have written an
+// event in the last outboxActiveFor, and every outboxSweepEvery it walks them
+// all. An event written by another replica, or before this process started,
+// therefore goes out within outboxSweepEvery.
+//
+// An org whose store cannot be opened is skipped for this pass rather than
+// failing it; its events wait, and the next sweep tries again.
+func (app *App) OutboxStores(ctx context.Context) ([]db.Outbox, error) {
+	root := commerceDatastore.New(ctx)
+
+	var stores []db.Outbox
+	if o, ok := root.DB().(db.Outbox); ok {
+		stores = append(stores, o)
+	}
+	if app.DB == nil {
+		return stores, nil
+	}
+
+	namespaces, sweep := app.outboxScope.namespaces(time.Now())
+	if sweep {
+		orgs := make([]*orgModel.Organization, 0)
+		if _, err := orgModel.Query(root).GetAll(&orgs); err != nil {
+			return stores, fmt.Errorf("list orgs for the outbox: %w", err)
+		}
+		for _, org := range orgs {
+			if ns := org.Namespace(); ns != "" {
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+	for _, ns := range namespaces {
+		odb, err := app.DB.Org(ns)
+		if err != nil {
+			continue
+		}
+		if o, ok := odb.(db.Outbox); ok {
+			stores = append(stores, o)
+		}
+	}
+	return stores, nil
+}
@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/payment/router"
+)
+
+// RouterForOrg builds a payment router over the org's own processors
+// (ProcessorsForOrg) from its PaymentRouting settings. The same kms.Hydrate
+// precondition applies.
+//
+// The settings are validated here, against the processors this org can
+// actually charge through, and an org whose settings do not validate gets an
+// error rather than a router. Settings are validated when they are saved too,
+// but a processor can lose its credentials, or be put on the deny list, after
+// the rule that names it was written; a rule that silently stopped applying
+// would route that traffic somewhere finance never chose.
+//
+// Processors left empty means every processor the org has, in the registry's
+// priority order.
+//
+// The router is built afresh over the org's current credentials each time, but
+// it is not a stranger: it carries on the breakers of the org's last router
+// (router.Carry), so a processor that is failing stays cut off from one
+// payment to the next. Every org's router records its outcomes into one
+// process-wide router, installed with router.SetDefault, which the adaptive
+// strategy scores on and the router stats report.
+func RouterForOrg(org *organization.Organization) (*router.Router, error) {
+	reg := ProcessorsForOrg(org)
+	cfg, err := RouterConfigForOrg(org, reg)
+	if err != nil {
+		return nil, err
+	}
+	r := router.NewRouter(reg, cfg)
+
+	routersMu.Lock()
+	defer routersMu.Unlock()
+	if prev, ok := routers[org.Id()]; ok {
+		r.Carry(prev)
+	} else {
+		r.Carry(processRouter)
+	}
+	routers[org.Id()] = r
+	return r, nil
+}
+
+// processRouter routes nothing itself. It holds the outcomes every org's
+// router records: how a processor does with a currency and card brand is a
+// fact about the processor, and one org alone seldom makes enough payments in
+// a window for its numbers to be trusted.
+var processRouter = router.NewRouter(processor.NewRegistry(processor.DefaultConfig()), router.Config{Strategy: router.Adaptive})
+
+// routers is each org's last router, by org id, for the next to carry on.
+var (
+	routersMu sync.Mutex
+	routers   = make(map[string]*router.Router)
+)
+
+func init() {
+	router.SetDefault(processRouter)
+}
+
+// RouterConfigForOrg resolves and validates the org's routing settings against
+// reg. It is RouterForOrg without the router, for callers that only need to
+// know the settings are good.
+func RouterConfigForOrg(org *organization.Organization, reg *processor.Registry) (router.Config, error) {
+	cfg := org.PaymentRouting.Config()
+
+	var errs []error
+	if len(cfg.Processors) == 0 {
+		for _, pt := range processor.DefaultConfig().ProcessorPriority {
+			if _, err := reg.Get(pt); err == nil {
+				cfg.Processors = append(cfg.Processors, pt)
+			}
+		}
+	} else {
+		for _, pt := range cfg.Processors {
+			if _, err := reg.Get(pt); err != nil {
+				errs = append(errs, fmt.Errorf("processors: %w", err))
+			}
+		}
+	}
+	if cfg.Primary != "" {
+		if _, err := reg.Get(cfg.Primary); err != nil {
+			errs = append(errs, fmt.Errorf("primary: %w", err))
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return router.Config{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,62 @@
+package payment
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+	"github.com/hanzoai/commerce/payment/router"
+)
+
+// With no Processors of its own the router gets what the org can charge
+// through, and Stripe, denied by default, is not among them.
+func TestRouterForOrg_DefaultProcessors(t *testing.T) {
+	ensureDefaultProcessorPolicy(t)
+	org := orgWithSquareCreds()
+	org.Live = true
+	org.Stripe.Live.AccessToken = "sk_live"
+
+	cfg, err := RouterConfigForOrg(org, ProcessorsForOrg(org))
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	if len(cfg.Processors) != 1 || cfg.Processors[0] != processor.Square {
+		t.Fatalf("processors = %v, want [square]", cfg.Processors)
+	}
+	if cfg.Strategy != router.PrimaryFallback {
+		t.Fatalf("strategy = %q, want primary_fallback", cfg.Strategy)
+	}
+}
+
+// A rule naming a processor the org has no credentials for, or one on the
+// deny list, is refused rather than left to never match.
+func TestRouterForOrg_RuleForUnavailableProcessor(t *testing.T) {
+	ensureDefaultProcessorPolicy(t)
+	org := orgWithSquareCreds()
+	org.Live = true
+	org.PaymentRouting = router.Settings{Rules: []router.Rule{
+		{Name: "eur-large", Processor: processor.Adyen, Match: router.Match{Currencies: []currency.Type{currency.EUR}, MinAmount: 50001}},
+		{Name: "br-cards", Processor: processor.Stripe, Match: router.Match{Countries: []string{"BR"}}},
+	}}
+
+	_, err := RouterForOrg(org)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"rules[0] (eur-large): processor adyen", "rules[1] (br-cards): processor stripe"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+
+	org.Adyen.APIKey = "adyen-key"
+	org.PaymentRouting.Rules = org.PaymentRouting.Rules[:1]
+	r, err := RouterForOrg(org)
+	if err != nil {
+		t.Fatalf("router: %v", err)
+	}
+	if d := r.DryRun(processor.PaymentRequest{Amount: 60000, Currency: currency.EUR}); d.Processor != processor.Adyen {
+		t.Fatalf("decision = %+v, want adyen", d)
+	}
+}
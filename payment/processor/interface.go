@@ -42,6 +42,18 @@ type PaymentProcessor interface {
 	IsAvailable(ctx context.Context) bool
 }
 
+// AuthenticationProcessor extends PaymentProcessor for processors whose card
+// payments can stop for strong customer authentication. Charge and Authorize
+// return a result with StatusRequiresAction and a NextAction; once the customer
+// has completed it, ResumePayment finishes the payment and returns its outcome,
+// which may be yet another challenge.
+type AuthenticationProcessor interface {
+	PaymentProcessor
+
+	// ResumePayment completes a payment after its challenge.
+	ResumePayment(ctx context.Context, req ResumeRequest) (*PaymentResult, error)
+}
+
 // CryptoProcessor extends PaymentProcessor with crypto-specific methods
 type CryptoProcessor interface {
 	PaymentProcessor
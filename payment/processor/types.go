@@ -50,6 +50,12 @@ type PaymentRequest struct {
 	// For card payments
 	Token string `json:"token,omitempty"`
 
+	// ReturnURL is where the customer's browser comes back to after an
+	// authentication challenge the issuer sends them off to complete (3-D
+	// Secure). A processor that would need to redirect and has no ReturnURL
+	// declines rather than strand the customer on the bank's page.
+	ReturnURL string `json:"returnUrl,omitempty"`
+
 	// For crypto payments
 	Address string `json:"address,omitempty"`
 	Chain   string `json:"chain,omitempty"`
@@ -79,6 +85,70 @@ type PaymentResult struct {
 	ErrorMessage  string                 `json:"error,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 	Status        string                 `json:"status"`
+
+	// NextAction is set, and Status is StatusRequiresAction, when the issuer
+	// wants the customer to authenticate before it decides. Success is false
+	// then: no money has moved and none will until ResumePayment says so.
+	NextAction *NextAction `json:"nextAction,omitempty"`
+}
+
+// StatusRequiresAction is the PaymentResult.Status of a payment waiting on the
+// customer to complete a strong customer authentication challenge.
+//
+// It used to be reported as Success with a processor-specific status
+// ("action_required"), and a caller that checked Success alone shipped the
+// goods for a payment the customer had not yet authenticated and the issuer
+// had not yet approved.
+const StatusRequiresAction = "requires_action"
+
+// RequiresAction reports whether the payment is waiting on a challenge.
+func (r *PaymentResult) RequiresAction() bool {
+	return r != nil && r.Status == StatusRequiresAction
+}
+
+// Next action types.
+const (
+	// NextActionRedirect sends the customer's browser to RedirectURL. The
+	// issuer sends it back to the request's ReturnURL when they are done.
+	NextActionRedirect = "redirect"
+
+	// NextActionSDK hands Data to the processor's client SDK, which runs the
+	// challenge in the page without leaving it.
+	NextActionSDK = "sdk"
+)
+
+// NextAction is what the customer must do to complete a payment: the challenge
+// a processor issued, in a form the front end can act on without knowing which
+// processor it came from.
+type NextAction struct {
+	Type string `json:"type"`
+
+	// RedirectURL, and Method when it is not GET, are set for
+	// NextActionRedirect. A POST redirect carries its form fields in Data.
+	RedirectURL string `json:"redirectUrl,omitempty"`
+	Method      string `json:"method,omitempty"`
+
+	// Data is the processor's own challenge payload for its SDK: a Stripe
+	// client secret, an Adyen action, a Braintree nonce and bin.
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// ResumeRequest continues a payment that returned StatusRequiresAction.
+type ResumeRequest struct {
+	// TransactionID is the result's TransactionID.
+	TransactionID string `json:"transactionId"`
+
+	// Request is the request the challenge interrupted. Processors that
+	// resume by replaying the payment with the authentication result attached
+	// need it; the rest ignore it.
+	Request PaymentRequest `json:"request"`
+
+	// AuthorizeOnly resumes an Authorize rather than a Charge.
+	AuthorizeOnly bool `json:"authorizeOnly,omitempty"`
+
+	// Data is what the challenge returned: the query parameters of the return
+	// URL, or the result the client SDK reported.
+	Data map[string]interface{} `json:"data,omitempty"`
 }
 
 // RefundRequest represents a refund to be processed
@@ -154,6 +154,11 @@ type adyenPaymentResponse struct {
 	Amount            *adyenAmount           `json:"amount,omitempty"`
 	MerchantReference string                 `json:"merchantReference,omitempty"`
 	AdditionalData    map[string]interface{} `json:"additionalData,omitempty"`
+	Action            map[string]interface{} `json:"action,omitempty"`
+}
+
+type adyenPaymentDetailsRequest struct {
+	Details map[string]interface{} `json:"details"`
 }
 
 type adyenCaptureRequest struct {
@@ -286,8 +291,10 @@ func (p *Provider) doPayment(ctx context.Context, req processor.PaymentRequest,
 		body.Metadata = stringifyMap(req.Metadata)
 	}
 
-	// Allow callers to pass returnUrl via options (required for some payment methods).
-	if retURL, ok := req.Options["returnUrl"].(string); ok && retURL != "" {
+	// Adyen requires a returnUrl for 3-D Secure redirects. Older callers pass
+	// it via options.
+	body.ReturnURL = req.ReturnURL
+	if retURL, ok := req.Options["returnUrl"].(string); ok && retURL != "" && body.ReturnURL == "" {
 		body.ReturnURL = retURL
 	}
 
@@ -296,6 +303,34 @@ func (p *Provider) doPayment(ctx context.Context, req processor.PaymentRequest,
 		return nil, err
 	}
 
+	return paymentResult(&resp, reference, authOnly), nil
+}
+
+// ResumePayment submits what the shopper's 3-D Secure challenge returned to
+// /payments/details: the redirectResult from the return URL's query, or the
+// threeDSResult the Drop-in or Components SDK reported. Data is passed on as
+// Adyen's details object unchanged.
+func (p *Provider) ResumePayment(ctx context.Context, req processor.ResumeRequest) (*processor.PaymentResult, error) {
+	if err := p.ensureAvailable(); err != nil {
+		return nil, err
+	}
+	if len(req.Data) == 0 {
+		return nil, fmt.Errorf("adyen: resume needs the challenge details")
+	}
+
+	var resp adyenPaymentResponse
+	if err := p.post(ctx, "/payments/details", adyenPaymentDetailsRequest{Details: req.Data}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.PSPReference == "" {
+		resp.PSPReference = req.TransactionID
+	}
+
+	return paymentResult(&resp, resp.MerchantReference, req.AuthorizeOnly), nil
+}
+
+// paymentResult maps a /payments or /payments/details response.
+func paymentResult(resp *adyenPaymentResponse, reference string, authOnly bool) *processor.PaymentResult {
 	result := &processor.PaymentResult{
 		TransactionID: resp.PSPReference,
 		ProcessorRef:  resp.PSPReference,
@@ -329,10 +364,11 @@ func (p *Provider) doPayment(ctx context.Context, req processor.PaymentRequest,
 		result.Error = processor.NewPaymentError(processor.Adyen, "API_ERROR",
 			resp.RefusalReason, nil)
 	case "RedirectShopper", "IdentifyShopper", "ChallengeShopper", "PresentToShopper":
-		// 3DS or redirect-based flows: return the action data so the caller can handle it.
-		result.Success = true
-		result.Status = "action_required"
-		result.Metadata["resultCode"] = resp.ResultCode
+		// 3DS or redirect-based flows: nothing is authorised until the shopper
+		// completes the action and ResumePayment submits its result.
+		result.Success = false
+		result.Status = processor.StatusRequiresAction
+		result.NextAction = nextAction(resp.Action)
 	default:
 		result.Success = false
 		result.Status = "unknown"
@@ -341,7 +377,26 @@ func (p *Provider) doPayment(ctx context.Context, req processor.PaymentRequest,
 			result.ErrorMessage, nil)
 	}
 
-	return result, nil
+	return result
+}
+
+// nextAction converts an Adyen action. A redirect the shopper's browser can
+// follow is spelled out; anything else (threeDS2 fingerprint and challenge,
+// QR codes, vouchers) is handed whole to the Adyen SDK, which knows it.
+func nextAction(action map[string]interface{}) *processor.NextAction {
+	if action["type"] == "redirect" {
+		if u, ok := action["url"].(string); ok && u != "" {
+			next := &processor.NextAction{Type: processor.NextActionRedirect, RedirectURL: u}
+			if m, ok := action["method"].(string); ok && m != "GET" {
+				next.Method = m
+			}
+			if data, ok := action["data"].(map[string]interface{}); ok {
+				next.Data = data
+			}
+			return next
+		}
+	}
+	return &processor.NextAction{Type: processor.NextActionSDK, Data: action}
 }
 
 // Capture captures a previously authorized payment.
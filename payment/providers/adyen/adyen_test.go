@@ -172,6 +172,7 @@ func TestSupportedCurrencies_ContainsExpected(t *testing.T) {
 
 func TestInterfaceCompliance(t *testing.T) {
 	var _ processor.PaymentProcessor = newTestProvider()
+	var _ processor.AuthenticationProcessor = newTestProvider()
 }
 
 // ---------------------------------------------------------------------------
@@ -530,26 +531,99 @@ func TestCharge_Error(t *testing.T) {
 
 func TestCharge_RedirectShopper(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body adyenPaymentRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.ReturnURL != "https://shop.example/return" {
+			t.Errorf("returnUrl = %q", body.ReturnURL)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(adyenPaymentResponse{
 			PSPReference: "PSP-3DS",
 			ResultCode:   "RedirectShopper",
+			Action: map[string]interface{}{
+				"type":   "redirect",
+				"method": "GET",
+				"url":    "https://test.adyen.com/hpp/3d/validate.shtml",
+			},
 		})
 	}))
 	defer server.Close()
 
 	p := configuredProvider(server.URL)
 	result, err := p.Charge(context.Background(), processor.PaymentRequest{
-		Amount: 1000, Currency: currency.USD, Token: "tok",
+		Amount: 1000, Currency: currency.USD, Token: "tok", ReturnURL: "https://shop.example/return",
 	})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !result.Success {
-		t.Fatal("RedirectShopper should be success (action required)")
+	if result.Success {
+		t.Fatal("RedirectShopper must not report success before the shopper authenticates")
+	}
+	if !result.RequiresAction() {
+		t.Errorf("Status = %q, want %s", result.Status, processor.StatusRequiresAction)
+	}
+	if result.NextAction == nil || result.NextAction.Type != processor.NextActionRedirect ||
+		result.NextAction.RedirectURL != "https://test.adyen.com/hpp/3d/validate.shtml" || result.NextAction.Method != "" {
+		t.Errorf("NextAction = %+v", result.NextAction)
+	}
+}
+
+func TestCharge_ChallengeShopper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adyenPaymentResponse{
+			PSPReference: "PSP-3DS2",
+			ResultCode:   "ChallengeShopper",
+			Action:       map[string]interface{}{"type": "threeDS2", "token": "tok-3ds2"},
+		})
+	}))
+	defer server.Close()
+
+	p := configuredProvider(server.URL)
+	result, err := p.Charge(context.Background(), processor.PaymentRequest{
+		Amount: 1000, Currency: currency.EUR, Token: "tok",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success || !result.RequiresAction() {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.NextAction.Type != processor.NextActionSDK || result.NextAction.Data["token"] != "tok-3ds2" {
+		t.Errorf("NextAction = %+v", result.NextAction)
+	}
+}
+
+func TestResumePayment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/payments/details") {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body adyenPaymentDetailsRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Details["redirectResult"] != "X6XtfGC3" {
+			t.Errorf("details = %v", body.Details)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adyenPaymentResponse{
+			PSPReference:      "PSP-3DS",
+			ResultCode:        "Authorised",
+			MerchantReference: "order-1",
+		})
+	}))
+	defer server.Close()
+
+	p := configuredProvider(server.URL)
+	result, err := p.ResumePayment(context.Background(), processor.ResumeRequest{
+		TransactionID: "PSP-3DS",
+		AuthorizeOnly: true,
+		Data:          map[string]interface{}{"redirectResult": "X6XtfGC3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if result.Status != "action_required" {
-		t.Errorf("Status = %q, want action_required", result.Status)
+	if !result.Success || result.Status != "authorized" || result.TransactionID != "PSP-3DS" {
+		t.Errorf("result = %+v", result)
 	}
 }
 
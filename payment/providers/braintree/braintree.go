@@ -114,6 +114,7 @@ func (p *Provider) Charge(ctx context.Context, req processor.PaymentRequest) (*p
 			transaction {
 				id
 				status
+				gatewayRejectionReason
 				amount {
 					value
 					currencyCode
@@ -168,6 +169,10 @@ func (p *Provider) Charge(ctx context.Context, req processor.PaymentRequest) (*p
 	txID, _ := tx["id"].(string)
 	status, _ := tx["status"].(string)
 
+	if res := threeDSecureRequired(tx, req); res != nil {
+		return res, nil
+	}
+
 	return &processor.PaymentResult{
 		Success:       true,
 		TransactionID: txID,
@@ -200,6 +205,7 @@ func (p *Provider) Authorize(ctx context.Context, req processor.PaymentRequest)
 			transaction {
 				id
 				status
+				gatewayRejectionReason
 				amount {
 					value
 					currencyCode
@@ -253,6 +259,10 @@ func (p *Provider) Authorize(ctx context.Context, req processor.PaymentRequest)
 	txID, _ := tx["id"].(string)
 	status, _ := tx["status"].(string)
 
+	if res := threeDSecureRequired(tx, req); res != nil {
+		return res, nil
+	}
+
 	return &processor.PaymentResult{
 		Success:       true,
 		TransactionID: txID,
@@ -264,6 +274,58 @@ func (p *Provider) Authorize(ctx context.Context, req processor.PaymentRequest)
 	}, nil
 }
 
+// ResumePayment retries the payment with the nonce the Braintree client SDK
+// returned from threeDSecure.verifyCard. Braintree attaches the 3-D Secure
+// result to that nonce rather than to the rejected transaction, so resuming
+// is a fresh charge (or authorization) of the same request paid with it.
+func (p *Provider) ResumePayment(ctx context.Context, req processor.ResumeRequest) (*processor.PaymentResult, error) {
+	nonce, _ := req.Data["nonce"].(string)
+	if nonce == "" {
+		return nil, processor.NewPaymentError(processor.Braintree, "INVALID_REQUEST",
+			"resume needs the nonce from threeDSecure.verifyCard", nil)
+	}
+
+	retry := req.Request
+	retry.Token = nonce
+	if req.AuthorizeOnly {
+		return p.Authorize(ctx, retry)
+	}
+	return p.Charge(ctx, retry)
+}
+
+// threeDSecureRequired is the requires_action result for a transaction the
+// gateway rejected because the merchant's rules demand 3-D Secure and the
+// payment method carried none, or nil for any other transaction. The client
+// SDK needs the payment method, the amount and the bin to run verifyCard.
+func threeDSecureRequired(tx map[string]interface{}, req processor.PaymentRequest) *processor.PaymentResult {
+	status, _ := tx["status"].(string)
+	reason, _ := tx["gatewayRejectionReason"].(string)
+	if !strings.EqualFold(status, "GATEWAY_REJECTED") || !strings.EqualFold(reason, "THREE_D_SECURE") {
+		return nil
+	}
+
+	txID, _ := tx["id"].(string)
+	data := map[string]interface{}{
+		"paymentMethodId": req.Token,
+		"amount":          req.Currency.ToStringNoSymbol(req.Amount),
+		"currency":        req.Currency.Code(),
+	}
+	if bin, ok := req.Options["bin"].(string); ok && bin != "" {
+		data["bin"] = bin
+	}
+
+	return &processor.PaymentResult{
+		Success:       false,
+		TransactionID: txID,
+		ProcessorRef:  txID,
+		Status:        processor.StatusRequiresAction,
+		NextAction:    &processor.NextAction{Type: processor.NextActionSDK, Data: data},
+		Metadata: map[string]interface{}{
+			"braintreeStatus": status,
+		},
+	}
+}
+
 // Capture captures a previously authorized payment.
 func (p *Provider) Capture(ctx context.Context, transactionID string, amount money.Amount) (*processor.PaymentResult, error) {
 	if err := p.checkAvailable(); err != nil {
@@ -729,3 +791,4 @@ func mapStatus(btStatus string) string {
 
 // Compile-time interface check.
 var _ processor.PaymentProcessor = (*Provider)(nil)
+var _ processor.AuthenticationProcessor = (*Provider)(nil)
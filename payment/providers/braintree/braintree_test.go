@@ -443,6 +443,60 @@ func TestCharge_Success(t *testing.T) {
 	}
 }
 
+func TestCharge_ThreeDSecureRequired(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct {
+				Input struct {
+					PaymentMethodID string `json:"paymentMethodId"`
+				} `json:"input"`
+			} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		tokens = append(tokens, body.Variables.Input.PaymentMethodID)
+
+		tx := map[string]interface{}{"id": "bt-tx-3ds", "status": "GATEWAY_REJECTED", "gatewayRejectionReason": "THREE_D_SECURE"}
+		if body.Variables.Input.PaymentMethodID == "nonce-3ds" {
+			tx = map[string]interface{}{"id": "bt-tx-2", "status": "SUBMITTED_FOR_SETTLEMENT"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(graphqlResp(map[string]interface{}{
+			"chargePaymentMethod": map[string]interface{}{"transaction": tx},
+		}))
+	}))
+	defer server.Close()
+
+	p := configuredProvider(server.URL)
+	req := processor.PaymentRequest{Amount: 1000, Currency: currency.EUR, Token: "tok-1"}
+	result, err := p.Charge(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Success || !result.RequiresAction() {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.NextAction.Type != processor.NextActionSDK || result.NextAction.Data["paymentMethodId"] != "tok-1" ||
+		result.NextAction.Data["amount"] != "10.00" {
+		t.Errorf("NextAction = %+v", result.NextAction)
+	}
+
+	result, err = p.ResumePayment(context.Background(), processor.ResumeRequest{
+		TransactionID: result.TransactionID,
+		Request:       req,
+		Data:          map[string]interface{}{"nonce": "nonce-3ds"},
+	})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if !result.Success || result.TransactionID != "bt-tx-2" {
+		t.Fatalf("resumed result = %+v", result)
+	}
+	if len(tokens) != 2 || tokens[1] != "nonce-3ds" {
+		t.Errorf("charged with %v, want the 3-D Secure nonce second", tokens)
+	}
+}
+
 func TestCharge_GraphQLError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
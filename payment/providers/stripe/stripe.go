@@ -119,7 +119,7 @@ func (p *Provider) Charge(ctx context.Context, req processor.PaymentRequest) (*p
 	params.Set("currency", strings.ToLower(string(req.Currency)))
 	params.Set("confirm", "true")
 	params.Set("automatic_payment_methods[enabled]", "true")
-	params.Set("automatic_payment_methods[allow_redirects]", "never")
+	setReturnURL(params, req)
 
 	if req.Token != "" {
 		params.Set("payment_method", req.Token)
@@ -146,25 +146,7 @@ func (p *Provider) Charge(ctx context.Context, req processor.PaymentRequest) (*p
 		}, err
 	}
 
-	if pi.Status == "requires_action" {
-		return &processor.PaymentResult{
-			Success:       true,
-			TransactionID: pi.ID,
-			ProcessorRef:  pi.ID,
-			Status:        "action_required",
-			Metadata: map[string]interface{}{
-				"client_secret": pi.ClientSecret,
-			},
-		}, nil
-	}
-
-	return &processor.PaymentResult{
-		Success:       pi.Status == "succeeded",
-		TransactionID: pi.ID,
-		ProcessorRef:  pi.LatestCharge,
-		Fee:           0, // Fee available via balance_transaction, not on PI
-		Status:        pi.Status,
-	}, nil
+	return chargeResult(&pi), nil
 }
 
 // Authorize creates a PaymentIntent with capture_method=manual.
@@ -179,7 +161,7 @@ func (p *Provider) Authorize(ctx context.Context, req processor.PaymentRequest)
 	params.Set("capture_method", "manual")
 	params.Set("confirm", "true")
 	params.Set("automatic_payment_methods[enabled]", "true")
-	params.Set("automatic_payment_methods[allow_redirects]", "never")
+	setReturnURL(params, req)
 
 	if req.Token != "" {
 		params.Set("payment_method", req.Token)
@@ -203,12 +185,116 @@ func (p *Provider) Authorize(ctx context.Context, req processor.PaymentRequest)
 		}, err
 	}
 
+	return authorizeResult(&pi), nil
+}
+
+// ResumePayment finishes a PaymentIntent whose 3-D Secure challenge the
+// customer has completed. Stripe carries the outcome on the intent itself, so
+// resuming is reading it back, and confirming it once more if Stripe left it
+// waiting for confirmation (it does for intents created with
+// confirmation_method=manual).
+func (p *Provider) ResumePayment(ctx context.Context, req processor.ResumeRequest) (*processor.PaymentResult, error) {
+	if req.TransactionID == "" {
+		return nil, fmt.Errorf("stripe: resume needs the payment intent id")
+	}
+
+	var pi paymentIntent
+	if err := p.get(ctx, "/payment_intents/"+req.TransactionID, nil, &pi); err != nil {
+		return &processor.PaymentResult{
+			Success:      false,
+			ErrorMessage: err.Error(),
+			Error:        err,
+		}, err
+	}
+
+	if pi.Status == "requires_confirmation" {
+		params := url.Values{}
+		setReturnURL(params, req.Request)
+		if err := p.post(ctx, "/payment_intents/"+pi.ID+"/confirm", params, &pi); err != nil {
+			return &processor.PaymentResult{
+				Success:      false,
+				ErrorMessage: err.Error(),
+				Error:        err,
+			}, err
+		}
+	}
+
+	if req.AuthorizeOnly {
+		return authorizeResult(&pi), nil
+	}
+	return chargeResult(&pi), nil
+}
+
+// setReturnURL lets Stripe send the customer to their bank when the request
+// says where to send them back to. Without a return URL a redirect would
+// strand them, so redirects are refused and a card that insists on one
+// declines; challenges the Stripe SDK can run in the page still come back as
+// requires_action either way.
+func setReturnURL(params url.Values, req processor.PaymentRequest) {
+	if req.ReturnURL != "" {
+		params.Set("return_url", req.ReturnURL)
+		return
+	}
+	params.Set("automatic_payment_methods[allow_redirects]", "never")
+}
+
+// chargeResult maps a confirmed PaymentIntent to the outcome of a charge.
+func chargeResult(pi *paymentIntent) *processor.PaymentResult {
+	if res := pendingResult(pi); res != nil {
+		return res
+	}
+	return &processor.PaymentResult{
+		Success:       pi.Status == "succeeded",
+		TransactionID: pi.ID,
+		ProcessorRef:  pi.LatestCharge,
+		Fee:           0, // Fee available via balance_transaction, not on PI
+		Status:        pi.Status,
+		ErrorMessage:  pi.LastPaymentError.Message,
+	}
+}
+
+// authorizeResult maps a confirmed manual-capture PaymentIntent to the
+// outcome of an authorization.
+func authorizeResult(pi *paymentIntent) *processor.PaymentResult {
+	if res := pendingResult(pi); res != nil {
+		return res
+	}
 	return &processor.PaymentResult{
 		Success:       pi.Status == "requires_capture",
 		TransactionID: pi.ID,
 		ProcessorRef:  pi.ID,
 		Status:        "authorized",
-	}, nil
+		ErrorMessage:  pi.LastPaymentError.Message,
+	}
+}
+
+// pendingResult is the requires_action result for an intent waiting on the
+// customer, or nil for one that is not. The client secret stays in Metadata
+// as well as NextAction for callers that read it from there.
+func pendingResult(pi *paymentIntent) *processor.PaymentResult {
+	if pi.Status != "requires_action" {
+		return nil
+	}
+
+	next := &processor.NextAction{
+		Type: processor.NextActionSDK,
+		Data: map[string]interface{}{"clientSecret": pi.ClientSecret},
+	}
+	if pi.NextAction.Type == "redirect_to_url" && pi.NextAction.RedirectToURL.URL != "" {
+		next.Type = processor.NextActionRedirect
+		next.RedirectURL = pi.NextAction.RedirectToURL.URL
+	}
+
+	return &processor.PaymentResult{
+		Success:       false,
+		TransactionID: pi.ID,
+		ProcessorRef:  pi.ID,
+		Status:        processor.StatusRequiresAction,
+		NextAction:    next,
+		Metadata: map[string]interface{}{
+			"client_secret": pi.ClientSecret,
+		},
+	}
 }
 
 // Capture captures a previously authorized PaymentIntent.
@@ -604,6 +690,18 @@ type paymentIntent struct {
 	ClientSecret string                 `json:"client_secret"`
 	Created      int64                  `json:"created"`
 	Metadata     map[string]interface{} `json:"metadata"`
+
+	NextAction struct {
+		Type          string `json:"type"`
+		RedirectToURL struct {
+			URL string `json:"url"`
+		} `json:"redirect_to_url"`
+	} `json:"next_action"`
+
+	LastPaymentError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
 }
 
 type refund struct {
@@ -704,6 +802,8 @@ func mapEventType(stripeType string) string {
 		return "payment.completed"
 	case "payment_intent.payment_failed":
 		return "payment.failed"
+	case "payment_intent.requires_action":
+		return "payment.requires_action"
 	case "charge.refunded":
 		return "refund.succeeded"
 	case "charge.refund.updated":
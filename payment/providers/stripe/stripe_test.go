@@ -177,16 +177,17 @@ func TestValidateWebhook_EmptySecret(t *testing.T) {
 
 func TestMapEventType(t *testing.T) {
 	cases := map[string]string{
-		"payment_intent.succeeded":      "payment.completed",
-		"payment_intent.payment_failed": "payment.failed",
-		"charge.refunded":               "refund.succeeded",
-		"charge.dispute.created":        "dispute.created",
-		"customer.subscription.created": "subscription.created",
-		"customer.subscription.deleted": "subscription.canceled",
-		"invoice.paid":                  "invoice.paid",
-		"invoice.payment_failed":        "invoice.payment_failed",
-		"customer.created":              "customer.created",
-		"unknown.event.type":            "unknown.event.type",
+		"payment_intent.succeeded":       "payment.completed",
+		"payment_intent.payment_failed":  "payment.failed",
+		"payment_intent.requires_action": "payment.requires_action",
+		"charge.refunded":                "refund.succeeded",
+		"charge.dispute.created":         "dispute.created",
+		"customer.subscription.created":  "subscription.created",
+		"customer.subscription.deleted":  "subscription.canceled",
+		"invoice.paid":                   "invoice.paid",
+		"invoice.payment_failed":         "invoice.payment_failed",
+		"customer.created":               "customer.created",
+		"unknown.event.type":             "unknown.event.type",
 	}
 	for input, expected := range cases {
 		got := mapEventType(input)
@@ -274,4 +275,49 @@ func TestInterfaceCompliance(t *testing.T) {
 	var _ processor.PaymentProcessor = (*Provider)(nil)
 	var _ processor.SubscriptionProcessor = (*Provider)(nil)
 	var _ processor.CustomerProcessor = (*Provider)(nil)
+	var _ processor.AuthenticationProcessor = (*Provider)(nil)
+}
+
+func TestChargeResult_RequiresAction(t *testing.T) {
+	var pi paymentIntent
+	body := `{"id":"pi_123","status":"requires_action","client_secret":"pi_123_secret",
+		"next_action":{"type":"redirect_to_url","redirect_to_url":{"url":"https://hooks.stripe.com/3ds"}}}`
+	if err := json.Unmarshal([]byte(body), &pi); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, res := range map[string]*processor.PaymentResult{
+		"charge":    chargeResult(&pi),
+		"authorize": authorizeResult(&pi),
+	} {
+		if res.Success {
+			t.Errorf("%s: a payment awaiting 3-D Secure reported success", name)
+		}
+		if !res.RequiresAction() || res.TransactionID != "pi_123" {
+			t.Errorf("%s: result = %+v", name, res)
+		}
+		if res.NextAction.Type != processor.NextActionRedirect || res.NextAction.RedirectURL != "https://hooks.stripe.com/3ds" {
+			t.Errorf("%s: next action = %+v", name, res.NextAction)
+		}
+	}
+
+	pi.NextAction.Type = "use_stripe_sdk"
+	res := chargeResult(&pi)
+	if res.NextAction.Type != processor.NextActionSDK || res.NextAction.Data["clientSecret"] != "pi_123_secret" {
+		t.Errorf("sdk next action = %+v", res.NextAction)
+	}
+}
+
+func TestChargeResult_FailedChallenge(t *testing.T) {
+	var pi paymentIntent
+	body := `{"id":"pi_123","status":"requires_payment_method",
+		"last_payment_error":{"code":"payment_intent_authentication_failure","message":"authentication failed"}}`
+	if err := json.Unmarshal([]byte(body), &pi); err != nil {
+		t.Fatal(err)
+	}
+
+	res := chargeResult(&pi)
+	if res.Success || res.RequiresAction() || res.ErrorMessage != "authentication failed" {
+		t.Fatalf("result = %+v", res)
+	}
 }
@@ -0,0 +1,506 @@
+package router
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+)
+
+// ---------------------------------------------------------------------------
+// Adaptive strategy
+// ---------------------------------------------------------------------------
+//
+// The other strategies route on configuration alone: they send a payment where
+// they were told to whether or not that processor has been approving anything.
+// Adaptive routes on what actually happened. Every attempt the router makes is
+// recorded against its processor, currency and card brand over a sliding
+// window, and each payment goes to the processor with the best expected value:
+//
+//	approval rate × (amount − fee) − latency penalty
+//
+// A strategy that only ever exploits stops learning — a processor that had a
+// bad ten minutes would never be tried again — so with probability Epsilon a
+// payment is sent to some other processor instead, and its outcome keeps that
+// processor's numbers current.
+//
+// The circuit breaker is not part of the score and is not overridden by it. A
+// processor whose breaker is open goes to the back of the list however good
+// its history, and routePayment still refuses it until the breaker allows.
+
+// AdaptiveConfig tunes the Adaptive strategy.
+type AdaptiveConfig struct {
+	// Window is how far back outcomes count. Default 15m.
+	Window time.Duration
+
+	// Buckets is how many slices the window is kept in; outcomes leave the
+	// window a slice at a time. Default 15.
+	Buckets int
+
+	// Epsilon is the share of payments sent to a processor other than the
+	// best, to keep measuring it. Default 0.05; negative turns exploration off.
+	Epsilon float64
+
+	// MinSamples is how many attempts a currency or card brand needs in the
+	// window before its own rate is trusted over the broader one. Default 20.
+	MinSamples int
+
+	// Fees is what each processor charges. A processor without an entry is
+	// taken to be free, which is rarely true: list them all.
+	Fees map[processor.ProcessorType]Fee
+
+	// LatencyPenaltyBps is what a second of mean latency costs, in basis points
+	// of the amount. Zero leaves latency out of the score (it is still reported).
+	LatencyPenaltyBps int
+}
+
+func (c AdaptiveConfig) withDefaults() AdaptiveConfig {
+	if c.Window <= 0 {
+		c.Window = 15 * time.Minute
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = 15
+	}
+	if c.Epsilon == 0 {
+		c.Epsilon = 0.05
+	}
+	if c.Epsilon < 0 {
+		c.Epsilon = 0
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = 20
+	}
+	return c
+}
+
+// Fee is a processor's price for a payment: a rate plus a fixed amount.
+type Fee struct {
+	BasisPoints int            `json:"basisPoints"`
+	Fixed       currency.Cents `json:"fixed"`
+}
+
+// On returns the fee for amount.
+func (f Fee) On(amount currency.Cents) currency.Cents {
+	return amount.BasisPoints(f.BasisPoints) + f.Fixed
+}
+
+// cardBrand reads the card brand from the request. There is no field for it:
+// callers that know it put it in Options or Metadata under "cardBrand".
+//
+// The value comes from whoever built the request, so a brand the card networks
+// do not have is recorded as "other": outcomes are kept per brand, and a
+// caller must not be able to grow them one made-up brand at a time.
+func cardBrand(req processor.PaymentRequest) string {
+	b := strings.ToLower(attr(req, "cardBrand"))
+	if b == "" || cardBrands[b] {
+		return b
+	}
+	return "other"
+}
+
+// cardBrands are the brands outcomes are kept for by name.
+var cardBrands = map[string]bool{
+	"amex":             true,
+	"cartes_bancaires": true,
+	"diners":           true,
+	"discover":         true,
+	"eftpos":           true,
+	"interac":          true,
+	"jcb":              true,
+	"maestro":          true,
+	"mastercard":       true,
+	"unionpay":         true,
+	"visa":             true,
+}
+
+// ---------------------------------------------------------------------------
+// Sliding window
+// ---------------------------------------------------------------------------
+
+type outcomeKey struct {
+	processor processor.ProcessorType
+	currency  currency.Type
+	brand     string
+}
+
+type bucket struct {
+	start     time.Time
+	attempts  int64
+	approvals int64
+	latency   time.Duration
+	routed    int64
+	explored  int64
+}
+
+// window keeps counts in fixed time slices. A slice is reused when time comes
+// round to it again, which is what drops the oldest outcomes.
+type window struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+func newWindow(cfg AdaptiveConfig) *window {
+	return &window{
+		width:   cfg.Window / time.Duration(cfg.Buckets),
+		buckets: make([]bucket, cfg.Buckets),
+	}
+}
+
+func (w *window) at(now time.Time) *bucket {
+	start := now.Truncate(w.width)
+	b := &w.buckets[int(start.UnixNano()/int64(w.width))%len(w.buckets)]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	return b
+}
+
+func (w *window) sum(now time.Time) bucket {
+	var total bucket
+	oldest := now.Truncate(w.width).Add(-w.width * time.Duration(len(w.buckets)-1))
+	for _, b := range w.buckets {
+		if b.start.Before(oldest) || b.start.After(now) {
+			continue
+		}
+		total = add(total, b)
+	}
+	return total
+}
+
+// outcomes is the router's record of what its processors did.
+type outcomes struct {
+	mu      sync.Mutex
+	cfg     AdaptiveConfig
+	windows map[outcomeKey]*window
+}
+
+func newOutcomes(cfg AdaptiveConfig) *outcomes {
+	return &outcomes{cfg: cfg, windows: make(map[outcomeKey]*window)}
+}
+
+func (o *outcomes) bucket(k outcomeKey, now time.Time) *bucket {
+	w, ok := o.windows[k]
+	if !ok {
+		o.prune(now)
+		w = newWindow(o.cfg)
+		o.windows[k] = w
+	}
+	return w.at(now)
+}
+
+// prune drops the windows nothing has been recorded in for a whole window.
+// They count for nothing in an estimate, and a key that comes back starts a
+// fresh one.
+func (o *outcomes) prune(now time.Time) {
+	for k, w := range o.windows {
+		if s := w.sum(now); s.attempts == 0 && s.routed == 0 {
+			delete(o.windows, k)
+		}
+	}
+}
+
+func (o *outcomes) attempt(k outcomeKey, approved bool, latency time.Duration, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	b := o.bucket(k, now)
+	b.attempts++
+	if approved {
+		b.approvals++
+	}
+	b.latency += latency
+}
+
+func (o *outcomes) decision(k outcomeKey, explored bool, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	b := o.bucket(k, now)
+	b.routed++
+	if explored {
+		b.explored++
+	}
+}
+
+// estimate returns the approval rate and mean latency to expect from k.
+//
+// The narrowest level with minSamples attempts answers: the card brand in this
+// currency, then the currency, then the processor as a whole. minSamples is
+// the asking router's, not the config the outcomes were made with: outcomes
+// are shared (Carry), and each router decides how far it trusts them. Each is smoothed
+// toward one half, so a processor nobody has tried yet scores as a coin flip
+// rather than as perfect or as useless.
+func (o *outcomes) estimate(k outcomeKey, minSamples int, now time.Time) (rate float64, latency time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var exact, byCurrency, all bucket
+	for key, w := range o.windows {
+		if key.processor != k.processor {
+			continue
+		}
+		s := w.sum(now)
+		all = add(all, s)
+		if key.currency == k.currency {
+			byCurrency = add(byCurrency, s)
+			if key.brand == k.brand {
+				exact = add(exact, s)
+			}
+		}
+	}
+
+	use := all
+	need := int64(minSamples)
+	switch {
+	case k.brand != "" && exact.attempts >= need:
+		use = exact
+	case byCurrency.attempts >= need:
+		use = byCurrency
+	}
+
+	rate = float64(use.approvals+1) / float64(use.attempts+2)
+	if use.attempts > 0 {
+		latency = use.latency / time.Duration(use.attempts)
+	}
+	return rate, latency
+}
+
+func add(a, b bucket) bucket {
+	a.attempts += b.attempts
+	a.approvals += b.approvals
+	a.latency += b.latency
+	a.routed += b.routed
+	a.explored += b.explored
+	return a
+}
+
+// ---------------------------------------------------------------------------
+// Selection
+// ---------------------------------------------------------------------------
+
+// score is the expected value of sending req to pt, in minor units. It is a
+// float because it only ranks processors; no money is computed from it.
+func (r *Router) score(pt processor.ProcessorType, req processor.PaymentRequest, now time.Time) float64 {
+	cfg := r.config.Adaptive
+	rate, latency := r.outcomes.estimate(outcomeKey{pt, req.Currency, cardBrand(req)}, cfg.MinSamples, now)
+
+	net := req.Amount - cfg.Fees[pt].On(req.Amount)
+	ev := rate * float64(net)
+	if cfg.LatencyPenaltyBps > 0 {
+		ev -= float64(req.Amount.BasisPoints(cfg.LatencyPenaltyBps)) * latency.Seconds()
+	}
+	return ev
+}
+
+func (r *Router) candidatesAdaptive(_ context.Context, req processor.PaymentRequest) []processor.ProcessorType {
+	n := len(r.config.Processors)
+	if n == 0 {
+		return nil
+	}
+	now := r.now()
+
+	type entry struct {
+		pt    processor.ProcessorType
+		open  bool
+		score float64
+	}
+	entries := make([]entry, n)
+	for i, pt := range r.config.Processors {
+		cb := r.getBreaker(pt)
+		entries[i] = entry{pt: pt, open: cb != nil && cb.isOpen(), score: r.score(pt, req, now)}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].open != entries[j].open {
+			return !entries[i].open
+		}
+		return entries[i].score > entries[j].score
+	})
+
+	// Explore: swap a random other closed-breaker processor to the front.
+	explored := false
+	closed := 0
+	for _, e := range entries {
+		if !e.open {
+			closed++
+		}
+	}
+	if closed > 1 && r.config.Adaptive.Epsilon > 0 {
+		r.rngMu.Lock()
+		if r.rng.Float64() < r.config.Adaptive.Epsilon {
+			pick := 1 + r.rng.Intn(closed-1)
+			entries[0], entries[pick] = entries[pick], entries[0]
+			explored = true
+		}
+		r.rngMu.Unlock()
+	}
+
+	r.outcomes.decision(outcomeKey{entries[0].pt, req.Currency, cardBrand(req)}, explored, now)
+
+	result := make([]processor.ProcessorType, n)
+	for i, e := range entries {
+		result[i] = e.pt
+	}
+	return result
+}
+
+// ---------------------------------------------------------------------------
+// Stats
+// ---------------------------------------------------------------------------
+
+// OutcomeStats is what one processor did for one currency and card brand in the
+// window. Routed counts the payments the router sent there first, Explored the
+// part of those that were exploration; Attempts counts every try, fallbacks
+// included. Read together they say why traffic moved: a processor whose
+// approvals fell keeps its Attempts for a while and loses its Routed.
+type OutcomeStats struct {
+	Processor     processor.ProcessorType `json:"processor"`
+	Currency      currency.Type           `json:"currency"`
+	CardBrand     string                  `json:"cardBrand,omitempty"`
+	Attempts      int64                   `json:"attempts"`
+	Approvals     int64                   `json:"approvals"`
+	ApprovalRate  float64                 `json:"approvalRate"`
+	MeanLatencyMs float64                 `json:"meanLatencyMs"`
+	Routed        int64                   `json:"routed"`
+	Explored      int64                   `json:"explored"`
+}
+
+// BreakerStats is a processor's circuit breaker as it stands.
+type BreakerStats struct {
+	Processor processor.ProcessorType `json:"processor"`
+	State     string                  `json:"state"`
+	Failures  int                     `json:"failures"`
+}
+
+// Stats is a router's live picture: its configuration, its breakers, and the
+// outcomes its choices were made on.
+type Stats struct {
+	Strategy   Strategy                        `json:"strategy"`
+	Window     string                          `json:"window"`
+	Epsilon    float64                         `json:"epsilon"`
+	MinSamples int                             `json:"minSamples"`
+	Fees       map[processor.ProcessorType]Fee `json:"fees,omitempty"`
+	Breakers   []BreakerStats                  `json:"breakers"`
+	Outcomes   []OutcomeStats                  `json:"outcomes"`
+}
+
+// Stats reports the router's breakers and the outcomes in its window. Outcomes
+// are recorded whatever the strategy; only Adaptive acts on them. Window is the
+// one the outcomes are kept over, which is prev's after Carry.
+func (r *Router) Stats() Stats {
+	cfg := r.config.Adaptive
+	s := Stats{
+		Strategy:   r.config.Strategy,
+		Window:     r.outcomes.cfg.Window.String(),
+		Epsilon:    cfg.Epsilon,
+		MinSamples: cfg.MinSamples,
+		Fees:       cfg.Fees,
+		Breakers:   make([]BreakerStats, 0, len(r.config.Processors)),
+		Outcomes:   make([]OutcomeStats, 0),
+	}
+
+	for _, pt := range r.config.Processors {
+		if cb := r.getBreaker(pt); cb != nil {
+			state, failures := cb.snapshot()
+			s.Breakers = append(s.Breakers, BreakerStats{Processor: pt, State: state, Failures: failures})
+		}
+	}
+
+	now := r.now()
+	r.outcomes.mu.Lock()
+	for k, w := range r.outcomes.windows {
+		b := w.sum(now)
+		if b.attempts == 0 && b.routed == 0 {
+			continue
+		}
+		o := OutcomeStats{
+			Processor: k.processor,
+			Currency:  k.currency,
+			CardBrand: k.brand,
+			Attempts:  b.attempts,
+			Approvals: b.approvals,
+			Routed:    b.routed,
+			Explored:  b.explored,
+		}
+		if b.attempts > 0 {
+			o.ApprovalRate = float64(b.approvals) / float64(b.attempts)
+			o.MeanLatencyMs = float64(b.latency/time.Duration(b.attempts)) / float64(time.Millisecond)
+		}
+		s.Outcomes = append(s.Outcomes, o)
+	}
+	r.outcomes.mu.Unlock()
+
+	sort.Slice(s.Outcomes, func(i, j int) bool {
+		a, b := s.Outcomes[i], s.Outcomes[j]
+		if a.Processor != b.Processor {
+			return a.Processor < b.Processor
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.CardBrand < b.CardBrand
+	})
+	return s
+}
+
+// ---------------------------------------------------------------------------
+// Process-wide router
+// ---------------------------------------------------------------------------
+
+// Carry hands what prev has learned to r, which is about to replace it: the
+// circuit breakers and in-flight counts of the processors both route through,
+// the round-robin position, and the outcomes. They are shared, not copied, so
+// a payment prev is still making counts toward r as well.
+//
+// It is for a router rebuilt because its processors or settings may have
+// changed — a new router is built over an org's current credentials — and
+// must be called before r routes anything. A processor prev did not have
+// starts with a closed breaker.
+//
+// The outcomes come with the window they are kept over, so r's Window and
+// Buckets no longer apply: r records into, and scores on, prev's window. The
+// rest of r's AdaptiveConfig — fees, epsilon, MinSamples, the latency penalty
+// — is still r's own, applied as r scores.
+func (r *Router) Carry(prev *Router) {
+	if prev == nil {
+		return
+	}
+	prev.mu.RLock()
+	r.mu.Lock()
+	for pt := range r.breakers {
+		if cb, ok := prev.breakers[pt]; ok {
+			r.breakers[pt] = cb
+		}
+		if n, ok := prev.inflight[pt]; ok {
+			r.inflight[pt] = n
+		}
+	}
+	r.mu.Unlock()
+	prev.mu.RUnlock()
+
+	r.rrCounter.Store(prev.rrCounter.Load())
+	r.outcomes = prev.outcomes
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultRouter *Router
+)
+
+// SetDefault installs the router the process routes payments through, so its
+// stats can be served. Nil removes it.
+func SetDefault(r *Router) {
+	defaultMu.Lock()
+	defaultRouter = r
+	defaultMu.Unlock()
+}
+
+// Default returns the process-wide router, or nil if none was installed.
+func Default() *Router {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRouter
+}
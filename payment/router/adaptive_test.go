@@ -0,0 +1,257 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// adaptiveRouter builds an Adaptive router over stripe and square with
+// exploration off and a clock the test moves.
+func adaptiveRouter(cfg AdaptiveConfig) (*Router, *time.Time) {
+	reg := setupRegistry(newMock("stripe", true), newMock("square", true))
+	if cfg.Epsilon == 0 {
+		cfg.Epsilon = -1
+	}
+	if cfg.MinSamples == 0 {
+		cfg.MinSamples = 5
+	}
+	r := NewRouter(reg, Config{
+		Strategy:   Adaptive,
+		Processors: []processor.ProcessorType{"stripe", "square"},
+		Adaptive:   cfg,
+	})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+// seed records n attempts, approved of them approved, against k.
+func seed(r *Router, k outcomeKey, n, approved int) {
+	for i := 0; i < n; i++ {
+		r.outcomes.attempt(k, i < approved, 100*time.Millisecond, r.now())
+	}
+}
+
+func first(r *Router, req processor.PaymentRequest) processor.ProcessorType {
+	return r.selectCandidates(context.Background(), req)[0]
+}
+
+// ---------------------------------------------------------------------------
+// Tests: Adaptive
+// ---------------------------------------------------------------------------
+
+func TestAdaptive_RoutesToHigherApproval(t *testing.T) {
+	r, _ := adaptiveRouter(AdaptiveConfig{})
+	seed(r, outcomeKey{"stripe", currency.USD, ""}, 20, 8)
+	seed(r, outcomeKey{"square", currency.USD, ""}, 20, 18)
+
+	if got := first(r, baseReq()); got != "square" {
+		t.Fatalf("first = %s, want square (90%% vs 40%% approval)", got)
+	}
+}
+
+// Equal approval rates leave the fee to decide.
+func TestAdaptive_FeesBreakEvenApproval(t *testing.T) {
+	r, _ := adaptiveRouter(AdaptiveConfig{Fees: map[processor.ProcessorType]Fee{
+		"stripe": {BasisPoints: 290, Fixed: 30},
+		"square": {BasisPoints: 260, Fixed: 10},
+	}})
+	seed(r, outcomeKey{"stripe", currency.USD, ""}, 20, 18)
+	seed(r, outcomeKey{"square", currency.USD, ""}, 20, 18)
+
+	if got := first(r, baseReq()); got != "square" {
+		t.Fatalf("first = %s, want the cheaper square", got)
+	}
+
+	r.config.Adaptive.Fees["square"] = Fee{BasisPoints: 500}
+	if got := first(r, baseReq()); got != "stripe" {
+		t.Fatalf("first = %s, want stripe once square costs more", got)
+	}
+}
+
+// A card brand with enough history of its own is judged on it, not on the
+// processor's overall rate.
+func TestAdaptive_CardBrandHasItsOwnRate(t *testing.T) {
+	r, _ := adaptiveRouter(AdaptiveConfig{})
+	seed(r, outcomeKey{"square", currency.USD, "visa"}, 40, 39)
+	seed(r, outcomeKey{"square", currency.USD, "amex"}, 10, 2)
+	seed(r, outcomeKey{"stripe", currency.USD, "amex"}, 10, 9)
+	seed(r, outcomeKey{"stripe", currency.USD, "visa"}, 10, 7)
+
+	amex := baseReq()
+	amex.Metadata = map[string]interface{}{"cardBrand": "AMEX"}
+	if got := first(r, amex); got != "stripe" {
+		t.Fatalf("amex first = %s, want stripe", got)
+	}
+
+	visa := baseReq()
+	visa.Options = map[string]interface{}{"cardBrand": "visa"}
+	if got := first(r, visa); got != "square" {
+		t.Fatalf("visa first = %s, want square", got)
+	}
+}
+
+// Outcomes older than the window stop counting.
+func TestAdaptive_WindowForgets(t *testing.T) {
+	r, now := adaptiveRouter(AdaptiveConfig{Window: 10 * time.Minute, Buckets: 10})
+	seed(r, outcomeKey{"stripe", currency.USD, ""}, 20, 0)
+	seed(r, outcomeKey{"square", currency.USD, ""}, 20, 20)
+	if got := first(r, baseReq()); got != "square" {
+		t.Fatalf("first = %s, want square", got)
+	}
+
+	*now = now.Add(11 * time.Minute)
+	seed(r, outcomeKey{"stripe", currency.USD, ""}, 20, 20)
+	seed(r, outcomeKey{"square", currency.USD, ""}, 20, 0)
+	if got := first(r, baseReq()); got != "stripe" {
+		t.Fatalf("first = %s, want stripe once square's good run has aged out", got)
+	}
+}
+
+// The breaker is a hard guard: an open breaker goes last however good the
+// processor's record.
+func TestAdaptive_OpenBreakerGoesLast(t *testing.T) {
+	r, _ := adaptiveRouter(AdaptiveConfig{})
+	seed(r, outcomeKey{"square", currency.USD, ""}, 20, 20)
+	seed(r, outcomeKey{"stripe", currency.USD, ""}, 20, 10)
+
+	for i := 0; i < r.config.CircuitBreaker.FailureThreshold; i++ {
+		r.getBreaker("square").failure()
+	}
+	if got := first(r, baseReq()); got != "stripe" {
+		t.Fatalf("first = %s, want stripe while square's breaker is open", got)
+	}
+}
+
+func TestAdaptive_Explores(t *testing.T) {
+	r, _ := adaptiveRouter(AdaptiveConfig{Epsilon: 0.2})
+	seed(r, outcomeKey{"square", currency.USD, ""}, 20, 20)
+	seed(r, outcomeKey{"stripe", currency.USD, ""}, 20, 10)
+
+	counts := map[processor.ProcessorType]int{}
+	for i := 0; i < 2000; i++ {
+		counts[first(r, baseReq())]++
+	}
+	if counts["stripe"] < 250 || counts["stripe"] > 550 {
+		t.Fatalf("stripe chosen %d of 2000 times, want about 400 at epsilon 0.2", counts["stripe"])
+	}
+
+	var explored int64
+	for _, o := range r.Stats().Outcomes {
+		if o.Processor == "stripe" {
+			explored += o.Explored
+		}
+	}
+	if explored != int64(counts["stripe"]) {
+		t.Fatalf("stats explored = %d, want %d", explored, counts["stripe"])
+	}
+}
+
+// Every attempt is recorded, fallbacks included, and Stats reports it with
+// the breakers.
+func TestAdaptive_StatsRecordAttempts(t *testing.T) {
+	stripe := newMock("stripe", true)
+	stripe.chargeErr = fmt.Errorf("declined")
+	square := newMock("square", true)
+	r := NewRouter(setupRegistry(stripe, square), Config{
+		Strategy:   PrimaryFallback,
+		Primary:    "stripe",
+		Processors: []processor.ProcessorType{"stripe", "square"},
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Charge(context.Background(), baseReq()); err != nil {
+			t.Fatalf("charge: %v", err)
+		}
+	}
+
+	s := r.Stats()
+	if s.Strategy != PrimaryFallback || len(s.Breakers) != 2 {
+		t.Fatalf("stats = %+v", s)
+	}
+	got := map[processor.ProcessorType]OutcomeStats{}
+	for _, o := range s.Outcomes {
+		got[o.Processor] = o
+	}
+	if o := got["stripe"]; o.Attempts != 3 || o.Approvals != 0 {
+		t.Fatalf("stripe = %+v, want 3 attempts and no approvals", o)
+	}
+	if o := got["square"]; o.Attempts != 3 || o.ApprovalRate != 1 {
+		t.Fatalf("square = %+v, want 3 approved attempts", o)
+	}
+}
+
+// A card brand the networks do not have is kept as "other", and a window
+// nothing has been recorded in for a whole window is dropped, so a caller
+// cannot grow the outcomes one made-up brand at a time.
+func TestAdaptive_OutcomesStayBounded(t *testing.T) {
+	r, now := adaptiveRouter(AdaptiveConfig{Window: 10 * time.Minute, Buckets: 10})
+	for i := 0; i < 100; i++ {
+		req := baseReq()
+		req.Options = map[string]interface{}{"cardBrand": fmt.Sprintf("brand-%d", i)}
+		first(r, req)
+	}
+	if n := len(r.outcomes.windows); n != 1 {
+		t.Fatalf("%d windows after 100 made-up brands, want the one for other", n)
+	}
+
+	*now = now.Add(11 * time.Minute)
+	seed(r, outcomeKey{"stripe", currency.USD, "visa"}, 1, 1)
+	if _, ok := r.outcomes.windows[outcomeKey{"stripe", currency.USD, "visa"}]; !ok || len(r.outcomes.windows) != 1 {
+		t.Fatalf("windows = %v, want the idle one pruned", r.outcomes.windows)
+	}
+}
+
+// A rebuilt router carries on its predecessor's breakers and outcomes.
+func TestCarry(t *testing.T) {
+	prev, _ := adaptiveRouter(AdaptiveConfig{})
+	seed(prev, outcomeKey{"square", currency.USD, ""}, 20, 20)
+	seed(prev, outcomeKey{"stripe", currency.USD, ""}, 20, 20)
+	for i := 0; i < prev.config.CircuitBreaker.FailureThreshold; i++ {
+		prev.getBreaker("square").failure()
+	}
+
+	r, _ := adaptiveRouter(AdaptiveConfig{})
+	r.Carry(prev)
+	if !r.getBreaker("square").isOpen() {
+		t.Fatal("square's breaker closed on the rebuilt router")
+	}
+	if got := first(r, baseReq()); got != "stripe" {
+		t.Fatalf("first = %s, want stripe while square's breaker is open", got)
+	}
+	if r.outcomes != prev.outcomes {
+		t.Fatal("the rebuilt router does not share its predecessor's outcomes")
+	}
+}
+
+// A rebuilt router scores the outcomes it carries on with its own settings,
+// over the window they were kept in.
+func TestCarry_OwnScoring(t *testing.T) {
+	prev, _ := adaptiveRouter(AdaptiveConfig{})
+	seed(prev, outcomeKey{"stripe", currency.USD, ""}, 20, 20)
+	seed(prev, outcomeKey{"stripe", currency.EUR, ""}, 30, 0)
+	seed(prev, outcomeKey{"square", currency.USD, ""}, 20, 10)
+	if got := first(prev, baseReq()); got != "stripe" {
+		t.Fatalf("prev first = %s, want stripe on its 20 USD approvals", got)
+	}
+
+	// Needing 50 attempts, USD alone is too few to trust: stripe is judged on
+	// all 50 of its attempts, 20 of them approved.
+	r, _ := adaptiveRouter(AdaptiveConfig{MinSamples: 50, Window: time.Hour})
+	r.Carry(prev)
+	if got := first(r, baseReq()); got != "square" {
+		t.Fatalf("first = %s, want square under the rebuilt router's MinSamples", got)
+	}
+	if s := r.Stats(); s.Window != (15*time.Minute).String() || s.MinSamples != 50 {
+		t.Fatalf("stats window %s, minSamples %d; want the carried 15m window and its own 50", s.Window, s.MinSamples)
+	}
+}
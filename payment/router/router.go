@@ -2,13 +2,19 @@
 //
 // The Router implements processor.PaymentProcessor so it can be used as a
 // drop-in replacement anywhere a single processor is expected. Internally it
-// delegates to real processors selected by one of five configurable strategies:
+// delegates to real processors selected by one of six configurable strategies:
 //
 //   - PrimaryFallback: try a designated primary, fall back through the list
 //   - RoundRobin: distribute requests evenly across processors
 //   - CurrencyBased: route by currency code to a designated processor
 //   - WeightedRandom: probabilistic distribution according to configured weights
 //   - LeastLoad: pick the processor with the fewest in-flight requests
+//   - Adaptive: pick the best expected value from measured approval rates,
+//     latency and fees, exploring the others now and then (adaptive.go)
+//
+// Ahead of the strategy sits an optional list of declarative rules (rules.go):
+// the first rule whose match fits the payment names the processor to try
+// first, and only a payment no rule matches is left to the strategy.
 //
 // Each processor is wrapped in a circuit breaker that opens after consecutive
 // failures and probes with limited requests before fully closing again.
@@ -56,6 +62,10 @@ const (
 
 	// LeastLoad routes to the processor with the fewest in-flight requests.
 	LeastLoad Strategy = "least_load"
+
+	// Adaptive routes to the processor with the best expected value given
+	// its measured approval rate, latency and fee.
+	Adaptive Strategy = "adaptive"
 )
 
 // routerProcessorType is the ProcessorType returned by Router.Type().
@@ -93,6 +103,13 @@ type Config struct {
 
 	// CircuitBreaker configures per-processor circuit breakers.
 	CircuitBreaker CircuitBreakerConfig
+
+	// Adaptive tunes the Adaptive strategy.
+	Adaptive AdaptiveConfig
+
+	// Rules are evaluated in order before the strategy; the first match
+	// decides. See Validate.
+	Rules []Rule
 }
 
 // CircuitBreakerConfig tunes the per-processor circuit breaker.
@@ -186,6 +203,28 @@ func (cb *circuitBreaker) success() {
 	cb.state = cbClosed
 }
 
+// isOpen reports whether the breaker is refusing requests right now, without
+// counting as one: a half-open breaker is not open, and neither is one whose
+// reset timeout has passed.
+func (cb *circuitBreaker) isOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state == cbOpen && time.Since(cb.lastFailure) < cb.config.ResetTimeout
+}
+
+// snapshot returns the breaker's state name and consecutive failures.
+func (cb *circuitBreaker) snapshot() (string, int) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case cbOpen:
+		return "open", cb.failures
+	case cbHalfOpen:
+		return "half_open", cb.failures
+	}
+	return "closed", cb.failures
+}
+
 // failure records a failed request.
 func (cb *circuitBreaker) failure() {
 	cb.mu.Lock()
@@ -227,6 +266,12 @@ type Router struct {
 	// rng is used for weighted random selection; guarded by rngMu.
 	rng   *rand.Rand
 	rngMu sync.Mutex
+
+	// outcomes records every attempt for the Adaptive strategy and Stats.
+	outcomes *outcomes
+
+	// now is the clock outcomes are recorded on.
+	now func() time.Time
 }
 
 // NewRouter creates a Router backed by the given registry and config.
@@ -234,6 +279,7 @@ type Router struct {
 // config.Processors.
 func NewRouter(registry *processor.Registry, config Config) *Router {
 	config.CircuitBreaker = config.CircuitBreaker.withDefaults()
+	config.Adaptive = config.Adaptive.withDefaults()
 
 	// Collect the union of all processor currencies.
 	allCurrencies := make(map[currency.Type]struct{})
@@ -268,6 +314,8 @@ func NewRouter(registry *processor.Registry, config Config) *Router {
 		breakers:      breakers,
 		inflight:      inflight,
 		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		outcomes:      newOutcomes(config.Adaptive),
+		now:           time.Now,
 	}
 }
 
@@ -316,6 +364,43 @@ func (r *Router) Capture(ctx context.Context, transactionID string, amount money
 	return result, nil
 }
 
+// ResumePayment completes a payment that came back requires_action, on the
+// processor that issued the challenge. The transactionID must be
+// router-prefixed. The outcome counts toward that processor's statistics like
+// any other attempt, unless it is yet another challenge.
+func (r *Router) ResumePayment(ctx context.Context, req processor.ResumeRequest) (*processor.PaymentResult, error) {
+	pt, rawID, err := r.parseTransactionID(req.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := r.getProcessor(ctx, pt)
+	if err != nil {
+		return nil, err
+	}
+	ap, ok := p.(processor.AuthenticationProcessor)
+	if !ok {
+		return nil, processor.NewPaymentError(routerProcessorType, "NOT_SUPPORTED",
+			fmt.Sprintf("processor %s cannot resume an authenticated payment", pt), nil)
+	}
+
+	req.TransactionID = rawID
+	started := r.now()
+	result, err := ap.ResumePayment(ctx, req)
+	finished := r.now()
+
+	if err != nil || !result.RequiresAction() {
+		approved := err == nil && (result == nil || result.Success)
+		r.outcomes.attempt(outcomeKey{pt, req.Request.Currency, cardBrand(req.Request)}, approved, finished.Sub(started), finished)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.prefixResult(result, pt)
+	return result, nil
+}
+
 // Refund processes a refund on the processor that handled the original charge.
 func (r *Router) Refund(ctx context.Context, req processor.RefundRequest) (*processor.RefundResult, error) {
 	pt, rawID, err := r.parseTransactionID(req.TransactionID)
@@ -467,12 +552,31 @@ func (r *Router) routePayment(ctx context.Context, req processor.PaymentRequest,
 			counter.Add(1)
 		}
 
+		started := r.now()
 		result, err := fn(p, req)
 
 		if counter != nil {
 			counter.Add(-1)
 		}
 
+		// A challenge is not a decline. The processor is up and the payment is
+		// alive with it, so it ends here: falling back would take the same
+		// payment a second time while the customer authenticates the first.
+		// Its outcome is recorded when it is resumed.
+		if err == nil && result.RequiresAction() {
+			if cb != nil {
+				cb.success()
+			}
+			r.prefixResult(result, pt)
+			return result, nil
+		}
+
+		// Every attempt is an outcome, fallbacks included: a processor that
+		// declines as a fallback has declined.
+		finished := r.now()
+		approved := err == nil && (result == nil || result.Success)
+		r.outcomes.attempt(outcomeKey{pt, req.Currency, cardBrand(req)}, approved, finished.Sub(started), finished)
+
 		if err != nil {
 			lastErr = err
 			if cb != nil {
@@ -506,8 +610,16 @@ func (r *Router) routePayment(ctx context.Context, req processor.PaymentRequest,
 }
 
 // selectCandidates returns an ordered slice of processor types to try.
-// The order depends on the configured strategy.
+// A matching rule decides the order; otherwise the configured strategy does.
 func (r *Router) selectCandidates(ctx context.Context, req processor.PaymentRequest) []processor.ProcessorType {
+	if i := r.matchRule(req); i >= 0 {
+		return r.candidatesRule(r.config.Rules[i])
+	}
+	return r.candidatesStrategy(ctx, req)
+}
+
+// candidatesStrategy returns the configured strategy's order for req.
+func (r *Router) candidatesStrategy(ctx context.Context, req processor.PaymentRequest) []processor.ProcessorType {
 	switch r.config.Strategy {
 	case PrimaryFallback:
 		return r.candidatesPrimaryFallback(ctx, req)
@@ -519,6 +631,8 @@ func (r *Router) selectCandidates(ctx context.Context, req processor.PaymentRequ
 		return r.candidatesWeightedRandom(ctx, req)
 	case LeastLoad:
 		return r.candidatesLeastLoad(ctx, req)
+	case Adaptive:
+		return r.candidatesAdaptive(ctx, req)
 	default:
 		return r.candidatesPrimaryFallback(ctx, req)
 	}
@@ -758,3 +872,4 @@ func (r *Router) getInflight(pt processor.ProcessorType) *atomic.Int64 {
 // ---------------------------------------------------------------------------
 
 var _ processor.PaymentProcessor = (*Router)(nil)
+var _ processor.AuthenticationProcessor = (*Router)(nil)
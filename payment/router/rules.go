@@ -0,0 +1,442 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+)
+
+// ---------------------------------------------------------------------------
+// Routing rules
+// ---------------------------------------------------------------------------
+//
+// A strategy is one policy for all traffic. Finance's policies are not: "EUR
+// over €500 to adyen, cards from BR to stripe, anything under $1 to square,
+// otherwise primary_fallback" is four policies and a default. Rules say that
+// directly. They are evaluated in order, the first whose Match fits the payment
+// names the processor to try first, and a payment no rule matches falls
+// through to the strategy.
+//
+// A rule chooses where a payment STARTS, not where it must end. Its processor
+// is tried first and the router's Primary and Processors follow as fallbacks,
+// so a rule pointing at a processor that is down or declining degrades to the
+// default order rather than to a failed payment. The circuit breaker still
+// guards the rule's processor exactly as it guards any other.
+
+// Rule sends payments its Match fits to Processor first.
+type Rule struct {
+	// Name identifies the rule in validation errors and dry runs.
+	Name string `json:"name,omitempty"`
+
+	Match Match `json:"match"`
+
+	Processor processor.ProcessorType `json:"processor"`
+}
+
+// Match is what a payment must be for a rule to apply. Every field set must
+// fit; a field left empty matches anything, so an empty Match matches every
+// payment and ends the rule list.
+//
+// The request has no fields for country, payment method or org. Callers that
+// know them put them in the request's Options or Metadata under "country",
+// "paymentMethod" and "orgId", as they do "cardBrand" for the Adaptive
+// strategy.
+type Match struct {
+	// Currencies the payment may be in.
+	Currencies []currency.Type `json:"currencies,omitempty"`
+
+	// MinAmount is inclusive and MaxAmount exclusive, both in the minor units
+	// of the payment's currency; zero leaves that end open. Because 100 is a
+	// dollar but a hundred yen, a bound needs Currencies to mean anything and
+	// Validate refuses one without.
+	MinAmount currency.Cents `json:"minAmount,omitempty"`
+	MaxAmount currency.Cents `json:"maxAmount,omitempty"`
+
+	// Countries are ISO 3166-1 alpha-2 codes: the card's issuing country, or
+	// the billing country where the card's is not known.
+	Countries []string `json:"countries,omitempty"`
+
+	// Methods are payment method types: "card", "ach", "sepa_debit", "wallet".
+	Methods []string `json:"methods,omitempty"`
+
+	// Metadata must all be present on the payment's Metadata with these values.
+	// This is where what the caller knows about the customer is matched.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Orgs the payment may be for.
+	Orgs []string `json:"orgs,omitempty"`
+}
+
+// attr reads a routing attribute the request has no field for from its
+// Options, then its Metadata.
+func attr(req processor.PaymentRequest, key string) string {
+	for _, m := range []map[string]interface{}{req.Options, req.Metadata} {
+		if s, ok := m[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func (m Match) empty() bool {
+	return len(m.Currencies) == 0 && m.MinAmount == 0 && m.MaxAmount == 0 &&
+		len(m.Countries) == 0 && len(m.Methods) == 0 && len(m.Metadata) == 0 && len(m.Orgs) == 0
+}
+
+// matches reports whether req fits m. Codes compare without regard to case;
+// finance writes "EUR" and "br" and means what the request means by them.
+func (m Match) matches(req processor.PaymentRequest) bool {
+	if len(m.Currencies) > 0 {
+		found := false
+		for _, c := range m.Currencies {
+			if strings.EqualFold(string(c), string(req.Currency)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if m.MinAmount > 0 && req.Amount < m.MinAmount {
+		return false
+	}
+	if m.MaxAmount > 0 && req.Amount >= m.MaxAmount {
+		return false
+	}
+	if !oneOf(m.Countries, attr(req, "country")) {
+		return false
+	}
+	if !oneOf(m.Methods, attr(req, "paymentMethod")) {
+		return false
+	}
+	if !oneOf(m.Orgs, attr(req, "orgId")) {
+		return false
+	}
+	for k, want := range m.Metadata {
+		v, ok := req.Metadata[k]
+		if !ok || fmt.Sprint(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// oneOf reports whether v is in set, or set is empty. An attribute the request
+// does not carry matches no set: a rule for BR cards does not take a payment
+// whose country nobody knows.
+func oneOf(set []string, v string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, s := range set {
+		if strings.EqualFold(s, v) && v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule returns the index of the first rule req matches, or -1.
+func (r *Router) matchRule(req processor.PaymentRequest) int {
+	for i, rule := range r.config.Rules {
+		if rule.Match.matches(req) {
+			return i
+		}
+	}
+	return -1
+}
+
+// candidatesRule is the rule's processor, then the primary-fallback order.
+// The strategy is not consulted: it may count or record its choices, and a
+// payment a rule routed was not its choice.
+func (r *Router) candidatesRule(rule Rule) []processor.ProcessorType {
+	result := []processor.ProcessorType{rule.Processor}
+	for _, pt := range r.candidatesPrimaryFallback(context.Background(), processor.PaymentRequest{}) {
+		if pt != rule.Processor {
+			result = append(result, pt)
+		}
+	}
+	return result
+}
+
+// ---------------------------------------------------------------------------
+// Validation
+// ---------------------------------------------------------------------------
+
+// Validate reports everything wrong with the config's strategy and rules at
+// once, so a rule list is fixed in one pass rather than one error at a time.
+// NewRouter does not call it; whatever loads rules from somewhere a person
+// wrote them must, before the rules route a payment.
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Strategy {
+	case "", PrimaryFallback, RoundRobin, CurrencyBased, WeightedRandom, LeastLoad, Adaptive:
+	default:
+		errs = append(errs, fmt.Errorf("unknown strategy %q", c.Strategy))
+	}
+
+	known := make(map[processor.ProcessorType]bool, len(c.Processors)+1)
+	for _, pt := range c.Processors {
+		known[pt] = true
+	}
+	if c.Primary != "" {
+		known[c.Primary] = true
+	}
+
+	names := make(map[string]int, len(c.Rules))
+	catchAll := -1
+	for i, rule := range c.Rules {
+		fail := func(format string, args ...interface{}) {
+			label := rule.Name
+			if label == "" {
+				label = "unnamed"
+			}
+			errs = append(errs, fmt.Errorf("rules[%d] (%s): %s", i, label, fmt.Sprintf(format, args...)))
+		}
+		m := rule.Match
+
+		if catchAll >= 0 {
+			fail("unreachable: rules[%d] matches every payment", catchAll)
+		}
+		if m.empty() {
+			catchAll = i
+		}
+
+		if rule.Name != "" {
+			if j, ok := names[rule.Name]; ok {
+				fail("name is also used by rules[%d]", j)
+			}
+			names[rule.Name] = i
+		}
+
+		switch {
+		case rule.Processor == "":
+			fail("no processor")
+		case !known[rule.Processor]:
+			fail("processor %s is not one this router uses", rule.Processor)
+		}
+
+		for _, cur := range m.Currencies {
+			if cur == "" {
+				fail("empty currency")
+			}
+		}
+		if m.MinAmount < 0 || m.MaxAmount < 0 {
+			fail("negative amount bound")
+		}
+		if m.MaxAmount > 0 && m.MinAmount >= m.MaxAmount {
+			fail("minAmount %d is not below maxAmount %d, so no amount matches", m.MinAmount, m.MaxAmount)
+		}
+		if m.MinAmount != 0 || m.MaxAmount != 0 {
+			if len(m.Currencies) == 0 {
+				fail("amount bounds are in minor units and need currencies to say whose")
+			} else {
+				first := currency.Type(strings.ToLower(string(m.Currencies[0])))
+				for _, cur := range m.Currencies[1:] {
+					if currency.Type(strings.ToLower(string(cur))).Decimals() != first.Decimals() {
+						fail("amount bounds span %s and %s, whose minor units differ", m.Currencies[0].Code(), cur.Code())
+						break
+					}
+				}
+			}
+		}
+
+		for _, cc := range m.Countries {
+			if !isAlpha2(cc) {
+				fail("country %q is not an ISO 3166-1 alpha-2 code", cc)
+			}
+		}
+		for _, method := range m.Methods {
+			if method == "" {
+				fail("empty payment method")
+			}
+		}
+		for _, org := range m.Orgs {
+			if org == "" {
+				fail("empty org")
+			}
+		}
+		for k := range m.Metadata {
+			if k == "" {
+				fail("empty metadata key")
+			}
+		}
+	}
+
+	errs = append(errs, c.Adaptive.validate(known)...)
+
+	return errors.Join(errs...)
+}
+
+// validate checks the adaptive settings against the processors the router
+// uses. A fee for a processor it does not use is a mistake in the table: the
+// processor meant is scored as free.
+func (c AdaptiveConfig) validate(known map[processor.ProcessorType]bool) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("adaptive: %s", fmt.Sprintf(format, args...)))
+	}
+
+	if c.Window < 0 {
+		fail("negative window")
+	}
+	if c.Epsilon > 1 {
+		fail("epsilon %v is over 1", c.Epsilon)
+	}
+	if c.MinSamples < 0 {
+		fail("negative minSamples")
+	}
+	if c.LatencyPenaltyBps < 0 {
+		fail("negative latencyPenaltyBps")
+	}
+
+	pts := make([]processor.ProcessorType, 0, len(c.Fees))
+	for pt := range c.Fees {
+		pts = append(pts, pt)
+	}
+	sort.Slice(pts, func(i, j int) bool { return pts[i] < pts[j] })
+	for _, pt := range pts {
+		fee := c.Fees[pt]
+		if !known[pt] {
+			fail("fee for %s, which is not a processor this router uses", pt)
+		}
+		if fee.BasisPoints < 0 || fee.BasisPoints > 10000 {
+			fail("fee for %s: basisPoints %d is not between 0 and 10000", pt, fee.BasisPoints)
+		}
+		if fee.Fixed < 0 {
+			fail("fee for %s: negative fixed amount", pt)
+		}
+	}
+	return errs
+}
+
+func isAlpha2(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// ---------------------------------------------------------------------------
+// Settings
+// ---------------------------------------------------------------------------
+
+// Settings is the part of a router's Config an org declares: its rules, the
+// strategy a payment no rule matches falls through to, and how the Adaptive
+// strategy weighs its processors. Processors, when empty, is left to whoever
+// builds the router, which knows what the org has configured.
+type Settings struct {
+	Strategy   Strategy                  `json:"strategy,omitempty"`
+	Primary    processor.ProcessorType   `json:"primary,omitempty"`
+	Processors []processor.ProcessorType `json:"processors,omitempty"`
+	Rules      []Rule                    `json:"rules,omitempty"`
+	Adaptive   *AdaptiveSettings         `json:"adaptive,omitempty"`
+}
+
+// AdaptiveSettings is the part of AdaptiveConfig an org declares: what its
+// processors charge it, which is its own contract with each, and how it
+// scores them. Zero values take AdaptiveConfig's defaults. The window is not
+// here: outcomes are kept over one window for every org (see Router.Carry).
+type AdaptiveSettings struct {
+	Fees              map[processor.ProcessorType]Fee `json:"fees,omitempty"`
+	Epsilon           float64                         `json:"epsilon,omitempty"`
+	MinSamples        int                             `json:"minSamples,omitempty"`
+	LatencyPenaltyBps int                             `json:"latencyPenaltyBps,omitempty"`
+}
+
+// ParseSettings decodes settings strictly. A misspelled field would otherwise
+// decode to nothing, and a Match with its only condition misspelled matches
+// every payment.
+func ParseSettings(data []byte) (Settings, error) {
+	var s Settings
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// Config returns a Config carrying the settings.
+func (s Settings) Config() Config {
+	strategy := s.Strategy
+	if strategy == "" {
+		strategy = PrimaryFallback
+	}
+	cfg := Config{
+		Strategy:   strategy,
+		Primary:    s.Primary,
+		Processors: s.Processors,
+		Rules:      s.Rules,
+	}
+	if a := s.Adaptive; a != nil {
+		cfg.Adaptive = AdaptiveConfig{
+			Fees:              a.Fees,
+			Epsilon:           a.Epsilon,
+			MinSamples:        a.MinSamples,
+			LatencyPenaltyBps: a.LatencyPenaltyBps,
+		}
+	}
+	return cfg
+}
+
+// ---------------------------------------------------------------------------
+// Dry run
+// ---------------------------------------------------------------------------
+
+// Decision is where a payment would go and why.
+type Decision struct {
+	// Rule and RuleIndex name the rule that matched; RuleIndex is -1 when none
+	// did and the payment fell through to Strategy.
+	Rule      string   `json:"rule,omitempty"`
+	RuleIndex int      `json:"ruleIndex"`
+	Strategy  Strategy `json:"strategy,omitempty"`
+
+	// Processor is tried first and Candidates is the whole order. Both are
+	// empty when the strategy decides per payment (round robin, weighted
+	// random, least load, adaptive): what it would pick now says nothing
+	// about what it will pick for the real one.
+	Processor  processor.ProcessorType   `json:"processor,omitempty"`
+	Candidates []processor.ProcessorType `json:"candidates,omitempty"`
+}
+
+// DryRun reports where req would be routed without routing it. It touches no
+// processor, breaker, counter or statistic, so it is safe against a live
+// router.
+func (r *Router) DryRun(req processor.PaymentRequest) Decision {
+	d := Decision{RuleIndex: r.matchRule(req)}
+
+	if d.RuleIndex >= 0 {
+		rule := r.config.Rules[d.RuleIndex]
+		d.Rule = rule.Name
+		d.Candidates = r.candidatesRule(rule)
+	} else {
+		d.Strategy = r.config.Strategy
+		switch d.Strategy {
+		case "", PrimaryFallback:
+			d.Strategy = PrimaryFallback
+			d.Candidates = r.candidatesPrimaryFallback(context.Background(), req)
+		case CurrencyBased:
+			d.Candidates = r.candidatesCurrencyBased(context.Background(), req)
+		}
+	}
+
+	if len(d.Candidates) > 0 {
+		d.Processor = d.Candidates[0]
+	}
+	return d
+}
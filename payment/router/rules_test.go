@@ -0,0 +1,271 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment/processor"
+)
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// financeRules is the rule list from the request that motivated them.
+func financeRules() []Rule {
+	return []Rule{
+		{Name: "eur-large", Processor: "adyen", Match: Match{Currencies: []currency.Type{"EUR"}, MinAmount: 50001}},
+		{Name: "br-cards", Processor: "stripe", Match: Match{Countries: []string{"BR"}, Methods: []string{"card"}}},
+		{Name: "micro", Processor: "square", Match: Match{Currencies: []currency.Type{currency.USD}, MaxAmount: 100}},
+	}
+}
+
+func rulesRouter(rules []Rule) (*Router, map[processor.ProcessorType]*mockProcessor) {
+	mocks := map[processor.ProcessorType]*mockProcessor{
+		"stripe": newMock("stripe", true),
+		"square": newMock("square", true),
+		"adyen":  newMock("adyen", true),
+	}
+	r := NewRouter(setupRegistry(mocks["stripe"], mocks["square"], mocks["adyen"]), Config{
+		Strategy:   PrimaryFallback,
+		Primary:    "square",
+		Processors: []processor.ProcessorType{"square", "stripe", "adyen"},
+		Rules:      rules,
+	})
+	return r, mocks
+}
+
+// ---------------------------------------------------------------------------
+// Tests: matching
+// ---------------------------------------------------------------------------
+
+func TestRules_FirstMatchDecides(t *testing.T) {
+	r, _ := rulesRouter(financeRules())
+
+	tests := []struct {
+		name string
+		req  processor.PaymentRequest
+		want processor.ProcessorType
+		rule int
+	}{
+		{"eur over 500", processor.PaymentRequest{Amount: 60000, Currency: currency.EUR}, "adyen", 0},
+		{"eur at 500", processor.PaymentRequest{Amount: 50000, Currency: currency.EUR}, "square", -1},
+		{"br card", processor.PaymentRequest{Amount: 5000, Currency: currency.USD,
+			Metadata: map[string]interface{}{"country": "br", "paymentMethod": "card"}}, "stripe", 1},
+		{"br ach", processor.PaymentRequest{Amount: 5000, Currency: currency.USD,
+			Metadata: map[string]interface{}{"country": "BR", "paymentMethod": "ach"}}, "square", -1},
+		{"br card over 500 eur", processor.PaymentRequest{Amount: 90000, Currency: currency.EUR,
+			Options: map[string]interface{}{"country": "BR", "paymentMethod": "card"}}, "adyen", 0},
+		{"usd under a dollar", processor.PaymentRequest{Amount: 99, Currency: currency.USD}, "square", 2},
+		{"usd a dollar", processor.PaymentRequest{Amount: 100, Currency: currency.USD}, "square", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.matchRule(tt.req); got != tt.rule {
+				t.Fatalf("rule = %d, want %d", got, tt.rule)
+			}
+			if got := r.selectCandidates(context.Background(), tt.req)[0]; got != tt.want {
+				t.Fatalf("first = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// A condition on something the request does not carry does not match.
+func TestRules_MissingAttributeDoesNotMatch(t *testing.T) {
+	r, _ := rulesRouter([]Rule{
+		{Processor: "adyen", Match: Match{Orgs: []string{"acme"}}},
+		{Processor: "stripe", Match: Match{Metadata: map[string]string{"tier": "vip"}}},
+	})
+
+	if i := r.matchRule(baseReq()); i != -1 {
+		t.Fatalf("bare request matched rules[%d]", i)
+	}
+
+	req := baseReq()
+	req.Metadata = map[string]interface{}{"orgId": "acme"}
+	if i := r.matchRule(req); i != 0 {
+		t.Fatalf("org request matched %d, want 0", i)
+	}
+
+	req.Metadata = map[string]interface{}{"tier": "vip"}
+	if i := r.matchRule(req); i != 1 {
+		t.Fatalf("vip request matched %d, want 1", i)
+	}
+}
+
+// The rule's processor goes first; the default order backs it up.
+func TestRules_FallBackWhenRuleProcessorFails(t *testing.T) {
+	r, mocks := rulesRouter(financeRules())
+	mocks["adyen"].chargeErr = fmt.Errorf("declined")
+
+	res, err := r.Charge(context.Background(), processor.PaymentRequest{Amount: 60000, Currency: currency.EUR})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if !strings.HasPrefix(res.TransactionID, "square:") {
+		t.Fatalf("transaction = %s, want square to have taken it", res.TransactionID)
+	}
+	if mocks["adyen"].chargeCalls != 1 {
+		t.Fatalf("adyen calls = %d, want 1", mocks["adyen"].chargeCalls)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Tests: validation
+// ---------------------------------------------------------------------------
+
+func TestRules_ValidateAcceptsFinanceRules(t *testing.T) {
+	r, _ := rulesRouter(financeRules())
+	if err := r.config.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
+
+func TestRules_ValidateReportsEveryProblem(t *testing.T) {
+	cfg := Config{
+		Strategy:   "fastest",
+		Processors: []processor.ProcessorType{"square", "stripe"},
+		Rules: []Rule{
+			{Name: "a", Processor: "adyen", Match: Match{Currencies: []currency.Type{currency.EUR}}},
+			{Name: "a", Processor: "stripe", Match: Match{MaxAmount: 100}},
+			{Name: "b", Processor: "stripe", Match: Match{Currencies: []currency.Type{currency.USD, currency.JPY}, MinAmount: 10}},
+			{Name: "c", Processor: "square", Match: Match{Currencies: []currency.Type{currency.USD}, MinAmount: 500, MaxAmount: 500}},
+			{Name: "d", Processor: "square", Match: Match{Countries: []string{"BRA"}}},
+			{Name: "everything", Processor: "square"},
+			{Name: "e", Match: Match{Methods: []string{"card"}}},
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{
+		`unknown strategy "fastest"`,
+		"rules[0] (a): processor adyen is not one this router uses",
+		"rules[1] (a): name is also used by rules[0]",
+		"rules[1] (a): amount bounds are in minor units",
+		"rules[2] (b): amount bounds span USD and JPY",
+		"rules[3] (c): minAmount 500 is not below maxAmount 500",
+		`rules[4] (d): country "BRA"`,
+		"rules[6] (e): unreachable: rules[5] matches every payment",
+		"rules[6] (e): no processor",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("errors do not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestRules_ParseSettingsIsStrict(t *testing.T) {
+	s, err := ParseSettings([]byte(`{"strategy":"primary_fallback","rules":[{"name":"eur","processor":"adyen","match":{"currencies":["eur"]}}]}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(s.Rules) != 1 || s.Rules[0].Processor != "adyen" {
+		t.Fatalf("settings = %+v", s)
+	}
+
+	// "currency" for "currencies" would otherwise leave a rule that matches
+	// every payment.
+	if _, err := ParseSettings([]byte(`{"rules":[{"processor":"adyen","match":{"currency":["eur"]}}]}`)); err == nil {
+		t.Fatal("misspelled match field was accepted")
+	}
+}
+
+// An org's adaptive settings reach the router's config, and a fee table that
+// prices a processor the router does not use, or prices one impossibly, is
+// refused.
+func TestRules_AdaptiveSettings(t *testing.T) {
+	s, err := ParseSettings([]byte(`{"strategy":"adaptive","adaptive":{"fees":{"stripe":{"basisPoints":290,"fixed":30}},"epsilon":0.1,"minSamples":50}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cfg := s.Config()
+	cfg.Processors = []processor.ProcessorType{"stripe", "square"}
+	if fee := cfg.Adaptive.Fees["stripe"]; fee.BasisPoints != 290 || fee.Fixed != 30 || cfg.Adaptive.Epsilon != 0.1 || cfg.Adaptive.MinSamples != 50 {
+		t.Fatalf("adaptive config = %+v", cfg.Adaptive)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	cfg.Adaptive.Fees["adyen"] = Fee{BasisPoints: 20000}
+	cfg.Adaptive.Epsilon = 2
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{
+		"adaptive: epsilon 2 is over 1",
+		"adaptive: fee for adyen, which is not a processor this router uses",
+		"adaptive: fee for adyen: basisPoints 20000 is not between 0 and 10000",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("errors do not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Tests: dry run
+// ---------------------------------------------------------------------------
+
+func TestRules_DryRun(t *testing.T) {
+	r, mocks := rulesRouter(financeRules())
+
+	d := r.DryRun(processor.PaymentRequest{Amount: 60000, Currency: currency.EUR})
+	if d.Rule != "eur-large" || d.RuleIndex != 0 || d.Processor != "adyen" {
+		t.Fatalf("decision = %+v", d)
+	}
+	if want := []processor.ProcessorType{"adyen", "square", "stripe"}; !equalTypes(d.Candidates, want) {
+		t.Fatalf("candidates = %v, want %v", d.Candidates, want)
+	}
+
+	d = r.DryRun(baseReq())
+	if d.RuleIndex != -1 || d.Strategy != PrimaryFallback || d.Processor != "square" {
+		t.Fatalf("fall-through decision = %+v", d)
+	}
+
+	for pt, m := range mocks {
+		if m.chargeCalls != 0 {
+			t.Fatalf("dry run charged %s", pt)
+		}
+	}
+	if s := r.Stats(); len(s.Outcomes) != 0 {
+		t.Fatalf("dry run recorded outcomes: %+v", s.Outcomes)
+	}
+}
+
+// A strategy that decides per payment has nothing honest to report ahead of
+// time.
+func TestRules_DryRunPerPaymentStrategy(t *testing.T) {
+	r := NewRouter(setupRegistry(newMock("stripe", true), newMock("square", true)), Config{
+		Strategy:   RoundRobin,
+		Processors: []processor.ProcessorType{"stripe", "square"},
+	})
+
+	d := r.DryRun(baseReq())
+	if d.Strategy != RoundRobin || d.Processor != "" || len(d.Candidates) != 0 {
+		t.Fatalf("decision = %+v", d)
+	}
+	if n := r.rrCounter.Load(); n != 0 {
+		t.Fatalf("dry run advanced the round robin to %d", n)
+	}
+}
+
+func equalTypes(a, b []processor.ProcessorType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/commerce/payment/processor"
+)
+
+// challengeMock challenges every charge and approves every resume.
+type challengeMock struct {
+	*mockProcessor
+	resumed []processor.ResumeRequest
+}
+
+func (m *challengeMock) Charge(_ context.Context, req processor.PaymentRequest) (*processor.PaymentResult, error) {
+	m.chargeCalls++
+	return &processor.PaymentResult{
+		TransactionID: "pi_" + string(m.Type()),
+		Status:        processor.StatusRequiresAction,
+		NextAction:    &processor.NextAction{Type: processor.NextActionRedirect, RedirectURL: "https://acs.example/" + req.ReturnURL},
+	}, nil
+}
+
+func (m *challengeMock) ResumePayment(_ context.Context, req processor.ResumeRequest) (*processor.PaymentResult, error) {
+	m.resumed = append(m.resumed, req)
+	return &processor.PaymentResult{Success: true, TransactionID: req.TransactionID, Status: "succeeded"}, nil
+}
+
+// A challenge ends the routing: the payment is alive with the processor that
+// issued it, and a fallback would take it twice.
+func TestRoutePayment_ChallengeDoesNotFallBack(t *testing.T) {
+	stripe := &challengeMock{mockProcessor: newMock("stripe", true)}
+	square := newMock("square", true)
+	reg := setupRegistry(square)
+	reg.Register(stripe)
+	r := NewRouter(reg, Config{
+		Strategy:   PrimaryFallback,
+		Primary:    "stripe",
+		Processors: []processor.ProcessorType{"stripe", "square"},
+	})
+
+	res, err := r.Charge(context.Background(), baseReq())
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if !res.RequiresAction() || res.TransactionID != "stripe:pi_stripe" || res.NextAction == nil {
+		t.Fatalf("result = %+v", res)
+	}
+	if square.chargeCalls != 0 {
+		t.Fatalf("fell back to square while the customer authenticates with stripe")
+	}
+	if s := r.Stats(); len(s.Outcomes) != 0 {
+		t.Fatalf("a pending challenge was recorded as an outcome: %+v", s.Outcomes)
+	}
+
+	res, err = r.ResumePayment(context.Background(), processor.ResumeRequest{
+		TransactionID: res.TransactionID,
+		Request:       baseReq(),
+		Data:          map[string]interface{}{"redirectResult": "ok"},
+	})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if !res.Success || res.TransactionID != "stripe:pi_stripe" {
+		t.Fatalf("resumed result = %+v", res)
+	}
+	if len(stripe.resumed) != 1 || stripe.resumed[0].TransactionID != "pi_stripe" {
+		t.Fatalf("stripe resumed with %+v", stripe.resumed)
+	}
+	if s := r.Stats(); len(s.Outcomes) != 1 || s.Outcomes[0].Approvals != 1 {
+		t.Fatalf("outcomes after resume = %+v", s.Outcomes)
+	}
+}
+
+func TestResumePayment_ProcessorCannotAuthenticate(t *testing.T) {
+	r := NewRouter(setupRegistry(newMock("square", true)), Config{
+		Strategy:   PrimaryFallback,
+		Primary:    "square",
+		Processors: []processor.ProcessorType{"square"},
+	})
+
+	_, err := r.ResumePayment(context.Background(), processor.ResumeRequest{TransactionID: "square:pay_1"})
+	if err == nil || !strings.Contains(err.Error(), "cannot resume") {
+		t.Fatalf("err = %v", err)
+	}
+}
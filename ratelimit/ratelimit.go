@@ -0,0 +1,180 @@
+// Package ratelimit counts API requests against the limits of an org's plan
+// tier (billing/tier.RateLimit).
+//
+// It is a sliding-window counter: each key counts its requests in fixed
+// windows, and a request is weighed against the current window's count plus
+// the part of the previous window's that the sliding window still overlaps.
+// Thirty seconds into a one-minute window, half the last minute's requests
+// still count. That is two counters per key, not a log of every request, and
+// it does not let a caller spend two windows' worth across a boundary the way
+// a plain fixed window does.
+//
+// The counters live in the infra KV store, so every replica counts against
+// the same numbers: the base SQLite store embedded, an external KV when KV_URL
+// is set. Each is created with a ttl of two windows and needs no cleanup.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Counter is the KV store the counts are kept in; infra.KVClient is one.
+type Counter interface {
+	IncrBy(key string, by int64, ttl time.Duration) (int64, error)
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// Result is the outcome of counting a request.
+type Result struct {
+	Allowed bool
+
+	// Limit and Remaining are in requests; Remaining is 0 once the limit is
+	// reached.
+	Limit     int
+	Remaining int
+
+	// Reset is when the current window ends.
+	Reset time.Duration
+
+	// RetryAfter is how long a refused caller should wait before the next
+	// request would be allowed. It is 0 for an allowed request.
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests in a Counter.
+type Limiter struct {
+	kv Counter
+
+	// now is the clock, indirected for tests.
+	now func() time.Time
+}
+
+// New returns a Limiter counting in kv.
+func New(kv Counter) *Limiter {
+	return &Limiter{kv: kv, now: time.Now}
+}
+
+// Take counts one request against key, which may make limit requests per
+// window. A refused request is taken back out of the count, so a caller
+// that keeps knocking while refused is let in as soon as its earlier
+// requests age out, not held off for as long as it keeps trying.
+func (l *Limiter) Take(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	w, err := l.window(key, limit, window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	cur, err := l.kv.IncrBy(w.cur, 1, 2*window)
+	if err != nil {
+		return Result{}, err
+	}
+	prev, err := l.count(ctx, key, w.prev)
+	if err != nil {
+		return Result{}, err
+	}
+
+	r := Decide(prev, cur, w.elapsed, window, limit)
+	if !r.Allowed {
+		if _, err := l.kv.IncrBy(w.cur, -1, 2*window); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// Peek is what Take would decide for one more request against key, without
+// counting it.
+func (l *Limiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	w, err := l.window(key, limit, window)
+	if err != nil {
+		return Result{}, err
+	}
+	cur, err := l.count(ctx, key, w.cur)
+	if err != nil {
+		return Result{}, err
+	}
+	prev, err := l.count(ctx, key, w.prev)
+	if err != nil {
+		return Result{}, err
+	}
+	return Decide(prev, cur+1, w.elapsed, window, limit), nil
+}
+
+// windows are the counters of key's current and previous windows, and how
+// far into the current one it is.
+type windows struct {
+	cur, prev string
+	elapsed   time.Duration
+}
+
+func (l *Limiter) window(key string, limit int, window time.Duration) (windows, error) {
+	if limit <= 0 || window < time.Second {
+		return windows{}, fmt.Errorf("ratelimit: %s: invalid limit %d per %s", key, limit, window)
+	}
+	now := l.now()
+	size := int64(window / time.Second)
+	idx := now.Unix() / size
+	return windows{
+		cur:     windowKey(key, size, idx),
+		prev:    windowKey(key, size, idx-1),
+		elapsed: now.Sub(time.Unix(idx*size, 0)),
+	}, nil
+}
+
+// count reads the counter of one of key's windows; one never written is 0.
+func (l *Limiter) count(ctx context.Context, key, counter string) (int64, error) {
+	raw, err := l.kv.Get(ctx, counter)
+	if err != nil || raw == "" {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ratelimit: %s: %s: %w", key, counter, err)
+	}
+	return n, nil
+}
+
+// windowKey names the counter of key's window idx. The window's length is
+// part of it, so changing a limit's window starts fresh counts rather than
+// reading the old ones as if they were the new.
+func windowKey(key string, size, idx int64) string {
+	return "ratelimit:" + key + ":" + strconv.FormatInt(size, 10) + ":" + strconv.FormatInt(idx, 10)
+}
+
+// Decide weighs a request against limit: cur is the current window's count
+// including the request, prev the previous window's, and elapsed how far
+// into the current window it is.
+func Decide(prev, cur int64, elapsed, window time.Duration, limit int) Result {
+	f := float64(elapsed) / float64(window)
+	count := float64(prev)*(1-f) + float64(cur)
+
+	r := Result{
+		Allowed: count <= float64(limit),
+		Limit:   limit,
+		Reset:   window - elapsed,
+	}
+	if r.Allowed {
+		r.Remaining = int(math.Floor(float64(limit) - count))
+		return r
+	}
+
+	// Refused: the request is not counted, and the next one fits once the
+	// previous window's weight has dropped by the excess. If that is not
+	// within this window, the current count carries over as the next
+	// window's previous one, and decays the same way. The wait is rounded up
+	// to whole seconds, as Retry-After carries it.
+	cur--
+	excess := float64(prev)*(1-f) + float64(cur) + 1 - float64(limit)
+	wait := r.Reset.Seconds()
+	if prev > 0 && excess/float64(prev)*window.Seconds() <= wait {
+		wait = excess / float64(prev) * window.Seconds()
+	} else if over := float64(cur) + 1 - float64(limit); over > 0 {
+		wait += over / float64(cur) * window.Seconds()
+	}
+	r.RetryAfter = time.Duration(math.Max(1, math.Ceil(wait-1e-9))) * time.Second
+	return r
+}
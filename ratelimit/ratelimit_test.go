@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memCounter is an in-memory Counter. Expiry is left out: the tests read
+// only the windows they wrote.
+type memCounter struct {
+	mu sync.Mutex
+	n  map[string]int64
+}
+
+func (m *memCounter) IncrBy(key string, by int64, _ time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.n == nil {
+		m.n = map[string]int64{}
+	}
+	m.n[key] += by
+	return m.n[key], nil
+}
+
+func (m *memCounter) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, ok := m.n[key]; ok {
+		return strconv.FormatInt(n, 10), nil
+	}
+	return "", nil
+}
+
+func TestDecide(t *testing.T) {
+	const window = time.Minute
+	for _, c := range []struct {
+		name       string
+		prev, cur  int64
+		elapsed    time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{"first request", 0, 1, 0, true, 9, 0},
+		{"last that fits", 0, 10, 10 * time.Second, true, 0, 0},
+		{"one over, nothing to decay", 0, 11, 15 * time.Second, false, 0, 51 * time.Second},
+		{"half the last window", 10, 1, 30 * time.Second, true, 4, 0},
+		{"over while the last decays", 10, 6, 30 * time.Second, false, 0, 6 * time.Second},
+	} {
+		r := Decide(c.prev, c.cur, c.elapsed, window, 10)
+		if r.Allowed != c.allowed || r.Remaining != c.remaining || r.RetryAfter != c.retryAfter {
+			t.Errorf("%s: Decide = %+v, want allowed %v remaining %d retry after %s",
+				c.name, r, c.allowed, c.remaining, c.retryAfter)
+		}
+		if r.Limit != 10 || r.Reset != window-c.elapsed {
+			t.Errorf("%s: limit %d reset %s", c.name, r.Limit, r.Reset)
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+	ctx := context.Background()
+	kv := &memCounter{}
+	now := time.Unix(1_800_000_000, 0).Truncate(time.Minute)
+	l := New(kv)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if r, err := l.Take(ctx, "org/acme", 3, time.Minute); err != nil || !r.Allowed {
+			t.Fatalf("request %d = %+v, %v; want allowed", i+1, r, err)
+		}
+	}
+	r, err := l.Take(ctx, "org/acme", 3, time.Minute)
+	if err != nil || r.Allowed || r.RetryAfter != 80*time.Second {
+		t.Fatalf("fourth request = %+v, %v; want refused for 80s", r, err)
+	}
+	if n, _ := kv.Get(ctx, windowKey("org/acme", 60, now.Unix()/60)); n != "3" {
+		t.Errorf("window count = %s, want the refused request taken back out", n)
+	}
+
+	// Peek decides as Take would, and counts nothing.
+	if r, err := l.Peek(ctx, "org/acme", 3, time.Minute); err != nil || r.Allowed {
+		t.Errorf("peek at the limit = %+v, %v; want refused", r, err)
+	}
+	if r, err := l.Peek(ctx, "org/acme", 4, time.Minute); err != nil || !r.Allowed || r.Remaining != 0 {
+		t.Errorf("peek under a higher limit = %+v, %v; want allowed with none remaining", r, err)
+	}
+	if n, _ := kv.Get(ctx, windowKey("org/acme", 60, now.Unix()/60)); n != "3" {
+		t.Errorf("window count after peeking = %s, want 3", n)
+	}
+
+	// Half a window on, half the last one's three still count: 1.5 + 1 fits.
+	now = now.Add(90 * time.Second)
+	if r, err := l.Take(ctx, "org/acme", 3, time.Minute); err != nil || !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("next window = %+v, %v; want allowed with none remaining", r, err)
+	}
+
+	if _, err := l.Take(ctx, "org/acme", 0, time.Minute); err == nil {
+		t.Error("Take with no limit succeeded")
+	}
+}
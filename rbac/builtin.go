@@ -0,0 +1,76 @@
+package rbac
+
+import "sort"
+
+// The built-in roles.
+const (
+	Owner      = "owner"
+	Admin      = "admin"
+	Support    = "support"
+	Fulfilment = "fulfilment"
+	Finance    = "finance"
+)
+
+// Builtin is the permissions of each built-in role. Their names are
+// reserved: an org's own role by one of them is ignored.
+//
+//   - owner may do anything.
+//   - admin may do anything but change who holds which role, or delete the
+//     org; that stays with its owners.
+//   - support looks up customers and their orders, and handles returns,
+//     notes and notifications.
+//   - fulfilment ships orders: fulfilments, stock and shipping, and returns
+//     as they come back in.
+//   - finance reads orders and money, and changes nothing.
+//
+// Each can ask why it may or may not do something (GET /rbac/explain).
+var Builtin = map[string][]string{
+	Owner: {"*:*"},
+
+	Admin: {
+		"*:*",
+		"!role:write", "!role:delete",
+		"!roleassignment:write", "!roleassignment:delete",
+		"!apipermission:write", "!apipermission:delete",
+		"!organization:delete",
+	},
+
+	Support: {
+		"order:read", "cart:read", "checkout-session:read", "user:read",
+		"subscriber:read", "payment:read", "refund:read", "gift-card:read",
+		"customergroup:read", "review:read",
+		"return:*", "exchange:*", "claim:*", "note:*", "notification:*",
+		"rbac:read",
+	},
+
+	Fulfilment: {
+		"order:read", "product:read", "variant:read",
+		"fulfillment:*", "fulfillmentset:read", "fulfillmentprovider:read",
+		"shippingoption:read", "shippingprofile:read", "servicezone:read", "geozone:read",
+		"stocklocation:*", "inventoryitem:*", "inventorylevel:*", "reservation:*",
+		"return:read", "return:label", "return:receive",
+		"rbac:read",
+	},
+
+	Finance: {
+		"order:read", "payment:read", "payment-intent:read", "refund:read",
+		"dispute:read", "transaction:read", "transfer:read", "fee:read",
+		"subscription:read", "plan:read", "billing-invoice:read", "credit-note:read",
+		"billing-payout:read", "balance-transaction:read", "customer-balance:read",
+		"billing:read", "billing-event:read", "credit-grant:read",
+		"subscription-item:read", "subscription-schedule:read",
+		"coupon:read", "discount:read", "promotion:read",
+		"tax:read", "taxrate:read", "taxregion:read", "oss-accrual:read",
+		"rbac:read",
+	},
+}
+
+// BuiltinRoles is the names of the built-in roles, sorted.
+func BuiltinRoles() []string {
+	names := make([]string, 0, len(Builtin))
+	for name := range Builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,178 @@
+// Package rbac decides what an org member or an API key may do, from the
+// roles assigned to it (models/roleassignment).
+//
+// A role is a list of permissions, each "resource:action": the resource is a
+// model kind ("order", "return") or the group a custom route hangs off
+// ("tax"), and the action "read", "write", "delete" or the verb of a custom
+// route ("refund", "resend"). Either half may be "*". A permission prefixed
+// "!" denies what it matches, whatever else the subject's roles allow, so a
+// role can grant everything but a few things. A role's entry with no ":" in
+// it names one of the org's ApiPermissions, which spells out its resource
+// and action.
+//
+// The built-in roles (see Builtin) need no setup; an org adds its own as
+// Roles. Roles are additive: a subject may do what any of its roles allow
+// and none of them deny.
+//
+// Roles are opt-in per subject. A subject with none is decided by its
+// token's permission bits as it always was; one with roles is held to them,
+// and on rest's generic CRUD they decide outright. Handlers that require an
+// admin still do, roles or not.
+package rbac
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hanzoai/commerce/models/roleassignment"
+)
+
+// The standard actions of a resource. Custom routes add their own verbs.
+const (
+	Read   = "read"
+	Write  = "write"
+	Delete = "delete"
+)
+
+// Subject is who is asking: an org member or an API key.
+type Subject struct {
+	Type roleassignment.SubjectType `json:"type"`
+	Id   string                     `json:"id"`
+}
+
+func (s Subject) String() string {
+	return string(s.Type) + ":" + s.Id
+}
+
+// ParseSubject parses "user:<id>" or "apikey:<name>".
+func ParseSubject(s string) (Subject, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	sub := Subject{Type: roleassignment.SubjectType(typ), Id: id}
+	if !ok || id == "" || (sub.Type != roleassignment.User && sub.Type != roleassignment.APIKey) {
+		return Subject{}, fmt.Errorf("rbac: subject %q is not user:<id> or apikey:<name>", s)
+	}
+	return sub, nil
+}
+
+// Grant is one of a subject's roles and the permissions it expands to.
+type Grant struct {
+	Role string `json:"role"`
+
+	// Source is where the role is defined: "builtin", "custom", or
+	// "unknown" for a name the org has no role by, which grants nothing.
+	Source string `json:"source"`
+
+	Permissions []string `json:"permissions"`
+}
+
+// Match is the permission of a role that decided a request.
+type Match struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
+// Decision is whether a subject may take an action on a resource, and why.
+type Decision struct {
+	Subject  Subject `json:"subject"`
+	Resource string  `json:"resource"`
+	Action   string  `json:"action"`
+	Allowed  bool    `json:"allowed"`
+
+	// Enforced is false for a subject with no roles: RBAC has no say, and its
+	// token's permissions decide.
+	Enforced bool `json:"enforced"`
+
+	Roles     []Grant `json:"roles"`
+	AllowedBy *Match  `json:"allowedBy,omitempty"`
+	DeniedBy  *Match  `json:"deniedBy,omitempty"`
+	Reason    string  `json:"reason"`
+}
+
+// Matches reports whether permission, without any "!", covers action on
+// resource.
+func Matches(permission, resource, action string) bool {
+	res, act, ok := strings.Cut(strings.TrimSpace(permission), ":")
+	if !ok {
+		return false
+	}
+	return (res == "*" || strings.EqualFold(res, resource)) &&
+		(act == "*" || strings.EqualFold(act, action))
+}
+
+// Evaluate decides whether subject, with grants, may take action on
+// resource. A deny in any grant wins over every allow.
+func Evaluate(subject Subject, grants []Grant, resource, action string) Decision {
+	d := Decision{
+		Subject:  subject,
+		Resource: resource,
+		Action:   action,
+		Enforced: len(grants) > 0,
+		Roles:    grants,
+	}
+	if !d.Enforced {
+		d.Allowed = true
+		d.Reason = subject.String() + " has no roles; its token's permissions decide"
+		return d
+	}
+
+	for _, g := range grants {
+		for _, p := range g.Permissions {
+			if deny, ok := strings.CutPrefix(p, "!"); ok && Matches(deny, resource, action) {
+				d.DeniedBy = &Match{Role: g.Role, Permission: p}
+				d.Reason = fmt.Sprintf("role %s denies %s:%s", g.Role, resource, action)
+				return d
+			}
+		}
+	}
+	for _, g := range grants {
+		for _, p := range g.Permissions {
+			if !strings.HasPrefix(p, "!") && Matches(p, resource, action) {
+				d.Allowed = true
+				d.AllowedBy = &Match{Role: g.Role, Permission: p}
+				d.Reason = fmt.Sprintf("role %s allows %s:%s by %s", g.Role, resource, action, p)
+				return d
+			}
+		}
+	}
+
+	names := make([]string, len(grants))
+	for i, g := range grants {
+		names[i] = g.Role
+	}
+	d.Reason = fmt.Sprintf("none of %s's roles (%s) allow %s:%s", subject, strings.Join(names, ", "), resource, action)
+	return d
+}
+
+// ActionFor is the action a route takes: reads for GET, HEAD and OPTIONS,
+// delete for DELETE, and otherwise the route's verb — the last segment of
+// its path, "refund" for POST /:paymentid/refund — or write when its path
+// ends in a parameter or nothing.
+func ActionFor(method, path string) string {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return Read
+	case http.MethodDelete:
+		return Delete
+	}
+	path = strings.Trim(path, "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	if path == "" || strings.HasPrefix(path, ":") || strings.HasPrefix(path, "*") {
+		return Write
+	}
+	return strings.ToLower(path)
+}
+
+// ActionForMethod is the action of one of rest's generic handlers: get and
+// list read, delete deletes, and create, update and patch write.
+func ActionForMethod(method string) string {
+	switch method {
+	case "get", "list":
+		return Read
+	case "delete":
+		return Delete
+	}
+	return Write
+}
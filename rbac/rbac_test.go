@@ -0,0 +1,102 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/hanzoai/commerce/models/roleassignment"
+)
+
+func builtin(names ...string) []Grant {
+	grants := make([]Grant, len(names))
+	for i, name := range names {
+		grants[i] = Grant{Role: name, Source: "builtin", Permissions: Builtin[name]}
+	}
+	return grants
+}
+
+func TestEvaluate(t *testing.T) {
+	key := Subject{Type: roleassignment.APIKey, Id: "warehouse"}
+
+	for _, c := range []struct {
+		roles            []string
+		resource, action string
+		want             bool
+	}{
+		{[]string{Owner}, "roleassignment", Write, true},
+		{[]string{Admin}, "order", "refund", true},
+		{[]string{Admin}, "roleassignment", Write, false},
+		{[]string{Admin}, "roleassignment", Read, true},
+		{[]string{Finance}, "order", Read, true},
+		{[]string{Finance}, "order", Write, false},
+		{[]string{Fulfilment}, "fulfillment", "ship", true},
+		{[]string{Fulfilment}, "return", "refund", false},
+		{[]string{Support, Fulfilment}, "return", "refund", true},
+		{[]string{Owner, Admin}, "role", Delete, false},
+	} {
+		d := Evaluate(key, builtin(c.roles...), c.resource, c.action)
+		if !d.Enforced || d.Allowed != c.want {
+			t.Errorf("%v %s:%s = %v (%s), want %v", c.roles, c.resource, c.action, d.Allowed, d.Reason, c.want)
+		}
+	}
+}
+
+func TestEvaluateUnassigned(t *testing.T) {
+	d := Evaluate(Subject{Type: roleassignment.User, Id: "u1"}, nil, "order", Write)
+	if d.Enforced || !d.Allowed {
+		t.Errorf("no roles = %+v, want not enforced", d)
+	}
+
+	unknown := []Grant{{Role: "ghost", Source: "unknown", Permissions: []string{}}}
+	d = Evaluate(Subject{Type: roleassignment.User, Id: "u1"}, unknown, "order", Read)
+	if !d.Enforced || d.Allowed {
+		t.Errorf("unknown role = %+v, want enforced and denied", d)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	for _, c := range []struct {
+		permission, resource, action string
+		want                         bool
+	}{
+		{"order:read", "order", "read", true},
+		{"Order:Read", "order", "read", true},
+		{"order:*", "order", "refund", true},
+		{"*:read", "payment", "read", true},
+		{"*:read", "payment", "write", false},
+		{"order", "order", "read", false},
+		{"order:read", "orders", "read", false},
+	} {
+		if got := Matches(c.permission, c.resource, c.action); got != c.want {
+			t.Errorf("Matches(%q, %s, %s) = %v, want %v", c.permission, c.resource, c.action, got, c.want)
+		}
+	}
+}
+
+func TestActionFor(t *testing.T) {
+	for _, c := range []struct{ method, path, want string }{
+		{"GET", "/:orderid", Read},
+		{"HEAD", "", Read},
+		{"DELETE", "/:orderid", Delete},
+		{"POST", "", Write},
+		{"PUT", "/:orderid", Write},
+		{"POST", "/:paymentid/refund", "refund"},
+		{"POST", "/ids/validate", "validate"},
+		{"POST", "/:returnid/Store-Credit", "store-credit"},
+	} {
+		if got := ActionFor(c.method, c.path); got != c.want {
+			t.Errorf("ActionFor(%s, %q) = %q, want %q", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestParseSubject(t *testing.T) {
+	s, err := ParseSubject("apikey:live-secret-key")
+	if err != nil || s.Type != roleassignment.APIKey || s.Id != "live-secret-key" {
+		t.Errorf("ParseSubject = %+v, %v", s, err)
+	}
+	for _, bad := range []string{"", "user", "user:", "group:ops"} {
+		if _, err := ParseSubject(bad); err == nil {
+			t.Errorf("ParseSubject(%q) succeeded", bad)
+		}
+	}
+}
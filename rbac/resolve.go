@@ -0,0 +1,82 @@
+package rbac
+
+import (
+	"strings"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/apipermission"
+	"github.com/hanzoai/commerce/models/role"
+	"github.com/hanzoai/commerce/models/roleassignment"
+)
+
+// Grants loads the roles assigned to subject in the org db is namespaced to,
+// expanded to their permissions. A subject assigned a role more than once
+// is granted it once.
+func Grants(db *datastore.Datastore, subject Subject) ([]Grant, error) {
+	var assignments []*roleassignment.RoleAssignment
+	_, err := roleassignment.Query(db).
+		Filter("SubjectType=", subject.Type).
+		Filter("SubjectId=", subject.Id).
+		GetAll(&assignments)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]Grant, 0)
+	seen := map[string]bool{}
+	for _, a := range assignments {
+		for _, name := range a.Roles {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			g, err := grant(db, name)
+			if err != nil {
+				return nil, err
+			}
+			grants = append(grants, g)
+		}
+	}
+	return grants, nil
+}
+
+// grant expands the role name: a built-in one, else the org's own.
+func grant(db *datastore.Datastore, name string) (Grant, error) {
+	if perms, ok := Builtin[name]; ok {
+		return Grant{Role: name, Source: "builtin", Permissions: perms}, nil
+	}
+
+	r := role.New(db)
+	ok, err := r.Query().Filter("Name=", name).Get()
+	if err != nil {
+		return Grant{}, err
+	}
+	if !ok {
+		return Grant{Role: name, Source: "unknown", Permissions: []string{}}, nil
+	}
+
+	perms := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		p = strings.TrimSpace(p)
+		if strings.Contains(p, ":") {
+			perms = append(perms, p)
+			continue
+		}
+		// Not resource:action, so the name of one of the org's ApiPermissions.
+		ap := apipermission.New(db)
+		found, err := ap.Query().Filter("Name=", strings.TrimPrefix(p, "!")).Get()
+		if err != nil {
+			return Grant{}, err
+		}
+		if !found {
+			continue
+		}
+		expanded := ap.Resource + ":" + ap.Action
+		if strings.HasPrefix(p, "!") {
+			expanded = "!" + expanded
+		}
+		perms = append(perms, expanded)
+	}
+	return Grant{Role: name, Source: "custom", Permissions: perms}, nil
+}
@@ -0,0 +1,30 @@
+package commerce
+
+import (
+	"context"
+	"fmt"
+)
+
+// startReservationSweeper starts the sweeper Bootstrap built.
+func (app *App) startReservationSweeper() {
+	if app.reservations != nil {
+		app.reservations.Start()
+	}
+}
+
+// orgNamespaces lists the namespace of every org, which is where its carts,
+// orders and stock live. It is the Namespaces of the reservation and
+// idempotency sweepers.
+func (app *App) orgNamespaces(ctx context.Context) ([]string, error) {
+	orgs, err := app.orgs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("org namespaces: %w", err)
+	}
+	namespaces := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		if ns := org.Namespace(); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
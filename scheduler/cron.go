@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression: when a job is due.
+//
+// Five fields, minute hour day-of-month month day-of-week, each a *, a value,
+// a range a-b, or a comma-separated list of those, any of them with a /step:
+//
+//	0 * * * *        the top of every hour
+//	*/15 * * * *     every fifteen minutes
+//	0 3 1 * *        03:00 on the first of the month
+//	30 6 * * 1-5     06:30 on weekdays
+//
+// Months and weekdays may be written by name (jan, mon), and Sunday is 0 or 7.
+// When both day fields are restricted a day matching either is due, as in
+// cron. The descriptors @yearly, @monthly, @weekly, @daily (or @midnight) and
+// @hourly stand for their usual expressions, and @every <duration> is due at
+// each multiple of the duration since the Unix epoch, a minute at least.
+//
+// Times are UTC: a replica's local zone must not move the billing run.
+type Schedule struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+
+	every time.Duration
+}
+
+// field is one of the five fields' bounds and names.
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("cron: empty expression")
+	}
+
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %q: %w", expr, err)
+		}
+		if d < time.Minute || d%time.Minute != 0 {
+			return nil, fmt.Errorf("cron: %q: @every takes whole minutes", expr)
+		}
+		return &Schedule{expr: expr, every: d}, nil
+	}
+
+	fields := expr
+	if strings.HasPrefix(expr, "@") {
+		std, ok := descriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("cron: unknown descriptor %q", expr)
+		}
+		fields = std
+	}
+
+	parts := strings.Fields(fields)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron: %q: want 5 fields, got %d", expr, len(parts))
+	}
+
+	s := &Schedule{expr: expr}
+	var err error
+	if s.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, fmt.Errorf("cron: %q: %w", expr, err)
+	}
+	if s.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, fmt.Errorf("cron: %q: %w", expr, err)
+	}
+	if s.dom, err = parseField(parts[2], domField); err != nil {
+		return nil, fmt.Errorf("cron: %q: %w", expr, err)
+	}
+	if s.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, fmt.Errorf("cron: %q: %w", expr, err)
+	}
+	if s.dow, err = parseField(parts[4], dowField); err != nil {
+		return nil, fmt.Errorf("cron: %q: %w", expr, err)
+	}
+	// Sunday is 0 and 7; keep one.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = strings.HasPrefix(parts[2], "*")
+	s.dowStar = strings.HasPrefix(parts[4], "*")
+	return s, nil
+}
+
+// MustParse is Parse for expressions known to be valid; it panics on error.
+func MustParse(expr string) *Schedule {
+	s, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// String is the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// parseField parses one field into a bit set of the values it allows.
+func parseField(spec string, f field) (uint64, error) {
+	var set uint64
+	for _, term := range strings.Split(spec, ",") {
+		rng, stepStr, hasStep := strings.Cut(term, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: bad step %q", f.name, stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: range %q runs backwards", f.name, rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// value is a single value of the field, by number or name.
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: bad value %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %d is outside %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next is the first time the schedule is due strictly after t, or the zero
+// time when it is never due (a 31st of February).
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.UTC()
+	if s.every > 0 {
+		return t.Truncate(s.every).Add(s.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Five years covers every day-of-month and weekday combination that can
+	// happen at all; past it the expression never matches.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule for the two day fields: when both are
+// restricted, either may match.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, c := range []struct {
+		expr, after, want string
+	}{
+		{"0 * * * *", "2026-10-18T10:00:00Z", "2026-10-18T11:00:00Z"},
+		{"0 * * * *", "2026-10-18T10:59:59Z", "2026-10-18T11:00:00Z"},
+		{"*/15 * * * *", "2026-10-18T10:07:00Z", "2026-10-18T10:15:00Z"},
+		{"5/20 * * * *", "2026-10-18T10:26:00Z", "2026-10-18T10:45:00Z"},
+		{"0 3 1 * *", "2026-10-18T10:00:00Z", "2026-11-01T03:00:00Z"},
+		{"0 3 1 * *", "2026-12-01T03:00:00Z", "2027-01-01T03:00:00Z"},
+		{"30 6 * * 1-5", "2026-10-16T07:00:00Z", "2026-10-19T06:30:00Z"}, // Friday to Monday
+		{"0 0 * * sun", "2026-10-18T00:00:00Z", "2026-10-25T00:00:00Z"},
+		{"0 0 * * 7", "2026-10-17T12:00:00Z", "2026-10-18T00:00:00Z"},
+		{"0 0 13 * fri", "2026-10-17T00:00:00Z", "2026-10-23T00:00:00Z"}, // either day field
+		{"0 0 29 feb *", "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 12 * jan,jul *", "2026-10-18T00:00:00Z", "2027-01-01T12:00:00Z"},
+		{"@monthly", "2026-10-18T10:00:00Z", "2026-11-01T00:00:00Z"},
+		{"@hourly", "2026-10-18T10:30:00Z", "2026-10-18T11:00:00Z"},
+		{"@every 10m", "2026-10-18T10:21:30Z", "2026-10-18T10:30:00Z"},
+	} {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.expr, err)
+			continue
+		}
+		if got := s.Next(at(c.after)); !got.Equal(at(c.want)) {
+			t.Errorf("%q after %s = %s, want %s", c.expr, c.after, got.Format(time.RFC3339), c.want)
+		}
+	}
+
+	if got := MustParse("0 0 31 2 *").Next(at("2026-01-01T00:00:00Z")); !got.IsZero() {
+		t.Errorf("31 February = %s, want never", got)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * smarch *",
+		"@fortnightly",
+		"@every 30s",
+		"@every soon",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
@@ -0,0 +1,668 @@
+// Package scheduler runs commerce's recurring jobs — billing cycles,
+// auto-recharge, contributor accruals — in process, on cron schedules, so a
+// deployment needs no CronJob poking admin endpoints to bill its customers.
+//
+// Every replica runs a Scheduler and every replica polls, but a job runs on
+// one replica at a time: before running, a replica takes the job's lock
+// (infra.Lock, through Locker), and holds it, extended, until the job
+// returns. Which slots have run is not the lock's to remember but the
+// History's: a replica that gets the lock reads the last scheduled run under
+// it, so a slot one replica has finished is never run again by the next to
+// ask.
+//
+// A slot no replica ran — every replica was down, or a deploy straddled it —
+// is dealt with by the job's CatchUp policy. Every run, scheduled or
+// triggered by hand, is recorded: when it was due, when it started and
+// ended, and how it went.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/log"
+)
+
+// CatchUp is what a job does about slots that passed while nothing ran it.
+type CatchUp string
+
+const (
+	// CatchUpSkip drops missed slots: the job runs at its next slot, or at
+	// one no more than Grace late.
+	CatchUpSkip CatchUp = "skip"
+
+	// CatchUpOnce runs the job once for everything it missed, as soon as a
+	// replica can. Right for a job that does all that is due whenever it
+	// runs, as a billing cycle does.
+	CatchUpOnce CatchUp = "once"
+
+	// CatchUpAll runs the job for each missed slot in turn, oldest first, up
+	// to MaxCatchUp of them. Right for a job whose runs each do one slot's
+	// work.
+	CatchUpAll CatchUp = "all"
+)
+
+// Trigger is what started a run.
+type Trigger string
+
+const (
+	TriggerSchedule Trigger = "schedule"
+	TriggerManual   Trigger = "manual"
+)
+
+// Outcome is how a run went.
+type Outcome string
+
+const (
+	Running   Outcome = "running"
+	Succeeded Outcome = "succeeded"
+	Failed    Outcome = "failed"
+
+	// Skipped records a slot CatchUpSkip dropped, so the next replica does
+	// not weigh it again.
+	Skipped Outcome = "skipped"
+)
+
+var (
+	// ErrHeld is what a Locker returns when another holder has the lock.
+	ErrHeld = errors.New("scheduler: lock held")
+
+	// ErrUnknownJob is returned for a job name nothing was added under.
+	ErrUnknownJob = errors.New("scheduler: unknown job")
+
+	// ErrRunning is returned by Trigger when the job is already running,
+	// here or on another replica.
+	ErrRunning = errors.New("scheduler: job already running")
+)
+
+// Run is one run of a job.
+type Run struct {
+	// Id is set by History when the run is first recorded.
+	Id string `json:"id"`
+
+	Job     string  `json:"job"`
+	Trigger Trigger `json:"trigger"`
+
+	// ScheduledAt is the slot a scheduled run is for. A manual run has none.
+	ScheduledAt time.Time `json:"scheduledAt,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	EndedAt     time.Time `json:"endedAt,omitempty"`
+
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+
+	// Host is the replica that ran it.
+	Host string `json:"host,omitempty"`
+}
+
+// History keeps the runs.
+type History interface {
+	// Record writes run: a new run when its Id is empty (setting it), the
+	// same one again otherwise.
+	Record(ctx context.Context, run *Run) error
+
+	// LastScheduled is the job's run with the latest ScheduledAt, or nil
+	// when it has never run on schedule.
+	LastScheduled(ctx context.Context, job string) (*Run, error)
+
+	// List is the job's latest runs, newest first.
+	List(ctx context.Context, job string, limit int) ([]*Run, error)
+}
+
+// Lock is a held lock.
+type Lock interface {
+	Extend(ctx context.Context, ttl time.Duration) error
+	Release(ctx context.Context) error
+}
+
+// Locker takes the lock on key for ttl, or returns ErrHeld.
+type Locker interface {
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Job is a recurring job.
+type Job struct {
+	// Name identifies the job in config, history and the admin API.
+	Name string
+
+	// Schedule is a cron expression (see Schedule). Empty runs the job only
+	// when triggered.
+	Schedule string
+
+	// CatchUp is the missed-slot policy; CatchUpOnce when empty.
+	CatchUp CatchUp
+
+	// Timeout bounds a run. Zero leaves it unbounded.
+	Timeout time.Duration
+
+	// Run does the work. Its context is cancelled at Timeout, when the
+	// scheduler stops, and when the replica loses the job's lock.
+	Run func(ctx context.Context) error
+
+	schedule *Schedule
+}
+
+// Config is a job's schedule as a deployment sets it, overriding the one the
+// job was written with.
+type Config struct {
+	// Schedule is a cron expression. "off" leaves the job to be triggered by
+	// hand.
+	Schedule string `json:"schedule"`
+
+	// CatchUp is the missed-slot policy. Empty keeps the job's own.
+	CatchUp CatchUp `json:"catchUp,omitempty"`
+}
+
+// Configure applies cfg to job.
+func (job Job) Configure(cfg Config) Job {
+	switch cfg.Schedule {
+	case "":
+	case "off":
+		job.Schedule = ""
+	default:
+		job.Schedule = cfg.Schedule
+	}
+	if cfg.CatchUp != "" {
+		job.CatchUp = cfg.CatchUp
+	}
+	return job
+}
+
+// JobStatus is a job as the admin API shows it.
+type JobStatus struct {
+	Name     string        `json:"name"`
+	Schedule string        `json:"schedule,omitempty"`
+	CatchUp  CatchUp       `json:"catchUp"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+
+	// Next is the job's next slot; zero for a job with no schedule.
+	Next time.Time `json:"next,omitempty"`
+
+	// Running reports whether this replica is running it now.
+	Running bool `json:"running"`
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	// Locker elects the replica that runs each job. Nil runs every job
+	// unlocked, which is only right for a single replica.
+	Locker Locker
+
+	// History records runs, and is how replicas agree which slots are done.
+	History History
+
+	// Interval is the time between polls. Slots are run at most this late.
+	Interval time.Duration
+
+	// Grace is how late a slot may start and still be on time.
+	Grace time.Duration
+
+	// LockTTL is how long a job's lock outlives a replica that dies holding
+	// it. A running job's lock is extended well within it.
+	LockTTL time.Duration
+
+	// MaxCatchUp bounds the slots CatchUpAll runs after an outage.
+	MaxCatchUp int
+
+	// Host names this replica in the runs it records.
+	Host string
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	cursors map[string]time.Time
+	busy    map[string]bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New returns a Scheduler that elects with locker and records to history,
+// polling every 30 seconds.
+func New(locker Locker, history History) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		Locker:     locker,
+		History:    history,
+		Interval:   30 * time.Second,
+		Grace:      5 * time.Minute,
+		LockTTL:    time.Minute,
+		MaxCatchUp: 24,
+		Host:       host,
+		now:        time.Now,
+		jobs:       map[string]*Job{},
+		cursors:    map[string]time.Time{},
+		busy:       map[string]bool{},
+	}
+}
+
+// Add adds a job. It fails on a duplicate name, a bad schedule or an unknown
+// CatchUp policy, so a typo in config stops the boot rather than a job.
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return errors.New("scheduler: a job needs a Name and a Run")
+	}
+	switch job.CatchUp {
+	case "":
+		job.CatchUp = CatchUpOnce
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return fmt.Errorf("scheduler: job %s: unknown catch-up policy %q", job.Name, job.CatchUp)
+	}
+	if job.Schedule != "" {
+		sched, err := Parse(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("scheduler: job %s: %w", job.Name, err)
+		}
+		job.schedule = sched
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("scheduler: job %s added twice", job.Name)
+	}
+	s.jobs[job.Name] = &job
+	return nil
+}
+
+// Jobs lists the jobs by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		st := JobStatus{
+			Name:     j.Name,
+			Schedule: j.Schedule,
+			CatchUp:  j.CatchUp,
+			Timeout:  j.Timeout,
+			Running:  s.busy[j.Name],
+		}
+		if j.schedule != nil {
+			st.Next = j.schedule.Next(now)
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// Runs is the job's latest runs, newest first.
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int) ([]*Run, error) {
+	if s.job(name) == nil {
+		return nil, ErrUnknownJob
+	}
+	return s.History.List(ctx, name, limit)
+}
+
+// Trigger runs a job now, on this replica, whatever its schedule. It returns
+// the run as recorded when it starts; the job runs on in the background. A
+// manual run is not a slot: the schedule carries on as if it had not run.
+func (s *Scheduler) Trigger(name string) (*Run, error) {
+	j := s.job(name)
+	if j == nil {
+		return nil, ErrUnknownJob
+	}
+	if !s.claim(j) {
+		return nil, ErrRunning
+	}
+	ctx := s.baseContext()
+
+	lock, err := s.acquire(ctx, j)
+	if err != nil {
+		s.unclaim(j)
+		if errors.Is(err, ErrHeld) {
+			return nil, ErrRunning
+		}
+		return nil, err
+	}
+
+	run := &Run{Job: j.Name, Trigger: TriggerManual, StartedAt: s.now(), Outcome: Running, Host: s.Host}
+	if err := s.History.Record(ctx, run); err != nil {
+		s.release(ctx, j, lock)
+		s.unclaim(j)
+		return nil, err
+	}
+	started := *run
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.unclaim(j)
+		defer s.release(ctx, j, lock)
+		s.execute(ctx, j, lock, run)
+	}()
+	return &started, nil
+}
+
+// Poll runs, or starts running, every job with a slot due. Each runs on its
+// own goroutine; Poll does not wait for them.
+func (s *Scheduler) Poll(ctx context.Context) {
+	s.mu.Lock()
+	due := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		if j.schedule != nil && !s.busy[j.Name] {
+			due = append(due, j)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, j := range due {
+		if !s.claim(j) {
+			continue
+		}
+		s.wg.Add(1)
+		go func(j *Job) {
+			defer s.wg.Done()
+			defer s.unclaim(j)
+			s.poll(ctx, j)
+		}(j)
+	}
+}
+
+// poll runs j's due slots, if it can take j's lock.
+func (s *Scheduler) poll(ctx context.Context, j *Job) {
+	now := s.now()
+	cursor, known := s.cursor(j)
+	if known {
+		if next := j.schedule.Next(cursor); next.IsZero() || next.After(now) {
+			return
+		}
+	}
+
+	lock, err := s.acquire(ctx, j)
+	if errors.Is(err, ErrHeld) {
+		// Another replica is running it. When it is done, the next poll
+		// finds the slot recorded.
+		return
+	} else if err != nil {
+		log.Warn("scheduler: %s: lock: %v", j.Name, err, ctx)
+		return
+	}
+	defer s.release(ctx, j, lock)
+
+	// Under the lock, history is the word on which slots are done.
+	last, err := s.History.LastScheduled(ctx, j.Name)
+	if err != nil {
+		log.Error("scheduler: %s: last run: %v", j.Name, err, ctx)
+		return
+	}
+	switch {
+	case last != nil && last.ScheduledAt.After(cursor):
+		cursor = last.ScheduledAt
+	case last == nil && !known:
+		// A job that has never run starts with a slot that has only just
+		// passed, not with every slot since the epoch.
+		cursor = now.Add(-s.Grace)
+	}
+
+	slots := s.slots(j, cursor, now)
+	if len(slots) == 0 {
+		s.setCursor(j, cursor)
+		return
+	}
+	latest := slots[len(slots)-1]
+
+	switch j.CatchUp {
+	case CatchUpSkip:
+		if now.Sub(latest) > s.Grace {
+			s.skip(ctx, j, latest)
+		} else {
+			s.runSlot(ctx, j, lock, latest)
+		}
+	case CatchUpAll:
+		for _, slot := range slots {
+			if ctx.Err() != nil {
+				return
+			}
+			if !s.runSlot(ctx, j, lock, slot) {
+				return
+			}
+		}
+	default:
+		s.runSlot(ctx, j, lock, latest)
+	}
+}
+
+// maxSlots bounds the walk over missed slots. A job due every minute that
+// missed more is walked this far per poll, and the rest on the next.
+const maxSlots = 100000
+
+// slots are j's slots after cursor, up to now: the latest MaxCatchUp of them
+// for CatchUpAll, and only the latest for the other policies.
+func (s *Scheduler) slots(j *Job, cursor, now time.Time) []time.Time {
+	keep := 1
+	if j.CatchUp == CatchUpAll && s.MaxCatchUp > 0 {
+		keep = s.MaxCatchUp
+	}
+	var out []time.Time
+	for t, n := j.schedule.Next(cursor), 0; !t.IsZero() && !t.After(now) && n < maxSlots; t, n = j.schedule.Next(t), n+1 {
+		out = append(out, t)
+		if len(out) > keep {
+			out = out[1:]
+		}
+	}
+	return out
+}
+
+// runSlot runs j for slot and records it. It reports whether the run could
+// be recorded, and so whether catching up may go on.
+func (s *Scheduler) runSlot(ctx context.Context, j *Job, lock Lock, slot time.Time) bool {
+	run := &Run{Job: j.Name, Trigger: TriggerSchedule, ScheduledAt: slot, StartedAt: s.now(), Outcome: Running, Host: s.Host}
+	if err := s.History.Record(ctx, run); err != nil {
+		// Unrecorded, the slot would look undone to the next replica and run
+		// again: do not run it at all.
+		log.Error("scheduler: %s: record run: %v", j.Name, err, ctx)
+		return false
+	}
+	s.setCursor(j, slot)
+	s.execute(ctx, j, lock, run)
+	return true
+}
+
+// skip records slot as skipped.
+func (s *Scheduler) skip(ctx context.Context, j *Job, slot time.Time) {
+	now := s.now()
+	run := &Run{Job: j.Name, Trigger: TriggerSchedule, ScheduledAt: slot, StartedAt: now, EndedAt: now, Outcome: Skipped, Host: s.Host}
+	if err := s.History.Record(ctx, run); err != nil {
+		log.Error("scheduler: %s: record skipped slot: %v", j.Name, err, ctx)
+		return
+	}
+	log.Info("scheduler: %s: skipped the slot at %s, %s late", j.Name, slot.Format(time.RFC3339), now.Sub(slot).Round(time.Second), ctx)
+	s.setCursor(j, slot)
+}
+
+// execute runs j, keeping its lock, and records how the run went.
+func (s *Scheduler) execute(ctx context.Context, j *Job, lock Lock, run *Run) {
+	parent := ctx
+	if j.Timeout > 0 {
+		var stop context.CancelFunc
+		parent, stop = context.WithTimeout(ctx, j.Timeout)
+		defer stop()
+	}
+	jctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	kept := make(chan struct{})
+	go s.keep(jctx, cancel, j, lock, kept)
+
+	err := call(jctx, j)
+	cancel()
+	<-kept
+
+	run.EndedAt = s.now()
+	if err != nil {
+		run.Outcome = Failed
+		run.Error = err.Error()
+		log.Error("scheduler: %s: failed after %s: %v", j.Name, run.EndedAt.Sub(run.StartedAt).Round(time.Millisecond), err, ctx)
+	} else {
+		run.Outcome = Succeeded
+		log.Info("scheduler: %s: done in %s", j.Name, run.EndedAt.Sub(run.StartedAt).Round(time.Millisecond), ctx)
+	}
+	// The outcome is written even when the scheduler is stopping.
+	if err := s.History.Record(context.WithoutCancel(ctx), run); err != nil {
+		log.Error("scheduler: %s: record outcome: %v", j.Name, err, ctx)
+	}
+}
+
+// keep extends j's lock while it runs, and cancels the run if the lock is
+// lost: past that another replica may start it.
+func (s *Scheduler) keep(ctx context.Context, cancel context.CancelFunc, j *Job, lock Lock, done chan<- struct{}) {
+	defer close(done)
+	if lock == nil || s.LockTTL <= 0 {
+		return
+	}
+	t := time.NewTicker(s.LockTTL / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := lock.Extend(ctx, s.LockTTL); err != nil && ctx.Err() == nil {
+				log.Error("scheduler: %s: lost the lock, stopping the run: %v", j.Name, err, ctx)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// call runs j, turning a panic into an error.
+func call(ctx context.Context, j *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run(ctx)
+}
+
+func (s *Scheduler) acquire(ctx context.Context, j *Job) (Lock, error) {
+	if s.Locker == nil {
+		return nil, nil
+	}
+	return s.Locker.Acquire(ctx, "scheduler:"+j.Name, s.LockTTL)
+}
+
+func (s *Scheduler) release(ctx context.Context, j *Job, lock Lock) {
+	if lock == nil {
+		return
+	}
+	if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+		log.Warn("scheduler: %s: release lock: %v", j.Name, err, ctx)
+	}
+}
+
+func (s *Scheduler) job(name string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[name]
+}
+
+// claim marks j busy on this replica, reporting false when it already is.
+func (s *Scheduler) claim(j *Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[j.Name] {
+		return false
+	}
+	s.busy[j.Name] = true
+	return true
+}
+
+func (s *Scheduler) unclaim(j *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.busy, j.Name)
+}
+
+// cursor is the last of j's slots this replica knows to be done, and whether
+// it knows one at all. Until it does, every poll reads the history.
+func (s *Scheduler) cursor(j *Job) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cursors[j.Name]
+	return c, ok
+}
+
+func (s *Scheduler) setCursor(j *Job, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.cursors[j.Name]; !ok || t.After(c) {
+		s.cursors[j.Name] = t
+	}
+}
+
+// baseContext is the context runs get: cancelled by Stop, or background
+// before Start.
+func (s *Scheduler) baseContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+// Start polls until Stop. It is a no-op when the scheduler is already
+// running.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go s.loop(s.ctx, s.stop, s.done)
+}
+
+func (s *Scheduler) loop(ctx context.Context, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		s.Poll(ctx)
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.Interval):
+		}
+	}
+}
+
+// Stop ends polling, cancels the runs in progress and waits for them to
+// record how they ended.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	stop, done, cancel := s.stop, s.done, s.cancel
+	s.mu.Unlock()
+
+	close(stop)
+	<-done
+	cancel()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	s.ctx, s.cancel = nil, nil
+	s.mu.Unlock()
+}
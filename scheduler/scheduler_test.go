@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memHistory is an in-memory History.
+type memHistory struct {
+	mu   sync.Mutex
+	runs []Run
+}
+
+func (h *memHistory) Record(_ context.Context, run *Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if run.Id == "" {
+		run.Id = strconv.Itoa(len(h.runs) + 1)
+		h.runs = append(h.runs, *run)
+		return nil
+	}
+	for i := range h.runs {
+		if h.runs[i].Id == run.Id {
+			h.runs[i] = *run
+		}
+	}
+	return nil
+}
+
+func (h *memHistory) LastScheduled(_ context.Context, job string) (*Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var last *Run
+	for i := range h.runs {
+		r := h.runs[i]
+		if r.Job == job && r.Trigger == TriggerSchedule && (last == nil || r.ScheduledAt.After(last.ScheduledAt)) {
+			last = &r
+		}
+	}
+	return last, nil
+}
+
+func (h *memHistory) List(_ context.Context, job string, limit int) ([]*Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []*Run
+	for i := len(h.runs) - 1; i >= 0 && len(out) < limit; i-- {
+		if r := h.runs[i]; r.Job == job {
+			out = append(out, &r)
+		}
+	}
+	return out, nil
+}
+
+// slots is the ScheduledAt of the job's scheduled runs with outcome, in order.
+func (h *memHistory) slots(job string, outcome Outcome) []time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []time.Time
+	for _, r := range h.runs {
+		if r.Job == job && r.Trigger == TriggerSchedule && r.Outcome == outcome {
+			out = append(out, r.ScheduledAt)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Before(out[k]) })
+	return out
+}
+
+// memLocker is an in-memory Locker shared by the replicas of a test.
+type memLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+type memLock struct {
+	l   *memLocker
+	key string
+}
+
+func (l *memLocker) Acquire(_ context.Context, key string, _ time.Duration) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		l.held = map[string]bool{}
+	}
+	if l.held[key] {
+		return nil, ErrHeld
+	}
+	l.held[key] = true
+	return &memLock{l, key}, nil
+}
+
+func (m *memLock) Extend(context.Context, time.Duration) error { return nil }
+
+func (m *memLock) Release(context.Context) error {
+	m.l.mu.Lock()
+	defer m.l.mu.Unlock()
+	delete(m.l.held, m.key)
+	return nil
+}
+
+// replica is a Scheduler on a fake clock, with one hourly job counting runs.
+func replica(t *testing.T, locker Locker, history History, clock *time.Time, catchUp CatchUp, runs *int, mu *sync.Mutex) *Scheduler {
+	t.Helper()
+	s := New(locker, history)
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return *clock
+	}
+	err := s.Add(Job{Name: "cycle", Schedule: "@hourly", CatchUp: catchUp, Run: func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*runs++
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// poll polls s and waits for what it started.
+func poll(s *Scheduler) {
+	s.Poll(context.Background())
+	s.wg.Wait()
+}
+
+func TestSchedulerRunsEachSlotOnceAcrossReplicas(t *testing.T) {
+	var mu sync.Mutex
+	clock := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	history, locker := &memHistory{}, &memLocker{}
+	runs := 0
+	a := replica(t, locker, history, &clock, CatchUpOnce, &runs, &mu)
+	b := replica(t, locker, history, &clock, CatchUpOnce, &runs, &mu)
+
+	poll(a)
+	poll(b)
+	if runs != 0 {
+		t.Fatalf("ran %d times before the first slot", runs)
+	}
+
+	mu.Lock()
+	clock = time.Date(2026, 10, 18, 10, 0, 20, 0, time.UTC)
+	mu.Unlock()
+	poll(a)
+	poll(b)
+	poll(a)
+	if runs != 1 {
+		t.Fatalf("the 10:00 slot ran %d times across two replicas, want once", runs)
+	}
+	got := history.slots("cycle", Succeeded)
+	if len(got) != 1 || !got[0].Equal(time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("recorded slots = %v", got)
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	for _, c := range []struct {
+		policy  CatchUp
+		runs    int
+		skipped int
+	}{
+		{CatchUpSkip, 0, 1},
+		{CatchUpOnce, 1, 0},
+		{CatchUpAll, 5, 0},
+	} {
+		t.Run(string(c.policy), func(t *testing.T) {
+			var mu sync.Mutex
+			history := &memHistory{}
+			// The 09:00 slot ran; every replica was then down until 14:20.
+			history.runs = append(history.runs, Run{Id: "1", Job: "cycle", Trigger: TriggerSchedule,
+				ScheduledAt: time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), Outcome: Succeeded})
+			clock := time.Date(2026, 10, 18, 14, 20, 0, 0, time.UTC)
+			runs := 0
+			s := replica(t, &memLocker{}, history, &clock, c.policy, &runs, &mu)
+
+			poll(s)
+			poll(s)
+			if runs != c.runs {
+				t.Errorf("ran %d times, want %d", runs, c.runs)
+			}
+			if got := len(history.slots("cycle", Skipped)); got != c.skipped {
+				t.Errorf("skipped %d slots, want %d", got, c.skipped)
+			}
+			last, _ := history.LastScheduled(context.Background(), "cycle")
+			if want := time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC); !last.ScheduledAt.Equal(want) {
+				t.Errorf("last slot = %s, want %s", last.ScheduledAt, want)
+			}
+		})
+	}
+}
+
+func TestSchedulerTrigger(t *testing.T) {
+	history := &memHistory{}
+	s := New(&memLocker{}, history)
+	release := make(chan struct{})
+	if err := s.Add(Job{Name: "payouts", Run: func(context.Context) error {
+		<-release
+		return errors.New("no revenue ledger")
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := s.Trigger("payouts")
+	if err != nil || run.Trigger != TriggerManual || run.Outcome != Running {
+		t.Fatalf("Trigger = %+v, %v", run, err)
+	}
+	if _, err := s.Trigger("payouts"); !errors.Is(err, ErrRunning) {
+		t.Fatalf("second Trigger = %v, want ErrRunning", err)
+	}
+	if _, err := s.Trigger("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("Trigger(nope) = %v, want ErrUnknownJob", err)
+	}
+
+	close(release)
+	s.wg.Wait()
+	runs, _ := s.Runs(context.Background(), "payouts", 10)
+	if len(runs) != 1 || runs[0].Outcome != Failed || runs[0].Error != "no revenue ledger" || runs[0].EndedAt.IsZero() {
+		t.Fatalf("runs = %+v", runs)
+	}
+	if last, _ := history.LastScheduled(context.Background(), "payouts"); last != nil {
+		t.Fatalf("a manual run counted as a slot: %+v", last)
+	}
+}
+
+func TestSchedulerAddRejects(t *testing.T) {
+	s := New(nil, &memHistory{})
+	run := func(context.Context) error { return nil }
+	if err := s.Add(Job{Name: "a", Schedule: "0 * * *", Run: run}); err == nil {
+		t.Error("bad schedule accepted")
+	}
+	if err := s.Add(Job{Name: "a", CatchUp: "sometimes", Run: run}); err == nil {
+		t.Error("unknown catch-up policy accepted")
+	}
+	if err := s.Add(Job{Name: "a", Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Job{Name: "a", Run: run}); err == nil {
+		t.Error("duplicate job accepted")
+	}
+}
+
+func TestJobConfigure(t *testing.T) {
+	j := Job{Name: "prune", Schedule: "@daily", CatchUp: CatchUpSkip}
+	if got := j.Configure(Config{}); got.Schedule != "@daily" || got.CatchUp != CatchUpSkip {
+		t.Errorf("empty config changed the job: %+v", got)
+	}
+	if got := j.Configure(Config{Schedule: "0 3 * * *", CatchUp: CatchUpAll}); got.Schedule != "0 3 * * *" || got.CatchUp != CatchUpAll {
+		t.Errorf("Configure = %+v", got)
+	}
+	if got := j.Configure(Config{Schedule: "off"}); got.Schedule != "" {
+		t.Errorf("off left the schedule %q", got.Schedule)
+	}
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +31,8 @@ var ErrKVNotFound = errors.New("store: kv key not found")
 //     entry counts as absent and is overwritten.
 //   - CompareAndDelete / CompareAndExtend — atomic lock release/renew without
 //     server-side scripting (base SQLite transactions are serializable).
+//   - IncrBy — atomic counter (drives rate limiting); the ttl applies only
+//     when the counter is created.
 //
 // All mutating operations run inside RunInTransaction so concurrent writers
 // cannot corrupt or race the upsert; SQLite's serializable isolation makes the
@@ -262,6 +265,51 @@ func (s *KVStore) CompareAndExtend(key string, want []byte, ttl time.Duration) (
 	return extended, nil
 }
 
+// IncrBy atomically adds by to the integer stored at key and returns the
+// result. An absent or expired entry counts as 0 and is created with ttl; an
+// existing live entry keeps its expiry, so a fixed window counted here closes
+// when it was opened to, however often it is bumped. A value that is not an
+// integer is an error, as INCRBY's is.
+func (s *KVStore) IncrBy(key string, by int64, ttl time.Duration) (int64, error) {
+	if key == "" {
+		return 0, errors.New("store: kv incr: empty key")
+	}
+	var n int64
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		rec, err := s.findRecord(txApp, key)
+		if err != nil {
+			return fmt.Errorf("store: kv incr lookup: %w", err)
+		}
+		if rec != nil && live(int64(rec.GetInt("expires_at"))) {
+			cur, err := strconv.ParseInt(rec.GetString("value"), 10, 64)
+			if err != nil {
+				return fmt.Errorf("store: kv incr: value of %q is not an integer", key)
+			}
+			n = cur + by
+		} else {
+			if rec == nil {
+				collection, err := txApp.FindCollectionByNameOrId("commerce_kv")
+				if err != nil {
+					return fmt.Errorf("store: kv incr collection: %w", err)
+				}
+				rec = core.NewRecord(collection)
+				rec.Set("key", key)
+			}
+			rec.Set("expires_at", expiresAt(ttl))
+			n = by
+		}
+		rec.Set("value", strconv.FormatInt(n, 10))
+		if err := txApp.Save(rec); err != nil {
+			return fmt.Errorf("store: kv incr save: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // isUniqueViolationKV mirrors isUniqueViolation for kv-key collisions. A SetNX
 // race where two transactions both pass the absence check is impossible under
 // SQLite serializable isolation, but the unique index on `key` is the
@@ -195,6 +195,53 @@ func TestKVCompareAndExtend(t *testing.T) {
 	}
 }
 
+func TestKVIncrBy(t *testing.T) {
+	kv := newTestStore(t).KV
+	if n, err := kv.IncrBy("ctr", 1, 40*time.Millisecond); err != nil || n != 1 {
+		t.Fatalf("IncrBy new = (%d, %v), want (1, nil)", n, err)
+	}
+	if n, err := kv.IncrBy("ctr", 4, time.Hour); err != nil || n != 5 {
+		t.Fatalf("IncrBy live = (%d, %v), want (5, nil)", n, err)
+	}
+	if n, err := kv.IncrBy("ctr", -1, time.Hour); err != nil || n != 4 {
+		t.Fatalf("IncrBy -1 = (%d, %v), want (4, nil)", n, err)
+	}
+	// The second bump's hour must not have extended the counter: it still
+	// expires with the window it was created for, and starts over.
+	time.Sleep(80 * time.Millisecond)
+	if n, err := kv.IncrBy("ctr", 1, time.Hour); err != nil || n != 1 {
+		t.Fatalf("IncrBy after expiry = (%d, %v), want (1, nil)", n, err)
+	}
+
+	if err := kv.Set("word", []byte("abc"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := kv.IncrBy("word", 1, 0); err == nil {
+		t.Fatal("IncrBy on a non-integer succeeded")
+	}
+}
+
+// TestKVIncrByConcurrent asserts no increment is lost when 50 goroutines bump
+// one counter at once.
+func TestKVIncrByConcurrent(t *testing.T) {
+	kv := newTestStore(t).KV
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := kv.IncrBy("hot", 1, time.Minute); err != nil {
+				t.Errorf("IncrBy: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	got, err := kv.Get("hot")
+	if err != nil || string(got) != "50" {
+		t.Fatalf("counter = (%q, %v), want 50", got, err)
+	}
+}
+
 // TestKVConcurrentWriters asserts that 100 goroutines hammering Set on the same
 // and distinct keys never corrupt the store. base's serializable SQLite
 // transactions serialize the read-modify-write upsert.
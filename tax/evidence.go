@@ -0,0 +1,37 @@
+package tax
+
+// Evidence is what shows where the buyer of a digital sale is. The EU taxes
+// such a sale where the buyer is, and has the seller keep two pieces of
+// evidence that agree on it; three are kept here, so that a VPN or a card
+// from home does not leave a sale with only one.
+type Evidence struct {
+	// BillingCountry is the country of the billing address the buyer gave.
+	BillingCountry string `json:"billingCountry,omitempty"`
+
+	// IPCountry is the country the buyer's IP address was in at checkout.
+	IPCountry string `json:"ipCountry,omitempty"`
+
+	// CardCountry is the country that issued the buyer's card, from its
+	// BIN, as the processor reported it.
+	CardCountry string `json:"cardCountry,omitempty"`
+}
+
+// Country is the country at least two pieces of evidence agree on, and
+// true; or, when none do, the billing country, else the IP's, else the
+// card's, and false.
+func (e Evidence) Country() (string, bool) {
+	pieces := []string{e.BillingCountry, e.IPCountry, e.CardCountry}
+	for i, a := range pieces {
+		for _, b := range pieces[i+1:] {
+			if a != "" && a == b {
+				return a, true
+			}
+		}
+	}
+	for _, c := range pieces {
+		if c != "" {
+			return c, false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,23 @@
+package tax
+
+import "testing"
+
+func TestEvidence_Country(t *testing.T) {
+	cases := []struct {
+		e       Evidence
+		country string
+		agreed  bool
+	}{
+		{Evidence{BillingCountry: "DE", IPCountry: "DE", CardCountry: "FR"}, "DE", true},
+		{Evidence{BillingCountry: "DE", IPCountry: "NL", CardCountry: "NL"}, "NL", true},
+		{Evidence{BillingCountry: "DE", CardCountry: "DE"}, "DE", true},
+		{Evidence{BillingCountry: "DE", IPCountry: "NL", CardCountry: "FR"}, "DE", false},
+		{Evidence{IPCountry: "NL"}, "NL", false},
+		{Evidence{}, "", false},
+	}
+	for _, c := range cases {
+		if country, agreed := c.e.Country(); country != c.country || agreed != c.agreed {
+			t.Errorf("%+v: %q %v, want %q %v", c.e, country, agreed, c.country, c.agreed)
+		}
+	}
+}
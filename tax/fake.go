@@ -0,0 +1,173 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// FakeName is the name Fake registers under.
+const FakeName = "fake"
+
+// Fake is an external tax provider in memory, for tests: it quotes one rate
+// per address and keeps its own record of committed sales, as a tax service
+// does, so that what checkout commits, voids and refunds can be looked at
+// afterwards.
+type Fake struct {
+	// Rates is the rate of a jurisdiction, by country-province code or
+	// else by country.
+	Rates map[string]float64
+
+	// TaxShipping is whether shipping is taxed.
+	TaxShipping bool
+
+	// Err, when set, is what every call returns, as when the service is
+	// down.
+	Err error
+
+	mu           sync.Mutex
+	seq          int
+	transactions map[string]*FakeTransaction
+}
+
+// FakeTransaction is a sale as Fake recorded it.
+type FakeTransaction struct {
+	Transaction
+	Voided   bool
+	Refunded currency.Cents
+}
+
+func NewFake(rates map[string]float64) *Fake {
+	return &Fake{Rates: rates, transactions: make(map[string]*FakeTransaction)}
+}
+
+func (f *Fake) Name() string { return FakeName }
+
+func (f *Fake) Quote(ctx context.Context, req *Request) (*Quote, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	q := &Quote{Provider: FakeName, Inclusive: req.Inclusive, Lines: make([]LineTax, 0, len(req.Lines))}
+
+	jurisdiction := Jurisdiction(req.Address.Country, req.Address.Province)
+	r, ok := f.Rates[jurisdiction]
+	if !ok {
+		jurisdiction = req.Address.Country
+		r, ok = f.Rates[jurisdiction]
+	}
+	var rates []rate
+	reverse := ok && ReverseCharge(req)
+	if ok {
+		q.Jurisdiction = jurisdiction
+		if !req.Customer.Exempt && !reverse {
+			rates = []rate{{name: "Fake tax", code: "FAKE", rate: r}}
+		}
+	}
+	q.Exempt = ok && req.Customer.Exempt
+	q.ExemptionNumber = req.Customer.ExemptionNumber
+	if reverse {
+		q.ReverseCharge, q.TaxId = true, req.Customer.TaxId.Value
+	}
+
+	for _, l := range req.Lines {
+		lineRates := rates
+		if !l.Taxable {
+			lineRates = nil
+		}
+		lt, err := apply(l.Amount(), lineRates, req.Inclusive, jurisdiction)
+		if err != nil {
+			return nil, err
+		}
+		lt.LineId = l.Id
+		q.Lines = append(q.Lines, lt)
+		q.Tax += lt.Tax
+	}
+	if !f.TaxShipping {
+		rates = nil
+	}
+	shipping, err := apply(req.Shipping, rates, req.Inclusive, jurisdiction)
+	if err != nil {
+		return nil, err
+	}
+	q.Shipping = shipping
+	q.Tax += shipping.Tax
+	return q, nil
+}
+
+func (f *Fake) Commit(ctx context.Context, req *Request) (*Transaction, error) {
+	if req.Reference == "" {
+		return nil, ErrNoReference
+	}
+	q, err := f.Quote(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.transactions {
+		if t.Reference == req.Reference && !t.Voided {
+			tx := t.Transaction
+			return &tx, nil
+		}
+	}
+	f.seq++
+	t := &FakeTransaction{Transaction: Transaction{
+		Id:        fmt.Sprintf("ftx_%d", f.seq),
+		Provider:  FakeName,
+		Reference: req.Reference,
+		Tax:       q.Tax,
+	}}
+	if f.transactions == nil {
+		f.transactions = make(map[string]*FakeTransaction)
+	}
+	f.transactions[t.Id] = t
+	tx := t.Transaction
+	return &tx, nil
+}
+
+func (f *Fake) Void(ctx context.Context, transactionId string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.transactions[transactionId]
+	if !ok {
+		return ErrUnknownTransaction
+	}
+	t.Voided = true
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, transactionId string, amount currency.Cents) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.transactions[transactionId]
+	switch {
+	case !ok:
+		return ErrUnknownTransaction
+	case t.Voided:
+		return ErrVoided
+	case t.Refunded+amount > t.Tax:
+		return ErrRefundExceedsTax
+	}
+	t.Refunded += amount
+	return nil
+}
+
+// Transaction returns the transaction with the given id as it stands.
+func (f *Fake) Transaction(id string) (FakeTransaction, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.transactions[id]
+	if !ok {
+		return FakeTransaction{}, false
+	}
+	return *t, true
+}
@@ -0,0 +1,69 @@
+package tax
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake(map[string]float64{"US-NY": 0.08, "US": 0.05})
+	req := &Request{Reference: "ord_1", Address: Address{Country: "US", Province: "NY"}, Lines: []Line{line("p1", 1000, 2)}, Shipping: 500}
+
+	q, err := f.Quote(ctx, req)
+	if err != nil || q.Tax != 160 || q.Jurisdiction != "US-NY" || q.Provider != FakeName {
+		t.Fatalf("quote = %+v, %v", q, err)
+	}
+	if q, _ := f.Quote(ctx, &Request{Address: Address{Country: "US", Province: "TX"}, Lines: req.Lines}); q.Tax != 100 || q.Jurisdiction != "US" {
+		t.Fatalf("country fallback = %+v", q)
+	}
+
+	tx, err := f.Commit(ctx, req)
+	if err != nil || tx.Tax != 160 {
+		t.Fatalf("commit = %+v, %v", tx, err)
+	}
+	if again, _ := f.Commit(ctx, req); again.Id != tx.Id {
+		t.Fatalf("committing ord_1 again made %s, not %s", again.Id, tx.Id)
+	}
+
+	if err := f.Refund(ctx, tx.Id, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Refund(ctx, tx.Id, 61); !errors.Is(err, ErrRefundExceedsTax) {
+		t.Fatalf("over-refund: err = %v", err)
+	}
+	if err := f.Void(ctx, tx.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Transaction(tx.Id); !got.Voided || got.Refunded != 100 {
+		t.Fatalf("transaction = %+v", got)
+	}
+	if err := f.Refund(ctx, tx.Id, 1); !errors.Is(err, ErrVoided) {
+		t.Fatalf("refund of voided: err = %v", err)
+	}
+	if err := f.Void(ctx, "ftx_404"); !errors.Is(err, ErrUnknownTransaction) {
+		t.Fatalf("void of unknown: err = %v", err)
+	}
+
+	down := errors.New("service unavailable")
+	f.Err = down
+	if _, err := f.Quote(ctx, req); !errors.Is(err, down) {
+		t.Fatalf("quote while down: err = %v", err)
+	}
+}
+
+// A registered provider is found by name; an unknown one is an error.
+func TestRegister(t *testing.T) {
+	f := NewFake(nil)
+	Register(f)
+	if p, err := Get(FakeName); err != nil || p != f {
+		t.Fatalf("Get(fake) = %v, %v", p, err)
+	}
+	if _, err := Get(BuiltIn); err != nil {
+		t.Fatalf("Get(rules): %v", err)
+	}
+	if _, err := Get("avalara"); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Get(avalara): err = %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package tax
+
+import (
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/company"
+	"github.com/hanzoai/commerce/models/employee"
+	"github.com/hanzoai/commerce/models/pricepreference"
+	"github.com/hanzoai/commerce/models/product"
+	"github.com/hanzoai/commerce/models/taxrate"
+	"github.com/hanzoai/commerce/models/taxraterule"
+	"github.com/hanzoai/commerce/models/taxregion"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax/taxid"
+)
+
+// Prepare fills in what the caller of a quote need not know: each line's
+// product type and tax code from its product, whether the customer buys for
+// a tax-exempt company and under what tax number, whether the region or
+// currency prices include tax, and whether the region reverse-charges on an
+// unverified number.
+func Prepare(db *datastore.Datastore, req *Request) error {
+	for i := range req.Lines {
+		l := &req.Lines[i]
+		if l.ProductId == "" || (l.ProductTypeId != "" && l.TaxCode != "") {
+			continue
+		}
+		p := product.New(db)
+		if err := p.GetById(l.ProductId); err != nil {
+			continue
+		}
+		if l.ProductTypeId == "" {
+			l.ProductTypeId = p.TypeId
+		}
+		if l.TaxCode == "" {
+			l.TaxCode = p.TaxCode
+		}
+	}
+
+	if req.Customer.Id != "" && !req.Customer.Exempt {
+		e := employee.New(db)
+		ok, err := e.Query().Filter("CustomerId=", req.Customer.Id).Get()
+		if err != nil {
+			return err
+		}
+		if ok {
+			c := company.New(db)
+			if err := c.GetById(e.CompanyId); err == nil {
+				if c.TaxExempt {
+					req.Customer.Exempt = true
+					req.Customer.ExemptionNumber = c.TaxExemptionNumber
+				}
+				if req.Customer.TaxId.Value == "" {
+					req.Customer.TaxId = c.TaxId
+				}
+			}
+		}
+	}
+
+	if id := req.Customer.TaxId; id.Value != "" && (id.Status == taxid.Unverified || id.Status == "") && !req.ReverseChargeUnverified {
+		region, err := findRegion(db, req.Address)
+		if err != nil {
+			return err
+		}
+		req.ReverseChargeUnverified = region != nil && region.ReverseChargeUnverified
+	}
+
+	if !req.Inclusive {
+		inclusive, err := Inclusive(db, req.RegionId, req.Currency)
+		if err != nil {
+			return err
+		}
+		req.Inclusive = inclusive
+	}
+	return nil
+}
+
+// Price preference attributes, as Medusa names them.
+const (
+	preferRegion   = "region_id"
+	preferCurrency = "currency_code"
+)
+
+// Inclusive is whether prices in a region, or else in a currency, include
+// tax, by the org's price preferences. With neither, they do not.
+func Inclusive(db *datastore.Datastore, regionId string, cur currency.Type) (bool, error) {
+	for _, pref := range []struct{ attribute, value string }{
+		{preferRegion, regionId},
+		{preferCurrency, string(cur)},
+	} {
+		if pref.value == "" {
+			continue
+		}
+		p := pricepreference.New(db)
+		ok, err := p.Query().Filter("Attribute=", pref.attribute).Filter("Value=", pref.value).Get()
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return p.IsTaxInclusive, nil
+		}
+	}
+	return false, nil
+}
+
+// LoadRuleSet loads the tax region covering address and its rates and rules.
+// A province with a region of its own is taxed by it, and by its country's
+// when its own has no rates.
+func LoadRuleSet(db *datastore.Datastore, address Address) (*RuleSet, error) {
+	region, err := findRegion(db, address)
+	if err != nil || region == nil {
+		return &RuleSet{}, err
+	}
+	rs := &RuleSet{Region: region}
+	if _, err := taxrate.Query(db).Filter("TaxRegionId=", region.Id()).GetAll(&rs.Rates); err != nil {
+		return nil, err
+	}
+	if len(rs.Rates) == 0 && region.ProvinceCode != "" {
+		if country, err := findRegion(db, Address{Country: address.Country}); err != nil {
+			return nil, err
+		} else if country != nil {
+			if _, err := taxrate.Query(db).Filter("TaxRegionId=", country.Id()).GetAll(&rs.Rates); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, r := range rs.Rates {
+		var rules []*taxraterule.TaxRateRule
+		if _, err := taxraterule.Query(db).Filter("TaxRateId=", r.Id()).GetAll(&rules); err != nil {
+			return nil, err
+		}
+		rs.Rules = append(rs.Rules, rules...)
+	}
+	return rs, nil
+}
+
+// findRegion is the tax region of address's province, or else its country's,
+// or nil.
+func findRegion(db *datastore.Datastore, address Address) (*taxregion.TaxRegion, error) {
+	if address.Country == "" {
+		return nil, nil
+	}
+	provinces := []string{""}
+	if address.Province != "" {
+		provinces = []string{address.Province, ""}
+	}
+	for _, province := range provinces {
+		region := taxregion.New(db)
+		ok, err := region.Query().
+			Filter("CountryCode=", address.Country).
+			Filter("ProvinceCode=", province).
+			Get()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return region, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,143 @@
+package oss
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/billinginvoice"
+	"github.com/hanzoai/commerce/models/credit"
+	"github.com/hanzoai/commerce/models/order"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/payment"
+)
+
+// Load builds the return for a quarter of year from the orders and billing
+// invoices in db's namespace, for a seller established in origin.
+//
+// An order is a sale in the quarter it was placed and paid for; an invoice
+// in the quarter it was paid. Refunds of an order and credit notes against
+// an invoice come off the sale whenever they were made, so a return loaded
+// again after one differs from the one filed; the difference is the
+// correction for the later return.
+func Load(db *datastore.Datastore, year, quarter int, origin string) (*Report, error) {
+	if quarter < 1 || quarter > 4 {
+		return nil, fmt.Errorf("oss: quarter %d is not 1 to 4", quarter)
+	}
+	r := &Report{Origin: origin, Year: year, Quarter: quarter}
+	r.From, r.To = Quarter(year, quarter)
+
+	orders, err := orderSales(db, r)
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := invoiceSales(db, r)
+	if err != nil {
+		return nil, err
+	}
+	r.Build(append(orders, invoices...))
+	return r, nil
+}
+
+func orderSales(db *datastore.Datastore, r *Report) ([]Sale, error) {
+	var orders []*order.Order
+	q := order.Query(db).
+		Filter("CreatedAt>=", r.From).
+		Filter("CreatedAt<", r.To)
+	if _, err := q.GetAll(&orders); err != nil {
+		return nil, fmt.Errorf("oss: query orders: %w", err)
+	}
+
+	sales := make([]Sale, 0, len(orders))
+	for _, o := range orders {
+		if o.PaymentStatus != payment.Paid && o.PaymentStatus != payment.Refunded {
+			continue
+		}
+		country := o.ShippingAddress.Country
+		if country == "" {
+			country, _ = o.TaxEvidence.Country()
+		}
+		sales = append(sales, Sale{
+			Ref:           o.Id(),
+			Country:       country,
+			Evidence:      o.TaxEvidence,
+			Currency:      o.Currency,
+			Rates:         o.TaxRates,
+			ReverseCharge: o.TaxReverseCharge,
+			Total:         o.Total,
+			Refunded:      o.Refunded,
+		})
+	}
+	return sales, nil
+}
+
+func invoiceSales(db *datastore.Datastore, r *Report) ([]Sale, error) {
+	var invoices []*billinginvoice.BillingInvoice
+	q := billinginvoice.Query(db).
+		Filter("Status=", billinginvoice.Paid).
+		Filter("PaidAt>=", r.From).
+		Filter("PaidAt<", r.To)
+	if _, err := q.GetAll(&invoices); err != nil {
+		return nil, fmt.Errorf("oss: query invoices: %w", err)
+	}
+
+	sales := make([]Sale, 0, len(invoices))
+	for _, inv := range invoices {
+		credited, err := credited(db, inv.Id())
+		if err != nil {
+			return nil, err
+		}
+		country := inv.TaxEvidence.BillingCountry
+		if country == "" {
+			country, _ = inv.TaxEvidence.Country()
+		}
+		sales = append(sales, Sale{
+			Ref:           inv.Id(),
+			Country:       country,
+			Evidence:      inv.TaxEvidence,
+			Currency:      inv.Currency,
+			Rates:         inv.TaxRates,
+			ReverseCharge: inv.ReverseCharge,
+			Total:         currency.Cents(inv.Subtotal + inv.Tax - inv.Discount),
+			Refunded:      currency.Cents(credited),
+		})
+	}
+	return sales, nil
+}
+
+// credited is the total of the credit notes issued against an invoice and
+// not voided.
+func credited(db *datastore.Datastore, invoiceId string) (int64, error) {
+	var notes []*credit.CreditNote
+	if _, err := credit.Query(db).Filter("InvoiceId=", invoiceId).GetAll(&notes); err != nil {
+		return 0, fmt.Errorf("oss: query credit notes of %s: %w", invoiceId, err)
+	}
+	var total int64
+	for _, cn := range notes {
+		if cn.Status != credit.Void {
+			total += cn.Amount
+		}
+	}
+	return total, nil
+}
+
+// WriteCSV writes the report's lines as CSV, a header first, amounts in
+// major units of their currency and rates as percentages.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"country", "rate", "currency", "sales", "taxable", "tax"})
+	for _, l := range r.Lines {
+		cw.Write([]string{
+			l.Country,
+			strconv.FormatFloat(l.Rate*100, 'f', -1, 64),
+			string(l.Currency),
+			strconv.Itoa(l.Sales),
+			l.Currency.ToStringNoSymbol(l.Taxable),
+			l.Currency.ToStringNoSymbol(l.Tax),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
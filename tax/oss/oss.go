@@ -0,0 +1,169 @@
+// Package oss builds the EU One-Stop-Shop VAT return: a seller's sales to
+// consumers in other member states over a quarter, by member state and rate,
+// as the return is filed with the seller's own tax authority instead of
+// registering for VAT in each state sold into.
+//
+// It is built from what orders and invoices recorded when they were taxed —
+// their rates, where the customer was shown to be, whether they were
+// reverse-charged — not by taxing them again, since a return states the tax
+// that was charged.
+package oss
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax"
+	"github.com/hanzoai/commerce/tax/taxid"
+)
+
+// Sale is an order or invoice as the return counts it.
+type Sale struct {
+	// Ref is the order or invoice id.
+	Ref string
+
+	// Country is the member state whose VAT was charged: where the
+	// customer's address was.
+	Country string
+
+	// Evidence is where else the customer was shown to be.
+	Evidence tax.Evidence
+
+	Currency currency.Type
+	Rates    []tax.Rate
+
+	// ReverseCharge is a sale to a business the business accounts for the
+	// VAT on, which is not in the return.
+	ReverseCharge bool
+
+	// Total and Refunded are what the sale came to and what of it has been
+	// refunded or credited since, which the return is net of.
+	Total    currency.Cents
+	Refunded currency.Cents
+}
+
+// Line is one line of the return: the sales into a member state at a rate,
+// in one currency. The return itself is in euros; sales in another currency
+// are converted at the ECB's rate for the last day of the quarter by whoever
+// files it, so they are kept apart here rather than converted.
+type Line struct {
+	Country  string         `json:"country"`
+	Rate     float64        `json:"rate"`
+	Currency currency.Type  `json:"currency"`
+	Sales    int            `json:"sales"`
+	Taxable  currency.Cents `json:"taxable"`
+	Tax      currency.Cents `json:"tax"`
+}
+
+// Report is the return for a quarter.
+type Report struct {
+	// Origin is the member state the seller is established in, whose sales
+	// are domestic and not in the return; empty, or outside the EU, for a
+	// seller under the non-Union scheme, for whom every member state is.
+	Origin string `json:"origin,omitempty"`
+
+	Year    int       `json:"year"`
+	Quarter int       `json:"quarter"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+
+	Lines []Line `json:"lines"`
+
+	// Unrated is the sales into other member states that were taxed
+	// without a record of their rates, by the legacy store rates or before
+	// rates were recorded, and so could not be put on a line. They have to
+	// be accounted for by hand.
+	Unrated []string `json:"unrated,omitempty"`
+
+	// Unevidenced is the sales in the return without two pieces of
+	// evidence that the customer was where they were taxed, which the
+	// seller is to keep for each sale and may be asked for.
+	Unevidenced []string `json:"unevidenced,omitempty"`
+}
+
+// Quarter is the first moment of the quarter of year and the first of the
+// next, in UTC. quarter is 1 to 4.
+func Quarter(year, quarter int) (from, to time.Time) {
+	from = time.Date(year, time.Month(3*(quarter-1)+1), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 3, 0)
+}
+
+// Build adds up sales into the report's lines: each sale into a member state
+// other than the origin, not reverse-charged, by its rates, less the
+// refunded share of each. Lines are ordered by country, rate and currency.
+func (r *Report) Build(sales []Sale) {
+	type key struct {
+		country  string
+		rate     float64
+		currency currency.Type
+	}
+	lines := make(map[key]*Line)
+	counted := make(map[key]string)
+
+	for _, s := range sales {
+		if s.ReverseCharge || s.Country == r.Origin || !taxid.MemberState(s.Country) {
+			continue
+		}
+		if s.Refunded >= s.Total && s.Total > 0 {
+			continue
+		}
+		if !evidenced(s) {
+			r.Unevidenced = append(r.Unevidenced, s.Ref)
+		}
+		if len(s.Rates) == 0 {
+			r.Unrated = append(r.Unrated, s.Ref)
+			continue
+		}
+		for _, rt := range s.Rates {
+			k := key{s.Country, rt.Rate, s.Currency}
+			l, ok := lines[k]
+			if !ok {
+				l = &Line{Country: s.Country, Rate: rt.Rate, Currency: s.Currency}
+				lines[k] = l
+			}
+			if counted[k] != s.Ref {
+				counted[k] = s.Ref
+				l.Sales++
+			}
+			l.Taxable += net(rt.Taxable, s)
+			l.Tax += net(rt.Amount, s)
+		}
+	}
+
+	r.Lines = make([]Line, 0, len(lines))
+	for _, l := range lines {
+		r.Lines = append(r.Lines, *l)
+	}
+	sort.Slice(r.Lines, func(i, j int) bool {
+		a, b := r.Lines[i], r.Lines[j]
+		if a.Country != b.Country {
+			return a.Country < b.Country
+		}
+		if a.Rate != b.Rate {
+			return a.Rate > b.Rate
+		}
+		return a.Currency < b.Currency
+	})
+}
+
+// evidenced is that two pieces of s's evidence put the customer in the
+// country s was taxed in.
+func evidenced(s Sale) bool {
+	n := 0
+	for _, c := range []string{s.Evidence.BillingCountry, s.Evidence.IPCountry, s.Evidence.CardCountry} {
+		if c == s.Country {
+			n++
+		}
+	}
+	return n >= 2
+}
+
+// net is amount less its share of what of s was refunded, in proportion to
+// s's total, the way an order's tax refunds are shared.
+func net(amount currency.Cents, s Sale) currency.Cents {
+	if s.Total <= 0 || s.Refunded <= 0 {
+		return amount
+	}
+	return amount - currency.Cents((int64(s.Refunded)*int64(amount)+int64(s.Total)/2)/int64(s.Total))
+}
@@ -0,0 +1,70 @@
+package oss
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax"
+)
+
+func vat(rate float64, taxable, amount currency.Cents) tax.Rate {
+	return tax.Rate{Rate: rate, Taxable: taxable, Amount: amount}
+}
+
+var agreed = tax.Evidence{BillingCountry: "DE", IPCountry: "DE"}
+
+// Sales into other member states are added up by country, rate and
+// currency, net of refunds; domestic, reverse-charged, non-EU and wholly
+// refunded sales are left out, and sales without rates or evidence named.
+func TestReport_Build(t *testing.T) {
+	r := &Report{Origin: "FR"}
+	r.Build([]Sale{
+		{Ref: "o1", Country: "DE", Evidence: agreed, Currency: "eur", Total: 1190, Rates: []tax.Rate{vat(0.19, 1000, 190)}},
+		{Ref: "o2", Country: "DE", Evidence: agreed, Currency: "eur", Total: 2380, Refunded: 1190, Rates: []tax.Rate{vat(0.19, 2000, 380)}},
+		{Ref: "o3", Country: "DE", Currency: "eur", Total: 1070, Rates: []tax.Rate{vat(0.07, 1000, 70)}},
+		{Ref: "o4", Country: "NL", Evidence: tax.Evidence{BillingCountry: "NL", CardCountry: "NL"}, Currency: "usd", Total: 1210, Rates: []tax.Rate{vat(0.21, 1000, 210)}},
+		{Ref: "mixed", Country: "DE", Evidence: agreed, Currency: "eur", Total: 2260, Rates: []tax.Rate{vat(0.19, 1000, 190), vat(0.07, 1000, 70)}},
+
+		{Ref: "domestic", Country: "FR", Currency: "eur", Total: 1200, Rates: []tax.Rate{vat(0.20, 1000, 200)}},
+		{Ref: "b2b", Country: "DE", Currency: "eur", Total: 1000, ReverseCharge: true},
+		{Ref: "us", Country: "US", Currency: "usd", Total: 1000, Rates: []tax.Rate{vat(0.08, 1000, 80)}},
+		{Ref: "refunded", Country: "DE", Currency: "eur", Total: 1190, Refunded: 1190, Rates: []tax.Rate{vat(0.19, 1000, 190)}},
+		{Ref: "legacy", Country: "IT", Evidence: tax.Evidence{BillingCountry: "IT", IPCountry: "IT"}, Currency: "eur", Total: 1220},
+	})
+
+	want := []Line{
+		{Country: "DE", Rate: 0.19, Currency: "eur", Sales: 3, Taxable: 1000 + 1000 + 1000, Tax: 190 + 190 + 190},
+		{Country: "DE", Rate: 0.07, Currency: "eur", Sales: 2, Taxable: 2000, Tax: 140},
+		{Country: "NL", Rate: 0.21, Currency: "usd", Sales: 1, Taxable: 1000, Tax: 210},
+	}
+	if !reflect.DeepEqual(r.Lines, want) {
+		t.Fatalf("lines = %+v\nwant %+v", r.Lines, want)
+	}
+	if !reflect.DeepEqual(r.Unrated, []string{"legacy"}) {
+		t.Fatalf("unrated = %v", r.Unrated)
+	}
+	if !reflect.DeepEqual(r.Unevidenced, []string{"o3"}) {
+		t.Fatalf("unevidenced = %v", r.Unevidenced)
+	}
+}
+
+// A seller outside the EU reports sales into every member state.
+func TestReport_BuildNonUnion(t *testing.T) {
+	r := &Report{Origin: "US"}
+	r.Build([]Sale{
+		{Ref: "fr", Country: "FR", Currency: "usd", Total: 1200, Rates: []tax.Rate{vat(0.20, 1000, 200)}},
+		{Ref: "us", Country: "US", Currency: "usd", Total: 1080, Rates: []tax.Rate{vat(0.08, 1000, 80)}},
+	})
+	if len(r.Lines) != 1 || r.Lines[0].Country != "FR" || r.Lines[0].Tax != 200 {
+		t.Fatalf("lines = %+v", r.Lines)
+	}
+}
+
+func TestQuarter(t *testing.T) {
+	from, to := Quarter(2026, 4)
+	if !from.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Q4 2026 = %v to %v", from, to)
+	}
+}
@@ -0,0 +1,98 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/taxprovider"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{BuiltIn: Rules{}}
+)
+
+// Register makes p the provider of every tax region whose taxprovider is
+// named p.Name(), replacing any registered under that name before.
+func Register(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name()] = p
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	if p, ok := providers[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+}
+
+// For is the provider that taxes a sale to address: the one the covering tax
+// region names, or Rules when it names none, or one that is disabled. A
+// region naming a provider that is not registered is an error rather than
+// quietly taxed by the rules, which would charge what the merchant meant
+// someone else to work out.
+func For(db *datastore.Datastore, address Address) (Provider, error) {
+	region, err := findRegion(db, address)
+	if err != nil || region == nil || region.ProviderId == "" {
+		return Rules{}, err
+	}
+	tp := taxprovider.New(db)
+	if err := tp.GetById(region.ProviderId); err != nil {
+		return nil, fmt.Errorf("tax: provider %s of region %s: %w", region.ProviderId, region.Id(), err)
+	}
+	if !tp.IsEnabled {
+		return Rules{}, nil
+	}
+	return Get(tp.Name)
+}
+
+// Calculate quotes the tax on req in ctx's org, after Prepare.
+func Calculate(ctx context.Context, req *Request) (*Quote, error) {
+	db := datastore.New(ctx)
+	if err := Prepare(db, req); err != nil {
+		return nil, err
+	}
+	p, err := For(db, req.Address)
+	if err != nil {
+		return nil, err
+	}
+	return p.Quote(ctx, req)
+}
+
+// Commit records req, after Prepare, with the provider that quotes it.
+func Commit(ctx context.Context, req *Request) (*Transaction, error) {
+	db := datastore.New(ctx)
+	if err := Prepare(db, req); err != nil {
+		return nil, err
+	}
+	p, err := For(db, req.Address)
+	if err != nil {
+		return nil, err
+	}
+	return p.Commit(ctx, req)
+}
+
+// Void voids a transaction of the named provider.
+func Void(ctx context.Context, provider, transactionId string) error {
+	p, err := Get(provider)
+	if err != nil {
+		return err
+	}
+	return p.Void(ctx, transactionId)
+}
+
+// Refund refunds amount of tax on a transaction of the named provider.
+func Refund(ctx context.Context, provider, transactionId string, amount currency.Cents) error {
+	p, err := Get(provider)
+	if err != nil {
+		return err
+	}
+	return p.Refund(ctx, transactionId, amount)
+}
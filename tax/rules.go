@@ -0,0 +1,276 @@
+package tax
+
+import (
+	"context"
+
+	"github.com/hanzoai/decimal"
+	"github.com/hanzoai/money"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/models/taxrate"
+	"github.com/hanzoai/commerce/models/taxraterule"
+	"github.com/hanzoai/commerce/models/taxregion"
+	"github.com/hanzoai/commerce/models/types/currency"
+)
+
+// BuiltIn is the name of the built-in provider, Rules.
+const BuiltIn = "rules"
+
+// What a tax rate rule ties its rate to: a product, a product type, or
+// shipping. A rate with a rule is an override, and taxes only what its rules
+// name.
+const (
+	ReferenceProduct     = "product"
+	ReferenceProductType = "product_type"
+	ReferenceShipping    = "shipping"
+)
+
+// RuleSet is the tax region covering an address, its rates and their rules.
+// Region is nil when no region covers it.
+type RuleSet struct {
+	Region *taxregion.TaxRegion
+	Rates  []*taxrate.TaxRate
+	Rules  []*taxraterule.TaxRateRule
+}
+
+// rate is a tax rate as the arithmetic needs it.
+type rate struct {
+	id, name, code string
+	rate           float64
+}
+
+func rateOf(r *taxrate.TaxRate) rate {
+	return rate{id: r.Id(), name: r.Name, code: r.Code, rate: r.Rate}
+}
+
+// overrides is the rates whose rules tie them to reference, and to id when
+// one is given.
+func (rs *RuleSet) overrides(reference, id string) []rate {
+	var out []rate
+	for _, r := range rs.Rates {
+		for _, rule := range rs.Rules {
+			if rule.TaxRateId == r.Id() && rule.Reference == reference && (id == "" || rule.ReferenceId == id) {
+				out = append(out, rateOf(r))
+				break
+			}
+		}
+	}
+	return out
+}
+
+// defaults is what a line nothing overrides pays: every combinable rate
+// together, or else the default rate, or else the first. Overrides are not
+// among them.
+func (rs *RuleSet) defaults() []rate {
+	var plain []*taxrate.TaxRate
+	for _, r := range rs.Rates {
+		ruled := false
+		for _, rule := range rs.Rules {
+			if rule.TaxRateId == r.Id() {
+				ruled = true
+				break
+			}
+		}
+		if !ruled {
+			plain = append(plain, r)
+		}
+	}
+
+	var out []rate
+	for _, r := range plain {
+		if r.IsCombinable {
+			out = append(out, rateOf(r))
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, r := range plain {
+		if r.IsDefault {
+			return []rate{rateOf(r)}
+		}
+	}
+	if len(plain) > 0 {
+		return []rate{rateOf(plain[0])}
+	}
+	return nil
+}
+
+// ratesFor is the rates that tax l: those its product is tied to, else those
+// with its tax code, else those its product type is tied to, else the
+// defaults.
+func (rs *RuleSet) ratesFor(l Line) []rate {
+	if l.ProductId != "" {
+		if rates := rs.overrides(ReferenceProduct, l.ProductId); len(rates) > 0 {
+			return rates
+		}
+	}
+	if l.TaxCode != "" {
+		var rates []rate
+		for _, r := range rs.Rates {
+			if r.Code == l.TaxCode {
+				rates = append(rates, rateOf(r))
+			}
+		}
+		if len(rates) > 0 {
+			return rates
+		}
+	}
+	if l.ProductTypeId != "" {
+		if rates := rs.overrides(ReferenceProductType, l.ProductTypeId); len(rates) > 0 {
+			return rates
+		}
+	}
+	return rs.defaults()
+}
+
+// shippingRates is the rates that tax shipping: those tied to shipping, else
+// the defaults if the region taxes shipping.
+func (rs *RuleSet) shippingRates() []rate {
+	if rates := rs.overrides(ReferenceShipping, ""); len(rates) > 0 {
+		return rates
+	}
+	if rs.Region.TaxShipping {
+		return rs.defaults()
+	}
+	return nil
+}
+
+// Jurisdiction is the code of where a region taxes: its country, and its
+// province when it has one.
+func Jurisdiction(country, province string) string {
+	if province == "" {
+		return country
+	}
+	return country + "-" + province
+}
+
+// Evaluate is the tax on req under rs.
+//
+// Each rate's part of a line is rounded on its own, and the tax is the sum of
+// the parts: every jurisdiction is owed the amount on its own line, which a
+// total rounded once over the combined rate need not add up to. With
+// inclusive prices the tax in a line is taken out at the combined rate and
+// then shared between the rates, so that the parts still add up to it.
+func Evaluate(req *Request, rs *RuleSet) (*Quote, error) {
+	q := &Quote{Provider: BuiltIn, Inclusive: req.Inclusive, Lines: make([]LineTax, 0, len(req.Lines))}
+	if rs == nil || rs.Region == nil {
+		for _, l := range req.Lines {
+			q.Lines = append(q.Lines, LineTax{LineId: l.Id, Taxable: l.Amount()})
+		}
+		q.Shipping.Taxable = req.Shipping
+		return q, nil
+	}
+	q.Jurisdiction = Jurisdiction(rs.Region.CountryCode, rs.Region.ProvinceCode)
+	q.Exempt = req.Customer.Exempt
+	q.ExemptionNumber = req.Customer.ExemptionNumber
+	if ReverseCharge(req) {
+		q.ReverseCharge = true
+		q.TaxId = req.Customer.TaxId.Value
+	}
+	untaxed := q.Exempt || q.ReverseCharge
+
+	for _, l := range req.Lines {
+		var rates []rate
+		if l.Taxable && !untaxed {
+			rates = rs.ratesFor(l)
+		}
+		lt, err := apply(l.Amount(), rates, req.Inclusive, q.Jurisdiction)
+		if err != nil {
+			return nil, err
+		}
+		lt.LineId = l.Id
+		q.Lines = append(q.Lines, lt)
+		q.Tax += lt.Tax
+	}
+
+	var rates []rate
+	if req.Shipping > 0 && !untaxed {
+		rates = rs.shippingRates()
+	}
+	shipping, err := apply(req.Shipping, rates, req.Inclusive, q.Jurisdiction)
+	if err != nil {
+		return nil, err
+	}
+	q.Shipping = shipping
+	q.Tax += shipping.Tax
+	return q, nil
+}
+
+// apply taxes amount at rates.
+func apply(amount currency.Cents, rates []rate, inclusive bool, jurisdiction string) (LineTax, error) {
+	lt := LineTax{Taxable: amount}
+	if len(rates) == 0 || amount <= 0 {
+		return lt, nil
+	}
+
+	exact := make([]decimal.Decimal, len(rates))
+	combined := decimal.New(0, 0)
+	for i, r := range rates {
+		d, err := money.RateFromFloat(r.rate)
+		if err != nil {
+			return lt, err
+		}
+		exact[i] = d
+		combined = combined.Add(d)
+	}
+
+	var included currency.Cents
+	if inclusive {
+		one := decimal.New(1, 0)
+		included = amount.Scale(combined.Div(one.Add(combined)))
+		lt.Taxable = amount - included
+	}
+
+	lt.Rates = make([]Rate, len(rates))
+	for i, r := range rates {
+		lt.Rates[i] = Rate{
+			TaxRateId:    r.id,
+			Name:         r.name,
+			Code:         r.code,
+			Rate:         r.rate,
+			Amount:       lt.Taxable.Scale(exact[i]),
+			Jurisdiction: jurisdiction,
+			Taxable:      lt.Taxable,
+		}
+		lt.Tax += lt.Rates[i].Amount
+	}
+	if inclusive {
+		lt.Rates[len(rates)-1].Amount += included - lt.Tax
+		lt.Tax = included
+	}
+	return lt, nil
+}
+
+// Rules is the built-in provider: the org's tax regions, rates and rate
+// rules, as Evaluate applies them. It keeps no record of its own; the order
+// or invoice that was taxed is the record, so committing only quotes again
+// and voiding and refunding have nothing to do.
+type Rules struct{}
+
+func (Rules) Name() string { return BuiltIn }
+
+func (Rules) Quote(ctx context.Context, req *Request) (*Quote, error) {
+	rs, err := LoadRuleSet(datastore.New(ctx), req.Address)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(req, rs)
+}
+
+func (r Rules) Commit(ctx context.Context, req *Request) (*Transaction, error) {
+	if req.Reference == "" {
+		return nil, ErrNoReference
+	}
+	q, err := r.Quote(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &Transaction{Id: req.Reference, Provider: BuiltIn, Reference: req.Reference, Tax: q.Tax}, nil
+}
+
+func (Rules) Void(ctx context.Context, transactionId string) error { return nil }
+
+func (Rules) Refund(ctx context.Context, transactionId string, amount currency.Cents) error {
+	return nil
+}
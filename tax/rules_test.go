@@ -0,0 +1,239 @@
+package tax
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hanzoai/commerce/models/taxrate"
+	"github.com/hanzoai/commerce/models/taxraterule"
+	"github.com/hanzoai/commerce/models/taxregion"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax/taxid"
+)
+
+func newRate(id string, r float64, isDefault, combinable bool, code string) *taxrate.TaxRate {
+	tr := &taxrate.TaxRate{Rate: r, Name: id, Code: code, IsDefault: isDefault, IsCombinable: combinable}
+	tr.Id_ = id
+	return tr
+}
+
+func newRule(rateId, reference, referenceId string) *taxraterule.TaxRateRule {
+	return &taxraterule.TaxRateRule{TaxRateId: rateId, Reference: reference, ReferenceId: referenceId}
+}
+
+func line(id string, price currency.Cents, qty int) Line {
+	return Line{Id: id, ProductId: id, UnitPrice: price, Quantity: qty, Taxable: true}
+}
+
+func evaluate(t *testing.T, req *Request, rs *RuleSet) *Quote {
+	t.Helper()
+	q, err := Evaluate(req, rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func taxes(q *Quote) []currency.Cents {
+	out := make([]currency.Cents, len(q.Lines))
+	for i, l := range q.Lines {
+		out[i] = l.Tax
+	}
+	return out
+}
+
+// Combinable rates stack, each rounded on its own; without them the default
+// rate applies, and without that the first.
+func TestEvaluate_Defaults(t *testing.T) {
+	bc := &taxregion.TaxRegion{CountryCode: "CA", ProvinceCode: "BC"}
+	req := &Request{Lines: []Line{line("p1", 1005, 1)}}
+
+	q := evaluate(t, req, &RuleSet{Region: bc, Rates: []*taxrate.TaxRate{
+		newRate("gst", 0.05, false, true, ""),
+		newRate("pst", 0.07, false, true, ""),
+	}})
+	// 50.25 rounds to 50 and 70.35 to 70.
+	if q.Tax != 120 || len(q.Lines[0].Rates) != 2 || q.Jurisdiction != "CA-BC" {
+		t.Fatalf("stacked: tax %d, rates %+v, jurisdiction %q", q.Tax, q.Lines[0].Rates, q.Jurisdiction)
+	}
+
+	gb := &taxregion.TaxRegion{CountryCode: "GB"}
+	q = evaluate(t, req, &RuleSet{Region: gb, Rates: []*taxrate.TaxRate{
+		newRate("reduced", 0.05, false, false, ""),
+		newRate("standard", 0.20, true, false, ""),
+	}})
+	if q.Tax != 201 {
+		t.Fatalf("default rate: tax %d, want 201", q.Tax)
+	}
+
+	q = evaluate(t, req, &RuleSet{Region: gb, Rates: []*taxrate.TaxRate{newRate("gst", 0.10, false, false, "")}})
+	if q.Tax != 101 {
+		t.Fatalf("first rate: tax %d, want 101", q.Tax)
+	}
+
+	q = evaluate(t, req, &RuleSet{})
+	if q.Tax != 0 || q.Jurisdiction != "" {
+		t.Fatalf("no region: tax %d, jurisdiction %q", q.Tax, q.Jurisdiction)
+	}
+}
+
+// A rate tied to a product taxes it instead of the defaults, then a rate with
+// the product's tax code, then one tied to its type; the overrides tax
+// nothing else.
+func TestEvaluate_Overrides(t *testing.T) {
+	rs := &RuleSet{
+		Region: &taxregion.TaxRegion{CountryCode: "DE"},
+		Rates: []*taxrate.TaxRate{
+			newRate("standard", 0.19, true, false, ""),
+			newRate("books", 0.07, false, false, ""),
+			newRate("food", 0.07, false, false, "FOOD"),
+			newRate("zero", 0, false, false, ""),
+		},
+		Rules: []*taxraterule.TaxRateRule{
+			newRule("books", ReferenceProductType, "ptyp_books"),
+			newRule("zero", ReferenceProduct, "charity-book"),
+		},
+	}
+	book := line("novel", 1000, 1)
+	book.ProductTypeId = "ptyp_books"
+	charity := line("charity-book", 1000, 1)
+	charity.ProductTypeId = "ptyp_books"
+	bread := line("bread", 1000, 1)
+	bread.TaxCode = "FOOD"
+	untaxed := line("gift-wrap", 1000, 1)
+	untaxed.Taxable = false
+
+	q := evaluate(t, &Request{Lines: []Line{line("shirt", 1000, 1), book, charity, bread, untaxed}}, rs)
+	if got, want := taxes(q), []currency.Cents{190, 70, 0, 70, 0}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("line taxes = %v, want %v", got, want)
+	}
+	if id := q.Lines[1].Rates[0].TaxRateId; id != "books" {
+		t.Fatalf("book taxed by %s", id)
+	}
+}
+
+// Inclusive prices have the tax taken out, and the rates' parts still add up
+// to it; line discounts come off first.
+func TestEvaluate_InclusiveAndDiscounts(t *testing.T) {
+	rs := &RuleSet{Region: &taxregion.TaxRegion{CountryCode: "CA", ProvinceCode: "QC"}, Rates: []*taxrate.TaxRate{
+		newRate("gst", 0.05, false, true, ""),
+		newRate("qst", 0.09975, false, true, ""),
+	}}
+	q := evaluate(t, &Request{Inclusive: true, Lines: []Line{line("p1", 11498, 1)}}, rs)
+	l := q.Lines[0]
+	if l.Taxable != 10000 || l.Tax != 1498 || !q.Inclusive {
+		t.Fatalf("inclusive line = %+v", l)
+	}
+	if sum := l.Rates[0].Amount + l.Rates[1].Amount; sum != l.Tax {
+		t.Fatalf("rate parts %+v add up to %d, not %d", l.Rates, sum, l.Tax)
+	}
+
+	discounted := line("p1", 1000, 3)
+	discounted.Discount = 500
+	q = evaluate(t, &Request{Lines: []Line{discounted}}, rs)
+	if q.Lines[0].Taxable != 2500 || q.Tax != 125+249 {
+		t.Fatalf("discounted line = %+v", q.Lines[0])
+	}
+}
+
+// Shipping is taxed when the region says so, or by a rate tied to it.
+func TestEvaluate_Shipping(t *testing.T) {
+	region := &taxregion.TaxRegion{CountryCode: "US", ProvinceCode: "NY"}
+	rates := []*taxrate.TaxRate{newRate("ny", 0.08, true, false, "")}
+	req := &Request{Lines: []Line{line("p1", 1000, 1)}, Shipping: 500}
+
+	if q := evaluate(t, req, &RuleSet{Region: region, Rates: rates}); q.Shipping.Tax != 0 || q.Tax != 80 {
+		t.Fatalf("untaxed shipping: %+v, tax %d", q.Shipping, q.Tax)
+	}
+
+	region.TaxShipping = true
+	if q := evaluate(t, req, &RuleSet{Region: region, Rates: rates}); q.Shipping.Tax != 40 || q.Tax != 120 {
+		t.Fatalf("taxed shipping: %+v, tax %d", q.Shipping, q.Tax)
+	}
+
+	region.TaxShipping = false
+	rs := &RuleSet{
+		Region: region,
+		Rates:  append(rates, newRate("freight", 0.04, false, false, "")),
+		Rules:  []*taxraterule.TaxRateRule{newRule("freight", ReferenceShipping, "")},
+	}
+	if q := evaluate(t, req, rs); q.Shipping.Tax != 20 || q.Lines[0].Tax != 80 {
+		t.Fatalf("shipping rule: %+v, line %+v", q.Shipping, q.Lines[0])
+	}
+}
+
+func TestEvaluate_Exempt(t *testing.T) {
+	region := &taxregion.TaxRegion{CountryCode: "US", ProvinceCode: "CA", TaxShipping: true}
+	req := &Request{
+		Customer: Customer{Id: "buyer", Exempt: true, ExemptionNumber: "RESALE-1"},
+		Lines:    []Line{line("p1", 1000, 2)},
+		Shipping: 500,
+	}
+	q := evaluate(t, req, &RuleSet{Region: region, Rates: []*taxrate.TaxRate{newRate("ca", 0.0725, true, false, "")}})
+	if q.Tax != 0 || !q.Exempt || q.ExemptionNumber != "RESALE-1" || q.Jurisdiction != "US-CA" {
+		t.Fatalf("exempt quote = %+v", q)
+	}
+	if q.Lines[0].Taxable != 2000 {
+		t.Fatalf("exempt line = %+v", q.Lines[0])
+	}
+}
+
+// A business abroad with a verified tax number of the country it is in
+// accounts for the tax itself, and so does one whose number nobody checks
+// where the org opted in; one at home, one with a number shown to be invalid
+// or whose check failed, and one whose seller is nowhere known are charged it.
+func TestEvaluate_ReverseCharge(t *testing.T) {
+	rs := &RuleSet{Region: &taxregion.TaxRegion{CountryCode: "DE"}, Rates: []*taxrate.TaxRate{newRate("standard", 0.19, true, false, "")}}
+	vat := taxid.TaxId{Type: taxid.EUVAT, Value: "DE136695976", Country: "DE", Status: taxid.Verified}
+	req := func(origin string, id taxid.TaxId) *Request {
+		return &Request{
+			Address:  Address{Country: "DE"},
+			Customer: Customer{Id: "buyer", TaxId: id},
+			Origin:   origin,
+			Lines:    []Line{line("p1", 1000, 1)},
+		}
+	}
+	with := func(status taxid.Status) taxid.TaxId {
+		id := vat
+		id.Status = status
+		return id
+	}
+	optedIn := func(r *Request) *Request {
+		r.ReverseChargeUnverified = true
+		return r
+	}
+
+	for name, r := range map[string]*Request{
+		"verified":             req("FR", vat),
+		"unverified, opted in": optedIn(req("FR", with(taxid.Unverified))),
+	} {
+		q := evaluate(t, r, rs)
+		if q.Tax != 0 || !q.ReverseCharge || q.TaxId != "DE136695976" || q.Jurisdiction != "DE" {
+			t.Errorf("%s: cross-border b2b = %+v", name, q)
+		}
+	}
+
+	for name, r := range map[string]*Request{
+		"domestic":              req("DE", vat),
+		"invalid number":        req("FR", with(taxid.Invalid)),
+		"unverified":            req("FR", with(taxid.Unverified)),
+		"unavailable, opted in": optedIn(req("FR", with(taxid.Unavailable))),
+		"unknown origin":        req("", vat),
+		"no number":             req("FR", taxid.TaxId{}),
+	} {
+		if q := evaluate(t, r, rs); q.Tax != 190 || q.ReverseCharge {
+			t.Errorf("%s: tax %d, reverse charge %v", name, q.Tax, q.ReverseCharge)
+		}
+	}
+}
+
+func TestQuote_Rates(t *testing.T) {
+	rs := &RuleSet{Region: &taxregion.TaxRegion{CountryCode: "CA", ProvinceCode: "ON", TaxShipping: true}, Rates: []*taxrate.TaxRate{
+		newRate("hst", 0.13, true, false, ""),
+	}}
+	q := evaluate(t, &Request{Lines: []Line{line("p1", 1000, 1), line("p2", 2000, 1)}, Shipping: 1000}, rs)
+	got := q.Rates()
+	if len(got) != 1 || got[0].Amount != 520 || got[0].Amount != q.Tax || got[0].Taxable != 4000 {
+		t.Fatalf("rates = %+v, tax %d", got, q.Tax)
+	}
+}
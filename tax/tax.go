@@ -0,0 +1,280 @@
+// Package tax computes the tax on a sale and reports the sale to whoever keeps
+// the books on it.
+//
+// Every sale is taxed through a Provider. Carts, orders at checkout, billing
+// invoices and the /tax/calculate preview put their sale into a Request and
+// call Calculate, so what a shopper is quoted is what they are charged and
+// what an invoice says; two copies of the arithmetic had already drifted, one
+// taking a single effective rate and one summing every rate it found.
+//
+// The built-in provider, Rules, is the org's own tax regions, rates and rate
+// rules (rules.go). A region may name another, such as a tax service that
+// files returns; it is registered with Register under the name its
+// taxprovider record has. Fake is one in memory, for tests.
+//
+// A quote is only a quote. Once an order is paid its tax is committed to the
+// provider, and voided or refunded with the order.
+package tax
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hanzoai/commerce/models/lineitem"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/tax/taxid"
+)
+
+var (
+	// ErrUnknownProvider is returned for a provider nobody registered.
+	ErrUnknownProvider = errors.New("tax: unknown provider")
+
+	// ErrNoReference is returned when committing a sale with no reference.
+	ErrNoReference = errors.New("tax: a committed sale needs a reference")
+
+	// ErrUnknownTransaction is returned for a transaction the provider does
+	// not have.
+	ErrUnknownTransaction = errors.New("tax: unknown transaction")
+
+	// ErrVoided is returned for a refund of a voided transaction.
+	ErrVoided = errors.New("tax: transaction is voided")
+
+	// ErrRefundExceedsTax is returned for a refund of more tax than is left.
+	ErrRefundExceedsTax = errors.New("tax: refund is more than the tax left")
+)
+
+// Provider quotes tax and keeps the record of what was sold.
+type Provider interface {
+	// Name is the name the provider is registered under.
+	Name() string
+
+	// Quote computes the tax on a sale without recording it.
+	Quote(ctx context.Context, req *Request) (*Quote, error)
+
+	// Commit records a sale, by req.Reference, and returns its tax as
+	// recorded. Committing a reference again returns the same transaction.
+	Commit(ctx context.Context, req *Request) (*Transaction, error)
+
+	// Void takes a committed sale out of the record, as if it never
+	// happened.
+	Void(ctx context.Context, transactionId string) error
+
+	// Refund records amount of a committed sale's tax as given back.
+	Refund(ctx context.Context, transactionId string, amount currency.Cents) error
+}
+
+// Address is where a sale is taxed: where it ships to, or where the buyer is
+// when nothing ships.
+type Address struct {
+	Country    string `json:"country"`
+	Province   string `json:"province,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+}
+
+// Customer is who is buying. A business buying for resale, or one otherwise
+// exempt, pays no tax; Prepare finds out from the company the customer buys
+// for. A business abroad with a tax number accounts for the tax itself, and
+// is charged none (ReverseCharge).
+type Customer struct {
+	Id              string `json:"id,omitempty"`
+	Exempt          bool   `json:"exempt,omitempty"`
+	ExemptionNumber string `json:"exemptionNumber,omitempty"`
+
+	TaxId taxid.TaxId `json:"taxId,omitempty"`
+}
+
+// Line is one line of a sale.
+type Line struct {
+	Id            string `json:"id"`
+	ProductId     string `json:"productId,omitempty"`
+	ProductTypeId string `json:"productTypeId,omitempty"`
+
+	// TaxCode classifies the product for tax, as clothing or a digital
+	// good; a rate with the same Code taxes it.
+	TaxCode string `json:"taxCode,omitempty"`
+
+	Quantity  int            `json:"quantity"`
+	UnitPrice currency.Cents `json:"unitPrice"`
+
+	// Discount is what discounts took off the line as a whole. Tax is on
+	// what is left.
+	Discount currency.Cents `json:"discount,omitempty"`
+
+	// Taxable is false for a line that is never taxed, wherever it ships.
+	Taxable bool `json:"taxable"`
+}
+
+// Amount is what the line comes to, less its discount.
+func (l Line) Amount() currency.Cents {
+	amount := l.UnitPrice*currency.Cents(l.Quantity) - l.Discount
+	if amount < 0 {
+		return 0
+	}
+	return amount
+}
+
+// Request is a sale to tax.
+type Request struct {
+	// Reference is the order or invoice the sale is, for Commit.
+	Reference string `json:"reference,omitempty"`
+
+	Currency currency.Type `json:"currency"`
+	Address  Address       `json:"address"`
+	Customer Customer      `json:"customer"`
+
+	// RegionId is the commerce region the sale is in, whose price
+	// preference says whether prices include tax.
+	RegionId string `json:"regionId,omitempty"`
+
+	// Origin is the country the seller is established in. A sale is only
+	// reverse-charged when it is known to cross a border.
+	Origin string `json:"origin,omitempty"`
+
+	Lines    []Line         `json:"lines"`
+	Shipping currency.Cents `json:"shipping"`
+
+	// Inclusive is that prices already include tax: it is taken out of
+	// them rather than added on top.
+	Inclusive bool `json:"inclusive,omitempty"`
+
+	// ReverseChargeUnverified is that the org reverse-charges on tax
+	// numbers no Verifier checks, as its tax region for the address says.
+	ReverseChargeUnverified bool `json:"reverseChargeUnverified,omitempty"`
+}
+
+// Rate is one rate's part of the tax on a line.
+type Rate struct {
+	TaxRateId    string         `json:"taxRateId,omitempty"`
+	Name         string         `json:"name,omitempty"`
+	Code         string         `json:"code,omitempty"`
+	Rate         float64        `json:"rate"`
+	Amount       currency.Cents `json:"amount"`
+	Jurisdiction string         `json:"jurisdiction"`
+
+	// Taxable is what the rate was applied to, which returns that report
+	// sales by rate need alongside the tax.
+	Taxable currency.Cents `json:"taxable"`
+}
+
+// LineTax is the tax on one line, or on shipping.
+type LineTax struct {
+	LineId string `json:"lineId,omitempty"`
+
+	// Taxable is what the tax is on: the line's amount, or with inclusive
+	// prices the amount less the tax in it.
+	Taxable currency.Cents `json:"taxable"`
+	Tax     currency.Cents `json:"tax"`
+	Rates   []Rate         `json:"rates,omitempty"`
+}
+
+// Quote is the tax on a sale.
+type Quote struct {
+	Provider string `json:"provider"`
+
+	// Jurisdiction is where the sale is taxed, as a country or
+	// country-province code. It is empty when no tax region covers the
+	// address, which is not the same as one that charges nothing.
+	Jurisdiction string `json:"jurisdiction,omitempty"`
+
+	Lines    []LineTax `json:"lines"`
+	Shipping LineTax   `json:"shipping"`
+
+	// Tax is the tax on the lines and shipping together.
+	Tax currency.Cents `json:"tax"`
+
+	// Inclusive is that Tax is part of the prices rather than on top of
+	// them.
+	Inclusive bool `json:"inclusive,omitempty"`
+
+	Exempt          bool   `json:"exempt,omitempty"`
+	ExemptionNumber string `json:"exemptionNumber,omitempty"`
+
+	// ReverseCharge is that the buyer, a business abroad, accounts for the
+	// tax itself under its TaxId, which the invoice has to show.
+	ReverseCharge bool   `json:"reverseCharge,omitempty"`
+	TaxId         string `json:"taxId,omitempty"`
+}
+
+// ReverseCharge reports whether req is a sale across a border to a business
+// registered for tax where it is taxed, which is charged no tax: the buyer
+// accounts for it. That is the EU and UK reverse charge, and the same holds
+// for Australian and Canadian GST on sales by sellers abroad.
+//
+// The buyer's tax number has to be of the address's country and verified. A
+// number no Verifier checks (Unverified) is enough only where the org has
+// opted in (ReverseChargeUnverified); one whose check failed to run
+// (Unavailable) or showed to be invalid never is. Nor is an unknown origin,
+// since a seller at home charges its own tax to businesses too.
+func ReverseCharge(req *Request) bool {
+	id := req.Customer.TaxId
+	country := req.Address.Country
+	if req.Origin == "" || country == "" || req.Origin == country || id.Country != country || !id.Valid() {
+		return false
+	}
+	switch id.Status {
+	case taxid.Verified:
+		return true
+	case taxid.Unverified, "":
+		return req.ReverseChargeUnverified
+	}
+	return false
+}
+
+// Rates is the tax by rate across the quote's lines and shipping, in the
+// order the rates first appear.
+func (q *Quote) Rates() []Rate {
+	var out []Rate
+	seen := make(map[string]int)
+	add := func(rs []Rate) {
+		for _, r := range rs {
+			key := r.TaxRateId + "|" + r.Jurisdiction + "|" + r.Code
+			if i, ok := seen[key]; ok {
+				out[i].Amount += r.Amount
+				out[i].Taxable += r.Taxable
+				continue
+			}
+			seen[key] = len(out)
+			out = append(out, r)
+		}
+	}
+	for _, l := range q.Lines {
+		add(l.Rates)
+	}
+	add(q.Shipping.Rates)
+	return out
+}
+
+// Transaction is a sale as a provider recorded it.
+type Transaction struct {
+	Id        string         `json:"id"`
+	Provider  string         `json:"provider"`
+	Reference string         `json:"reference"`
+	Tax       currency.Cents `json:"tax"`
+}
+
+// LineItems is items as lines to tax, each less what discounts took off it,
+// by line id. Free items and subscriptions, which are not billed with the
+// rest, are left out.
+func LineItems(items []lineitem.LineItem, discounts map[string]currency.Cents) []Line {
+	out := make([]Line, 0, len(items))
+	for _, li := range items {
+		if li.Free || (li.Product != nil && li.Product.IsSubscribeable) {
+			continue
+		}
+		l := Line{
+			Id:        li.Id(),
+			ProductId: li.ProductId,
+			Quantity:  li.Quantity,
+			UnitPrice: li.Price,
+			Discount:  discounts[li.Id()],
+			Taxable:   li.Taxable,
+		}
+		if li.Product != nil {
+			l.ProductTypeId = li.Product.TypeId
+			l.TaxCode = li.Product.TaxCode
+		}
+		out = append(out, l)
+	}
+	return out
+}
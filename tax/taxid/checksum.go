@@ -0,0 +1,188 @@
+package taxid
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// vatChecks checks the digits of each member state's VAT numbers, after the
+// prefix, for the states whose check is public and settled. The rest are
+// checked for format only and left to the Verifier.
+var vatChecks = map[string]func(string) bool{
+	"AT": atCheck,
+	"BE": beCheck,
+	"DE": deCheck,
+	"DK": dkCheck,
+	"FI": fiCheck,
+	"FR": frCheck,
+	"IT": luhn,
+	"LU": luCheck,
+	"NL": nlCheck,
+	"PL": plCheck,
+	"PT": ptCheck,
+	"SE": func(v string) bool { return luhn(v[:10]) },
+}
+
+func digits(s string) []int {
+	d := make([]int, len(s))
+	for i := range s {
+		d[i] = int(s[i] - '0')
+	}
+	return d
+}
+
+// weighted is the sum of d's digits times weights, digit by digit.
+func weighted(d []int, weights ...int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += d[i] * w
+	}
+	return sum
+}
+
+// luhn is the Luhn check on a string of digits, the last being the check
+// digit.
+func luhn(v string) bool {
+	sum := 0
+	d := digits(v)
+	for i := range d {
+		n := d[len(d)-1-i]
+		if i%2 == 1 {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+// atCheck: U, seven digits and a Luhn-like check digit offset by 4.
+func atCheck(v string) bool {
+	d := digits(v[1:])
+	sum := 0
+	for i := 0; i < 7; i++ {
+		n := d[i]
+		if i%2 == 1 {
+			n *= 2
+			n = n/10 + n%10
+		}
+		sum += n
+	}
+	return (10-(sum+4)%10)%10 == d[7]
+}
+
+// beCheck: the last two digits are 97 less the first eight modulo 97.
+func beCheck(v string) bool {
+	n, _ := strconv.Atoi(v[:8])
+	check, _ := strconv.Atoi(v[8:])
+	return 97-n%97 == check
+}
+
+// deCheck: ISO 7064 MOD 11,10.
+func deCheck(v string) bool {
+	d := digits(v)
+	p := 10
+	for _, n := range d[:8] {
+		s := (n + p) % 10
+		if s == 0 {
+			s = 10
+		}
+		p = 2 * s % 11
+	}
+	check := 11 - p
+	if check == 10 {
+		check = 0
+	}
+	return check == d[8]
+}
+
+// dkCheck: the weighted sum of all eight digits is a multiple of 11.
+func dkCheck(v string) bool {
+	return weighted(digits(v), 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0
+}
+
+// fiCheck: 11 less the weighted sum of the first seven modulo 11, where a
+// remainder of 1 is never issued.
+func fiCheck(v string) bool {
+	d := digits(v)
+	r := weighted(d, 7, 9, 10, 5, 8, 4, 2) % 11
+	switch r {
+	case 0:
+		return d[7] == 0
+	case 1:
+		return false
+	}
+	return 11-r == d[7]
+}
+
+// frCheck: a numeric key is 12 plus three times the SIREN modulo 97, all
+// modulo 97. Keys with letters, issued since the numeric ones ran out, have
+// no public check.
+func frCheck(v string) bool {
+	key, err := strconv.Atoi(v[:2])
+	if err != nil {
+		return true
+	}
+	siren, _ := strconv.Atoi(v[2:])
+	return (12+3*(siren%97))%97 == key
+}
+
+// luCheck: the last two digits are the first six modulo 89.
+func luCheck(v string) bool {
+	n, _ := strconv.Atoi(v[:6])
+	check, _ := strconv.Atoi(v[6:])
+	return n%89 == check
+}
+
+// nlCheck: the ninth digit is the weighted sum of the first eight modulo 11,
+// for the numbers of companies; sole traders' numbers since 2020 are
+// checked as a whole, letters counted from A=10, modulo 97.
+func nlCheck(v string) bool {
+	d := digits(v[:9])
+	if weighted(d, 9, 8, 7, 6, 5, 4, 3, 2)%11 == d[8] {
+		return true
+	}
+	n := ""
+	for _, r := range "NL" + v {
+		if r >= 'A' && r <= 'Z' {
+			n += strconv.Itoa(int(r-'A') + 10)
+		} else {
+			n += string(r)
+		}
+	}
+	b, ok := new(big.Int).SetString(n, 10)
+	return ok && new(big.Int).Mod(b, big.NewInt(97)).Int64() == 1
+}
+
+// plCheck: the last digit is the weighted sum of the first nine modulo 11.
+func plCheck(v string) bool {
+	d := digits(v)
+	return weighted(d, 6, 5, 7, 2, 3, 4, 5, 6, 7)%11 == d[9]
+}
+
+// ptCheck: 11 less the weighted sum of the first eight modulo 11, or 0.
+func ptCheck(v string) bool {
+	d := digits(v)
+	check := 11 - weighted(d, 9, 8, 7, 6, 5, 4, 3, 2)%11
+	if check >= 10 {
+		check = 0
+	}
+	return check == d[8]
+}
+
+// gbCheck: the weighted sum of the first seven digits and the last two is
+// a multiple of 97, or, for numbers issued since 2010, is once 55 is added.
+func gbCheck(v string) bool {
+	d := digits(v)
+	sum := weighted(d, 8, 7, 6, 5, 4, 3, 2) + d[7]*10 + d[8]
+	return sum%97 == 0 || (sum+55)%97 == 0
+}
+
+// abnCheck: with one taken from the first digit, the weighted sum is a
+// multiple of 89.
+func abnCheck(v string) bool {
+	d := digits(v)
+	d[0]--
+	return weighted(d, 10, 1, 3, 5, 7, 9, 11, 13, 15, 17, 19)%89 == 0
+}
@@ -0,0 +1,257 @@
+// Package taxid is the tax registration numbers business customers give: EU
+// and UK VAT numbers, Australian Business Numbers and Canadian Business and
+// GST/HST numbers.
+//
+// A number is parsed into a TaxId, normalized, and checked for its country's
+// format and check digits, which catches the typing mistakes that would
+// otherwise go to a verification service, or go unnoticed when there is none.
+// Whether the number is registered to anyone is the Verifier's to say
+// (verify.go); the tax engine reverse-charges a sale to a number that has not
+// been shown to be invalid, and charges tax on one that has.
+package taxid
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupported is returned for a number of a country or type with no
+	// scheme here.
+	ErrUnsupported = errors.New("taxid: unsupported country or type")
+
+	// ErrFormat is returned for a number not in its scheme's format.
+	ErrFormat = errors.New("taxid: number is not in the right format")
+
+	// ErrChecksum is returned for a number whose check digits do not match.
+	ErrChecksum = errors.New("taxid: check digits do not match")
+)
+
+// Type is the scheme a number belongs to, by the names payment processors
+// give them.
+type Type string
+
+const (
+	EUVAT Type = "eu_vat"
+	GBVAT Type = "gb_vat"
+	AUABN Type = "au_abn"
+	CABN  Type = "ca_bn"
+	CAGST Type = "ca_gst_hst"
+)
+
+// Status is what verification made of a number.
+type Status string
+
+const (
+	// Unverified numbers are well formed and nobody has said otherwise,
+	// because no Verifier is registered for the scheme.
+	Unverified Status = "unverified"
+
+	// Verified numbers are registered, by the Verifier.
+	Verified Status = "verified"
+
+	// Invalid numbers are malformed, or not registered to anyone.
+	Invalid Status = "invalid"
+
+	// Unavailable numbers are well formed but could not be verified, the
+	// service being down; they are checked again when next saved.
+	Unavailable Status = "unavailable"
+)
+
+// TaxId is a customer's tax registration number.
+type TaxId struct {
+	Type Type `json:"type,omitempty"`
+
+	// Value is the number, normalized: upper case, without spaces or
+	// punctuation, and for VAT numbers with their country prefix.
+	Value string `json:"value"`
+
+	// Country is the ISO 3166 code of the country that issued the number.
+	// Greek VAT numbers are prefixed EL, but their country is GR.
+	Country string `json:"country,omitempty"`
+
+	Status Status `json:"status,omitempty"`
+
+	// The registered name and address of the business, as the Verifier
+	// returned them, and when.
+	VerifiedName    string    `json:"verifiedName,omitempty"`
+	VerifiedAddress string    `json:"verifiedAddress,omitempty"`
+	VerifiedAt      time.Time `json:"verifiedAt,omitempty"`
+}
+
+// Holder is a model with a tax number of its own, kept by Install.
+type Holder interface {
+	TaxIdentity() *TaxId
+}
+
+// vatPrefixes is the VAT number prefix of each EU member state.
+var vatPrefixes = map[string]string{
+	"AT": "AT", "BE": "BE", "BG": "BG", "CY": "CY", "CZ": "CZ", "DE": "DE",
+	"DK": "DK", "EE": "EE", "EL": "GR", "ES": "ES", "FI": "FI", "FR": "FR",
+	"HR": "HR", "HU": "HU", "IE": "IE", "IT": "IT", "LT": "LT", "LU": "LU",
+	"LV": "LV", "MT": "MT", "NL": "NL", "PL": "PL", "PT": "PT", "RO": "RO",
+	"SE": "SE", "SI": "SI", "SK": "SK",
+}
+
+// MemberState reports whether country is an EU member state, and so taxes
+// digital sales under the One-Stop-Shop.
+func MemberState(country string) bool {
+	if country == "GR" {
+		return true
+	}
+	c, ok := vatPrefixes[country]
+	return ok && c == country
+}
+
+// vatPrefix is the VAT prefix of an EU country.
+func vatPrefix(country string) string {
+	if country == "GR" {
+		return "EL"
+	}
+	return country
+}
+
+// Parse reads raw as the tax number of a business in country. A VAT number
+// with its country prefix is read as that country's, whatever country says;
+// one without takes country's. An Australian number is read as an ABN, and
+// a Canadian one as a Business Number or, with a program account, a GST/HST
+// number.
+func Parse(country, raw string) (TaxId, error) {
+	v := normalize(raw)
+	country = strings.ToUpper(strings.TrimSpace(country))
+
+	id := TaxId{Value: v}
+	switch {
+	case len(v) > 2 && (v[:2] == "GB" || v[:2] == "XI"):
+		id.Type, id.Country = GBVAT, "GB"
+	case len(v) > 2 && vatPrefixes[v[:2]] != "":
+		id.Type, id.Country = EUVAT, vatPrefixes[v[:2]]
+	case country == "GB":
+		id.Type, id.Country, id.Value = GBVAT, "GB", "GB"+v
+	case MemberState(country):
+		id.Type, id.Country, id.Value = EUVAT, country, vatPrefix(country)+v
+	case country == "AU":
+		id.Type, id.Country = AUABN, "AU"
+	case country == "CA" && len(v) > 9:
+		id.Type, id.Country = CAGST, "CA"
+	case country == "CA":
+		id.Type, id.Country = CABN, "CA"
+	default:
+		return id, ErrUnsupported
+	}
+	return id, id.Validate()
+}
+
+func normalize(raw string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '/', '\t':
+			return -1
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return r
+	}, raw)
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// formats is the shape of each scheme's numbers, and of each member state's
+// VAT numbers after the prefix.
+var formats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"EL": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^[1-9]\d{1,9}$`),
+	"SE": regexp.MustCompile(`^\d{10}01$`),
+	"SI": regexp.MustCompile(`^[1-9]\d{7}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+
+	"GB":     regexp.MustCompile(`^(\d{9}|\d{12}|GD[0-4]\d{2}|HA[5-9]\d{2})$`),
+	"AU":     regexp.MustCompile(`^\d{11}$`),
+	"CA":     regexp.MustCompile(`^\d{9}$`),
+	"CA-GST": regexp.MustCompile(`^\d{9}RT\d{4}$`),
+}
+
+// Validate checks id's format and check digits. It does not say whether the
+// number is registered to anyone.
+func (id TaxId) Validate() error {
+	v := id.Value
+	switch id.Type {
+	case EUVAT:
+		if len(v) < 3 {
+			return ErrFormat
+		}
+		prefix, rest := v[:2], v[2:]
+		if vatPrefixes[prefix] == "" || (id.Country != "" && vatPrefixes[prefix] != id.Country) {
+			return ErrFormat
+		}
+		if !formats[prefix].MatchString(rest) {
+			return ErrFormat
+		}
+		if check, ok := vatChecks[prefix]; ok && !check(rest) {
+			return ErrChecksum
+		}
+		return nil
+
+	case GBVAT:
+		if len(v) < 3 || (v[:2] != "GB" && v[:2] != "XI") || !formats["GB"].MatchString(v[2:]) {
+			return ErrFormat
+		}
+		if rest := v[2:]; isDigit(rest[0]) && !gbCheck(rest[:9]) {
+			return ErrChecksum
+		}
+		return nil
+
+	case AUABN:
+		if !formats["AU"].MatchString(v) {
+			return ErrFormat
+		}
+		if !abnCheck(v) {
+			return ErrChecksum
+		}
+		return nil
+
+	case CABN, CAGST:
+		f := formats["CA"]
+		if id.Type == CAGST {
+			f = formats["CA-GST"]
+		}
+		if !f.MatchString(v) {
+			return ErrFormat
+		}
+		if !luhn(v[:9]) {
+			return ErrChecksum
+		}
+		return nil
+	}
+	return ErrUnsupported
+}
+
+// Valid reports whether id is well formed and not known to be invalid.
+func (id TaxId) Valid() bool {
+	return id.Value != "" && id.Status != Invalid && id.Validate() == nil
+}
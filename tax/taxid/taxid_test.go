@@ -0,0 +1,118 @@
+package taxid
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Real registrations, or numbers built to each scheme's check, as they are
+// typed: with spaces, dots and lower case.
+func TestParse_Valid(t *testing.T) {
+	cases := []struct {
+		country, raw string
+		typ          Type
+		value        string
+		issuer       string
+	}{
+		{"", "atu13585627", EUVAT, "ATU13585627", "AT"},
+		{"", "BE 0403.170.701", EUVAT, "BE0403170701", "BE"},
+		{"DE", "136695976", EUVAT, "DE136695976", "DE"},
+		{"", "DK13585628", EUVAT, "DK13585628", "DK"},
+		{"", "FI20774740", EUVAT, "FI20774740", "FI"},
+		{"", "FR 40 303265045", EUVAT, "FR40303265045", "FR"},
+		{"", "IT00743110157", EUVAT, "IT00743110157", "IT"},
+		{"", "LU26375245", EUVAT, "LU26375245", "LU"},
+		{"", "NL004495445B01", EUVAT, "NL004495445B01", "NL"},
+		{"", "PL5260250274", EUVAT, "PL5260250274", "PL"},
+		{"", "PT501964843", EUVAT, "PT501964843", "PT"},
+		{"", "SE556188840401", EUVAT, "SE556188840401", "SE"},
+		{"", "GB 980 7806 84", GBVAT, "GB980780684", "GB"},
+		{"AU", "51 824 753 556", AUABN, "51824753556", "AU"},
+		{"CA", "123456782", CABN, "123456782", "CA"},
+		{"CA", "123456782 RT0001", CAGST, "123456782RT0001", "CA"},
+	}
+	for _, c := range cases {
+		id, err := Parse(c.country, c.raw)
+		if err != nil {
+			t.Errorf("Parse(%q, %q): %v", c.country, c.raw, err)
+			continue
+		}
+		if id.Type != c.typ || id.Value != c.value || id.Country != c.issuer {
+			t.Errorf("Parse(%q, %q) = %+v, want %s %s %s", c.country, c.raw, id, c.typ, c.value, c.issuer)
+		}
+	}
+}
+
+// Greek numbers are prefixed EL, and issued by GR.
+func TestParse_Greece(t *testing.T) {
+	id, err := Parse("GR", "123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Value != "EL123456789" || id.Country != "GR" || !MemberState("GR") {
+		t.Fatalf("greek number: %+v", id)
+	}
+}
+
+// A digit off, or two swapped, fails the check; a number of the wrong shape
+// fails the format first.
+func TestParse_Invalid(t *testing.T) {
+	cases := []struct {
+		country, raw string
+		err          error
+	}{
+		{"", "DE136695977", ErrChecksum},
+		{"", "ATU13585628", ErrChecksum},
+		{"", "BE0403170702", ErrChecksum},
+		{"", "IT00743110158", ErrChecksum},
+		{"", "PL5260250247", ErrChecksum},
+		{"", "GB980780685", ErrChecksum},
+		{"AU", "51824753557", ErrChecksum},
+		{"CA", "123456783", ErrChecksum},
+		{"", "DE13669597", ErrFormat},
+		{"", "ATX13585627", ErrFormat},
+		{"US", "12-3456789", ErrUnsupported},
+	}
+	for _, c := range cases {
+		if _, err := Parse(c.country, c.raw); !errors.Is(err, c.err) {
+			t.Errorf("Parse(%q, %q) = %v, want %v", c.country, c.raw, err, c.err)
+		}
+	}
+}
+
+// Verify trusts no status it is handed, records the registry's answer, and
+// tells a registry that is down from a number that is not registered.
+func TestVerify(t *testing.T) {
+	defer RegisterVerifier(EUVAT, nil)
+	ctx := context.Background()
+
+	id := TaxId{Value: "DE136695976", Status: Invalid}
+	if err := Verify(ctx, &id); err != nil || id.Status != Unverified || !id.Valid() {
+		t.Fatalf("no verifier: %v %+v", err, id)
+	}
+
+	RegisterVerifier(EUVAT, VerifierFunc(func(ctx context.Context, id TaxId) (Result, error) {
+		return Result{Valid: id.Value == "DE136695976", Name: "ACME GMBH"}, nil
+	}))
+	id = TaxId{Value: "DE 136 695 976"}
+	if err := Verify(ctx, &id); err != nil || id.Status != Verified || id.VerifiedName != "ACME GMBH" || id.VerifiedAt.IsZero() {
+		t.Fatalf("verified: %v %+v", err, id)
+	}
+	id = TaxId{Value: "FR40303265045"}
+	if err := Verify(ctx, &id); err != nil || id.Status != Invalid || id.Valid() {
+		t.Fatalf("not registered: %v %+v", err, id)
+	}
+
+	down := errors.New("vies: service unavailable")
+	RegisterVerifier(EUVAT, VerifierFunc(func(context.Context, TaxId) (Result, error) { return Result{}, down }))
+	id = TaxId{Value: "DE136695976", Status: Verified}
+	if err := Verify(ctx, &id); err != down || id.Status != Unavailable || !id.Valid() {
+		t.Fatalf("unavailable: %v %+v", err, id)
+	}
+
+	id = TaxId{Value: "DE136695977"}
+	if err := Verify(ctx, &id); !errors.Is(err, ErrChecksum) || id.Status != Invalid {
+		t.Fatalf("bad checksum: %v %+v", err, id)
+	}
+}
@@ -0,0 +1,120 @@
+package taxid
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+)
+
+// Result is what a Verifier found out about a number.
+type Result struct {
+	// Valid is that the number is registered to a business.
+	Valid bool
+
+	Name    string
+	Address string
+}
+
+// Verifier asks the registry that issued a number whether it is registered:
+// VIES for EU VAT numbers, HMRC for UK ones, the ABR for ABNs. An error is
+// the registry not answering, not the number being invalid.
+type Verifier interface {
+	Verify(ctx context.Context, id TaxId) (Result, error)
+}
+
+// VerifierFunc is a func as a Verifier.
+type VerifierFunc func(ctx context.Context, id TaxId) (Result, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, id TaxId) (Result, error) { return f(ctx, id) }
+
+var (
+	verifiersMu sync.RWMutex
+	verifiers   = make(map[Type]Verifier)
+)
+
+// RegisterVerifier makes v the Verifier of numbers of type t. None are
+// registered by default, and numbers of a type without one are left
+// Unverified.
+func RegisterVerifier(t Type, v Verifier) {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+	if v == nil {
+		delete(verifiers, t)
+		return
+	}
+	verifiers[t] = v
+}
+
+// Verify normalizes id, checks it and has it verified, and records the
+// outcome in it. Whatever status id came with is not trusted.
+//
+// The error is why id is Invalid, or the Verifier's when it did not answer
+// and id is Unavailable.
+func Verify(ctx context.Context, id *TaxId) error {
+	parsed, err := Parse(id.Country, id.Value)
+	*id = parsed
+	if err != nil {
+		id.Status = Invalid
+		return err
+	}
+
+	verifiersMu.RLock()
+	v := verifiers[id.Type]
+	verifiersMu.RUnlock()
+	if v == nil {
+		id.Status = Unverified
+		return nil
+	}
+
+	res, err := v.Verify(ctx, *id)
+	if err != nil {
+		id.Status = Unavailable
+		return err
+	}
+	if !res.Valid {
+		id.Status = Invalid
+		return nil
+	}
+	id.Status = Verified
+	id.VerifiedName = res.Name
+	id.VerifiedAddress = res.Address
+	id.VerifiedAt = time.Now()
+	return nil
+}
+
+// Install verifies the tax numbers of models of the given kinds, each a
+// Holder, as they are written with a new or changed number, or one that
+// could not be verified before. It runs before the write, so what is saved
+// is the number as verified.
+//
+// An invalid number is saved as Invalid rather than refusing the write: a
+// customer with a mistyped VAT number is charged VAT, not kept from
+// buying.
+func Install(r *hooks.Registry, kinds ...string) {
+	for _, kind := range kinds {
+		r.OnModelCreate(kind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "taxid", Func: verifyChanged})
+		r.OnModelUpdate(kind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "taxid", Func: verifyChanged})
+	}
+}
+
+func verifyChanged(e *hooks.ModelEvent) error {
+	h, ok := e.Model.(Holder)
+	if !ok {
+		return e.Next()
+	}
+	id := h.TaxIdentity()
+	if id.Value == "" || (!e.IsNew && !e.Changed("taxId", "customerTaxId") && id.Status != Unavailable) {
+		return e.Next()
+	}
+	ctx := e.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := Verify(ctx, id); err != nil {
+		log.Warn("taxid: %s %s is %s: %v", e.Kind, id.Value, id.Status, err, ctx)
+	}
+	return e.Next()
+}
@@ -350,7 +350,7 @@ func (api API) CreateOrder(storeId string, ord *order.Order) *Error {
 
 			// Optional
 			TaxTotal:          centsToFloat(ord.Tax, ord.Currency),
-			ShippingTotal:     centsToFloat(ord.Shipping, ord.Currency),
+			ShippingTotal:     centsToFloat(ord.NetShipping(), ord.Currency),
 			FinancialStatus:   string(ord.PaymentStatus),
 			FulfillmentStatus: string(ord.Fulfillment.Status),
 			CampaignID:        ord.Mailchimp.CampaignId,
@@ -441,7 +441,7 @@ func (api API) UpdateOrder(storeId string, ord *order.Order) *Error {
 
 			// Optional
 			TaxTotal:          centsToFloat(ord.Tax, ord.Currency),
-			ShippingTotal:     centsToFloat(ord.Shipping, ord.Currency),
+			ShippingTotal:     centsToFloat(ord.NetShipping(), ord.Currency),
 			FinancialStatus:   string(ord.PaymentStatus),
 			FulfillmentStatus: string(ord.Fulfillment.Status),
 			CampaignID:        ord.Mailchimp.CampaignId,
@@ -2,6 +2,7 @@ package mandrill
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -97,6 +98,31 @@ func (c *Client) Send(message *email.Message) error {
 	return nil
 }
 
+// SendId sends message and returns the id Mandrill gave it. A message
+// Mandrill rejected or found invalid is an error.
+func (c *Client) SendId(message *email.Message) (string, error) {
+	var (
+		res []*mandrill.Response
+		err error
+		msg = newMessage(message)
+	)
+	if message.TemplateID != "" {
+		res, err = c.client.MessagesSendTemplate(msg, message.TemplateID, msg.GlobalMergeVars)
+	} else {
+		res, err = c.client.MessagesSend(msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(res) == 0 {
+		return "", nil
+	}
+	if res[0].Status == "rejected" || res[0].Status == "invalid" {
+		return "", fmt.Errorf("mandrill: %s: %s", res[0].Status, res[0].RejectionReason)
+	}
+	return res[0].Id, nil
+}
+
 func New(c context.Context, in integration.Mandrill) *Client {
 	// Set deadline
 	var cancel context.CancelFunc
@@ -187,7 +187,7 @@ func (c Client) SetPaymentOptions(pay *payment.Payment, ord *order.Order, org *o
 	}
 
 	// Add shipping, tax
-	data.Set("receiverOptions[0].invoiceData.totalShipping", cur.ToStringNoSymbol(ord.Shipping))
+	data.Set("receiverOptions[0].invoiceData.totalShipping", cur.ToStringNoSymbol(ord.NetShipping()))
 	data.Set("receiverOptions[0].invoiceData.totalTax", cur.ToStringNoSymbol(ord.Tax))
 
 	// Make request
@@ -1,6 +1,8 @@
 package sendgrid
 
 import (
+	"fmt"
+
 	"github.com/hanzoai/sendgrid-go/helpers/mail"
 
 	"github.com/hanzoai/commerce/log"
@@ -123,3 +125,19 @@ func (api API) Send(message *email.Message) error {
 	log.Info("Headers: %v", res.Headers, c)
 	return nil
 }
+
+// SendId sends message and returns the id SendGrid gave it. Unlike Send, a
+// response SendGrid did not accept the message with is an error.
+func (api API) SendId(message *email.Message) (string, error) {
+	res, err := api.Request("POST", "/v3/mail/send", nil, newMessage(message))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode >= 300 {
+		return "", fmt.Errorf("sendgrid: %d: %s", res.StatusCode, res.Body)
+	}
+	if ids := res.Headers["X-Message-Id"]; len(ids) > 0 {
+		return ids[0], nil
+	}
+	return "", nil
+}
@@ -259,7 +259,7 @@ func newOrder(ord *order.Order) *Order {
 	so.LastModified = Date(ord.UpdatedAt)
 	so.OrderTotal = ord.Currency.ToStringNoSymbol(ord.Total)
 	so.TaxAmount = ord.Currency.ToStringNoSymbol(ord.Tax)
-	so.ShippingAmount = ord.Currency.ToStringNoSymbol(ord.Shipping)
+	so.ShippingAmount = ord.Currency.ToStringNoSymbol(ord.NetShipping())
 	so.Items.Items = make([]Item, len(ord.Items))
 	for i, item := range ord.Items {
 		so.Items.Items[i] = newItem(ord, item)
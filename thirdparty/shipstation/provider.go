@@ -0,0 +1,337 @@
+package shipstation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hanzoai/commerce/fulfillment"
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/fulfillmentprovider"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/util/json"
+)
+
+func init() { fulfillment.Register(ProviderName, openProvider) }
+
+// ProviderName is the name a fulfillmentprovider gives ShipStation.
+const ProviderName = "shipstation"
+
+// Provider is ShipStation's REST API as a fulfillment provider: it quotes
+// and buys labels from the carrier accounts connected to ShipStation, which
+// the merchant then packs and hands over. It is apart from the order export
+// ShipStation polls (see Route), which has ShipStation buy the labels.
+//
+// ShipStation does not report tracking scans through its API; it posts its
+// ship notifications to the export endpoint, which records them.
+type Provider struct {
+	ApiKey    string
+	ApiSecret string
+	Endpoint  string
+
+	// Carriers are the codes of the carriers to quote, from the
+	// fulfillmentprovider's metadata under "carriers"; all connected to
+	// ShipStation when empty.
+	Carriers []string
+
+	client *http.Client
+}
+
+func openProvider(org *organization.Organization, cfg *fulfillmentprovider.FulfillmentProvider) (fulfillment.Provider, error) {
+	if org.ShipStation.ApiKey == "" {
+		return nil, fmt.Errorf("shipstation: no credentials for %s", org.Name)
+	}
+	p := &Provider{
+		ApiKey:    org.ShipStation.ApiKey,
+		ApiSecret: org.ShipStation.ApiSecret,
+		Endpoint:  "https://ssapi.shipstation.com",
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if carriers, ok := cfg.Metadata["carriers"]; ok {
+		if err := json.DecodeBytes(json.EncodeBytes(carriers), &p.Carriers); err != nil {
+			return nil, fmt.Errorf("shipstation: carriers: %w", err)
+		}
+	}
+	return p, nil
+}
+
+func (p *Provider) Name() string { return ProviderName }
+
+func (p *Provider) do(ctx context.Context, method, path string, body, dst interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(json.EncodeBytes(body))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.Endpoint+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(p.ApiKey, p.ApiSecret)
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("shipstation: %s %s: %w", method, path, err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if res.StatusCode >= 300 {
+		var e struct {
+			Message          string `json:"Message"`
+			ExceptionMessage string `json:"ExceptionMessage"`
+		}
+		json.DecodeBytes(data, &e)
+		if e.ExceptionMessage != "" {
+			e.Message = e.ExceptionMessage
+		}
+		return fmt.Errorf("shipstation: %s %s: %d %s", method, path, res.StatusCode, e.Message)
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.DecodeBytes(data, dst)
+}
+
+type address struct {
+	Name        string `json:"name"`
+	Company     string `json:"company,omitempty"`
+	Street1     string `json:"street1"`
+	Street2     string `json:"street2,omitempty"`
+	City        string `json:"city"`
+	State       string `json:"state"`
+	PostalCode  string `json:"postalCode"`
+	Country     string `json:"country"`
+	Phone       string `json:"phone,omitempty"`
+	Residential bool   `json:"residential"`
+}
+
+func addressOf(a fulfillment.Address) address {
+	return address{
+		Name:        a.Name,
+		Company:     a.Company,
+		Street1:     a.Line1,
+		Street2:     a.Line2,
+		City:        a.City,
+		State:       a.State,
+		PostalCode:  a.PostalCode,
+		Country:     a.Country,
+		Phone:       a.Phone,
+		Residential: a.Residential,
+	}
+}
+
+type weight struct {
+	Value float64 `json:"value"`
+	Units string  `json:"units"`
+}
+
+type dimensions struct {
+	Units  string  `json:"units"`
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// parcel is req's one parcel, which is all ShipStation labels at once.
+func parcel(req *fulfillment.Request) (weight, *dimensions, error) {
+	if len(req.Parcels) != 1 {
+		return weight{}, nil, fmt.Errorf("shipstation: %d parcels, labels are bought one parcel at a time", len(req.Parcels))
+	}
+	pc := req.Parcels[0]
+	w := pc.Weight
+	if w == 0 {
+		for _, it := range pc.Items {
+			w += it.Weight * float64(it.Quantity)
+		}
+	}
+	if w == 0 {
+		return weight{}, nil, fmt.Errorf("shipstation: parcel has no weight")
+	}
+	var dims *dimensions
+	if pc.Length > 0 && pc.Width > 0 && pc.Height > 0 {
+		dims = &dimensions{Units: "centimeters", Length: pc.Length, Width: pc.Width, Height: pc.Height}
+	}
+	return weight{Value: w, Units: "grams"}, dims, nil
+}
+
+// ValidateAddress is not something ShipStation's API does.
+func (p *Provider) ValidateAddress(ctx context.Context, addr fulfillment.Address) (fulfillment.Address, error) {
+	return addr, fulfillment.ErrUnsupported
+}
+
+type rateRequest struct {
+	CarrierCode    string      `json:"carrierCode"`
+	ServiceCode    string      `json:"serviceCode,omitempty"`
+	FromPostalCode string      `json:"fromPostalCode"`
+	ToState        string      `json:"toState,omitempty"`
+	ToCountry      string      `json:"toCountry"`
+	ToPostalCode   string      `json:"toPostalCode"`
+	ToCity         string      `json:"toCity,omitempty"`
+	Weight         weight      `json:"weight"`
+	Dimensions     *dimensions `json:"dimensions,omitempty"`
+	Residential    bool        `json:"residential"`
+}
+
+type rate struct {
+	ServiceName  string  `json:"serviceName"`
+	ServiceCode  string  `json:"serviceCode"`
+	ShipmentCost float64 `json:"shipmentCost"`
+	OtherCost    float64 `json:"otherCost"`
+}
+
+// Rates quotes each of the provider's carriers, which ShipStation quotes
+// one at a time. ShipStation quotes in US dollars.
+func (p *Provider) Rates(ctx context.Context, req *fulfillment.Request) ([]fulfillment.Rate, error) {
+	w, dims, err := parcel(req)
+	if err != nil {
+		return nil, err
+	}
+	carriers := p.Carriers
+	if len(carriers) == 0 {
+		var connected []struct {
+			Code string `json:"code"`
+		}
+		if err := p.do(ctx, "GET", "/carriers", nil, &connected); err != nil {
+			return nil, err
+		}
+		for _, c := range connected {
+			carriers = append(carriers, c.Code)
+		}
+	}
+
+	var rates []fulfillment.Rate
+	for _, carrier := range carriers {
+		rr := rateRequest{
+			CarrierCode:    carrier,
+			ServiceCode:    req.Service,
+			FromPostalCode: req.From.PostalCode,
+			ToState:        req.To.State,
+			ToCountry:      req.To.Country,
+			ToPostalCode:   req.To.PostalCode,
+			ToCity:         req.To.City,
+			Weight:         w,
+			Dimensions:     dims,
+			Residential:    req.To.Residential,
+		}
+		var quoted []rate
+		if err := p.do(ctx, "POST", "/shipments/getrates", rr, &quoted); err != nil {
+			return nil, err
+		}
+		for _, q := range quoted {
+			amount, err := currency.USD.Parse(strconv.FormatFloat(q.ShipmentCost+q.OtherCost, 'f', 2, 64))
+			if err != nil {
+				return nil, fmt.Errorf("shipstation: rate %s: %w", q.ServiceCode, err)
+			}
+			rates = append(rates, fulfillment.Rate{
+				Provider: ProviderName,
+				Carrier:  carrier,
+				Service:  q.ServiceCode,
+				Name:     q.ServiceName,
+				Amount:   amount,
+				Currency: currency.USD,
+			})
+		}
+	}
+	return rates, nil
+}
+
+type labelRequest struct {
+	CarrierCode  string      `json:"carrierCode"`
+	ServiceCode  string      `json:"serviceCode"`
+	PackageCode  string      `json:"packageCode"`
+	Confirmation string      `json:"confirmation"`
+	ShipDate     string      `json:"shipDate"`
+	Weight       weight      `json:"weight"`
+	Dimensions   *dimensions `json:"dimensions,omitempty"`
+	ShipFrom     address     `json:"shipFrom"`
+	ShipTo       address     `json:"shipTo"`
+}
+
+type label struct {
+	ShipmentId     int     `json:"shipmentId"`
+	ShipmentCost   float64 `json:"shipmentCost"`
+	InsuranceCost  float64 `json:"insuranceCost"`
+	TrackingNumber string  `json:"trackingNumber"`
+	LabelData      string  `json:"labelData"`
+}
+
+// label buys a label from one address to another. ShipStation returns the
+// label itself, a base64 PDF, rather than a link to it; it is kept as a
+// data URL.
+func (p *Provider) label(ctx context.Context, req *fulfillment.Request, from, to fulfillment.Address) (*fulfillment.Shipment, error) {
+	if req.Carrier == "" || req.Service == "" {
+		return nil, fmt.Errorf("shipstation: a label needs a carrier and service, from a rate")
+	}
+	w, dims, err := parcel(req)
+	if err != nil {
+		return nil, err
+	}
+	lr := labelRequest{
+		CarrierCode:  req.Carrier,
+		ServiceCode:  req.Service,
+		PackageCode:  "package",
+		Confirmation: "none",
+		ShipDate:     time.Now().Format("2006-01-02"),
+		Weight:       w,
+		Dimensions:   dims,
+		ShipFrom:     addressOf(from),
+		ShipTo:       addressOf(to),
+	}
+	var l label
+	if err := p.do(ctx, "POST", "/shipments/createlabel", lr, &l); err != nil {
+		return nil, err
+	}
+	cost, err := currency.USD.Parse(strconv.FormatFloat(l.ShipmentCost+l.InsuranceCost, 'f', 2, 64))
+	if err != nil {
+		return nil, err
+	}
+	return &fulfillment.Shipment{
+		Id:      strconv.Itoa(l.ShipmentId),
+		Carrier: req.Carrier,
+		Service: req.Service,
+		Cost:    cost,
+		Labels: []fulfillmentmodel.FulfillmentLabel{{
+			TrackingNumber: l.TrackingNumber,
+			LabelUrl:       "data:application/pdf;base64," + l.LabelData,
+		}},
+	}, nil
+}
+
+// CreateShipment buys a label at the carrier and service req names.
+func (p *Provider) CreateShipment(ctx context.Context, req *fulfillment.Request) (*fulfillment.Shipment, error) {
+	return p.label(ctx, req, req.From, req.To)
+}
+
+// CancelShipment voids the label, which the carrier refunds.
+func (p *Provider) CancelShipment(ctx context.Context, id string) error {
+	shipmentId, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("shipstation: shipment id %q: %w", id, err)
+	}
+	var res struct {
+		Approved bool   `json:"approved"`
+		Message  string `json:"message"`
+	}
+	if err := p.do(ctx, "POST", "/shipments/voidlabel", map[string]int{"shipmentId": shipmentId}, &res); err != nil {
+		return err
+	}
+	if !res.Approved {
+		return fmt.Errorf("shipstation: void shipment %s: %s", id, res.Message)
+	}
+	return nil
+}
+
+// Track is not something ShipStation's API does; see Provider.
+func (p *Provider) Track(ctx context.Context, id string) (*fulfillment.Tracking, error) {
+	return nil, fulfillment.ErrUnsupported
+}
+
+// CreateReturnLabel buys a label from the customer back to the merchant.
+func (p *Provider) CreateReturnLabel(ctx context.Context, shipment string, req *fulfillment.Request) (*fulfillment.Shipment, error) {
+	return p.label(ctx, req, req.To, req.From)
+}
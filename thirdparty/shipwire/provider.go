@@ -0,0 +1,274 @@
+package shipwire
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hanzoai/commerce/fulfillment"
+	"github.com/hanzoai/commerce/models/fulfillmentmodel"
+	"github.com/hanzoai/commerce/models/fulfillmentprovider"
+	"github.com/hanzoai/commerce/models/organization"
+	"github.com/hanzoai/commerce/models/types/currency"
+	"github.com/hanzoai/commerce/util/json"
+
+	. "github.com/hanzoai/commerce/thirdparty/shipwire/types"
+)
+
+func init() { fulfillment.Register(fulfillmentTypeName, openProvider) }
+
+const fulfillmentTypeName = "shipwire"
+
+// Provider is Shipwire as a fulfillment provider: its warehouses pick, pack
+// and label the order, so a shipment is a Shipwire order, and its labels and
+// tracking appear once the warehouse has shipped it.
+type Provider struct {
+	Username string
+	Password string
+
+	// WarehouseArea is where rates are quoted from, US unless the
+	// fulfillmentprovider's metadata says otherwise under "warehouseArea".
+	WarehouseArea string
+}
+
+func openProvider(org *organization.Organization, cfg *fulfillmentprovider.FulfillmentProvider) (fulfillment.Provider, error) {
+	if org.Shipwire.Username == "" {
+		return nil, fmt.Errorf("shipwire: no credentials for %s", org.Name)
+	}
+	p := &Provider{Username: org.Shipwire.Username, Password: org.Shipwire.Password, WarehouseArea: "US"}
+	if area, ok := cfg.Metadata["warehouseArea"].(string); ok && area != "" {
+		p.WarehouseArea = area
+	}
+	return p, nil
+}
+
+func (p *Provider) Name() string { return fulfillmentTypeName }
+
+func (p *Provider) client(ctx context.Context) *Client {
+	return NewClient(ctx, p.Username, p.Password)
+}
+
+func items(req *fulfillment.Request) []Item {
+	var out []Item
+	for _, it := range req.Items() {
+		out = append(out, Item{SKU: it.SKU, Quantity: it.Quantity})
+	}
+	return out
+}
+
+type addressValidation struct {
+	Name       string `json:"name,omitempty"`
+	Address1   string `json:"address1"`
+	Address2   string `json:"address2,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+}
+
+// ValidateAddress has Shipwire's address validation correct addr.
+func (p *Provider) ValidateAddress(ctx context.Context, addr fulfillment.Address) (fulfillment.Address, error) {
+	req := addressValidation{
+		Name:       addr.Name,
+		Address1:   addr.Line1,
+		Address2:   addr.Line2,
+		City:       addr.City,
+		State:      addr.State,
+		PostalCode: addr.PostalCode,
+		Country:    addr.Country,
+	}
+	var res struct {
+		Status   int               `json:"status"`
+		Message  string            `json:"message"`
+		Errors   []Error           `json:"errors"`
+		Resource addressValidation `json:"resource"`
+	}
+	if _, err := p.client(ctx).Request("POST", ".1/addressValidation", req, &res); err != nil {
+		return addr, err
+	}
+	if res.Status >= 300 || len(res.Errors) > 0 {
+		return addr, fmt.Errorf("%w: %s", fulfillment.ErrAddress, res.Message)
+	}
+	if r := res.Resource; r.Address1 != "" {
+		addr.Line1, addr.Line2, addr.City, addr.State, addr.PostalCode, addr.Country =
+			r.Address1, r.Address2, r.City, r.State, r.PostalCode, r.Country
+	}
+	return addr, nil
+}
+
+// Rates quotes every service level of the warehouse Shipwire would ship
+// from.
+func (p *Provider) Rates(ctx context.Context, req *fulfillment.Request) ([]fulfillment.Rate, error) {
+	rr := RateRequest{}
+	rr.Options.Currency = req.Currency.Code()
+	rr.Options.CanSplit = 1
+	rr.Options.WarehouseArea = p.WarehouseArea
+	rr.Options.HighAccuracyEstimates = 1
+	rr.Options.ReturnAllRates = 1
+	rr.Options.ExpectedShipDate = time.Now().Add(24 * time.Hour).Format("2006-01-02")
+	rr.Order.ShipTo.Address1 = req.To.Line1
+	rr.Order.ShipTo.Address2 = req.To.Line2
+	rr.Order.ShipTo.City = req.To.City
+	rr.Order.ShipTo.State = req.To.State
+	rr.Order.ShipTo.PostalCode = req.To.PostalCode
+	rr.Order.ShipTo.Country = req.To.Country
+	if req.To.Company != "" && !req.To.Residential {
+		rr.Order.ShipTo.IsCommercial = 1
+	}
+	rr.Order.Items = items(req)
+
+	var res RateResponse
+	if _, err := p.client(ctx).Request("POST", ".1/rate", rr, &res); err != nil {
+		return nil, err
+	}
+	if res.Status >= 300 {
+		return nil, fmt.Errorf("shipwire: rate: %s", res.Message)
+	}
+
+	var rates []fulfillment.Rate
+	for _, warehouse := range res.Resource {
+		for _, o := range warehouse.ShippingOptions {
+			cur := currency.Type(o.Cost.Currency)
+			if cur == "" {
+				cur = req.Currency
+			}
+			amount, err := cur.Parse(strconv.FormatFloat(o.Cost.Amount, 'f', -1, 64))
+			if err != nil {
+				return nil, fmt.Errorf("shipwire: rate %s: %w", o.ServiceLevel, err)
+			}
+			rate := fulfillment.Rate{
+				Provider:    fulfillmentTypeName,
+				Carrier:     o.Carrier.Code,
+				Service:     o.ServiceLevel,
+				Name:        o.Carrier.Description,
+				Amount:      amount,
+				Currency:    cur,
+				DeliveredBy: o.ExpectedDeliveryMaxDate.Time,
+			}
+			if !o.ExpectedShipDate.IsZero() {
+				rate.MinDays = days(o.ExpectedShipDate.Time, o.ExpectedDeliveryMinDate.Time)
+				rate.MaxDays = days(o.ExpectedShipDate.Time, o.ExpectedDeliveryMaxDate.Time)
+			}
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+func days(from, to time.Time) int {
+	if to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return int(to.Sub(from).Hours()+23) / 24
+}
+
+// CreateShipment has Shipwire ship req, at the service level req names.
+func (p *Provider) CreateShipment(ctx context.Context, req *fulfillment.Request) (*fulfillment.Shipment, error) {
+	or := OrderRequest{}
+	or.CommerceName = "Hanzo"
+	or.ExternalID = req.Reference
+	or.OrderNo = strconv.Itoa(req.Number)
+	or.Options.ServiceLevelCode = ServiceLevelCode(req.Service)
+	if or.Options.ServiceLevelCode == "" {
+		or.Options.ServiceLevelCode = DomesticGround
+	}
+	or.ShipTo.Name = req.To.Name
+	or.ShipTo.Email = req.To.Email
+	or.ShipTo.Address1 = req.To.Line1
+	or.ShipTo.Address2 = req.To.Line2
+	or.ShipTo.City = req.To.City
+	or.ShipTo.State = req.To.State
+	or.ShipTo.PostalCode = req.To.PostalCode
+	or.ShipTo.Country = req.To.Country
+	or.Items = items(req)
+
+	o := Order{}
+	if _, err := p.client(ctx).Resource("POST", "/orders", or, &o); err != nil {
+		return nil, err
+	}
+	return &fulfillment.Shipment{
+		Id:      strconv.Itoa(o.ID),
+		Carrier: o.Options.Resource.CarrierCode,
+		Service: o.Options.Resource.ServiceLevelCode,
+	}, nil
+}
+
+// CancelShipment cancels the Shipwire order, which it can until the
+// warehouse has started on it.
+func (p *Provider) CancelShipment(ctx context.Context, id string) error {
+	_, err := p.client(ctx).Resource("POST", "/orders/"+id+"/cancel", nil, nil)
+	return err
+}
+
+// Track is the trackings of the Shipwire order, one per piece shipped.
+func (p *Provider) Track(ctx context.Context, id string) (*fulfillment.Tracking, error) {
+	res, err := p.client(ctx).Resource("GET", "/orders/"+id+"/trackings", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &fulfillment.Tracking{}
+	for _, item := range res.Resource.Items {
+		var trk Tracking
+		if err := json.DecodeBytes(item.Resource, &trk); err != nil {
+			return nil, err
+		}
+		t.Labels = append(t.Labels, fulfillmentmodel.FulfillmentLabel{TrackingNumber: trk.Tracking, TrackingUrl: trk.Url})
+		t.Events = append(t.Events, events(trk)...)
+	}
+	for _, e := range t.Events {
+		t.Status = later(t.Status, e.Status)
+	}
+	return t, nil
+}
+
+// events is what a Shipwire tracking says happened, which is the dates of
+// the label, the first scan and the delivery.
+func events(trk Tracking) []fulfillmentmodel.FulfillmentEvent {
+	var out []fulfillmentmodel.FulfillmentEvent
+	add := func(status fulfillmentmodel.TrackingStatus, at time.Time, description, location string) {
+		if !at.IsZero() {
+			out = append(out, fulfillmentmodel.FulfillmentEvent{TrackingNumber: trk.Tracking, Status: status, Description: description, Location: location, At: at})
+		}
+	}
+	add(fulfillmentmodel.LabelCreated, trk.LabelCreatedDate.Time, "Label created", "")
+	add(fulfillmentmodel.InTransit, trk.FirstScanDate.Time, trk.Summary, trk.FirstScanRegion+" "+trk.FirstScanCountry)
+	add(fulfillmentmodel.Delivered, trk.DeliveredDate.Time, "Delivered", trk.DeliveryCity+" "+trk.DeliveryCountry)
+	return out
+}
+
+// later is whichever of two statuses a parcel reaches later.
+func later(a, b fulfillmentmodel.TrackingStatus) fulfillmentmodel.TrackingStatus {
+	rank := map[fulfillmentmodel.TrackingStatus]int{
+		fulfillmentmodel.LabelCreated:   1,
+		fulfillmentmodel.InTransit:      2,
+		fulfillmentmodel.OutForDelivery: 3,
+		fulfillmentmodel.Delivered:      4,
+	}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// CreateReturnLabel creates a Shipwire return of the order, with a prepaid
+// label Shipwire emails the customer.
+func (p *Provider) CreateReturnLabel(ctx context.Context, shipment string, req *fulfillment.Request) (*fulfillment.Shipment, error) {
+	id, err := strconv.Atoi(shipment)
+	if err != nil {
+		return nil, fmt.Errorf("shipwire: order id %q: %w", shipment, err)
+	}
+	rr := ReturnRequest{}
+	rr.ExternalID = req.Reference
+	rr.OriginalOrder.ID = id
+	rr.Options.GeneratePrepaidLabel = 1
+	rr.Options.EmailCustomer = 1
+	rr.Items = items(req)
+
+	r := Return{}
+	if _, err := p.client(ctx).Resource("POST", "/returns", rr, &r); err != nil {
+		return nil, err
+	}
+	return &fulfillment.Shipment{Id: strconv.Itoa(r.ID)}, nil
+}
@@ -42,6 +42,18 @@ func New(c *zip.Ctx, username, password string) *Client {
 	}
 }
 
+// NewClient is a client for use outside a request handler, as a
+// fulfillment provider is.
+func NewClient(ctx context.Context, username, password string) *Client {
+	return &Client{
+		Username: username,
+		Password: password,
+		Endpoint: "https://api.shipwire.com/api/v3",
+		client:   &http.Client{Timeout: 30 * time.Second},
+		ctx:      ctx,
+	}
+}
+
 func (c *Client) Request(method, url string, body interface{}, dst interface{}) (*http.Response, error) {
 	var data *bytes.Buffer
 
@@ -94,7 +106,9 @@ func (c *Client) Resource(method, url string, body interface{}, dst interface{})
 	r, err := c.Request(method, url, body, &res)
 
 	// Shipwire does not always provide a status
-	res.Status = r.StatusCode
+	if r != nil {
+		res.Status = r.StatusCode
+	}
 
 	// Request failed
 	if err != nil {
@@ -4,6 +4,14 @@ type Sender interface {
 	Send(message *Message) error
 }
 
+// IdSender is a Sender that can say what the provider calls the message it
+// sent, so a delivery can be matched to the provider's events about it
+// (bounces, opens) later.
+type IdSender interface {
+	Sender
+	SendId(message *Message) (string, error)
+}
+
 type Marketer interface {
 	Subscribe(l *List, s *Subscriber) error
 }
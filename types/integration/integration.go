@@ -10,9 +10,9 @@ import (
 // StripeConnectToken holds legacy Stripe Connect OAuth credentials.
 // Retained for backward compatibility with stored data.
 type StripeConnectToken struct {
-	AccessToken    string `json:"accessToken,omitempty"`
+	AccessToken    string `json:"accessToken,omitempty" audit:"redact"`
 	PublishableKey string `json:"publishableKey,omitempty"`
-	RefreshToken   string `json:"refreshToken,omitempty"`
+	RefreshToken   string `json:"refreshToken,omitempty" audit:"redact"`
 	UserId         string `json:"userId,omitempty"`
 	Livemode       bool   `json:"livemode,omitempty"`
 	Scope          string `json:"scope,omitempty"`
@@ -47,6 +47,7 @@ const (
 	SecurityTokenType Type = "securityToken"
 	WireTransferType  Type = "wireTransfer"
 	SendGridType      Type = "sendgrid"
+	ShipStationType   Type = "shipstation"
 	ShipwireType      Type = "shipwire"
 	SMTPRelayType     Type = "smtprelay"
 	StripeType        Type = "stripe"
@@ -112,30 +113,30 @@ type AnalyticsSentry struct {
 // Mailchimp settings
 type Mailchimp struct {
 	ListId      string `json:"listId,omitempty"`
-	APIKey      string `json:"apiKey,omitempty"`
+	APIKey      string `json:"apiKey,omitempty" audit:"redact"`
 	CheckoutUrl string `json:"checkoutUrl,omitempty"`
 }
 
 // Mandrill settings
 type Mandrill struct {
-	APIKey string `json:"apiKey,omitempty"`
+	APIKey string `json:"apiKey,omitempty" audit:"redact"`
 }
 
 // Mercury bank connection
 type Mercury struct {
-	APIToken      string `json:"apiToken,omitempty"`
-	WebhookSecret string `json:"webhookSecret,omitempty"`
+	APIToken      string `json:"apiToken,omitempty" audit:"redact"`
+	WebhookSecret string `json:"webhookSecret,omitempty" audit:"redact"`
 	AccountID     string `json:"accountId,omitempty"`
 }
 
 // SendGrid settings
 type SendGrid struct {
-	APIKey string `json:"apiKey,omitempty"`
+	APIKey string `json:"apiKey,omitempty" audit:"redact"`
 }
 
 // Netlify settings
 type Netlify struct {
-	AccessToken string    `json:"accessToken,omitempty"`
+	AccessToken string    `json:"accessToken,omitempty" audit:"redact"`
 	CreatedAt   time.Time `json:"createdAt,omitempty"`
 	Email       string    `json:"email,omitempty"`
 	Id          string    `json:"id,omitempty"`
@@ -147,15 +148,15 @@ type Paypal struct {
 	Live struct {
 		Email             string `json:"email,omitempty"`
 		SecurityUserId    string `json:"securityUserId,omitempty"`
-		SecurityPassword  string `json:"securityPassword,omitempty" datastore:",noindex"`
-		SecuritySignature string `json:"SecuritySignature,omitempty" datastore:",noindex"`
+		SecurityPassword  string `json:"securityPassword,omitempty" datastore:",noindex" audit:"redact"`
+		SecuritySignature string `json:"SecuritySignature,omitempty" datastore:",noindex" audit:"redact"`
 		ApplicationId     string `json:"applicationId,omitempty"`
 	} `json:"live,omitempty"`
 	Test struct {
 		Email             string `json:"email,omitempty"`
 		SecurityUserId    string `json:"securityUserId,omitempty"`
-		SecurityPassword  string `json:"securityPassword,omitempty" datastore:",noindex"`
-		SecuritySignature string `json:"SecuritySignature,omitempty" datastore:",noindex"`
+		SecurityPassword  string `json:"securityPassword,omitempty" datastore:",noindex" audit:"redact"`
+		SecuritySignature string `json:"SecuritySignature,omitempty" datastore:",noindex" audit:"redact"`
 		ApplicationId     string `json:"applicationId,omitempty"`
 	} `json:"test,omitempty"`
 
@@ -166,7 +167,7 @@ type Paypal struct {
 // Plaid keys
 type Plaid struct {
 	ClientId  string `json:"clientId,omitempty"`
-	Secret    string `json:"secret,omitempty" datastore:",noindex"`
+	Secret    string `json:"secret,omitempty" datastore:",noindex" audit:"redact"`
 	PublicKey string `json:"pubKey,omitempty"`
 }
 
@@ -177,35 +178,42 @@ type Affiliate struct {
 }
 
 type Reamaze struct {
-	Secret string `json:"secret,omitempty"`
+	Secret string `json:"secret,omitempty" audit:"redact"`
 }
 
 type Recaptcha struct {
 	Enabled   bool   `json:"enabled,omitempty"`
-	SecretKey string `json:"secretKey,omitempty"`
+	SecretKey string `json:"secretKey,omitempty" audit:"redact"`
 }
 
 // Salesforce settings
 type Salesforce struct {
-	AccessToken        string `json:"accessToken,omitempty"`
+	AccessToken        string `json:"accessToken,omitempty" audit:"redact"`
 	DefaultPriceBookId string `json:"defaultPriceBookId,omitempty"`
 	// personalized login url
 	Id           string `json:"id,omitempty"`
 	InstanceUrl  string `json:"instanceUrl,omitempty"`
 	IssuedAt     string `json:"issuedAt,omitempty"`
-	RefreshToken string `json:"refreshToken,omitempty"`
-	Signature    string `json:"signature,omitempty" datastore:",noindex"`
+	RefreshToken string `json:"refreshToken,omitempty" audit:"redact"`
+	Signature    string `json:"signature,omitempty" datastore:",noindex" audit:"redact"`
 }
 
 type Shipwire struct {
 	Username string `json:"username,omitempty"`
-	Password string `json:"password,omitempty"`
+	Password string `json:"password,omitempty" audit:"redact"`
+}
+
+// ShipStation API credentials, for buying labels and tracking through its
+// REST API; the order export ShipStation polls authenticates as a user.
+type ShipStation struct {
+	ApiKey    string `json:"apiKey,omitempty" audit:"redact"`
+	ApiSecret string `json:"apiSecret,omitempty" audit:"redact"`
 }
 
 // SMTP settings
 type SMTPRelay struct {
 	Username string   `json:"username"`
-	Password string   `json:"password"`
+	Password string   `json:"password" audit:"redact"`
 	Host     string   `json:"host"`
 	Port     string   `json:"port"`
 	MailFrom string   `json:"mailFrom"`
@@ -217,9 +225,9 @@ type SMTPRelay struct {
 // Retained for backward compatibility with stored organization data.
 type Stripe struct {
 	// For convenience duplicated
-	AccessToken    string `json:"accessToken,omitempty"`
+	AccessToken    string `json:"accessToken,omitempty" audit:"redact"`
 	PublishableKey string `json:"publishableKey,omitempty"`
-	RefreshToken   string `json:"refreshToken,omitempty"`
+	RefreshToken   string `json:"refreshToken,omitempty" audit:"redact"`
 	UserId         string `json:"userId,omitempty"`
 
 	// Save entire live and test tokens
@@ -230,12 +238,12 @@ type Stripe struct {
 // Square connection
 type SquareConnection struct {
 	ApplicationId string `json:"applicationId,omitempty"`
-	AccessToken   string `json:"accessToken,omitempty"`
+	AccessToken   string `json:"accessToken,omitempty" audit:"redact"`
 	LocationId    string `json:"locationId,omitempty"`
 }
 
 type Square struct {
-	WebhookSignatureKey string `json:"webhookSignatureKey,omitempty"`
+	WebhookSignatureKey string `json:"webhookSignatureKey,omitempty" audit:"redact"`
 	// WebhookURL is the notification URL registered for this org's Square
 	// webhook subscription. Square signs deliveries over (WebhookURL +
 	// rawBody); when empty the deployment falls back to SQUARE_WEBHOOK_URL
@@ -260,9 +268,9 @@ type WireTransfer struct {
 
 // Adyen connection
 type Adyen struct {
-	APIKey          string `json:"apiKey,omitempty" datastore:",noindex"`
+	APIKey          string `json:"apiKey,omitempty" datastore:",noindex" audit:"redact"`
 	MerchantAccount string `json:"merchantAccount,omitempty"`
-	HMACKey         string `json:"hmacKey,omitempty" datastore:",noindex"`
+	HMACKey         string `json:"hmacKey,omitempty" datastore:",noindex" audit:"redact"`
 	Environment     string `json:"environment,omitempty"` // "test" or "live"
 	LiveURLPrefix   string `json:"liveUrlPrefix,omitempty"`
 }
@@ -271,29 +279,29 @@ type Adyen struct {
 type Braintree struct {
 	MerchantID  string `json:"merchantId,omitempty"`
 	PublicKey   string `json:"publicKey,omitempty"`
-	PrivateKey  string `json:"privateKey,omitempty" datastore:",noindex"`
+	PrivateKey  string `json:"privateKey,omitempty" datastore:",noindex" audit:"redact"`
 	Environment string `json:"environment,omitempty"` // "sandbox" or "production"
 }
 
 // Recurly connection
 type Recurly struct {
-	APIKey    string `json:"apiKey,omitempty" datastore:",noindex"`
+	APIKey    string `json:"apiKey,omitempty" datastore:",noindex" audit:"redact"`
 	Subdomain string `json:"subdomain,omitempty"`
 }
 
 // LemonSqueezy connection
 type LemonSqueezy struct {
-	APIKey           string `json:"apiKey,omitempty" datastore:",noindex"`
+	APIKey           string `json:"apiKey,omitempty" datastore:",noindex" audit:"redact"`
 	StoreID          string `json:"storeId,omitempty"`
-	WebhookSecret    string `json:"webhookSecret,omitempty" datastore:",noindex"`
+	WebhookSecret    string `json:"webhookSecret,omitempty" datastore:",noindex" audit:"redact"`
 	DefaultVariantID string `json:"defaultVariantId,omitempty"`
 }
 
 // Authorize.net connection
 type AuthorizeNetConnection struct {
 	LoginId        string `json:"loginId,omitempty"`
-	TransactionKey string `json:"transactionKey,omitempty"`
-	Key            string `json:"key,omitempty"`
+	TransactionKey string `json:"transactionKey,omitempty" audit:"redact"`
+	Key            string `json:"key,omitempty" audit:"redact"`
 }
 
 type AuthorizeNet struct {
@@ -341,7 +349,7 @@ type Integration struct {
 	Enabled   bool            `json:"enabled,omitempty"`
 	Show      bool            `json:"show,omitempty"`
 	Id        string          `json:"id,omitempty"`
-	Data      json.RawMessage `json:"data,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty" audit:"redact"`
 	CreatedAt time.Time       `json:"createdAt,omitempty"`
 	UpdatedAt time.Time       `json:"updatedAt,omitempty"`
 
@@ -366,6 +374,7 @@ type Integration struct {
 	Reamaze       Reamaze       `json:"-"`
 	Recaptcha     Recaptcha     `json:"-"`
 	Salesforce    Salesforce    `json:"-"`
+	ShipStation   ShipStation   `json:"-"`
 	Shipwire      Shipwire      `json:"-"`
 	SendGrid      SendGrid      `json:"-"`
 	SMTPRelay     SMTPRelay     `json:"-"`
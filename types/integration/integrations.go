@@ -61,6 +61,8 @@ func Encode(src *Integration, dst *Integration) error {
 		dst.Data = json.EncodeBytes(src.Salesforce)
 	case SecurityTokenType:
 		dst.Data = json.EncodeBytes(src.SecurityToken)
+	case ShipStationType:
+		dst.Data = json.EncodeBytes(src.ShipStation)
 	case ShipwireType:
 		dst.Data = json.EncodeBytes(src.Shipwire)
 	case StripeType:
@@ -127,6 +129,8 @@ func Decode(src *Integration, dst *Integration) error {
 		dst.Salesforce = src.Salesforce
 	case SecurityTokenType:
 		dst.SecurityToken = src.SecurityToken
+	case ShipStationType:
+		dst.ShipStation = src.ShipStation
 	case ShipwireType:
 		dst.Shipwire = src.Shipwire
 	case StripeType:
@@ -180,6 +184,8 @@ func Decode(src *Integration, dst *Integration) error {
 			json.DecodeBytes(src.Data, &dst.Salesforce)
 		case SecurityTokenType:
 			json.DecodeBytes(src.Data, &dst.SecurityToken)
+		case ShipStationType:
+			json.DecodeBytes(src.Data, &dst.ShipStation)
 		case ShipwireType:
 			json.DecodeBytes(src.Data, &dst.Shipwire)
 		case StripeType:
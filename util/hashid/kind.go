@@ -207,6 +207,26 @@ var kinds = map[string]int{
 	// touched this path, which is why it survived — there was no way to get a
 	// first row in.
 	"auto-recharge": 290,
+
+	// One attempt to deliver a webhook, kept for replay (api/webhook).
+	"webhook-delivery": 292,
+
+	// A shopper's way through checkout, cart to order (checkout/session).
+	"checkout-session": 293,
+
+	// How a notification is worded, and what a customer opted out of (notify).
+	"notificationtemplate":   294,
+	"notificationpreference": 295,
+
+	// The roles an org member or API key holds (rbac).
+	"roleassignment": 296,
+
+	// The runs of the scheduler's recurring jobs (scheduler).
+	"jobrun": 297,
+
+	// An order's charge to a promotion's campaign budget, once per order and
+	// promotion (promotion/engine.Redeem).
+	"promotion-redemption": 298,
 }
 
 var kindsReversed = make(map[int]string)
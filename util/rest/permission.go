@@ -138,6 +138,36 @@ var DefaultPermissions = map[string]Permissions{
 		"list":   masks(Admin, Referrer),
 	},
 
+	// Who may do what is an admin's to read and change. A caller with roles
+	// is held to those instead (see rbac.Builtin): an admin role reads them,
+	// and only an owner changes them.
+	"apipermission": Permissions{
+		"create": masks(Admin),
+		"delete": masks(Admin),
+		"patch":  masks(Admin),
+		"update": masks(Admin),
+		"get":    masks(Admin),
+		"list":   masks(Admin),
+	},
+
+	"role": Permissions{
+		"create": masks(Admin),
+		"delete": masks(Admin),
+		"patch":  masks(Admin),
+		"update": masks(Admin),
+		"get":    masks(Admin),
+		"list":   masks(Admin),
+	},
+
+	"roleassignment": Permissions{
+		"create": masks(Admin),
+		"delete": masks(Admin),
+		"patch":  masks(Admin),
+		"update": masks(Admin),
+		"get":    masks(Admin),
+		"list":   masks(Admin),
+	},
+
 	"return": Permissions{
 		"create": masks(Admin, WriteReturn),
 		"delete": masks(Admin, WriteReturn),
@@ -12,6 +12,7 @@ import (
 	"github.com/hanzoai/commerce/log"
 	"github.com/hanzoai/commerce/middleware"
 	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/rbac"
 	"github.com/hanzoai/commerce/util/json"
 	"github.com/hanzoai/commerce/util/json/http"
 	"github.com/hanzoai/commerce/util/nscontext"
@@ -167,10 +168,14 @@ func (r *Rest) Route(api zip.Router, mw ...zip.Handler) {
 		r.Permissions = DefaultPermissions[r.Kind]
 	}
 
-	// Add default routes
+	// Add default routes, each gated on the caller's roles once its token
+	// has been checked. A handler a package swapped in for a default one is
+	// held to them as well as the generic handlers, which check again.
+	resource := r.resource()
 	for _, route := range r.defaultRoutes() {
 		// log.Debug("%-7s %v", route.method, prefix+route.url)
-		handle(group, route.method, route.url, append(mw, route.handlers...)...)
+		handlers := append(append([]zip.Handler{}, mw...), middleware.Authorize(resource, rbac.ActionFor(route.method, route.url)))
+		handle(group, route.method, route.url, append(handlers, route.handlers...)...)
 	}
 
 	// Custom sub-routes keep their OWN handler chain (each already carries the
@@ -187,18 +192,58 @@ func (r *Rest) Route(api zip.Router, mw ...zip.Handler) {
 	// b2b Accept/Reject/Approve, wallet Send, transaction Create/Hold, wire
 	// Credit. That is stricter and more precise than propagating the base gate,
 	// and it works on the IAM path where TokenRequired(Admin) no-ops.
+	//
+	// Roles do reach them: each is checked against the caller's roles as
+	// <resource>:<verb> ("payment:refund" for POST /:paymentid/refund), by a
+	// gate just ahead of its handler, after whatever auth its chain runs.
 	for _, routes := range r.routes {
 		for _, route := range routes {
 			// log.Debug("%-7s %v", route.method, prefix+route.url)
-			handle(group, route.method, route.url, route.handlers...)
+			if len(route.handlers) == 0 {
+				continue
+			}
+			handlers := make([]zip.Handler, 0, len(route.handlers)+1)
+			handlers = append(handlers, route.handlers[:len(route.handlers)-1]...)
+			handlers = append(handlers, middleware.Authorize(resource, rbac.ActionFor(route.method, route.url)))
+			handlers = append(handlers, route.handlers[len(route.handlers)-1])
+			handle(group, route.method, route.url, handlers...)
 		}
 	}
 }
 
+// resource is what the caller's roles name this API by: its kind, or for a
+// group of custom routes the last segment of its prefix ("tax" for /tax).
+func (r Rest) resource() string {
+	if r.Kind != "" {
+		return r.Kind
+	}
+	prefix := strings.Trim(r.Prefix, "/")
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		prefix = prefix[i+1:]
+	}
+	return prefix
+}
+
 // CheckPermissions renders a 403 and returns false when the token lacks
 // permission for method; the render is a side-effect (the response is written),
 // so a denied handler just returns nil.
+//
+// A caller with roles is held to them instead: the method is checked as
+// <kind>:read, write or delete, and the token's permissions are not
+// consulted.
 func (r Rest) CheckPermissions(c *zip.Ctx, method string) bool {
+	d, err := middleware.Authorization(c, r.resource(), rbac.ActionForMethod(method))
+	if err != nil {
+		r.Fail(c, 500, "Failed to load roles", err)
+		return false
+	}
+	if d.Enforced {
+		if !d.Allowed {
+			r.Fail(c, 403, d.Reason, errors.New(d.Reason))
+		}
+		return d.Allowed
+	}
+
 	// Get permissions of current token
 	tok := middleware.GetPermissions(c)
 
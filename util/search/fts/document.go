@@ -0,0 +1,174 @@
+package fts
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// saver is a search document that lays out its own fields and facets, as
+// every model's Document does through mixin.DocumentSaveLoad.
+type saver interface {
+	Save() ([]mixin.SearchField, *mixin.SearchDocumentMetadata, error)
+}
+
+// parts is a document as the index stores it.
+type parts struct {
+	json   []byte
+	body   string
+	facets []facetRow
+}
+
+type facetRow struct {
+	name  string
+	value string
+	num   *float64
+}
+
+// extract takes doc apart. A saver's fields are its text and its facets are
+// its facets. Anything else is indexed on the strings and numbers at the top
+// of its JSON, and has no facets.
+func extract(doc interface{}) (*parts, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("fts: encode document: %w", err)
+	}
+	p := &parts{json: raw}
+
+	s, ok := doc.(saver)
+	if !ok {
+		var top map[string]interface{}
+		if err := json.Unmarshal(raw, &top); err != nil {
+			return nil, fmt.Errorf("fts: document is not an object: %w", err)
+		}
+		keys := make([]string, 0, len(top))
+		for k := range top {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var words []string
+		for _, k := range keys {
+			words = append(words, textOf(top[k])...)
+		}
+		p.body = strings.Join(words, " ")
+		return p, nil
+	}
+
+	// A document's codec lives in an unexported field; one built without
+	// Init has none, and Save would panic on it.
+	if g, ok := doc.(interface{ GetDocument() reflect.Value }); ok && !g.GetDocument().IsValid() {
+		if in, ok := doc.(interface{ Init() }); ok {
+			in.Init()
+		}
+	}
+	fields, meta, err := s.Save()
+	if err != nil {
+		return nil, fmt.Errorf("fts: save document: %w", err)
+	}
+	var words []string
+	for _, f := range fields {
+		words = append(words, textOf(f.Value)...)
+	}
+	p.body = strings.Join(words, " ")
+	if meta != nil {
+		for _, f := range meta.Facets {
+			if row, ok := facetOf(f.Name, f.Value); ok {
+				p.facets = append(p.facets, row)
+			}
+		}
+	}
+	return p, nil
+}
+
+// terms is the distinct words of the document's text, its contribution to
+// the index's vocabulary.
+func (p *parts) terms() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, w := range strings.Fields(p.body) {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// textOf is what the full-text index sees of a field: the words of a string,
+// and a whole number as its digits, so an order is found by its number.
+// Fractions are amounts, which nobody types into a search box.
+func textOf(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return tokens(v)
+	case search.Atom:
+		return tokens(string(v))
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) && math.Abs(v) < 1e15 {
+			return []string{strconv.FormatInt(int64(v), 10)}
+		}
+	case int:
+		return []string{strconv.Itoa(v)}
+	case int64:
+		return []string{strconv.FormatInt(v, 10)}
+	}
+	return nil
+}
+
+func facetOf(name string, v interface{}) (facetRow, bool) {
+	row := facetRow{name: facetName(name)}
+	switch v := v.(type) {
+	case string:
+		row.value = v
+	case search.Atom:
+		row.value = string(v)
+	case bool:
+		row.value = strconv.FormatBool(v)
+	case float64:
+		row.value, row.num = formatNum(v), &v
+	case int:
+		n := float64(v)
+		row.value, row.num = formatNum(n), &n
+	case int64:
+		n := float64(v)
+		row.value, row.num = formatNum(n), &n
+	default:
+		return row, false
+	}
+	return row, row.value != ""
+}
+
+func formatNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// facetName is the name a facet is stored and refined under. Documents name
+// their Kind facet after the field ("Kind") and every other facet in
+// camelCase ("paymentStatus"), and callers refine on "kind", so the first
+// letter is lowered on the way in and on the way out.
+func facetName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	if n == 0 || !unicode.IsUpper(r) {
+		return name
+	}
+	return string(unicode.ToLower(r)) + name[n:]
+}
+
+// tokens splits s into lowercase runs of letters and digits. Documents and
+// queries go through it alike, so "jane.doe@example.com" is four words in
+// both, and a query can hold nothing that means anything to FTS5 or
+// to_tsquery.
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,331 @@
+// Package fts is the built-in search.Backend. It keeps its indexes in the
+// store of the org being searched — the same per-org database its orders and
+// users live in — as a SQLite FTS5 table, or as a tsvector column with a GIN
+// index when that store is Postgres, so search works with nothing running
+// beside commerce.
+//
+// Every document is stored three ways: its JSON, which Iterator.Next and
+// Index.Get decode back into the caller's document type; its text, reduced to
+// lowercase words (see tokens), which the full-text index matches and ranks;
+// and its facets, one row per value, which refinements filter on and facet
+// counts group by.
+//
+// Queries are words, all of which must match, each as a prefix: "jo smi"
+// finds John Smith. Results are ranked by relevance (bm25 on SQLite, ts_rank
+// on Postgres); an empty query lists the index newest first. A fuzzy search
+// also finds "jhon smith", by correcting each word that matches nothing to
+// the nearest word in the index's vocabulary.
+package fts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// ErrNoStore is returned when the context's namespace has no store to keep an
+// index in: a reserved namespace, or an org the store resolver refused.
+var ErrNoStore = errors.New("fts: no store for this namespace")
+
+// Backend opens indexes in the store of each call's namespace.
+type Backend struct {
+	store func(ctx context.Context) db.DB
+
+	mu       sync.Mutex
+	migrated map[string]bool
+}
+
+// New returns a Backend over each org's own store, as datastore.NewNamespaced
+// resolves it.
+func New() *Backend {
+	return NewWithStore(func(ctx context.Context) db.DB {
+		return datastore.NewNamespaced(ctx).DB()
+	})
+}
+
+// NewWithStore returns a Backend that keeps its indexes in whatever store
+// returns for a call's context. The store must offer db.SQLStore.
+func NewWithStore(store func(ctx context.Context) db.DB) *Backend {
+	return &Backend{store: store, migrated: make(map[string]bool)}
+}
+
+// Open returns the index called name. Nothing is touched until it is used.
+func (b *Backend) Open(name string) (search.Index, error) {
+	return &index{b: b, name: name}, nil
+}
+
+// Close is a no-op: the stores belong to the db layer.
+func (b *Backend) Close() error { return nil }
+
+// Drop empties the index called name in ctx's namespace. Reindexing drops the
+// index first so documents whose models are gone go with it.
+func (b *Backend) Drop(ctx context.Context, name string) error {
+	s, err := b.open(ctx)
+	if err != nil {
+		return err
+	}
+	return s.WriteSQL(ctx, func(tx *sql.Tx) error {
+		if !s.postgres {
+			if _, err := s.exec(ctx, tx, `DELETE FROM search_fts WHERE rowid IN (SELECT seq FROM search_docs WHERE ns = ? AND idx = ?)`, s.ns, name); err != nil {
+				return err
+			}
+		}
+		if _, err := s.exec(ctx, tx, `DELETE FROM search_facets WHERE doc IN (SELECT seq FROM search_docs WHERE ns = ? AND idx = ?)`, s.ns, name); err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, tx, `DELETE FROM search_terms WHERE ns = ? AND idx = ?`, s.ns, name); err != nil {
+			return err
+		}
+		_, err := s.exec(ctx, tx, `DELETE FROM search_docs WHERE ns = ? AND idx = ?`, s.ns, name)
+		return err
+	})
+}
+
+// store is a namespace's SQL store, its schema in place.
+type store struct {
+	db.SQLStore
+	postgres bool
+
+	// ns is kept on every row. With a resolver installed each org has a
+	// store to itself and it is redundant; without one (dev, tests) every
+	// org shares the default store, and it is what keeps them apart.
+	ns string
+}
+
+func (b *Backend) open(ctx context.Context) (*store, error) {
+	d := b.store(ctx)
+	if d == nil {
+		return nil, ErrNoStore
+	}
+	sqlStore, ok := d.(db.SQLStore)
+	if !ok {
+		return nil, fmt.Errorf("fts: store %T has no SQL access", d)
+	}
+	s := &store{
+		SQLStore: sqlStore,
+		postgres: sqlStore.SQLDialect() == db.DialectPostgres,
+		ns:       nscontext.GetNamespace(ctx),
+	}
+
+	// The schema is applied once per namespace per process. Holding mu
+	// across it keeps two first writers from racing the DDL.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.migrated[s.ns] {
+		if err := s.migrate(ctx); err != nil {
+			return nil, fmt.Errorf("fts: schema: %w", err)
+		}
+		b.migrated[s.ns] = true
+	}
+	return s, nil
+}
+
+func (s *store) migrate(ctx context.Context) error {
+	schema := sqliteSchema
+	if s.postgres {
+		schema = postgresSchema
+	}
+	return s.WriteSQL(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range schema {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// bind rewrites ? placeholders as $1, $2, ... on Postgres. No statement here
+// has a ? anywhere else.
+func (s *store) bind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (s *store) exec(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(ctx, s.bind(query), args...)
+}
+
+// index is one named index. The namespace comes from each call's context, so
+// one index value serves every org.
+type index struct {
+	b    *Backend
+	name string
+}
+
+// Put stores doc under id, replacing what was there.
+func (ix *index) Put(ctx context.Context, id string, doc interface{}) (string, error) {
+	if id == "" {
+		return "", errors.New("fts: document has no id")
+	}
+	d, err := extract(doc)
+	if err != nil {
+		return "", err
+	}
+	s, err := ix.b.open(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.WriteSQL(ctx, func(tx *sql.Tx) error {
+		var seq int64
+		if err := tx.QueryRowContext(ctx, s.bind(`
+			INSERT INTO search_docs (ns, idx, id, doc, body, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (ns, idx, id) DO UPDATE SET doc = excluded.doc, body = excluded.body, updated_at = excluded.updated_at
+			RETURNING seq`),
+			s.ns, ix.name, id, string(d.json), d.body, time.Now().UnixNano()).Scan(&seq); err != nil {
+			return err
+		}
+
+		// Postgres derives the tsvector from body itself. FTS5 is a table
+		// of its own, keyed by the document's seq.
+		if !s.postgres {
+			if _, err := s.exec(ctx, tx, `DELETE FROM search_fts WHERE rowid = ?`, seq); err != nil {
+				return err
+			}
+			if _, err := s.exec(ctx, tx, `INSERT INTO search_fts (rowid, body) VALUES (?, ?)`, seq, d.body); err != nil {
+				return err
+			}
+		}
+
+		if _, err := s.exec(ctx, tx, `DELETE FROM search_facets WHERE doc = ?`, seq); err != nil {
+			return err
+		}
+		for _, f := range d.facets {
+			if _, err := s.exec(ctx, tx, `INSERT INTO search_facets (doc, name, value, num) VALUES (?, ?, ?, ?)`,
+				seq, f.name, f.value, f.num); err != nil {
+				return err
+			}
+		}
+		for _, t := range d.terms() {
+			if _, err := s.exec(ctx, tx, `INSERT INTO search_terms (ns, idx, term) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+				s.ns, ix.name, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Get decodes the document stored under id into dst.
+func (ix *index) Get(ctx context.Context, id string, dst interface{}) error {
+	s, err := ix.b.open(ctx)
+	if err != nil {
+		return err
+	}
+	var raw []byte
+	err = s.ReadSQL(ctx, func(h *sql.DB) error {
+		return h.QueryRowContext(ctx, s.bind(`SELECT doc FROM search_docs WHERE ns = ? AND idx = ? AND id = ?`),
+			s.ns, ix.name, id).Scan(&raw)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return search.ErrNoSuchDocument
+	}
+	if err != nil {
+		return err
+	}
+	return decode(raw, dst)
+}
+
+// Delete removes the document stored under id. Deleting one that is not there
+// is not an error.
+func (ix *index) Delete(ctx context.Context, id string) error {
+	s, err := ix.b.open(ctx)
+	if err != nil {
+		return err
+	}
+	return s.WriteSQL(ctx, func(tx *sql.Tx) error {
+		var seq int64
+		err := tx.QueryRowContext(ctx, s.bind(`SELECT seq FROM search_docs WHERE ns = ? AND idx = ? AND id = ?`),
+			s.ns, ix.name, id).Scan(&seq)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !s.postgres {
+			if _, err := s.exec(ctx, tx, `DELETE FROM search_fts WHERE rowid = ?`, seq); err != nil {
+				return err
+			}
+		}
+		if _, err := s.exec(ctx, tx, `DELETE FROM search_facets WHERE doc = ?`, seq); err != nil {
+			return err
+		}
+		_, err = s.exec(ctx, tx, `DELETE FROM search_docs WHERE seq = ?`, seq)
+		return err
+	})
+}
+
+// Search runs query against the index. A failure is returned by the
+// iterator's first Next. With opts.Fuzzy, misspelt words are corrected first
+// (see correct).
+func (ix *index) Search(ctx context.Context, query string, opts *search.SearchOptions) search.Iterator {
+	if opts == nil {
+		opts = &search.SearchOptions{}
+	}
+	s, err := ix.b.open(ctx)
+	if err != nil {
+		return &iterator{err: err}
+	}
+	it := &iterator{idsOnly: opts.IDsOnly}
+	err = s.ReadSQL(ctx, func(h *sql.DB) error {
+		if opts.Fuzzy {
+			corrected, err := s.correct(ctx, h, ix.name, query)
+			if err != nil {
+				return err
+			}
+			query = corrected
+		}
+		q, err := compile(s.postgres, s.ns, ix.name, query, opts)
+		if err != nil {
+			return err
+		}
+		return q.run(ctx, s, h, it)
+	})
+	if err != nil {
+		return &iterator{err: err}
+	}
+	return it
+}
+
+// decode fills dst from a stored document. A search document keeps its codec
+// in an unexported field, so one that can is re-initialised to save again.
+func decode(raw []byte, dst interface{}) error {
+	if dst == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("fts: decode document: %w", err)
+	}
+	if d, ok := dst.(interface{ Init() }); ok {
+		d.Init()
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package fts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/commerce/db"
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/util/nscontext"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// testDoc is laid out like the models' documents: a Kind facet named after
+// its field, text fields, and camelCase facets.
+type testDoc struct {
+	mixin.DocumentSaveLoad `datastore:"-" json:"-"`
+
+	Kind string `search:",facet"`
+
+	Id_    string
+	Name   string
+	Email  string
+	Number float64
+
+	StatusOption string  `search:"status,facet"`
+	TotalOption  float64 `search:"total,facet"`
+}
+
+func (d *testDoc) Id() string { return d.Id_ }
+func (d *testDoc) Init()      { d.SetDocument(d) }
+
+func newDoc(kind, id, name, email string, number float64, status string, total float64) *testDoc {
+	d := &testDoc{Kind: kind, Id_: id, Name: name, Email: email, Number: number, StatusOption: status, TotalOption: total}
+	d.Init()
+	return d
+}
+
+func sqliteStore(t *testing.T) db.DB {
+	t.Helper()
+	sdb, err := db.NewSQLiteDB(&db.SQLiteDBConfig{
+		Path:       filepath.Join(t.TempDir(), "search.db"),
+		Config:     db.DefaultConfig().SQLite,
+		TenantID:   "acme",
+		TenantType: "org",
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	t.Cleanup(func() { sdb.Close() })
+	return sdb
+}
+
+// postgresStore is env-gated like the ledger's. Point it at a THROWAWAY
+// database: it empties the search tables before every test.
+func postgresStore(t *testing.T) db.DB {
+	t.Helper()
+	dsn := os.Getenv("COMMERCE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("COMMERCE_TEST_POSTGRES_DSN not set")
+	}
+	pdb, err := db.NewPostgresDB(&db.PostgresDBConfig{
+		DSN:      dsn,
+		TenantID: "acme", TenantType: "org",
+		MaxOpenConns: 4, MaxIdleConns: 4,
+	})
+	if err != nil {
+		t.Fatalf("NewPostgresDB: %v", err)
+	}
+	t.Cleanup(func() { pdb.Close() })
+
+	ctx := context.Background()
+	if _, err := NewWithStore(func(context.Context) db.DB { return pdb }).open(ctx); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	if err := pdb.WriteSQL(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `TRUNCATE search_facets, search_docs`)
+		return err
+	}); err != nil {
+		t.Fatalf("clearing the throwaway search tables: %v", err)
+	}
+	return pdb
+}
+
+// forEachStore runs fn against a Backend over each store the index has SQL
+// for.
+func forEachStore(t *testing.T, fn func(t *testing.T, b *Backend)) {
+	for _, s := range []struct {
+		name  string
+		store func(*testing.T) db.DB
+	}{
+		{"sqlite", sqliteStore},
+		{"postgres", postgresStore},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			store := s.store(t)
+			fn(t, NewWithStore(func(context.Context) db.DB { return store }))
+		})
+	}
+}
+
+func ids(t *testing.T, it search.Iterator) []string {
+	t.Helper()
+	var out []string
+	for {
+		var doc testDoc
+		id, err := it.Next(&doc)
+		if err == search.Done {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if doc.Id() != id {
+			t.Fatalf("Next decoded %q for id %q", doc.Id(), id)
+		}
+		out = append(out, id)
+	}
+}
+
+func putAll(t *testing.T, ctx context.Context, ix search.Index, docs ...*testDoc) {
+	t.Helper()
+	for _, d := range docs {
+		if _, err := ix.Put(ctx, d.Id(), d); err != nil {
+			t.Fatalf("Put %s: %v", d.Id(), err)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	got := tokens("Jane.Doe@Example.com, #1042  Zoë")
+	want := []string{"jane", "doe", "example", "com", "1042", "zoë"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokens = %q, want %q", got, want)
+	}
+}
+
+// Values of one facet are alternatives; different facets all have to hold.
+func TestCompile_Refinements(t *testing.T) {
+	q, err := compile(false, "acme", "everything", "", &search.SearchOptions{
+		Refinements: []search.Facet{
+			{Name: "kind", Value: "order"},
+			{Name: "status", Value: "open"},
+			{Name: "status", Value: search.Atom("paid")},
+			{Name: "total", Value: search.Range{Start: 10, End: 20}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(q.from, "EXISTS"); n != 3 {
+		t.Fatalf("%d EXISTS clauses in %q, want one per facet", n, q.from)
+	}
+	if !strings.Contains(q.from, `f.value = ? OR f.value = ?`) {
+		t.Fatalf("statuses are not alternatives: %q", q.from)
+	}
+	want := []interface{}{"acme", "everything", "kind", "order", "status", "open", "paid", "total", 10.0, 20.0}
+	if !reflect.DeepEqual(q.fromArgs, want) {
+		t.Fatalf("args = %v, want %v", q.fromArgs, want)
+	}
+
+	if _, err := compile(false, "acme", "everything", "", &search.SearchOptions{
+		Sort: &search.SortOptions{Expressions: []search.SortExpression{{Expr: "Total); DROP TABLE search_docs; --"}}},
+	}); err == nil {
+		t.Fatal("sorting on an expression compiled; only field names may be spliced in")
+	}
+}
+
+// Every word is a prefix and all of them must match, and refinements and
+// facets work over what matched.
+func TestIndex_Search(t *testing.T) {
+	forEachStore(t, func(t *testing.T, b *Backend) {
+		ctx := nscontext.WithNamespace(context.Background(), "acme")
+		ix, _ := b.Open(mixin.DefaultIndex)
+		putAll(t, ctx, ix,
+			newDoc("order", "o1", "John Smith", "john@example.com", 1001, "open", 15),
+			newDoc("order", "o2", "Johanna Smithers", "jo@example.com", 1002, "paid", 40),
+			newDoc("order", "o3", "Jack Jones", "jack@example.com", 1003, "paid", 12),
+			newDoc("user", "u1", "John Smith", "john@example.com", 0, "", 0),
+		)
+
+		if got := ids(t, ix.Search(ctx, "jo smi", nil)); len(got) != 3 {
+			t.Fatalf(`"jo smi" found %v, want o1, o2 and u1`, got)
+		}
+		if got := ids(t, ix.Search(ctx, "1003", nil)); !reflect.DeepEqual(got, []string{"o3"}) {
+			t.Fatalf("order number found %v, want [o3]", got)
+		}
+		// Johanna is not a John, and u1 is not an order.
+		if got := ids(t, ix.Search(ctx, "john", &search.SearchOptions{Refinements: []search.Facet{{Name: "kind", Value: "order"}}})); !reflect.DeepEqual(got, []string{"o1"}) {
+			t.Fatalf("john in orders = %v, want [o1]", got)
+		}
+
+		it := ix.Search(ctx, "", &search.SearchOptions{
+			Limit:       1,
+			Refinements: []search.Facet{{Name: "kind", Value: "order"}, {Name: "total", Value: search.Range{Start: 10, End: 20}}},
+			Facets:      []search.FacetSearchOption{{Name: "status"}},
+		})
+		if it.Count() != 2 {
+			t.Fatalf("Count = %d, want the 2 orders totalling 10 to 20", it.Count())
+		}
+		if got := ids(t, it); len(got) != 1 {
+			t.Fatalf("page = %v, want 1 by Limit", got)
+		}
+		facets, err := it.Facets()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := [][]search.FacetResult{{
+			{Name: "status", Value: "open", Count: 1},
+			{Name: "status", Value: "paid", Count: 1},
+		}}
+		if !reflect.DeepEqual(facets, want) {
+			t.Fatalf("facets = %+v, want %+v", facets, want)
+		}
+
+		// Another org's index is another index.
+		other := nscontext.WithNamespace(context.Background(), "globex")
+		if got := ids(t, ix.Search(other, "john", nil)); len(got) != 0 {
+			t.Fatalf("globex found %v in acme's index", got)
+		}
+	})
+}
+
+func TestIndex_PutReplacesAndDeleteRemoves(t *testing.T) {
+	forEachStore(t, func(t *testing.T, b *Backend) {
+		ctx := nscontext.WithNamespace(context.Background(), "acme")
+		ix, _ := b.Open(mixin.DefaultIndex)
+		putAll(t, ctx, ix, newDoc("order", "o1", "John Smith", "", 1001, "open", 15))
+		putAll(t, ctx, ix, newDoc("order", "o1", "Jane Smith", "", 1001, "paid", 15))
+
+		if got := ids(t, ix.Search(ctx, "john", nil)); len(got) != 0 {
+			t.Fatalf("the replaced text still matches: %v", got)
+		}
+		if got := ids(t, ix.Search(ctx, "jane", &search.SearchOptions{Refinements: []search.Facet{{Name: "status", Value: "paid"}}})); !reflect.DeepEqual(got, []string{"o1"}) {
+			t.Fatalf("the new document = %v, want [o1]", got)
+		}
+		var doc testDoc
+		if err := ix.Get(ctx, "o1", &doc); err != nil || doc.Name != "Jane Smith" {
+			t.Fatalf("Get = %+v, %v", doc, err)
+		}
+
+		if err := ix.Delete(ctx, "o1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.Delete(ctx, "o1"); err != nil {
+			t.Fatalf("deleting again: %v", err)
+		}
+		if err := ix.Get(ctx, "o1", &doc); !errors.Is(err, search.ErrNoSuchDocument) {
+			t.Fatalf("Get after Delete: err = %v, want ErrNoSuchDocument", err)
+		}
+		if it := ix.Search(ctx, "", nil); it.Count() != 0 {
+			t.Fatalf("%d documents left after Delete", it.Count())
+		}
+	})
+}
+
+type searchableModel struct{ doc *testDoc }
+
+func (m searchableModel) Document() mixin.Document { return m.doc }
+
+// The hooks index a searchable model on write and drop it on delete, through
+// whatever backend search has.
+func TestInstall_IndexesSearchableModels(t *testing.T) {
+	store := sqliteStore(t)
+	search.SetBackend(NewWithStore(func(context.Context) db.DB { return store }))
+	t.Cleanup(func() { search.SetBackend(nil) })
+
+	ctx := nscontext.WithNamespace(context.Background(), "acme")
+	m := searchableModel{newDoc("order", "o1", "John Smith", "", 1001, "open", 15)}
+	if err := indexer(false)(&hooks.ModelEvent{Kind: "order", Model: m, Context: ctx}); err != nil {
+		t.Fatal(err)
+	}
+	var doc testDoc
+	if err := search.Get(ctx, mixin.DefaultIndex, "o1", &doc); err != nil {
+		t.Fatalf("after create: %v", err)
+	}
+
+	if err := indexer(true)(&hooks.ModelEvent{Kind: "order", Model: m, Context: ctx}); err != nil {
+		t.Fatal(err)
+	}
+	if err := search.Get(ctx, mixin.DefaultIndex, "o1", &doc); !errors.Is(err, search.ErrNoSuchDocument) {
+		t.Fatalf("after delete: err = %v, want ErrNoSuchDocument", err)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"shirt", "shirt", 0},
+		{"shrit", "shirt", 1}, // a transposition is one edit
+		{"shrt", "shirt", 1},
+		{"sneekers", "sneakers", 1},
+		{"snaekrs", "sneakers", 2},
+		{"zoë", "zoe", 1},
+	} {
+		if got := distance(c.a, c.b); got != c.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+	if term, d := nearest("sneek", "sneakers"); term != "sneak" || d != 1 {
+		t.Fatalf(`nearest("sneek", "sneakers") = %q, %d; want the prefix "sneak" at 1`, term, d)
+	}
+}
+
+// A fuzzy search finds through a typo what the plain search cannot, and range
+// facets count every bucket asked for.
+func TestIndex_FuzzyAndRanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, b *Backend) {
+		ctx := nscontext.WithNamespace(context.Background(), "acme")
+		ix, _ := b.Open(mixin.DefaultIndex)
+		putAll(t, ctx, ix,
+			newDoc("order", "o1", "Johnathan Smith", "", 1001, "open", 15),
+			newDoc("order", "o2", "Jack Jones", "", 1002, "paid", 40),
+		)
+
+		if got := ids(t, ix.Search(ctx, "johnatahn", nil)); len(got) != 0 {
+			t.Fatalf("the misspelling matched without Fuzzy: %v", got)
+		}
+		if got := ids(t, ix.Search(ctx, "johnatahn smiht", &search.SearchOptions{Fuzzy: true})); !reflect.DeepEqual(got, []string{"o1"}) {
+			t.Fatalf("fuzzy search = %v, want [o1]", got)
+		}
+		// Too short to correct: "jax" is not taken for "jack".
+		if got := ids(t, ix.Search(ctx, "jax", &search.SearchOptions{Fuzzy: true})); len(got) != 0 {
+			t.Fatalf(`"jax" = %v, want nothing`, got)
+		}
+
+		it := ix.Search(ctx, "", &search.SearchOptions{Facets: []search.FacetSearchOption{{
+			Name:   "total",
+			Ranges: []search.Range{{Start: 0, End: 20}, {Start: 20, End: 50}, {Start: 50, End: math.Inf(1)}},
+		}}})
+		facets, err := it.Facets()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := [][]search.FacetResult{{
+			{Name: "total", Value: search.Range{Start: 0, End: 20}, Count: 1},
+			{Name: "total", Value: search.Range{Start: 20, End: 50}, Count: 1},
+			{Name: "total", Value: search.Range{Start: 50, End: math.Inf(1)}, Count: 0},
+		}}
+		if !reflect.DeepEqual(facets, want) {
+			t.Fatalf("range facets = %+v, want %+v", facets, want)
+		}
+	})
+}
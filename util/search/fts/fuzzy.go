@@ -0,0 +1,134 @@
+package fts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCandidates bounds how much of the vocabulary one word is compared
+// against: the terms sharing its first letter, of which a big catalog has
+// thousands at most.
+const maxCandidates = 5000
+
+// typos is how many edits a word of n letters may be from what it is
+// corrected to. Short words are left alone: one edit turns most of them into
+// another word, and "cat" searched as "car" is not a typo corrected.
+func typos(n int) int {
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	}
+	return 0
+}
+
+// correct rewrites query for a fuzzy search. A word that is the prefix of
+// some word in the index stands, since searching it finds something. One that
+// is not is replaced by the nearest term within typos edits, compared whole
+// and, as the word may still be being typed, by the term's prefix of the
+// word's length; nearest wins, then the shorter term, then the first in
+// order. Candidates share the word's first letter, which people rarely get
+// wrong and which keeps the comparison to a slice of the vocabulary. A word
+// with nothing near enough stands, and finds nothing.
+func (s *store) correct(ctx context.Context, h *sql.DB, name, query string) (string, error) {
+	words := tokens(query)
+	changed := false
+	for i, w := range words {
+		n := utf8.RuneCountInString(w)
+		k := typos(n)
+		if k == 0 {
+			continue
+		}
+
+		var one int
+		err := h.QueryRowContext(ctx, s.bind(`SELECT 1 FROM search_terms WHERE ns = ? AND idx = ? AND term LIKE ? LIMIT 1`),
+			s.ns, name, w+"%").Scan(&one)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+
+		_, size := utf8.DecodeRuneInString(w)
+		rows, err := h.QueryContext(ctx, s.bind(`
+			SELECT term FROM search_terms
+			WHERE ns = ? AND idx = ? AND term LIKE ? AND length(term) >= ?
+			ORDER BY term LIMIT ?`),
+			s.ns, name, w[:size]+"%", n-k, maxCandidates)
+		if err != nil {
+			return "", err
+		}
+		best, bestDist := "", k+1
+		for rows.Next() {
+			var term string
+			if err := rows.Scan(&term); err != nil {
+				rows.Close()
+				return "", err
+			}
+			cand, d := nearest(w, term)
+			if d < bestDist || d == bestDist && len(cand) < len(best) {
+				best, bestDist = cand, d
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		if best != "" {
+			words[i] = best
+			changed = true
+		}
+	}
+	if !changed {
+		return query, nil
+	}
+	return strings.Join(words, " "), nil
+}
+
+// nearest is how far w is from term, whole or as a prefix the length of w,
+// and which of the two is nearer. Searching the prefix still finds term.
+func nearest(w, term string) (string, int) {
+	d := distance(w, term)
+	n := utf8.RuneCountInString(w)
+	if utf8.RuneCountInString(term) > n {
+		prefix := string([]rune(term)[:n])
+		if p := distance(w, prefix); p < d {
+			return prefix, p
+		}
+	}
+	return term, d
+}
+
+// distance is the optimal string alignment distance between a and b: the
+// insertions, deletions, substitutions and transpositions of neighbours that
+// turn one into the other, a transposition counting as one edit since it is
+// the commonest typo there is.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
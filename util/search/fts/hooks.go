@@ -0,0 +1,45 @@
+package fts
+
+import (
+	"github.com/hanzoai/commerce/hooks"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/mixin"
+	"github.com/hanzoai/commerce/util/search"
+)
+
+// Install keeps mixin.DefaultIndex current through r's after-commit model
+// hooks: a searchable model's document is put when the model is created or
+// updated and deleted with it. It indexes through search's default backend,
+// whichever that is.
+//
+// A failure is logged and does not fail the write; the model is saved either
+// way, and `commerce search reindex` rebuilds an index that fell behind.
+func Install(r *hooks.Registry) {
+	r.OnModelAfterCreate(hooks.AnyKind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "search", Func: indexer(false)})
+	r.OnModelAfterUpdate(hooks.AnyKind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "search", Func: indexer(false)})
+	r.OnModelAfterDelete(hooks.AnyKind).Bind(&hooks.Handler[*hooks.ModelEvent]{ID: "search", Func: indexer(true)})
+}
+
+func indexer(deleted bool) func(*hooks.ModelEvent) error {
+	return func(e *hooks.ModelEvent) error {
+		s, ok := e.Model.(mixin.Searchable)
+		if !ok || e.Context == nil {
+			return e.Next()
+		}
+		doc := s.Document()
+		if doc == nil || doc.Id() == "" {
+			return e.Next()
+		}
+
+		var err error
+		if deleted {
+			err = search.Delete(e.Context, mixin.DefaultIndex, doc.Id())
+		} else {
+			_, err = search.Put(e.Context, mixin.DefaultIndex, doc.Id(), doc)
+		}
+		if err != nil {
+			log.Error("search: index %s %s: %v", e.Kind, doc.Id(), err, e.Context)
+		}
+		return e.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package fts
+
+import "github.com/hanzoai/commerce/util/search"
+
+// iterator holds a page of results, read in full when the search ran: a
+// page is at most maxLimit documents, and holding no rows open means an
+// abandoned iterator holds nothing.
+type iterator struct {
+	ids     []string
+	docs    [][]byte
+	count   int
+	facets  [][]search.FacetResult
+	idsOnly bool
+
+	err  error
+	next int
+}
+
+// Next decodes the next document into dst, which may be nil, and returns its
+// id. With IDsOnly it returns the id alone.
+func (it *iterator) Next(dst interface{}) (string, error) {
+	if it.err != nil {
+		return "", it.err
+	}
+	if it.next >= len(it.ids) {
+		return "", search.Done
+	}
+	i := it.next
+	it.next++
+	if !it.idsOnly {
+		if err := decode(it.docs[i], dst); err != nil {
+			return it.ids[i], err
+		}
+	}
+	return it.ids[i], nil
+}
+
+// Count is the number of documents the search matched, of which the page is
+// a part. It is exact.
+func (it *iterator) Count() int { return it.count }
+
+// Facets is one slice per facet, of its values' counts.
+func (it *iterator) Facets() ([][]search.FacetResult, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	return it.facets, nil
+}
@@ -0,0 +1,337 @@
+package fts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/hanzoai/commerce/util/search"
+)
+
+const (
+	// defaultLimit and maxLimit are App Engine search's, which is what
+	// util/search's callers were written against.
+	defaultLimit = 20
+	maxLimit     = 1000
+
+	// defaultFacetValues is how many values a facet returns when its
+	// option does not say.
+	defaultFacetValues = 10
+)
+
+// sortFieldRE is what a sort expression may be: a top-level field of the
+// stored JSON. It is spliced into the SQL, so it is nothing else.
+var sortFieldRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// compiled is a search as SQL: from is the FROM and WHERE that select the
+// matching documents as d, and orderBy ranks them.
+type compiled struct {
+	from      string
+	fromArgs  []interface{}
+	orderBy   string
+	orderArgs []interface{}
+
+	limit, offset int
+	facets        []search.FacetSearchOption
+}
+
+func compile(postgres bool, ns, name, query string, opts *search.SearchOptions) (*compiled, error) {
+	q := &compiled{
+		limit:  defaultLimit,
+		offset: opts.Offset,
+		facets: opts.Facets,
+	}
+	if opts.Limit > 0 {
+		q.limit = min(opts.Limit, maxLimit)
+	}
+	if q.offset < 0 {
+		q.offset = 0
+	}
+
+	var from strings.Builder
+	words := tokens(query)
+	switch {
+	case len(words) == 0:
+		from.WriteString(`search_docs d WHERE d.ns = ? AND d.idx = ?`)
+		q.fromArgs = []interface{}{ns, name}
+		q.orderBy = `d.updated_at DESC`
+	case postgres:
+		match := matchPostgres(words)
+		from.WriteString(`search_docs d WHERE d.tsv @@ to_tsquery('simple', ?) AND d.ns = ? AND d.idx = ?`)
+		q.fromArgs = []interface{}{match, ns, name}
+		q.orderBy = `ts_rank(d.tsv, to_tsquery('simple', ?)) DESC`
+		q.orderArgs = []interface{}{match}
+	default:
+		from.WriteString(`search_docs d JOIN search_fts ON search_fts.rowid = d.seq WHERE search_fts MATCH ? AND d.ns = ? AND d.idx = ?`)
+		q.fromArgs = []interface{}{matchSQLite(words), ns, name}
+		q.orderBy = `bm25(search_fts)`
+	}
+
+	where, args, err := refine(opts.Refinements)
+	if err != nil {
+		return nil, err
+	}
+	from.WriteString(where)
+	q.fromArgs = append(q.fromArgs, args...)
+	q.from = from.String()
+
+	if opts.Sort != nil && len(opts.Sort.Expressions) > 0 {
+		sorts := make([]string, 0, len(opts.Sort.Expressions)+1)
+		for _, e := range opts.Sort.Expressions {
+			s, err := sortBy(postgres, e)
+			if err != nil {
+				return nil, err
+			}
+			sorts = append(sorts, s)
+		}
+		q.orderBy = strings.Join(append(sorts, q.orderBy), ", ")
+	}
+	q.orderBy += `, d.seq DESC`
+	return q, nil
+}
+
+// matchSQLite and matchPostgres make every word a prefix and require them
+// all. tokens has left nothing in a word but letters and digits, so quoting
+// it is enough.
+func matchSQLite(words []string) string {
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+func matchPostgres(words []string) string {
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = w + `:*`
+	}
+	return strings.Join(terms, " & ")
+}
+
+// refine turns refinements into conditions on d. Values of one facet are
+// alternatives and different facets must all hold, as in App Engine: kind=order
+// with two statuses is orders in either status.
+func refine(refinements []search.Facet) (string, []interface{}, error) {
+	var (
+		names []string
+		conds = map[string][]string{}
+		vals  = map[string][]interface{}{}
+	)
+	for _, r := range refinements {
+		name := facetName(r.Name)
+		if name == "" {
+			return "", nil, fmt.Errorf("fts: refinement has no facet name")
+		}
+		var cond string
+		var args []interface{}
+		switch v := r.Value.(type) {
+		case search.Range:
+			cond, args = rangeCond(v)
+		case *search.Range:
+			cond, args = rangeCond(*v)
+		default:
+			row, ok := facetOf(name, v)
+			if !ok {
+				return "", nil, fmt.Errorf("fts: cannot refine %s on a %T", name, r.Value)
+			}
+			cond, args = `f.value = ?`, []interface{}{row.value}
+		}
+		if _, seen := conds[name]; !seen {
+			names = append(names, name)
+		}
+		conds[name] = append(conds[name], cond)
+		vals[name] = append(vals[name], args...)
+	}
+
+	var sb strings.Builder
+	var args []interface{}
+	for _, name := range names {
+		sb.WriteString(` AND EXISTS (SELECT 1 FROM search_facets f WHERE f.doc = d.seq AND f.name = ? AND (`)
+		sb.WriteString(strings.Join(conds[name], " OR "))
+		sb.WriteString(`))`)
+		args = append(args, name)
+		args = append(args, vals[name]...)
+	}
+	return sb.String(), args, nil
+}
+
+// rangeCond is Start <= n < End. An infinite bound is no bound.
+func rangeCond(r search.Range) (string, []interface{}) {
+	conds := []string{`f.num IS NOT NULL`}
+	var args []interface{}
+	if !math.IsInf(r.Start, -1) {
+		conds = append(conds, `f.num >= ?`)
+		args = append(args, r.Start)
+	}
+	if !math.IsInf(r.End, 1) {
+		conds = append(conds, `f.num < ?`)
+		args = append(args, r.End)
+	}
+	return `(` + strings.Join(conds, " AND ") + `)`, args
+}
+
+// sortBy orders on a field of the stored JSON. Documents without the field
+// sort last either way; Default is not supported.
+func sortBy(postgres bool, e search.SortExpression) (string, error) {
+	if !sortFieldRE.MatchString(e.Expr) {
+		return "", fmt.Errorf("fts: cannot sort on %q: only a document field can be sorted on", e.Expr)
+	}
+	expr := `json_extract(d.doc, '$.` + e.Expr + `')`
+	if postgres {
+		expr = `(d.doc -> '` + e.Expr + `')`
+	}
+	if e.Reverse {
+		return expr + ` DESC NULLS LAST`, nil
+	}
+	return expr + ` ASC NULLS LAST`, nil
+}
+
+// run fills it with the page q selects, the total it is a page of and the
+// facet counts over that total.
+func (q *compiled) run(ctx context.Context, s *store, h *sql.DB, it *iterator) error {
+	if err := h.QueryRowContext(ctx, s.bind(`SELECT COUNT(*) FROM `+q.from), q.fromArgs...).Scan(&it.count); err != nil {
+		return err
+	}
+
+	args := append(append(append([]interface{}{}, q.fromArgs...), q.orderArgs...), q.limit, q.offset)
+	rows, err := h.QueryContext(ctx, s.bind(`SELECT d.id, d.doc FROM `+q.from+` ORDER BY `+q.orderBy+` LIMIT ? OFFSET ?`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var doc []byte
+		if err := rows.Scan(&id, &doc); err != nil {
+			return err
+		}
+		it.ids = append(it.ids, id)
+		it.docs = append(it.docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(q.facets) > 0 {
+		facets, err := q.facetCounts(ctx, s, h)
+		if err != nil {
+			return err
+		}
+		it.facets = facets
+	}
+	return nil
+}
+
+// facetCounts counts, for each facet asked for, the matching documents
+// holding each of its values, most common first, or falling in each of its
+// ranges when the option has some. An option without a name asks for the
+// facets most of the matching documents have.
+func (q *compiled) facetCounts(ctx context.Context, s *store, h *sql.DB) ([][]search.FacetResult, error) {
+	matched := `SELECT d.seq FROM ` + q.from
+
+	type want struct {
+		name   string
+		limit  int
+		ranges []search.Range
+	}
+	var wants []want
+	for _, o := range q.facets {
+		limit := o.ValueLimit
+		if limit <= 0 {
+			limit = defaultFacetValues
+		}
+		if o.Name != "" {
+			wants = append(wants, want{facetName(o.Name), limit, o.Ranges})
+			continue
+		}
+
+		discover := o.DiscoveryLimit
+		if discover <= 0 {
+			discover = defaultFacetValues
+		}
+		args := append(append([]interface{}{}, q.fromArgs...), discover)
+		rows, err := h.QueryContext(ctx, s.bind(`
+			SELECT f.name FROM search_facets f WHERE f.doc IN (`+matched+`)
+			GROUP BY f.name ORDER BY COUNT(DISTINCT f.doc) DESC, f.name LIMIT ?`), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			wants = append(wants, want{name: name, limit: limit})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([][]search.FacetResult, 0, len(wants))
+	for _, w := range wants {
+		if len(w.ranges) > 0 {
+			values, err := q.rangeCounts(ctx, s, h, w.name, w.ranges)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, values)
+			continue
+		}
+		args := append(append([]interface{}{w.name}, q.fromArgs...), w.limit)
+		rows, err := h.QueryContext(ctx, s.bind(`
+			SELECT f.value, MAX(f.num), COUNT(DISTINCT f.doc) FROM search_facets f
+			WHERE f.name = ? AND f.doc IN (`+matched+`)
+			GROUP BY f.value ORDER BY COUNT(DISTINCT f.doc) DESC, f.value LIMIT ?`), args...)
+		if err != nil {
+			return nil, err
+		}
+		var values []search.FacetResult
+		for rows.Next() {
+			var value string
+			var num sql.NullFloat64
+			var count int
+			if err := rows.Scan(&value, &num, &count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			r := search.FacetResult{Name: w.name, Value: value, Count: count}
+			if num.Valid {
+				r.Value = num.Float64
+			}
+			values = append(values, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			out = append(out, values)
+		}
+	}
+	return out, nil
+}
+
+// rangeCounts counts the matching documents with a value of the facet name in
+// each of ranges, as refining on the range would.
+func (q *compiled) rangeCounts(ctx context.Context, s *store, h *sql.DB, name string, ranges []search.Range) ([]search.FacetResult, error) {
+	values := make([]search.FacetResult, 0, len(ranges))
+	for _, r := range ranges {
+		cond, condArgs := rangeCond(r)
+		args := append(append([]interface{}{name}, condArgs...), q.fromArgs...)
+		var count int
+		if err := h.QueryRowContext(ctx, s.bind(`
+			SELECT COUNT(DISTINCT f.doc) FROM search_facets f
+			WHERE f.name = ? AND `+cond+` AND f.doc IN (SELECT d.seq FROM `+q.from+`)`), args...).Scan(&count); err != nil {
+			return nil, err
+		}
+		values = append(values, search.FacetResult{Name: name, Value: r, Count: count})
+	}
+	return values, nil
+}
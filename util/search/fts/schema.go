@@ -0,0 +1,83 @@
+package fts
+
+// The index's tables, per dialect. Every statement is safe to run again; the
+// Backend applies them the first time it touches a namespace's store.
+//
+// search_docs is the document of record: its seq is the FTS5 rowid on SQLite
+// and what search_facets rows point at on both. updated_at is Unix
+// nanoseconds, the order an empty query lists in.
+//
+// search_terms is each index's vocabulary, what a fuzzy search corrects a
+// misspelt word against. It only grows: a word whose documents are all gone
+// stays until the index is dropped, and correcting to it finds nothing, which
+// is what the misspelling found anyway.
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS search_docs (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		ns          TEXT    NOT NULL,
+		idx         TEXT    NOT NULL,
+		id          TEXT    NOT NULL,
+		doc         TEXT    NOT NULL,
+		body        TEXT    NOT NULL,
+		updated_at  INTEGER NOT NULL,
+
+		UNIQUE (ns, idx, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_docs_updated ON search_docs (ns, idx, updated_at)`,
+
+	// body is already lowercase words split on anything else (see tokens),
+	// so the tokenizer has nothing left to decide.
+	`CREATE VIRTUAL TABLE IF NOT EXISTS search_fts USING fts5 (body, tokenize = 'unicode61')`,
+
+	`CREATE TABLE IF NOT EXISTS search_facets (
+		doc    INTEGER NOT NULL REFERENCES search_docs (seq),
+		name   TEXT    NOT NULL,
+		value  TEXT    NOT NULL,
+		num    REAL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_facets_doc  ON search_facets (doc)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_facets_name ON search_facets (name, value)`,
+
+	`CREATE TABLE IF NOT EXISTS search_terms (
+		ns    TEXT NOT NULL,
+		idx   TEXT NOT NULL,
+		term  TEXT NOT NULL,
+
+		PRIMARY KEY (ns, idx, term)
+	) WITHOUT ROWID`,
+}
+
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS search_docs (
+		seq         BIGSERIAL PRIMARY KEY,
+		ns          TEXT      NOT NULL,
+		idx         TEXT      NOT NULL,
+		id          TEXT      NOT NULL,
+		doc         JSONB     NOT NULL,
+		body        TEXT      NOT NULL,
+		tsv         TSVECTOR  GENERATED ALWAYS AS (to_tsvector('simple', body)) STORED,
+		updated_at  BIGINT    NOT NULL,
+
+		UNIQUE (ns, idx, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_docs_updated ON search_docs (ns, idx, updated_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_docs_tsv     ON search_docs USING GIN (tsv)`,
+
+	`CREATE TABLE IF NOT EXISTS search_facets (
+		doc    BIGINT           NOT NULL REFERENCES search_docs (seq),
+		name   TEXT             NOT NULL,
+		value  TEXT             NOT NULL,
+		num    DOUBLE PRECISION
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_facets_doc  ON search_facets (doc)`,
+	`CREATE INDEX IF NOT EXISTS idx_search_facets_name ON search_facets (name, value)`,
+
+	`CREATE TABLE IF NOT EXISTS search_terms (
+		ns    TEXT NOT NULL,
+		idx   TEXT NOT NULL,
+		term  TEXT NOT NULL,
+
+		PRIMARY KEY (ns, idx, term)
+	)`,
+}
@@ -20,6 +20,10 @@ var (
 
 	// ErrIndexNotFound is returned when the requested index doesn't exist.
 	ErrIndexNotFound = errors.New("search: index not found")
+
+	// ErrNoSuchDocument is returned by Index.Get when the index holds no
+	// document with the given ID.
+	ErrNoSuchDocument = errors.New("search: no such document")
 )
 
 // Backend is the interface that search backends must implement.
@@ -80,6 +84,11 @@ type SearchOptions struct {
 
 	// CountAccuracy configures count accuracy.
 	CountAccuracy int
+
+	// Fuzzy tolerates typos: a query word that matches nothing is searched
+	// as the closest word the index does hold, if one is close enough.
+	// Backends without a vocabulary to correct against ignore it.
+	Fuzzy bool
 }
 
 // SortOptions configures result sorting.
@@ -130,6 +139,11 @@ type FacetSearchOption struct {
 
 	// DiscoveryLimit limits the number of facets discovered (for auto-discovery).
 	DiscoveryLimit int
+
+	// Ranges buckets a numeric facet: one FacetResult per range, in the
+	// order given, whose Value is the Range. A range nothing falls in is
+	// counted as zero rather than left out.
+	Ranges []Range
 }
 
 // Range represents a numeric range for faceting.
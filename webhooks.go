@@ -0,0 +1,34 @@
+package commerce
+
+import (
+	"context"
+
+	"github.com/hanzoai/commerce/datastore"
+	"github.com/hanzoai/commerce/log"
+	"github.com/hanzoai/commerce/models/webhook"
+	"github.com/hanzoai/commerce/util/nscontext"
+)
+
+// upgradeWebhooks brings every org's webhooks up to the current revision (see
+// webhook.Upgrade) before any delivery is made, so that a webhook stored when
+// Enabled was ignored keeps receiving events. Once every webhook has been
+// saved since, it reads them and writes nothing. An org it cannot reach is
+// logged and retried on the next start; its old webhooks stay quiet until
+// then.
+func (app *App) upgradeWebhooks(ctx context.Context) {
+	namespaces, err := app.orgNamespaces(ctx)
+	if err != nil {
+		log.Error("webhooks: %v", err, ctx)
+		return
+	}
+	for _, ns := range namespaces {
+		n, err := webhook.Upgrade(datastore.NewNamespaced(nscontext.WithNamespace(ctx, ns)))
+		if err != nil {
+			log.Error("webhooks: upgrading %s: %v", ns, err, ctx)
+			continue
+		}
+		if n > 0 {
+			log.Info("webhooks: upgraded %d webhook(s) in %s", n, ns, ctx)
+		}
+	}
+}